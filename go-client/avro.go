@@ -0,0 +1,551 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// A minimal Avro binary reader, so the client can inspect what the server
+// stored without an Avro library. It covers every schema type; logical
+// types are read as their underlying type.
+
+// avroSchema is a parsed schema node.
+type avroSchema struct {
+	kind     string // a primitive name, record, enum, array, map, fixed or union
+	name     string // full name of named types
+	fields   []avroField
+	symbols  []string
+	items    *avroSchema // array items and map values
+	size     int
+	branches []*avroSchema
+}
+
+type avroField struct {
+	name   string
+	schema *avroSchema
+}
+
+var avroPrimitives = map[string]bool{
+	"null": true, "boolean": true, "int": true, "long": true,
+	"float": true, "double": true, "bytes": true, "string": true,
+}
+
+// parseAvroSchema parses the JSON text of a schema.
+func parseAvroSchema(text []byte) (*avroSchema, error) {
+	var v interface{}
+	if err := json.Unmarshal(text, &v); err != nil {
+		return nil, fmt.Errorf("schema is not JSON: %w", err)
+	}
+	return parseAvroNode(v, "", map[string]*avroSchema{})
+}
+
+func parseAvroNode(v interface{}, namespace string, names map[string]*avroSchema) (*avroSchema, error) {
+	switch t := v.(type) {
+	case string:
+		if avroPrimitives[t] {
+			return &avroSchema{kind: t}, nil
+		}
+		if s, ok := names[qualifyAvroName(t, namespace)]; ok {
+			return s, nil
+		}
+		if s, ok := names[t]; ok {
+			return s, nil
+		}
+		return nil, fmt.Errorf("unknown type %q", t)
+	case []interface{}:
+		union := &avroSchema{kind: "union"}
+		for _, branch := range t {
+			s, err := parseAvroNode(branch, namespace, names)
+			if err != nil {
+				return nil, err
+			}
+			union.branches = append(union.branches, s)
+		}
+		return union, nil
+	case map[string]interface{}:
+		kind, ok := t["type"].(string)
+		if !ok {
+			// {"type": {...}} or {"type": [...]} wraps another schema.
+			return parseAvroNode(t["type"], namespace, names)
+		}
+		switch kind {
+		case "record", "error", "enum", "fixed":
+			name, _ := t["name"].(string)
+			if name == "" {
+				return nil, fmt.Errorf("%s without a name", kind)
+			}
+			if ns, ok := t["namespace"].(string); ok && !strings.Contains(name, ".") {
+				namespace = ns
+			}
+			s := &avroSchema{kind: kind, name: qualifyAvroName(name, namespace)}
+			if i := strings.LastIndex(s.name, "."); i >= 0 {
+				namespace = s.name[:i]
+			}
+			// Register before the fields so records can refer to themselves.
+			names[s.name] = s
+			switch kind {
+			case "enum":
+				for _, symbol := range t["symbols"].([]interface{}) {
+					s.symbols = append(s.symbols, fmt.Sprint(symbol))
+				}
+			case "fixed":
+				size, _ := t["size"].(float64)
+				s.size = int(size)
+			default:
+				s.kind = "record"
+				fields, _ := t["fields"].([]interface{})
+				for _, f := range fields {
+					field, _ := f.(map[string]interface{})
+					fieldName, _ := field["name"].(string)
+					fs, err := parseAvroNode(field["type"], namespace, names)
+					if err != nil {
+						return nil, fmt.Errorf("field %s.%s: %w", s.name, fieldName, err)
+					}
+					s.fields = append(s.fields, avroField{name: fieldName, schema: fs})
+				}
+			}
+			return s, nil
+		case "array":
+			items, err := parseAvroNode(t["items"], namespace, names)
+			if err != nil {
+				return nil, err
+			}
+			return &avroSchema{kind: "array", items: items}, nil
+		case "map":
+			values, err := parseAvroNode(t["values"], namespace, names)
+			if err != nil {
+				return nil, err
+			}
+			return &avroSchema{kind: "map", items: values}, nil
+		default:
+			// A primitive, possibly annotated with a logical type.
+			return parseAvroNode(kind, namespace, names)
+		}
+	}
+	return nil, fmt.Errorf("invalid schema node %v", v)
+}
+
+func qualifyAvroName(name, namespace string) string {
+	if strings.Contains(name, ".") || namespace == "" {
+		return name
+	}
+	return namespace + "." + name
+}
+
+// typeName is the name a union branch is labelled with in Avro JSON.
+func (s *avroSchema) typeName() string {
+	if s.name != "" {
+		return s.name
+	}
+	return s.kind
+}
+
+// avroRecord keeps a decoded record's fields in schema order when
+// marshaled to JSON.
+type avroRecord struct {
+	names  []string
+	values []interface{}
+}
+
+func (r avroRecord) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, name := range r.names {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(name)
+		value, err := json.Marshal(r.values[i])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// avroReader decodes Avro binary values from a buffer.
+type avroReader struct {
+	data []byte
+	pos  int
+	// stripUnions returns union values bare instead of as
+	// {"type": value}, the way /decode's strip_unions does.
+	stripUnions bool
+}
+
+var errAvroShort = errors.New("unexpected end of Avro data")
+
+func (r *avroReader) long() (int64, error) {
+	v, n := binary.Varint(r.data[r.pos:])
+	if n <= 0 {
+		return 0, errAvroShort
+	}
+	r.pos += n
+	return v, nil
+}
+
+func (r *avroReader) next(n int) ([]byte, error) {
+	if n < 0 || r.pos+n > len(r.data) {
+		return nil, errAvroShort
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+func (r *avroReader) bytes() ([]byte, error) {
+	n, err := r.long()
+	if err != nil {
+		return nil, err
+	}
+	return r.next(int(n))
+}
+
+// avroJSONBytes renders bytes the way Avro JSON does, one code point per
+// byte.
+func avroJSONBytes(b []byte) string {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+func (r *avroReader) read(s *avroSchema) (interface{}, error) {
+	switch s.kind {
+	case "null":
+		return nil, nil
+	case "boolean":
+		b, err := r.next(1)
+		if err != nil {
+			return nil, err
+		}
+		return b[0] != 0, nil
+	case "int", "long":
+		return r.long()
+	case "float":
+		b, err := r.next(4)
+		if err != nil {
+			return nil, err
+		}
+		return jsonFloat(float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))), nil
+	case "double":
+		b, err := r.next(8)
+		if err != nil {
+			return nil, err
+		}
+		return jsonFloat(math.Float64frombits(binary.LittleEndian.Uint64(b))), nil
+	case "bytes":
+		b, err := r.bytes()
+		if err != nil {
+			return nil, err
+		}
+		return avroJSONBytes(b), nil
+	case "string":
+		b, err := r.bytes()
+		return string(b), err
+	case "fixed":
+		b, err := r.next(s.size)
+		if err != nil {
+			return nil, err
+		}
+		return avroJSONBytes(b), nil
+	case "enum":
+		i, err := r.long()
+		if err != nil {
+			return nil, err
+		}
+		if i < 0 || int(i) >= len(s.symbols) {
+			return nil, fmt.Errorf("enum %s has no symbol %d", s.name, i)
+		}
+		return s.symbols[i], nil
+	case "record":
+		rec := avroRecord{}
+		for _, f := range s.fields {
+			v, err := r.read(f.schema)
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %w", s.name, f.name, err)
+			}
+			rec.names = append(rec.names, f.name)
+			rec.values = append(rec.values, v)
+		}
+		return rec, nil
+	case "array":
+		items := []interface{}{}
+		err := r.blocks(func() error {
+			v, err := r.read(s.items)
+			items = append(items, v)
+			return err
+		})
+		return items, err
+	case "map":
+		values := map[string]interface{}{}
+		err := r.blocks(func() error {
+			key, err := r.bytes()
+			if err != nil {
+				return err
+			}
+			v, err := r.read(s.items)
+			values[string(key)] = v
+			return err
+		})
+		return values, err
+	case "union":
+		i, err := r.long()
+		if err != nil {
+			return nil, err
+		}
+		if i < 0 || int(i) >= len(s.branches) {
+			return nil, fmt.Errorf("union has no branch %d", i)
+		}
+		branch := s.branches[i]
+		v, err := r.read(branch)
+		if err != nil || branch.kind == "null" || r.stripUnions {
+			return v, err
+		}
+		return map[string]interface{}{branch.typeName(): v}, nil
+	}
+	return nil, fmt.Errorf("unsupported type %s", s.kind)
+}
+
+// blocks reads the blocks of an array or map, calling item for each item.
+func (r *avroReader) blocks(item func() error) error {
+	for {
+		count, err := r.long()
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return nil
+		}
+		if count < 0 {
+			// A negative count is followed by the block's size in bytes.
+			count = -count
+			if _, err := r.long(); err != nil {
+				return err
+			}
+		}
+		for ; count > 0; count-- {
+			if err := item(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// jsonFloat keeps NaN and infinities, which JSON cannot hold, printable.
+func jsonFloat(f float64) interface{} {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	return f
+}
+
+// decodeAvroStream reads consecutive data of schema until data is used up.
+func decodeAvroStream(schema *avroSchema, data []byte, stripUnions bool, each func(interface{}) error) error {
+	r := &avroReader{data: data, stripUnions: stripUnions}
+	for r.pos < len(data) {
+		v, err := r.read(schema)
+		if err != nil {
+			return err
+		}
+		if err := each(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Object Container Files.
+
+var ocfMagic = []byte("Obj\x01")
+
+// ocfFile is a parsed container file header with its remaining blocks.
+type ocfFile struct {
+	schema     *avroSchema
+	schemaText string
+	codec      string
+	sync       []byte
+	r          *avroReader
+}
+
+func openOCF(data []byte) (*ocfFile, error) {
+	r := &avroReader{data: data, pos: len(ocfMagic)}
+	meta := map[string][]byte{}
+	err := r.blocks(func() error {
+		key, err := r.bytes()
+		if err != nil {
+			return err
+		}
+		value, err := r.bytes()
+		meta[string(key)] = value
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("container header: %w", err)
+	}
+	sync, err := r.next(16)
+	if err != nil {
+		return nil, fmt.Errorf("container header: %w", err)
+	}
+	f := &ocfFile{schemaText: string(meta["avro.schema"]), codec: string(meta["avro.codec"]), sync: sync, r: r}
+	if f.codec == "" {
+		f.codec = "null"
+	}
+	if f.schema, err = parseAvroSchema(meta["avro.schema"]); err != nil {
+		return nil, fmt.Errorf("embedded schema: %w", err)
+	}
+	return f, nil
+}
+
+// each calls fn with every record of the file, in order.
+func (f *ocfFile) each(stripUnions bool, fn func(interface{}) error) error {
+	for f.r.pos < len(f.r.data) {
+		count, err := f.r.long()
+		if err != nil {
+			return err
+		}
+		block, err := f.r.bytes()
+		if err != nil {
+			return fmt.Errorf("block of %d records: %w", count, err)
+		}
+		sync, err := f.r.next(16)
+		if err != nil || !bytes.Equal(sync, f.sync) {
+			return errors.New("block is not followed by the file's sync marker")
+		}
+		if block, err = decompressOCFBlock(f.codec, block); err != nil {
+			return err
+		}
+		r := &avroReader{data: block, stripUnions: stripUnions}
+		for ; count > 0; count-- {
+			v, err := r.read(f.schema)
+			if err != nil {
+				return err
+			}
+			if err := fn(v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func decompressOCFBlock(codec string, block []byte) ([]byte, error) {
+	switch codec {
+	case "null":
+		return block, nil
+	case "deflate":
+		return inflate(block)
+	case "snappy":
+		return unsnappyBlock(block)
+	}
+	return nil, fmt.Errorf("unsupported OCF codec %q", codec)
+}
+
+// inflate decompresses a deflate block, which Avro stores as raw deflate
+// without a zlib header.
+func inflate(block []byte) ([]byte, error) {
+	out, err := io.ReadAll(flate.NewReader(bytes.NewReader(block)))
+	if err != nil {
+		return nil, fmt.Errorf("cannot decompress deflate block: %w", err)
+	}
+	return out, nil
+}
+
+// unsnappyBlock decompresses a snappy block, which Avro follows with the
+// big-endian CRC-32 of the uncompressed data.
+func unsnappyBlock(block []byte) ([]byte, error) {
+	if len(block) < 4 {
+		return nil, errors.New("snappy block is too short for its checksum")
+	}
+	out, err := unsnappy(block[:len(block)-4])
+	if err != nil {
+		return nil, fmt.Errorf("cannot decompress snappy block: %w", err)
+	}
+	if crc32.ChecksumIEEE(out) != binary.BigEndian.Uint32(block[len(block)-4:]) {
+		return nil, errors.New("snappy block checksum mismatch")
+	}
+	return out, nil
+}
+
+// unsnappy decodes the snappy block format: the uncompressed length, then
+// a sequence of literals and back-references.
+func unsnappy(src []byte) ([]byte, error) {
+	n, k := binary.Uvarint(src)
+	if k <= 0 || n > 1<<30 {
+		return nil, errors.New("invalid snappy length")
+	}
+	src = src[k:]
+	dst := make([]byte, 0, n)
+	for len(src) > 0 {
+		tag := src[0]
+		var length, offset int
+		switch tag & 3 {
+		case 0: // literal
+			length = int(tag >> 2)
+			src = src[1:]
+			if length >= 60 {
+				extra := length - 59
+				if len(src) < extra {
+					return nil, errAvroShort
+				}
+				length = 0
+				for i := extra - 1; i >= 0; i-- {
+					length = length<<8 | int(src[i])
+				}
+				src = src[extra:]
+			}
+			length++
+			if len(src) < length {
+				return nil, errAvroShort
+			}
+			dst = append(dst, src[:length]...)
+			src = src[length:]
+			continue
+		case 1:
+			if len(src) < 2 {
+				return nil, errAvroShort
+			}
+			length = 4 + int(tag>>2&7)
+			offset = int(tag&0xe0)<<3 | int(src[1])
+			src = src[2:]
+		case 2:
+			if len(src) < 3 {
+				return nil, errAvroShort
+			}
+			length = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint16(src[1:]))
+			src = src[3:]
+		case 3:
+			if len(src) < 5 {
+				return nil, errAvroShort
+			}
+			length = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint32(src[1:]))
+			src = src[5:]
+		}
+		if offset <= 0 || offset > len(dst) {
+			return nil, errors.New("invalid snappy back-reference")
+		}
+		// Copies may overlap the bytes they produce.
+		for i := 0; i < length; i++ {
+			dst = append(dst, dst[len(dst)-offset])
+		}
+	}
+	if len(dst) != int(n) {
+		return nil, errors.New("snappy length mismatch")
+	}
+	return dst, nil
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// batchResult is the outcome of one log request of a batch.
+type batchResult struct {
+	size     string
+	latency  time.Duration
+	err      string // transport error or HTTP status, empty on success
+	attempts int
+
+	originalSize, wrapperSize, logdataSize int
+	stats                                  map[string]interface{} // compression_stats, for --output
+}
+
+// batchTotals aggregates the results of one payload size.
+type batchTotals struct {
+	ok, failed                             int
+	originalBytes, wrapperBytes, dataBytes int
+	latencies                              []time.Duration
+}
+
+func (t *batchTotals) add(r batchResult) {
+	if r.err != "" {
+		t.failed++
+		return
+	}
+	t.ok++
+	t.originalBytes += r.originalSize
+	t.wrapperBytes += r.wrapperSize
+	t.dataBytes += r.logdataSize
+	t.latencies = append(t.latencies, r.latency)
+}
+
+// runLogBatch sends --count /log requests from --concurrency workers and
+// prints the compression stats of all of them per payload size, so the
+// server can be exercised under parallel load.
+func runLogBatch(args []string) {
+	fs := flag.NewFlagSet("log batch", flag.ExitOnError)
+	count := fs.Int("count", 100, "number of log requests to send")
+	concurrency := fs.Int("concurrency", 8, "concurrent workers")
+	size := fs.String("size", "small", "log size: small, medium, large or random (picked per request)")
+	fs.Parse(args)
+
+	if *count < 1 || *concurrency < 1 {
+		fmt.Println("❌ --count and --concurrency must be at least 1")
+		return
+	}
+	sizes := []string{*size}
+	if *size == "random" {
+		sizes = []string{"small", "medium", "large"}
+	}
+	bodies, err := logBodies(sizes)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return
+	}
+
+	fmt.Printf("📦 Sending %d %s logs via %s with %d workers...\n", *count, *size, transport.Name(), *concurrency)
+	results := make([]batchResult, *count)
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	start := time.Now()
+	for w := 0; w < *concurrency; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(time.Now().UnixNano() + int64(w)))
+			for {
+				if rootCtx.Err() != nil {
+					return
+				}
+				i := int(next.Add(1) - 1)
+				if i >= *count {
+					return
+				}
+				s := sizes[rng.Intn(len(sizes))]
+				results[i] = sendBatchLog(rootCtx, s, bodies[s])
+			}
+		}(w)
+	}
+	wg.Wait()
+	// After Ctrl-C only the requests handed out were sent.
+	results = results[:min(int(next.Load()), *count)]
+	emitBatchResults("log batch", results)
+	printBatchReport(sizes, results, time.Since(start))
+}
+
+// logBodies marshals one /log request of each size.
+func logBodies(sizes []string) (map[string][]byte, error) {
+	bodies := make(map[string][]byte, len(sizes))
+	for _, s := range sizes {
+		var logReq LogRequest
+		switch s {
+		case "small":
+			logReq = createSmallLogData()
+		case "medium":
+			logReq = createMediumLogData()
+		case "large":
+			logReq = createLargeLogData()
+		default:
+			return nil, fmt.Errorf("unknown size: %s", s)
+		}
+		body, err := json.Marshal(logReq)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal request: %w", err)
+		}
+		bodies[s] = body
+	}
+	return bodies, nil
+}
+
+func sendBatchLog(ctx context.Context, size string, body []byte) batchResult {
+	r := batchResult{size: size}
+	start := time.Now()
+	resp, err := transport.Send(ctx, logPath, body)
+	r.latency = time.Since(start)
+	if resp != nil {
+		r.attempts = resp.Attempts
+	}
+	if err != nil {
+		r.err = err.Error()
+		return r
+	}
+	if err := resp.Err(); err != nil {
+		r.err = err.Error()
+		return r
+	}
+	var logResp LogResponse
+	if err := json.Unmarshal(resp.Body, &logResp); err != nil {
+		r.err = "invalid response: " + err.Error()
+		return r
+	}
+	r.stats = logResp.CompressionStats
+	r.originalSize = getIntValue(logResp.CompressionStats, "original_json_size")
+	r.wrapperSize = getIntValue(logResp.CompressionStats, "wrapper_avro_size")
+	r.logdataSize = getIntValue(logResp.CompressionStats, "logdata_avro_size")
+	return r
+}
+
+// emitBatchResults emits one --output row per request.
+func emitBatchResults(command string, results []batchResult) {
+	for i, r := range results {
+		row := newResult(command).set("request", i+1).set("size", r.size).setLatency("latency_ms", r.latency).set("attempts", r.attempts)
+		if r.err != "" {
+			row.set("error", r.err)
+		}
+		emitResult(row.setStats(r.stats))
+	}
+}
+
+func printBatchReport(sizes []string, results []batchResult, elapsed time.Duration) {
+	bySize := make(map[string]*batchTotals, len(sizes))
+	for _, s := range sizes {
+		bySize[s] = &batchTotals{}
+	}
+	var all batchTotals
+	failures := map[string]int{}
+	for _, r := range results {
+		bySize[r.size].add(r)
+		all.add(r)
+		if r.err != "" {
+			failures[r.err]++
+		}
+	}
+
+	fmt.Printf("\n=== 📦 Batch Results (%d requests in %v, %.1f req/s) ===\n", len(results), elapsed.Round(time.Millisecond), float64(len(results))/elapsed.Seconds())
+	fmt.Printf("%-8s %6s %6s %12s %12s %12s %9s %9s %12s %10s %10s\n",
+		"size", "ok", "failed", "json bytes", "wrapper", "logdata", "wrapper%", "logdata%", "saved", "p50", "p99")
+	row := func(name string, t *batchTotals) {
+		sort.Slice(t.latencies, func(i, j int) bool { return t.latencies[i] < t.latencies[j] })
+		wrapperRatio, dataRatio := 0.0, 0.0
+		if t.originalBytes > 0 {
+			wrapperRatio = float64(t.wrapperBytes) / float64(t.originalBytes) * 100
+			dataRatio = float64(t.dataBytes) / float64(t.originalBytes) * 100
+		}
+		fmt.Printf("%-8s %6d %6d %12d %12d %12d %8.2f%% %8.2f%% %12d %10v %10v\n",
+			name, t.ok, t.failed, t.originalBytes, t.wrapperBytes, t.dataBytes, wrapperRatio, dataRatio,
+			t.originalBytes-t.wrapperBytes, percentile(t.latencies, 50), percentile(t.latencies, 99))
+	}
+	for _, s := range sizes {
+		row(s, bySize[s])
+	}
+	if len(sizes) > 1 {
+		row("total", &all)
+	}
+
+	if len(failures) > 0 {
+		fmt.Printf("\n❌ Failures:\n")
+		for msg, n := range failures {
+			fmt.Printf("  %6d × %s\n", n, msg)
+		}
+	}
+}
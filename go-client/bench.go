@@ -0,0 +1,423 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// benchOp is one kind of request in a mixed bench scenario.
+type benchOp struct {
+	name string
+	do   func(ctx context.Context) (*Response, error)
+}
+
+// benchSample is the outcome of one request.
+type benchSample struct {
+	op      int
+	latency time.Duration
+	failed  bool
+}
+
+// runMixedBench drives ingestion (/log) and reads (/logs/replay, /decode)
+// concurrently at the ratios given by --mix and reports latency
+// percentiles per endpoint. With --baseline every endpoint is first run on
+// its own, so the mixed numbers show what contention between the encode
+// pipeline and storage scans costs.
+func runMixedBench(args []string) {
+	fs := flag.NewFlagSet("bench mixed", flag.ExitOnError)
+	duration := fs.Duration("duration", 10*time.Second, "how long each phase runs")
+	concurrency := fs.Int("concurrency", 8, "concurrent workers")
+	mix := fs.String("mix", "log=8,replay=1,decode=1", "relative weights of log, replay and decode requests")
+	size := fs.String("size", "small", "log size sent to /log: small, medium or large")
+	replayLimit := fs.Int("replay-limit", 100, "records read per /logs/replay request")
+	baseline := fs.Bool("baseline", false, "run every endpoint alone before the mix for comparison")
+	fs.Parse(args)
+
+	ops, err := newBenchOps(*size, *replayLimit)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return
+	}
+	weights, err := parseBenchMix(*mix, ops)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return
+	}
+	if *concurrency < 1 {
+		fmt.Println("❌ --concurrency must be at least 1")
+		return
+	}
+	for i, op := range ops {
+		if op.name == "replay" && weights[i] > 0 {
+			if _, ok := transport.(fetcher); !ok {
+				fmt.Printf("❌ replay requests need GET, which the %s transport cannot send; use --transport http or h2c, or drop replay from --mix\n", transport.Name())
+				return
+			}
+		}
+	}
+
+	// Seed storage so the first scans have something to read.
+	if _, err := ops[0].do(rootCtx); err != nil {
+		fmt.Printf("❌ Failed to seed a log: %v\n", err)
+		return
+	}
+
+	fmt.Printf("🏋️  Mixed bench via %s: %d workers, %v per phase, mix %s\n", transport.Name(), *concurrency, *duration, *mix)
+
+	var alone [][]time.Duration
+	if *baseline {
+		alone = make([][]time.Duration, len(ops))
+		for i, op := range ops {
+			if weights[i] == 0 {
+				continue
+			}
+			only := make([]int, len(ops))
+			only[i] = 1
+			fmt.Printf("⏳ Baseline: %s alone...\n", op.name)
+			samples := runBenchPhase(ops, only, *concurrency, *duration)
+			alone[i] = benchLatencies(samples, len(ops))[i]
+		}
+	}
+
+	fmt.Println("⏳ Mixed load...")
+	samples := runBenchPhase(ops, weights, *concurrency, *duration)
+	printBenchReport(ops, weights, samples, alone, *duration)
+}
+
+// newBenchOps returns the log, replay and decode operations, in that order.
+func newBenchOps(size string, replayLimit int) ([]benchOp, error) {
+	var logReq LogRequest
+	switch size {
+	case "small":
+		logReq = createSmallLogData()
+	case "medium":
+		logReq = createMediumLogData()
+	case "large":
+		logReq = createLargeLogData()
+	default:
+		return nil, fmt.Errorf("unknown size: %s", size)
+	}
+	logBody, err := json.Marshal(logReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal log request: %w", err)
+	}
+	decodeBody, err := json.Marshal(map[string]interface{}{
+		"schema": "LogData",
+		"data": base64.StdEncoding.EncodeToString(encodeLogDataBinary(LogData{
+			Timestamp: time.Now().UnixMilli(),
+			Logtype:   "bench",
+			Version:   "1.0",
+			Issuer:    "go-client",
+		})),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal decode request: %w", err)
+	}
+	replayPath := "/logs/replay?limit=" + strconv.Itoa(replayLimit)
+
+	return []benchOp{
+		{name: "log", do: func(ctx context.Context) (*Response, error) {
+			return transport.Send(ctx, logPath, logBody)
+		}},
+		{name: "replay", do: func(ctx context.Context) (*Response, error) {
+			f, ok := transport.(fetcher)
+			if !ok {
+				return nil, errors.New("transport cannot send GET requests")
+			}
+			return f.Get(ctx, replayPath)
+		}},
+		{name: "decode", do: func(ctx context.Context) (*Response, error) {
+			return transport.Send(ctx, "/decode", decodeBody)
+		}},
+	}, nil
+}
+
+// parseBenchMix parses "log=8,replay=1,decode=1" into weights indexed like
+// ops. Operations left out get weight 0.
+func parseBenchMix(mix string, ops []benchOp) ([]int, error) {
+	names := make([]string, len(ops))
+	for i, op := range ops {
+		names[i] = op.name
+	}
+	return parseWeights("--mix", mix, names)
+}
+
+// parseWeights parses a name=weight list given with flag into weights
+// indexed like names.
+func parseWeights(flag, mix string, names []string) ([]int, error) {
+	weights := make([]int, len(names))
+	total := 0
+	for _, part := range strings.Split(mix, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(part, "=")
+		weight, err := strconv.Atoi(value)
+		if !ok || err != nil || weight < 0 {
+			return nil, fmt.Errorf("invalid %s entry %q (expected name=weight)", flag, part)
+		}
+		found := false
+		for i, n := range names {
+			if n == name {
+				weights[i] = weight
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown %s entry %q (expected %s)", flag, name, strings.Join(names, ", "))
+		}
+		total += weight
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("%s needs at least one positive weight", flag)
+	}
+	return weights, nil
+}
+
+// runBenchPhase runs workers that each pick operations at random by weight
+// until duration has passed.
+func runBenchPhase(ops []benchOp, weights []int, concurrency int, duration time.Duration) []benchSample {
+	total := 0
+	for _, w := range weights {
+		total += w
+	}
+	deadline := time.Now().Add(duration)
+	ctx, cancel := context.WithDeadline(rootCtx, deadline)
+	defer cancel()
+
+	results := make([][]benchSample, concurrency)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(time.Now().UnixNano() + int64(w)))
+			for ctx.Err() == nil {
+				op := pickBenchOp(weights, rng.Intn(total))
+				start := time.Now()
+				resp, err := ops[op].do(ctx)
+				end := time.Now()
+				if !end.Before(deadline) || rootCtx.Err() != nil {
+					// Requests cut off by the end of the phase, or by Ctrl-C,
+					// are not samples.
+					return
+				}
+				results[w] = append(results[w], benchSample{
+					op:      op,
+					latency: end.Sub(start),
+					failed:  err != nil || resp.StatusCode >= 400,
+				})
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	var samples []benchSample
+	for _, r := range results {
+		samples = append(samples, r...)
+	}
+	return samples
+}
+
+func pickBenchOp(weights []int, n int) int {
+	for i, w := range weights {
+		if n < w {
+			return i
+		}
+		n -= w
+	}
+	return len(weights) - 1
+}
+
+// benchLatencies groups the latencies of successful samples by operation,
+// sorted ascending.
+func benchLatencies(samples []benchSample, ops int) [][]time.Duration {
+	out := make([][]time.Duration, ops)
+	for _, s := range samples {
+		if !s.failed {
+			out[s.op] = append(out[s.op], s.latency)
+		}
+	}
+	for _, l := range out {
+		sort.Slice(l, func(i, j int) bool { return l[i] < l[j] })
+	}
+	return out
+}
+
+// percentile returns the p-th percentile (0-100) of sorted latencies using
+// the nearest-rank method.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+func printBenchReport(ops []benchOp, weights []int, samples []benchSample, alone [][]time.Duration, duration time.Duration) {
+	latencies := benchLatencies(samples, len(ops))
+	failures := make([]int, len(ops))
+	for _, s := range samples {
+		if s.failed {
+			failures[s.op]++
+		}
+	}
+
+	fmt.Printf("\n=== 📈 Latency Percentiles (mixed load) ===\n")
+	fmt.Printf("%-8s %8s %8s %7s %10s %10s %10s %10s %10s\n", "endpoint", "ok", "failed", "req/s", "p50", "p90", "p95", "p99", "max")
+	for i, op := range ops {
+		if weights[i] == 0 {
+			continue
+		}
+		l := latencies[i]
+		row := newResult("bench mixed").set("endpoint", op.name).set("ok", len(l)).set("failed", failures[i]).
+			set("rps", float64(len(l))/duration.Seconds()).setLatency("p50_ms", percentile(l, 50)).
+			setLatency("p90_ms", percentile(l, 90)).setLatency("p95_ms", percentile(l, 95)).
+			setLatency("p99_ms", percentile(l, 99)).setLatency("max_ms", percentile(l, 100))
+		if alone != nil && len(alone[i]) > 0 {
+			row.setLatency("p50_alone_ms", percentile(alone[i], 50)).setLatency("p99_alone_ms", percentile(alone[i], 99))
+		}
+		emitResult(row)
+		fmt.Printf("%-8s %8d %8d %7.1f %10v %10v %10v %10v %10v\n", op.name, len(l), failures[i],
+			float64(len(l))/duration.Seconds(),
+			percentile(l, 50), percentile(l, 90), percentile(l, 95), percentile(l, 99), percentile(l, 100))
+	}
+
+	if alone == nil {
+		return
+	}
+	fmt.Printf("\n=== ⚖️  Mixed vs Alone ===\n")
+	fmt.Printf("%-8s %12s %12s %12s %12s %8s\n", "endpoint", "p50 alone", "p50 mixed", "p99 alone", "p99 mixed", "p99 ×")
+	for i, op := range ops {
+		if weights[i] == 0 || len(alone[i]) == 0 {
+			continue
+		}
+		before, after := percentile(alone[i], 99), percentile(latencies[i], 99)
+		ratio := 0.0
+		if before > 0 {
+			ratio = float64(after) / float64(before)
+		}
+		fmt.Printf("%-8s %12v %12v %12v %12v %7.2fx\n", op.name,
+			percentile(alone[i], 50), percentile(latencies[i], 50), before, after, ratio)
+	}
+}
+
+// encodeLogDataBinary encodes d as a LogData Avro datum, so /decode and
+// /log/binary can be exercised without an Avro library. Map values are
+// converted like the server converts JSON: strings as is, null as "" and
+// anything else as its JSON encoding.
+func encodeLogDataBinary(d LogData) []byte {
+	var out []byte
+	out = binary.AppendVarint(out, d.Timestamp)
+	for _, s := range []string{d.Logtype, d.Version, d.Issuer} {
+		out = appendAvroString(out, s)
+	}
+	for _, m := range []interface{}{d.Metadata, d.DomainData} {
+		values := logStringMap(m)
+		if values == nil {
+			// Branch 0 (null) of the union.
+			out = append(out, 0)
+			continue
+		}
+		out = binary.AppendVarint(out, 1)
+		if len(values) > 0 {
+			out = binary.AppendVarint(out, int64(len(values)))
+			for _, k := range sortedKeys(values) {
+				out = appendAvroString(out, k)
+				out = appendAvroString(out, values[k])
+			}
+		}
+		out = append(out, 0)
+	}
+	return out
+}
+
+// encodeLogWrapperBinary encodes r as a LogWrapper Avro datum whose body is
+// the LogData Avro JSON.
+func encodeLogWrapperBinary(r LogRequest) ([]byte, error) {
+	body, err := json.Marshal(logDataAvroJSON(r.Body))
+	if err != nil {
+		return nil, err
+	}
+	var out []byte
+	for _, s := range []string{r.ProjectName, r.ProjectVersion, string(body), r.LogLevel, r.LogType, r.LogSource} {
+		out = appendAvroString(out, s)
+	}
+	return out, nil
+}
+
+// logDataAvroJSON returns d in Avro JSON form, fields in schema order and
+// maps wrapped in their union branch.
+func logDataAvroJSON(d LogData) avroRecord {
+	rec := avroRecord{
+		names:  []string{"timestamp", "logtype", "version", "issuer", "metadata", "domainData"},
+		values: []interface{}{d.Timestamp, d.Logtype, d.Version, d.Issuer, nil, nil},
+	}
+	for i, m := range []interface{}{d.Metadata, d.DomainData} {
+		if values := logStringMap(m); values != nil {
+			rec.values[4+i] = map[string]interface{}{"map": values}
+		}
+	}
+	return rec
+}
+
+// logStringMap converts a metadata or domainData object to string values,
+// or returns nil when it is absent.
+func logStringMap(m interface{}) map[string]string {
+	if m == nil {
+		return nil
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil || fields == nil {
+		return nil
+	}
+	values := make(map[string]string, len(fields))
+	for k, raw := range fields {
+		var s string
+		switch {
+		case string(raw) == "null":
+		case json.Unmarshal(raw, &s) == nil:
+		default:
+			s = string(raw)
+		}
+		values[k] = s
+	}
+	return values
+}
+
+func appendAvroString(out []byte, s string) []byte {
+	out = binary.AppendVarint(out, int64(len(s)))
+	return append(out, s...)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
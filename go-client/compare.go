@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	neturl "net/url"
+	"sort"
+	"time"
+)
+
+// compareLeg is one way of ingesting the same log.
+type compareLeg struct {
+	name, path, contentType string
+	body                    []byte
+}
+
+// compareTotals are the results of one leg.
+type compareTotals struct {
+	ok, failed int
+	latencies  []time.Duration
+	stats      map[string]interface{} // compression_stats of the last success
+	lastErr    string
+}
+
+// runCompare sends one payload to every ingest endpoint the server has,
+// as JSON to /log and as Avro binary to /log/binary, --count times each,
+// and prints their request sizes, latencies and what the server stored
+// side by side.
+func runCompare(args []string) {
+	if len(args) < 1 || args[0] == "random" || args[0][0] == '-' {
+		fmt.Println("Please specify log size: small, medium or large")
+		return
+	}
+	size := args[0]
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	count := fs.Int("count", 10, "requests per endpoint")
+	fs.Parse(args[1:])
+	if *count < 1 {
+		fmt.Println("❌ --count must be at least 1")
+		return
+	}
+	f, ok := transport.(fetcher)
+	if !ok {
+		fmt.Printf("❌ /log/binary needs an Avro Content-Type, which the %s transport cannot send; use --transport http or h2c\n", transport.Name())
+		return
+	}
+	legs, err := newCompareLegs(size)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return
+	}
+
+	fmt.Printf("⚖️  Comparing encodings of the %s log via %s, %d requests each\n", size, transport.Name(), *count)
+	totals := make([]*compareTotals, len(legs))
+	for i := range totals {
+		totals[i] = &compareTotals{}
+	}
+	// The legs take turns rather than run one after another, so a warming
+	// server or a noisy neighbour affects them alike.
+	for n := 0; n < *count && rootCtx.Err() == nil; n++ {
+		for i, leg := range legs {
+			totals[i].add(sendCompareLeg(rootCtx, f, leg))
+		}
+	}
+	printCompareReport(size, legs, totals)
+}
+
+// newCompareLegs encodes the size's log for every endpoint.
+func newCompareLegs(size string) ([]compareLeg, error) {
+	var logReq LogRequest
+	switch size {
+	case "small":
+		logReq = createSmallLogData()
+	case "medium":
+		logReq = createMediumLogData()
+	case "large":
+		logReq = createLargeLogData()
+	default:
+		return nil, fmt.Errorf("unknown size: %s", size)
+	}
+	jsonBody, err := json.Marshal(logReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	wrapper, err := encodeLogWrapperBinary(logReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode wrapper: %w", err)
+	}
+	query := neturl.Values{
+		"schema":         {"LogData"},
+		"projectName":    {logReq.ProjectName},
+		"projectVersion": {logReq.ProjectVersion},
+		"logLevel":       {logReq.LogLevel},
+		"logType":        {logReq.LogType},
+		"logSource":      {logReq.LogSource},
+	}
+	return []compareLeg{
+		{name: "json", path: logPath, contentType: "application/json", body: jsonBody},
+		{name: "wrapper", path: "/log/binary", contentType: "application/avro", body: wrapper},
+		{name: "logdata", path: "/log/binary?" + query.Encode(), contentType: "application/avro", body: encodeLogDataBinary(logReq.Body)},
+	}, nil
+}
+
+type compareResult struct {
+	latency time.Duration
+	err     string
+	stats   map[string]interface{}
+}
+
+func sendCompareLeg(ctx context.Context, f fetcher, leg compareLeg) compareResult {
+	start := time.Now()
+	resp, err := f.Post(ctx, leg.path, leg.contentType, leg.body)
+	r := compareResult{latency: time.Since(start)}
+	switch {
+	case err != nil:
+		r.err = err.Error()
+	case resp.Err() != nil:
+		r.err = resp.Err().Error()
+	default:
+		var logResp LogResponse
+		if err := json.Unmarshal(resp.Body, &logResp); err != nil {
+			r.err = "invalid response: " + err.Error()
+		}
+		r.stats = logResp.CompressionStats
+	}
+	return r
+}
+
+func (t *compareTotals) add(r compareResult) {
+	if r.err != "" {
+		t.failed++
+		t.lastErr = r.err
+		return
+	}
+	t.ok++
+	t.latencies = append(t.latencies, r.latency)
+	t.stats = r.stats
+}
+
+func printCompareReport(size string, legs []compareLeg, totals []*compareTotals) {
+	jsonSize := len(legs[0].body)
+	fmt.Printf("\n=== ⚖️  Encoding Comparison (%s log) ===\n", size)
+	fmt.Printf("%-8s %-12s %12s %9s %6s %6s %10s %10s %10s %12s %12s\n",
+		"encoding", "endpoint", "request", "vs json", "ok", "failed", "p50", "p99", "mean", "wrapper avro", "logdata avro")
+	for i, leg := range legs {
+		t := totals[i]
+		sort.Slice(t.latencies, func(a, b int) bool { return t.latencies[a] < t.latencies[b] })
+		var mean time.Duration
+		for _, l := range t.latencies {
+			mean += l
+		}
+		if len(t.latencies) > 0 {
+			mean /= time.Duration(len(t.latencies))
+		}
+		endpoint := "/log"
+		if leg.name != "json" {
+			endpoint = "/log/binary"
+		}
+		ratio := float64(len(leg.body)) / float64(jsonSize) * 100
+		fmt.Printf("%-8s %-12s %12d %8.2f%% %6d %6d %10v %10v %10v %12d %12d\n",
+			leg.name, endpoint, len(leg.body), ratio, t.ok, t.failed,
+			percentile(t.latencies, 50), percentile(t.latencies, 99), mean,
+			getIntValue(t.stats, "wrapper_avro_size"), getIntValue(t.stats, "logdata_avro_size"))
+
+		emitResult(newResult("compare").set("size", size).set("encoding", leg.name).set("endpoint", endpoint).
+			set("request_bytes", len(leg.body)).set("vs_json_percent", ratio).set("ok", t.ok).set("failed", t.failed).
+			setLatency("p50_ms", percentile(t.latencies, 50)).setLatency("p99_ms", percentile(t.latencies, 99)).
+			setLatency("mean_ms", mean).setStats(t.stats))
+	}
+
+	for i, leg := range legs {
+		if totals[i].lastErr != "" {
+			fmt.Printf("\n❌ %s: %s\n", leg.name, totals[i].lastErr)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// sealedMagic starts files the server encrypted in multi-tenant mode.
+var sealedMagic = []byte("AJSEAL1\n")
+
+// errDecodeLimit stops decoding once --limit records were printed.
+var errDecodeLimit = errors.New("limit reached")
+
+// runDecode decodes a stored Avro file back to JSON locally, so what the
+// server wrote to avro-logs can be inspected offline. Object Container
+// Files carry their schema; single-object data and bare binaries, such as
+// artifacts, need --schema. Records are printed to stdout as one JSON
+// object per line, whatever --output says, and the summary goes to
+// stderr, so the output can be piped into jq.
+func runDecode(args []string) {
+	fs := flag.NewFlagSet("decode", flag.ExitOnError)
+	schemaFile := fs.String("schema", "", "writer schema (.avsc); required unless the file is an Object Container File")
+	stripUnions := fs.Bool("strip-unions", false, "print union values bare instead of as {\"type\": value}")
+	limit := fs.Int("limit", 0, "stop after this many records (0 prints all)")
+	file, args := splitFileArg(args)
+	fs.Parse(args)
+	if file == "" && fs.NArg() > 0 {
+		file = fs.Arg(0)
+	}
+	if file == "" {
+		fmt.Println("Please specify a file: go run . decode <file.avro> [--schema <schema.avsc>]")
+		return
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return
+	}
+	var schema *avroSchema
+	if *schemaFile != "" {
+		text, err := os.ReadFile(*schemaFile)
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return
+		}
+		if schema, err = parseAvroSchema(text); err != nil {
+			fmt.Printf("❌ %s: %v\n", *schemaFile, err)
+			return
+		}
+	}
+
+	records := 0
+	print := func(v interface{}) error {
+		line, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(resultOut, string(line))
+		records++
+		if *limit > 0 && records >= *limit {
+			return errDecodeLimit
+		}
+		return nil
+	}
+
+	var kind string
+	switch {
+	case bytes.HasPrefix(data, sealedMagic):
+		fmt.Printf("❌ %s is encrypted by multi-tenant mode; fetch it through the server instead\n", file)
+		return
+	case json.Valid(data):
+		fmt.Printf("❌ %s is already JSON, such as an original-json artifact\n", file)
+		return
+	case bytes.HasPrefix(data, ocfMagic):
+		f, err := openOCF(data)
+		if err != nil {
+			fmt.Printf("❌ %s: %v\n", file, err)
+			return
+		}
+		kind = fmt.Sprintf("object container file, codec %s", f.codec)
+		if schema != nil {
+			fmt.Fprintf(os.Stderr, "ℹ️  %s embeds its writer schema; --schema is ignored\n", file)
+		}
+		err = f.each(*stripUnions, print)
+	case len(data) >= 10 && data[0] == 0xC3 && data[1] == 0x01:
+		fingerprint := binary.LittleEndian.Uint64(data[2:10])
+		kind = fmt.Sprintf("single-object datum, schema fingerprint %016x", fingerprint)
+		if schema == nil {
+			fmt.Printf("❌ %s is single-object encoded with schema fingerprint %016x; pass its schema with --schema\n", file, fingerprint)
+			return
+		}
+		err = decodeAvroStream(schema, data[10:], *stripUnions, print)
+	default:
+		kind = "Avro binary"
+		if schema == nil {
+			fmt.Printf("❌ %s is not an Object Container File; pass its writer schema with --schema\n", file)
+			return
+		}
+		err = decodeAvroStream(schema, data, *stripUnions, print)
+	}
+	if err != nil && err != errDecodeLimit {
+		fmt.Printf("❌ %s: failed after %d records: %v\n", file, records, err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "📄 Decoded %d records from %s (%s, %d bytes)\n", records, file, kind, len(data))
+}
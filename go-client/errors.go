@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Failures are typed so callers branch on what went wrong instead of
+// matching messages: errors.Is(err, ErrRateLimited) tells the kind, and
+// errors.As into *ValidationError, *RateLimitedError, *ServerError or
+// *TransportError gives the details. Response.Err parses a failed
+// response's structured body {"code", "message", "field", "request_id", ...},
+// or "error" for the message of servers that predate "message";
+// requests that got no response at all fail with a *TransportError.
+var (
+	ErrValidation  = errors.New("request rejected as invalid")
+	ErrRateLimited = errors.New("rate limited")
+	ErrServer      = errors.New("server error")
+	ErrTransport   = errors.New("transport error")
+)
+
+// APIError is a failed response. Statuses of no other kind, such as 401,
+// 403 and 404, come as a plain *APIError.
+type APIError struct {
+	StatusCode int
+	// Code is the server's error code, such as validation_failed or
+	// quota_exceeded; empty when the body was not an error body.
+	Code      string
+	Message   string
+	RequestID string
+	// Details holds the body's other keys, such as a quota's limit and
+	// used or the plugin that rejected a log.
+	Details map[string]interface{}
+}
+
+func (e *APIError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Code != "" {
+		b.WriteString(" (" + e.Code + ")")
+	}
+	if e.Message != "" {
+		b.WriteString(": " + e.Message)
+	}
+	if e.RequestID != "" {
+		b.WriteString(" [request " + e.RequestID + "]")
+	}
+	return b.String()
+}
+
+// ValidationError is a request the server refused as malformed, not fitting
+// its schema or rejected by a plugin. Field names the offending field when
+// the server knows it.
+type ValidationError struct {
+	APIError
+	Field string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Field == "" {
+		return e.APIError.Error()
+	}
+	return e.APIError.Error() + " (field " + e.Field + ")"
+}
+
+func (e *ValidationError) Is(target error) bool { return target == ErrValidation }
+
+// RateLimitedError is a 429, such as a project over its daily quota.
+// RetryAfter is how long the server asked to wait, 0 when it did not say.
+type RateLimitedError struct {
+	APIError
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitedError) Error() string {
+	if e.RetryAfter <= 0 {
+		return e.APIError.Error()
+	}
+	return fmt.Sprintf("%s (retry after %v)", e.APIError.Error(), e.RetryAfter)
+}
+
+func (e *RateLimitedError) Is(target error) bool { return target == ErrRateLimited }
+
+// ServerError is a 5xx: the server or, in router mode, its backend failed.
+type ServerError struct {
+	APIError
+}
+
+func (e *ServerError) Is(target error) bool { return target == ErrServer }
+
+// TransportError is a request that got no response: the connection
+// failed, an attempt timed out or the reply could not be read, after
+// Attempts tries.
+type TransportError struct {
+	Transport string
+	Attempts  int
+	Err       error
+}
+
+func (e *TransportError) Error() string {
+	if e.Attempts > 1 {
+		return fmt.Sprintf("%s transport: giving up after %d attempts: %v", e.Transport, e.Attempts, e.Err)
+	}
+	return fmt.Sprintf("%s transport: %v", e.Transport, e.Err)
+}
+
+func (e *TransportError) Unwrap() error { return e.Err }
+
+func (e *TransportError) Is(target error) bool { return target == ErrTransport }
+
+// validationCodes are the error codes of requests that are wrong as sent.
+var validationCodes = map[string]bool{
+	"invalid_request":        true,
+	"validation_failed":      true,
+	"unknown_schema":         true,
+	"schema_pinned":          true,
+	"plugin_rejected":        true,
+	"body_too_large":         true,
+	"unsupported_media_type": true,
+}
+
+// Err returns the typed error of a failed response, or nil below 400.
+func (r *Response) Err() error {
+	if r.StatusCode < 400 {
+		return nil
+	}
+	e := APIError{StatusCode: r.StatusCode}
+	var body map[string]interface{}
+	if err := json.Unmarshal(r.Body, &body); err == nil {
+		field, _ := body["field"].(string)
+		e.Code, _ = body["code"].(string)
+		if e.Message, _ = body["message"].(string); e.Message == "" {
+			e.Message, _ = body["error"].(string)
+		}
+		e.RequestID, _ = body["request_id"].(string)
+		for _, key := range []string{"code", "message", "error", "field", "request_id"} {
+			delete(body, key)
+		}
+		if len(body) > 0 {
+			e.Details = body
+		}
+		if r.StatusCode < 500 && r.StatusCode != http.StatusTooManyRequests && (validationCodes[e.Code] || field != "") {
+			return &ValidationError{APIError: e, Field: field}
+		}
+	} else {
+		e.Message = truncateString(strings.TrimSpace(string(r.Body)), 200)
+	}
+	switch {
+	case r.StatusCode == http.StatusTooManyRequests:
+		return &RateLimitedError{APIError: e, RetryAfter: r.retryAfter(time.Now())}
+	case r.StatusCode >= 500:
+		return &ServerError{APIError: e}
+	case r.StatusCode == http.StatusBadRequest || r.StatusCode == http.StatusUnprocessableEntity:
+		return &ValidationError{APIError: e}
+	}
+	return &e
+}
+
+// retryAfter reads the Retry-After header, in seconds or as an HTTP date,
+// falling back to the resets_at of a quota error body, which the frame
+// transports carry without headers.
+func (r *Response) retryAfter(now time.Time) time.Duration {
+	if value := r.Header.Get("Retry-After"); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second
+		}
+		if at, err := http.ParseTime(value); err == nil && at.After(now) {
+			return at.Sub(now)
+		}
+	}
+	var body struct {
+		ResetsAt time.Time `json:"resets_at"`
+	}
+	if json.Unmarshal(r.Body, &body) == nil && body.ResetsAt.After(now) {
+		return body.ResetsAt.Sub(now).Round(time.Second)
+	}
+	return 0
+}
+
+// errorKind names err's kind for result rows: validation, rate_limited,
+// server, transport or client.
+func errorKind(err error) string {
+	switch {
+	case errors.Is(err, ErrValidation):
+		return "validation"
+	case errors.Is(err, ErrRateLimited):
+		return "rate_limited"
+	case errors.Is(err, ErrServer):
+		return "server"
+	case errors.Is(err, ErrTransport):
+		return "transport"
+	}
+	return "client"
+}
+
+// setError records err in a result row with its kind and, for failed
+// responses, the server's error code.
+func (r *result) setError(err error) *result {
+	r.set("error", err.Error()).set("error_kind", errorKind(err))
+	if apiErr := asAPIError(err); apiErr != nil && apiErr.Code != "" {
+		r.set("error_code", apiErr.Code)
+	}
+	var rateLimited *RateLimitedError
+	if errors.As(err, &rateLimited) && rateLimited.RetryAfter > 0 {
+		r.set("retry_after_s", rateLimited.RetryAfter.Seconds())
+	}
+	return r
+}
+
+// asAPIError returns the failed response behind err of any kind, or nil.
+func asAPIError(err error) *APIError {
+	var validation *ValidationError
+	var rateLimited *RateLimitedError
+	var server *ServerError
+	var apiErr *APIError
+	switch {
+	case errors.As(err, &validation):
+		return &validation.APIError
+	case errors.As(err, &rateLimited):
+		return &rateLimited.APIError
+	case errors.As(err, &server):
+		return &server.APIError
+	case errors.As(err, &apiErr):
+		return apiErr
+	}
+	return nil
+}
+
+// printError reports err with what the user can do about it.
+func printError(what string, err error) {
+	fmt.Printf("❌ %s: %v\n", what, err)
+	var validation *ValidationError
+	var rateLimited *RateLimitedError
+	switch {
+	case errors.As(err, &validation) && validation.Field != "":
+		fmt.Printf("   Fix the %s field of the request and send it again\n", validation.Field)
+	case errors.As(err, &rateLimited) && rateLimited.RetryAfter > 0:
+		fmt.Printf("   Retry after %v\n", rateLimited.RetryAfter)
+	case errors.Is(err, ErrServer):
+		fmt.Println("   The server failed; its error.log has the request ID's entry")
+	case errors.Is(err, ErrTransport):
+		fmt.Println("   No response; check the server address, --transport and --timeout")
+	}
+}
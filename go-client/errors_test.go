@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestResponseErr(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		header http.Header
+		body   string
+		kind   error
+		code   string
+		field  string
+		msg    string
+		wait   time.Duration
+	}{
+		{name: "success", status: http.StatusOK, body: `{"status":"ok"}`},
+		{name: "validation", status: http.StatusBadRequest, body: `{"code":"validation_failed","error":"bad","field":"logBody.timestamp","request_id":"r1"}`, kind: ErrValidation, code: "validation_failed", field: "logBody.timestamp"},
+		{name: "message", status: http.StatusBadRequest, body: `{"code":"validation_failed","message":"bad","error":"bad","field":"logBody.issuer"}`, kind: ErrValidation, code: "validation_failed", field: "logBody.issuer", msg: "bad"},
+		{name: "field only", status: http.StatusConflict, body: `{"code":"conflict","field":"version"}`, kind: ErrValidation, code: "conflict", field: "version"},
+		{name: "plain 400", status: http.StatusBadRequest, body: `not json`, kind: ErrValidation},
+		{name: "rate limited", status: http.StatusTooManyRequests, header: http.Header{"Retry-After": {"3"}}, body: `{"code":"rate_limited"}`, kind: ErrRateLimited, code: "rate_limited", wait: 3 * time.Second},
+		{name: "quota", status: http.StatusTooManyRequests, body: `{"code":"quota_exceeded","field":"projectName"}`, kind: ErrRateLimited, code: "quota_exceeded"},
+		{name: "server", status: http.StatusBadGateway, body: `{"code":"upstream_failed","field":"backend"}`, kind: ErrServer, code: "upstream_failed"},
+		{name: "not found", status: http.StatusNotFound, body: `{"code":"not_found","error":"gone"}`, code: "not_found", msg: "gone"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &Response{StatusCode: tt.status, Header: tt.header, Body: []byte(tt.body)}
+			err := resp.Err()
+			if tt.status < 400 {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				return
+			}
+			for _, kind := range []error{ErrValidation, ErrRateLimited, ErrServer} {
+				if got := errors.Is(err, kind); got != (kind == tt.kind) {
+					t.Errorf("errors.Is(%v, %v) = %v", err, kind, got)
+				}
+			}
+			var apiErr *APIError
+			var validation *ValidationError
+			var limited *RateLimitedError
+			var server *ServerError
+			switch {
+			case errors.As(err, &validation):
+				apiErr = &validation.APIError
+				if validation.Field != tt.field {
+					t.Errorf("field = %q, want %q", validation.Field, tt.field)
+				}
+			case errors.As(err, &limited):
+				apiErr = &limited.APIError
+				if limited.RetryAfter != tt.wait {
+					t.Errorf("RetryAfter = %v, want %v", limited.RetryAfter, tt.wait)
+				}
+			case errors.As(err, &server):
+				apiErr = &server.APIError
+			case !errors.As(err, &apiErr):
+				t.Fatalf("unexpected error type %T", err)
+			}
+			if apiErr.StatusCode != tt.status || apiErr.Code != tt.code {
+				t.Errorf("got %d %q, want %d %q", apiErr.StatusCode, apiErr.Code, tt.status, tt.code)
+			}
+			if tt.msg != "" && (apiErr.Message != tt.msg || apiErr.Details != nil) {
+				t.Errorf("got message %q and details %v, want %q alone", apiErr.Message, apiErr.Details, tt.msg)
+			}
+		})
+	}
+}
+
+func TestRetryAfterFallsBackToQuotaReset(t *testing.T) {
+	now := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	resp := &Response{StatusCode: http.StatusTooManyRequests, Body: []byte(`{"code":"quota_exceeded","resets_at":"2030-01-01T00:01:00Z"}`)}
+	if wait := resp.retryAfter(now); wait != time.Minute {
+		t.Errorf("expected the quota reset a minute away, got %v", wait)
+	}
+	resp.Header = http.Header{"Retry-After": {now.Add(2 * time.Minute).Format(http.TimeFormat)}}
+	if wait := resp.retryAfter(now); wait != 2*time.Minute {
+		t.Errorf("expected the Retry-After date, got %v", wait)
+	}
+}
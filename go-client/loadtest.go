@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// loadtestSizes are the payload sizes --mix weighs, in report order.
+var loadtestSizes = []string{"small", "medium", "large"}
+
+// latencyBuckets are the upper bounds of the report's histogram rows; the
+// last row counts everything slower.
+var latencyBuckets = []time.Duration{
+	time.Millisecond, 2 * time.Millisecond, 5 * time.Millisecond,
+	10 * time.Millisecond, 20 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 200 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2 * time.Second, 5 * time.Second,
+}
+
+// runLoadTest sends /log requests at a fixed --rps for --duration, with
+// payload sizes drawn from --mix, and reports latency percentiles, a
+// latency histogram, error rates and the bytes Avro saved. The load is
+// open-loop: requests start on schedule whether or not earlier ones have
+// finished, and latency is measured from the scheduled start, so a
+// server that falls behind shows it in the percentiles instead of
+// quietly lowering the rate. Requests beyond --max-inflight are dropped
+// and counted.
+func runLoadTest(args []string) {
+	fs := flag.NewFlagSet("loadtest", flag.ExitOnError)
+	rps := fs.Float64("rps", 50, "target requests per second")
+	duration := fs.Duration("duration", 30*time.Second, "how long to send requests")
+	mix := fs.String("mix", "small=6,medium=3,large=1", "relative weights of small, medium and large payloads")
+	maxInflight := fs.Int("max-inflight", 256, "requests in flight at once; scheduled requests beyond it are dropped")
+	timeout := fs.Duration("timeout", 10*time.Second, "per-request timeout, including retries")
+	fs.Parse(args)
+
+	if *rps <= 0 || *duration <= 0 || *maxInflight < 1 || *timeout <= 0 {
+		fmt.Println("❌ --rps, --duration, --max-inflight and --timeout must be positive")
+		return
+	}
+	weights, err := parseWeights("--mix", *mix, loadtestSizes)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return
+	}
+	bodies, err := logBodies(loadtestSizes)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return
+	}
+	total := 0
+	for _, w := range weights {
+		total += w
+	}
+
+	fmt.Printf("🚦 Load test via %s: %.1f req/s for %v, mix %s\n", transport.Name(), *rps, *duration, *mix)
+	interval := time.Duration(float64(time.Second) / *rps)
+	slots := make(chan struct{}, *maxInflight)
+	var mu sync.Mutex
+	var results []batchResult
+	var wg sync.WaitGroup
+	dropped := 0
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	start := time.Now()
+	for i := 0; rootCtx.Err() == nil; i++ {
+		scheduled := start.Add(time.Duration(i) * interval)
+		if scheduled.Sub(start) >= *duration {
+			break
+		}
+		select {
+		case <-rootCtx.Done():
+			continue
+		case <-time.After(time.Until(scheduled)):
+		}
+		size := loadtestSizes[pickBenchOp(weights, rng.Intn(total))]
+		select {
+		case slots <- struct{}{}:
+		default:
+			dropped++
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			ctx, cancel := context.WithTimeout(rootCtx, *timeout)
+			defer cancel()
+			r := sendBatchLog(ctx, size, bodies[size])
+			// Count the time the request waited behind its schedule.
+			r.latency = time.Since(scheduled)
+			mu.Lock()
+			results = append(results, r)
+			mu.Unlock()
+		}()
+	}
+	sending := time.Since(start)
+	wg.Wait()
+	emitBatchResults("loadtest", results)
+	printLoadTestReport(results, dropped, *rps, sending)
+}
+
+func printLoadTestReport(results []batchResult, dropped int, rps float64, elapsed time.Duration) {
+	bySize := make(map[string]*batchTotals, len(loadtestSizes))
+	for _, s := range loadtestSizes {
+		bySize[s] = &batchTotals{}
+	}
+	var all batchTotals
+	var latencies []time.Duration
+	failures := map[string]int{}
+	for _, r := range results {
+		bySize[r.size].add(r)
+		all.add(r)
+		latencies = append(latencies, r.latency)
+		if r.err != "" {
+			failures[r.err]++
+		}
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	fmt.Printf("\n=== 🚦 Load Test Results ===\n")
+	fmt.Printf("Sent %d requests in %v: %.1f req/s (target %.1f), %d dropped over --max-inflight\n",
+		len(results), elapsed.Round(time.Millisecond), float64(len(results))/elapsed.Seconds(), rps, dropped)
+	fmt.Printf("\n%-8s %6s %6s %7s %10s %10s %10s %10s\n", "size", "ok", "failed", "errors", "p50", "p95", "p99", "max")
+	row := func(name string, t *batchTotals) {
+		sort.Slice(t.latencies, func(i, j int) bool { return t.latencies[i] < t.latencies[j] })
+		errorRate := 0.0
+		if n := t.ok + t.failed; n > 0 {
+			errorRate = float64(t.failed) / float64(n) * 100
+		}
+		fmt.Printf("%-8s %6d %6d %6.2f%% %10v %10v %10v %10v\n", name, t.ok, t.failed, errorRate,
+			percentile(t.latencies, 50), percentile(t.latencies, 95), percentile(t.latencies, 99), percentile(t.latencies, 100))
+	}
+	for _, s := range loadtestSizes {
+		if t := bySize[s]; t.ok+t.failed > 0 {
+			row(s, t)
+		}
+	}
+	row("total", &all)
+
+	fmt.Printf("\n=== 📊 Latency Histogram (all requests) ===\n")
+	counts := make([]int, len(latencyBuckets)+1)
+	for _, l := range latencies {
+		counts[sort.Search(len(latencyBuckets), func(i int) bool { return l <= latencyBuckets[i] })]++
+	}
+	most, last := 0, 0
+	for i, n := range counts {
+		most = max(most, n)
+		if n > 0 {
+			last = i
+		}
+	}
+	// Rows slower than the slowest request are left out.
+	for i, n := range counts[:last+1] {
+		label := "> " + latencyBuckets[len(latencyBuckets)-1].String()
+		if i < len(latencyBuckets) {
+			label = "≤ " + latencyBuckets[i].String()
+		}
+		bar := 0
+		if most > 0 {
+			bar = n * 40 / most
+		}
+		fmt.Printf("%8s %7d %s\n", label, n, strings.Repeat("█", bar))
+	}
+
+	fmt.Printf("\n=== 💾 Bytes Saved (successful requests) ===\n")
+	fmt.Printf("JSON sent:     %d bytes\n", all.originalBytes)
+	fmt.Printf("Wrapper Avro:  %d bytes (saved %d)\n", all.wrapperBytes, all.originalBytes-all.wrapperBytes)
+	fmt.Printf("LogData Avro:  %d bytes (saved %d)\n", all.dataBytes, all.originalBytes-all.dataBytes)
+
+	if len(failures) > 0 {
+		fmt.Printf("\n❌ Failures:\n")
+		for msg, n := range failures {
+			fmt.Printf("  %6d × %s\n", n, msg)
+		}
+	}
+}
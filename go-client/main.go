@@ -1,13 +1,15 @@
 package main
 
 import (
-	"bytes"
+	"crypto/tls"
 	"encoding/json"
+	"flag"
 	"fmt"
-	"io"
 	"math/rand"
-	"net/http"
+	neturl "net/url"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -45,27 +47,196 @@ type LogResponse struct {
 	CompressionStats map[string]interface{} `json:"compression_stats"`
 	WrapperAvroJSON  string                 `json:"wrapper_avro_json"`
 	LogdataAvroJSON  string                 `json:"logdata_avro_json"`
+	// Echo is set when the server truncated or omitted the Avro JSON.
+	Echo map[string]interface{} `json:"echo,omitempty"`
+	// ID and Artifacts are set when the server stores log artifacts.
+	ID        string            `json:"id,omitempty"`
+	Artifacts map[string]string `json:"artifacts,omitempty"`
 }
 
-const serverURL = "http://localhost:8080"
+const (
+	serverURL       = "http://localhost:8080"
+	secureServerURL = "https://localhost:8080"
+)
+
+var transport Transport
+
+// logPath is the /log path including the echo policy query, if any.
+var logPath = "/log"
 
 func main() {
-	if len(os.Args) < 2 {
+	transportName := flag.String("transport", "http", "transport to use: http, h2c, grpc, tcp, udp")
+	server := flag.String("server", "", "server URL (default "+serverURL+", or "+secureServerURL+" with --tls-ca)")
+	servers := flag.String("servers", "", "comma-separated server URLs; requests are spread round-robin")
+	flag.String("profile", "", "connection profile from the config file; see profile list")
+	tcpAddr := flag.String("tcp-addr", "localhost:8081", "server address(es) for the tcp transport, comma-separated for round-robin")
+	udpAddr := flag.String("udp-addr", "localhost:8082", "server address(es) for the udp transport, comma-separated for round-robin")
+	repeat := flag.Int("repeat", 1, "run the command this many times")
+	echo := flag.String("echo", "", "Avro JSON echo policy requested from /log: full, truncate or omit (default: server setting)")
+	echoBytes := flag.Int("echo-bytes", 0, "bytes of each Avro JSON encoding to keep with --echo truncate")
+	var retryOpts RetryOptions
+	flag.DurationVar(&retryOpts.Timeout, "timeout", 30*time.Second, "timeout of each request attempt (0 for none)")
+	flag.IntVar(&retryOpts.Retries, "retries", 2, "times a request is retried after a transport error, timeout, 429 (except quota_exceeded) or 5xx")
+	flag.DurationVar(&retryOpts.Backoff, "retry-backoff", 100*time.Millisecond, "wait before the first retry, doubled for each next one, with jitter")
+	flag.DurationVar(&retryOpts.MaxBackoff, "retry-max-backoff", 5*time.Second, "longest wait between retries")
+	output := flag.String("output", "text", "result format: text, json (one object per line) or csv; json and csv move the human-readable text to stderr")
+	var tlsOpts TLSOptions
+	flag.StringVar(&tlsOpts.CAFile, "tls-ca", "", "CA bundle used to verify the server certificate; switches to https")
+	flag.StringVar(&tlsOpts.CertFile, "tls-cert", "", "client certificate (PEM) for mutual TLS")
+	flag.StringVar(&tlsOpts.KeyFile, "tls-key", "", "client private key (PEM) for mutual TLS")
+	flag.StringVar(&tlsOpts.ServerName, "tls-server-name", "", "expected server name (SAN) when it differs from the host")
+	var netOpts NetworkOptions
+	flag.StringVar(&netOpts.ProxyURL, "proxy", "", "proxy URL (http://, https://, socks5://, socks5h://); defaults to HTTP(S)_PROXY for HTTP transports")
+	flag.StringVar(&netOpts.DNSServer, "dns-server", "", "DNS server (host[:port]) used instead of the system resolver")
+	resolve := flag.String("resolve", "", "comma-separated host=address overrides, e.g. api.internal=10.0.0.5")
+	flag.Usage = printUsage
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) < 1 {
 		printUsage()
 		return
 	}
 
-	command := os.Args[1]
+	if err := applyClientSettings(flag.CommandLine, os.Environ()); err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+	if err := setupOutput(*output); err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+	overrides, err := parseResolve(*resolve)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+	netOpts.Resolve = overrides
+
+	query := neturl.Values{}
+	if *echo != "" {
+		query.Set("echo", *echo)
+	}
+	if *echoBytes > 0 {
+		query.Set("echo_bytes", strconv.Itoa(*echoBytes))
+	}
+	if len(query) > 0 {
+		logPath += "?" + query.Encode()
+	}
+
+	tlsConfig, err := buildClientTLSConfig(tlsOpts)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+	url := serverURL
+	if tlsConfig != nil {
+		url = secureServerURL
+	}
+	switch {
+	case *server != "" && *servers != "":
+		fmt.Println("❌ use either --server or --servers")
+		os.Exit(1)
+	case *server != "":
+		url = *server
+	case *servers != "":
+		url = *servers
+	}
+
+	if retryOpts.Retries < 0 || retryOpts.Timeout < 0 || retryOpts.Backoff < 0 || retryOpts.MaxBackoff < 0 {
+		fmt.Println("❌ --retries, --timeout, --retry-backoff and --retry-max-backoff must not be negative")
+		os.Exit(1)
+	}
+	transport, err = buildTransport(*transportName, url, *tcpAddr, *udpAddr, tlsConfig, netOpts)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+	transport = newRetryTransport(transport, retryOpts)
+	defer transport.Close()
+	defer cancelOnInterrupt()()
+
+	for i := 0; i < *repeat && rootCtx.Err() == nil; i++ {
+		if *repeat > 1 {
+			fmt.Printf("\n🔂 Run %d/%d\n", i+1, *repeat)
+		}
+		runCommand(args)
+	}
+	flushResults()
+}
+
+// buildTransport creates one transport per configured instance and wraps
+// them in a round-robin transport when more than one is given.
+func buildTransport(name, urls, tcpAddrs, udpAddrs string, tlsConfig *tls.Config, netOpts NetworkOptions) (Transport, error) {
+	urlList := strings.Split(urls, ",")
+	tcpList := strings.Split(tcpAddrs, ",")
+	udpList := strings.Split(udpAddrs, ",")
+
+	count := len(urlList)
+	switch name {
+	case "tcp":
+		count = len(tcpList)
+	case "udp":
+		count = len(udpList)
+	}
+
+	pick := func(list []string, i int) string {
+		return strings.TrimSpace(list[i%len(list)])
+	}
+
+	transports := make([]Transport, 0, count)
+	for i := 0; i < count; i++ {
+		t, err := newTransport(name, TransportOptions{
+			ServerURL: pick(urlList, i),
+			TCPAddr:   pick(tcpList, i),
+			UDPAddr:   pick(udpList, i),
+			TLS:       tlsConfig,
+			Network:   netOpts,
+		})
+		if err != nil {
+			return nil, err
+		}
+		transports = append(transports, t)
+	}
+	return newRoundRobinTransport(transports), nil
+}
+
+func runCommand(args []string) {
+	command := args[0]
 	switch command {
 	case "ping":
 		testPing()
 	case "log":
-		if len(os.Args) < 3 {
+		if len(args) < 2 {
 			fmt.Println("Please specify log size: small, medium, large, or random")
 			return
 		}
-		size := os.Args[2]
+		switch args[1] {
+		case "batch":
+			runLogBatch(args[2:])
+			return
+		case "replay":
+			runLogReplay(args[2:])
+			return
+		}
+		size := args[1]
 		testLog(size)
+	case "loadtest":
+		runLoadTest(args[1:])
+	case "decode":
+		runDecode(args[1:])
+	case "compare":
+		runCompare(args[1:])
+	case "repl":
+		runREPL(args[1:])
+	case "profile":
+		runProfile(args[1:])
+	case "bench":
+		if len(args) < 2 || args[1] != "mixed" {
+			fmt.Println("Please specify a bench scenario: mixed")
+			return
+		}
+		runMixedBench(args[2:])
 	default:
 		fmt.Printf("Unknown command: %s\n", command)
 		printUsage()
@@ -79,6 +250,57 @@ func printUsage() {
 	fmt.Println("  go run . log medium            - Send medium log data")
 	fmt.Println("  go run . log large             - Send large log data")
 	fmt.Println("  go run . log random            - Send random size log data")
+	fmt.Println("  go run . log batch [flags]     - Send many logs concurrently and summarize compression stats")
+	fmt.Println("      --count 100 --concurrency 8 --size small|medium|large|random")
+	fmt.Println("  go run . log replay <file.ndjson> [flags] - Send every line of an NDJSON file (.gz or - for stdin) to /log")
+	fmt.Println("      --concurrency 1 --rate 0 --skip 0 --limit 0 --progress 2s, and for LogData records")
+	fmt.Println("      --project-name --project-version --log-level --log-type --log-source")
+	fmt.Println("  go run . bench mixed [flags]   - Mix /log, /logs/replay and /decode and report latency percentiles")
+	fmt.Println("      --mix log=8,replay=1,decode=1 --duration 10s --concurrency 8 --size small --replay-limit 100 --baseline")
+	fmt.Println("  go run . loadtest [flags]      - Send /log at a fixed rate and report latency percentiles, a histogram and errors")
+	fmt.Println("      --rps 50 --duration 30s --mix small=6,medium=3,large=1 --max-inflight 256 --timeout 10s")
+	fmt.Println("  go run . compare <size> [flags] - Send one log as JSON and as Avro binary and compare sizes and latencies")
+	fmt.Println("      --count 10")
+	fmt.Println("  go run . decode <file.avro>    - Decode a stored Avro file to JSON lines locally, without the server")
+	fmt.Println("      --schema schema.avsc (unless the file is an Object Container File) --strip-unions --limit 0")
+	fmt.Println("  go run . [flags] profile list|show|save <name>|use <name>|delete <name> - Manage connection profiles")
+	fmt.Println("  go run . repl                  - Interactive prompt to build, tweak and send payloads and compare sizes")
+	fmt.Println()
+	fmt.Println("Flags (before the command):")
+	fmt.Println("  --transport http|h2c|grpc|tcp|udp  - Transport used to reach the server (default http)")
+	fmt.Println("  --server url                       - Server URL (default http://localhost:8080)")
+	fmt.Println("  --servers url1,url2,...            - Spread requests round-robin over several servers")
+	fmt.Println("  --profile name                     - Connection profile from ~/.avro-json-client.json (built in: local)")
+	fmt.Println("  --repeat N                         - Run the command N times")
+	fmt.Println("  --echo full|truncate|omit          - How much Avro JSON /log should echo back")
+	fmt.Println("  --echo-bytes N                     - Bytes kept per encoding with --echo truncate")
+	fmt.Println("  --timeout 30s                      - Timeout of each request attempt (0 for none)")
+	fmt.Println("  --retries 2                        - Retries after transport errors, timeouts, 429 and 5xx (waits out Retry-After; quota_exceeded is final)")
+	fmt.Println("  --retry-backoff 100ms              - First retry wait, doubled per retry with jitter")
+	fmt.Println("  --retry-max-backoff 5s             - Longest wait between retries")
+	fmt.Println("  --output text|json|csv             - Also print results as JSON lines or CSV on stdout; text goes to stderr")
+	fmt.Println("  --tcp-addr host:port               - Server address for the tcp transport")
+	fmt.Println("  --udp-addr host:port               - Server address for the udp transport")
+	fmt.Println("  --tls-ca file                      - Verify the server with this CA and use TLS")
+	fmt.Println("  --tls-cert file --tls-key file     - Present a client certificate (mutual TLS)")
+	fmt.Println("  --tls-server-name name             - Override the expected server SAN")
+	fmt.Println("  --proxy url                        - http://, https://, socks5:// or socks5h:// proxy (default: HTTP(S)_PROXY)")
+	fmt.Println("  --dns-server host[:port]           - Resolve names with this DNS server")
+	fmt.Println("  --resolve host=addr[,...]          - Pin host names to fixed addresses")
+}
+
+// send delivers body to path over the selected transport and reports the round trip.
+func send(path string, body []byte) (*Response, error) {
+	start := time.Now()
+	resp, err := transport.Send(rootCtx, path, body)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("⏱️  Round trip via %s: %v (%d bytes on the wire, instance %d)\n", transport.Name(), time.Since(start), resp.WireBytes, resp.Instance)
+	if resp.Attempts > 1 {
+		fmt.Printf("🔁 Succeeded after %d attempts\n", resp.Attempts)
+	}
+	return resp, nil
 }
 
 func testPing() {
@@ -106,24 +328,30 @@ func testPing() {
 
 	fmt.Printf("📤 Sending request (%d bytes)...\n", len(reqBody))
 
-	resp, err := http.Post(serverURL+"/ping", "application/json", bytes.NewBuffer(reqBody))
+	row := newResult("ping").set("transport", transport.Name()).set("request_bytes", len(reqBody))
+	defer emitResult(row)
+	start := time.Now()
+	resp, err := send("/ping", reqBody)
 	if err != nil {
-		fmt.Printf("❌ Failed to send request: %v\n", err)
+		printError("Failed to send request", err)
+		row.setError(err)
 		return
 	}
-	defer resp.Body.Close()
-
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		fmt.Printf("❌ Failed to read response: %v\n", err)
+	row.setLatency("latency_ms", time.Since(start)).set("http_status", resp.StatusCode).
+		set("wire_bytes", resp.WireBytes).set("instance", resp.Instance).set("attempts", resp.Attempts)
+	respBody := resp.Body
+
+	fmt.Printf("📥 Response status: %s\n", resp.Status())
+	if err := resp.Err(); err != nil {
+		printError("Ping failed", err)
+		row.setError(err)
 		return
 	}
 
-	fmt.Printf("📥 Response status: %s\n", resp.Status)
-
 	var pingResp PingResponse
 	if err := json.Unmarshal(respBody, &pingResp); err != nil {
 		fmt.Printf("❌ Failed to parse response: %v\n", err)
+		row.set("error", "invalid response: "+err.Error())
 		return
 	}
 
@@ -135,6 +363,7 @@ func testPing() {
 	sentDataJSON, _ := json.Marshal(avroJSONData)
 	echoDataJSON, _ := json.Marshal(pingResp.Echo)
 	
+	row.set("status", pingResp.Status).set("message", pingResp.Message).set("echo_ok", string(sentDataJSON) == string(echoDataJSON))
 	if string(sentDataJSON) == string(echoDataJSON) {
 		fmt.Printf("Echo Test: ✅ PASSED - Data echoed correctly\n")
 	} else {
@@ -177,27 +406,34 @@ func testLog(size string) {
 	fmt.Printf("📤 Request size: %d bytes\n", len(reqBody))
 	fmt.Printf("📤 Sending log request...\n")
 
-	resp, err := http.Post(serverURL+"/log", "application/json", bytes.NewBuffer(reqBody))
+	row := newResult("log").set("size", size).set("transport", transport.Name()).set("request_bytes", len(reqBody))
+	defer emitResult(row)
+	start := time.Now()
+	resp, err := send(logPath, reqBody)
 	if err != nil {
-		fmt.Printf("❌ Failed to send request: %v\n", err)
+		printError("Failed to send request", err)
+		row.setError(err)
 		return
 	}
-	defer resp.Body.Close()
-
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		fmt.Printf("❌ Failed to read response: %v\n", err)
+	row.setLatency("latency_ms", time.Since(start)).set("http_status", resp.StatusCode).
+		set("wire_bytes", resp.WireBytes).set("instance", resp.Instance).set("attempts", resp.Attempts)
+	respBody := resp.Body
+
+	fmt.Printf("📥 Response status: %s\n", resp.Status())
+	if err := resp.Err(); err != nil {
+		printError("Log rejected", err)
+		row.setError(err)
 		return
 	}
 
-	fmt.Printf("📥 Response status: %s\n", resp.Status)
-
 	var logResp LogResponse
 	if err := json.Unmarshal(respBody, &logResp); err != nil {
 		fmt.Printf("❌ Failed to parse response: %v\n", err)
 		fmt.Printf("Raw response: %s\n", string(respBody))
+		row.set("error", "invalid response: "+err.Error())
 		return
 	}
+	row.set("status", logResp.Status).set("id", logResp.ID).setStats(logResp.CompressionStats)
 
 	fmt.Printf("\n=== 📊 Compression Results ===\n")
 	fmt.Printf("Status: %s\n", logResp.Status)
@@ -223,6 +459,20 @@ func testLog(size string) {
 		}
 	}
 
+	if logResp.ID != "" {
+		fmt.Printf("\n📦 Stored as %s:\n", logResp.ID)
+		for _, format := range []string{"wrapper-binary", "logdata-binary", "original-json"} {
+			if link, ok := logResp.Artifacts[format]; ok {
+				fmt.Printf("  %-15s %s\n", format, link)
+			}
+		}
+	}
+
+	if logResp.Echo != nil && logResp.Echo["policy"] == "omit" {
+		fmt.Printf("\n🔇 Avro JSON omitted by the server (wrapper %d bytes, logdata %d bytes)\n",
+			getIntValue(logResp.Echo, "wrapper_avro_json_size"), getIntValue(logResp.Echo, "logdata_avro_json_size"))
+		return
+	}
 	fmt.Printf("\n=== 🔍 Sample Avro JSON Output ===\n")
 	fmt.Printf("Wrapper Avro JSON (first 200 chars):\n%s...\n", truncateString(logResp.WrapperAvroJSON, 200))
 	fmt.Printf("LogData Avro JSON (first 200 chars):\n%s...\n", truncateString(logResp.LogdataAvroJSON, 200))
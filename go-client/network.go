@@ -0,0 +1,336 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NetworkOptions controls how the client reaches the server from restricted
+// environments: an explicit proxy (http, https, socks5 or socks5h URL), a
+// custom DNS server and static host overrides. A socks5 proxy is given
+// addresses resolved locally through the same DNS server and overrides; only
+// socks5h hands host names to the proxy.
+type NetworkOptions struct {
+	// ProxyURL overrides HTTP_PROXY/HTTPS_PROXY/NO_PROXY from the environment.
+	ProxyURL string
+	// DNSServer is a host:port queried instead of the system resolver.
+	DNSServer string
+	// Resolve maps host names to fixed addresses, like curl --resolve.
+	Resolve map[string]string
+}
+
+func (o NetworkOptions) proxyURL() (*url.URL, error) {
+	if o.ProxyURL == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(o.ProxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+		return u, nil
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+	}
+}
+
+// httpProxy returns the proxy selector for net/http, which handles http and
+// https proxies natively. Socks proxies are left to httpDial so that targets
+// are resolved the same way as for the stream transports.
+func (o NetworkOptions) httpProxy() (func(*http.Request) (*url.URL, error), error) {
+	u, err := o.proxyURL()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case u == nil:
+		return http.ProxyFromEnvironment, nil
+	case isSocks(u.Scheme):
+		return nil, nil
+	default:
+		return http.ProxyURL(u), nil
+	}
+}
+
+// httpDial is the DialContext for net/http: it tunnels through an explicit
+// socks proxy and dials directly otherwise.
+func (o NetworkOptions) httpDial(ctx context.Context, network, addr string) (net.Conn, error) {
+	if u, err := o.proxyURL(); err == nil && u != nil && isSocks(u.Scheme) {
+		return o.streamDial(ctx, addr)
+	}
+	return o.directDial(ctx, network, addr)
+}
+
+func isSocks(scheme string) bool {
+	return scheme == "socks5" || scheme == "socks5h"
+}
+
+func (o NetworkOptions) resolver() *net.Resolver {
+	if o.DNSServer == "" {
+		return net.DefaultResolver
+	}
+	server := o.DNSServer
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, server)
+		},
+	}
+}
+
+// directDial connects without a proxy, applying host overrides and the
+// custom resolver.
+func (o NetworkOptions) directDial(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if override, ok := o.Resolve[host]; ok {
+		host = override
+	}
+	d := net.Dialer{Timeout: 30 * time.Second, Resolver: o.resolver()}
+	return d.DialContext(ctx, network, net.JoinHostPort(host, port))
+}
+
+// resolveAddr turns the host in addr into an IP address, applying host
+// overrides and the custom resolver like directDial does.
+func (o NetworkOptions) resolveAddr(ctx context.Context, addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	if override, ok := o.Resolve[host]; ok {
+		host = override
+	}
+	if net.ParseIP(host) == nil {
+		addrs, err := o.resolver().LookupHost(ctx, host)
+		if err != nil {
+			return "", err
+		}
+		host = addrs[0]
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// streamDial opens a TCP connection to addr, tunnelling through the explicit
+// proxy when one is configured. Environment proxies only apply to HTTP.
+func (o NetworkOptions) streamDial(ctx context.Context, addr string) (net.Conn, error) {
+	u, err := o.proxyURL()
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		return o.directDial(ctx, "tcp", addr)
+	}
+
+	proxyAddr := u.Host
+	if u.Port() == "" {
+		proxyAddr = net.JoinHostPort(u.Hostname(), defaultProxyPort(u.Scheme))
+	}
+	conn, err := o.directDial(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, fmt.Errorf("dial proxy: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	if err := o.tunnel(ctx, u, &conn, addr); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// tunnel asks the proxy behind conn to connect to addr. An https proxy is
+// spoken to over TLS, so conn is replaced by the TLS client connection.
+func (o NetworkOptions) tunnel(ctx context.Context, u *url.URL, conn *net.Conn, addr string) error {
+	switch u.Scheme {
+	case "socks5":
+		resolved, err := o.resolveAddr(ctx, addr)
+		if err != nil {
+			return fmt.Errorf("resolve %s: %w", addr, err)
+		}
+		return socks5Connect(*conn, u.User, resolved)
+	case "socks5h":
+		return socks5Connect(*conn, u.User, addr)
+	case "https":
+		tlsConn := tls.Client(*conn, &tls.Config{ServerName: u.Hostname()})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return fmt.Errorf("proxy TLS handshake: %w", err)
+		}
+		*conn = tlsConn
+		return httpConnect(tlsConn, u.User, addr)
+	default:
+		return httpConnect(*conn, u.User, addr)
+	}
+}
+
+func defaultProxyPort(scheme string) string {
+	switch scheme {
+	case "socks5", "socks5h":
+		return "1080"
+	case "https":
+		return "443"
+	default:
+		return "80"
+	}
+}
+
+// httpConnect establishes a tunnel with an HTTP CONNECT request.
+func httpConnect(conn net.Conn, user *url.Userinfo, addr string) error {
+	req := fmt.Sprintf("CONNECT %s HTTP/1.1\r\nHost: %s\r\n", addr, addr)
+	if user != nil {
+		password, _ := user.Password()
+		cred := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + password))
+		req += "Proxy-Authorization: Basic " + cred + "\r\n"
+	}
+	if _, err := io.WriteString(conn, req+"\r\n"); err != nil {
+		return err
+	}
+
+	// Read byte by byte so no tunnelled data is buffered away from conn.
+	resp, err := http.ReadResponse(bufio.NewReaderSize(conn, 1), nil)
+	if err != nil {
+		return fmt.Errorf("read CONNECT response: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("proxy CONNECT failed: %s", resp.Status)
+	}
+	return nil
+}
+
+// socks5Connect performs the RFC 1928 CONNECT handshake with optional
+// RFC 1929 username/password authentication. An IP host is sent as an
+// address and anything else as a host name for the proxy to resolve.
+func socks5Connect(conn net.Conn, user *url.Userinfo, addr string) error {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return fmt.Errorf("invalid port %q", portStr)
+	}
+
+	methods := []byte{0x00}
+	if user != nil {
+		methods = []byte{0x00, 0x02}
+	}
+	if _, err := conn.Write(append([]byte{0x05, byte(len(methods))}, methods...)); err != nil {
+		return err
+	}
+
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[0] != 0x05 {
+		return errors.New("socks5: unexpected protocol version")
+	}
+	switch reply[1] {
+	case 0x00:
+	case 0x02:
+		if user == nil {
+			return errors.New("socks5: proxy requires authentication")
+		}
+		password, _ := user.Password()
+		auth := []byte{0x01, byte(len(user.Username()))}
+		auth = append(auth, user.Username()...)
+		auth = append(auth, byte(len(password)))
+		auth = append(auth, password...)
+		if _, err := conn.Write(auth); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return err
+		}
+		if reply[1] != 0x00 {
+			return errors.New("socks5: authentication rejected")
+		}
+	default:
+		return errors.New("socks5: no acceptable authentication method")
+	}
+
+	req := []byte{0x05, 0x01, 0x00}
+	if ip := net.ParseIP(host); ip != nil && ip.To4() != nil {
+		req = append(req, 0x01)
+		req = append(req, ip.To4()...)
+	} else if ip != nil {
+		req = append(req, 0x04)
+		req = append(req, ip.To16()...)
+	} else {
+		if len(host) > 255 {
+			return errors.New("socks5: host name too long")
+		}
+		req = append(req, 0x03, byte(len(host)))
+		req = append(req, host...)
+	}
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		return err
+	}
+	if head[1] != 0x00 {
+		return fmt.Errorf("socks5: connect failed with code %d", head[1])
+	}
+
+	// Discard the bound address.
+	var skip int
+	switch head[3] {
+	case 0x01:
+		skip = net.IPv4len + 2
+	case 0x04:
+		skip = net.IPv6len + 2
+	case 0x03:
+		l := make([]byte, 1)
+		if _, err := io.ReadFull(conn, l); err != nil {
+			return err
+		}
+		skip = int(l[0]) + 2
+	default:
+		return errors.New("socks5: unknown bound address type")
+	}
+	_, err = io.ReadFull(conn, make([]byte, skip))
+	return err
+}
+
+// parseResolve turns "host=ip,host2=ip2" into a lookup table.
+func parseResolve(s string) (map[string]string, error) {
+	out := make(map[string]string)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		host, ip, ok := strings.Cut(entry, "=")
+		if !ok || host == "" || ip == "" {
+			return nil, fmt.Errorf("invalid --resolve entry %q (expected host=address)", entry)
+		}
+		out[host] = ip
+	}
+	return out, nil
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+// exchange is one request the fake proxy expects and the reply it sends.
+type exchange struct {
+	want  []byte
+	reply []byte
+}
+
+// scriptedProxy plays script on the far end of a pipe and returns the
+// client end; the returned channel reports the first mismatch, or nil,
+// once the script ends or the client hangs up.
+func scriptedProxy(script []exchange) (net.Conn, <-chan error) {
+	client, server := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		defer server.Close()
+		for i, step := range script {
+			got := make([]byte, len(step.want))
+			if _, err := io.ReadFull(server, got); err != nil {
+				done <- nil
+				return
+			}
+			if !bytes.Equal(got, step.want) {
+				done <- fmt.Errorf("step %d: got % x, want % x", i, got, step.want)
+				return
+			}
+			if _, err := server.Write(step.reply); err != nil {
+				done <- nil
+				return
+			}
+		}
+		done <- nil
+	}()
+	return client, done
+}
+
+func TestSocks5Connect(t *testing.T) {
+	connectOK := []byte{0x05, 0x00, 0x00, 0x01, 127, 0, 0, 1, 0x1f, 0x90}
+	tests := []struct {
+		name    string
+		user    *url.Userinfo
+		addr    string
+		script  []exchange
+		wantErr bool
+	}{
+		{
+			name: "ipv4 target",
+			addr: "10.0.0.5:8080",
+			script: []exchange{
+				{[]byte{0x05, 0x01, 0x00}, []byte{0x05, 0x00}},
+				{[]byte{0x05, 0x01, 0x00, 0x01, 10, 0, 0, 5, 0x1f, 0x90}, connectOK},
+			},
+		},
+		{
+			name: "host name target",
+			addr: "api:443",
+			script: []exchange{
+				{[]byte{0x05, 0x01, 0x00}, []byte{0x05, 0x00}},
+				{[]byte{0x05, 0x01, 0x00, 0x03, 3, 'a', 'p', 'i', 0x01, 0xbb}, []byte{0x05, 0x00, 0x00, 0x03, 1, 'x', 0, 0}},
+			},
+		},
+		{
+			name: "ipv6 target",
+			addr: "[::1]:80",
+			script: []exchange{
+				{[]byte{0x05, 0x01, 0x00}, []byte{0x05, 0x00}},
+				{append(append([]byte{0x05, 0x01, 0x00, 0x04}, net.IPv6loopback...), 0, 80), append([]byte{0x05, 0x00, 0x00, 0x04}, make([]byte, 18)...)},
+			},
+		},
+		{
+			name: "password",
+			user: url.UserPassword("u", "pw"),
+			addr: "10.0.0.5:80",
+			script: []exchange{
+				{[]byte{0x05, 0x02, 0x00, 0x02}, []byte{0x05, 0x02}},
+				{[]byte{0x01, 1, 'u', 2, 'p', 'w'}, []byte{0x01, 0x00}},
+				{[]byte{0x05, 0x01, 0x00, 0x01, 10, 0, 0, 5, 0, 80}, connectOK},
+			},
+		},
+		{
+			name:    "password rejected",
+			user:    url.UserPassword("u", "pw"),
+			addr:    "10.0.0.5:80",
+			script:  []exchange{{[]byte{0x05, 0x02, 0x00, 0x02}, []byte{0x05, 0x02}}, {[]byte{0x01, 1, 'u', 2, 'p', 'w'}, []byte{0x01, 0x01}}},
+			wantErr: true,
+		},
+		{
+			name:    "authentication required",
+			addr:    "10.0.0.5:80",
+			script:  []exchange{{[]byte{0x05, 0x01, 0x00}, []byte{0x05, 0x02}}},
+			wantErr: true,
+		},
+		{
+			name:    "no acceptable method",
+			addr:    "10.0.0.5:80",
+			script:  []exchange{{[]byte{0x05, 0x01, 0x00}, []byte{0x05, 0xff}}},
+			wantErr: true,
+		},
+		{
+			name:    "not socks5",
+			addr:    "10.0.0.5:80",
+			script:  []exchange{{[]byte{0x05, 0x01, 0x00}, []byte{0x04, 0x00}}},
+			wantErr: true,
+		},
+		{
+			name: "connection refused",
+			addr: "10.0.0.5:80",
+			script: []exchange{
+				{[]byte{0x05, 0x01, 0x00}, []byte{0x05, 0x00}},
+				{[]byte{0x05, 0x01, 0x00, 0x01, 10, 0, 0, 5, 0, 80}, []byte{0x05, 0x05, 0x00, 0x01}},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "bad port",
+			addr:    "10.0.0.5:http",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, done := scriptedProxy(tt.script)
+			err := socks5Connect(conn, tt.user, tt.addr)
+			conn.Close()
+			if mismatch := <-done; mismatch != nil {
+				t.Fatal(mismatch)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("socks5Connect() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHTTPConnect(t *testing.T) {
+	tests := []struct {
+		name    string
+		user    *url.Userinfo
+		status  int
+		wantErr bool
+	}{
+		{name: "tunnel", status: http.StatusOK},
+		{name: "proxy auth", user: url.UserPassword("u", "pw"), status: http.StatusOK},
+		{name: "auth required", status: http.StatusProxyAuthRequired, wantErr: true},
+		{name: "forbidden", status: http.StatusForbidden, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+			got := make(chan *http.Request, 1)
+			go func() {
+				defer server.Close()
+				req, err := http.ReadRequest(bufio.NewReader(server))
+				got <- req
+				if err == nil {
+					fmt.Fprintf(server, "HTTP/1.1 %d %s\r\nContent-Length: 0\r\n\r\n", tt.status, http.StatusText(tt.status))
+				}
+			}()
+
+			err := httpConnect(client, tt.user, "api.internal:443")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("httpConnect() error = %v, want error %v", err, tt.wantErr)
+			}
+			req := <-got
+			if req == nil || req.Method != http.MethodConnect || req.Host != "api.internal:443" {
+				t.Fatalf("unexpected CONNECT request %+v", req)
+			}
+			wantAuth := ""
+			if tt.user != nil {
+				wantAuth = "Basic " + base64.StdEncoding.EncodeToString([]byte("u:pw"))
+			}
+			if auth := req.Header.Get("Proxy-Authorization"); auth != wantAuth {
+				t.Errorf("Proxy-Authorization = %q, want %q", auth, wantAuth)
+			}
+		})
+	}
+}
+
+func TestResolveAddr(t *testing.T) {
+	o := NetworkOptions{Resolve: map[string]string{"api.internal": "10.0.0.5"}}
+	tests := []struct{ addr, want string }{
+		{"api.internal:443", "10.0.0.5:443"},
+		{"192.0.2.1:80", "192.0.2.1:80"},
+		{"[::1]:80", "[::1]:80"},
+	}
+	for _, tt := range tests {
+		if got, err := o.resolveAddr(context.Background(), tt.addr); err != nil || got != tt.want {
+			t.Errorf("resolveAddr(%q) = %q, %v; want %q", tt.addr, got, err, tt.want)
+		}
+	}
+	if _, err := o.resolveAddr(context.Background(), "no-port"); err == nil {
+		t.Error("expected an address without a port to fail")
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// outputFormat is --output. With text the commands print their usual
+// report; with json or csv they also emit one row per result on stdout,
+// as JSON lines or a CSV table, so results can be piped into jq or a
+// spreadsheet, and the human-readable text moves to stderr.
+var outputFormat = "text"
+
+// resultOut receives machine-readable rows and decoded records.
+var resultOut io.Writer = os.Stdout
+
+// csvRows holds rows until flushResults, because the CSV header is the
+// union of every row's columns.
+var csvRows []*result
+
+func setupOutput(format string) error {
+	switch format {
+	case "text":
+	case "json", "csv":
+		resultOut = os.Stdout
+		os.Stdout = os.Stderr
+	default:
+		return fmt.Errorf("unknown --output %q: use text, json or csv", format)
+	}
+	outputFormat = format
+	return nil
+}
+
+// machineOutput reports whether results are emitted as rows.
+func machineOutput() bool {
+	return outputFormat != "text"
+}
+
+// result is one machine-readable row, keeping its columns in the order
+// they were set.
+type result struct {
+	columns []string
+	values  map[string]interface{}
+}
+
+func newResult(command string) *result {
+	r := &result{values: make(map[string]interface{})}
+	return r.set("command", command)
+}
+
+func (r *result) set(column string, value interface{}) *result {
+	if _, ok := r.values[column]; !ok {
+		r.columns = append(r.columns, column)
+	}
+	r.values[column] = value
+	return r
+}
+
+func (r *result) setLatency(column string, d time.Duration) *result {
+	return r.set(column, float64(d.Microseconds())/1000)
+}
+
+// setStats adds every compression_stats field, sorted by name, so fields
+// the server adds later show up without a client change.
+func (r *result) setStats(stats map[string]interface{}) *result {
+	names := make([]string, 0, len(stats))
+	for name := range stats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		r.set(name, stats[name])
+	}
+	return r
+}
+
+func (r *result) MarshalJSON() ([]byte, error) {
+	rec := avroRecord{names: r.columns}
+	for _, c := range r.columns {
+		rec.values = append(rec.values, r.values[c])
+	}
+	return rec.MarshalJSON()
+}
+
+// emitResult writes r as a JSON line, or queues it for the CSV table. It
+// does nothing with --output text.
+func emitResult(r *result) {
+	switch outputFormat {
+	case "json":
+		line, err := json.Marshal(r)
+		if err != nil {
+			fmt.Printf("❌ Failed to marshal result: %v\n", err)
+			return
+		}
+		fmt.Fprintln(resultOut, string(line))
+	case "csv":
+		csvRows = append(csvRows, r)
+	}
+}
+
+// flushResults writes the queued CSV rows under a header of every column,
+// in the order columns first appeared.
+func flushResults() {
+	if len(csvRows) == 0 {
+		return
+	}
+	var header []string
+	seen := map[string]bool{}
+	for _, r := range csvRows {
+		for _, c := range r.columns {
+			if !seen[c] {
+				seen[c] = true
+				header = append(header, c)
+			}
+		}
+	}
+	w := csv.NewWriter(resultOut)
+	w.Write(header)
+	for _, r := range csvRows {
+		record := make([]string, len(header))
+		for i, c := range header {
+			record[i] = csvValue(r.values[c])
+		}
+		w.Write(record)
+	}
+	w.Flush()
+	csvRows = nil
+}
+
+func csvValue(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case int, int64, bool:
+		return fmt.Sprint(t)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Every global flag can also be set in an environment variable named
+// clientEnvPrefix followed by the flag name in upper case with dashes as
+// underscores, e.g. AVRO_CLIENT_SERVER, or in a named profile of the
+// config file, e.g. ~/.avro-json-client.json:
+//
+//	{
+//	  "default": "staging",
+//	  "profiles": {
+//	    "staging": {"server": "https://staging.example.com:8443", "tls-ca": "/etc/ssl/staging-ca.pem"}
+//	  }
+//	}
+//
+// Command-line flags win over the environment, which wins over the
+// profile, which wins over the defaults. The profile is --profile,
+// AVRO_CLIENT_PROFILE or the file's default; the built-in local profile
+// is the local server. Unlike the server's AVRO_JSON_ variables, these
+// belong to the client alone, so both can be set in one shell.
+const clientEnvPrefix = "AVRO_CLIENT_"
+
+// clientConfigEnv names the config file instead of the one in the home
+// directory.
+const clientConfigEnv = clientEnvPrefix + "CONFIG"
+
+// Setting sources, as reported by profile show.
+const (
+	sourceDefault = "default"
+	sourceProfile = "profile"
+	sourceEnv     = "env"
+	sourceFlag    = "flag"
+)
+
+// clientConfig is the config file.
+type clientConfig struct {
+	Default  string                       `json:"default,omitempty"`
+	Profiles map[string]map[string]string `json:"profiles,omitempty"`
+}
+
+// builtinProfiles are available without a config file; a profile of the
+// same name in the file replaces them.
+var builtinProfiles = map[string]map[string]string{
+	"local": {"server": serverURL},
+}
+
+// settings records where the global flags came from, for profile show and
+// profile save.
+var settings struct {
+	path    string
+	config  *clientConfig
+	profile string
+	sources map[string]string
+}
+
+func clientConfigPath() (string, error) {
+	if path := os.Getenv(clientConfigEnv); path != "" {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot find the config file: %w; set %s", err, clientConfigEnv)
+	}
+	return filepath.Join(home, ".avro-json-client.json"), nil
+}
+
+// loadClientConfig reads the config file at path; a missing file is an
+// empty config.
+func loadClientConfig(path string) (*clientConfig, error) {
+	cfg := &clientConfig{}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// save writes the config readable only by its owner, as profiles may hold
+// proxy credentials.
+func (c *clientConfig) save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o600)
+}
+
+func (c *clientConfig) lookup(name string) (map[string]string, bool) {
+	if p, ok := c.Profiles[name]; ok {
+		return p, true
+	}
+	p, ok := builtinProfiles[name]
+	return p, ok
+}
+
+func clientEnvName(flagName string) string {
+	return clientEnvPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// applyClientSettings fills the flags of fs that were not set on the
+// command line from the environment and then from the selected profile.
+// --server and --servers are one setting: when either is given on the
+// command line, neither is taken from elsewhere.
+func applyClientSettings(fs *flag.FlagSet, environ []string) error {
+	path, err := clientConfigPath()
+	if err != nil {
+		return err
+	}
+	cfg, err := loadClientConfig(path)
+	if err != nil {
+		return err
+	}
+	sources := make(map[string]string)
+	fs.VisitAll(func(f *flag.Flag) { sources[f.Name] = sourceDefault })
+	fs.Visit(func(f *flag.Flag) { sources[f.Name] = sourceFlag })
+
+	env := make(map[string]string)
+	for _, kv := range environ {
+		if k, v, ok := strings.Cut(kv, "="); ok && strings.HasPrefix(k, clientEnvPrefix) && k != clientConfigEnv {
+			env[k] = v
+		}
+	}
+
+	name := fs.Lookup("profile").Value.String()
+	if name == "" {
+		name = env[clientEnvName("profile")]
+	}
+	if name == "" {
+		name = cfg.Default
+	}
+	profile := map[string]string{}
+	if name != "" {
+		var ok bool
+		if profile, ok = cfg.lookup(name); !ok {
+			return fmt.Errorf("unknown profile %q in %s", name, path)
+		}
+	}
+
+	var errs []error
+	for key := range profile {
+		if fs.Lookup(key) == nil || key == "profile" {
+			errs = append(errs, fmt.Errorf("profile %s: unknown setting %q", name, key))
+		}
+	}
+	serverGiven := sources["server"] == sourceFlag || sources["servers"] == sourceFlag
+	known := make(map[string]bool)
+	fs.VisitAll(func(f *flag.Flag) {
+		key := clientEnvName(f.Name)
+		known[key] = true
+		if sources[f.Name] == sourceFlag || f.Name == "profile" {
+			return
+		}
+		if serverGiven && (f.Name == "server" || f.Name == "servers") {
+			return
+		}
+		if value, ok := env[key]; ok {
+			if err := fs.Set(f.Name, value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %v", key, err))
+			}
+			sources[f.Name] = sourceEnv
+		} else if value, ok := profile[f.Name]; ok {
+			if err := fs.Set(f.Name, value); err != nil {
+				errs = append(errs, fmt.Errorf("profile %s: %s: %v", name, f.Name, err))
+			}
+			sources[f.Name] = sourceProfile
+		}
+	})
+	for key := range env {
+		if !known[key] {
+			errs = append(errs, fmt.Errorf("unknown environment variable %s", key))
+		}
+	}
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+
+	settings.path, settings.config, settings.profile, settings.sources = path, cfg, name, sources
+	return errors.Join(errs...)
+}
+
+// runProfile manages the connection profiles of the config file.
+func runProfile(args []string) {
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+	cfg := settings.config
+	var err error
+	switch args[0] {
+	case "list":
+		listProfiles()
+	case "show":
+		showSettings()
+	case "save":
+		err = saveProfile(args[1:])
+	case "use":
+		if len(args) != 2 {
+			err = errors.New("usage: profile use <name>")
+		} else if _, ok := cfg.lookup(args[1]); !ok {
+			err = fmt.Errorf("unknown profile %q", args[1])
+		} else {
+			cfg.Default = args[1]
+			err = cfg.save(settings.path)
+		}
+		if err == nil {
+			fmt.Printf("✅ %s is now the default profile\n", args[1])
+		}
+	case "delete":
+		if len(args) != 2 {
+			err = errors.New("usage: profile delete <name>")
+		} else if _, ok := cfg.Profiles[args[1]]; !ok {
+			err = fmt.Errorf("no profile %q in %s", args[1], settings.path)
+		} else {
+			delete(cfg.Profiles, args[1])
+			if cfg.Default == args[1] {
+				cfg.Default = ""
+			}
+			err = cfg.save(settings.path)
+		}
+		if err == nil {
+			fmt.Printf("🗑️  Deleted profile %s\n", args[1])
+		}
+	default:
+		err = fmt.Errorf("unknown profile command %q: use list, show, save, use or delete", args[0])
+	}
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+	}
+}
+
+func listProfiles() {
+	cfg := settings.config
+	names := map[string]bool{}
+	for name := range builtinProfiles {
+		names[name] = true
+	}
+	for name := range cfg.Profiles {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	fmt.Printf("Profiles in %s:\n", settings.path)
+	for _, name := range sorted {
+		p, _ := cfg.lookup(name)
+		mark := " "
+		if name == settings.profile {
+			mark = "*"
+		}
+		server := p["server"]
+		if server == "" {
+			server = p["servers"]
+		}
+		note := ""
+		if name == cfg.Default {
+			note = " (default)"
+		}
+		if _, ok := cfg.Profiles[name]; !ok {
+			note += " (built in)"
+		}
+		fmt.Printf("%s %-12s %s%s\n", mark, name, server, note)
+	}
+}
+
+// showSettings prints every global flag and where its value came from.
+func showSettings() {
+	profile := settings.profile
+	if profile == "" {
+		profile = "none"
+	}
+	fmt.Printf("Profile: %s (config %s)\n", profile, settings.path)
+	flag.VisitAll(func(f *flag.Flag) {
+		if f.Name == "profile" {
+			return
+		}
+		fmt.Printf("  %-18s %-8s %s\n", f.Name, settings.sources[f.Name], f.Value.String())
+	})
+}
+
+// saveProfile stores every flag not left at its default as profile name,
+// so a profile can also be copied with changes, e.g.
+// go run . --server https://staging:8443 --tls-ca ca.pem profile save staging.
+func saveProfile(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: go run . [flags] profile save <name>")
+	}
+	name := args[0]
+	profile := map[string]string{}
+	flag.VisitAll(func(f *flag.Flag) {
+		if settings.sources[f.Name] != sourceDefault && f.Name != "profile" {
+			profile[f.Name] = f.Value.String()
+		}
+	})
+	if len(profile) == 0 {
+		return errors.New("no settings to save; give them as flags before the command, e.g. --server URL profile save " + name)
+	}
+	cfg := settings.config
+	if cfg.Profiles == nil {
+		cfg.Profiles = map[string]map[string]string{}
+	}
+	cfg.Profiles[name] = profile
+	if err := cfg.save(settings.path); err != nil {
+		return err
+	}
+	fmt.Printf("💾 Saved profile %s to %s: %d settings\n", name, settings.path, len(profile))
+	return nil
+}
@@ -0,0 +1,425 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// replSession is the state of an interactive session: the payload being
+// edited, the last response and the /log results to compare.
+type replSession struct {
+	payload map[string]interface{}
+	name    string // where the payload came from, starred once edited
+	last    *Response
+	logResp *LogResponse // the last response, when it answered /log
+	sent    []replSend
+}
+
+// replSend is one /log result kept for compare.
+type replSend struct {
+	payload string
+	stats   map[string]interface{}
+}
+
+const replHelp = `Commands:
+  new small|medium|large   start from a built-in payload
+  load <file.json>         load a payload from a file
+  save <file.json>         write the payload to a file
+  show                     print the payload and its size
+  set <path> <value>       set a field, e.g. set body.metadata.region eu-west-1;
+                           values that parse as JSON are used as JSON, others as strings
+  del <path>               remove a field
+  send [path]              POST the payload (default /log)
+  get <path>               GET an endpoint, e.g. get /stats
+  resp                     print the last response in full
+  decode                   unpack the Avro JSON embedded in the last /log response
+  decode <format>          fetch a stored artifact of the last log, e.g. logdata-binary,
+                           and decode it back to JSON with /decode
+  compare                  compare the sizes of every /log sent this session
+  help                     show this help
+  quit                     leave; Ctrl-D does too, and Ctrl-C cancels a request in flight and leaves`
+
+// runREPL reads commands from stdin until quit, so payloads can be built,
+// tweaked and sent without editing the createXLogData functions.
+func runREPL(args []string) {
+	s := &replSession{}
+	if err := s.newPayload("small"); err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return
+	}
+	fmt.Printf("🧪 Avro JSON REPL via %s, starting from the small payload; type help for commands\n", transport.Name())
+
+	in := bufio.NewScanner(os.Stdin)
+	in.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for rootCtx.Err() == nil {
+		fmt.Print("avro> ")
+		if !in.Scan() {
+			fmt.Println()
+			return
+		}
+		command, rest, _ := strings.Cut(strings.TrimSpace(in.Text()), " ")
+		rest = strings.TrimSpace(rest)
+		var err error
+		switch command {
+		case "":
+		case "help":
+			fmt.Println(replHelp)
+		case "new":
+			err = s.newPayload(rest)
+		case "load":
+			err = s.load(rest)
+		case "save":
+			err = s.save(rest)
+		case "show":
+			err = s.show()
+		case "set":
+			path, value, _ := strings.Cut(rest, " ")
+			err = s.set(path, strings.TrimSpace(value))
+		case "del":
+			err = s.del(rest)
+		case "send":
+			if rest == "" {
+				rest = logPath
+			}
+			err = s.send(rest)
+		case "get":
+			err = s.get(rest)
+		case "resp":
+			err = s.printLast()
+		case "decode":
+			err = s.decode(rest)
+		case "compare":
+			s.compare()
+		case "quit", "exit":
+			return
+		default:
+			err = fmt.Errorf("unknown command %q; type help for commands", command)
+		}
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+		}
+	}
+}
+
+// parseJSON decodes data keeping numbers exact, so timestamps survive a
+// round trip through the editable payload.
+func parseJSON(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("unexpected data after the JSON value")
+	}
+	return v, nil
+}
+
+func (s *replSession) setPayload(name string, data []byte) error {
+	v, err := parseJSON(data)
+	if err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+	payload, ok := v.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("the payload must be a JSON object")
+	}
+	s.payload, s.name = payload, name
+	return nil
+}
+
+func (s *replSession) newPayload(size string) error {
+	bodies, err := logBodies([]string{size})
+	if err != nil {
+		return err
+	}
+	return s.setPayload(size, bodies[size])
+}
+
+func (s *replSession) load(file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	if err := s.setPayload(file, data); err != nil {
+		return err
+	}
+	fmt.Printf("📂 Loaded %s (%d bytes)\n", file, len(data))
+	return nil
+}
+
+func (s *replSession) save(file string) error {
+	if file == "" {
+		return fmt.Errorf("usage: save <file.json>")
+	}
+	data, err := json.MarshalIndent(s.payload, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(file, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("💾 Saved %s\n", file)
+	return nil
+}
+
+func (s *replSession) show() error {
+	body, err := json.Marshal(s.payload)
+	if err != nil {
+		return err
+	}
+	pretty, _ := json.MarshalIndent(s.payload, "", "  ")
+	fmt.Printf("%s\n📄 %s: %d bytes\n", pretty, s.name, len(body))
+	return nil
+}
+
+// lookupParent walks path, a dotted list of object keys and array
+// indexes, and returns the container holding its last element.
+func (s *replSession) lookupParent(path string, create bool) (interface{}, string, error) {
+	if path == "" {
+		return nil, "", fmt.Errorf("missing field path")
+	}
+	parts := strings.Split(path, ".")
+	var node interface{} = s.payload
+	for i, part := range parts[:len(parts)-1] {
+		var next interface{}
+		switch n := node.(type) {
+		case map[string]interface{}:
+			next = n[part]
+			if next == nil && create {
+				next = map[string]interface{}{}
+				n[part] = next
+			}
+		case []interface{}:
+			idx, err := strconv.Atoi(part)
+			if err != nil || idx < 0 || idx >= len(n) {
+				return nil, "", fmt.Errorf("%s has no element %s", strings.Join(parts[:i], "."), part)
+			}
+			next = n[idx]
+		}
+		if next == nil {
+			return nil, "", fmt.Errorf("no field %s", strings.Join(parts[:i+1], "."))
+		}
+		node = next
+	}
+	return node, parts[len(parts)-1], nil
+}
+
+func (s *replSession) set(path, value string) error {
+	parent, key, err := s.lookupParent(path, true)
+	if err != nil {
+		return err
+	}
+	v, err := parseJSON([]byte(value))
+	if err != nil {
+		v = value
+	}
+	switch p := parent.(type) {
+	case map[string]interface{}:
+		p[key] = v
+	case []interface{}:
+		idx, err := strconv.Atoi(key)
+		if err != nil || idx < 0 || idx >= len(p) {
+			return fmt.Errorf("no element %s in %s", key, path)
+		}
+		p[idx] = v
+	default:
+		return fmt.Errorf("%s is not inside an object or array", path)
+	}
+	s.edited()
+	return nil
+}
+
+func (s *replSession) del(path string) error {
+	parent, key, err := s.lookupParent(path, false)
+	if err != nil {
+		return err
+	}
+	p, ok := parent.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%s is not an object field", path)
+	}
+	if _, ok := p[key]; !ok {
+		return fmt.Errorf("no field %s", path)
+	}
+	delete(p, key)
+	s.edited()
+	return nil
+}
+
+func (s *replSession) edited() {
+	if !strings.HasSuffix(s.name, "*") {
+		s.name += "*"
+	}
+}
+
+func (s *replSession) send(path string) error {
+	body, err := json.Marshal(s.payload)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("📤 POST %s (%s, %d bytes)\n", path, s.name, len(body))
+	resp, err := send(path, body)
+	if err != nil {
+		return err
+	}
+	s.received(resp)
+
+	if s.logResp == nil {
+		return s.printLast()
+	}
+	fmt.Printf("📥 %s: %s\n", resp.Status(), s.logResp.Status)
+	printStats(s.logResp.CompressionStats)
+	if s.logResp.CompressionStats != nil {
+		s.sent = append(s.sent, replSend{payload: s.name, stats: s.logResp.CompressionStats})
+	}
+	if s.logResp.ID != "" {
+		fmt.Printf("📦 Stored as %s; decode <format> reads it back\n", s.logResp.ID)
+	}
+	return nil
+}
+
+func (s *replSession) get(path string) error {
+	if path == "" {
+		return fmt.Errorf("usage: get <path>")
+	}
+	f, ok := transport.(fetcher)
+	if !ok {
+		return fmt.Errorf("the %s transport cannot send GET requests", transport.Name())
+	}
+	resp, err := f.Get(rootCtx, path)
+	if err != nil {
+		return err
+	}
+	s.received(resp)
+	return s.printLast()
+}
+
+// received keeps resp as the last response, parsing it as a /log answer
+// when it is one.
+func (s *replSession) received(resp *Response) {
+	s.last, s.logResp = resp, nil
+	var logResp LogResponse
+	if json.Unmarshal(resp.Body, &logResp) == nil && (logResp.CompressionStats != nil || logResp.ID != "") {
+		s.logResp = &logResp
+	}
+}
+
+func (s *replSession) printLast() error {
+	if s.last == nil {
+		return fmt.Errorf("nothing received yet")
+	}
+	fmt.Printf("📥 %s (%d bytes)\n", s.last.Status(), len(s.last.Body))
+	var pretty bytes.Buffer
+	if json.Indent(&pretty, s.last.Body, "", "  ") == nil {
+		fmt.Println(pretty.String())
+	} else {
+		fmt.Println(string(s.last.Body))
+	}
+	return nil
+}
+
+// printStats prints every compression_stats field, sorted by name.
+func printStats(stats map[string]interface{}) {
+	row := newResult("").setStats(stats)
+	for _, key := range row.columns[1:] {
+		fmt.Printf("  %-26s %v\n", key, stats[key])
+	}
+}
+
+func (s *replSession) decode(format string) error {
+	if s.logResp == nil {
+		return fmt.Errorf("the last response is not from /log; send the payload first")
+	}
+	if format == "" {
+		if s.logResp.WrapperAvroJSON == "" && s.logResp.LogdataAvroJSON == "" {
+			return fmt.Errorf("the server did not echo Avro JSON (see --echo); try decode logdata-binary")
+		}
+		for _, part := range []struct{ name, text string }{
+			{"Wrapper Avro JSON", s.logResp.WrapperAvroJSON},
+			{"LogData Avro JSON", s.logResp.LogdataAvroJSON},
+		} {
+			var pretty bytes.Buffer
+			if err := json.Indent(&pretty, []byte(part.text), "", "  "); err != nil {
+				fmt.Printf("=== %s (truncated) ===\n%s\n", part.name, part.text)
+				continue
+			}
+			fmt.Printf("=== %s ===\n%s\n", part.name, pretty.String())
+		}
+		return nil
+	}
+
+	link, ok := s.logResp.Artifacts[format]
+	if !ok {
+		return fmt.Errorf("the last log has no %s artifact; the server stores artifacts unless -artifact-dir is empty", format)
+	}
+	f, ok := transport.(fetcher)
+	if !ok {
+		return fmt.Errorf("the %s transport cannot fetch artifacts", transport.Name())
+	}
+	resp, err := f.Get(rootCtx, link)
+	if err != nil {
+		return err
+	}
+	if err := resp.Err(); err != nil {
+		return fmt.Errorf("fetching %s: %w", format, err)
+	}
+	fmt.Printf("📦 %s: %d bytes\n", format, len(resp.Body))
+	schema := "LogData"
+	switch {
+	case strings.HasPrefix(format, "wrapper"):
+		schema = "LogWrapper"
+	case !strings.HasPrefix(format, "logdata"):
+		// Not Avro, such as original-json.
+		s.received(resp)
+		return s.printLast()
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"schema": schema,
+		"data":   base64.StdEncoding.EncodeToString(resp.Body),
+	})
+	if err != nil {
+		return err
+	}
+	decoded, err := send("/decode", body)
+	if err != nil {
+		return err
+	}
+	s.last = decoded
+	return s.printLast()
+}
+
+// compare prints the sizes of every /log sent this session, with the
+// change from the one before.
+func (s *replSession) compare() {
+	if len(s.sent) == 0 {
+		fmt.Println("Nothing sent to /log yet")
+		return
+	}
+	fmt.Printf("%-3s %-24s %10s %10s %10s %9s %9s %10s\n", "#", "payload", "json", "wrapper", "logdata", "wrapper%", "logdata%", "Δ logdata")
+	prev := 0
+	for i, sent := range s.sent {
+		original := getIntValue(sent.stats, "original_json_size")
+		wrapper := getIntValue(sent.stats, "wrapper_avro_size")
+		logdata := getIntValue(sent.stats, "logdata_avro_size")
+		wrapperRatio, dataRatio := 0.0, 0.0
+		if original > 0 {
+			wrapperRatio = float64(wrapper) / float64(original) * 100
+			dataRatio = float64(logdata) / float64(original) * 100
+		}
+		delta := ""
+		if i > 0 {
+			delta = fmt.Sprintf("%+d", logdata-prev)
+		}
+		prev = logdata
+		fmt.Printf("%-3d %-24s %10d %10d %10d %8.2f%% %8.2f%% %10s\n", i+1, truncateString(sent.payload, 24),
+			original, wrapper, logdata, wrapperRatio, dataRatio, delta)
+	}
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// replayJob is one NDJSON line to send.
+type replayJob struct {
+	line int
+	body []byte
+}
+
+// runLogReplay streams an NDJSON file of log records to /log, one request
+// per line, printing progress as it goes and the cumulative compression
+// stats at the end, so exported production logs can be replayed against
+// a server. Lines may be /log requests, or LogWrapper or LogData records
+// as GET /logs/export?format=ndjson writes them; LogData records get the
+// wrapper fields from the flags. A .gz file is decompressed, and - reads
+// stdin.
+func runLogReplay(args []string) {
+	fs := flag.NewFlagSet("log replay", flag.ExitOnError)
+	concurrency := fs.Int("concurrency", 1, "concurrent requests; 1 keeps the file's order")
+	rate := fs.Float64("rate", 0, "most lines sent per second (0 for as fast as the server answers)")
+	skip := fs.Int("skip", 0, "lines skipped at the start of the file")
+	limit := fs.Int("limit", 0, "most lines sent (0 for all)")
+	progress := fs.Duration("progress", 2*time.Second, "how often progress is printed")
+	var wrapper LogRequest
+	fs.StringVar(&wrapper.ProjectName, "project-name", "replay", "projectName for LogData records")
+	fs.StringVar(&wrapper.ProjectVersion, "project-version", "1.0.0", "projectVersion for LogData records")
+	fs.StringVar(&wrapper.LogLevel, "log-level", "INFO", "logLevel for LogData records")
+	fs.StringVar(&wrapper.LogType, "log-type", "REPLAY", "logType for LogData records")
+	fs.StringVar(&wrapper.LogSource, "log-source", "ndjson", "logSource for LogData records")
+	file, args := splitFileArg(args)
+	fs.Parse(args)
+	if file == "" && fs.NArg() > 0 {
+		file = fs.Arg(0)
+	}
+	if file == "" {
+		fmt.Println("Please specify a file: go run . log replay <file.ndjson> [flags]")
+		return
+	}
+	if *concurrency < 1 || *rate < 0 || *skip < 0 || *limit < 0 || *progress <= 0 {
+		fmt.Println("❌ --concurrency must be at least 1, --progress positive and --rate, --skip and --limit not negative")
+		return
+	}
+
+	in, size, err := openReplayFile(file)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return
+	}
+	defer in.Close()
+	counted := &countingReader{r: in}
+	var r io.Reader = counted
+	if strings.HasSuffix(file, ".gz") {
+		gz, err := gzip.NewReader(counted)
+		if err != nil {
+			fmt.Printf("❌ %s: %v\n", file, err)
+			return
+		}
+		r = gz
+	}
+	reader := bufio.NewReaderSize(r, 1<<20)
+
+	fmt.Printf("📼 Replaying %s to %s via %s with %d workers\n", file, logPath, transport.Name(), *concurrency)
+	var (
+		mu       sync.Mutex
+		totals   batchTotals
+		failures = map[string][]int{} // lines by error
+		sent     atomic.Int64
+	)
+	jobs := make(chan replayJob)
+	var wg sync.WaitGroup
+	for w := 0; w < *concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				res := sendBatchLog(rootCtx, "", job.body)
+				row := newResult("log replay").set("line", job.line).setLatency("latency_ms", res.latency).set("attempts", res.attempts)
+				if res.err != "" {
+					row.set("error", res.err)
+				}
+				emitResult(row.setStats(res.stats))
+				mu.Lock()
+				totals.add(res)
+				if res.err != "" {
+					failures[res.err] = append(failures[res.err], job.line)
+				}
+				mu.Unlock()
+				sent.Add(1)
+			}
+		}()
+	}
+
+	start := time.Now()
+	lastProgress := start
+	report := func() {
+		mu.Lock()
+		ok, failed, original, wrapperBytes := totals.ok, totals.failed, totals.originalBytes, totals.wrapperBytes
+		mu.Unlock()
+		elapsed := time.Since(start)
+		done := ""
+		if size > 0 {
+			done = fmt.Sprintf(" (%.1f%% of the file)", float64(counted.n.Load())/float64(size)*100)
+		}
+		fmt.Printf("⏳ %d lines sent%s in %v, %.1f lines/s, %d ok, %d failed, %d bytes saved\n", sent.Load(), done,
+			elapsed.Round(time.Second), float64(sent.Load())/elapsed.Seconds(), ok, failed, original-wrapperBytes)
+	}
+
+	lineNo, queued, invalid := 0, 0, 0
+	var interval time.Duration
+	if *rate > 0 {
+		interval = time.Duration(float64(time.Second) / *rate)
+	}
+	for rootCtx.Err() == nil && (*limit == 0 || queued < *limit) {
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			lineNo++
+			if lineNo > *skip {
+				body, convErr := replayRequest(line, wrapper)
+				if convErr != nil {
+					invalid++
+					mu.Lock()
+					msg := "invalid line: " + convErr.Error()
+					failures[msg] = append(failures[msg], lineNo)
+					mu.Unlock()
+				} else {
+					if interval > 0 {
+						time.Sleep(time.Until(start.Add(time.Duration(queued) * interval)))
+					}
+					jobs <- replayJob{line: lineNo, body: body}
+					queued++
+				}
+			}
+		} else if len(line) > 0 {
+			lineNo++
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			fmt.Printf("❌ %s: reading line %d: %v\n", file, lineNo+1, err)
+			break
+		}
+		if time.Since(lastProgress) >= *progress {
+			lastProgress = time.Now()
+			report()
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	report()
+	printReplayReport(&totals, failures, invalid)
+}
+
+// splitFileArg takes a leading file argument off args, so a command can be
+// written as cmd <file> --flag value as well as cmd --flag value <file>.
+func splitFileArg(args []string) (string, []string) {
+	if len(args) > 0 && (args[0] == "-" || !strings.HasPrefix(args[0], "-")) {
+		return args[0], args[1:]
+	}
+	return "", args
+}
+
+// openReplayFile opens file, or stdin for -, and returns its size when
+// known.
+func openReplayFile(file string) (io.ReadCloser, int64, error) {
+	if file == "-" {
+		return io.NopCloser(os.Stdin), 0, nil
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, info.Size(), nil
+}
+
+// countingReader counts the bytes read through it, for progress.
+type countingReader struct {
+	r io.Reader
+	n atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+// replayRequest turns one NDJSON line into a /log request body. A
+// LogWrapper record's body is LogData Avro JSON text and is parsed; a
+// LogData record is wrapped with wrapper's fields. Union wrappers such as
+// {"map": {...}} around metadata and domainData are removed, and an RFC
+// 3339 timestamp, as exports with strip_unions=true write it, is turned
+// back into epoch milliseconds.
+func replayRequest(line []byte, wrapper LogRequest) ([]byte, error) {
+	v, err := parseJSON(line)
+	if err != nil {
+		return nil, err
+	}
+	record, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("not a JSON object")
+	}
+	if body, ok := record["body"]; ok {
+		if text, ok := body.(string); ok {
+			if body, err = parseJSON([]byte(text)); err != nil {
+				return nil, fmt.Errorf("body is not LogData JSON: %w", err)
+			}
+		}
+		data, ok := body.(map[string]interface{})
+		if !ok {
+			return nil, errors.New("body is not an object")
+		}
+		if err := unwrapLogUnions(data); err != nil {
+			return nil, err
+		}
+		record["body"] = data
+		return json.Marshal(record)
+	}
+	if record["timestamp"] == nil || record["logtype"] == nil {
+		return nil, errors.New("neither a /log request nor a LogWrapper or LogData record")
+	}
+	if err := unwrapLogUnions(record); err != nil {
+		return nil, err
+	}
+	return json.Marshal(map[string]interface{}{
+		"projectName":    wrapper.ProjectName,
+		"projectVersion": wrapper.ProjectVersion,
+		"logLevel":       wrapper.LogLevel,
+		"logType":        wrapper.LogType,
+		"logSource":      wrapper.LogSource,
+		"body":           record,
+	})
+}
+
+func unwrapLogUnions(data map[string]interface{}) error {
+	for _, field := range []string{"metadata", "domainData"} {
+		if union, ok := data[field].(map[string]interface{}); ok && len(union) == 1 {
+			if values, ok := union["map"].(map[string]interface{}); ok {
+				data[field] = values
+			}
+		}
+	}
+	if text, ok := data["timestamp"].(string); ok {
+		ts, err := time.Parse(time.RFC3339Nano, text)
+		if err != nil {
+			return fmt.Errorf("timestamp is neither epoch milliseconds nor RFC 3339: %q", text)
+		}
+		data["timestamp"] = ts.UnixMilli()
+	}
+	return nil
+}
+
+func printReplayReport(t *batchTotals, failures map[string][]int, invalid int) {
+	fmt.Printf("\n=== 📼 Replay Results ===\n")
+	fmt.Printf("Sent: %d ok, %d failed; %d invalid lines skipped\n", t.ok, t.failed, invalid)
+	sort.Slice(t.latencies, func(i, j int) bool { return t.latencies[i] < t.latencies[j] })
+	fmt.Printf("Latency: p50 %v, p99 %v, max %v\n", percentile(t.latencies, 50), percentile(t.latencies, 99), percentile(t.latencies, 100))
+	if t.originalBytes > 0 {
+		fmt.Printf("📄 Original JSON: %d bytes\n", t.originalBytes)
+		fmt.Printf("🗜️  Wrapper Avro:  %d bytes (%.2f%% of original)\n", t.wrapperBytes, float64(t.wrapperBytes)/float64(t.originalBytes)*100)
+		fmt.Printf("🗜️  LogData Avro:  %d bytes (%.2f%% of original)\n", t.dataBytes, float64(t.dataBytes)/float64(t.originalBytes)*100)
+		fmt.Printf("💾 Space saved:   %d bytes\n", t.originalBytes-t.wrapperBytes)
+	}
+
+	if len(failures) > 0 {
+		fmt.Printf("\n❌ Failures:\n")
+		for msg, lines := range failures {
+			sort.Ints(lines)
+			shown := lines
+			if len(shown) > 5 {
+				shown = shown[:5]
+			}
+			more := ""
+			if len(lines) > len(shown) {
+				more = ", ..."
+			}
+			fmt.Printf("  %6d × %s (lines %s%s)\n", len(lines), msg, strings.Trim(fmt.Sprint(shown), "[]"), more)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	mathrand "math/rand"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// rootCtx is cancelled on the first Ctrl-C or SIGTERM, so requests in
+// flight are abandoned and commands print what they have so far. A
+// second Ctrl-C quits at once.
+var rootCtx = context.Background()
+
+func cancelOnInterrupt() context.CancelFunc {
+	ctx, cancel := context.WithCancel(context.Background())
+	rootCtx = ctx
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		signal.Stop(signals)
+		fmt.Println("\n🛑 Interrupted, cancelling requests in flight (Ctrl-C again to quit)")
+		cancel()
+	}()
+	return cancel
+}
+
+// RetryOptions configures how every request is timed out and retried.
+type RetryOptions struct {
+	// Timeout bounds each attempt; 0 waits as long as the caller's context.
+	Timeout time.Duration
+	// Retries is how many times a failed attempt is repeated.
+	Retries int
+	// Backoff is the wait before the first retry, doubled for each next one
+	// up to MaxBackoff. Every wait is jittered to between half and all of
+	// it, so clients that failed together do not retry together.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// retryTransport repeats requests that failed in transit, timed out, or
+// were answered with 429 or a 5xx status, waiting as long as a Retry-After
+// asks. A 429 for a spent quota is not retried. Wrapped around a
+// round-robin transport, each retry goes to the next instance. Every
+// attempt of a /log request carries the same Idempotency-Key over HTTP, so
+// a server with an artifact store keeps it once; the frame transports
+// cannot send the key and may store a retried log twice.
+type retryTransport struct {
+	Transport
+	opts RetryOptions
+}
+
+func newRetryTransport(t Transport, opts RetryOptions) Transport {
+	rt := &retryTransport{Transport: t, opts: opts}
+	if _, ok := t.(fetcher); ok {
+		return retryFetcher{rt}
+	}
+	return rt
+}
+
+func (t *retryTransport) Send(ctx context.Context, path string, body []byte) (*Response, error) {
+	ctx = withIdempotencyKey(ctx, path)
+	return t.do(ctx, func(ctx context.Context) (*Response, error) {
+		return t.Transport.Send(ctx, path, body)
+	})
+}
+
+// retryFetcher is a retryTransport around a fetcher.
+type retryFetcher struct {
+	*retryTransport
+}
+
+func (t retryFetcher) Get(ctx context.Context, path string) (*Response, error) {
+	return t.do(ctx, func(ctx context.Context) (*Response, error) {
+		return t.Transport.(fetcher).Get(ctx, path)
+	})
+}
+
+func (t retryFetcher) Post(ctx context.Context, path, contentType string, body []byte) (*Response, error) {
+	ctx = withIdempotencyKey(ctx, path)
+	return t.do(ctx, func(ctx context.Context) (*Response, error) {
+		return t.Transport.(fetcher).Post(ctx, path, contentType, body)
+	})
+}
+
+func (t *retryTransport) do(ctx context.Context, send func(context.Context) (*Response, error)) (*Response, error) {
+	var resp *Response
+	var err error
+	var retryAfter time.Duration
+	for attempt := 0; attempt <= t.opts.Retries; attempt++ {
+		if attempt > 0 {
+			wait := retryAfter
+			if wait <= 0 {
+				wait = t.backoff(attempt)
+			}
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(wait):
+			}
+		}
+		resp, err = t.attempt(ctx, send)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		retryAfter = 0
+		if err == nil {
+			resp.Attempts = attempt + 1
+			if !retryable(resp) {
+				return resp, nil
+			}
+			retryAfter = resp.retryAfter(time.Now())
+		}
+	}
+	if err != nil {
+		return nil, &TransportError{Transport: t.Name(), Attempts: t.opts.Retries + 1, Err: err}
+	}
+	return resp, nil
+}
+
+func (t *retryTransport) attempt(ctx context.Context, send func(context.Context) (*Response, error)) (*Response, error) {
+	if t.opts.Timeout <= 0 {
+		return send(ctx)
+	}
+	attemptCtx, cancel := context.WithTimeout(ctx, t.opts.Timeout)
+	defer cancel()
+	resp, err := send(attemptCtx)
+	if err != nil && ctx.Err() == nil && errors.Is(attemptCtx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("timed out after %v: %w", t.opts.Timeout, err)
+	}
+	return resp, err
+}
+
+// backoff returns the jittered wait before retry attempt, counted from 1.
+func (t *retryTransport) backoff(attempt int) time.Duration {
+	wait := t.opts.Backoff << (attempt - 1)
+	if wait <= 0 || (t.opts.MaxBackoff > 0 && wait > t.opts.MaxBackoff) {
+		wait = t.opts.MaxBackoff
+	}
+	if wait <= 0 {
+		return 0
+	}
+	return wait/2 + time.Duration(mathrand.Int63n(int64(wait/2)+1))
+}
+
+// retryable reports whether a response is worth retrying: the server was
+// overloaded or failing. A project over its quota stays over it until the
+// quota resets, so its 429 is final.
+func retryable(resp *Response) bool {
+	switch {
+	case resp.StatusCode >= 500:
+		return true
+	case resp.StatusCode == http.StatusTooManyRequests:
+		var limited *RateLimitedError
+		return !errors.As(resp.Err(), &limited) || limited.Code != "quota_exceeded"
+	}
+	return false
+}
+
+// idempotencyKeyHeader names the key the server deduplicates logs by.
+const idempotencyKeyHeader = "Idempotency-Key"
+
+type idempotencyKeyContext struct{}
+
+// withIdempotencyKey gives a /log request a fresh key, shared by all its
+// attempts.
+func withIdempotencyKey(ctx context.Context, path string) context.Context {
+	if path != "/log" && path != "/log/binary" {
+		return ctx
+	}
+	key := make([]byte, 16)
+	rand.Read(key)
+	return context.WithValue(ctx, idempotencyKeyContext{}, hex.EncodeToString(key))
+}
+
+// idempotencyKey returns the key withIdempotencyKey put in ctx, or "".
+func idempotencyKey(ctx context.Context) string {
+	key, _ := ctx.Value(idempotencyKeyContext{}).(string)
+	return key
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     RetryOptions
+		attempt  int
+		min, max time.Duration
+	}{
+		{"first retry", RetryOptions{Backoff: 100 * time.Millisecond, MaxBackoff: time.Second}, 1, 50 * time.Millisecond, 100 * time.Millisecond},
+		{"doubled", RetryOptions{Backoff: 100 * time.Millisecond, MaxBackoff: time.Second}, 3, 200 * time.Millisecond, 400 * time.Millisecond},
+		{"capped", RetryOptions{Backoff: 100 * time.Millisecond, MaxBackoff: time.Second}, 10, 500 * time.Millisecond, time.Second},
+		{"overflow capped", RetryOptions{Backoff: time.Second, MaxBackoff: 5 * time.Second}, 70, 2500 * time.Millisecond, 5 * time.Second},
+		{"no backoff", RetryOptions{}, 2, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := &retryTransport{opts: tt.opts}
+			for i := 0; i < 20; i++ {
+				if wait := rt.backoff(tt.attempt); wait < tt.min || wait > tt.max {
+					t.Fatalf("backoff(%d) = %v, want between %v and %v", tt.attempt, wait, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		status int
+		body   string
+		want   bool
+	}{
+		{http.StatusOK, `{}`, false},
+		{http.StatusBadRequest, `{"code":"invalid_request"}`, false},
+		{http.StatusTooManyRequests, `{"code":"rate_limited"}`, true},
+		{http.StatusTooManyRequests, `{"code":"quota_exceeded","resets_at":"2030-01-01T00:00:00Z"}`, false},
+		{http.StatusTooManyRequests, `slow down`, true},
+		{http.StatusServiceUnavailable, `{"code":"upstream_failed"}`, true},
+	}
+	for _, tt := range tests {
+		if got := retryable(&Response{StatusCode: tt.status, Body: []byte(tt.body)}); got != tt.want {
+			t.Errorf("retryable(%d %s) = %v, want %v", tt.status, tt.body, got, tt.want)
+		}
+	}
+}
+
+// scriptedTransport answers Send with its responses in turn and records
+// the idempotency key of each call.
+type scriptedTransport struct {
+	responses []*Response
+	keys      []string
+}
+
+func (s *scriptedTransport) Name() string { return "scripted" }
+func (s *scriptedTransport) Close() error { return nil }
+
+func (s *scriptedTransport) Send(ctx context.Context, path string, body []byte) (*Response, error) {
+	s.keys = append(s.keys, idempotencyKey(ctx))
+	resp := s.responses[0]
+	s.responses = s.responses[1:]
+	return resp, nil
+}
+
+func TestRetryTransport(t *testing.T) {
+	limited := &Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {"1"}}, Body: []byte(`{"code":"rate_limited"}`)}
+	ok := &Response{StatusCode: http.StatusOK, Body: []byte(`{}`)}
+	script := &scriptedTransport{responses: []*Response{limited, ok}}
+	rt := newRetryTransport(script, RetryOptions{Retries: 2, Backoff: time.Hour, MaxBackoff: time.Hour})
+
+	// The second of Retry-After is honored over the hour of backoff.
+	resp, err := rt.Send(context.Background(), "/log", []byte(`{}`))
+	if err != nil || resp.StatusCode != http.StatusOK || resp.Attempts != 2 {
+		t.Fatalf("expected success on the second attempt, got %+v: %v", resp, err)
+	}
+	if len(script.keys) != 2 || script.keys[0] == "" || script.keys[0] != script.keys[1] {
+		t.Errorf("expected one idempotency key across attempts, got %q", script.keys)
+	}
+
+	script.responses, script.keys = []*Response{ok}, nil
+	if rt.Send(context.Background(), "/stats", nil); script.keys[0] != "" {
+		t.Errorf("expected no idempotency key outside /log, got %q", script.keys[0])
+	}
+
+	quota := &Response{StatusCode: http.StatusTooManyRequests, Body: []byte(`{"code":"quota_exceeded"}`)}
+	script.responses, script.keys = []*Response{quota, ok}, nil
+	if resp, _ := rt.Send(context.Background(), "/log", nil); resp.StatusCode != http.StatusTooManyRequests || resp.Attempts != 1 {
+		t.Errorf("expected quota_exceeded to be final, got %+v", resp)
+	}
+}
@@ -0,0 +1,470 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Transport delivers a JSON request body to a server endpoint. Every
+// implementation reaches the same server handlers so that bench scenarios
+// can compare transport overhead independently of serialization.
+type Transport interface {
+	Name() string
+	Send(ctx context.Context, path string, body []byte) (*Response, error)
+	Close() error
+}
+
+// fetcher is implemented by transports that can send GET requests and
+// bodies other than JSON; the frame-based transports always POST JSON.
+type fetcher interface {
+	Get(ctx context.Context, path string) (*Response, error)
+	Post(ctx context.Context, path, contentType string, body []byte) (*Response, error)
+}
+
+// Response is the transport-independent result of a request.
+type Response struct {
+	StatusCode int
+	Body       []byte
+	// WireBytes is the number of bytes written for the request including
+	// transport framing, when the transport can report it.
+	WireBytes int
+	// Instance is the index of the server that answered in round-robin mode.
+	Instance int
+	// Attempts is how many times the request was sent, counting retries.
+	Attempts int
+	// Header holds the response headers; only the http transport has them.
+	Header http.Header
+}
+
+func (r *Response) Status() string {
+	return fmt.Sprintf("%d %s", r.StatusCode, http.StatusText(r.StatusCode))
+}
+
+const grpcTransportPath = "/exp.avrojson.Transport/Call"
+
+// TransportOptions carries the endpoints used by the different transports.
+type TransportOptions struct {
+	ServerURL string
+	TCPAddr   string
+	UDPAddr   string
+	// TLS enables TLS (and mutual TLS when it carries a client certificate)
+	// for every transport except udp.
+	TLS *tls.Config
+	// Network configures proxies and name resolution.
+	Network NetworkOptions
+}
+
+func newTransport(name string, opts TransportOptions) (Transport, error) {
+	if opts.TLS != nil && name == "udp" {
+		return nil, errors.New("the udp transport does not support TLS")
+	}
+	if opts.Network.ProxyURL != "" && name == "udp" {
+		return nil, errors.New("the udp transport cannot be proxied")
+	}
+
+	switch name {
+	case "http", "", "h2c", "grpc":
+		client, err := newHTTPClient(name != "http" && name != "", opts.TLS, opts.Network)
+		if err != nil {
+			return nil, err
+		}
+		if name == "grpc" {
+			return &grpcTransport{serverURL: opts.ServerURL, client: client}, nil
+		}
+		if name == "" {
+			name = "http"
+		}
+		return newHTTPTransport(name, opts.ServerURL, client), nil
+	case "tcp":
+		if _, err := opts.Network.proxyURL(); err != nil {
+			return nil, err
+		}
+		return &tcpTransport{addr: opts.TCPAddr, tlsConfig: opts.TLS, network: opts.Network}, nil
+	case "udp":
+		return &udpTransport{addr: opts.UDPAddr, network: opts.Network}, nil
+	default:
+		return nil, fmt.Errorf("unknown transport %q (expected http, h2c, grpc, tcp or udp)", name)
+	}
+}
+
+// newHTTPClient returns a client speaking HTTP/1.1, or HTTP/2 when http2 is
+// set: prior-knowledge h2c over plaintext, ALPN-negotiated h2 over TLS.
+// Plaintext h2c only works through socks5 proxies, since HTTP forward
+// proxies expect HTTP/1.1.
+func newHTTPClient(http2 bool, tlsConfig *tls.Config, network NetworkOptions) (*http.Client, error) {
+	proxy, err := network.httpProxy()
+	if err != nil {
+		return nil, err
+	}
+
+	protocols := new(http.Protocols)
+	switch {
+	case http2 && tlsConfig != nil:
+		protocols.SetHTTP2(true)
+	case http2:
+		protocols.SetUnencryptedHTTP2(true)
+	default:
+		protocols.SetHTTP1(true)
+	}
+	return &http.Client{Transport: &http.Transport{
+		Protocols:       protocols,
+		TLSClientConfig: tlsConfig,
+		Proxy:           proxy,
+		DialContext:     network.httpDial,
+	}}, nil
+}
+
+// httpTransport posts JSON over HTTP/1.1 or HTTP/2 depending on its client.
+type httpTransport struct {
+	name      string
+	serverURL string
+	client    *http.Client
+}
+
+func newHTTPTransport(name, serverURL string, client *http.Client) *httpTransport {
+	return &httpTransport{name: name, serverURL: serverURL, client: client}
+}
+
+func (t *httpTransport) Name() string { return t.name }
+
+func (t *httpTransport) Send(ctx context.Context, path string, body []byte) (*Response, error) {
+	return t.Post(ctx, path, "application/json", body)
+}
+
+func (t *httpTransport) Post(ctx context.Context, path, contentType string, body []byte) (*Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.serverURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if key := idempotencyKey(ctx); key != "" {
+		req.Header.Set(idempotencyKeyHeader, key)
+	}
+	return t.do(req, len(body))
+}
+
+func (t *httpTransport) Get(ctx context.Context, path string) (*Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.serverURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return t.do(req, 0)
+}
+
+func (t *httpTransport) do(req *http.Request, wireBytes int) (*Response, error) {
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &Response{StatusCode: resp.StatusCode, Body: respBody, WireBytes: wireBytes, Header: resp.Header}, nil
+}
+
+func (t *httpTransport) Close() error {
+	t.client.CloseIdleConnections()
+	return nil
+}
+
+// grpcTransport wraps request frames in unary gRPC messages over h2c.
+type grpcTransport struct {
+	serverURL string
+	client    *http.Client
+}
+
+func (t *grpcTransport) Name() string { return "grpc" }
+
+func (t *grpcTransport) Send(ctx context.Context, path string, body []byte) (*Response, error) {
+	frame, err := encodeRequestFrame(path, body)
+	if err != nil {
+		return nil, err
+	}
+	message := make([]byte, 5+len(frame))
+	binary.BigEndian.PutUint32(message[1:5], uint32(len(frame)))
+	copy(message[5:], frame)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.serverURL+grpcTransportPath, bytes.NewReader(message))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	payload, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	status := resp.Trailer.Get("Grpc-Status")
+	if status == "" {
+		status = resp.Header.Get("Grpc-Status")
+	}
+	if status != "0" {
+		msg := resp.Trailer.Get("Grpc-Message")
+		if msg == "" {
+			msg = resp.Header.Get("Grpc-Message")
+		}
+		return nil, fmt.Errorf("grpc status %s: %s", status, msg)
+	}
+	if len(payload) < 5 {
+		return nil, errors.New("grpc response message truncated")
+	}
+
+	out, err := decodeResponseFrame(payload[5:])
+	if err != nil {
+		return nil, err
+	}
+	out.WireBytes = len(message)
+	return out, nil
+}
+
+func (t *grpcTransport) Close() error {
+	t.client.CloseIdleConnections()
+	return nil
+}
+
+// tcpTransport keeps one connection open and exchanges length-prefixed frames.
+type tcpTransport struct {
+	addr      string
+	tlsConfig *tls.Config
+	network   NetworkOptions
+
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func (t *tcpTransport) Name() string { return "tcp" }
+
+func (t *tcpTransport) Send(ctx context.Context, path string, body []byte) (*Response, error) {
+	frame, err := encodeRequestFrame(path, body)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.conn == nil {
+		conn, err := t.network.streamDial(ctx, t.addr)
+		if err != nil {
+			return nil, err
+		}
+		if t.tlsConfig != nil {
+			config := t.tlsConfig.Clone()
+			if config.ServerName == "" {
+				config.ServerName, _, _ = net.SplitHostPort(t.addr)
+			}
+			tlsConn := tls.Client(conn, config)
+			if err := tlsConn.HandshakeContext(ctx); err != nil {
+				conn.Close()
+				return nil, err
+			}
+			conn = tlsConn
+		}
+		t.conn = conn
+		t.reader = bufio.NewReader(conn)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		t.conn.SetDeadline(deadline)
+	}
+
+	out := make([]byte, 4+len(frame))
+	binary.BigEndian.PutUint32(out[:4], uint32(len(frame)))
+	copy(out[4:], frame)
+	if _, err := t.conn.Write(out); err != nil {
+		t.reset()
+		return nil, err
+	}
+
+	var size uint32
+	if err := binary.Read(t.reader, binary.BigEndian, &size); err != nil {
+		t.reset()
+		return nil, err
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(t.reader, payload); err != nil {
+		t.reset()
+		return nil, err
+	}
+
+	resp, err := decodeResponseFrame(payload)
+	if err != nil {
+		return nil, err
+	}
+	resp.WireBytes = len(out)
+	return resp, nil
+}
+
+func (t *tcpTransport) reset() {
+	if t.conn != nil {
+		t.conn.Close()
+	}
+	t.conn = nil
+	t.reader = nil
+}
+
+func (t *tcpTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.reset()
+	return nil
+}
+
+// udpTransport sends each request as a single datagram, so payloads are
+// limited to what fits in one UDP packet.
+type udpTransport struct {
+	addr    string
+	network NetworkOptions
+}
+
+const maxDatagramSize = 65507
+
+func (t *udpTransport) Name() string { return "udp" }
+
+func (t *udpTransport) Send(ctx context.Context, path string, body []byte) (*Response, error) {
+	frame, err := encodeRequestFrame(path, body)
+	if err != nil {
+		return nil, err
+	}
+	if len(frame) > maxDatagramSize {
+		return nil, fmt.Errorf("request of %d bytes exceeds UDP datagram size", len(frame))
+	}
+
+	conn, err := t.network.directDial(ctx, "udp", t.addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if _, err := conn.Write(frame); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, maxDatagramSize)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := decodeResponseFrame(buf[:n])
+	if err != nil {
+		return nil, err
+	}
+	resp.WireBytes = len(frame)
+	return resp, nil
+}
+
+func (t *udpTransport) Close() error { return nil }
+
+// encodeRequestFrame builds [2 bytes path length][path][body], matching the
+// server's frame layout.
+func encodeRequestFrame(path string, body []byte) ([]byte, error) {
+	if !strings.HasPrefix(path, "/") || len(path) > 0xFFFF {
+		return nil, fmt.Errorf("invalid frame path %q", path)
+	}
+	frame := make([]byte, 2+len(path)+len(body))
+	binary.BigEndian.PutUint16(frame[:2], uint16(len(path)))
+	copy(frame[2:], path)
+	copy(frame[2+len(path):], body)
+	return frame, nil
+}
+
+func decodeResponseFrame(frame []byte) (*Response, error) {
+	if len(frame) < 2 {
+		return nil, errors.New("response frame too short")
+	}
+	return &Response{
+		StatusCode: int(binary.BigEndian.Uint16(frame[:2])),
+		Body:       frame[2:],
+	}, nil
+}
+
+// roundRobinTransport spreads requests across several server instances.
+type roundRobinTransport struct {
+	transports []Transport
+	next       atomic.Uint64
+}
+
+func newRoundRobinTransport(transports []Transport) Transport {
+	if len(transports) == 1 {
+		return transports[0]
+	}
+	rr := &roundRobinTransport{transports: transports}
+	if _, ok := transports[0].(fetcher); ok {
+		return roundRobinFetcher{rr}
+	}
+	return rr
+}
+
+func (t *roundRobinTransport) Name() string {
+	return fmt.Sprintf("%s×%d (round-robin)", t.transports[0].Name(), len(t.transports))
+}
+
+func (t *roundRobinTransport) Send(ctx context.Context, path string, body []byte) (*Response, error) {
+	i := (t.next.Add(1) - 1) % uint64(len(t.transports))
+	resp, err := t.transports[i].Send(ctx, path, body)
+	if err != nil {
+		return nil, fmt.Errorf("instance %d: %w", i, err)
+	}
+	resp.Instance = int(i)
+	return resp, nil
+}
+
+// roundRobinFetcher is a roundRobinTransport whose instances are all
+// fetchers.
+type roundRobinFetcher struct {
+	*roundRobinTransport
+}
+
+func (t roundRobinFetcher) Get(ctx context.Context, path string) (*Response, error) {
+	i := (t.next.Add(1) - 1) % uint64(len(t.transports))
+	resp, err := t.transports[i].(fetcher).Get(ctx, path)
+	if err != nil {
+		return nil, fmt.Errorf("instance %d: %w", i, err)
+	}
+	resp.Instance = int(i)
+	return resp, nil
+}
+
+func (t roundRobinFetcher) Post(ctx context.Context, path, contentType string, body []byte) (*Response, error) {
+	i := (t.next.Add(1) - 1) % uint64(len(t.transports))
+	resp, err := t.transports[i].(fetcher).Post(ctx, path, contentType, body)
+	if err != nil {
+		return nil, fmt.Errorf("instance %d: %w", i, err)
+	}
+	resp.Instance = int(i)
+	return resp, nil
+}
+
+func (t *roundRobinTransport) Close() error {
+	var errs []error
+	for _, tr := range t.transports {
+		errs = append(errs, tr.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,349 @@
+package artifact
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/homveloper/exp-avro-json/server/bloom"
+)
+
+// Existence checks against blobs and idempotency keys go through Bloom
+// filters first, so the common "never seen" answer costs no disk access.
+// Each set is split into 16 partitions by the first hex digit of the
+// SHA-256, persisted as bloom/<set>-<digit>.bloom next to the manifests.
+const (
+	filterPartitions = 16
+	// filterCapacity is the expected number of keys per set; beyond it the
+	// false-positive rate climbs above filterFalsePositive, which costs
+	// extra disk lookups but never a wrong answer.
+	filterCapacity      = 1 << 20
+	filterFalsePositive = 0.01
+)
+
+// cleanMarker exists only while the filter files on disk hold every key.
+// It is removed before the first key added after a flush, so after a crash
+// the filters are rebuilt from the blobs and keys directories.
+const cleanMarker = "clean"
+
+type filterSet struct {
+	name  string
+	parts [filterPartitions]*bloom.Filter
+	dirty [filterPartitions]bool
+}
+
+func newFilterSet(name string) *filterSet {
+	s := &filterSet{name: name}
+	for i := range s.parts {
+		s.parts[i] = bloom.New(filterCapacity/filterPartitions, filterFalsePositive)
+		s.dirty[i] = true
+	}
+	return s
+}
+
+// partition picks the filter of a hex SHA-256.
+func partition(hash string) int {
+	v, _ := hex.DecodeString("0" + hash[:1])
+	return int(v[0])
+}
+
+func (s *filterSet) test(hash string) bool { return s.parts[partition(hash)].Test([]byte(hash)) }
+
+func (s *filterSet) add(hash string) {
+	p := partition(hash)
+	s.parts[p].Add([]byte(hash))
+	s.dirty[p] = true
+}
+
+func (s *filterSet) count() int64 {
+	var n uint64
+	for _, f := range s.parts {
+		n += f.Count()
+	}
+	return int64(n)
+}
+
+func (s *filterSet) path(dir string, p int) string {
+	return filepath.Join(dir, fmt.Sprintf("%s-%x.bloom", s.name, p))
+}
+
+func (s *filterSet) load(dir string) error {
+	for p := range s.parts {
+		data, err := os.ReadFile(s.path(dir, p))
+		if err != nil {
+			return err
+		}
+		if err := s.parts[p].UnmarshalBinary(data); err != nil {
+			return fmt.Errorf("artifact: %s: %w", s.path(dir, p), err)
+		}
+		s.dirty[p] = false
+	}
+	return nil
+}
+
+// FilterStats describes the Bloom filters in front of the store's
+// existence checks. Keys counts claimed idempotency keys and Duplicates
+// the claims that found one. Negatives are checks answered without
+// touching disk; FalsePositives are "maybe" answers the disk lookup then
+// refuted.
+type FilterStats struct {
+	Keys              int64   `json:"keys"`
+	Duplicates        int64   `json:"duplicates"`
+	Negatives         int64   `json:"negatives"`
+	FalsePositives    int64   `json:"false_positives"`
+	FalsePositiveRate float64 `json:"false_positive_rate"`
+	Rebuilt           bool    `json:"rebuilt"`
+}
+
+func (s *Store) filterDir() string { return filepath.Join(s.dir, "bloom") }
+func (s *Store) keyDir() string    { return filepath.Join(s.dir, "keys") }
+
+func (s *Store) keyPath(hash string) string {
+	return filepath.Join(s.keyDir(), hash[:2], hash)
+}
+
+// openFilters loads the persisted filters, or rebuilds them when the last
+// process did not flush them cleanly. It runs before scan, which adds the
+// blob hashes to the blob filter unless it was loaded.
+func (s *Store) openFilters() error {
+	s.blobFilter, s.keyFilter = newFilterSet("blobs"), newFilterSet("keys")
+	marker := filepath.Join(s.filterDir(), cleanMarker)
+	_, err := os.Stat(marker)
+	if err == nil {
+		err = s.blobFilter.load(s.filterDir())
+	}
+	if err == nil {
+		err = s.keyFilter.load(s.filterDir())
+	}
+	if err == nil {
+		s.filterStats.Keys = s.keyFilter.count()
+		s.filtersClean = true
+		return nil
+	}
+	if !errors.Is(err, os.ErrNotExist) && !errors.Is(err, bloom.ErrCorrupt) {
+		return err
+	}
+
+	s.blobFilter, s.keyFilter = newFilterSet("blobs"), newFilterSet("keys")
+	// A missing filter directory is a new store, or one from before the
+	// filters; only an unclean shutdown counts as a rebuild.
+	if _, err := os.Stat(s.filterDir()); err == nil {
+		s.filterStats.Rebuilt = true
+	}
+	err = filepath.WalkDir(s.keyDir(), func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, os.ErrNotExist) && path == s.keyDir() {
+			return fs.SkipDir
+		}
+		if err != nil || d.IsDir() || !hashPattern.MatchString(d.Name()) {
+			return err
+		}
+		s.keyFilter.add(d.Name())
+		s.filterStats.Keys++
+		return nil
+	})
+	return err
+}
+
+// mayContain reports whether the filter of set may hold hash.
+func (s *Store) mayContain(set *filterSet, hash string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return set.test(hash)
+}
+
+// admit adds hash to set ahead of the file that records it, so a crash in
+// between never leaves a key on disk the filter denies. maybe is what the
+// preceding check answered, which the disk lookup has since refuted.
+func (s *Store) admit(set *filterSet, hash string, maybe bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if maybe {
+		s.filterStats.FalsePositives++
+	} else {
+		s.filterStats.Negatives++
+	}
+	if s.filtersClean {
+		if err := os.Remove(filepath.Join(s.filterDir(), cleanMarker)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		s.filtersClean = false
+	}
+	set.add(hash)
+	s.filterGeneration++
+	return nil
+}
+
+// FlushFilters writes the filter partitions that changed since the last
+// flush and marks the files clean. Call it periodically and before exit;
+// filters that were not flushed are rebuilt on the next Open.
+func (s *Store) FlushFilters() error {
+	type snapshot struct {
+		set  *filterSet
+		part int
+		data []byte
+	}
+	s.mu.Lock()
+	if s.filtersClean {
+		s.mu.Unlock()
+		return nil
+	}
+	var pending []snapshot
+	for _, set := range []*filterSet{s.blobFilter, s.keyFilter} {
+		for p, f := range set.parts {
+			if !set.dirty[p] {
+				continue
+			}
+			data, err := f.MarshalBinary()
+			if err != nil {
+				s.mu.Unlock()
+				return err
+			}
+			pending = append(pending, snapshot{set, p, data})
+			set.dirty[p] = false
+		}
+	}
+	generation := s.filterGeneration
+	s.mu.Unlock()
+
+	if err := os.MkdirAll(s.filterDir(), 0755); err != nil {
+		return err
+	}
+	for i, snap := range pending {
+		if err := replaceFile(snap.set.path(s.filterDir(), snap.part), snap.data); err != nil {
+			s.mu.Lock()
+			for _, rest := range pending[i:] {
+				rest.set.dirty[rest.part] = true
+			}
+			s.mu.Unlock()
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.filterGeneration != generation {
+		// Keys arrived while writing; the next flush covers them.
+		return nil
+	}
+	if err := os.WriteFile(filepath.Join(s.filterDir(), cleanMarker), nil, 0644); err != nil {
+		return err
+	}
+	s.filtersClean = true
+	return nil
+}
+
+// replaceFile atomically replaces path with data. Unlike blobs, filter
+// files are meant to be overwritten.
+func replaceFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".flush-")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// Claim records key, such as a client's idempotency key, as belonging to
+// log id. If the key was claimed before, Claim returns the earlier log's
+// ID with claimed false. Keys never seen are recognised by the Bloom
+// filter alone; only possible repeats are looked up on disk.
+func (s *Store) Claim(key, id string) (owner string, claimed bool, err error) {
+	if key == "" {
+		return "", false, errors.New("artifact: empty idempotency key")
+	}
+	if !idPattern.MatchString(id) {
+		return "", false, fmt.Errorf("artifact: invalid log id %q", id)
+	}
+	hash := hashOf([]byte(key))
+	path := s.keyPath(hash)
+
+	maybe := s.mayContain(s.keyFilter, hash)
+	if maybe {
+		owner, err := s.keyOwner(path)
+		if err == nil || !errors.Is(err, os.ErrNotExist) {
+			return owner, false, err
+		}
+	}
+	if err := s.admit(s.keyFilter, hash, maybe); err != nil {
+		return "", false, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", false, err
+	}
+	created, err := writeOnce(path, []byte(id))
+	if err != nil {
+		return "", false, err
+	}
+	if !created {
+		// A concurrent request with the same key won.
+		owner, err := s.keyOwner(path)
+		return owner, false, err
+	}
+	s.mu.Lock()
+	s.filterStats.Keys++
+	s.mu.Unlock()
+	return id, true, nil
+}
+
+// Release undoes a claim of key by log id, for a log that failed to be
+// stored. The filter keeps the key, which only costs a disk lookup later.
+func (s *Store) Release(key, id string) error {
+	path := s.keyPath(hashOf([]byte(key)))
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(data)) != id {
+		return nil
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.filterStats.Keys--
+	s.mu.Unlock()
+	return nil
+}
+
+// keyOwner reads the log ID a claimed key belongs to.
+func (s *Store) keyOwner(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	s.filterStats.Duplicates++
+	s.mu.Unlock()
+	return strings.TrimSpace(string(data)), nil
+}
+
+// FilterStats returns the Bloom filter counters.
+func (s *Store) FilterStats() FilterStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := s.filterStats
+	var rate float64
+	for _, set := range []*filterSet{s.blobFilter, s.keyFilter} {
+		for _, f := range set.parts {
+			rate += f.FalsePositiveRate()
+		}
+	}
+	stats.FalsePositiveRate = rate / (2 * filterPartitions)
+	return stats
+}
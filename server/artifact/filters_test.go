@@ -0,0 +1,87 @@
+package artifact
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClaimDetectsRepeatedKeys(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	owner, claimed, err := s.Claim("event-1", "log1")
+	if err != nil || !claimed || owner != "log1" {
+		t.Fatalf("unexpected first claim %q %v: %v", owner, claimed, err)
+	}
+	owner, claimed, err = s.Claim("event-1", "log2")
+	if err != nil || claimed || owner != "log1" {
+		t.Fatalf("Expected the repeat to report log1, got %q %v: %v", owner, claimed, err)
+	}
+	if _, _, err := s.Claim("", "log3"); err == nil {
+		t.Error("Expected an empty key to be rejected")
+	}
+	stats := s.FilterStats()
+	if stats.Keys != 1 || stats.Duplicates != 1 || stats.Negatives != 1 || stats.Rebuilt {
+		t.Errorf("unexpected filter stats %+v", stats)
+	}
+
+	if err := s.FlushFilters(); err != nil {
+		t.Fatalf("Failed to flush filters: %v", err)
+	}
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	if stats := reopened.FilterStats(); stats.Rebuilt || stats.Keys != 1 {
+		t.Errorf("Expected the flushed filters to be loaded, got %+v", stats)
+	}
+	if owner, claimed, _ := reopened.Claim("event-1", "log4"); claimed || owner != "log1" {
+		t.Errorf("reopened store lost key event-1: %q %v", owner, claimed)
+	}
+
+	// A key claimed after the last flush must survive a crash.
+	if _, claimed, err := reopened.Claim("event-2", "log5"); err != nil || !claimed {
+		t.Fatalf("Failed to claim event-2: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "bloom", cleanMarker)); !os.IsNotExist(err) {
+		t.Fatalf("Expected the clean marker to be removed, got %v", err)
+	}
+	crashed, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen store after a crash: %v", err)
+	}
+	if stats := crashed.FilterStats(); !stats.Rebuilt || stats.Keys != 2 {
+		t.Errorf("Expected rebuilt filters holding 2 keys, got %+v", stats)
+	}
+	if owner, claimed, _ := crashed.Claim("event-2", "log6"); claimed || owner != "log5" {
+		t.Errorf("rebuilt filters lost key event-2: %q %v", owner, claimed)
+	}
+}
+
+func TestBlobFilterSurvivesRebuild(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	if err := s.Put("one", map[string][]byte{WrapperBinary: []byte("payload")}); err != nil {
+		t.Fatalf("Failed to put artifacts: %v", err)
+	}
+
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	if err := reopened.Put("two", map[string][]byte{WrapperBinary: []byte("payload")}); err != nil {
+		t.Fatalf("Failed to put artifacts: %v", err)
+	}
+	if stats := reopened.Stats(); stats.Blobs != 1 || stats.DedupHits != 1 {
+		t.Errorf("Expected the payload to dedup after a rebuild, got %+v", stats)
+	}
+	if stats := reopened.FilterStats(); stats.Negatives != 0 || stats.FalsePositives != 0 {
+		t.Errorf("Expected the rebuilt blob filter to know the payload, got %+v", stats)
+	}
+}
@@ -0,0 +1,236 @@
+package artifact
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Retention bounds what a Store keeps. Logs are removed oldest first until
+// every limit holds; zero fields are unlimited.
+type Retention struct {
+	// MaxAge removes logs stored longer ago than this.
+	MaxAge time.Duration
+	// MaxLogs caps the number of logs, so the manifests directory holds
+	// at most this many files.
+	MaxLogs int64
+	// MaxBytes caps Stats.StoredBytes, the distinct blobs on disk. A blob
+	// is only freed once no remaining log refers to it.
+	MaxBytes int64
+}
+
+// Enabled reports whether r sets any limit.
+func (r Retention) Enabled() bool {
+	return r.MaxAge > 0 || r.MaxLogs > 0 || r.MaxBytes > 0
+}
+
+// PruneResult counts what Prune removed. Keys are the idempotency keys of
+// removed logs; ReclaimedBytes is the on-disk size of every removed file.
+type PruneResult struct {
+	Logs           int64 `json:"logs"`
+	Blobs          int64 `json:"blobs"`
+	Keys           int64 `json:"keys"`
+	ReclaimedBytes int64 `json:"reclaimed_bytes"`
+}
+
+func (r *PruneResult) add(d PruneResult) {
+	r.Logs += d.Logs
+	r.Blobs += d.Blobs
+	r.Keys += d.Keys
+	r.ReclaimedBytes += d.ReclaimedBytes
+}
+
+// RetentionStats totals the Prune runs of a store since it was opened.
+type RetentionStats struct {
+	Runs    int64       `json:"runs"`
+	Errors  int64       `json:"errors"`
+	LastRun time.Time   `json:"last_run"`
+	Pruned  PruneResult `json:"pruned"`
+}
+
+// storedLog is a manifest as Prune sees it, with its file size.
+type storedLog struct {
+	*manifest
+	size int64
+}
+
+// Prune removes the logs r no longer allows at now, with the blobs only
+// they referred to and their idempotency keys. Puts wait while it runs, so
+// a blob is never freed under a log being stored. The Bloom filters keep
+// removed hashes, which only costs a disk lookup if they come back.
+func (s *Store) Prune(r Retention, now time.Time) (PruneResult, error) {
+	s.pruneMu.Lock()
+	defer s.pruneMu.Unlock()
+
+	var result PruneResult
+	var removed Stats
+	err := s.prune(r, now, &result, &removed)
+
+	s.mu.Lock()
+	s.stats.Logs -= removed.Logs
+	s.stats.Artifacts -= removed.Artifacts
+	s.stats.LogicalBytes -= removed.LogicalBytes
+	s.stats.Blobs -= removed.Blobs
+	s.stats.StoredBytes -= removed.StoredBytes
+	// As in scan, dedup hits are the artifacts without a blob of their own.
+	if s.stats.DedupHits -= removed.Artifacts - removed.Blobs; s.stats.DedupHits < 0 {
+		s.stats.DedupHits = 0
+	}
+	s.filterStats.Keys -= result.Keys
+	s.retention.Runs++
+	s.retention.LastRun = now
+	s.retention.Pruned.add(result)
+	if err != nil {
+		s.retention.Errors++
+	}
+	s.mu.Unlock()
+	return result, err
+}
+
+// prune does the work of Prune, recording what it removed as it goes so a
+// failure part way still updates the totals.
+func (s *Store) prune(r Retention, now time.Time, result *PruneResult, removed *Stats) error {
+	if !r.Enabled() {
+		return nil
+	}
+	logs, err := s.storedLogs()
+	if err != nil {
+		return err
+	}
+	blobSizes := make(map[string]int64)
+	var stored int64
+	err = filepath.WalkDir(s.blobDir(), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !hashPattern.MatchString(d.Name()) {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		blobSizes[d.Name()] = info.Size()
+		stored += info.Size()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	refs := make(map[string]int)
+	for _, log := range logs {
+		for _, ptr := range log.Artifacts {
+			refs[ptr.Hash]++
+		}
+	}
+
+	pruned := make(map[string]bool)
+	remaining := int64(len(logs))
+	for _, log := range logs {
+		expired := r.MaxAge > 0 && now.Sub(log.StoredAt) > r.MaxAge
+		tooMany := r.MaxLogs > 0 && remaining > r.MaxLogs
+		tooBig := r.MaxBytes > 0 && stored > r.MaxBytes
+		if !expired && !tooMany && !tooBig {
+			// Later logs are younger, and the counts only shrink.
+			break
+		}
+		if err := os.Remove(s.manifestPath(log.ID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		pruned[log.ID] = true
+		remaining--
+		result.Logs++
+		result.ReclaimedBytes += log.size
+		removed.Logs++
+		for _, ptr := range log.Artifacts {
+			removed.Artifacts++
+			removed.LogicalBytes += ptr.Size
+			if refs[ptr.Hash]--; refs[ptr.Hash] > 0 {
+				continue
+			}
+			size, ok := blobSizes[ptr.Hash]
+			if !ok {
+				continue
+			}
+			if err := os.Remove(s.blobPath(ptr.Hash)); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+			delete(blobSizes, ptr.Hash)
+			stored -= size
+			result.Blobs++
+			result.ReclaimedBytes += size
+			removed.Blobs++
+			removed.StoredBytes += size
+		}
+	}
+	if len(pruned) == 0 {
+		return nil
+	}
+	return s.pruneKeys(pruned, result)
+}
+
+// storedLogs reads every manifest, oldest first.
+func (s *Store) storedLogs() ([]storedLog, error) {
+	entries, err := os.ReadDir(s.manifestDir())
+	if err != nil {
+		return nil, err
+	}
+	var logs []storedLog
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		m, err := s.readManifest(id)
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, storedLog{m, info.Size()})
+	}
+	sort.Slice(logs, func(i, j int) bool {
+		if !logs[i].StoredAt.Equal(logs[j].StoredAt) {
+			return logs[i].StoredAt.Before(logs[j].StoredAt)
+		}
+		return logs[i].ID < logs[j].ID
+	})
+	return logs, nil
+}
+
+// pruneKeys removes the idempotency keys claimed by pruned logs, so a
+// repeat of one is stored again instead of pointing at a removed log.
+func (s *Store) pruneKeys(pruned map[string]bool, result *PruneResult) error {
+	err := filepath.WalkDir(s.keyDir(), func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, os.ErrNotExist) && path == s.keyDir() {
+			return fs.SkipDir
+		}
+		if err != nil || d.IsDir() || !hashPattern.MatchString(d.Name()) {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if !pruned[strings.TrimSpace(string(data))] {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		result.Keys++
+		result.ReclaimedBytes += int64(len(data))
+		return nil
+	})
+	return err
+}
+
+// RetentionStats returns the totals of the store's Prune runs.
+func (s *Store) RetentionStats() RetentionStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.retention
+}
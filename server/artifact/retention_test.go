@@ -0,0 +1,111 @@
+package artifact
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// backdate moves the stored time of log id back by age.
+func backdate(t *testing.T, s *Store, id string, age time.Duration) {
+	t.Helper()
+	m, err := s.readManifest(id)
+	if err != nil {
+		t.Fatalf("Failed to read manifest: %v", err)
+	}
+	m.StoredAt = m.StoredAt.Add(-age)
+	data, _ := json.Marshal(m)
+	if err := os.WriteFile(s.manifestPath(id), data, 0644); err != nil {
+		t.Fatalf("Failed to write manifest: %v", err)
+	}
+}
+
+func TestPruneByAge(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	shared := []byte("shared payload")
+	for _, id := range []string{"old", "new"} {
+		if err := s.Put(id, map[string][]byte{
+			WrapperBinary: shared,
+			OriginalJSON:  []byte(`{"id":"` + id + `"}`),
+		}); err != nil {
+			t.Fatalf("Failed to put artifacts: %v", err)
+		}
+	}
+	if _, claimed, err := s.Claim("retry-1", "old"); err != nil || !claimed {
+		t.Fatalf("Failed to claim key: %v", err)
+	}
+	backdate(t, s, "old", 2*time.Hour)
+
+	result, err := s.Prune(Retention{MaxAge: time.Hour}, time.Now())
+	if err != nil {
+		t.Fatalf("Failed to prune: %v", err)
+	}
+	// The shared blob stays with the new log; only old's JSON is freed.
+	if result.Logs != 1 || result.Blobs != 1 || result.Keys != 1 || result.ReclaimedBytes == 0 {
+		t.Errorf("unexpected prune result %+v", result)
+	}
+	if _, _, err := s.Get("old", OriginalJSON); err != ErrNotFound {
+		t.Errorf("expected the old log to be gone, got %v", err)
+	}
+	if data, _, err := s.Get("new", WrapperBinary); err != nil || string(data) != string(shared) {
+		t.Errorf("expected the shared blob to survive: %q, %v", data, err)
+	}
+	if owner, claimed, err := s.Claim("retry-1", "again"); err != nil || !claimed || owner != "again" {
+		t.Errorf("expected the pruned log's key to be free, got %s %v %v", owner, claimed, err)
+	}
+
+	want := Stats{Logs: 1, Artifacts: 2, Blobs: 2, LogicalBytes: 26, StoredBytes: 26, DedupRatio: 1}
+	if got := s.Stats(); got != want {
+		t.Errorf("unexpected stats:\n got %+v\nwant %+v", got, want)
+	}
+	if stats := s.RetentionStats(); stats.Runs != 1 || stats.Pruned != result {
+		t.Errorf("unexpected retention stats %+v", stats)
+	}
+}
+
+func TestPruneByCountAndSize(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	ids := []string{"a", "b", "c", "d", "e"}
+	for i, id := range ids {
+		if err := s.Put(id, map[string][]byte{OriginalJSON: make([]byte, 100+i)}); err != nil {
+			t.Fatalf("Failed to put artifacts: %v", err)
+		}
+		backdate(t, s, id, time.Duration(len(ids)-i)*time.Minute)
+	}
+
+	if got, err := s.IDs(); err != nil || strings.Join(got, "") != "abcde" {
+		t.Fatalf("expected the IDs oldest first, got %v: %v", got, err)
+	}
+	if result, err := s.Prune(Retention{MaxLogs: 3}, time.Now()); err != nil || result.Logs != 2 {
+		t.Fatalf("expected 2 logs over the count limit to go, got %+v: %v", result, err)
+	}
+	for _, id := range ids[:2] {
+		if _, _, err := s.Get(id, OriginalJSON); err != ErrNotFound {
+			t.Errorf("expected the oldest log %s to be pruned, got %v", id, err)
+		}
+	}
+
+	// c, d and e hold 102+103+104 bytes; 250 keeps e and d.
+	result, err := s.Prune(Retention{MaxBytes: 250}, time.Now())
+	if err != nil || result.Logs != 1 || result.Blobs != 1 {
+		t.Fatalf("expected one log over the size limit to go, got %+v: %v", result, err)
+	}
+	if stats := s.Stats(); stats.Logs != 2 || stats.StoredBytes != 207 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	if result, err := s.Prune(Retention{MaxLogs: 2, MaxBytes: 1000}, time.Now()); err != nil || result != (PruneResult{}) {
+		t.Errorf("expected nothing to prune within the limits, got %+v: %v", result, err)
+	}
+	if result, err := s.Prune(Retention{}, time.Now()); err != nil || result != (PruneResult{}) {
+		t.Errorf("expected no limits to prune nothing, got %+v: %v", result, err)
+	}
+}
@@ -0,0 +1,411 @@
+// Package artifact stores the encodings produced for each logged request so
+// they can be downloaded later instead of being echoed inline. Payloads are
+// content-addressed, so identical encodings are kept once.
+package artifact
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/homveloper/exp-avro-json/server/seal"
+)
+
+// Formats of a stored log. The single formats are the binary ones in Avro
+// single-object encoding, which starts with the schema's fingerprint.
+const (
+	WrapperBinary = "wrapper-binary"
+	LogDataBinary = "logdata-binary"
+	WrapperSingle = "wrapper-single"
+	LogDataSingle = "logdata-single"
+	OriginalJSON  = "original-json"
+)
+
+// Formats lists every format in the order they are reported.
+var Formats = []string{WrapperBinary, LogDataBinary, WrapperSingle, LogDataSingle, OriginalJSON}
+
+var fileNames = map[string]string{
+	WrapperBinary: "wrapper.avro",
+	LogDataBinary: "logdata.avro",
+	WrapperSingle: "wrapper-single.avro",
+	LogDataSingle: "logdata-single.avro",
+	OriginalJSON:  "original.json",
+}
+
+var contentTypes = map[string]string{
+	WrapperBinary: "application/avro",
+	LogDataBinary: "application/avro",
+	WrapperSingle: "application/avro",
+	LogDataSingle: "application/avro",
+	OriginalJSON:  "application/json",
+}
+
+var (
+	// ErrNotFound is returned for unknown log IDs.
+	ErrNotFound = errors.New("artifact: log not found")
+	// ErrUnknownFormat is returned for formats not in Formats.
+	ErrUnknownFormat = errors.New("artifact: unknown format")
+)
+
+// idPattern keeps IDs safe to use as directory names.
+var idPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Store keeps artifacts content-addressed: each distinct payload is written
+// once to blobs/<aa>/<sha256>, and manifests/<id>.json maps a log's formats
+// to blob hashes. Identical payloads, common in synthetic load, therefore
+// share one file. It is safe for concurrent use; a log's manifest appears
+// atomically once all its blobs exist.
+type Store struct {
+	dir string
+	// key, when set, encrypts blobs and names them by keyed hash.
+	key *seal.Key
+
+	// pruneMu is held by Put for reading and by Prune for writing.
+	pruneMu sync.RWMutex
+
+	mu        sync.Mutex
+	stats     Stats
+	retention RetentionStats
+
+	blobFilter, keyFilter *filterSet
+	filterStats           FilterStats
+	filtersClean          bool   // the clean marker is on disk
+	filterGeneration      uint64 // bumped by every filter change
+}
+
+// Stats describes what the store holds. LogicalBytes counts every artifact
+// of every log, StoredBytes only the distinct blobs on disk; their
+// difference is what deduplication saved.
+type Stats struct {
+	Logs         int64   `json:"logs"`
+	Artifacts    int64   `json:"artifacts"`
+	Blobs        int64   `json:"blobs"`
+	DedupHits    int64   `json:"dedup_hits"`
+	LogicalBytes int64   `json:"logical_bytes"`
+	StoredBytes  int64   `json:"stored_bytes"`
+	SavedBytes   int64   `json:"saved_bytes"`
+	DedupRatio   float64 `json:"dedup_ratio"`
+}
+
+// manifest is the on-disk record of one log.
+type manifest struct {
+	ID        string                 `json:"id"`
+	StoredAt  time.Time              `json:"stored_at"`
+	Artifacts map[string]blobPointer `json:"artifacts"`
+}
+
+type blobPointer struct {
+	Hash string `json:"sha256"`
+	Size int64  `json:"size"`
+}
+
+// Open creates dir if needed and returns a store rooted there. Existing
+// manifests and blobs are scanned to seed Stats, and the Bloom filters are
+// loaded, or rebuilt if they were not flushed.
+func Open(dir string) (*Store, error) {
+	return OpenSealed(dir, nil)
+}
+
+// OpenSealed is Open for a store whose blobs are encrypted with key, so
+// only manifests, which hold IDs, times and sizes, are readable without
+// it. Blobs are named by an HMAC of their content under key instead of
+// its SHA-256, so the names give nothing away either. A nil key is Open.
+func OpenSealed(dir string, key *seal.Key) (*Store, error) {
+	s := &Store{dir: dir, key: key}
+	for _, sub := range []string{s.blobDir(), s.manifestDir()} {
+		if err := os.MkdirAll(sub, 0755); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.openFilters(); err != nil {
+		return nil, err
+	}
+	if err := s.scan(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Dir returns the store's root directory.
+func (s *Store) Dir() string { return s.dir }
+
+func (s *Store) blobDir() string     { return filepath.Join(s.dir, "blobs") }
+func (s *Store) manifestDir() string { return filepath.Join(s.dir, "manifests") }
+
+func (s *Store) blobPath(hash string) string {
+	return filepath.Join(s.blobDir(), hash[:2], hash)
+}
+
+func (s *Store) manifestPath(id string) string {
+	return filepath.Join(s.manifestDir(), id+".json")
+}
+
+// Put stores the artifacts of log id, keyed by format.
+func (s *Store) Put(id string, artifacts map[string][]byte) error {
+	if !idPattern.MatchString(id) {
+		return fmt.Errorf("artifact: invalid log id %q", id)
+	}
+	for format := range artifacts {
+		if _, ok := fileNames[format]; !ok {
+			return fmt.Errorf("%w %q", ErrUnknownFormat, format)
+		}
+	}
+	s.pruneMu.RLock()
+	defer s.pruneMu.RUnlock()
+	if _, err := os.Stat(s.manifestPath(id)); err == nil {
+		return fmt.Errorf("artifact: log %s already stored", id)
+	}
+
+	m := manifest{ID: id, StoredAt: time.Now().UTC(), Artifacts: make(map[string]blobPointer, len(artifacts))}
+	var delta Stats
+	for format, data := range artifacts {
+		hash := s.hashOf(data)
+		created, err := s.putBlob(hash, data)
+		if err != nil {
+			return err
+		}
+		size := int64(len(data))
+		m.Artifacts[format] = blobPointer{Hash: hash, Size: size}
+		delta.Artifacts++
+		delta.LogicalBytes += size
+		if created {
+			delta.Blobs++
+			delta.StoredBytes += size
+		} else {
+			delta.DedupHits++
+		}
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	created, err := writeOnce(s.manifestPath(id), data)
+	if err != nil {
+		return err
+	}
+	if !created {
+		return fmt.Errorf("artifact: log %s already stored", id)
+	}
+	delta.Logs = 1
+
+	s.mu.Lock()
+	s.stats.add(delta)
+	s.mu.Unlock()
+	return nil
+}
+
+// putBlob writes data under hash unless an identical blob exists, reporting
+// whether it created the file.
+func (s *Store) putBlob(hash string, data []byte) (bool, error) {
+	path := s.blobPath(hash)
+	maybe := s.mayContain(s.blobFilter, hash)
+	if maybe {
+		if _, err := os.Stat(path); err == nil {
+			return false, nil
+		}
+	}
+	if err := s.admit(s.blobFilter, hash, maybe); err != nil {
+		return false, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return false, err
+	}
+	if s.key != nil {
+		data = s.key.Seal(data)
+	}
+	return writeOnce(path, data)
+}
+
+// writeOnce atomically creates path with data. It reports false without an
+// error when path already exists, which for blobs means a concurrent Put
+// stored the same content first.
+func writeOnce(path string, data []byte) (bool, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".put-")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return false, err
+	}
+	if err := tmp.Close(); err != nil {
+		return false, err
+	}
+	// A hard link, unlike rename, never replaces an existing file.
+	if err := os.Link(tmp.Name(), path); err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// Get returns one artifact of log id and when it was stored.
+func (s *Store) Get(id, format string) ([]byte, time.Time, error) {
+	if _, ok := fileNames[format]; !ok {
+		return nil, time.Time{}, fmt.Errorf("%w %q", ErrUnknownFormat, format)
+	}
+	m, err := s.readManifest(id)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	ptr, ok := m.Artifacts[format]
+	if !ok {
+		return nil, time.Time{}, ErrNotFound
+	}
+	data, err := os.ReadFile(s.blobPath(ptr.Hash))
+	if err == nil && s.key != nil {
+		data, err = s.key.Open(data)
+	}
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("artifact: blob %s of log %s: %w", ptr.Hash, id, err)
+	}
+	return data, m.StoredAt, nil
+}
+
+// IDs returns the IDs of the stored logs, oldest first.
+func (s *Store) IDs() ([]string, error) {
+	logs, err := s.storedLogs()
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(logs))
+	for i, log := range logs {
+		ids[i] = log.ID
+	}
+	return ids, nil
+}
+
+func (s *Store) readManifest(id string) (*manifest, error) {
+	if !idPattern.MatchString(id) {
+		return nil, ErrNotFound
+	}
+	data, err := os.ReadFile(s.manifestPath(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("artifact: manifest of log %s: %w", id, err)
+	}
+	for _, ptr := range m.Artifacts {
+		if !hashPattern.MatchString(ptr.Hash) {
+			return nil, fmt.Errorf("artifact: manifest of log %s has invalid hash %q", id, ptr.Hash)
+		}
+	}
+	return &m, nil
+}
+
+// Stats returns the store's current totals.
+func (s *Store) Stats() Stats {
+	s.mu.Lock()
+	stats := s.stats
+	s.mu.Unlock()
+	stats.SavedBytes = stats.LogicalBytes - stats.StoredBytes
+	if stats.StoredBytes > 0 {
+		stats.DedupRatio = float64(stats.LogicalBytes) / float64(stats.StoredBytes)
+	}
+	return stats
+}
+
+func (s *Stats) add(d Stats) {
+	s.Logs += d.Logs
+	s.Artifacts += d.Artifacts
+	s.Blobs += d.Blobs
+	s.DedupHits += d.DedupHits
+	s.LogicalBytes += d.LogicalBytes
+	s.StoredBytes += d.StoredBytes
+}
+
+// scan rebuilds the totals from disk. Dedup hits from before the process
+// started are inferred as artifacts that did not need a blob of their own.
+func (s *Store) scan() error {
+	var stats Stats
+	manifests, err := os.ReadDir(s.manifestDir())
+	if err != nil {
+		return err
+	}
+	for _, entry := range manifests {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		m, err := s.readManifest(id)
+		if err != nil {
+			return err
+		}
+		stats.Logs++
+		for _, ptr := range m.Artifacts {
+			stats.Artifacts++
+			stats.LogicalBytes += ptr.Size
+		}
+	}
+	err = filepath.WalkDir(s.blobDir(), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !hashPattern.MatchString(d.Name()) {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		stats.Blobs++
+		stats.StoredBytes += info.Size()
+		if !s.filtersClean {
+			s.blobFilter.add(d.Name())
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	stats.DedupHits = stats.Artifacts - stats.Blobs
+	if stats.DedupHits < 0 {
+		stats.DedupHits = 0
+	}
+	s.stats = stats
+	return nil
+}
+
+var hashPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+func (s *Store) hashOf(data []byte) string {
+	if s.key != nil {
+		return hex.EncodeToString(s.key.Hash(data))
+	}
+	return hashOf(data)
+}
+
+func hashOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// ContentType returns the media type served for format.
+func ContentType(format string) string {
+	return contentTypes[format]
+}
+
+// FileName returns the download file name of one artifact.
+func FileName(id, format string) string {
+	return id + "-" + fileNames[format]
+}
+
+// ETag returns a strong entity tag for data.
+func ETag(data []byte) string {
+	return `"` + hashOf(data)[:32] + `"`
+}
@@ -0,0 +1,134 @@
+package artifact
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/homveloper/exp-avro-json/server/seal"
+)
+
+func TestStorePutGet(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	if err := s.Put("abc123", map[string][]byte{
+		WrapperBinary: {0x02, 0x04},
+		OriginalJSON:  []byte(`{"a":1}`),
+	}); err != nil {
+		t.Fatalf("Failed to put artifacts: %v", err)
+	}
+
+	data, stored, err := s.Get("abc123", OriginalJSON)
+	if err != nil || string(data) != `{"a":1}` || stored.IsZero() {
+		t.Errorf("unexpected artifact %q at %v: %v", data, stored, err)
+	}
+	if _, _, err := s.Get("abc123", LogDataBinary); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a format that was not stored, got %v", err)
+	}
+	if _, _, err := s.Get("abc123", "xml"); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("expected ErrUnknownFormat, got %v", err)
+	}
+	if _, _, err := s.Get("../abc123", OriginalJSON); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected path traversal to be rejected, got %v", err)
+	}
+
+	entries, _ := os.ReadDir(s.Dir())
+	if len(entries) != 2 {
+		t.Errorf("expected only the blobs and manifests directories, found %d entries", len(entries))
+	}
+}
+
+func TestStoreDeduplicatesContent(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	payload := []byte("same payload")
+	for _, id := range []string{"one", "two"} {
+		if err := s.Put(id, map[string][]byte{
+			WrapperBinary: payload,
+			OriginalJSON:  []byte(`{"id":"` + id + `"}`),
+		}); err != nil {
+			t.Fatalf("Failed to put artifacts: %v", err)
+		}
+	}
+	if err := s.Put("one", map[string][]byte{OriginalJSON: nil}); err == nil {
+		t.Error("expected an existing log id to be rejected")
+	}
+
+	want := Stats{Logs: 2, Artifacts: 4, Blobs: 3, DedupHits: 1, LogicalBytes: 48, StoredBytes: 36, SavedBytes: 12, DedupRatio: 48.0 / 36}
+	if got := s.Stats(); got != want {
+		t.Errorf("unexpected stats:\n got %+v\nwant %+v", got, want)
+	}
+	for _, id := range []string{"one", "two"} {
+		if data, _, err := s.Get(id, WrapperBinary); err != nil || string(data) != string(payload) {
+			t.Errorf("unexpected artifact %q of %s: %v", data, id, err)
+		}
+	}
+
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	if got := reopened.Stats(); got != want {
+		t.Errorf("unexpected stats after reopening:\n got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestStoreRejectsInvalidInput(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	if err := s.Put("a/b", map[string][]byte{OriginalJSON: nil}); err == nil {
+		t.Error("expected an invalid id to be rejected")
+	}
+	if err := s.Put("ok", map[string][]byte{"xml": nil}); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("expected ErrUnknownFormat, got %v", err)
+	}
+	if err := s.Put("ok", map[string][]byte{OriginalJSON: nil}); err != nil {
+		t.Errorf("Failed to put after a rejected put: %v", err)
+	}
+}
+
+func TestETagIsStable(t *testing.T) {
+	if ETag([]byte("x")) != ETag([]byte("x")) || ETag([]byte("x")) == ETag([]byte("y")) {
+		t.Error("ETag must depend only on the content")
+	}
+}
+
+func TestSealedStore(t *testing.T) {
+	key, _ := seal.NewKey(bytes.Repeat([]byte{7}, seal.KeySize))
+	dir := t.TempDir()
+	s, err := OpenSealed(dir, key)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	payload := []byte(`{"issuer":"alice"}`)
+	if err := s.Put("abc123", map[string][]byte{OriginalJSON: payload}); err != nil {
+		t.Fatalf("Failed to put artifacts: %v", err)
+	}
+	if data, _, err := s.Get("abc123", OriginalJSON); err != nil || !bytes.Equal(data, payload) {
+		t.Errorf("unexpected artifact %q: %v", data, err)
+	}
+	blob, err := os.ReadFile(s.blobPath(s.hashOf(payload)))
+	if err != nil || bytes.Contains(blob, []byte("alice")) {
+		t.Errorf("expected an encrypted blob named by keyed hash: %v", err)
+	}
+	if _, err := os.Stat(s.blobPath(hashOf(payload))); err == nil {
+		t.Error("expected the blob name not to be the plain SHA-256")
+	}
+
+	other, _ := seal.NewKey(bytes.Repeat([]byte{8}, seal.KeySize))
+	reopened, err := OpenSealed(dir, other)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	if _, _, err := reopened.Get("abc123", OriginalJSON); err == nil {
+		t.Error("expected another key to fail to read the blob")
+	}
+}
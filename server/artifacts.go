@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/homveloper/exp-avro-json/server/artifact"
+	"github.com/homveloper/exp-avro-json/server/ids"
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+	"go.uber.org/zap"
+)
+
+// artifactStore keeps every logged request's encodings for download. It is
+// nil when -artifact-dir is empty, in which case /log returns no links.
+var artifactStore *artifact.Store
+
+func openArtifactStore(dir string) error {
+	if dir == "" {
+		return nil
+	}
+	if tenants != nil {
+		// Each tenant's store is opened below dir on first use.
+		tenantArtifactDir = dir
+		return os.MkdirAll(dir, 0755)
+	}
+	store, err := artifact.Open(dir)
+	if err != nil {
+		return err
+	}
+	artifactStore = store
+	return nil
+}
+
+// logIDs names logs, imports and OCF files. -id-kind and -id-node select
+// the generator; every kind sorts by creation time.
+var logIDs ids.Generator = ids.NewULID()
+
+// idempotencyHeader carries a client-chosen key for a log. A repeated key
+// is answered with the first log's ID instead of storing the log again.
+const idempotencyHeader = "Idempotency-Key"
+
+// storeLogArtifacts saves the encodings of log id in store and returns the
+// download link of each format.
+func storeLogArtifacts(store *artifact.Store, id string, encoded *avrojson.EncodedLog, originalJSON []byte) (gin.H, error) {
+	wrapperSingle, logDataSingle, err := encoded.SingleObjects()
+	if err != nil {
+		return nil, err
+	}
+	err = store.Put(id, map[string][]byte{
+		artifact.WrapperBinary: encoded.Wrapper,
+		artifact.LogDataBinary: encoded.LogData,
+		artifact.WrapperSingle: wrapperSingle,
+		artifact.LogDataSingle: logDataSingle,
+		artifact.OriginalJSON:  originalJSON,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return artifactLinks(id), nil
+}
+
+func artifactLinks(id string) gin.H {
+	links := gin.H{}
+	for _, format := range artifact.Formats {
+		links[format] = "/logs/" + id + "/artifact?format=" + format
+	}
+	return links
+}
+
+// claimIdempotencyKey claims the request's idempotency key, if any, for
+// log id in store. When the key was used before it answers the request
+// with the earlier log and returns false.
+func claimIdempotencyKey(c *gin.Context, store *artifact.Store, id string) (key string, ok bool) {
+	key = c.GetHeader(idempotencyHeader)
+	if key == "" || store == nil {
+		return "", true
+	}
+	owner, claimed, err := store.Claim(key, id)
+	if err != nil {
+		requestLogger(c).Error("Failed to claim idempotency key", zap.Error(err))
+		respondError(c, http.StatusInternalServerError, codeStorageFailed, "Failed to check idempotency key")
+		return "", false
+	}
+	if !claimed {
+		requestLogger(c).Info("Skipped repeated log", zap.String("id", owner))
+		c.Header("X-Log-ID", owner)
+		c.Header("Idempotent-Replayed", "true")
+		c.JSON(http.StatusOK, gin.H{"status": "duplicate", "id": owner, "artifacts": artifactLinks(owner)})
+		return "", false
+	}
+	return key, true
+}
+
+// releaseIdempotencyKey frees a key claimed for a log that was then
+// rejected or failed to store, so the client can retry with it.
+func releaseIdempotencyKey(store *artifact.Store, key, id string) {
+	if key == "" {
+		return
+	}
+	if err := store.Release(key, id); err != nil {
+		logger.Warn("Failed to release idempotency key", zap.Error(err))
+	}
+}
+
+// flushArtifactFilters persists the artifact stores' Bloom filters every
+// interval, so a restart loads them instead of rebuilding.
+func flushArtifactFilters(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, store := range openArtifactStores() {
+				if err := store.FlushFilters(); err != nil {
+					logger.Warn("Failed to flush artifact Bloom filters", zap.String("dir", store.Dir()), zap.Error(err))
+				}
+			}
+		}
+	}
+}
+
+// artifactRetention bounds every artifact store, the tenants' as well, by
+// age, log count and stored bytes (-artifact-max-*). It is applied by the
+// artifact-retention leader job, so instances sharing a directory prune it
+// once.
+var artifactRetention artifact.Retention
+
+// scheduleArtifactRetention registers the retention job when retention has
+// limits and artifacts are stored.
+func scheduleArtifactRetention(retention artifact.Retention, interval time.Duration) {
+	if !retention.Enabled() || (artifactStore == nil && tenantArtifactDir == "") {
+		return
+	}
+	artifactRetention = retention
+	registerLeaderJob("artifact-retention", interval, pruneArtifacts)
+}
+
+// pruneArtifacts applies artifactRetention to every artifact store,
+// opening the stores of tenants that have not logged since startup.
+func pruneArtifacts(ctx context.Context) error {
+	stores := []*artifact.Store{artifactStore}
+	var errs []error
+	if tenants != nil {
+		stores = nil
+		for _, t := range tenants {
+			store, err := t.artifactStore()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("tenant %s: %w", t.project, err))
+				continue
+			}
+			stores = append(stores, store)
+		}
+	}
+	for _, store := range stores {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		result, err := store.Prune(artifactRetention, time.Now())
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", store.Dir(), err))
+		}
+		if result.Logs > 0 {
+			logger.Info("Pruned log artifacts",
+				zap.String("dir", store.Dir()),
+				zap.Int64("logs", result.Logs),
+				zap.Int64("blobs", result.Blobs),
+				zap.Int64("keys", result.Keys),
+				zap.Int64("reclaimed_bytes", result.ReclaimedBytes))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// artifactHandler serves GET /logs/:id/artifact?format=..., with ETag and
+// conditional and range request support.
+func artifactHandler(c *gin.Context) {
+	store, err := requestArtifacts(c)
+	if err != nil {
+		requestLogger(c).Error("Failed to open tenant artifact store", zap.Error(err))
+		respondError(c, http.StatusInternalServerError, codeStorageFailed, "Failed to open artifact storage")
+		return
+	}
+	if store == nil {
+		respondError(c, http.StatusNotFound, codeNotFound, "artifact storage is disabled")
+		return
+	}
+	id, format := c.Param("id"), c.DefaultQuery("format", artifact.WrapperBinary)
+	data, stored, err := store.Get(id, format)
+	switch {
+	case errors.Is(err, artifact.ErrUnknownFormat):
+		respondErrorWith(c, http.StatusBadRequest, apiError{Code: codeInvalidRequest, Message: err.Error(), Field: "format"}, gin.H{"formats": artifact.Formats})
+		return
+	case errors.Is(err, artifact.ErrNotFound):
+		respondError(c, http.StatusNotFound, codeNotFound, err.Error())
+		return
+	case err != nil:
+		requestLogger(c).Error("Failed to read log artifact", zap.String("id", id), zap.String("format", format), zap.Error(err))
+		respondError(c, http.StatusInternalServerError, codeStorageFailed, "Failed to read log artifact")
+		return
+	}
+
+	c.Header("Content-Type", artifact.ContentType(format))
+	c.Header("ETag", artifact.ETag(data))
+	if created, err := logIDs.Time(id); err == nil {
+		// IDs from another generator kind, or from before IDs carried a
+		// time, have no creation time to report.
+		c.Header("X-Log-Time", created.Format(time.RFC3339Nano))
+	}
+	c.Header("Content-Disposition", `attachment; filename="`+artifact.FileName(id, format)+`"`)
+	http.ServeContent(c.Writer, c.Request, "", stored, bytes.NewReader(data))
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/homveloper/exp-avro-json/server/artifact"
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+	"go.uber.org/zap"
+)
+
+func TestLogArtifactDownloads(t *testing.T) {
+	logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	if err := openArtifactStore(t.TempDir()); err != nil {
+		t.Fatalf("Failed to open artifact store: %v", err)
+	}
+	defer func() { artifactStore = nil }()
+
+	r := gin.New()
+	r.POST("/log", logHandler)
+	r.GET("/logs/:id/artifact", artifactHandler)
+
+	body, _ := json.Marshal(warmupPayload(1))
+	req := httptest.NewRequest(http.MethodPost, "/log", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var logged struct {
+		ID        string            `json:"id"`
+		Artifacts map[string]string `json:"artifacts"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &logged); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if logged.ID == "" || len(logged.Artifacts) != len(artifact.Formats) {
+		t.Fatalf("expected an id and a link per format: %s", w.Body.String())
+	}
+	if w.Header().Get("X-Log-ID") != logged.ID {
+		t.Errorf("X-Log-ID %q does not match id %q", w.Header().Get("X-Log-ID"), logged.ID)
+	}
+
+	get := func(target, etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w = get(logged.Artifacts[artifact.WrapperBinary], "")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != avroContentType || w.Header().Get("ETag") == "" {
+		t.Fatalf("unexpected wrapper download: %d %v", w.Code, w.Header())
+	}
+	if created, err := time.Parse(time.RFC3339Nano, w.Header().Get("X-Log-Time")); err != nil || time.Since(created) > time.Minute {
+		t.Errorf("unexpected X-Log-Time %q: %v", w.Header().Get("X-Log-Time"), err)
+	}
+	wrapper, data, err := avrojson.DecodeLog(w.Body.Bytes())
+	if err != nil || wrapper.LogType != "warmup" || data.Issuer != "warmup" {
+		t.Errorf("downloaded wrapper does not decode: %+v %+v %v", wrapper, data, err)
+	}
+	if w := get(logged.Artifacts[artifact.WrapperBinary], w.Header().Get("ETag")); w.Code != http.StatusNotModified {
+		t.Errorf("Expected 304 for a matching ETag, got %d", w.Code)
+	}
+
+	wrapperBinary := w.Body.Bytes()
+	w = get(logged.Artifacts[artifact.WrapperSingle], "")
+	if fingerprint, rest, err := avrojson.SingleObjectFingerprint(w.Body.Bytes()); err != nil || !bytes.Equal(rest, wrapperBinary) {
+		t.Errorf("expected the wrapper in single-object encoding, got %x: %v", fingerprint, err)
+	}
+
+	w = get(logged.Artifacts[artifact.OriginalJSON], "")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/json" || w.Body.String() != string(body) {
+		t.Errorf("unexpected original JSON download: %d %s", w.Code, w.Body.String())
+	}
+
+	if w := get("/logs/"+logged.ID+"/artifact?format=xml", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown format, got %d", w.Code)
+	}
+	if w := get("/logs/missing/artifact", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown log, got %d", w.Code)
+	}
+}
+
+func TestIdempotencyKeySkipsRepeatedLogs(t *testing.T) {
+	logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	if err := openArtifactStore(t.TempDir()); err != nil {
+		t.Fatalf("Failed to open artifact store: %v", err)
+	}
+	defer func() { artifactStore = nil }()
+
+	r := gin.New()
+	r.POST("/log", logHandler)
+
+	post := func(key, issuer string) (*httptest.ResponseRecorder, map[string]interface{}) {
+		payload := warmupPayload(1)
+		payload.LogBody.Issuer = issuer
+		body, _ := json.Marshal(payload)
+		req := httptest.NewRequest(http.MethodPost, "/log", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(idempotencyHeader, key)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var resp map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w, resp
+	}
+
+	w, first := post("event-1", "a")
+	if w.Code != http.StatusOK || first["status"] != "logged" {
+		t.Fatalf("unexpected first response %d: %s", w.Code, w.Body.String())
+	}
+	w, repeat := post("event-1", "b")
+	if w.Code != http.StatusOK || repeat["status"] != "duplicate" || repeat["id"] != first["id"] || w.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("Expected the repeat to point at %v, got %d: %s", first["id"], w.Code, w.Body.String())
+	}
+	if _, other := post("event-2", "b"); other["status"] != "logged" || other["id"] == first["id"] {
+		t.Errorf("Expected a new key to be logged: %v", other)
+	}
+	if stats := artifactStore.Stats(); stats.Logs != 2 {
+		t.Errorf("Expected 2 stored logs, got %+v", stats)
+	}
+}
+
+func TestPruneArtifacts(t *testing.T) {
+	logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	if err := openArtifactStore(t.TempDir()); err != nil {
+		t.Fatalf("Failed to open artifact store: %v", err)
+	}
+	artifactRetention = artifact.Retention{MaxLogs: 2}
+	defer func() { artifactStore, artifactRetention = nil, artifact.Retention{} }()
+
+	r := gin.New()
+	r.POST("/log", logHandler)
+	for i := 0; i < 5; i++ {
+		body, _ := json.Marshal(warmupPayload(i))
+		req := httptest.NewRequest(http.MethodPost, "/log", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+
+	if err := pruneArtifacts(context.Background()); err != nil {
+		t.Fatalf("Failed to prune artifacts: %v", err)
+	}
+	if stats := artifactStore.Stats(); stats.Logs != 2 {
+		t.Errorf("expected 2 logs to be kept, got %+v", stats)
+	}
+	if retention := artifactStore.RetentionStats(); retention.Runs != 1 || retention.Pruned.Logs != 3 || retention.Pruned.ReclaimedBytes == 0 {
+		t.Errorf("unexpected retention stats %+v", retention)
+	}
+}
@@ -0,0 +1,144 @@
+// 디코딩 벤치마크 실행 방법:
+// 1. 모든 디코딩 벤치마크 실행: go test -run=^$ -bench=Decode -benchmem
+// 2. 병렬 벤치마크만 실행: go test -run=^$ -bench=Parallel -benchmem -cpu=1,4,8
+// 3. 풀 사용 여부 비교: go test -run=^$ -bench='BinaryToJSON' -benchmem
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+)
+
+// decodeInputs encodes 20 characters once in every form the decode
+// benchmarks read.
+func decodeInputs(b *testing.B) (codec *avrojson.Codec, binary, avroJSON, plainJSON []byte) {
+	data := generateDummyCharacters(20)
+	codec, err := avrojson.NewCodec(userCharacterSchema)
+	if err != nil {
+		b.Fatalf("Failed to compile schema: %v", err)
+	}
+	if binary, err = codec.Encode(data); err != nil {
+		b.Fatalf("Failed to encode: %v", err)
+	}
+	if avroJSON, err = codec.BinaryToJSON(binary); err != nil {
+		b.Fatalf("Failed to convert to JSON: %v", err)
+	}
+	if plainJSON, err = json.Marshal(data); err != nil {
+		b.Fatalf("Failed to marshal: %v", err)
+	}
+	return codec, binary, avroJSON, plainJSON
+}
+
+// 표준 JSON 역직렬화 성능 측정 (20개 캐릭터)
+// 실행: go test -run=^$ -bench=BenchmarkStandardJSONDecode20Characters -benchmem
+func BenchmarkStandardJSONDecode20Characters(b *testing.B) {
+	_, _, _, plainJSON := decodeInputs(b)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var out UserCharacterStorage
+		_ = json.Unmarshal(plainJSON, &out)
+	}
+}
+
+// Avro Binary 역직렬화 성능 측정 (20개 캐릭터) - NativeFromBinary
+// 실행: go test -run=^$ -bench=BenchmarkAvroBinaryDecode20Characters -benchmem
+func BenchmarkAvroBinaryDecode20Characters(b *testing.B) {
+	codec, binary, _, _ := decodeInputs(b)
+	goavroCodec := codec.Goavro()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		native, _, _ := goavroCodec.NativeFromBinary(binary)
+		_ = native
+	}
+}
+
+// Avro JSON 역직렬화 성능 측정 (20개 캐릭터) - NativeFromTextual
+// 실행: go test -run=^$ -bench=BenchmarkAvroJSONDecode20Characters -benchmem
+func BenchmarkAvroJSONDecode20Characters(b *testing.B) {
+	codec, _, avroJSON, _ := decodeInputs(b)
+	goavroCodec := codec.Goavro()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		native, _, _ := goavroCodec.NativeFromTextual(avroJSON)
+		_ = native
+	}
+}
+
+// Avro Binary를 구조체로 역직렬화 성능 측정 (20개 캐릭터) - Codec.Decode
+// 실행: go test -run=^$ -bench=BenchmarkAvroStructDecode20Characters -benchmem
+func BenchmarkAvroStructDecode20Characters(b *testing.B) {
+	codec, binary, _, _ := decodeInputs(b)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var out UserCharacterStorage
+		_ = codec.Decode(binary, &out)
+	}
+}
+
+// 병렬 Avro Binary 역직렬화 성능 측정 (20개 캐릭터) - 코덱 공유
+// 실행: go test -run=^$ -bench=BenchmarkParallelAvroBinaryDecode20Characters -benchmem -cpu=1,4,8
+func BenchmarkParallelAvroBinaryDecode20Characters(b *testing.B) {
+	codec, binary, _, _ := decodeInputs(b)
+	goavroCodec := codec.Goavro()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			native, _, _ := goavroCodec.NativeFromBinary(binary)
+			_ = native
+		}
+	})
+}
+
+// 병렬 Avro JSON 역직렬화 성능 측정 (20개 캐릭터) - 코덱 공유
+// 실행: go test -run=^$ -bench=BenchmarkParallelAvroJSONDecode20Characters -benchmem -cpu=1,4,8
+func BenchmarkParallelAvroJSONDecode20Characters(b *testing.B) {
+	codec, _, avroJSON, _ := decodeInputs(b)
+	goavroCodec := codec.Goavro()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			native, _, _ := goavroCodec.NativeFromTextual(avroJSON)
+			_ = native
+		}
+	})
+}
+
+// Binary → Avro JSON 변환 성능 측정 (20개 캐릭터) - 매번 버퍼 할당
+// 실행: go test -run=^$ -bench=BenchmarkParallelBinaryToJSON20Characters -benchmem -cpu=1,4,8
+func BenchmarkParallelBinaryToJSON20Characters(b *testing.B) {
+	codec, binary, _, _ := decodeInputs(b)
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			text, _ := codec.BinaryToJSON(binary)
+			_ = text
+		}
+	})
+}
+
+// Binary → Avro JSON 변환 성능 측정 (20개 캐릭터) - DecoderPool로 버퍼 재사용
+// 실행: go test -run=^$ -bench=BenchmarkParallelPooledBinaryToJSON20Characters -benchmem -cpu=1,4,8
+func BenchmarkParallelPooledBinaryToJSON20Characters(b *testing.B) {
+	codec, binary, _, _ := decodeInputs(b)
+	pool := codec.Decoders()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			dec := pool.Get()
+			text, _ := dec.JSON(binary)
+			_ = text
+			pool.Put(dec)
+		}
+	})
+}
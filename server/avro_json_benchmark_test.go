@@ -11,259 +11,9 @@ import (
 	"encoding/json"
 	"testing"
 
-	"github.com/brianvoe/gofakeit/v6"
 	"github.com/linkedin/goavro/v2"
 )
 
-type UserCharacterStorage struct {
-	UserID     string      `json:"user_id"`
-	Characters []Character `json:"characters"`
-}
-
-type Character struct {
-	ID         string    `json:"id"`
-	Name       string    `json:"name"`
-	Level      int       `json:"level"`
-	Experience int       `json:"experience"`
-	Stats      Stats     `json:"stats"`
-	Inventory  []Item    `json:"inventory"`
-	Skills     []Skill   `json:"skills"`
-	Equipment  Equipment `json:"equipment"`
-	Quests     []Quest   `json:"quests"`
-	Metadata   Metadata  `json:"metadata"`
-}
-
-type Stats struct {
-	Health   int `json:"health"`
-	Mana     int `json:"mana"`
-	Strength int `json:"strength"`
-	Defense  int `json:"defense"`
-	Agility  int `json:"agility"`
-	Magic    int `json:"magic"`
-}
-
-type Item struct {
-	ID       string `json:"id"`
-	Name     string `json:"name"`
-	Type     string `json:"type"`
-	Quantity int    `json:"quantity"`
-	Rarity   string `json:"rarity"`
-}
-
-type Skill struct {
-	ID       string `json:"id"`
-	Name     string `json:"name"`
-	Level    int    `json:"level"`
-	Cooldown int    `json:"cooldown"`
-}
-
-type Equipment struct {
-	Weapon    string `json:"weapon"`
-	Armor     string `json:"armor"`
-	Accessory string `json:"accessory"`
-}
-
-type Quest struct {
-	ID       string `json:"id"`
-	Name     string `json:"name"`
-	Progress int    `json:"progress"`
-	Status   string `json:"status"`
-}
-
-type Metadata struct {
-	CreatedAt    string `json:"created_at"`
-	LastModified string `json:"last_modified"`
-	PlayTime     int    `json:"play_time"`
-}
-
-const userCharacterSchema = `{
-	"type": "record",
-	"name": "UserCharacterStorage",
-	"fields": [
-		{"name": "user_id", "type": "string"},
-		{
-			"name": "characters",
-			"type": {
-				"type": "array",
-				"items": {
-					"type": "record",
-					"name": "Character",
-					"fields": [
-						{"name": "id", "type": "string"},
-						{"name": "name", "type": "string"},
-						{"name": "level", "type": "int"},
-						{"name": "experience", "type": "int"},
-						{
-							"name": "stats",
-							"type": {
-								"type": "record",
-								"name": "Stats",
-								"fields": [
-									{"name": "health", "type": "int"},
-									{"name": "mana", "type": "int"},
-									{"name": "strength", "type": "int"},
-									{"name": "defense", "type": "int"},
-									{"name": "agility", "type": "int"},
-									{"name": "magic", "type": "int"}
-								]
-							}
-						},
-						{
-							"name": "inventory",
-							"type": {
-								"type": "array",
-								"items": {
-									"type": "record",
-									"name": "Item",
-									"fields": [
-										{"name": "id", "type": "string"},
-										{"name": "name", "type": "string"},
-										{"name": "type", "type": "string"},
-										{"name": "quantity", "type": "int"},
-										{"name": "rarity", "type": "string"}
-									]
-								}
-							}
-						},
-						{
-							"name": "skills",
-							"type": {
-								"type": "array",
-								"items": {
-									"type": "record",
-									"name": "Skill",
-									"fields": [
-										{"name": "id", "type": "string"},
-										{"name": "name", "type": "string"},
-										{"name": "level", "type": "int"},
-										{"name": "cooldown", "type": "int"}
-									]
-								}
-							}
-						},
-						{
-							"name": "equipment",
-							"type": {
-								"type": "record",
-								"name": "Equipment",
-								"fields": [
-									{"name": "weapon", "type": "string"},
-									{"name": "armor", "type": "string"},
-									{"name": "accessory", "type": "string"}
-								]
-							}
-						},
-						{
-							"name": "quests",
-							"type": {
-								"type": "array",
-								"items": {
-									"type": "record",
-									"name": "Quest",
-									"fields": [
-										{"name": "id", "type": "string"},
-										{"name": "name", "type": "string"},
-										{"name": "progress", "type": "int"},
-										{"name": "status", "type": "string"}
-									]
-								}
-							}
-						},
-						{
-							"name": "metadata",
-							"type": {
-								"type": "record",
-								"name": "Metadata",
-								"fields": [
-									{"name": "created_at", "type": "string"},
-									{"name": "last_modified", "type": "string"},
-									{"name": "play_time", "type": "int"}
-								]
-							}
-						}
-					]
-				}
-			}
-		}
-	]
-}`
-
-// gofakeit을 사용하여 더미 캐릭터 데이터 생성
-func generateDummyCharacters(count int) UserCharacterStorage {
-	storage := UserCharacterStorage{
-		UserID:     gofakeit.UUID(),
-		Characters: make([]Character, count),
-	}
-
-	for i := 0; i < count; i++ {
-		char := Character{
-			ID:         gofakeit.UUID(),
-			Name:       gofakeit.Username(),
-			Level:      gofakeit.Number(1, 100),
-			Experience: gofakeit.Number(0, 100000),
-			Stats: Stats{
-				Health:   gofakeit.Number(100, 10000),
-				Mana:     gofakeit.Number(50, 5000),
-				Strength: gofakeit.Number(10, 100),
-				Defense:  gofakeit.Number(10, 100),
-				Agility:  gofakeit.Number(10, 100),
-				Magic:    gofakeit.Number(10, 100),
-			},
-			Equipment: Equipment{
-				Weapon:    gofakeit.Word(),
-				Armor:     gofakeit.Word(),
-				Accessory: gofakeit.Word(),
-			},
-			Metadata: Metadata{
-				CreatedAt:    gofakeit.Date().Format("2006-01-02 15:04:05"),
-				LastModified: gofakeit.Date().Format("2006-01-02 15:04:05"),
-				PlayTime:     gofakeit.Number(0, 10000),
-			},
-		}
-
-		// Generate inventory
-		itemCount := gofakeit.Number(5, 20)
-		char.Inventory = make([]Item, itemCount)
-		for j := 0; j < itemCount; j++ {
-			char.Inventory[j] = Item{
-				ID:       gofakeit.UUID(),
-				Name:     gofakeit.Word(),
-				Type:     gofakeit.RandomString([]string{"weapon", "armor", "consumable", "material"}),
-				Quantity: gofakeit.Number(1, 99),
-				Rarity:   gofakeit.RandomString([]string{"common", "rare", "epic", "legendary"}),
-			}
-		}
-
-		// Generate skills
-		skillCount := gofakeit.Number(3, 10)
-		char.Skills = make([]Skill, skillCount)
-		for j := 0; j < skillCount; j++ {
-			char.Skills[j] = Skill{
-				ID:       gofakeit.UUID(),
-				Name:     gofakeit.Word(),
-				Level:    gofakeit.Number(1, 10),
-				Cooldown: gofakeit.Number(0, 300),
-			}
-		}
-
-		// Generate quests
-		questCount := gofakeit.Number(2, 8)
-		char.Quests = make([]Quest, questCount)
-		for j := 0; j < questCount; j++ {
-			char.Quests[j] = Quest{
-				ID:       gofakeit.UUID(),
-				Name:     gofakeit.Sentence(3),
-				Progress: gofakeit.Number(0, 100),
-				Status:   gofakeit.RandomString([]string{"active", "completed", "failed", "abandoned"}),
-			}
-		}
-
-		storage.Characters[i] = char
-	}
-
-	return storage
-}
-
 // 표준 JSON 직렬화 성능 측정 (20개 캐릭터)
 // 실행: go test -run=^$ -bench=BenchmarkStandardJSON20Characters -benchmem
 func BenchmarkStandardJSON20Characters(b *testing.B) {
@@ -446,6 +196,118 @@ func BenchmarkAvroBinary20Characters(b *testing.B) {
 	}
 }
 
+// gzip 압축 JSON 성능 측정 (20개 캐릭터) - 직렬화 후 압축까지 포함한 비교 기준
+// 실행: go test -run=^$ -bench=BenchmarkGzipJSON20Characters -benchmem
+func BenchmarkGzipJSON20Characters(b *testing.B) {
+	data := generateDummyCharacters(20)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		jsonData, _ := json.Marshal(data)
+		size, _ := gzipSize(jsonData)
+		_ = size
+	}
+}
+
+// MessagePack 직렬화 성능 측정 (20개 캐릭터) - 스키마 없는 바이너리 비교 기준
+// 실행: go test -run=^$ -bench=BenchmarkMessagePack20Characters -benchmem
+func BenchmarkMessagePack20Characters(b *testing.B) {
+	data := generateDummyCharacters(20)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		packed, _ := marshalMsgpack(data)
+		_ = packed
+	}
+}
+
+// CBOR 직렬화 성능 측정 (20개 캐릭터) - 스키마 없는 바이너리 비교 기준
+// 실행: go test -run=^$ -bench=BenchmarkCBOR20Characters -benchmem
+func BenchmarkCBOR20Characters(b *testing.B) {
+	data := generateDummyCharacters(20)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cborData, _ := marshalCBOR(data)
+		_ = cborData
+	}
+}
+
+// Protobuf 직렬화 성능 측정 (20개 캐릭터) - logpb/bench.proto 메시지
+// 실행: go test -run=^$ -bench=BenchmarkProtobuf20Characters -benchmem
+func BenchmarkProtobuf20Characters(b *testing.B) {
+	data := generateDummyCharacters(20).protobuf()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		protoData := data.Marshal()
+		_ = protoData
+	}
+}
+
+// LogRequest 직렬화 성능 측정 - /log 요청 하나의 JSON, gzip JSON, Avro, MessagePack, CBOR, Protobuf 비교
+// 실행: go test -run=^$ -bench=BenchmarkLogRequest -benchmem
+func BenchmarkLogRequestStandardJSON(b *testing.B) {
+	req := warmupPayload(2)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		jsonData, _ := json.Marshal(req)
+		_ = jsonData
+	}
+}
+
+func BenchmarkLogRequestGzipJSON(b *testing.B) {
+	req := warmupPayload(2)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		jsonData, _ := json.Marshal(req)
+		size, _ := gzipSize(jsonData)
+		_ = size
+	}
+}
+
+func BenchmarkLogRequestAvroBinary(b *testing.B) {
+	req := warmupPayload(2)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		encoded, _ := encodeLogRequest(req)
+		_ = encoded
+	}
+}
+
+func BenchmarkLogRequestMessagePack(b *testing.B) {
+	req := warmupPayload(2)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		packed, _ := marshalMsgpack(req)
+		_ = packed
+	}
+}
+
+func BenchmarkLogRequestCBOR(b *testing.B) {
+	req := warmupPayload(2)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cborData, _ := marshalCBOR(req)
+		_ = cborData
+	}
+}
+
+func BenchmarkLogRequestProtobuf(b *testing.B) {
+	req := warmupPayload(2).protobuf()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		protoData := req.Marshal()
+		_ = protoData
+	}
+}
+
 // 최적화된 JSON 직렬화 성능 측정 (5개 캐릭터) - 필드명 중복 제거
 // 실행: go test -run=^$ -bench=BenchmarkOptimizedJSON5Characters -benchmem
 func BenchmarkOptimizedJSON5Characters(b *testing.B) {
@@ -1,88 +1,386 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/gin-gonic/gin"
+	"github.com/homveloper/exp-avro-json/server/ocf"
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+	"github.com/homveloper/exp-avro-json/server/registry"
+	"github.com/homveloper/exp-avro-json/server/seal"
 	"go.uber.org/zap"
 )
 
-func logAvroData(wrapperBinary []byte, logDataBinary []byte, originalSize int, req LogRequest) {
-	// Create avro-logs directory if it doesn't exist
-	avroLogsDir := "avro-logs"
-	if err := os.MkdirAll(avroLogsDir, 0755); err != nil {
-		logger.Error("Failed to create avro-logs directory", zap.Error(err))
-		return
+// ocfTuning is the OCF writer settings of the file and S3 sinks, set by
+// the -ocf-* flags or a sink config entry.
+type ocfTuning struct {
+	MaxRecords int `json:"max_records"`
+	// Compression is the block codec of every stream, or a comma-separated
+	// list of stream=codec overrides with an optional default codec, such
+	// as "deflate,wrapper=snappy". Streams are named by their file prefix:
+	// wrapper, logdata or <subject>-v<version>.
+	Compression     string `json:"compression"`
+	BlockRecords    int    `json:"block_records"`
+	SyncInterval    int    `json:"sync_interval"`
+	FlushIntervalMS int    `json:"flush_interval_ms"`
+}
+
+// parseOCFCompression splits an ocfTuning.Compression value into its
+// default codec and per-stream overrides.
+func parseOCFCompression(value string) (string, map[string]string, error) {
+	def := ocf.CompressionNull
+	streams := make(map[string]string)
+	seenDefault := false
+	for _, entry := range splitList(value) {
+		stream, codec, ok := strings.Cut(entry, "=")
+		if !ok {
+			if seenDefault {
+				return "", nil, fmt.Errorf("more than one default codec in %q", value)
+			}
+			def, codec, seenDefault = entry, entry, true
+		} else if stream == "" {
+			return "", nil, fmt.Errorf("%q has no stream name", entry)
+		} else if _, dup := streams[stream]; dup {
+			return "", nil, fmt.Errorf("stream %q is given twice", stream)
+		} else {
+			streams[stream] = codec
+		}
+		if err := ocf.CheckCompression(codec); err != nil {
+			return "", nil, err
+		}
+	}
+	return def, streams, nil
+}
+
+// ocfStore appends logs to Avro Object Container Files, one stream of
+// LogWrapper records and one of LogData records, so the logs can be read
+// with standard Avro tooling. Both are nil until open.
+type ocfStore struct {
+	wrapper *ocf.Writer
+	logData *ocf.Writer
+
+	dir      string
+	tuning   ocfTuning
+	onClosed func(path string)
+	// key, when set, encrypts the store's files; it is the tenant's key in
+	// multi-tenant mode.
+	key *seal.Key
+	// index, when set before open, indexes the wrapper stream for /logs.
+	index *logIndex
+	// compression is the default block codec and streams the per-stream
+	// ones, parsed from tuning.Compression.
+	compression string
+	streams     map[string]string
+
+	// bySchema holds the writers for imported files and other body
+	// versions, keyed by canonical schema. It starts with the two built-in
+	// streams so imported LogWrapper and LogData records join them.
+	mu       sync.Mutex
+	bySchema map[string]*ocf.Writer
+}
+
+// ocfLogs is the store of the file sink; export, replay and imports read
+// and add to it. Its streams are nil when no file sink is configured.
+var ocfLogs ocfStore
+
+// openOCFLogs opens the file sink's store in dir.
+func openOCFLogs(dir string, tuning ocfTuning) error {
+	if dir == "" {
+		return nil
+	}
+	ocfLogs.index = newLogIndex()
+	return ocfLogs.open(dir, tuning, nil)
+}
+
+// open opens the built-in streams in dir. tuning applies to every stream,
+// including those opened later, and onClosed, if set, is called with each
+// finished file. A store with an index first indexes the wrapper files
+// already in dir.
+func (s *ocfStore) open(dir string, tuning ocfTuning, onClosed func(string)) error {
+	compression, streams, err := parseOCFCompression(tuning.Compression)
+	if err != nil {
+		return err
+	}
+	if s.index != nil {
+		if err := s.index.rebuild(dir, s); err != nil {
+			return fmt.Errorf("index %s: %w", dir, err)
+		}
+	}
+	s.dir, s.tuning, s.onClosed = dir, tuning, onClosed
+	s.compression, s.streams = compression, streams
+	wrapper, err := ocf.Open(dir, avrojson.WrapperSchema, s.options("wrapper"))
+	if err != nil {
+		return err
+	}
+	logData, err := ocf.Open(dir, avrojson.LogDataSchema, s.options("logdata"))
+	if err != nil {
+		return err
 	}
+	s.wrapper, s.logData = wrapper, logData
+	s.bySchema = make(map[string]*ocf.Writer)
+	for schema, w := range map[string]*ocf.Writer{avrojson.WrapperSchema: wrapper, avrojson.LogDataSchema: logData} {
+		codec, err := avrojson.DefaultCache.Get(schema)
+		if err != nil {
+			return err
+		}
+		s.bySchema[codec.Canonical()] = w
+	}
+	return nil
+}
+
+// options returns the writer options of the stream named prefix.
+func (s *ocfStore) options(prefix string) ocf.Options {
+	compression, ok := s.streams[prefix]
+	if !ok {
+		compression = s.compression
+	}
+	var onBlock func(string, int64, []interface{})
+	if prefix == "wrapper" && s.index != nil {
+		onBlock = s.index.addBlock
+	}
+	return ocf.Options{
+		Prefix:        prefix,
+		IDs:           logIDs,
+		MaxRecords:    s.tuning.MaxRecords,
+		Compression:   compression,
+		BlockRecords:  s.tuning.BlockRecords,
+		SyncInterval:  s.tuning.SyncInterval,
+		FlushInterval: time.Duration(s.tuning.FlushIntervalMS) * time.Millisecond,
+		Key:           s.key,
+		OnFileClosed:  s.onClosed,
+		OnBlock:       onBlock,
+	}
+}
+
+// flush writes the records every stream holds for a partly filled block,
+// so readers of the files see every log appended so far.
+func (s *ocfStore) flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var errs []error
+	for _, w := range s.bySchema {
+		errs = append(errs, w.Flush())
+	}
+	return errors.Join(errs...)
+}
 
-	// Generate timestamp-based filename
-	timestamp := time.Now().Format("20060102_150405")
+// sync flushes every stream and commits its current file to stable
+// storage.
+func (s *ocfStore) sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var errs []error
+	for _, w := range s.bySchema {
+		errs = append(errs, w.Sync())
+	}
+	return errors.Join(errs...)
+}
 
-	// Save wrapper Avro binary
-	wrapperFile := filepath.Join(avroLogsDir, fmt.Sprintf("wrapper_%s.avro", timestamp))
-	if err := os.WriteFile(wrapperFile, wrapperBinary, 0644); err != nil {
-		logger.Error("Failed to write wrapper Avro file", zap.Error(err))
-	} else {
-		logger.Info("Wrapper Avro binary saved",
-			zap.String("file", wrapperFile),
-			zap.Int("size_bytes", len(wrapperBinary)))
+// close writes the records every stream buffers and closes its file, so
+// it ends on a complete block.
+func (s *ocfStore) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var errs []error
+	for _, w := range s.bySchema {
+		errs = append(errs, w.Close())
 	}
+	return errors.Join(errs...)
+}
 
-	// Save logdata Avro binary
-	logDataFile := filepath.Join(avroLogsDir, fmt.Sprintf("logdata_%s.avro", timestamp))
-	if err := os.WriteFile(logDataFile, logDataBinary, 0644); err != nil {
-		logger.Error("Failed to write logdata Avro file", zap.Error(err))
-	} else {
-		logger.Info("LogData Avro binary saved",
-			zap.String("file", logDataFile),
-			zap.Int("size_bytes", len(logDataBinary)))
+// openFiles returns the paths of the files the store's streams are
+// writing; its other files are complete.
+func (s *ocfStore) openFiles() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var paths []string
+	for _, w := range s.bySchema {
+		if path := w.Current(); path != "" {
+			paths = append(paths, path)
+		}
 	}
+	return paths
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
 
-	// For comparison, save original JSON as well
-	jsonFile := filepath.Join(avroLogsDir, fmt.Sprintf("original_%s.json", timestamp))
-	originalJSON, err := json.Marshal(req)
+// writerFor returns the stream records of a registered schema are
+// appended to, opening one named <subject>-v<version> on first use.
+func (s *ocfStore) writerFor(schema registry.Schema) (*ocf.Writer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if w, ok := s.bySchema[schema.Canonical]; ok {
+		return w, nil
+	}
+	prefix := unsafeFileChars.ReplaceAllString(fmt.Sprintf("%s-v%d", schema.Name, schema.Version), "_")
+	w, err := ocf.Open(s.dir, schema.Schema, s.options(prefix))
 	if err != nil {
-		logger.Error("Failed to marshal original JSON", zap.Error(err))
-	} else {
-		if err := os.WriteFile(jsonFile, originalJSON, 0644); err != nil {
-			logger.Error("Failed to write original JSON file", zap.Error(err))
-		} else {
-			logger.Info("Original JSON saved",
-				zap.String("file", jsonFile),
-				zap.Int("size_bytes", len(originalJSON)))
+		return nil, err
+	}
+	s.bySchema[schema.Canonical] = w
+	return w, nil
+}
+
+// append adds one log's encodings to the streams.
+func (s *ocfStore) append(encoded *avrojson.EncodedLog) error {
+	if err := s.wrapper.Append(encoded.Wrapper); err != nil {
+		return fmt.Errorf("append wrapper: %w", err)
+	}
+	logData := s.logData
+	if encoded.LogDataSchema != "" && encoded.LogDataSchema != avrojson.LogDataSchema {
+		// Bodies of other registered versions get their own stream, as
+		// each container file holds one schema.
+		schema, err := schemaRegistry.Lookup(encoded.LogDataSchema)
+		if err == nil {
+			logData, err = s.writerFor(schema)
+		}
+		if err != nil {
+			return fmt.Errorf("open stream for log data schema: %w", err)
 		}
 	}
+	if err := logData.Append(encoded.LogData); err != nil {
+		return fmt.Errorf("append log data: %w", err)
+	}
+	return nil
+}
+
+// fileSink writes logs to the OCF store under -ocf-dir, or in multi-tenant
+// mode to each project's store below it. It is the sink export, replay and
+// imports work with, so at most one is configured.
+type fileSink struct {
+	store   *ocfStore
+	tenants *tenantStores
+}
+
+type fileSinkConfig struct {
+	Dir string `json:"dir"`
+	ocfTuning
+}
+
+func newFileSink(config fileSinkConfig) (Sink, error) {
+	if config.Dir == "" {
+		return nil, errors.New("dir is required")
+	}
+	if ocfLogs.wrapper != nil || tenantLogs != nil {
+		return nil, errors.New("only one file sink may be configured")
+	}
+	if tenants != nil {
+		stores, err := newTenantStores(config.Dir, config.ocfTuning, nil)
+		if err != nil {
+			return nil, err
+		}
+		stores.indexed = true
+		tenantLogs = stores
+		return fileSink{tenants: stores}, nil
+	}
+	if err := openOCFLogs(config.Dir, config.ocfTuning); err != nil {
+		return nil, err
+	}
+	return fileSink{store: &ocfLogs}, nil
+}
+
+func (s fileSink) Write(ctx context.Context, record sinkRecord) error {
+	store := s.store
+	if s.tenants != nil {
+		var err error
+		if store, err = s.tenants.store(record.Project); err != nil {
+			return err
+		}
+	}
+	return store.append(record.Encoded)
+}
+
+func (s fileSink) Sync() error {
+	if s.tenants != nil {
+		return s.tenants.sync()
+	}
+	return s.store.sync()
+}
+
+func (s fileSink) Close() error {
+	if s.tenants != nil {
+		return s.tenants.close()
+	}
+	return s.store.close()
+}
+
+func (s fileSink) openFiles() []string {
+	if s.tenants != nil {
+		return s.tenants.openFiles()
+	}
+	return s.store.openFiles()
+}
+
+func (s fileSink) Dir() string {
+	if s.tenants != nil {
+		return s.tenants.dir
+	}
+	return s.store.dir
+}
+
+// addBlockStats reports how large each encoding is as a compressed OCF
+// block, so /log responses compare Avro plus block codec against JSON.
+func addBlockStats(stats gin.H, encoded *avrojson.EncodedLog, originalSize int) {
+	if ocfLogs.wrapper == nil {
+		return
+	}
+	wrapperSize, err := ocf.BlockSize(ocfLogs.wrapper.Compression(), encoded.Wrapper)
+	if err != nil {
+		logger.Warn("Failed to measure compressed block size", zap.Error(err))
+		return
+	}
+	logDataSize, err := ocf.BlockSize(ocfLogs.logData.Compression(), encoded.LogData)
+	if err != nil {
+		logger.Warn("Failed to measure compressed block size", zap.Error(err))
+		return
+	}
+	stats["ocf_compression"] = ocfLogs.wrapper.Compression()
+	if c := ocfLogs.logData.Compression(); c != ocfLogs.wrapper.Compression() {
+		stats["ocf_logdata_compression"] = c
+	}
+	stats["wrapper_block_size"] = wrapperSize
+	stats["logdata_block_size"] = logDataSize
+	stats["wrapper_block_compression"] = fmt.Sprintf("%.2f%%", float64(wrapperSize)/float64(originalSize)*100)
+	stats["logdata_block_compression"] = fmt.Sprintf("%.2f%%", float64(logDataSize)/float64(originalSize)*100)
+}
+
+func ocfLogStats() gin.H {
+	if tenantLogs != nil {
+		return gin.H{"dir": tenantLogs.dir, "tenants": tenantLogs.stats()}
+	}
+	if ocfLogs.wrapper == nil {
+		return nil
+	}
+	return ocfLogs.stats()
+}
 
-	// Calculate and log compression statistics
-	wrapperCompressionRatio := float64(len(wrapperBinary)) / float64(originalSize) * 100
-	logDataCompressionRatio := float64(len(logDataBinary)) / float64(originalSize) * 100
-
-	wrapperSavings := originalSize - len(wrapperBinary)
-	logDataSavings := originalSize - len(logDataBinary)
-
-	logger.Info("Avro compression analysis",
-		zap.String("timestamp", timestamp),
-		zap.Int("original_json_bytes", originalSize),
-		zap.Int("wrapper_avro_bytes", len(wrapperBinary)),
-		zap.Int("logdata_avro_bytes", len(logDataBinary)),
-		zap.Float64("wrapper_compression_ratio", wrapperCompressionRatio),
-		zap.Float64("logdata_compression_ratio", logDataCompressionRatio),
-		zap.Int("wrapper_space_saved", wrapperSavings),
-		zap.Int("logdata_space_saved", logDataSavings),
-		zap.String("log_type", req.LogType),
-		zap.String("log_level", req.LogLevel))
-
-	// Log summary with better compression
-	if len(wrapperBinary) < originalSize {
-		logger.Info("Compression achieved!",
-			zap.String("best_compression", "wrapper"),
-			zap.Float64("compression_percent", 100.0-wrapperCompressionRatio),
-			zap.Int("bytes_saved", wrapperSavings))
-	} else {
-		logger.Warn("No compression achieved - Avro overhead exceeded savings",
-			zap.Int("overhead_bytes", len(wrapperBinary)-originalSize))
+func (s *ocfStore) stats() gin.H {
+	stats := gin.H{
+		"dir":         s.wrapper.Dir(),
+		"compression": s.compression,
+		"tuning":      s.tuning,
+		"wrapper":     s.wrapper.Stats(),
+		"logdata":     s.logData.Stats(),
+	}
+	imported := gin.H{}
+	s.mu.Lock()
+	for _, w := range s.bySchema {
+		if w != s.wrapper && w != s.logData {
+			imported[w.Prefix()] = w.Stats()
+		}
+	}
+	s.mu.Unlock()
+	if len(imported) > 0 {
+		stats["imported"] = imported
+	}
+	if s.index != nil {
+		stats["indexed_logs"] = s.index.len()
 	}
+	return stats
 }
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/homveloper/exp-avro-json/server/ocf"
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+	"github.com/linkedin/goavro/v2"
+	"go.uber.org/zap"
+)
+
+// writeOCFLog writes encoded through the file sink of the open OCF logs.
+func writeOCFLog(t *testing.T, encoded *avrojson.EncodedLog) {
+	t.Helper()
+	if err := (fileSink{store: &ocfLogs}).Write(context.Background(), sinkRecord{Encoded: encoded}); err != nil {
+		t.Fatalf("Failed to write log: %v", err)
+	}
+}
+
+func TestFileSinkWritesOCF(t *testing.T) {
+	logger = zap.NewNop()
+	dir := t.TempDir()
+	if err := openOCFLogs(dir, ocfTuning{}); err != nil {
+		t.Fatalf("Failed to open OCF logs: %v", err)
+	}
+	defer func() {
+		ocfLogs.wrapper.Close()
+		ocfLogs.logData.Close()
+		ocfLogs.wrapper, ocfLogs.logData = nil, nil
+	}()
+
+	for _, issuer := range []string{"a", "b"} {
+		encoded, err := avrojson.EncodeLog(avrojson.LogWrapper{ProjectName: "p", LogType: "t"},
+			avrojson.LogData{Timestamp: time.UnixMilli(1).UTC(), Logtype: "t", Version: "1", Issuer: issuer})
+		if err != nil {
+			t.Fatalf("Failed to encode log: %v", err)
+		}
+		writeOCFLog(t, encoded)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "logdata-*.avro"))
+	if len(files) != 1 {
+		t.Fatalf("Expected one log data OCF file, found %v", files)
+	}
+	f, err := os.Open(files[0])
+	if err != nil {
+		t.Fatalf("Failed to open OCF file: %v", err)
+	}
+	defer f.Close()
+	r, err := goavro.NewOCFReader(f)
+	if err != nil {
+		t.Fatalf("Failed to read OCF header: %v", err)
+	}
+	var issuers []string
+	for r.Scan() {
+		record, err := r.Read()
+		if err != nil {
+			t.Fatalf("Failed to read record: %v", err)
+		}
+		issuers = append(issuers, record.(map[string]interface{})["issuer"].(string))
+	}
+	if len(issuers) != 2 || issuers[0] != "a" || issuers[1] != "b" {
+		t.Errorf("unexpected records %v", issuers)
+	}
+	if stats := ocfLogStats(); stats["wrapper"].(ocf.Stats).Records != 2 {
+		t.Errorf("unexpected OCF stats %v", stats)
+	}
+}
+
+func TestAddBlockStatsUsesConfiguredCodec(t *testing.T) {
+	logger = zap.NewNop()
+	if err := openOCFLogs(t.TempDir(), ocfTuning{Compression: ocf.CompressionDeflate}); err != nil {
+		t.Fatalf("Failed to open OCF logs: %v", err)
+	}
+	defer func() {
+		ocfLogs.wrapper.Close()
+		ocfLogs.logData.Close()
+		ocfLogs.wrapper, ocfLogs.logData = nil, nil
+	}()
+
+	encoded, err := avrojson.EncodeLog(avrojson.LogWrapper{ProjectName: "p", LogType: "t"},
+		avrojson.LogData{Timestamp: time.UnixMilli(1).UTC(), Logtype: "t", Version: "1", Issuer: "i"})
+	if err != nil {
+		t.Fatalf("Failed to encode log: %v", err)
+	}
+	stats := gin.H{}
+	addBlockStats(stats, encoded, 100)
+	if stats["ocf_compression"] != ocf.CompressionDeflate {
+		t.Fatalf("unexpected block stats %v", stats)
+	}
+	if want, _ := ocf.BlockSize(ocf.CompressionDeflate, encoded.LogData); stats["logdata_block_size"] != want {
+		t.Errorf("log data block is %v bytes, want %d", stats["logdata_block_size"], want)
+	}
+	if ocfLogStats()["compression"] != ocf.CompressionDeflate {
+		t.Errorf("OCF stats do not report the codec: %v", ocfLogStats())
+	}
+}
+
+func TestOCFTuning(t *testing.T) {
+	logger = zap.NewNop()
+	tuning := ocfTuning{Compression: "deflate, logdata=snappy", BlockRecords: 10}
+	if err := openOCFLogs(t.TempDir(), tuning); err != nil {
+		t.Fatalf("Failed to open OCF logs: %v", err)
+	}
+	defer func() {
+		ocfLogs.wrapper.Close()
+		ocfLogs.logData.Close()
+		ocfLogs.wrapper, ocfLogs.logData = nil, nil
+	}()
+	if ocfLogs.wrapper.Compression() != ocf.CompressionDeflate || ocfLogs.logData.Compression() != ocf.CompressionSnappy {
+		t.Errorf("streams use %s and %s", ocfLogs.wrapper.Compression(), ocfLogs.logData.Compression())
+	}
+
+	for i := 0; i < 3; i++ {
+		encoded, err := avrojson.EncodeLog(avrojson.LogWrapper{ProjectName: "p", LogType: "t"},
+			avrojson.LogData{Timestamp: time.UnixMilli(1).UTC(), Logtype: "t", Version: "1", Issuer: "i"})
+		if err != nil {
+			t.Fatalf("Failed to encode log: %v", err)
+		}
+		writeOCFLog(t, encoded)
+	}
+	if stats := ocfLogs.logData.Stats(); stats.Buffered != 3 || stats.Records != 0 {
+		t.Errorf("expected the logs to wait for a full block: %+v", stats)
+	}
+	// Readers of the store flush first, so they see every log.
+	if _, err := ocfLogs.sources(); err != nil {
+		t.Fatalf("Failed to list OCF files: %v", err)
+	}
+	if stats := ocfLogs.logData.Stats(); stats.Records != 3 || stats.Blocks != 1 {
+		t.Errorf("expected the logs written as one block: %+v", stats)
+	}
+
+	for _, bad := range []string{"zstd", "wrapper=lz4", "null,deflate", "wrapper=null,wrapper=deflate", "=deflate"} {
+		if _, _, err := parseOCFCompression(bad); err == nil {
+			t.Errorf("expected compression %q to be rejected", bad)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
 	"github.com/linkedin/goavro/v2"
 )
 
@@ -116,16 +117,16 @@ func TestAvroSerialization(t *testing.T) {
 	fmt.Printf("\n📄 Original JSON size: %d bytes\n", len(originalJSON))
 
 	// 2. Convert metadata and domainData to Avro format
-	metadataForAvro := convertToAvroMap(testLogRequest.LogBody.Metadata)
-	domainDataForAvro := convertToAvroMap(testLogRequest.LogBody.DomainData)
+	metadataForAvro := avrojson.StringMap(testLogRequest.LogBody.Metadata)
+	domainDataForAvro := avrojson.StringMap(testLogRequest.LogBody.DomainData)
 
 	fmt.Printf("\n🔄 Converted to Avro map format:\n")
 	fmt.Printf("Metadata keys: %v\n", getMapKeys(metadataForAvro))
 	fmt.Printf("DomainData keys: %v\n", getMapKeys(domainDataForAvro))
 
 	// 3. Create Avro LogData
-	avroLogData := AvroLogData{
-		Timestamp:  testLogRequest.LogBody.Timestamp,
+	avroLogData := avrojson.LogData{
+		Timestamp:  time.UnixMilli(testLogRequest.LogBody.Timestamp).UTC(),
 		Logtype:    testLogRequest.LogBody.Logtype,
 		Version:    testLogRequest.LogBody.Version,
 		Issuer:     testLogRequest.LogBody.Issuer,
@@ -134,7 +135,7 @@ func TestAvroSerialization(t *testing.T) {
 	}
 
 	// 4. Serialize LogData to Avro binary
-	logDataCodec, err := goavro.NewCodec(logDataSchema)
+	logDataCodec, err := goavro.NewCodec(avrojson.LogDataSchema)
 	if err != nil {
 		t.Fatalf("Failed to create LogData codec: %v", err)
 	}
@@ -157,7 +158,7 @@ func TestAvroSerialization(t *testing.T) {
 	}
 
 	// 6. Create wrapper with LogData JSON as body
-	avroWrapper := AvroLogWrapper{
+	avroWrapper := avrojson.LogWrapper{
 		ProjectName:    testLogRequest.ProjectName,
 		ProjectVersion: testLogRequest.ProjectVersion,
 		Body:           string(logDataJSON),
@@ -167,7 +168,7 @@ func TestAvroSerialization(t *testing.T) {
 	}
 
 	// 7. Serialize wrapper to Avro binary
-	wrapperCodec, err := goavro.NewCodec(wrapperSchema)
+	wrapperCodec, err := goavro.NewCodec(avrojson.WrapperSchema)
 	if err != nil {
 		t.Fatalf("Failed to create wrapper codec: %v", err)
 	}
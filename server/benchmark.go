@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/homveloper/exp-avro-json/server/logpb"
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+	"github.com/homveloper/exp-avro-json/server/pkg/columnarjson"
+	"github.com/linkedin/goavro/v2"
+	"go.uber.org/zap"
+)
+
+// POST /benchmark runs the encoding comparison of the benchmark tests on
+// demand: plain and gzipped JSON, Avro JSON, Avro binary, MessagePack,
+// CBOR, Protobuf and columnar JSON. The sample is generated from a spec,
+//
+//	{"generate": "20 characters"}  one user of N game characters
+//	{"generate": "100 records"}    N records of the threshold analysis
+//	{"generate": "50 logs"}        N warm-up log bodies as LogData
+//
+// or sent with its schema, schema text or a registered subject, as one
+// datum or a batch of them in Avro JSON:
+//
+//	{"schema": "...", "payload": {...}}
+//	{"schema": "...", "records": [{...}, ...]}
+//
+// Each format is encoded "iterations" times (default 100); sizes, time and
+// allocations per encode come back side by side. Allocations are read from
+// runtime.MemStats around the loop, so concurrent requests inflate them.
+const (
+	defaultBenchmarkIterations = 100
+	maxBenchmarkIterations     = 10000
+	maxBenchmarkRecords        = 10000
+)
+
+type benchmarkRequest struct {
+	Generate   string            `json:"generate"`
+	Schema     string            `json:"schema"`
+	Version    int               `json:"version"`
+	Payload    json.RawMessage   `json:"payload"`
+	Records    []json.RawMessage `json:"records"`
+	Iterations int               `json:"iterations"`
+}
+
+// benchmarkSample is what the formats encode: value in plain JSON, and
+// natives, the goavro native form of each datum, in the Avro formats.
+// messages are the protobuf form of each datum, which only generated
+// samples have: a schema sent with the request has no .proto equivalent.
+type benchmarkSample struct {
+	name     string
+	schema   string
+	value    interface{}
+	natives  []interface{}
+	messages []logpb.Message
+}
+
+type benchmarkResult struct {
+	Format          string  `json:"format"`
+	Bytes           int     `json:"bytes,omitempty"`
+	SizeRatio       string  `json:"size_ratio,omitempty"`
+	NsPerOp         int64   `json:"ns_per_op,omitempty"`
+	AllocsPerOp     float64 `json:"allocs_per_op,omitempty"`
+	AllocBytesPerOp float64 `json:"alloc_bytes_per_op,omitempty"`
+	Error           string  `json:"error,omitempty"`
+}
+
+type benchmarkFormat struct {
+	name string
+	// prepare returns the encoding of one pass over the sample, or an
+	// error when the format cannot encode it.
+	prepare func(s *benchmarkSample) (func() (int, error), error)
+}
+
+var benchmarkFormats = []benchmarkFormat{
+	{"json", func(s *benchmarkSample) (func() (int, error), error) {
+		return func() (int, error) {
+			data, err := json.Marshal(s.value)
+			return len(data), err
+		}, nil
+	}},
+	{"json_gzip", func(s *benchmarkSample) (func() (int, error), error) {
+		return func() (int, error) {
+			data, err := json.Marshal(s.value)
+			if err != nil {
+				return 0, err
+			}
+			return gzipSize(data)
+		}, nil
+	}},
+	{"json_zstd", func(s *benchmarkSample) (func() (int, error), error) {
+		return nil, errNoZstd
+	}},
+	{"avro_json", func(s *benchmarkSample) (func() (int, error), error) {
+		codec, err := goavro.NewCodec(s.schema)
+		if err != nil {
+			return nil, err
+		}
+		single := len(s.natives) == 1
+		return func() (int, error) {
+			// A batch is a JSON array of its data, as plain JSON has it.
+			var buf []byte
+			if !single {
+				buf = append(buf, '[')
+			}
+			for i, native := range s.natives {
+				if i > 0 {
+					buf = append(buf, ',')
+				}
+				var err error
+				if buf, err = codec.TextualFromNative(buf, native); err != nil {
+					return 0, err
+				}
+			}
+			if !single {
+				buf = append(buf, ']')
+			}
+			return len(buf), nil
+		}, nil
+	}},
+	{"avro_binary", func(s *benchmarkSample) (func() (int, error), error) {
+		codec, err := goavro.NewCodec(s.schema)
+		if err != nil {
+			return nil, err
+		}
+		return func() (int, error) {
+			var buf []byte
+			for _, native := range s.natives {
+				var err error
+				if buf, err = codec.BinaryFromNative(buf, native); err != nil {
+					return 0, err
+				}
+			}
+			return len(buf), nil
+		}, nil
+	}},
+	{"msgpack", func(s *benchmarkSample) (func() (int, error), error) {
+		value := plainNumbers(s.value)
+		return func() (int, error) {
+			data, err := marshalMsgpack(value)
+			return len(data), err
+		}, nil
+	}},
+	{"cbor", func(s *benchmarkSample) (func() (int, error), error) {
+		value := plainNumbers(s.value)
+		return func() (int, error) {
+			data, err := marshalCBOR(value)
+			return len(data), err
+		}, nil
+	}},
+	{"protobuf", func(s *benchmarkSample) (func() (int, error), error) {
+		if len(s.messages) == 0 {
+			return nil, errors.New("no protobuf message for the schema; only generated samples have one")
+		}
+		return func() (int, error) {
+			// Messages of a batch are concatenated, as Avro data are.
+			n := 0
+			for _, m := range s.messages {
+				n += len(m.Marshal())
+			}
+			return n, nil
+		}, nil
+	}},
+	{"columnar", func(s *benchmarkSample) (func() (int, error), error) {
+		codec, err := columnarjson.New(s.schema)
+		if err != nil {
+			return nil, err
+		}
+		return func() (int, error) {
+			data, err := codec.Marshal(s.natives)
+			return len(data), err
+		}, nil
+	}},
+}
+
+func benchmarkHandler(c *gin.Context) {
+	var req benchmarkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	iterations := req.Iterations
+	if iterations == 0 {
+		iterations = defaultBenchmarkIterations
+	}
+	if iterations < 1 || iterations > maxBenchmarkIterations {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("iterations must be between 1 and %d", maxBenchmarkIterations))
+		return
+	}
+	sample, err := benchmarkSampleOf(req)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	results := make([]benchmarkResult, len(benchmarkFormats))
+	for i, format := range benchmarkFormats {
+		results[i] = runBenchmark(format, sample, iterations)
+		// Plain JSON is the baseline the others are given against.
+		if i == 0 && results[0].Error != "" {
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, "Sample does not encode as JSON: "+results[0].Error)
+			return
+		}
+	}
+	smallest, fastest := -1, -1
+	for i := range results {
+		r := &results[i]
+		if r.Error != "" {
+			continue
+		}
+		r.SizeRatio = fmt.Sprintf("%.2f%%", float64(r.Bytes)/float64(results[0].Bytes)*100)
+		if smallest < 0 || r.Bytes < results[smallest].Bytes {
+			smallest = i
+		}
+		if fastest < 0 || r.NsPerOp < results[fastest].NsPerOp {
+			fastest = i
+		}
+	}
+
+	requestLogger(c).Info("Benchmark run",
+		zap.String("sample", sample.name),
+		zap.Int("records", len(sample.natives)),
+		zap.Int("iterations", iterations))
+	c.JSON(http.StatusOK, gin.H{
+		"sample":     gin.H{"name": sample.name, "records": len(sample.natives)},
+		"iterations": iterations,
+		"results":    results,
+		"smallest":   results[smallest].Format,
+		"fastest":    results[fastest].Format,
+	})
+}
+
+// runBenchmark encodes the sample once for its size, failing on the first
+// error, and then iterations times for time and allocations.
+func runBenchmark(format benchmarkFormat, sample *benchmarkSample, iterations int) benchmarkResult {
+	result := benchmarkResult{Format: format.name}
+	encode, err := format.prepare(sample)
+	if err == nil {
+		result.Bytes, err = encode()
+	}
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	for i := 0; i < iterations; i++ {
+		if _, err := encode(); err != nil {
+			result.Error = err.Error()
+			return result
+		}
+	}
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+
+	result.NsPerOp = elapsed.Nanoseconds() / int64(iterations)
+	result.AllocsPerOp = float64(after.Mallocs-before.Mallocs) / float64(iterations)
+	result.AllocBytesPerOp = float64(after.TotalAlloc-before.TotalAlloc) / float64(iterations)
+	return result
+}
+
+func benchmarkSampleOf(req benchmarkRequest) (*benchmarkSample, error) {
+	if req.Generate != "" {
+		if req.Schema != "" || req.Payload != nil || req.Records != nil {
+			return nil, errors.New("generate cannot be combined with schema, payload or records")
+		}
+		return generateBenchmarkSample(req.Generate)
+	}
+	if strings.TrimSpace(req.Schema) == "" {
+		return nil, errors.New("either generate or schema is required")
+	}
+	if (req.Payload == nil) == (req.Records == nil) {
+		return nil, errors.New("exactly one of payload and records is required with schema")
+	}
+	if len(req.Records) > maxBenchmarkRecords {
+		return nil, fmt.Errorf("at most %d records", maxBenchmarkRecords)
+	}
+
+	sample := &benchmarkSample{name: "custom schema", schema: req.Schema}
+	// Schema text is JSON; anything else names a registered subject.
+	if !strings.ContainsAny(strings.TrimSpace(req.Schema)[:1], `{["`) {
+		schema, err := resolveSchema(req.Schema, req.Version)
+		if err != nil {
+			return nil, fmt.Errorf("unknown schema %q version %d", req.Schema, req.Version)
+		}
+		sample.name, sample.schema = schema.Name+" v"+strconv.Itoa(schema.Version), schema.Schema
+	}
+	codec, err := avrojson.DefaultCache.Get(sample.schema)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+
+	data := req.Records
+	if req.Payload != nil {
+		data = []json.RawMessage{req.Payload}
+	}
+	values := make([]interface{}, len(data))
+	for i, text := range data {
+		native, _, err := codec.Goavro().NativeFromTextual(text)
+		if err != nil {
+			return nil, fmt.Errorf("record %d is not Avro JSON of the schema: %w", i, err)
+		}
+		sample.natives = append(sample.natives, native)
+		dec := json.NewDecoder(bytes.NewReader(text))
+		dec.UseNumber()
+		if err := dec.Decode(&values[i]); err != nil {
+			return nil, fmt.Errorf("record %d: %w", i, err)
+		}
+	}
+	sample.value = values
+	if req.Payload != nil {
+		sample.value = values[0]
+	}
+	return sample, nil
+}
+
+// generateBenchmarkSample builds the sample of a "<count> <kind>" spec.
+func generateBenchmarkSample(spec string) (*benchmarkSample, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("generate must be \"<count> characters|records|logs\", got %q", spec)
+	}
+	n, err := strconv.Atoi(fields[0])
+	if err != nil || n < 1 || n > maxBenchmarkRecords {
+		return nil, fmt.Errorf("generate count must be between 1 and %d, got %q", maxBenchmarkRecords, fields[0])
+	}
+
+	sample := &benchmarkSample{name: strconv.Itoa(n) + " " + strings.TrimSuffix(fields[1], "s") + "s"}
+	var records []interface{}
+	switch strings.TrimSuffix(fields[1], "s") {
+	case "character":
+		storage := generateDummyCharacters(n)
+		sample.schema, sample.value = userCharacterSchema, storage
+		records = []interface{}{storage}
+		sample.messages = []logpb.Message{storage.protobuf()}
+	case "record":
+		generated := generateTestRecords(n)
+		sample.schema, sample.value = simpleRecordSchema, generated
+		for _, r := range generated {
+			records = append(records, r)
+			sample.messages = append(sample.messages, r.protobuf())
+		}
+	case "log":
+		bodies := make([]LogData, n)
+		for i := range bodies {
+			bodies[i] = warmupPayload(i).LogBody
+			sample.messages = append(sample.messages, bodies[i].protobuf())
+			records = append(records, avrojson.LogData{
+				Timestamp:  time.UnixMilli(bodies[i].Timestamp).UTC(),
+				Logtype:    bodies[i].Logtype,
+				Version:    bodies[i].Version,
+				Issuer:     bodies[i].Issuer,
+				Metadata:   avrojson.StringMap(bodies[i].Metadata),
+				DomainData: avrojson.StringMap(bodies[i].DomainData),
+			})
+		}
+		sample.schema, sample.value = avrojson.LogDataSchema, bodies
+	default:
+		return nil, fmt.Errorf("unknown generate kind %q (expected characters, records or logs)", fields[1])
+	}
+	for _, r := range records {
+		native, err := avrojson.ToNative(r)
+		if err != nil {
+			return nil, err
+		}
+		sample.natives = append(sample.natives, native)
+	}
+	return sample, nil
+}
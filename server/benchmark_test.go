@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type benchmarkResponse struct {
+	Sample struct {
+		Name    string `json:"name"`
+		Records int    `json:"records"`
+	} `json:"sample"`
+	Results  []benchmarkResult `json:"results"`
+	Smallest string            `json:"smallest"`
+}
+
+func (r benchmarkResponse) result(format string) benchmarkResult {
+	for _, result := range r.Results {
+		if result.Format == format {
+			return result
+		}
+	}
+	return benchmarkResult{}
+}
+
+func postBenchmark(t *testing.T, body string) (int, benchmarkResponse, string) {
+	t.Helper()
+	logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	if err := openSchemaRegistry(""); err != nil {
+		t.Fatalf("Failed to open schema registry: %v", err)
+	}
+	r := gin.New()
+	r.POST("/benchmark", benchmarkHandler)
+	req := httptest.NewRequest(http.MethodPost, "/benchmark", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var resp benchmarkResponse
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+	}
+	return w.Code, resp, w.Body.String()
+}
+
+func TestBenchmarkGenerated(t *testing.T) {
+	for _, tc := range []struct {
+		spec    string
+		records int
+	}{
+		{"20 characters", 1},
+		{"30 records", 30},
+		{"5 logs", 5},
+		{"1 character", 1},
+	} {
+		code, resp, body := postBenchmark(t, `{"generate":"`+tc.spec+`","iterations":3}`)
+		if code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", tc.spec, code, body)
+		}
+		if resp.Sample.Records != tc.records || len(resp.Results) != len(benchmarkFormats) {
+			t.Errorf("%s: unexpected response %s", tc.spec, body)
+		}
+		for _, r := range resp.Results {
+			if r.Format == "json_zstd" {
+				if r.Error != errNoZstd.Error() {
+					t.Errorf("%s: expected zstd to be reported as unavailable, got %+v", tc.spec, r)
+				}
+				continue
+			}
+			if r.Error != "" || r.Bytes == 0 || r.NsPerOp == 0 {
+				t.Errorf("%s: %s gave %+v", tc.spec, r.Format, r)
+			}
+		}
+		if gzipped := resp.result("json_gzip"); gzipped.Bytes >= resp.result("json").Bytes {
+			t.Errorf("%s: gzip did not shrink the JSON: %+v", tc.spec, gzipped)
+		}
+		// Uncompressed, the schema-based binary formats, which write no
+		// field names, are smallest; gzip may beat them on these
+		// repetitive fixtures.
+		smallest := resp.result("avro_binary")
+		if protobuf := resp.result("protobuf"); protobuf.Bytes < smallest.Bytes {
+			smallest = protobuf
+		}
+		for _, r := range resp.Results {
+			if r.Format != "json_gzip" && r.Error == "" && r.Bytes < smallest.Bytes {
+				t.Errorf("%s: expected Avro binary or Protobuf to be smallest uncompressed, got %s", tc.spec, r.Format)
+			}
+		}
+	}
+}
+
+func TestBenchmarkPayload(t *testing.T) {
+	schema, _ := json.Marshal(`{"type":"record","name":"User","fields":[{"name":"id","type":"long"},{"name":"email","type":["null","string"]}]}`)
+	code, resp, body := postBenchmark(t, `{"schema":`+string(schema)+`,"records":[{"id":1,"email":{"string":"a@b.c"}},{"id":2,"email":null}]}`)
+	if code != http.StatusOK || resp.Sample.Records != 2 {
+		t.Fatalf("Expected 200 with 2 records, got %d: %s", code, body)
+	}
+	if resp.Results[0].Format != "json" || resp.Results[0].SizeRatio != "100.00%" {
+		t.Errorf("expected plain JSON as the baseline: %+v", resp.Results[0])
+	}
+	// Numbers of a sent payload stay numbers in MessagePack.
+	if msgpack := resp.result("msgpack"); msgpack.Bytes == 0 || msgpack.Bytes >= resp.Results[0].Bytes {
+		t.Errorf("expected MessagePack to be smaller than JSON: %+v", resp.Results)
+	}
+
+	// A registered subject; a union is no record, so only columnar fails.
+	code, resp, body = postBenchmark(t, `{"schema":"LogWrapper","payload":{"projectName":"p","projectVersion":"1","body":"{}","logLevel":"INFO","logType":"t","logSource":"s"}}`)
+	if code != http.StatusOK || resp.Sample.Name != "LogWrapper v1" {
+		t.Fatalf("Expected 200 for LogWrapper v1, got %d: %s", code, body)
+	}
+	code, resp, body = postBenchmark(t, `{"schema":"[\"null\",\"string\"]","payload":{"string":"x"}}`)
+	failed := map[string]bool{}
+	for _, r := range resp.Results {
+		failed[r.Format] = r.Error != ""
+	}
+	if code != http.StatusOK || !failed["columnar"] || !failed["protobuf"] || failed["avro_binary"] || failed["msgpack"] || failed["cbor"] {
+		t.Errorf("expected only columnar and protobuf to fail for a union schema, got %d: %s", code, body)
+	}
+
+	for _, body := range []string{
+		`{}`,
+		`{"schema":"  ","payload":{}}`,
+		`{"generate":"20 dragons"}`,
+		`{"generate":"0 logs"}`,
+		`{"generate":"5 logs","schema":"LogData"}`,
+		`{"schema":"LogWrapper"}`,
+		`{"schema":"NoSuchSchema","payload":{}}`,
+		`{"schema":"LogWrapper","payload":{"projectName":1}}`,
+		`{"generate":"5 logs","iterations":100000}`,
+	} {
+		if code, _, resp := postBenchmark(t, body); code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d: %s", body, code, resp)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+// Package bloom implements Bloom filters: fixed-size sets that answer
+// "definitely absent" or "maybe present" for a key, never missing a key
+// that was added. They let the artifact store skip disk lookups for keys
+// it has never seen without holding the keys themselves in memory.
+package bloom
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"math"
+)
+
+// Filter is a Bloom filter. It is not safe for concurrent use.
+type Filter struct {
+	m     uint64 // bits
+	k     uint64 // hash functions
+	n     uint64 // keys added
+	words []uint64
+}
+
+// New returns a filter sized for capacity keys at false-positive rate p.
+func New(capacity int, p float64) *Filter {
+	if capacity < 1 {
+		capacity = 1
+	}
+	if p <= 0 || p >= 1 {
+		p = 0.01
+	}
+	m := uint64(math.Ceil(-float64(capacity) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	m = (m + 63) / 64 * 64
+	k := uint64(math.Round(float64(m) / float64(capacity) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &Filter{m: m, k: k, words: make([]uint64, m/64)}
+}
+
+// hashes derives the two base hashes of key; probe i is h1 + i*h2
+// (Kirsch-Mitzenmacher double hashing).
+func hashes(key []byte) (uint64, uint64) {
+	h := fnv.New128a()
+	h.Write(key)
+	sum := h.Sum(nil)
+	return binary.BigEndian.Uint64(sum[:8]), binary.BigEndian.Uint64(sum[8:]) | 1
+}
+
+// Add inserts key.
+func (f *Filter) Add(key []byte) {
+	h1, h2 := hashes(key)
+	for i := uint64(0); i < f.k; i++ {
+		bit := (h1 + i*h2) % f.m
+		f.words[bit/64] |= 1 << (bit % 64)
+	}
+	f.n++
+}
+
+// Test reports whether key may have been added. False is definite.
+func (f *Filter) Test(key []byte) bool {
+	h1, h2 := hashes(key)
+	for i := uint64(0); i < f.k; i++ {
+		bit := (h1 + i*h2) % f.m
+		if f.words[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Count returns how many keys were added, duplicates included.
+func (f *Filter) Count() uint64 { return f.n }
+
+// FalsePositiveRate estimates the chance that Test reports an absent key
+// as present at the current fill.
+func (f *Filter) FalsePositiveRate() float64 {
+	return math.Pow(1-math.Exp(-float64(f.k)*float64(f.n)/float64(f.m)), float64(f.k))
+}
+
+const magic = "BLM1"
+
+// MarshalBinary encodes the filter as magic, m, k, n and the bit words.
+func (f *Filter) MarshalBinary() ([]byte, error) {
+	out := make([]byte, 0, len(magic)+24+8*len(f.words))
+	out = append(out, magic...)
+	out = binary.BigEndian.AppendUint64(out, f.m)
+	out = binary.BigEndian.AppendUint64(out, f.k)
+	out = binary.BigEndian.AppendUint64(out, f.n)
+	for _, w := range f.words {
+		out = binary.BigEndian.AppendUint64(out, w)
+	}
+	return out, nil
+}
+
+// ErrCorrupt is returned by UnmarshalBinary for data MarshalBinary did not
+// produce.
+var ErrCorrupt = errors.New("bloom: corrupt filter")
+
+// UnmarshalBinary replaces the filter with one encoded by MarshalBinary.
+func (f *Filter) UnmarshalBinary(data []byte) error {
+	if len(data) < len(magic)+24 || string(data[:len(magic)]) != magic {
+		return ErrCorrupt
+	}
+	data = data[len(magic):]
+	m, k, n := binary.BigEndian.Uint64(data), binary.BigEndian.Uint64(data[8:]), binary.BigEndian.Uint64(data[16:])
+	data = data[24:]
+	if m == 0 || m%64 != 0 || k == 0 || uint64(len(data)) != m/8 {
+		return ErrCorrupt
+	}
+	words := make([]uint64, m/64)
+	for i := range words {
+		words[i] = binary.BigEndian.Uint64(data[8*i:])
+	}
+	*f = Filter{m: m, k: k, n: n, words: words}
+	return nil
+}
@@ -0,0 +1,51 @@
+package bloom
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func TestFilterHasNoFalseNegatives(t *testing.T) {
+	f := New(10000, 0.01)
+	for i := 0; i < 10000; i++ {
+		f.Add([]byte("event-" + strconv.Itoa(i)))
+	}
+	for i := 0; i < 10000; i++ {
+		if !f.Test([]byte("event-" + strconv.Itoa(i))) {
+			t.Fatalf("event-%d was added but tests absent", i)
+		}
+	}
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if f.Test([]byte("other-" + strconv.Itoa(i))) {
+			falsePositives++
+		}
+	}
+	// 1% expected; allow generous slack for the hash's variance.
+	if falsePositives > 300 {
+		t.Errorf("%d false positives in 10000 tests of a 1%% filter", falsePositives)
+	}
+	if rate := f.FalsePositiveRate(); rate < 0.005 || rate > 0.02 {
+		t.Errorf("estimated false-positive rate %f far from 1%%", rate)
+	}
+}
+
+func TestFilterRoundTrips(t *testing.T) {
+	f := New(100, 0.01)
+	f.Add([]byte("a"))
+	data, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Failed to marshal filter: %v", err)
+	}
+	var g Filter
+	if err := g.UnmarshalBinary(data); err != nil {
+		t.Fatalf("Failed to unmarshal filter: %v", err)
+	}
+	if !g.Test([]byte("a")) || g.Count() != 1 {
+		t.Errorf("restored filter lost its key")
+	}
+	if err := g.UnmarshalBinary(data[:len(data)-1]); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Expected ErrCorrupt for truncated data, got %v", err)
+	}
+}
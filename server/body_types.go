@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+	"github.com/homveloper/exp-avro-json/server/registry"
+)
+
+// The built-in LogData stores metadata and domainData as string maps, so
+// numbers, booleans and nested objects become JSON text and compress
+// poorly. -body-types=infer types them instead for /log bodies with no
+// project or logType schema of their own: the record types an
+// avrojson.Inferrer finds for the two values replace the maps in LogData,
+// and the result is registered under LogData.<logType>.inferred, where
+// versions evolve as bodies of new shapes arrive, and encodes the body.
+// Registered body schemas apply in both modes.
+const (
+	bodyTypesStrings = "strings"
+	bodyTypesInfer   = "infer"
+)
+
+var bodyTypes = bodyTypesStrings
+
+func parseBodyTypes(mode string) (string, error) {
+	switch mode {
+	case bodyTypesStrings, bodyTypesInfer:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown body types %q (want strings or infer)", mode)
+}
+
+// inferredSubject names the registry subject of the schemas inferred for
+// logType's bodies, or "" when logType has no subject of its own.
+func inferredSubject(logType string) string {
+	if logType == "" {
+		return bodySubject + ".inferred"
+	}
+	if !logTypeHasSubject(logType) {
+		return ""
+	}
+	return logTypeSubject(logType) + ".inferred"
+}
+
+// inferMu serializes inference, so bodies inferred together merge into one
+// version rather than racing to register their own.
+var inferMu sync.Mutex
+
+// inferLogRequest registers the schema inferred for the body of req and
+// returns it, with req's metadata and domainData converted to fit it. Each
+// value's type is merged with its type in the latest inferred version, so
+// bodies of shapes seen before reuse it, and ones with new or missing
+// fields or wider numbers add a version their predecessors still fit. It
+// reports false when the mode is off or the logType makes no subject
+// name, and the body keeps the built-in LogData.
+func inferLogRequest(req LogRequest) (registry.Schema, LogRequest, bool, error) {
+	subject := inferredSubject(req.LogType)
+	if bodyTypes != bodyTypesInfer || schemaRegistry == nil || !registry.ValidName(subject) {
+		return registry.Schema{}, req, false, nil
+	}
+	inferMu.Lock()
+	defer inferMu.Unlock()
+
+	var schema map[string]interface{}
+	if err := json.Unmarshal([]byte(avrojson.LogDataSchema), &schema); err != nil {
+		return registry.Schema{}, req, false, err
+	}
+	latest := latestInferredTypes(subject)
+	for _, f := range schema["fields"].([]interface{}) {
+		field := f.(map[string]interface{})
+		name, _ := field["name"].(string)
+		var value *interface{}
+		switch name {
+		case "metadata":
+			value = &req.LogBody.Metadata
+		case "domainData":
+			value = &req.LogBody.DomainData
+		default:
+			continue
+		}
+		in := avrojson.NewInferrer(name)
+		builtin, _ := json.Marshal(field["type"])
+		if prior, ok := latest[name]; ok {
+			// A field left at the built-in map was not inferred, and
+			// types edited by hand are replaced rather than merged.
+			if text, _ := json.Marshal(prior); !bytes.Equal(text, builtin) {
+				in.ObserveSchema(prior)
+			}
+		}
+		in.Observe(nil)
+		var decoded interface{}
+		if *value != nil {
+			// Go values, such as the ints of warm-up logs, are typed as
+			// the JSON they would be sent as.
+			text, err := json.Marshal(*value)
+			if err != nil {
+				return registry.Schema{}, req, false, err
+			}
+			dec := json.NewDecoder(bytes.NewReader(text))
+			dec.UseNumber()
+			if err := dec.Decode(&decoded); err != nil {
+				return registry.Schema{}, req, false, err
+			}
+			in.Observe(decoded)
+		}
+		if typ := in.Type(); typ != "null" {
+			field["type"] = typ
+		}
+		*value = in.Convert(decoded)
+	}
+	text, err := json.Marshal(schema)
+	if err != nil {
+		return registry.Schema{}, req, false, err
+	}
+	s, _, err := schemaRegistry.Register(subject, string(text))
+	if err != nil {
+		return registry.Schema{}, req, false, fmt.Errorf("register inferred body schema: %w", err)
+	}
+	return s, req, true, nil
+}
+
+// latestInferredTypes returns the field types of the latest version of
+// subject by field name, or nil before the first.
+func latestInferredTypes(subject string) map[string]interface{} {
+	s, err := resolveSchema(subject, 0)
+	if err != nil {
+		return nil
+	}
+	var schema struct {
+		Fields []struct {
+			Name string      `json:"name"`
+			Type interface{} `json:"type"`
+		} `json:"fields"`
+	}
+	if err := json.Unmarshal([]byte(s.Schema), &schema); err != nil {
+		return nil
+	}
+	types := make(map[string]interface{}, len(schema.Fields))
+	for _, f := range schema.Fields {
+		types[f.Name] = f.Type
+	}
+	return types
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func userActionRequest(domain map[string]interface{}) LogRequest {
+	req := warmupPayload(1)
+	req.LogType = "USER_ACTION"
+	req.LogBody.Logtype = "USER_ACTION"
+	req.LogBody.DomainData = domain
+	return req
+}
+
+func TestInferredBodyTypes(t *testing.T) {
+	r := newSchemaTestEngine(t)
+	r.POST("/log", logHandler)
+	domain := map[string]interface{}{"login_method": "password", "success": true, "duration_ms": 42, "score": 0.5,
+		"device": map[string]interface{}{"os": "ios", "build": 1234}}
+	req := userActionRequest(domain)
+
+	plain, err := encodeLogRequest(req)
+	if err != nil {
+		t.Fatalf("Failed to encode log: %v", err)
+	}
+	bodyTypes = bodyTypesInfer
+	defer func() { bodyTypes = bodyTypesStrings }()
+
+	typed, err := encodeLogRequest(req)
+	if err != nil {
+		t.Fatalf("Failed to encode log with inferred types: %v", err)
+	}
+	s, err := resolveSchema(inferredSubject("USER_ACTION"), 0)
+	if err != nil || typed.LogDataSchema != s.Schema {
+		t.Fatalf("expected the body encoded with the registered inferred schema, got %v", err)
+	}
+	for _, part := range []string{`"duration_ms":42`, `"success":true`, `"build":1234`} {
+		if !strings.Contains(string(typed.LogDataJSON), part) {
+			t.Errorf("expected %s in %s", part, typed.LogDataJSON)
+		}
+	}
+	if len(typed.LogData) >= len(plain.LogData) {
+		t.Errorf("expected typed log data to be smaller than the string maps: %d >= %d bytes", len(typed.LogData), len(plain.LogData))
+	}
+
+	// A body of the same shape reuses the version; a new field adds one.
+	versions := func() int {
+		sub, err := schemaRegistry.Subject(inferredSubject("USER_ACTION"))
+		if err != nil {
+			t.Fatalf("Failed to load subject: %v", err)
+		}
+		return len(sub.Versions)
+	}
+	if w := doJSON(r, http.MethodPost, "/log", req); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	before := versions()
+	if w := doJSON(r, http.MethodPost, "/log", req); w.Code != http.StatusOK || versions() != before {
+		t.Errorf("expected the same shape to keep version %d, got %d: %s", before, versions(), w.Body.String())
+	}
+	domain["retries"] = 2
+	if w := doJSON(r, http.MethodPost, "/log", userActionRequest(domain)); w.Code != http.StatusOK || versions() != before+1 {
+		t.Errorf("expected a new field to add a version, got %d: %s", versions(), w.Body.String())
+	}
+
+	// Versions merge the shapes before them: bodies lacking the new field
+	// or domainData fit the latest, a wider number adds a version, and the
+	// first shape still fits that.
+	delete(domain, "retries")
+	if w := doJSON(r, http.MethodPost, "/log", userActionRequest(domain)); w.Code != http.StatusOK || versions() != before+1 {
+		t.Errorf("expected a missing nullable field to keep version %d, got %d: %s", before+1, versions(), w.Body.String())
+	}
+	if w := doJSON(r, http.MethodPost, "/log", userActionRequest(nil)); w.Code != http.StatusOK || versions() != before+1 {
+		t.Errorf("expected a body without domainData to keep version %d, got %d: %s", before+1, versions(), w.Body.String())
+	}
+	domain["duration_ms"] = 42.5
+	if w := doJSON(r, http.MethodPost, "/log", userActionRequest(domain)); w.Code != http.StatusOK || versions() != before+2 {
+		t.Errorf("expected a double to widen the long in a new version, got %d: %s", versions(), w.Body.String())
+	}
+	domain["duration_ms"] = 42
+	if w := doJSON(r, http.MethodPost, "/log", userActionRequest(domain)); w.Code != http.StatusOK || versions() != before+2 {
+		t.Errorf("expected the first shape to fit the latest version, got %d: %s", versions(), w.Body.String())
+	}
+	latest, _ := resolveSchema(inferredSubject("USER_ACTION"), 0)
+	if !strings.Contains(latest.Schema, `{"name":"retries","type":["null","long"],"default":null}`) || !strings.Contains(latest.Schema, `"name":"duration_ms","type":"double"`) {
+		t.Errorf("expected a nullable retries and a double duration_ms, got %s", latest.Schema)
+	}
+
+	if _, err := parseBodyTypes("typed"); err == nil {
+		t.Error("expected an unknown mode to fail")
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Default request body limits. The client's "large" log is a few MiB,
+// OCF uploads to /logs/import are spooled to disk by the multipart reader,
+// and replicated files are streamed to disk as they arrive.
+const (
+	defaultMaxBodyBytes        = 16 << 20
+	defaultMaxImportBytes      = 256 << 20
+	defaultMaxReplicationBytes = 1 << 30
+)
+
+// bodyLimits caps request bodies before handlers read them. A body whose
+// Content-Length is over the limit is refused without reading it. Bodies of
+// unknown length (chunked HTTP/1.1, HTTP/2 and gRPC streams) are read up to
+// the limit and refused once they pass it, except on streaming routes,
+// whose handlers read the body themselves through http.MaxBytesReader and
+// report overruns with bodyTooLarge.
+type bodyLimits struct {
+	// max applies to every route; 0 disables the limit.
+	max int64
+	// routes override max for the routes they name, by gin full path.
+	routes map[string]int64
+	// streaming routes are not buffered.
+	streaming map[string]bool
+}
+
+func (l bodyLimits) limitFor(route string) int64 {
+	if limit, ok := l.routes[route]; ok {
+		return limit
+	}
+	return l.max
+}
+
+func (l bodyLimits) middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := l.limitFor(c.FullPath())
+		if limit <= 0 || c.Request.Body == nil || c.Request.Body == http.NoBody {
+			c.Next()
+			return
+		}
+		if c.Request.ContentLength > limit {
+			rejectBody(c, limit, c.Request.ContentLength)
+			return
+		}
+		if c.Request.ContentLength < 0 && !l.streaming[c.FullPath()] {
+			body, err := io.ReadAll(io.LimitReader(c.Request.Body, limit+1))
+			if err != nil {
+				respondError(c, http.StatusBadRequest, codeInvalidRequest, "Failed to read request body: "+err.Error())
+				return
+			}
+			if int64(len(body)) > limit {
+				rejectBody(c, limit, -1)
+				return
+			}
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+			c.Request.ContentLength = int64(len(body))
+			c.Next()
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		c.Next()
+	}
+}
+
+// bodyTooLarge answers 413 when err comes from reading past a streaming
+// route's limit.
+func bodyTooLarge(c *gin.Context, err error) bool {
+	var tooLarge *http.MaxBytesError
+	if !errors.As(err, &tooLarge) {
+		return false
+	}
+	rejectBody(c, tooLarge.Limit, c.Request.ContentLength)
+	return true
+}
+
+// rejectBody aborts with 413, or with a RESOURCE_EXHAUSTED status for gRPC
+// calls. contentLength is -1 when the client did not declare one.
+func rejectBody(c *gin.Context, limit, contentLength int64) {
+	requestLogger(c).Warn("Request body too large",
+		zap.String("path", c.Request.URL.Path),
+		zap.String("client_ip", c.ClientIP()),
+		zap.Int64("content_length", contentLength),
+		zap.Int64("limit_bytes", limit))
+
+	message := fmt.Sprintf("Request body exceeds the limit of %d bytes", limit)
+	if strings.HasPrefix(c.ContentType(), "application/grpc") {
+		writeGRPCStatus(c, grpcResourceExhausted, message)
+		c.Abort()
+		return
+	}
+	extra := gin.H{"limit_bytes": limit}
+	if contentLength >= 0 {
+		extra["content_length"] = contentLength
+	}
+	respondErrorWith(c, http.StatusRequestEntityTooLarge, apiError{Code: codeBodyTooLarge, Message: message}, extra)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// countingReader records how much of a body was read.
+type countingReader struct {
+	r    io.Reader
+	read int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.read += n
+	return n, err
+}
+
+func TestBodyLimits(t *testing.T) {
+	logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(bodyLimits{
+		max:       1024,
+		routes:    map[string]int64{"/upload": 4096},
+		streaming: map[string]bool{"/upload": true},
+	}.middleware())
+	echoLength := func(c *gin.Context) {
+		body, err := io.ReadAll(c.Request.Body)
+		if bodyTooLarge(c, err) {
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"bytes": len(body)})
+	}
+	r.POST("/log", echoLength)
+	r.POST("/upload", echoLength)
+
+	send := func(path string, size int, declared bool, contentType string) (*httptest.ResponseRecorder, *countingReader) {
+		body := &countingReader{r: strings.NewReader(strings.Repeat("x", size))}
+		req := httptest.NewRequest(http.MethodPost, path, body)
+		req.ContentLength = -1
+		if declared {
+			req.ContentLength = int64(size)
+		}
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w, body
+	}
+	var resp struct {
+		Bytes         int    `json:"bytes"`
+		Error         string `json:"error"`
+		LimitBytes    int64  `json:"limit_bytes"`
+		ContentLength *int64 `json:"content_length"`
+	}
+
+	// A declared length over the limit is refused without reading.
+	w, body := send("/log", 2000, true, "application/json")
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413, got %d: %s", w.Code, w.Body.String())
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.LimitBytes != 1024 || resp.ContentLength == nil || *resp.ContentLength != 2000 || resp.Error == "" {
+		t.Errorf("unexpected 413 body: %s", w.Body.String())
+	}
+	if body.read != 0 {
+		t.Errorf("expected the body not to be read, read %d bytes", body.read)
+	}
+
+	// Bodies of unknown length are read no further than the limit.
+	w, body = send("/log", 1<<20, false, "application/json")
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413 for a chunked body, got %d", w.Code)
+	}
+	if body.read > 1024+4096 {
+		t.Errorf("expected reading to stop near the limit, read %d bytes", body.read)
+	}
+	resp.ContentLength = nil
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.ContentLength != nil {
+		t.Errorf("expected no content_length for a chunked body: %s", w.Body.String())
+	}
+
+	for _, declared := range []bool{true, false} {
+		if w, _ := send("/log", 1024, declared, "application/json"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"bytes":1024`) {
+			t.Errorf("declared=%v: expected a body at the limit to pass, got %d: %s", declared, w.Code, w.Body.String())
+		}
+	}
+
+	// Streaming routes have their own limit and report overruns themselves.
+	if w, _ := send("/upload", 3000, false, "application/octet-stream"); w.Code != http.StatusOK {
+		t.Errorf("expected the route limit to apply, got %d: %s", w.Code, w.Body.String())
+	}
+	if w, _ := send("/upload", 5000, false, "application/octet-stream"); w.Code != http.StatusRequestEntityTooLarge || !strings.Contains(w.Body.String(), `"limit_bytes":4096`) {
+		t.Errorf("expected 413 from the streaming route, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// gRPC callers get a status instead of a JSON body.
+	w, _ = send("/log", 2000, false, "application/grpc")
+	if w.Header().Get("Grpc-Status") != "8" {
+		t.Errorf("expected RESOURCE_EXHAUSTED, got status %q", w.Header().Get("Grpc-Status"))
+	}
+}
@@ -0,0 +1,205 @@
+// Package broker is a small in-memory message broker used by the
+// single-binary demo mode. It offers NATS/Kafka-like topics with consumer
+// groups: every group receives each published message once, and consumers
+// that share a group split the messages between them.
+package broker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrClosed is returned when publishing to a closed broker.
+var ErrClosed = errors.New("broker: closed")
+
+// Message is a single published record.
+type Message struct {
+	ID          uint64
+	Topic       string
+	Key         string
+	Value       []byte
+	Headers     map[string]string
+	PublishedAt time.Time
+}
+
+// TopicStats summarizes the traffic of one topic.
+type TopicStats struct {
+	Published uint64            `json:"published"`
+	Bytes     uint64            `json:"bytes"`
+	Groups    map[string]int    `json:"group_queue_depth"`
+	Delivered map[string]uint64 `json:"group_delivered"`
+}
+
+type group struct {
+	ch        chan Message
+	delivered atomic.Uint64
+	closeOnce sync.Once
+}
+
+// close closes the queue; both Subscribe after Close and Close itself may
+// get here for a group.
+func (g *group) close() {
+	g.closeOnce.Do(func() { close(g.ch) })
+}
+
+type topic struct {
+	published atomic.Uint64
+	bytes     atomic.Uint64
+	groups    map[string]*group
+}
+
+// Broker routes messages from publishers to consumer groups.
+type Broker struct {
+	bufferSize int
+	nextID     atomic.Uint64
+
+	mu     sync.RWMutex
+	topics map[string]*topic
+	closed bool
+
+	// done is closed by Close to wake publishers waiting for queue space;
+	// inflight counts publishers that may still send, so Close only closes
+	// the group channels once none can.
+	done     chan struct{}
+	inflight sync.WaitGroup
+}
+
+// New creates a broker whose consumer group queues hold bufferSize messages.
+// Publishers block once a group's queue is full.
+func New(bufferSize int) *Broker {
+	if bufferSize <= 0 {
+		bufferSize = 1
+	}
+	return &Broker{bufferSize: bufferSize, topics: make(map[string]*topic), done: make(chan struct{})}
+}
+
+func (b *Broker) topicLocked(name string) *topic {
+	t, ok := b.topics[name]
+	if !ok {
+		t = &topic{groups: make(map[string]*group)}
+		b.topics[name] = t
+	}
+	return t
+}
+
+// Subscribe joins a consumer group on a topic. Messages published before the
+// group existed are not replayed. The channel is closed by Close.
+func (b *Broker) Subscribe(topicName, groupName string) <-chan Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t := b.topicLocked(topicName)
+	g, ok := t.groups[groupName]
+	if !ok {
+		g = &group{ch: make(chan Message, b.bufferSize)}
+		if b.closed {
+			g.close()
+		}
+		t.groups[groupName] = g
+	}
+	return g.ch
+}
+
+// Ack records that a consumer of groupName finished processing msg.
+func (b *Broker) Ack(groupName string, msg Message) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if t, ok := b.topics[msg.Topic]; ok {
+		if g, ok := t.groups[groupName]; ok {
+			g.delivered.Add(1)
+		}
+	}
+}
+
+// Publish delivers msg to every consumer group of the topic, waiting for
+// queue space until ctx is done or the broker is closed. The wait happens
+// outside the broker lock, so a full queue never holds up Subscribe, Stats or
+// other topics. Topics without groups accept and drop.
+func (b *Broker) Publish(ctx context.Context, topicName string, msg Message) error {
+	b.mu.RLock()
+	if b.closed {
+		b.mu.RUnlock()
+		return ErrClosed
+	}
+
+	msg.ID = b.nextID.Add(1)
+	msg.Topic = topicName
+	msg.PublishedAt = time.Now()
+
+	t, ok := b.topics[topicName]
+	if !ok {
+		b.mu.RUnlock()
+		return nil
+	}
+	t.published.Add(1)
+	t.bytes.Add(uint64(len(msg.Value)))
+
+	queues := make([]chan Message, 0, len(t.groups))
+	for _, g := range t.groups {
+		queues = append(queues, g.ch)
+	}
+	b.inflight.Add(1)
+	b.mu.RUnlock()
+	defer b.inflight.Done()
+
+	for _, ch := range queues {
+		select {
+		case ch <- msg:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-b.done:
+			return ErrClosed
+		}
+	}
+	return nil
+}
+
+// Stats reports per-topic counters and queue depths.
+func (b *Broker) Stats() map[string]TopicStats {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	out := make(map[string]TopicStats, len(b.topics))
+	for name, t := range b.topics {
+		s := TopicStats{
+			Published: t.published.Load(),
+			Bytes:     t.bytes.Load(),
+			Groups:    make(map[string]int, len(t.groups)),
+			Delivered: make(map[string]uint64, len(t.groups)),
+		}
+		for gname, g := range t.groups {
+			s.Groups[gname] = len(g.ch)
+			s.Delivered[gname] = g.delivered.Load()
+		}
+		out[name] = s
+	}
+	return out
+}
+
+// Close stops accepting messages and closes every subscription channel once
+// its queued messages have been drained by consumers. Publishers still
+// waiting for queue space return ErrClosed.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	b.closed = true
+	close(b.done)
+	b.mu.Unlock()
+
+	b.inflight.Wait()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, t := range b.topics {
+		for _, g := range t.groups {
+			g.close()
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package broker
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPublishFansOutToGroups(t *testing.T) {
+	b := New(8)
+	indexer := b.Subscribe("logs", "indexer")
+	archiver := b.Subscribe("logs", "archiver")
+
+	for i := 0; i < 3; i++ {
+		if err := b.Publish(context.Background(), "logs", Message{Key: "p", Value: []byte{byte(i)}}); err != nil {
+			t.Fatalf("Publish failed: %v", err)
+		}
+	}
+
+	for _, ch := range []<-chan Message{indexer, archiver} {
+		for i := 0; i < 3; i++ {
+			msg := <-ch
+			if msg.Value[0] != byte(i) {
+				t.Errorf("expected message %d in order, got %d", i, msg.Value[0])
+			}
+			if msg.Topic != "logs" || msg.ID == 0 {
+				t.Errorf("expected topic and ID to be set, got %+v", msg)
+			}
+		}
+	}
+
+	stats := b.Stats()["logs"]
+	if stats.Published != 3 || stats.Bytes != 3 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestGroupMembersShareMessages(t *testing.T) {
+	b := New(100)
+	first := b.Subscribe("logs", "workers")
+	second := b.Subscribe("logs", "workers")
+	if first != second {
+		t.Fatal("expected consumers of the same group to share a queue")
+	}
+
+	for i := 0; i < 50; i++ {
+		b.Publish(context.Background(), "logs", Message{Value: []byte("x")})
+	}
+	b.Close()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	seen := 0
+	for _, ch := range []<-chan Message{first, second} {
+		wg.Add(1)
+		go func(ch <-chan Message) {
+			defer wg.Done()
+			for msg := range ch {
+				b.Ack("workers", msg)
+				mu.Lock()
+				seen++
+				mu.Unlock()
+			}
+		}(ch)
+	}
+	wg.Wait()
+
+	if seen != 50 {
+		t.Errorf("expected 50 messages across the group, got %d", seen)
+	}
+	if delivered := b.Stats()["logs"].Delivered["workers"]; delivered != 50 {
+		t.Errorf("expected 50 acks, got %d", delivered)
+	}
+}
+
+func TestPublishRespectsContextWhenFull(t *testing.T) {
+	b := New(1)
+	b.Subscribe("logs", "slow")
+
+	if err := b.Publish(context.Background(), "logs", Message{}); err != nil {
+		t.Fatalf("first publish failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := b.Publish(ctx, "logs", Message{}); err != context.DeadlineExceeded {
+		t.Errorf("expected deadline exceeded on full queue, got %v", err)
+	}
+}
+
+func TestPublishAfterClose(t *testing.T) {
+	b := New(1)
+	b.Close()
+	if err := b.Publish(context.Background(), "logs", Message{}); err != ErrClosed {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+}
+
+func TestFullQueueDoesNotBlockOtherCalls(t *testing.T) {
+	b := New(1)
+	b.Subscribe("logs", "slow")
+	if err := b.Publish(context.Background(), "logs", Message{}); err != nil {
+		t.Fatalf("first publish failed: %v", err)
+	}
+
+	blocked := make(chan error, 1)
+	go func() { blocked <- b.Publish(context.Background(), "logs", Message{}) }()
+
+	// Subscribe takes the write lock, so it only returns while the blocked
+	// publisher is not holding the read lock.
+	subscribed := make(chan struct{})
+	go func() {
+		b.Subscribe("metrics", "late")
+		close(subscribed)
+	}()
+	select {
+	case <-subscribed:
+	case <-time.After(time.Second):
+		t.Fatal("Subscribe waited behind a publisher blocked on a full queue")
+	}
+
+	b.Close()
+	if err := <-blocked; err != ErrClosed {
+		t.Errorf("expected the blocked publisher to get ErrClosed, got %v", err)
+	}
+}
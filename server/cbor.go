@@ -0,0 +1,15 @@
+package main
+
+import "github.com/ugorji/go/codec"
+
+// CBOR (RFC 8949) is the second schema-less binary baseline next to
+// MessagePack, from the same codec library and naming struct fields by
+// their json tags too.
+var cborHandle = &codec.CborHandle{}
+
+// marshalCBOR encodes v as CBOR.
+func marshalCBOR(v interface{}) ([]byte, error) {
+	var out []byte
+	err := codec.NewEncoderBytes(&out, cborHandle).Encode(v)
+	return out, err
+}
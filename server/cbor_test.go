@@ -0,0 +1,31 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ugorji/go/codec"
+)
+
+func TestMarshalCBOR(t *testing.T) {
+	data := generateTestRecords(3)
+	encoded, err := marshalCBOR(data)
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+	// An array of three items, then a map of the seven fields.
+	if encoded[0] != 0x83 || encoded[1] != 0xa7 {
+		t.Errorf("unexpected CBOR header %x", encoded[:2])
+	}
+	var decoded []map[string]interface{}
+	if err := codec.NewDecoderBytes(encoded, cborHandle).Decode(&decoded); err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if len(decoded) != 3 || decoded[1]["email"] != data[1].Email {
+		t.Errorf("expected json tag names and all records, got %v", decoded)
+	}
+	plain, _ := json.Marshal(data)
+	if len(encoded) >= len(plain) {
+		t.Errorf("CBOR is %d bytes, JSON %d", len(encoded), len(plain))
+	}
+}
@@ -0,0 +1,635 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// schemaFile is one input .avsc file.
+type schemaFile struct {
+	path   string
+	schema string
+}
+
+// avroType is a parsed schema node. Named types are shared between every
+// reference to them.
+type avroType struct {
+	kind    string // primitive name, record, enum, fixed, array, map or union
+	name    string // full Avro name of named types
+	goName  string
+	logical string
+	doc     string
+
+	fields   []avroField
+	symbols  []string
+	size     int
+	items    *avroType // array items and map values
+	branches []*avroType
+}
+
+type avroField struct {
+	name   string
+	goName string
+	doc    string
+	typ    *avroType
+}
+
+var primitives = map[string]bool{
+	"null": true, "boolean": true, "int": true, "long": true,
+	"float": true, "double": true, "bytes": true, "string": true,
+}
+
+// options configures generate.
+type options struct {
+	pkg  string
+	tags []string // struct tag keys set to each field's Avro name
+}
+
+// defaultTags matches the avro tag hamba/avro reads and the json tag
+// gogen-avro emits, so the structs work with either library.
+var defaultTags = []string{"avro", "json"}
+
+// parseTags parses the -tags flag, a comma-separated list of struct tag
+// keys.
+func parseTags(s string) ([]string, error) {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, key := range strings.Split(s, ",") {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		for _, r := range key {
+			if r <= ' ' || r == ':' || r == '"' || r == '`' || r == 0x7f {
+				return nil, fmt.Errorf("invalid struct tag key %q", key)
+			}
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("duplicate struct tag key %q", key)
+		}
+		seen[key] = true
+		tags = append(tags, key)
+	}
+	return tags, nil
+}
+
+type generator struct {
+	tags    []string
+	named   map[string]*avroType
+	goNames map[string]string // Go name → Avro name, to detect clashes
+	order   []*avroType       // named types in definition order
+	roots   map[*avroType]string
+}
+
+// generate renders Go source for the named types defined in files. Later
+// files may refer to types defined by earlier ones.
+func generate(opts options, files []schemaFile) ([]byte, error) {
+	g := &generator{
+		tags:    opts.tags,
+		named:   make(map[string]*avroType),
+		goNames: make(map[string]string),
+		roots:   make(map[*avroType]string),
+	}
+	for _, f := range files {
+		var root interface{}
+		if err := json.Unmarshal([]byte(f.schema), &root); err != nil {
+			return nil, fmt.Errorf("%s: %w", f.path, err)
+		}
+		t, err := g.parse(root, "")
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.path, err)
+		}
+		if t.kind != "record" {
+			return nil, fmt.Errorf("%s: top-level schema must be a record, got %s", f.path, t.kind)
+		}
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, []byte(f.schema)); err != nil {
+			return nil, fmt.Errorf("%s: %w", f.path, err)
+		}
+		g.roots[t] = compact.String()
+	}
+
+	var body bytes.Buffer
+	for _, t := range g.order {
+		switch t.kind {
+		case "record":
+			g.writeRecord(&body, t)
+		case "enum":
+			g.writeEnum(&body, t)
+		case "fixed":
+			g.writeFixed(&body, t)
+		}
+	}
+
+	var out bytes.Buffer
+	out.WriteString("// Code generated by avrogen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&out, "package %s\n\nimport (\n\t\"fmt\"\n", opts.pkg)
+	if bytes.Contains(body.Bytes(), []byte("big.")) {
+		out.WriteString("\t\"math/big\"\n")
+	}
+	if bytes.Contains(body.Bytes(), []byte("time.")) {
+		out.WriteString("\t\"time\"\n")
+	}
+	out.WriteString("\n\t\"github.com/homveloper/exp-avro-json/server/pkg/avrojson\"\n)\n\n")
+	out.Write(body.Bytes())
+
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("generated code does not parse: %w\n%s", err, out.Bytes())
+	}
+	return src, nil
+}
+
+func (g *generator) parse(v interface{}, namespace string) (*avroType, error) {
+	switch s := v.(type) {
+	case string:
+		if primitives[s] {
+			return &avroType{kind: s}, nil
+		}
+		if t, ok := g.named[qualify(s, namespace)]; ok {
+			return t, nil
+		}
+		if t, ok := g.named[s]; ok {
+			return t, nil
+		}
+		return nil, fmt.Errorf("unknown type %q", s)
+
+	case []interface{}:
+		t := &avroType{kind: "union"}
+		for _, b := range s {
+			branch, err := g.parse(b, namespace)
+			if err != nil {
+				return nil, err
+			}
+			t.branches = append(t.branches, branch)
+		}
+		return t, nil
+
+	case map[string]interface{}:
+		kind, ok := s["type"].(string)
+		if !ok {
+			return g.parse(s["type"], namespace)
+		}
+		logical, _ := s["logicalType"].(string)
+		switch kind {
+		case "record", "error", "enum", "fixed":
+			return g.parseNamed(s, kind, logical, namespace)
+		case "array", "map":
+			key := "items"
+			if kind == "map" {
+				key = "values"
+			}
+			items, err := g.parse(s[key], namespace)
+			if err != nil {
+				return nil, err
+			}
+			return &avroType{kind: kind, items: items}, nil
+		}
+		if !primitives[kind] {
+			return g.parse(kind, namespace)
+		}
+		return &avroType{kind: kind, logical: logical}, nil
+	}
+	return nil, fmt.Errorf("unsupported schema node %v", v)
+}
+
+func (g *generator) parseNamed(s map[string]interface{}, kind, logical, namespace string) (*avroType, error) {
+	short, _ := s["name"].(string)
+	if short == "" {
+		return nil, fmt.Errorf("%s without a name", kind)
+	}
+	if ns, ok := s["namespace"].(string); ok && ns != "" {
+		namespace = ns
+	}
+	if i := strings.LastIndex(short, "."); i >= 0 {
+		namespace, short = short[:i], short[i+1:]
+	}
+	if kind == "error" {
+		kind = "record"
+	}
+	t := &avroType{kind: kind, name: qualify(short, namespace), goName: exportName(short), logical: logical}
+	t.doc, _ = s["doc"].(string)
+	if _, ok := g.named[t.name]; ok {
+		return nil, fmt.Errorf("type %s defined twice", t.name)
+	}
+	if other, ok := g.goNames[t.goName]; ok {
+		return nil, fmt.Errorf("types %s and %s both map to Go name %s", other, t.name, t.goName)
+	}
+	// Register before the fields so recursive references resolve.
+	g.named[t.name] = t
+	g.goNames[t.goName] = t.name
+	g.order = append(g.order, t)
+
+	switch kind {
+	case "enum":
+		symbols, _ := s["symbols"].([]interface{})
+		for _, sym := range symbols {
+			name, _ := sym.(string)
+			t.symbols = append(t.symbols, name)
+		}
+	case "fixed":
+		size, _ := s["size"].(float64)
+		t.size = int(size)
+	case "record":
+		fields, _ := s["fields"].([]interface{})
+		seen := make(map[string]bool)
+		for _, f := range fields {
+			field, _ := f.(map[string]interface{})
+			name, _ := field["name"].(string)
+			typ, err := g.parse(field["type"], namespace)
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %w", t.name, name, err)
+			}
+			goName := exportName(name)
+			if seen[goName] {
+				return nil, fmt.Errorf("%s: fields collide on Go name %s", t.name, goName)
+			}
+			seen[goName] = true
+			doc, _ := field["doc"].(string)
+			t.fields = append(t.fields, avroField{name: name, goName: goName, doc: doc, typ: typ})
+		}
+	}
+	return t, nil
+}
+
+func qualify(name, namespace string) string {
+	if strings.Contains(name, ".") || namespace == "" {
+		return name
+	}
+	return namespace + "." + name
+}
+
+// initialisms are kept upper case in Go names, as golint expects.
+var initialisms = map[string]bool{
+	"ID": true, "URL": true, "URI": true, "UUID": true, "IP": true, "JSON": true,
+	"HTTP": true, "API": true, "SQL": true, "TCP": true, "UDP": true,
+}
+
+// exportName converts an Avro name (camelCase, snake_case or SCREAMING) to
+// an exported Go identifier.
+func exportName(name string) string {
+	var words []string
+	var word []rune
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, string(word))
+			word = word[:0]
+		}
+	}
+	runes := []rune(name)
+	for i, r := range runes {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			flush()
+		case unicode.IsUpper(r) && i > 0 && unicode.IsLower(runes[i-1]):
+			flush()
+			word = append(word, r)
+		default:
+			word = append(word, r)
+		}
+	}
+	flush()
+
+	var b strings.Builder
+	for _, w := range words {
+		upper := strings.ToUpper(w)
+		if initialisms[upper] {
+			b.WriteString(upper)
+			continue
+		}
+		lower := []rune(w)
+		if strings.ToUpper(w) == w {
+			lower = []rune(strings.ToLower(w))
+		}
+		lower[0] = unicode.ToUpper(lower[0])
+		b.WriteString(string(lower))
+	}
+	out := b.String()
+	if out == "" || unicode.IsDigit([]rune(out)[0]) {
+		out = "X" + out
+	}
+	return out
+}
+
+// nullable returns the non-null branch of a ["null", T] union.
+func (t *avroType) nullable() *avroType {
+	if t.kind != "union" || len(t.branches) != 2 {
+		return nil
+	}
+	switch {
+	case t.branches[0].kind == "null" && t.branches[1].kind != "null":
+		return t.branches[1]
+	case t.branches[1].kind == "null" && t.branches[0].kind != "null":
+		return t.branches[0]
+	}
+	return nil
+}
+
+// goavroLogicalNames are the logical types goavro names <type>.<logical>
+// in unions; it ignores the others, such as uuid.
+var goavroLogicalNames = map[string]bool{
+	"int.date":              true,
+	"int.time-millis":       true,
+	"long.time-micros":      true,
+	"long.timestamp-millis": true,
+	"long.timestamp-micros": true,
+	"bytes.decimal":         true,
+}
+
+// unionKey is the key goavro uses for a union branch of type t.
+func (t *avroType) unionKey() string {
+	if t.name != "" {
+		return t.name
+	}
+	if key := t.kind + "." + t.logical; goavroLogicalNames[key] {
+		return key
+	}
+	return t.kind
+}
+
+// goType returns the Go type of t. It is also the type goavro produces
+// when decoding t, except for records, enums, fixed types and containers,
+// which are converted.
+func goType(t *avroType) string {
+	switch t.kind {
+	case "null":
+		return "interface{}"
+	case "boolean":
+		return "bool"
+	case "int":
+		switch t.logical {
+		case "date":
+			return "time.Time"
+		case "time-millis":
+			return "time.Duration"
+		}
+		return "int32"
+	case "long":
+		switch t.logical {
+		case "timestamp-millis", "timestamp-micros", "local-timestamp-millis", "local-timestamp-micros":
+			return "time.Time"
+		case "time-micros":
+			return "time.Duration"
+		}
+		return "int64"
+	case "float":
+		return "float32"
+	case "double":
+		return "float64"
+	case "bytes":
+		if t.logical == "decimal" {
+			return "*big.Rat"
+		}
+		return "[]byte"
+	case "string":
+		if t.logical == "uuid" {
+			return "avrojson.UUID"
+		}
+		return "string"
+	case "fixed":
+		if t.logical == "decimal" {
+			return "*big.Rat"
+		}
+		return t.goName
+	case "record", "enum":
+		return t.goName
+	case "array":
+		return "[]" + goType(t.items)
+	case "map":
+		return "map[string]" + goType(t.items)
+	case "union":
+		if inner := t.nullable(); inner != nil {
+			if isNilable(goType(inner)) {
+				return goType(inner)
+			}
+			return "*" + goType(inner)
+		}
+		return "interface{}"
+	}
+	return "interface{}"
+}
+
+func isNilable(goType string) bool {
+	return strings.HasPrefix(goType, "[]") || strings.HasPrefix(goType, "map[") ||
+		strings.HasPrefix(goType, "*") || goType == "interface{}"
+}
+
+func (g *generator) writeRecord(w *bytes.Buffer, t *avroType) {
+	writeDoc(w, "", fmt.Sprintf("%s is generated from the Avro record %s.", t.goName, t.name), t.doc)
+	fmt.Fprintf(w, "type %s struct {\n", t.goName)
+	for _, f := range t.fields {
+		if f.doc != "" {
+			writeDoc(w, "\t", f.doc, "")
+		}
+		fmt.Fprintf(w, "\t%s %s%s\n", f.goName, goType(f.typ), g.fieldTag(f))
+	}
+	w.WriteString("}\n\n")
+
+	if schema, ok := g.roots[t]; ok {
+		fmt.Fprintf(w, "// %sSchema is the Avro schema %s was generated from.\n", t.goName, t.goName)
+		fmt.Fprintf(w, "const %sSchema = %s\n\n", t.goName, quoteSchema(schema))
+		fmt.Fprintf(w, `// MarshalAvro encodes r as Avro binary with %[1]sSchema.
+func (r *%[1]s) MarshalAvro() ([]byte, error) {
+	codec, err := avrojson.DefaultCache.Get(%[1]sSchema)
+	if err != nil {
+		return nil, err
+	}
+	return codec.EncodeNative(r.AvroNative())
+}
+
+// UnmarshalAvro decodes Avro binary written with %[1]sSchema into r.
+func (r *%[1]s) UnmarshalAvro(data []byte) error {
+	codec, err := avrojson.DefaultCache.Get(%[1]sSchema)
+	if err != nil {
+		return err
+	}
+	native, err := codec.DecodeNative(data)
+	if err != nil {
+		return err
+	}
+	m, ok := native.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%[1]s: expected a record, got %%T", native)
+	}
+	return r.FromAvroNative(m)
+}
+
+`, t.goName)
+	}
+
+	fmt.Fprintf(w, "// AvroNative returns r in goavro's native form.\n")
+	fmt.Fprintf(w, "func (r %s) AvroNative() map[string]interface{} {\n\treturn map[string]interface{}{\n", t.goName)
+	for _, f := range t.fields {
+		fmt.Fprintf(w, "\t\t%q: %s,\n", f.name, encodeExpr(f.typ, "r."+f.goName, 0))
+	}
+	w.WriteString("\t}\n}\n\n")
+
+	fmt.Fprintf(w, "// FromAvroNative fills r from goavro's native form of the record.\n")
+	fmt.Fprintf(w, "func (r *%s) FromAvroNative(m map[string]interface{}) error {\n", t.goName)
+	for _, f := range t.fields {
+		writeDecode(w, f.typ, "r."+f.goName, fmt.Sprintf("m[%q]", f.name), t.name+"."+f.name, 0)
+	}
+	w.WriteString("\treturn nil\n}\n\n")
+}
+
+// fieldTag returns the struct tag of f, with every configured key set to
+// its Avro name.
+func (g *generator) fieldTag(f avroField) string {
+	if len(g.tags) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(g.tags))
+	for i, key := range g.tags {
+		pairs[i] = fmt.Sprintf("%s:%q", key, f.name)
+	}
+	return " `" + strings.Join(pairs, " ") + "`"
+}
+
+func (g *generator) writeEnum(w *bytes.Buffer, t *avroType) {
+	writeDoc(w, "", fmt.Sprintf("%s is generated from the Avro enum %s.", t.goName, t.name), t.doc)
+	fmt.Fprintf(w, "type %s string\n\n", t.goName)
+	if len(t.symbols) > 0 {
+		w.WriteString("const (\n")
+		for _, sym := range t.symbols {
+			fmt.Fprintf(w, "\t%s%s %s = %q\n", t.goName, exportName(sym), t.goName, sym)
+		}
+		w.WriteString(")\n\n")
+	}
+	quoted := make([]string, len(t.symbols))
+	for i, sym := range t.symbols {
+		quoted[i] = strconv.Quote(sym)
+	}
+	fmt.Fprintf(w, "// AvroSymbols lists the symbols of %s in schema order.\n", t.goName)
+	fmt.Fprintf(w, "func (%s) AvroSymbols() []string {\n\treturn []string{%s}\n}\n\n", t.goName, strings.Join(quoted, ", "))
+}
+
+func (g *generator) writeFixed(w *bytes.Buffer, t *avroType) {
+	if t.logical == "decimal" {
+		return
+	}
+	writeDoc(w, "", fmt.Sprintf("%s is generated from the Avro fixed type %s.", t.goName, t.name), t.doc)
+	fmt.Fprintf(w, "type %s [%d]byte\n\n", t.goName, t.size)
+}
+
+func writeDoc(w *bytes.Buffer, indent, first, rest string) {
+	lines := []string{first}
+	if rest != "" {
+		lines = append(lines, strings.Split(rest, "\n")...)
+	}
+	for _, line := range lines {
+		fmt.Fprintf(w, "%s// %s\n", indent, strings.TrimSpace(line))
+	}
+}
+
+func quoteSchema(schema string) string {
+	if strings.Contains(schema, "`") {
+		return strconv.Quote(schema)
+	}
+	return "`" + schema + "`"
+}
+
+// encodeExpr returns an expression converting the Go value v of type t to
+// goavro's native form.
+func encodeExpr(t *avroType, v string, depth int) string {
+	d := strconv.Itoa(depth)
+	switch t.kind {
+	case "enum":
+		return "string(" + v + ")"
+	case "fixed":
+		if t.logical == "decimal" {
+			return v
+		}
+		return v + "[:]"
+	case "string":
+		if t.logical == "uuid" {
+			return v + ".String()"
+		}
+	case "record":
+		return v + ".AvroNative()"
+	case "array":
+		return fmt.Sprintf("func() []interface{} {\nout := make([]interface{}, len(%[1]s))\nfor i%[2]s, x%[2]s := range %[1]s {\nout[i%[2]s] = %[3]s\n}\nreturn out\n}()",
+			v, d, encodeExpr(t.items, "x"+d, depth+1))
+	case "map":
+		return fmt.Sprintf("func() map[string]interface{} {\nout := make(map[string]interface{}, len(%[1]s))\nfor k%[2]s, x%[2]s := range %[1]s {\nout[k%[2]s] = %[3]s\n}\nreturn out\n}()",
+			v, d, encodeExpr(t.items, "x"+d, depth+1))
+	case "union":
+		inner := t.nullable()
+		if inner == nil {
+			return v
+		}
+		value := v
+		if !isNilable(goType(inner)) {
+			value = "(*" + v + ")"
+		}
+		return fmt.Sprintf("func() interface{} {\nif %s == nil {\nreturn nil\n}\nreturn map[string]interface{}{%q: %s}\n}()",
+			v, inner.unionKey(), encodeExpr(inner, value, depth+1))
+	}
+	return v
+}
+
+// writeDecode writes statements assigning the native value src, of type t,
+// to the Go location target.
+func writeDecode(w *bytes.Buffer, t *avroType, target, src, path string, depth int) {
+	d := strconv.Itoa(depth)
+	mismatch := func(want string) string {
+		return fmt.Sprintf("} else {\nreturn fmt.Errorf(\"%s: expected %s, got %%T\", %s)\n}\n", path, want, src)
+	}
+
+	if t.kind == "string" && t.logical == "uuid" {
+		fmt.Fprintf(w, "if v%[1]s, ok := %[2]s.(string); ok {\nif err := %[3]s.UnmarshalAvro(v%[1]s); err != nil {\nreturn fmt.Errorf(\"%[4]s: %%w\", err)\n}\n", d, src, target, path)
+		w.WriteString(mismatch("UUID string"))
+		return
+	}
+
+	switch t.kind {
+	case "null":
+		fmt.Fprintf(w, "%s = %s\n", target, src)
+	case "enum":
+		fmt.Fprintf(w, "if v%[1]s, ok := %[2]s.(string); ok {\n%[3]s = %[4]s(v%[1]s)\n", d, src, target, t.goName)
+		w.WriteString(mismatch("enum symbol"))
+	case "fixed":
+		if t.logical == "decimal" {
+			fmt.Fprintf(w, "if v%[1]s, ok := %[2]s.(*big.Rat); ok {\n%[3]s = v%[1]s\n", d, src, target)
+			w.WriteString(mismatch("*big.Rat"))
+			return
+		}
+		fmt.Fprintf(w, "if v%[1]s, ok := %[2]s.([]byte); ok && len(v%[1]s) == %[4]d {\ncopy(%[3]s[:], v%[1]s)\n", d, src, target, t.size)
+		w.WriteString(mismatch(fmt.Sprintf("%d bytes", t.size)))
+	case "record":
+		fmt.Fprintf(w, "if v%[1]s, ok := %[2]s.(map[string]interface{}); ok {\nif err := %[3]s.FromAvroNative(v%[1]s); err != nil {\nreturn err\n}\n", d, src, target)
+		w.WriteString(mismatch("record " + t.name))
+	case "array":
+		fmt.Fprintf(w, "if v%[1]s, ok := %[2]s.([]interface{}); ok {\n%[3]s = make(%[4]s, len(v%[1]s))\nfor i%[1]s, x%[1]s := range v%[1]s {\n", d, src, target, goType(t))
+		writeDecode(w, t.items, fmt.Sprintf("%s[i%s]", target, d), "x"+d, path+"[]", depth+1)
+		w.WriteString("}\n")
+		w.WriteString(mismatch("array"))
+	case "map":
+		fmt.Fprintf(w, "if v%[1]s, ok := %[2]s.(map[string]interface{}); ok {\n%[3]s = make(%[4]s, len(v%[1]s))\nfor k%[1]s, x%[1]s := range v%[1]s {\nvar e%[1]s %[5]s\n", d, src, target, goType(t), goType(t.items))
+		writeDecode(w, t.items, "e"+d, "x"+d, path+"{}", depth+1)
+		fmt.Fprintf(w, "%[1]s[k%[2]s] = e%[2]s\n}\n", target, d)
+		w.WriteString(mismatch("map"))
+	case "union":
+		inner := t.nullable()
+		if inner == nil {
+			fmt.Fprintf(w, "%s = %s\n", target, src)
+			return
+		}
+		fmt.Fprintf(w, "if %[2]s == nil {\n%[3]s = nil\n} else if u%[1]s, ok := %[2]s.(map[string]interface{}); ok && len(u%[1]s) == 1 {\nvar e%[1]s %[4]s\n", d, src, target, goType(inner))
+		writeDecode(w, inner, "e"+d, fmt.Sprintf("u%s[%q]", d, inner.unionKey()), path, depth+1)
+		if isNilable(goType(inner)) {
+			fmt.Fprintf(w, "%s = e%s\n", target, d)
+		} else {
+			fmt.Fprintf(w, "%s = &e%s\n", target, d)
+		}
+		w.WriteString(mismatch("union"))
+	default:
+		goT := goType(t)
+		fmt.Fprintf(w, "if v%[1]s, ok := %[2]s.(%[4]s); ok {\n%[3]s = v%[1]s\n", d, src, target, goT)
+		w.WriteString(mismatch(goT))
+	}
+}
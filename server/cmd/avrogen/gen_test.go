@@ -0,0 +1,133 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const testSchema = `{
+  "type": "record", "name": "Order", "namespace": "shop",
+  "doc": "An order placed in the shop.",
+  "fields": [
+    {"name": "order_id", "type": "string"},
+    {"name": "placedAt", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+    {"name": "status", "type": {"type": "enum", "name": "Status", "symbols": ["NEW", "SHIPPED"]}},
+    {"name": "hash", "type": {"type": "fixed", "name": "Hash", "size": 4}},
+    {"name": "items", "type": {"type": "array", "items": {"type": "record", "name": "Item", "fields": [
+      {"name": "sku", "type": "string"},
+      {"name": "price", "type": {"type": "bytes", "logicalType": "decimal", "precision": 10, "scale": 2}}
+    ]}}},
+    {"name": "discount", "type": ["null", "int"], "default": null},
+    {"name": "gift", "type": ["null", "Item"], "default": null},
+    {"name": "customer", "type": ["null", {"type": "string", "logicalType": "uuid"}], "default": null},
+    {"name": "extra", "type": ["string", "long"]}
+  ]
+}`
+
+func TestGenerate(t *testing.T) {
+	src, err := generate(options{pkg: "shop", tags: defaultTags}, []schemaFile{{path: "order.avsc", schema: testSchema}})
+	if err != nil {
+		t.Fatalf("Failed to generate: %v", err)
+	}
+	// Compare with gofmt's alignment collapsed to single spaces.
+	code := strings.Join(strings.Fields(string(src)), " ")
+	for _, want := range []string{
+		"// Code generated by avrogen. DO NOT EDIT.",
+		"package shop",
+		`"math/big"`,
+		`"time"`,
+		"// An order placed in the shop.",
+		"OrderID string `avro:\"order_id\" json:\"order_id\"`",
+		"PlacedAt time.Time",
+		"Status Status",
+		"Hash Hash",
+		"Items []Item",
+		"Discount *int32",
+		"Gift *Item",
+		"Extra interface{}",
+		"Price *big.Rat",
+		"type Status string",
+		`StatusNew Status = "NEW"`,
+		"type Hash [4]byte",
+		"const OrderSchema = ",
+		"func (r *Order) MarshalAvro() ([]byte, error)",
+		`map[string]interface{}{"shop.Item": (*r.Gift).AvroNative()}`,
+		`map[string]interface{}{"int": (*r.Discount)}`,
+		"Customer *avrojson.UUID",
+		`map[string]interface{}{"string": (*r.Customer).String()}`,
+		"if err := e0.UnmarshalAvro(v1); err != nil",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("generated code lacks %q", want)
+		}
+	}
+	if strings.Contains(code, "func (r *Item) MarshalAvro") {
+		t.Error("nested records should not get MarshalAvro")
+	}
+}
+
+func TestGenerateCrossFileReferences(t *testing.T) {
+	files := []schemaFile{
+		{path: "a.avsc", schema: `{"type":"record","name":"A","fields":[{"name":"x","type":"int"}]}`},
+		{path: "b.avsc", schema: `{"type":"record","name":"B","fields":[{"name":"a","type":"A"}]}`},
+	}
+	src, err := generate(options{pkg: "p", tags: defaultTags}, files)
+	if err != nil {
+		t.Fatalf("Failed to generate: %v", err)
+	}
+	if !strings.Contains(string(src), "A A `avro:\"a\"") {
+		t.Errorf("expected B.A to reference the generated A:\n%s", src)
+	}
+
+	if _, err := generate(options{pkg: "p", tags: defaultTags}, files[1:]); err == nil {
+		t.Error("Expected an error for an undefined type")
+	}
+	if _, err := generate(options{pkg: "p", tags: defaultTags}, []schemaFile{{path: "e.avsc", schema: `{"type":"enum","name":"E","symbols":["X"]}`}}); err == nil {
+		t.Error("Expected an error for a top-level enum")
+	}
+}
+
+func TestGenerateTags(t *testing.T) {
+	files := []schemaFile{{path: "a.avsc", schema: `{"type":"record","name":"A","fields":[{"name":"user_id","type":"string"}]}`}}
+	tags, err := parseTags("avro, bson")
+	if err != nil {
+		t.Fatalf("Failed to parse tags: %v", err)
+	}
+	src, err := generate(options{pkg: "p", tags: tags}, files)
+	if err != nil {
+		t.Fatalf("Failed to generate: %v", err)
+	}
+	if !strings.Contains(string(src), "UserID string `avro:\"user_id\" bson:\"user_id\"`") {
+		t.Errorf("expected avro and bson tags only:\n%s", src)
+	}
+
+	src, err = generate(options{pkg: "p"}, files)
+	if err != nil {
+		t.Fatalf("Failed to generate: %v", err)
+	}
+	if code := strings.Join(strings.Fields(string(src)), " "); !strings.Contains(code, "UserID string }") {
+		t.Errorf("expected no struct tags without tag keys:\n%s", src)
+	}
+
+	for _, bad := range []string{"av ro", "json,json", `a"b`, "a:b"} {
+		if _, err := parseTags(bad); err == nil {
+			t.Errorf("Expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestExportName(t *testing.T) {
+	cases := map[string]string{
+		"projectName": "ProjectName",
+		"log_type":    "LogType",
+		"userId":      "UserID",
+		"url":         "URL",
+		"HTTP_STATUS": "HTTPStatus",
+		"3d":          "X3d",
+	}
+	for in, want := range cases {
+		if got := exportName(in); got != want {
+			t.Errorf("exportName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"strings"
+)
+
+// Line colors of the HTML charts, cycled when there are more series.
+var palette = []string{"#4e79a7", "#f28e2b", "#e15759", "#76b7b2", "#59a14f", "#edc948", "#b07aa1", "#ff9da7", "#9c755f", "#bab0ac"}
+
+const (
+	chartWidth  = 640
+	chartHeight = 280
+	chartMargin = 48
+)
+
+// writeHTML writes the report as one self-contained page: the tables of
+// the Markdown report and an SVG line chart of each charted metric over
+// the sweep's sizes.
+func writeHTML(w io.Writer, out *benchOutput, baseline string) error {
+	var b strings.Builder
+	b.WriteString(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Benchmark report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 2px 8px; text-align: right; }
+th:first-child, td:first-child { text-align: left; }
+.legend span { margin-right: 1em; }
+</style></head><body>
+<h1>Benchmark report</h1>
+`)
+	if len(out.env) > 0 {
+		b.WriteString("<ul>\n")
+		for _, line := range out.env {
+			fmt.Fprintf(&b, "<li>%s</li>\n", html.EscapeString(line))
+		}
+		b.WriteString("</ul>\n")
+	}
+
+	sweeps, other := groupSweeps(out.benchmarks)
+	for _, s := range sweeps {
+		fmt.Fprintf(&b, "<h2>%s</h2>\n", html.EscapeString(s.title))
+		for _, m := range s.metrics(baseline) {
+			fmt.Fprintf(&b, "<h3>%s</h3>\n", html.EscapeString(m.title))
+			if m.chart {
+				svgChart(&b, s, m)
+			}
+			b.WriteString("<table>\n")
+			htmlRow(&b, "th", append([]string{s.dimension}, s.series...))
+			for _, x := range s.xs {
+				row := []string{fmt.Sprint(x)}
+				for _, series := range s.series {
+					cell := ""
+					if v, ok := m.value(series, x); ok {
+						cell = m.format(v)
+					}
+					row = append(row, cell)
+				}
+				htmlRow(&b, "td", row)
+			}
+			b.WriteString("</table>\n")
+		}
+	}
+
+	if len(other) > 0 {
+		b.WriteString("<h2>Other benchmarks</h2>\n<table>\n")
+		units := otherUnits(other)
+		htmlRow(&b, "th", append([]string{"benchmark"}, units...))
+		for _, bench := range other {
+			row := []string{bench.name}
+			for _, unit := range units {
+				cell := ""
+				if v, ok := bench.metrics[unit]; ok {
+					cell = formatValue(v)
+				}
+				row = append(row, cell)
+			}
+			htmlRow(&b, "td", row)
+		}
+		b.WriteString("</table>\n")
+	}
+	b.WriteString("</body></html>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// svgChart draws a line per series over the sweep's sizes, spaced evenly
+// rather than to scale, with the y axis from zero to the largest value.
+func svgChart(b *strings.Builder, s *sweep, m metric) {
+	max := 0.0
+	for _, series := range s.series {
+		for _, x := range s.xs {
+			if v, ok := m.value(series, x); ok && v > max {
+				max = v
+			}
+		}
+	}
+	if max == 0 {
+		return
+	}
+	plotW, plotH := float64(chartWidth-2*chartMargin), float64(chartHeight-2*chartMargin)
+	xPos := func(i int) float64 {
+		if len(s.xs) == 1 {
+			return chartMargin + plotW/2
+		}
+		return chartMargin + plotW*float64(i)/float64(len(s.xs)-1)
+	}
+	yPos := func(v float64) float64 { return chartMargin + plotH*(1-v/max) }
+
+	fmt.Fprintf(b, `<svg width="%d" height="%d" viewBox="0 0 %d %d" xmlns="http://www.w3.org/2000/svg" font-size="11">`+"\n",
+		chartWidth, chartHeight, chartWidth, chartHeight)
+	fmt.Fprintf(b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#333"/>`+"\n",
+		chartMargin, chartHeight-chartMargin, chartWidth-chartMargin, chartHeight-chartMargin)
+	fmt.Fprintf(b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#333"/>`+"\n",
+		chartMargin, chartMargin, chartMargin, chartHeight-chartMargin)
+	fmt.Fprintf(b, `<text x="%d" y="%d" text-anchor="end">%s</text>`+"\n", chartMargin-4, chartMargin+4, html.EscapeString(m.format(max)))
+	fmt.Fprintf(b, `<text x="%d" y="%d" text-anchor="end">0</text>`+"\n", chartMargin-4, chartHeight-chartMargin+4)
+	for i, x := range s.xs {
+		fmt.Fprintf(b, `<text x="%.1f" y="%d" text-anchor="middle">%d</text>`+"\n", xPos(i), chartHeight-chartMargin+16, x)
+	}
+	fmt.Fprintf(b, `<text x="%d" y="%d" text-anchor="middle">%s</text>`+"\n", chartWidth/2, chartHeight-8, html.EscapeString(s.dimension))
+
+	for n, series := range s.series {
+		color := palette[n%len(palette)]
+		var points []string
+		for i, x := range s.xs {
+			if v, ok := m.value(series, x); ok {
+				points = append(points, fmt.Sprintf("%.1f,%.1f", xPos(i), yPos(v)))
+			}
+		}
+		if len(points) == 0 {
+			continue
+		}
+		fmt.Fprintf(b, `<polyline fill="none" stroke="%s" stroke-width="2" points="%s"><title>%s</title></polyline>`+"\n",
+			color, strings.Join(points, " "), html.EscapeString(series))
+		for _, p := range points {
+			xy := strings.Split(p, ",")
+			fmt.Fprintf(b, `<circle cx="%s" cy="%s" r="3" fill="%s"/>`+"\n", xy[0], xy[1], color)
+		}
+	}
+	b.WriteString("</svg>\n<div class=\"legend\">")
+	for n, series := range s.series {
+		fmt.Fprintf(b, `<span style="color:%s">■ %s</span>`, palette[n%len(palette)], html.EscapeString(series))
+	}
+	b.WriteString("</div>\n")
+}
+
+func htmlRow(b *strings.Builder, cell string, cells []string) {
+	b.WriteString("<tr>")
+	for _, c := range cells {
+		fmt.Fprintf(b, "<%s>%s</%s>", cell, html.EscapeString(c), cell)
+	}
+	b.WriteString("</tr>\n")
+}
@@ -0,0 +1,122 @@
+// Command benchreport turns the output of the serialization benchmarks into
+// a Markdown or HTML report, instead of copying console output by hand.
+//
+//	go run ./cmd/benchreport -out report.md                 # runs -bench FormatSweep
+//	go run ./cmd/benchreport -bench 'Characters|LogRequest' -format html -out report.html
+//	go test -run '^$' -bench . -benchmem | go run ./cmd/benchreport -in -
+//
+// Without -in it runs go test -run '^$' -bench <pattern> -benchmem on -pkg
+// (default the server package, from the server directory) and echoes the
+// output to stderr while it runs. Benchmarks measured at several sizes,
+// either as sub-benchmarks named key=N (FormatSweep/characters=20/json) or
+// as names ending in N and a word (OptimizedJSON20Characters), become a
+// table per metric with a row per size and a column per series, and time
+// and size ratio are charted: text bars in Markdown, SVG lines in HTML.
+// Size ratios divide each series' encoded_bytes by the -baseline series'.
+// Repeated runs (-count) are averaged; other benchmarks share one table.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+)
+
+func main() {
+	in := flag.String("in", "", "go test -bench output to read, - for stdin; runs the benchmarks when empty")
+	pattern := flag.String("bench", "FormatSweep", "benchmarks to run, as go test -bench")
+	pkg := flag.String("pkg", ".", "package whose benchmarks to run")
+	benchtime := flag.String("benchtime", "", "go test -benchtime")
+	count := flag.Int("count", 1, "go test -count; runs are averaged")
+	format := flag.String("format", "", "markdown or html; from the -out extension when empty, else markdown")
+	out := flag.String("out", "", "report file; stdout when empty")
+	baseline := flag.String("baseline", "json", "series the size ratios are given against")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: benchreport [-in file|-] [-bench pattern] [-format markdown|html] [-out file]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *format == "" {
+		*format = "markdown"
+		if ext := filepath.Ext(*out); ext == ".html" || ext == ".htm" {
+			*format = "html"
+		}
+	}
+	write := map[string]func(io.Writer, *benchOutput, string) error{
+		"markdown": writeMarkdown,
+		"md":       writeMarkdown,
+		"html":     writeHTML,
+	}[*format]
+	if write == nil {
+		fmt.Fprintf(os.Stderr, "benchreport: unknown format %q\n", *format)
+		os.Exit(2)
+	}
+
+	var input io.Reader
+	switch *in {
+	case "":
+		output, err := runBenchmarks(*pkg, *pattern, *benchtime, *count)
+		if err != nil {
+			fail(err)
+		}
+		input = bytes.NewReader(output)
+	case "-":
+		input = os.Stdin
+	default:
+		f, err := os.Open(*in)
+		if err != nil {
+			fail(err)
+		}
+		defer f.Close()
+		input = f
+	}
+
+	parsed, err := parse(input)
+	if err != nil {
+		fail(err)
+	}
+	if len(parsed.benchmarks) == 0 {
+		fail(fmt.Errorf("no benchmark results in the input"))
+	}
+	var report bytes.Buffer
+	if err := write(&report, parsed, *baseline); err != nil {
+		fail(err)
+	}
+	if *out == "" {
+		os.Stdout.Write(report.Bytes())
+		return
+	}
+	if err := os.WriteFile(*out, report.Bytes(), 0644); err != nil {
+		fail(err)
+	}
+}
+
+// runBenchmarks runs the benchmarks of pkg and returns their output.
+func runBenchmarks(pkg, pattern, benchtime string, count int) ([]byte, error) {
+	args := []string{"test", "-run", "^$", "-bench", pattern, "-benchmem", "-count", strconv.Itoa(count)}
+	if benchtime != "" {
+		args = append(args, "-benchtime", benchtime)
+	}
+	var output bytes.Buffer
+	cmd := exec.Command("go", append(args, pkg)...)
+	cmd.Stdout = io.MultiWriter(&output, os.Stderr)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("go test: %w", err)
+	}
+	return output.Bytes(), nil
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "benchreport: %v\n", err)
+	os.Exit(1)
+}
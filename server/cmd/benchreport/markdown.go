@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+const barWidth = 40
+
+// writeMarkdown writes the report as GitHub-flavored Markdown: a table per
+// metric of each sweep, text bar charts of time and size ratio, and one
+// table of the other benchmarks.
+func writeMarkdown(w io.Writer, out *benchOutput, baseline string) error {
+	var b strings.Builder
+	b.WriteString("# Benchmark report\n\n")
+	for _, line := range out.env {
+		fmt.Fprintf(&b, "- %s\n", line)
+	}
+	if len(out.env) > 0 {
+		b.WriteString("\n")
+	}
+
+	sweeps, other := groupSweeps(out.benchmarks)
+	for _, s := range sweeps {
+		fmt.Fprintf(&b, "## %s\n\n", s.title)
+		for _, m := range s.metrics(baseline) {
+			fmt.Fprintf(&b, "### %s\n\n", m.title)
+			markdownRow(&b, append([]string{s.dimension}, s.series...))
+			markdownRow(&b, repeat("---:", len(s.series)+1))
+			for _, x := range s.xs {
+				row := []string{fmt.Sprint(x)}
+				for _, series := range s.series {
+					cell := ""
+					if v, ok := m.value(series, x); ok {
+						cell = m.format(v)
+					}
+					row = append(row, cell)
+				}
+				markdownRow(&b, row)
+			}
+			b.WriteString("\n")
+			if m.chart {
+				markdownChart(&b, s, m)
+			}
+		}
+	}
+
+	if len(other) > 0 {
+		b.WriteString("## Other benchmarks\n\n")
+		units := otherUnits(other)
+		markdownRow(&b, append([]string{"benchmark"}, units...))
+		markdownRow(&b, append([]string{"---"}, repeat("---:", len(units))...))
+		for _, bench := range other {
+			row := []string{bench.name}
+			for _, unit := range units {
+				cell := ""
+				if v, ok := bench.metrics[unit]; ok {
+					cell = formatValue(v)
+				}
+				row = append(row, cell)
+			}
+			markdownRow(&b, row)
+		}
+		b.WriteString("\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// markdownChart draws a bar per series at each x, scaled to the largest
+// value at that x.
+func markdownChart(b *strings.Builder, s *sweep, m metric) {
+	width := 0
+	for _, series := range s.series {
+		if len(series) > width {
+			width = len(series)
+		}
+	}
+	b.WriteString("```text\n")
+	for _, x := range s.xs {
+		max := 0.0
+		for _, series := range s.series {
+			if v, ok := m.value(series, x); ok && v > max {
+				max = v
+			}
+		}
+		fmt.Fprintf(b, "%s=%d\n", s.dimension, x)
+		for _, series := range s.series {
+			v, ok := m.value(series, x)
+			if !ok {
+				continue
+			}
+			n := 0
+			if max > 0 {
+				n = int(v / max * barWidth)
+			}
+			if n == 0 && v > 0 {
+				n = 1
+			}
+			fmt.Fprintf(b, "  %-*s %-*s %s\n", width, series, barWidth, strings.Repeat("█", n), m.format(v))
+		}
+	}
+	b.WriteString("```\n\n")
+}
+
+func markdownRow(b *strings.Builder, cells []string) {
+	b.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+}
+
+func repeat(s string, n int) []string {
+	out := make([]string, n)
+	for i := range out {
+		out[i] = s
+	}
+	return out
+}
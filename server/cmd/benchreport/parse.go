@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// benchmark is one benchmark of the output, its metrics averaged over
+// every line it printed (one per -count run).
+type benchmark struct {
+	name    string // without the Benchmark prefix and -GOMAXPROCS suffix
+	runs    int
+	metrics map[string]float64
+	units   []string // in the order go test prints them
+}
+
+// benchOutput is the parsed output of go test -bench.
+type benchOutput struct {
+	env        []string // goos, goarch, pkg and cpu lines
+	benchmarks []*benchmark
+}
+
+// parse reads go test -bench output. Lines other than results and the
+// environment header, such as PASS or test logs, are skipped.
+func parse(r io.Reader) (*benchOutput, error) {
+	out := &benchOutput{}
+	byName := make(map[string]*benchmark)
+	seenEnv := make(map[string]bool)
+	sums := make(map[*benchmark]map[string]float64)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		for _, key := range []string{"goos:", "goarch:", "pkg:", "cpu:"} {
+			if strings.HasPrefix(line, key) && !seenEnv[line] {
+				seenEnv[line] = true
+				out.env = append(out.env, line)
+			}
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 4 || !strings.HasPrefix(fields[0], "Benchmark") {
+			continue
+		}
+		if _, err := strconv.Atoi(fields[1]); err != nil {
+			continue
+		}
+		name := benchmarkName(fields[0])
+		b := byName[name]
+		if b == nil {
+			b = &benchmark{name: name, metrics: make(map[string]float64)}
+			byName[name] = b
+			sums[b] = make(map[string]float64)
+			out.benchmarks = append(out.benchmarks, b)
+		}
+		b.runs++
+		for i := 2; i+1 < len(fields); i += 2 {
+			value, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				break
+			}
+			unit := fields[i+1]
+			if _, ok := sums[b][unit]; !ok {
+				b.units = append(b.units, unit)
+			}
+			sums[b][unit] += value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for b, sum := range sums {
+		for unit, total := range sum {
+			b.metrics[unit] = total / float64(b.runs)
+		}
+	}
+	return out, nil
+}
+
+// benchmarkName strips the Benchmark prefix and the -GOMAXPROCS suffix go
+// test adds when GOMAXPROCS is above one.
+func benchmarkName(name string) string {
+	name = strings.TrimPrefix(name, "Benchmark")
+	if i := strings.LastIndexByte(name, '-'); i > 0 {
+		if _, err := strconv.Atoi(name[i+1:]); err == nil {
+			name = name[:i]
+		}
+	}
+	return name
+}
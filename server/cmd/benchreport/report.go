@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A sweep is a family of benchmarks measured at several sizes, such as
+// FormatSweep/characters=20/json or OptimizedJSON20Characters: a series
+// (json, OptimizedJSON) at a point x (20) of a dimension (characters).
+type sweep struct {
+	title     string
+	dimension string
+	xs        []int
+	series    []string
+	points    map[string]map[int]*benchmark
+}
+
+var (
+	// characters=20 in a sub-benchmark name.
+	paramPart = regexp.MustCompile(`^([A-Za-z_]+)=(\d+)$`)
+	// OptimizedJSON20Characters, the naming of the older benchmarks.
+	sizeSuffix = regexp.MustCompile(`^(.*?)(\d+)([A-Z][a-z]+)$`)
+)
+
+// sweepKey places a benchmark in a sweep; ok is false for benchmarks
+// measured at one size only.
+func sweepKey(name string) (title, dimension, series string, x int, ok bool) {
+	parts := strings.Split(name, "/")
+	for i, part := range parts {
+		m := paramPart.FindStringSubmatch(part)
+		if m == nil {
+			continue
+		}
+		x, _ = strconv.Atoi(m[2])
+		group := strings.Join(parts[:i], "/")
+		series = strings.Join(parts[i+1:], "/")
+		if series == "" {
+			series = group
+		}
+		return fmt.Sprintf("%s by %s", group, m[1]), m[1], series, x, true
+	}
+	if len(parts) == 1 {
+		if m := sizeSuffix.FindStringSubmatch(name); m != nil && m[1] != "" {
+			x, _ = strconv.Atoi(m[2])
+			return "*N" + m[3], strings.ToLower(m[3]), m[1], x, true
+		}
+	}
+	return "", "", "", 0, false
+}
+
+// groupSweeps sorts the benchmarks into sweeps, in the order they first
+// appear, and returns the rest.
+func groupSweeps(benchmarks []*benchmark) ([]*sweep, []*benchmark) {
+	var sweeps []*sweep
+	byTitle := make(map[string]*sweep)
+	var other []*benchmark
+	for _, b := range benchmarks {
+		title, dimension, series, x, ok := sweepKey(b.name)
+		if !ok {
+			other = append(other, b)
+			continue
+		}
+		s := byTitle[title]
+		if s == nil {
+			s = &sweep{title: title, dimension: dimension, points: make(map[string]map[int]*benchmark)}
+			byTitle[title] = s
+			sweeps = append(sweeps, s)
+		}
+		if s.points[series] == nil {
+			s.points[series] = make(map[int]*benchmark)
+			s.series = append(s.series, series)
+		}
+		if !containsInt(s.xs, x) {
+			s.xs = append(s.xs, x)
+		}
+		s.points[series][x] = b
+	}
+	for _, s := range sweeps {
+		sort.Ints(s.xs)
+	}
+	return sweeps, other
+}
+
+func containsInt(xs []int, x int) bool {
+	for _, v := range xs {
+		if v == x {
+			return true
+		}
+	}
+	return false
+}
+
+// A metric is one table of a sweep: a value per series and x.
+type metric struct {
+	title string
+	// chart marks the metrics the report draws: time and size ratio.
+	chart  bool
+	value  func(series string, x int) (float64, bool)
+	format func(float64) string
+}
+
+// metrics lists a sweep's tables: every unit the benchmarks reported and,
+// when they report encoded_bytes and include the baseline series, the size
+// ratio against it.
+func (s *sweep) metrics(baseline string) []metric {
+	var units []string
+	seen := make(map[string]bool)
+	for _, series := range s.series {
+		for _, x := range s.xs {
+			if b := s.points[series][x]; b != nil {
+				for _, unit := range b.units {
+					if !seen[unit] {
+						seen[unit] = true
+						units = append(units, unit)
+					}
+				}
+			}
+		}
+	}
+
+	var metrics []metric
+	for _, unit := range units {
+		unit := unit
+		metrics = append(metrics, metric{
+			title: unit,
+			chart: unit == "ns/op",
+			value: func(series string, x int) (float64, bool) {
+				b := s.points[series][x]
+				if b == nil {
+					return 0, false
+				}
+				v, ok := b.metrics[unit]
+				return v, ok
+			},
+			format: formatValue,
+		})
+		if unit == "encoded_bytes" && s.points[baseline] != nil {
+			metrics = append(metrics, metric{
+				title: "size ratio vs " + baseline,
+				chart: true,
+				value: func(series string, x int) (float64, bool) {
+					b, base := s.points[series][x], s.points[baseline][x]
+					if b == nil || base == nil || base.metrics[unit] == 0 {
+						return 0, false
+					}
+					return b.metrics[unit] / base.metrics[unit] * 100, true
+				},
+				format: func(v float64) string { return fmt.Sprintf("%.2f%%", v) },
+			})
+		}
+	}
+	return metrics
+}
+
+// formatValue prints whole numbers without decimals and the rest with two.
+func formatValue(v float64) string {
+	if v == math.Trunc(v) && math.Abs(v) < 1e15 {
+		return strconv.FormatFloat(v, 'f', 0, 64)
+	}
+	return strconv.FormatFloat(v, 'f', 2, 64)
+}
+
+// otherUnits returns every unit the benchmarks reported, in order.
+func otherUnits(benchmarks []*benchmark) []string {
+	var units []string
+	seen := make(map[string]bool)
+	for _, b := range benchmarks {
+		for _, unit := range b.units {
+			if !seen[unit] {
+				seen[unit] = true
+				units = append(units, unit)
+			}
+		}
+	}
+	return units
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const testOutput = `goos: linux
+goarch: amd64
+pkg: github.com/homveloper/exp-avro-json/server
+cpu: AMD EPYC
+BenchmarkFormatSweep/characters=1/json-8         	   10000	      2000 ns/op	       400.0 encoded_bytes	     512 B/op	       3 allocs/op
+BenchmarkFormatSweep/characters=1/avro_binary-8  	   10000	      1000 ns/op	       100.0 encoded_bytes	     128 B/op	       2 allocs/op
+BenchmarkFormatSweep/characters=20/json-8        	    1000	     40000 ns/op	      8000 encoded_bytes	    9000 B/op	      30 allocs/op
+BenchmarkFormatSweep/characters=20/json-8        	    1000	     20000 ns/op	      8000 encoded_bytes	    9000 B/op	      30 allocs/op
+BenchmarkFormatSweep/characters=20/avro_binary-8 	    1000	     10000 ns/op	      2000 encoded_bytes	    3000 B/op	       5 allocs/op
+    benchmark_test.go:10: some log line
+BenchmarkOptimizedJSON5Characters-8              	    5000	      5000 ns/op	    2048 B/op	      10 allocs/op
+BenchmarkOptimizedJSON50Characters-8             	     500	     50000 ns/op	   20480 B/op	     100 allocs/op
+BenchmarkLogRequestCBOR-8                        	  100000	       900 ns/op	     256 B/op	       4 allocs/op
+PASS
+ok  	github.com/homveloper/exp-avro-json/server	3.2s
+`
+
+func TestParse(t *testing.T) {
+	out, err := parse(strings.NewReader(testOutput))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if len(out.env) != 4 || out.env[0] != "goos: linux" {
+		t.Errorf("unexpected environment: %q", out.env)
+	}
+	if len(out.benchmarks) != 7 {
+		t.Fatalf("expected 7 benchmarks, got %d", len(out.benchmarks))
+	}
+	json20 := out.benchmarks[2]
+	if json20.name != "FormatSweep/characters=20/json" || json20.runs != 2 {
+		t.Errorf("unexpected benchmark: %+v", json20)
+	}
+	if json20.metrics["ns/op"] != 30000 || json20.metrics["encoded_bytes"] != 8000 {
+		t.Errorf("expected runs to be averaged: %v", json20.metrics)
+	}
+	if strings.Join(json20.units, ",") != "ns/op,encoded_bytes,B/op,allocs/op" {
+		t.Errorf("unexpected units: %q", json20.units)
+	}
+}
+
+func TestGroupSweeps(t *testing.T) {
+	out, _ := parse(strings.NewReader(testOutput))
+	sweeps, other := groupSweeps(out.benchmarks)
+	if len(sweeps) != 2 || len(other) != 1 || other[0].name != "LogRequestCBOR" {
+		t.Fatalf("unexpected grouping: %d sweeps, other %v", len(sweeps), other)
+	}
+	formats := sweeps[0]
+	if formats.title != "FormatSweep by characters" || formats.dimension != "characters" {
+		t.Errorf("unexpected sweep: %+v", formats)
+	}
+	if strings.Join(formats.series, ",") != "json,avro_binary" || len(formats.xs) != 2 || formats.xs[1] != 20 {
+		t.Errorf("unexpected series %q or sizes %v", formats.series, formats.xs)
+	}
+	if optimized := sweeps[1]; optimized.title != "*NCharacters" || optimized.series[0] != "OptimizedJSON" || optimized.xs[1] != 50 {
+		t.Errorf("unexpected sweep: %+v", optimized)
+	}
+
+	var ratio *metric
+	for _, m := range formats.metrics("json") {
+		if m.title == "size ratio vs json" {
+			m := m
+			ratio = &m
+		}
+	}
+	if ratio == nil {
+		t.Fatalf("expected a size ratio table")
+	}
+	if v, ok := ratio.value("avro_binary", 20); !ok || v != 25 {
+		t.Errorf("expected avro_binary at 25%% of json, got %v", v)
+	}
+}
+
+func TestWriteReports(t *testing.T) {
+	out, _ := parse(strings.NewReader(testOutput))
+
+	var md strings.Builder
+	if err := writeMarkdown(&md, out, "json"); err != nil {
+		t.Fatalf("Failed to write Markdown: %v", err)
+	}
+	for _, want := range []string{
+		"## FormatSweep by characters",
+		"### size ratio vs json",
+		"| characters | json | avro_binary |",
+		"| 20 | 100.00% | 25.00% |",
+		"| 20 | 30000 | 10000 |",
+		"characters=20\n  json        ████████████████████████████████████████ 30000",
+		"## Other benchmarks",
+		"| LogRequestCBOR | 900 | 256 | 4 |",
+	} {
+		if !strings.Contains(md.String(), want) {
+			t.Errorf("Markdown report lacks %q:\n%s", want, md.String())
+		}
+	}
+
+	var page strings.Builder
+	if err := writeHTML(&page, out, "json"); err != nil {
+		t.Fatalf("Failed to write HTML: %v", err)
+	}
+	for _, want := range []string{"<h2>FormatSweep by characters</h2>", "<svg", "<polyline", "<td>LogRequestCBOR</td>"} {
+		if !strings.Contains(page.String(), want) {
+			t.Errorf("HTML report lacks %q", want)
+		}
+	}
+}
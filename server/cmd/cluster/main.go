@@ -0,0 +1,301 @@
+// Command cluster launches several server instances on consecutive ports so
+// horizontal scaling can be evaluated locally without Docker.
+//
+//	go run ./cmd/cluster -n 3 -- -demo
+//
+// Everything after "--" is passed to every instance as shared configuration.
+// Each instance gets its own working directory (logs/, avro-logs/) under
+// -dir, and a cluster.json manifest lists the instance URLs for clients.
+// Instances share a lease file under -dir, so exactly one of them runs the
+// compaction and retention jobs.
+//
+// With -router-port an extra instance runs in router mode (-shard-backends)
+// in front of the others, sharding /log requests by projectName.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+type instance struct {
+	Name    string `json:"name"`
+	URL     string `json:"url"`
+	TCPAddr string `json:"tcp_addr,omitempty"`
+	UDPAddr string `json:"udp_addr,omitempty"`
+	WorkDir string `json:"work_dir"`
+	PID     int    `json:"pid"`
+
+	cmd     *exec.Cmd
+	exited  chan struct{}
+	exitErr error
+}
+
+type manifest struct {
+	StartedAt  time.Time   `json:"started_at"`
+	SharedArgs []string    `json:"shared_args"`
+	Instances  []*instance `json:"instances"`
+	Router     *instance   `json:"router,omitempty"`
+}
+
+func main() {
+	count := flag.Int("n", 3, "number of server instances")
+	basePort := flag.Int("base-port", 8080, "HTTP port of the first instance; others use consecutive ports")
+	dir := flag.String("dir", "cluster", "root directory for instance working directories and the manifest")
+	serverDir := flag.String("server-dir", ".", "server package to build when -bin is not set")
+	bin := flag.String("bin", "", "prebuilt server binary")
+	transports := flag.Bool("transports", false, "also enable the TCP/UDP frame transports (ports base+1000+i, base+2000+i)")
+	routerPort := flag.Int("router-port", 0, "also start a consistent-hashing router on this port (0 disables)")
+	healthTimeout := flag.Duration("health-timeout", 15*time.Second, "how long to wait for each instance to answer /ping")
+	flag.Parse()
+	sharedArgs := flag.Args()
+
+	if *count < 1 {
+		fmt.Println("❌ -n must be at least 1")
+		os.Exit(1)
+	}
+
+	root, err := filepath.Abs(*dir)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		fmt.Printf("❌ Failed to create %s: %v\n", root, err)
+		os.Exit(1)
+	}
+
+	binary := *bin
+	if binary == "" {
+		binary = filepath.Join(root, "server")
+		fmt.Printf("🔨 Building server from %s...\n", *serverDir)
+		build := exec.Command("go", "build", "-o", binary, ".")
+		build.Dir = *serverDir
+		build.Stdout, build.Stderr = os.Stdout, os.Stderr
+		if err := build.Run(); err != nil {
+			fmt.Printf("❌ Build failed: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	m := manifest{StartedAt: time.Now(), SharedArgs: sharedArgs}
+	for i := 0; i < *count; i++ {
+		inst, err := startInstance(binary, root, i, *basePort, *transports, sharedArgs)
+		if err != nil {
+			fmt.Printf("❌ Failed to start node-%d: %v\n", i, err)
+			shutdown(m.Instances)
+			os.Exit(1)
+		}
+		m.Instances = append(m.Instances, inst)
+	}
+
+	for _, inst := range m.Instances {
+		if err := waitHealthy(ctx, inst, *healthTimeout); err != nil {
+			fmt.Printf("❌ %s did not become healthy: %v\n", inst.Name, err)
+			shutdown(m.Instances)
+			os.Exit(1)
+		}
+		fmt.Printf("✅ %s ready at %s (pid %d)\n", inst.Name, inst.URL, inst.PID)
+	}
+
+	urls := make([]string, len(m.Instances))
+	for i, inst := range m.Instances {
+		urls[i] = inst.URL
+	}
+
+	if *routerPort > 0 {
+		router, err := startRouter(binary, root, *routerPort, urls)
+		if err == nil {
+			err = waitHealthy(ctx, router, *healthTimeout)
+		}
+		if err != nil {
+			fmt.Printf("❌ Router failed to start: %v\n", err)
+			if router != nil {
+				m.Instances = append(m.Instances, router)
+			}
+			shutdown(m.Instances)
+			os.Exit(1)
+		}
+		m.Router = router
+		fmt.Printf("✅ %s ready at %s (pid %d)\n", router.Name, router.URL, router.PID)
+	}
+
+	manifestFile := filepath.Join(root, "cluster.json")
+	data, _ := json.MarshalIndent(m, "", "  ")
+	if err := os.WriteFile(manifestFile, data, 0644); err != nil {
+		fmt.Printf("⚠️  Failed to write manifest: %v\n", err)
+	}
+
+	fmt.Printf("\n📋 Manifest: %s\n", manifestFile)
+	fmt.Printf("🔁 Round-robin client: cd go-client && go run . --servers %s log random\n", strings.Join(urls, ","))
+	if m.Router != nil {
+		fmt.Printf("🧭 Sharded client: cd go-client && go run . --servers %s log random\n", m.Router.URL)
+	}
+	fmt.Println("Press Ctrl-C to stop the cluster.")
+
+	all := m.Instances
+	if m.Router != nil {
+		all = append(all, m.Router)
+	}
+	for _, inst := range all {
+		go func(inst *instance) {
+			select {
+			case <-inst.exited:
+				fmt.Printf("⚠️  %s exited unexpectedly: %v\n", inst.Name, inst.exitErr)
+			case <-ctx.Done():
+			}
+		}(inst)
+	}
+
+	<-ctx.Done()
+	fmt.Println("\n🛑 Stopping cluster...")
+	shutdown(all)
+}
+
+func startInstance(binary, root string, i, basePort int, transports bool, sharedArgs []string) (*instance, error) {
+	name := fmt.Sprintf("node-%d", i)
+	workDir := filepath.Join(root, name)
+	if err := os.MkdirAll(workDir, 0755); err != nil {
+		return nil, err
+	}
+
+	port := basePort + i
+	inst := &instance{
+		Name:    name,
+		URL:     fmt.Sprintf("http://localhost:%d", port),
+		WorkDir: workDir,
+		exited:  make(chan struct{}),
+	}
+
+	args := []string{
+		"-addr", fmt.Sprintf(":%d", port),
+		"-node-id", name,
+		"-id-node", strconv.Itoa(i),
+		"-lease-file", filepath.Join(root, "jobs.lease"),
+	}
+	if transports {
+		inst.TCPAddr = fmt.Sprintf("localhost:%d", basePort+1000+i)
+		inst.UDPAddr = fmt.Sprintf("localhost:%d", basePort+2000+i)
+		args = append(args, "-tcp-addr", fmt.Sprintf(":%d", basePort+1000+i), "-udp-addr", fmt.Sprintf(":%d", basePort+2000+i))
+	} else {
+		args = append(args, "-tcp-addr=", "-udp-addr=")
+	}
+	args = append(args, sharedArgs...)
+	return launch(inst, binary, args)
+}
+
+// startRouter runs an instance that only proxies /log to the backends. It
+// does not receive the shared arguments, which configure the backends.
+func startRouter(binary, root string, port int, backends []string) (*instance, error) {
+	workDir := filepath.Join(root, "router")
+	if err := os.MkdirAll(workDir, 0755); err != nil {
+		return nil, err
+	}
+	inst := &instance{
+		Name:    "router",
+		URL:     fmt.Sprintf("http://localhost:%d", port),
+		WorkDir: workDir,
+		exited:  make(chan struct{}),
+	}
+	args := []string{
+		"-addr", fmt.Sprintf(":%d", port),
+		"-tcp-addr=", "-udp-addr=",
+		"-shard-backends", strings.Join(backends, ","),
+	}
+	return launch(inst, binary, args)
+}
+
+func launch(inst *instance, binary string, args []string) (*instance, error) {
+	cmd := exec.Command(binary, args...)
+	cmd.Dir = inst.WorkDir
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stderr = cmd.Stdout
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	inst.cmd = cmd
+	inst.PID = cmd.Process.Pid
+	go prefixOutput(inst.Name, stdout)
+	go func() {
+		inst.exitErr = cmd.Wait()
+		close(inst.exited)
+	}()
+	return inst, nil
+}
+
+var outputMu sync.Mutex
+
+func prefixOutput(name string, r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		outputMu.Lock()
+		fmt.Printf("[%s] %s\n", name, scanner.Text())
+		outputMu.Unlock()
+	}
+}
+
+func waitHealthy(ctx context.Context, inst *instance, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	client := &http.Client{Timeout: time.Second}
+	body := []byte(`{"data":"cluster-health"}`)
+	for {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodPost, inst.URL+"/ping", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+		}
+
+		select {
+		case <-inst.exited:
+			return fmt.Errorf("process exited: %v", inst.exitErr)
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
+
+// shutdown interrupts every instance and kills those that do not exit in time.
+func shutdown(instances []*instance) {
+	for _, inst := range instances {
+		inst.cmd.Process.Signal(os.Interrupt)
+	}
+	deadline := time.After(5 * time.Second)
+	for _, inst := range instances {
+		select {
+		case <-inst.exited:
+		case <-deadline:
+			fmt.Printf("⚠️  Killing %s\n", inst.Name)
+			inst.cmd.Process.Kill()
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+	"github.com/homveloper/exp-avro-json/server/registry"
+)
+
+// manifest is contract.json.
+type manifest struct {
+	Schema      string `json:"schema"`
+	Version     int    `json:"version"`
+	Fingerprint string `json:"fingerprint"`
+	Canonical   string `json:"canonical"`
+	Seed        int64  `json:"seed"`
+	// ByteExact is false when the schema has maps, whose entries may be
+	// encoded in any order.
+	ByteExact bool          `json:"byte_exact"`
+	Valid     []validCase   `json:"valid"`
+	Invalid   []invalidCase `json:"invalid"`
+}
+
+// validCase paths are relative to the bundle directory.
+type validCase struct {
+	Name      string `json:"name"`
+	Seed      int64  `json:"seed"`
+	JSON      string `json:"json"`
+	PlainJSON string `json:"plain_json"`
+	Avro      string `json:"avro"`
+	AvroHex   string `json:"avro_hex"`
+}
+
+type invalidCase struct {
+	Name string `json:"name"`
+	JSON string `json:"json"`
+	Kind string `json:"kind"`
+	Path string `json:"path"`
+	// From names the valid case the payload was derived from.
+	From string `json:"from"`
+	// Error is the server codec's message, for reference only.
+	Error string `json:"error"`
+}
+
+// writeBundle writes count valid cases of schema, seeded from seed, and
+// the invalid cases derived from them to dir.
+func writeBundle(dir string, schema registry.Schema, count int, seed int64) (*manifest, error) {
+	codec, err := avrojson.NewCodec(schema.Schema)
+	if err != nil {
+		return nil, err
+	}
+	for _, sub := range []string{"valid", "invalid"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			return nil, err
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "schema.avsc"), []byte(schema.Schema+"\n"), 0644); err != nil {
+		return nil, err
+	}
+
+	m := &manifest{
+		Schema:      schema.Name,
+		Version:     schema.Version,
+		Fingerprint: schema.Fingerprint,
+		Canonical:   schema.Canonical,
+		Seed:        seed,
+		ByteExact:   !strings.Contains(schema.Canonical, `"type":"map"`),
+	}
+	seen := make(map[string]bool)
+	for i := 0; i < count; i++ {
+		caseSeed := seed + int64(i)
+		if caseSeed == 0 {
+			// Seed 0 means random to Sample.
+			caseSeed = seed + int64(count)
+		}
+		native, err := codec.Sample(caseSeed)
+		if err != nil {
+			return nil, fmt.Errorf("sample %d: %w", caseSeed, err)
+		}
+		binary, err := codec.EncodeNative(native)
+		if err != nil {
+			return nil, fmt.Errorf("sample %d: %w", caseSeed, err)
+		}
+		text, err := codec.BinaryToJSON(binary)
+		if err != nil {
+			return nil, fmt.Errorf("sample %d: %w", caseSeed, err)
+		}
+		plain, err := plainJSON(codec, text)
+		if err != nil {
+			return nil, fmt.Errorf("sample %d: %w", caseSeed, err)
+		}
+
+		vc := validCase{
+			Name:      fmt.Sprintf("valid-%02d", i+1),
+			Seed:      caseSeed,
+			JSON:      fmt.Sprintf("valid/%02d.json", i+1),
+			PlainJSON: fmt.Sprintf("valid/%02d.plain.json", i+1),
+			Avro:      fmt.Sprintf("valid/%02d.avro", i+1),
+			AvroHex:   hex.EncodeToString(binary),
+		}
+		files := map[string][]byte{vc.JSON: indentJSON(text), vc.PlainJSON: indentJSON(plain), vc.Avro: binary}
+		if err := writeFiles(dir, files); err != nil {
+			return nil, err
+		}
+		m.Valid = append(m.Valid, vc)
+
+		violations, err := codec.Violations(text)
+		if err != nil {
+			return nil, fmt.Errorf("sample %d: %w", caseSeed, err)
+		}
+		for _, v := range violations {
+			key := v.Kind + " " + v.Path
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			n := len(m.Invalid) + 1
+			ic := invalidCase{
+				Name:  fmt.Sprintf("invalid-%03d", n),
+				JSON:  fmt.Sprintf("invalid/%03d-%s.json", n, v.Kind),
+				Kind:  v.Kind,
+				Path:  v.Path,
+				From:  vc.Name,
+				Error: v.Error,
+			}
+			if err := writeFiles(dir, map[string][]byte{ic.JSON: indentJSON(v.JSON)}); err != nil {
+				return nil, err
+			}
+			m.Invalid = append(m.Invalid, ic)
+		}
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "contract.json"), append(data, '\n'), 0644); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// plainJSON strips the union wrappers from Avro JSON text.
+func plainJSON(codec *avrojson.Codec, text []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(text))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	stripped, err := codec.StripUnions(v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(stripped)
+}
+
+func indentJSON(data []byte) []byte {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, "", "  "); err != nil {
+		return data
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
+
+func writeFiles(dir string, files map[string][]byte) error {
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, filepath.FromSlash(name)), data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+)
+
+func TestWriteBundle(t *testing.T) {
+	schema, err := readSchema(filepath.Join(t.TempDir(), "missing"), "LogData", 0)
+	if err != nil {
+		t.Fatalf("Failed to read built-in schema: %v", err)
+	}
+	dir := t.TempDir()
+	m, err := writeBundle(dir, schema, 3, 1)
+	if err != nil {
+		t.Fatalf("Failed to write bundle: %v", err)
+	}
+	if len(m.Valid) != 3 || len(m.Invalid) == 0 {
+		t.Fatalf("expected 3 valid cases and some invalid ones, got %d and %d", len(m.Valid), len(m.Invalid))
+	}
+	if m.ByteExact {
+		t.Error("expected LogData's maps to rule out byte-exact comparison")
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "contract.json"))
+	if err != nil {
+		t.Fatalf("Failed to read contract.json: %v", err)
+	}
+	var onDisk manifest
+	if err := json.Unmarshal(data, &onDisk); err != nil {
+		t.Fatalf("Failed to parse contract.json: %v", err)
+	}
+
+	codec, err := avrojson.NewCodec(schema.Schema)
+	if err != nil {
+		t.Fatalf("Failed to create codec: %v", err)
+	}
+	read := func(name string) []byte {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", name, err)
+		}
+		return data
+	}
+	for _, c := range onDisk.Valid {
+		want, err := codec.DecodeNative(read(c.Avro))
+		if err != nil {
+			t.Fatalf("%s: expected binary does not decode: %v", c.Name, err)
+		}
+		binary, err := codec.JSONToBinary(read(c.JSON))
+		if err != nil {
+			t.Fatalf("%s: JSON does not encode: %v", c.Name, err)
+		}
+		got, _ := codec.DecodeNative(binary)
+		if a, _ := json.Marshal(got); !bytes.Equal(a, mustMarshal(t, want)) {
+			t.Errorf("%s: JSON and binary disagree", c.Name)
+		}
+	}
+	for _, c := range onDisk.Invalid {
+		if _, err := codec.JSONToBinary(read(c.JSON)); err == nil {
+			t.Errorf("%s (%s at %q): expected the payload to be rejected", c.Name, c.Kind, c.Path)
+		}
+	}
+
+	// The same seed writes the same cases.
+	again, err := writeBundle(t.TempDir(), schema, 3, 1)
+	if err != nil {
+		t.Fatalf("Failed to write bundle: %v", err)
+	}
+	if len(again.Invalid) != len(m.Invalid) || again.Valid[0].Seed != m.Valid[0].Seed {
+		t.Error("expected the same seed to give the same bundle")
+	}
+}
+
+func mustMarshal(t *testing.T, v interface{}) []byte {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+	return data
+}
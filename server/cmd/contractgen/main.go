@@ -0,0 +1,129 @@
+// Command contractgen writes a contract-test bundle for a registered
+// schema, so client teams (UE/C++, web/TS, ...) can check their own Avro
+// serializers against the server's:
+//
+//	go run ./cmd/contractgen -schema-dir schemas -out contract/LogData LogData
+//	go run ./cmd/contractgen -server http://localhost:8080 -version 2 -out contract/LogData LogData
+//
+// The bundle holds the schema (schema.avsc), valid cases generated by
+// Codec.Sample with their expected Avro binary, invalid cases derived from
+// them by Codec.Violations, and contract.json listing every case. A
+// serializer passes when, for every valid case, encoding valid/NN.json (or
+// valid/NN.plain.json for serializers that take plain JSON unions) gives
+// valid/NN.avro and decoding valid/NN.avro gives the JSON back, and
+// encoding every invalid case fails. When contract.json has byte_exact
+// false the schema has maps, whose entries Avro writes in no fixed order,
+// so compare the decoded values instead of the bytes.
+//
+// The same -seed always writes the same cases.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+	"github.com/homveloper/exp-avro-json/server/registry"
+)
+
+func main() {
+	schemaDir := flag.String("schema-dir", "schemas", "schema registry directory, as the server's -schema-dir")
+	server := flag.String("server", "", "read the schema from this server's registry instead of -schema-dir")
+	version := flag.Int("version", 0, "schema version; 0 for the latest")
+	count := flag.Int("count", 5, "number of valid cases")
+	seed := flag.Int64("seed", 1, "seed for the generated cases")
+	out := flag.String("out", "", "bundle directory (created)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: contractgen [-schema-dir dir | -server url] [-version n] [-count n] [-seed n] -out dir name\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 || *out == "" || *count < 1 || *seed == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	name := flag.Arg(0)
+
+	var schema registry.Schema
+	var err error
+	if *server != "" {
+		schema, err = fetchSchema(*server, name, *version)
+	} else {
+		schema, err = readSchema(*schemaDir, name, *version)
+	}
+	if err != nil {
+		fail(err)
+	}
+
+	m, err := writeBundle(*out, schema, *count, *seed)
+	if err != nil {
+		fail(err)
+	}
+	fmt.Printf("%s v%d: %d valid and %d invalid cases -> %s\n", m.Schema, m.Version, len(m.Valid), len(m.Invalid), *out)
+}
+
+// readSchema looks name up in the registry persisted in dir. Built-in
+// schemas are found even before a server has registered them there.
+func readSchema(dir, name string, version int) (registry.Schema, error) {
+	if _, err := os.Stat(dir); err == nil {
+		reg, err := registry.Open(dir)
+		if err != nil {
+			return registry.Schema{}, err
+		}
+		s, err := reg.Get(name, version)
+		if err == nil || !errors.Is(err, registry.ErrNotFound) {
+			return s, err
+		}
+	}
+	builtin, ok := avrojson.BuiltinSchemas()[name]
+	if !ok || version > 1 {
+		return registry.Schema{}, fmt.Errorf("%s version %d is not registered in %s", name, version, dir)
+	}
+	reg, err := registry.Open("")
+	if err != nil {
+		return registry.Schema{}, err
+	}
+	s, _, err := reg.Register(name, builtin)
+	return s, err
+}
+
+// fetchSchema reads a schema version from a server's GET
+// /schemas/{name}/versions/{version}.
+func fetchSchema(server, name string, version int) (registry.Schema, error) {
+	v := "latest"
+	if version > 0 {
+		v = strconv.Itoa(version)
+	}
+	target := strings.TrimRight(server, "/") + "/schemas/" + url.PathEscape(name) + "/versions/" + v
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(target)
+	if err != nil {
+		return registry.Schema{}, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		registry.Schema
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return registry.Schema{}, fmt.Errorf("unexpected response (%s): %w", resp.Status, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return registry.Schema{}, fmt.Errorf("%s version %s: %s (%s)", name, v, result.Error, resp.Status)
+	}
+	return result.Schema, nil
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "contractgen: %v\n", err)
+	os.Exit(1)
+}
@@ -0,0 +1,226 @@
+// Command replay resends stored logs to a server's POST /log, so traffic
+// captured by one server version can be replayed against another and the
+// compression results compared.
+//
+//	go run ./cmd/replay -target http://localhost:8081 avro-logs            # the artifact store
+//	go run ./cmd/replay -rate 0 -report new.ndjson avro-logs/ocf/wrapper-*.avro
+//
+// Logs are read from an artifact store (a directory with manifests/, whose
+// original-json artifacts are resent byte for byte), a directory of OCF
+// files (its wrapper-*.avro files) or OCF LogWrapper files, rebuilt into
+// /log requests; other container files are skipped. The default source is
+// avro-logs. Logs are sent one at a time in storage order at -rate per
+// second. At the end the compression_stats of the accepted logs are
+// summed, each size as a share of original_json_size; -report writes each
+// log's status and compression_stats as an NDJSON line for a closer diff.
+// Interrupting the replay still prints the summary.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"time"
+)
+
+func main() {
+	target := flag.String("target", "http://localhost:8080", "base URL of the server to replay to")
+	rate := flag.Float64("rate", 10, "logs sent per second (0 sends as fast as the server answers)")
+	limit := flag.Int("limit", 0, "stop after this many logs (0 replays all)")
+	apiKey := flag.String("api-key", "", "bearer API key for a multi-tenant server")
+	timeout := flag.Duration("timeout", 10*time.Second, "timeout of each request")
+	reportPath := flag.String("report", "", "NDJSON file receiving each log's status and compression_stats")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: replay [-target url] [-rate n] [-limit n] [-report file] [avro-logs | dir | file.avro]...\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *rate < 0 || *limit < 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	paths := flag.Args()
+	if len(paths) == 0 {
+		paths = []string{"avro-logs"}
+	}
+
+	r := &replayer{
+		client: &http.Client{Timeout: *timeout},
+		url:    strings.TrimRight(*target, "/") + "/log",
+		apiKey: *apiKey,
+		totals: make(map[string]float64),
+		status: make(map[int]int),
+	}
+	if *rate > 0 {
+		r.interval = time.Duration(float64(time.Second) / *rate)
+	}
+	if *reportPath != "" {
+		f, err := os.Create(*reportPath)
+		if err != nil {
+			fail(err)
+		}
+		defer f.Close()
+		r.report = json.NewEncoder(f)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	start := time.Now()
+	err := readLogs(paths, func(log storedLog) error {
+		if *limit > 0 && r.sent >= *limit {
+			return errLimit
+		}
+		return r.send(ctx, log)
+	}, func(err error) { fmt.Fprintf(os.Stderr, "replay: skipping %v\n", err) })
+	if errors.Is(err, errLimit) || errors.Is(err, context.Canceled) {
+		err = nil
+	}
+	r.summary(os.Stdout, time.Since(start))
+	if err != nil {
+		fail(err)
+	}
+}
+
+var errLimit = errors.New("limit reached")
+
+// replayer sends logs and totals the responses.
+type replayer struct {
+	client   *http.Client
+	url      string
+	apiKey   string
+	interval time.Duration
+	report   *json.Encoder
+	next     time.Time
+
+	sent     int
+	accepted int
+	failed   int
+	status   map[int]int
+	// totals sums every numeric compression_stats field of the accepted
+	// logs.
+	totals map[string]float64
+}
+
+// reportLine is one line of -report.
+type reportLine struct {
+	Source           string                 `json:"source"`
+	Status           int                    `json:"status"`
+	ID               string                 `json:"id,omitempty"`
+	CompressionStats map[string]interface{} `json:"compression_stats,omitempty"`
+	Error            string                 `json:"error,omitempty"`
+}
+
+// send posts one log, waiting first so logs leave at the configured rate.
+func (r *replayer) send(ctx context.Context, log storedLog) error {
+	if wait := time.Until(r.next); wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	r.next = time.Now().Add(r.interval)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url, bytes.NewReader(log.Body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+r.apiKey)
+	}
+	r.sent++
+	line := reportLine{Source: log.Source}
+	resp, err := r.client.Do(req)
+	if ctx.Err() != nil {
+		r.sent--
+		return ctx.Err()
+	}
+	if err != nil {
+		r.failed++
+		line.Error = err.Error()
+		return r.write(line)
+	}
+	var result struct {
+		ID               string                 `json:"id"`
+		Error            string                 `json:"error"`
+		CompressionStats map[string]interface{} `json:"compression_stats"`
+	}
+	err = json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&result)
+	resp.Body.Close()
+	line.Status, line.ID, line.Error = resp.StatusCode, result.ID, result.Error
+	r.status[resp.StatusCode]++
+	if resp.StatusCode/100 != 2 || err != nil {
+		if line.Error == "" && err != nil {
+			line.Error = err.Error()
+		}
+		return r.write(line)
+	}
+	r.accepted++
+	line.CompressionStats = result.CompressionStats
+	for field, v := range result.CompressionStats {
+		if n, ok := v.(float64); ok {
+			r.totals[field] += n
+		}
+	}
+	return r.write(line)
+}
+
+func (r *replayer) write(line reportLine) error {
+	if r.report == nil {
+		return nil
+	}
+	return r.report.Encode(line)
+}
+
+// summary prints the counts and the compression totals.
+func (r *replayer) summary(w io.Writer, elapsed time.Duration) {
+	fmt.Fprintf(w, "sent %d logs in %s (%.1f/s): %d accepted, %d request errors\n",
+		r.sent, elapsed.Round(time.Millisecond), float64(r.sent)/elapsed.Seconds(), r.accepted, r.failed)
+	var codes []int
+	for code := range r.status {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		fmt.Fprintf(w, "  %d %s: %d\n", code, http.StatusText(code), r.status[code])
+	}
+	if r.accepted == 0 {
+		return
+	}
+	original := r.totals["original_json_size"]
+	var fields []string
+	for field := range r.totals {
+		if strings.HasSuffix(field, "_size") {
+			fields = append(fields, field)
+		}
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		if r.totals[fields[i]] != r.totals[fields[j]] {
+			return r.totals[fields[i]] > r.totals[fields[j]]
+		}
+		return fields[i] < fields[j]
+	})
+	fmt.Fprintf(w, "\n%-28s %14s %14s %10s\n", "compression_stats", "total bytes", "bytes/log", "of json")
+	for _, field := range fields {
+		share := "-"
+		if original > 0 {
+			share = fmt.Sprintf("%.2f%%", r.totals[field]/original*100)
+		}
+		fmt.Fprintf(w, "%-28s %14.0f %14.1f %10s\n", field, r.totals[field], r.totals[field]/float64(r.accepted), share)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "replay: %v\n", err)
+	os.Exit(1)
+}
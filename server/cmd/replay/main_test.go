@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/homveloper/exp-avro-json/server/artifact"
+	"github.com/homveloper/exp-avro-json/server/ocf"
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+)
+
+func TestReadLogs(t *testing.T) {
+	artifactDir := t.TempDir()
+	store, err := artifact.Open(artifactDir)
+	if err != nil {
+		t.Fatalf("Failed to open artifact store: %v", err)
+	}
+	original := `{"projectName":"p","body":{"timestamp":1,"metadata":{"n":42}}}`
+	if err := store.Put("log-1", map[string][]byte{artifact.OriginalJSON: []byte(original)}); err != nil {
+		t.Fatalf("Failed to put artifacts: %v", err)
+	}
+
+	ocfDir := t.TempDir()
+	wrapper, err := ocf.Open(ocfDir, avrojson.WrapperSchema, ocf.Options{Prefix: "wrapper"})
+	if err != nil {
+		t.Fatalf("Failed to open wrapper stream: %v", err)
+	}
+	logData, err := ocf.Open(ocfDir, avrojson.LogDataSchema, ocf.Options{Prefix: "logdata"})
+	if err != nil {
+		t.Fatalf("Failed to open log data stream: %v", err)
+	}
+	for _, issuer := range []string{"a", "b"} {
+		encoded, err := avrojson.EncodeLog(avrojson.LogWrapper{ProjectName: "p", LogLevel: "INFO", LogType: "event"},
+			avrojson.LogData{Timestamp: time.UnixMilli(1700000000000).UTC(), Logtype: "event", Version: "1", Issuer: issuer, Metadata: map[string]string{"k": issuer}})
+		if err != nil {
+			t.Fatalf("Failed to encode log: %v", err)
+		}
+		if err := wrapper.Append(encoded.Wrapper); err != nil {
+			t.Fatalf("Failed to append wrapper: %v", err)
+		}
+		if err := logData.Append(encoded.LogData); err != nil {
+			t.Fatalf("Failed to append log data: %v", err)
+		}
+	}
+	wrapper.Close()
+	logData.Close()
+
+	var logs []storedLog
+	var warnings []string
+	err = readLogs([]string{artifactDir, ocfDir, logData.Stats().File}, func(log storedLog) error {
+		logs = append(logs, log)
+		return nil
+	}, func(err error) { warnings = append(warnings, err.Error()) })
+	if err != nil {
+		t.Fatalf("Failed to read logs: %v", err)
+	}
+	if len(logs) != 3 || logs[0].Source != "log-1" || string(logs[0].Body) != original {
+		t.Fatalf("expected the original JSON then 2 rebuilt requests, got %v", logs)
+	}
+	var req logRequest
+	if err := json.Unmarshal(logs[2].Body, &req); err != nil {
+		t.Fatalf("Failed to parse rebuilt request: %v", err)
+	}
+	metadata, _ := req.Body.Metadata.(map[string]interface{})
+	if req.ProjectName != "p" || req.LogLevel != "INFO" || req.Body.Timestamp != 1700000000000 || req.Body.Issuer != "b" || metadata["k"] != "b" {
+		t.Errorf("unexpected rebuilt request %s", logs[2].Body)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "not a LogWrapper file") {
+		t.Errorf("expected the log data file to be skipped, got %q", warnings)
+	}
+	if err := readLogs([]string{t.TempDir()}, func(storedLog) error { return nil }, func(error) {}); err == nil {
+		t.Error("expected an empty directory to fail")
+	}
+}
+
+func TestReplayerSumsCompressionStats(t *testing.T) {
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		received = append(received, r.URL.Path+" "+r.Header.Get("Authorization"))
+		if body["projectName"] == "bad" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid"}`))
+			return
+		}
+		w.Write([]byte(`{"status":"logged","id":"x","compression_stats":{"original_json_size":200,"wrapper_avro_size":100,"wrapper_compression":"50.00%"}}`))
+	}))
+	defer server.Close()
+
+	r := &replayer{client: server.Client(), url: server.URL + "/log", apiKey: "secret", totals: map[string]float64{}, status: map[int]int{}}
+	for _, project := range []string{"p", "bad", "p"} {
+		if err := r.send(context.Background(), storedLog{Source: project, Body: []byte(`{"projectName":"` + project + `"}`)}); err != nil {
+			t.Fatalf("Failed to send log: %v", err)
+		}
+	}
+	if len(received) != 3 || received[0] != "/log Bearer secret" {
+		t.Errorf("unexpected requests %q", received)
+	}
+	if r.sent != 3 || r.accepted != 2 || r.status[http.StatusBadRequest] != 1 || r.totals["wrapper_avro_size"] != 200 {
+		t.Errorf("unexpected totals: sent %d, accepted %d, status %v, totals %v", r.sent, r.accepted, r.status, r.totals)
+	}
+
+	var out strings.Builder
+	r.summary(&out, time.Second)
+	for _, want := range []string{"sent 3 logs", "400 Bad Request: 1", "wrapper_avro_size", "50.00%"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("summary lacks %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestReplayerKeepsRate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"logged"}`))
+	}))
+	defer server.Close()
+	r := &replayer{client: server.Client(), url: server.URL, interval: 20 * time.Millisecond, totals: map[string]float64{}, status: map[int]int{}}
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if err := r.send(context.Background(), storedLog{Body: []byte(`{}`)}); err != nil {
+			t.Fatalf("Failed to send log: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Errorf("expected 4 logs at 50/s to take at least 60ms, took %s", elapsed)
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/homveloper/exp-avro-json/server/artifact"
+	"github.com/homveloper/exp-avro-json/server/ocf"
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+)
+
+// storedLog is one log to resend: the /log request body and where it was
+// read.
+type storedLog struct {
+	Source string
+	Body   []byte
+}
+
+// errNotWrapper marks container files of another stream than LogWrapper,
+// whose records cannot be turned back into /log requests.
+var errNotWrapper = errors.New("not a LogWrapper file")
+
+// readLogs calls fn with every log stored under paths, in storage order.
+// A directory holding manifests/ is an artifact store, whose original-json
+// artifacts are resent as they were received; any other directory stands
+// for its wrapper-*.avro files. Files are read as OCF LogWrapper streams.
+// warn is told about files and records that are skipped.
+func readLogs(paths []string, fn func(storedLog) error, warn func(error)) error {
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			if err := readOCF(path, fn, warn); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(path, "manifests")); err == nil {
+			if err := readArtifacts(path, fn, warn); err != nil {
+				return err
+			}
+			continue
+		}
+		files, err := filepath.Glob(filepath.Join(path, "wrapper-*.avro"))
+		if err != nil {
+			return err
+		}
+		if len(files) == 0 {
+			return fmt.Errorf("%s holds neither an artifact store nor wrapper-*.avro files", path)
+		}
+		sort.Strings(files)
+		for _, file := range files {
+			if err := readOCF(file, fn, warn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readArtifacts reads the original JSON of every log in the artifact
+// store in dir, oldest first. Sealed (multi-tenant) stores cannot be read.
+func readArtifacts(dir string, fn func(storedLog) error, warn func(error)) error {
+	store, err := artifact.Open(dir)
+	if err != nil {
+		return err
+	}
+	ids, err := store.IDs()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		body, _, err := store.Get(id, artifact.OriginalJSON)
+		if err != nil {
+			warn(fmt.Errorf("log %s: %w", id, err))
+			continue
+		}
+		if err := fn(storedLog{Source: id, Body: body}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readOCF rebuilds a /log request from every record of the LogWrapper
+// container file at path. A file of another stream is skipped, as is the
+// incomplete last block of a file still being written.
+func readOCF(path string, fn func(storedLog) error, warn func(error)) error {
+	f, err := ocf.OpenFile(path, nil)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	name := filepath.Base(path)
+	index := 0
+	_, _, err = ocf.Scan(f, func(record interface{}) error {
+		body, err := requestFromWrapper(record)
+		if errors.Is(err, errNotWrapper) {
+			return err
+		}
+		if err != nil {
+			warn(fmt.Errorf("%s record %d: %w", name, index, err))
+		} else if err := fn(storedLog{Source: fmt.Sprintf("%s#%d", name, index), Body: body}); err != nil {
+			return err
+		}
+		index++
+		return nil
+	})
+	var scanErr *ocf.ScanError
+	switch {
+	case errors.Is(err, errNotWrapper), errors.As(err, &scanErr):
+		warn(fmt.Errorf("%s: %w", name, err))
+		return nil
+	}
+	return err
+}
+
+// logRequest is the body of POST /log.
+type logRequest struct {
+	ProjectName    string  `json:"projectName"`
+	ProjectVersion string  `json:"projectVersion"`
+	LogLevel       string  `json:"logLevel"`
+	LogType        string  `json:"logType"`
+	LogSource      string  `json:"logSource"`
+	Body           logBody `json:"body"`
+}
+
+type logBody struct {
+	Timestamp  int64       `json:"timestamp"`
+	Logtype    string      `json:"logtype"`
+	Version    string      `json:"version"`
+	Issuer     string      `json:"issuer"`
+	Metadata   interface{} `json:"metadata,omitempty"`
+	DomainData interface{} `json:"domainData,omitempty"`
+}
+
+// requestFromWrapper turns a LogWrapper record back into the /log request
+// it was stored from. Metadata and domainData values were stored as
+// strings, so numbers in them come back quoted; the original-json
+// artifacts keep them as sent.
+func requestFromWrapper(record interface{}) ([]byte, error) {
+	fields, ok := record.(map[string]interface{})
+	if !ok {
+		return nil, errNotWrapper
+	}
+	str := func(name string) (string, bool) { s, ok := fields[name].(string); return s, ok }
+	body, ok := str("body")
+	if _, hasProject := str("projectName"); !ok || !hasProject {
+		return nil, errNotWrapper
+	}
+	codec, err := avrojson.DefaultCache.Get(avrojson.LogDataSchema)
+	if err != nil {
+		return nil, err
+	}
+	var data avrojson.LogData
+	if err := codec.DecodeJSON([]byte(body), &data); err != nil {
+		return nil, fmt.Errorf("decode body: %w", err)
+	}
+	req := logRequest{
+		Body: logBody{
+			Timestamp:  data.Timestamp.UnixMilli(),
+			Logtype:    data.Logtype,
+			Version:    data.Version,
+			Issuer:     data.Issuer,
+			Metadata:   data.Metadata,
+			DomainData: data.DomainData,
+		},
+	}
+	req.ProjectName, _ = str("projectName")
+	req.ProjectVersion, _ = str("projectVersion")
+	req.LogLevel, _ = str("logLevel")
+	req.LogType, _ = str("logType")
+	req.LogSource, _ = str("logSource")
+	return json.Marshal(req)
+}
@@ -0,0 +1,142 @@
+// 코덱 재사용 벤치마크 실행 방법:
+// 1. 전체 비교 실행: go test -run=^$ -bench=CodecReuse -benchmem
+// 2. 스키마 하나만 실행: go test -run=^$ -bench='CodecReuse/characters' -benchmem
+// 3. /log 요청 단위 비교: go test -run=^$ -bench=LogRequestCodec -benchmem
+// new 는 매 반복마다 goavro.NewCodec 으로 스키마를 컴파일하고, cached 는
+// avrojson.Cache 에서 (sha256 키로) 찾고, reused 는 컴파일된 코덱을 그대로 쓴다.
+// schema_bytes 는 스키마 텍스트 크기다.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+	"github.com/linkedin/goavro/v2"
+)
+
+// wideRecordSchema returns a flat record of n fields cycling through the
+// primitive types, so compile cost can be read against schema size alone.
+func wideRecordSchema(n int) string {
+	types := []string{`"long"`, `"string"`, `"double"`, `"boolean"`, `["null","string"]`}
+	fields := make([]string, n)
+	for i := range fields {
+		fields[i] = fmt.Sprintf(`{"name":"field%d","type":%s}`, i, types[i%len(types)])
+	}
+	return `{"type":"record","name":"Wide","fields":[` + strings.Join(fields, ",") + `]}`
+}
+
+// codecReuseSchemas runs from the smallest schema to the largest.
+var codecReuseSchemas = []struct {
+	name, schema string
+}{
+	{"wrapper", avrojson.WrapperSchema},
+	{"simple", simpleRecordSchema},
+	{"logdata", avrojson.LogDataSchema},
+	{"wide16", wideRecordSchema(16)},
+	{"wide64", wideRecordSchema(64)},
+	{"characters", userCharacterSchema},
+	{"wide256", wideRecordSchema(256)},
+}
+
+func BenchmarkCodecReuse(b *testing.B) {
+	for _, s := range codecReuseSchemas {
+		codec, err := avrojson.NewCodec(s.schema)
+		if err != nil {
+			b.Fatalf("Failed to compile %s: %v", s.name, err)
+		}
+		native, err := codec.Sample(1)
+		if err != nil {
+			b.Fatalf("Failed to sample %s: %v", s.name, err)
+		}
+
+		b.Run(s.name+"/new", func(b *testing.B) {
+			b.ReportMetric(float64(len(s.schema)), "schema_bytes")
+			for i := 0; i < b.N; i++ {
+				fresh, err := goavro.NewCodec(s.schema)
+				if err != nil {
+					b.Fatalf("Failed to compile: %v", err)
+				}
+				if _, err := fresh.BinaryFromNative(nil, native); err != nil {
+					b.Fatalf("Failed to encode: %v", err)
+				}
+			}
+		})
+
+		b.Run(s.name+"/cached", func(b *testing.B) {
+			cache := avrojson.NewCache()
+			b.ReportMetric(float64(len(s.schema)), "schema_bytes")
+			for i := 0; i < b.N; i++ {
+				cached, err := cache.Get(s.schema)
+				if err != nil {
+					b.Fatalf("Failed to compile: %v", err)
+				}
+				if _, err := cached.Goavro().BinaryFromNative(nil, native); err != nil {
+					b.Fatalf("Failed to encode: %v", err)
+				}
+			}
+		})
+
+		b.Run(s.name+"/reused", func(b *testing.B) {
+			reused := codec.Goavro()
+			b.ReportMetric(float64(len(s.schema)), "schema_bytes")
+			for i := 0; i < b.N; i++ {
+				if _, err := reused.BinaryFromNative(nil, native); err != nil {
+					b.Fatalf("Failed to encode: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// benchmarkLogRequestCodec encodes a /log request's LogData and LogWrapper
+// to binary and Avro JSON, as avrojson.EncodeLog does, getting both codecs
+// from compile for every log.
+func benchmarkLogRequestCodec(b *testing.B, compile func(schema string) (*goavro.Codec, error)) {
+	encoded, err := encodeLogRequest(warmupPayload(2))
+	if err != nil {
+		b.Fatalf("Failed to encode log: %v", err)
+	}
+	natives := make(map[string]interface{}, 2)
+	for schema, binary := range map[string][]byte{avrojson.LogDataSchema: encoded.LogData, avrojson.WrapperSchema: encoded.Wrapper} {
+		codec, err := avrojson.NewCodec(schema)
+		if err != nil {
+			b.Fatalf("Failed to compile: %v", err)
+		}
+		if natives[schema], err = codec.DecodeNative(binary); err != nil {
+			b.Fatalf("Failed to decode: %v", err)
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, schema := range []string{avrojson.LogDataSchema, avrojson.WrapperSchema} {
+			codec, err := compile(schema)
+			if err != nil {
+				b.Fatalf("Failed to compile: %v", err)
+			}
+			binary, _ := codec.BinaryFromNative(nil, natives[schema])
+			text, _ := codec.TextualFromNative(nil, natives[schema])
+			_, _ = binary, text
+		}
+	}
+}
+
+// BenchmarkLogRequestCodecPerCall compiles both schemas for every log, as
+// logHandler did before avrojson.DefaultCache.
+func BenchmarkLogRequestCodecPerCall(b *testing.B) {
+	benchmarkLogRequestCodec(b, goavro.NewCodec)
+}
+
+func BenchmarkLogRequestCodecCached(b *testing.B) {
+	cache := avrojson.NewCache()
+	benchmarkLogRequestCodec(b, func(schema string) (*goavro.Codec, error) {
+		codec, err := cache.Get(schema)
+		if err != nil {
+			return nil, err
+		}
+		return codec.Goavro(), nil
+	})
+}
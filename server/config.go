@@ -0,0 +1,310 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Every flag can also be set in the YAML file named by -config (keys are
+// flag names) or in an environment variable named envPrefix followed by
+// the flag name in upper case with dashes as underscores, e.g.
+// AVRO_JSON_ARTIFACT_DIR. Command-line flags win over the environment,
+// which wins over the file, which wins over the defaults:
+//
+//	addr: ":9090"
+//	artifact-dir: /var/lib/avro-json/artifacts
+//	cors-origins: [https://console.example.com]
+//	shard-backends:
+//	  - http://10.0.0.1:8080
+//	  - http://10.0.0.2:8080
+//
+// Sequences are joined with commas for the flags that take lists.
+const envPrefix = "AVRO_JSON_"
+
+// Config sources, as reported by -print-config.
+const (
+	sourceDefault = "default"
+	sourceFile    = "file"
+	sourceEnv     = "env"
+	sourceFlag    = "flag"
+)
+
+// configFlags are the flags about configuration itself. They are only read
+// from the command line, except that AVRO_JSON_CONFIG names the file when
+// -config is not given; see configPath.
+var configFlags = map[string]bool{"config": true, "print-config": true, "restore": true}
+
+// secretFlags hold credentials, which a snapshot's configuration leaves
+// out.
+var secretFlags = map[string]bool{"admin-token": true, "replicate-token": true}
+
+// configPath returns the config file named by -config or, failing that,
+// the environment.
+func configPath(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	return os.Getenv(envName("config"))
+}
+
+// applyConfig fills the flags of fs that were not set on the command line
+// from the environment and then from the YAML file at path (which may be
+// empty), and reports where every flag's value came from.
+func applyConfig(fs *flag.FlagSet, path string, environ []string) (map[string]string, error) {
+	sources := make(map[string]string)
+	fs.VisitAll(func(f *flag.Flag) { sources[f.Name] = sourceDefault })
+	fs.Visit(func(f *flag.Flag) { sources[f.Name] = sourceFlag })
+
+	env := make(map[string]string)
+	for _, kv := range environ {
+		if k, v, ok := strings.Cut(kv, "="); ok && strings.HasPrefix(k, envPrefix) {
+			env[k] = v
+		}
+	}
+
+	var file map[string]string
+	if path != "" {
+		var err error
+		if file, err = readConfigFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	var errs []error
+	for name := range file {
+		if fs.Lookup(name) == nil || configFlags[name] {
+			errs = append(errs, fmt.Errorf("%s: unknown setting %q", path, name))
+		}
+	}
+	known := make(map[string]bool)
+	fs.VisitAll(func(f *flag.Flag) {
+		key := envName(f.Name)
+		known[key] = true
+		if sources[f.Name] == sourceFlag || configFlags[f.Name] {
+			return
+		}
+		if value, ok := env[key]; ok {
+			if err := fs.Set(f.Name, value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %v", key, err))
+			}
+			sources[f.Name] = sourceEnv
+		} else if value, ok := file[f.Name]; ok {
+			if err := fs.Set(f.Name, value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %s: %v", path, f.Name, err))
+			}
+			sources[f.Name] = sourceFile
+		}
+	})
+	for key := range env {
+		if !known[key] {
+			errs = append(errs, fmt.Errorf("unknown environment variable %s", key))
+		}
+	}
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return sources, errors.Join(errs...)
+}
+
+// readConfigFile reads a flat YAML mapping of flag names to scalars or
+// sequences of scalars.
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	out := make(map[string]string, len(raw))
+	for name, value := range raw {
+		switch v := value.(type) {
+		case nil:
+			out[name] = ""
+		case []interface{}:
+			items := make([]string, len(v))
+			for i, item := range v {
+				if !isYAMLScalar(item) {
+					return nil, fmt.Errorf("%s: %s: list items must be scalars", path, name)
+				}
+				items[i] = fmt.Sprint(item)
+			}
+			out[name] = strings.Join(items, ",")
+		default:
+			if !isYAMLScalar(v) {
+				return nil, fmt.Errorf("%s: %s: expected a scalar or a list", path, name)
+			}
+			out[name] = fmt.Sprint(v)
+		}
+	}
+	return out, nil
+}
+
+func isYAMLScalar(v interface{}) bool {
+	switch v.(type) {
+	case string, bool, int, int64, uint64, float64:
+		return true
+	}
+	return false
+}
+
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// validateConfig checks the settings other flags' parsers do not, so
+// mistakes fail at startup instead of on first use.
+func validateConfig(fs *flag.FlagSet) error {
+	var errs []error
+	for _, name := range []string{"addr", "tcp-addr", "udp-addr"} {
+		value := fs.Lookup(name).Value.String()
+		if value == "" && name != "addr" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", name, err))
+		}
+		if name != "addr" && fs.Lookup("tenant-file").Value.String() != "" {
+			errs = append(errs, fmt.Errorf("%s: its frames carry no API key, so it cannot be used with -tenant-file", name))
+		}
+	}
+	if _, err := parseCORSOrigins(fs.Lookup("cors-origins").Value.String()); err != nil {
+		errs = append(errs, fmt.Errorf("cors-origins: %v", err))
+	}
+	for _, name := range splitList(fs.Lookup("features").Value.String()) {
+		if err := checkFeature(name); err != nil {
+			errs = append(errs, fmt.Errorf("features: %v", err))
+		}
+	}
+	for _, name := range []string{"max-body-bytes", "max-import-bytes"} {
+		if n, err := strconv.ParseInt(fs.Lookup(name).Value.String(), 10, 64); err == nil && n < 0 {
+			errs = append(errs, fmt.Errorf("%s: must not be negative (0 disables the limit)", name))
+		}
+	}
+	if n, err := strconv.ParseInt(fs.Lookup("max-replication-bytes").Value.String(), 10, 64); err == nil && n <= 0 {
+		errs = append(errs, fmt.Errorf("max-replication-bytes: must be positive"))
+	}
+	if fs.Lookup("standby").Value.String() == "true" && fs.Lookup("replicate-token").Value.String() == "" {
+		errs = append(errs, fmt.Errorf("standby: requires -replicate-token"))
+	}
+	if _, _, err := parseOCFCompression(fs.Lookup("ocf-compression").Value.String()); err != nil {
+		errs = append(errs, fmt.Errorf("ocf-compression: %v", err))
+	}
+	for _, name := range []string{"artifact-max-logs", "artifact-max-bytes"} {
+		if n, err := strconv.ParseInt(fs.Lookup(name).Value.String(), 10, 64); err == nil && n < 0 {
+			errs = append(errs, fmt.Errorf("%s: must not be negative (0 disables the limit)", name))
+		}
+	}
+	if d, err := time.ParseDuration(fs.Lookup("artifact-max-age").Value.String()); err == nil && d < 0 {
+		errs = append(errs, fmt.Errorf("artifact-max-age: must not be negative (0 keeps artifacts)"))
+	}
+	if d, err := time.ParseDuration(fs.Lookup("artifact-retention-interval").Value.String()); err == nil && d <= 0 {
+		errs = append(errs, fmt.Errorf("artifact-retention-interval: must be positive"))
+	}
+	for _, name := range []string{"ocf-block-records", "ocf-sync-interval"} {
+		if n, err := strconv.Atoi(fs.Lookup(name).Value.String()); err == nil && n < 0 {
+			errs = append(errs, fmt.Errorf("%s: must not be negative (0 disables the limit)", name))
+		}
+	}
+	if n, err := strconv.Atoi(fs.Lookup("sink-queue").Value.String()); err == nil && n < 0 {
+		errs = append(errs, fmt.Errorf("sink-queue: must not be negative (0 writes synchronously)"))
+	}
+	if n, err := strconv.Atoi(fs.Lookup("sink-batch").Value.String()); err == nil && n <= 0 {
+		errs = append(errs, fmt.Errorf("sink-batch: must be positive"))
+	}
+	if err := checkSinkFsync(fs.Lookup("sink-fsync").Value.String()); err != nil {
+		errs = append(errs, fmt.Errorf("sink-fsync: %v", err))
+	}
+	if d, err := time.ParseDuration(fs.Lookup("sink-fsync-interval").Value.String()); err == nil && d <= 0 {
+		errs = append(errs, fmt.Errorf("sink-fsync-interval: must be positive"))
+	}
+	for _, backend := range splitList(fs.Lookup("shard-backends").Value.String()) {
+		if u, err := url.Parse(backend); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("shard-backends: %q is not an absolute URL", backend))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// printConfig writes the effective configuration as YAML that -config
+// accepts, with each value's source as a comment. Flags in omit are left
+// out.
+func printConfig(w io.Writer, fs *flag.FlagSet, sources map[string]string, omit map[string]bool) error {
+	doc := &yaml.Node{Kind: yaml.MappingNode}
+	fs.VisitAll(func(f *flag.Flag) {
+		if configFlags[f.Name] || omit[f.Name] {
+			return
+		}
+		value := &yaml.Node{}
+		var v interface{} = f.Value.String()
+		if getter, ok := f.Value.(flag.Getter); ok {
+			v = getter.Get()
+		}
+		if list := splitList(f.Value.String()); listFlags[f.Name] && len(list) > 0 {
+			v = list
+		}
+		if err := value.Encode(v); err != nil {
+			value.SetString(f.Value.String())
+		}
+		key := &yaml.Node{Kind: yaml.ScalarNode, Value: f.Name}
+		if value.Kind == yaml.SequenceNode {
+			// Comments on sequences are lost; put it after the key instead.
+			key.LineComment = sources[f.Name]
+		} else {
+			value.LineComment = sources[f.Name]
+		}
+		doc.Content = append(doc.Content, key, value)
+	})
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// listFlags take comma-separated lists and print as YAML sequences.
+var listFlags = map[string]bool{"cors-origins": true, "features": true, "shard-backends": true, "tls-allowed-sans": true}
+
+// parseCORSOrigins parses -cors-origins: "*" allows any origin, otherwise
+// each entry is a scheme://host[:port] origin.
+func parseCORSOrigins(value string) ([]string, error) {
+	origins := splitList(value)
+	for _, origin := range origins {
+		if origin == "*" {
+			if len(origins) > 1 {
+				return nil, errors.New(`"*" cannot be combined with other origins`)
+			}
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" || u.RawQuery != "" {
+			return nil, fmt.Errorf("%q is not an origin (scheme://host[:port])", origin)
+		}
+	}
+	return origins, nil
+}
+
+// allowedOrigin returns the Access-Control-Allow-Origin value for a
+// request from origin, or "" when it is not allowed.
+func allowedOrigin(origins []string, origin string) string {
+	for _, allowed := range origins {
+		if allowed == "*" {
+			return "*"
+		}
+		if origin != "" && strings.EqualFold(allowed, origin) {
+			return origin
+		}
+	}
+	return ""
+}
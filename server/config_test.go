@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newConfigFlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("addr", ":8080", "")
+	fs.String("tcp-addr", ":8081", "")
+	fs.String("udp-addr", ":8082", "")
+	fs.String("tenant-file", "", "")
+	fs.String("artifact-dir", "avro-logs", "")
+	fs.String("cors-origins", "*", "")
+	fs.String("shard-backends", "", "")
+	fs.Int("warmup", 0, "")
+	fs.String("features", "", "")
+	fs.Int64("max-body-bytes", defaultMaxBodyBytes, "")
+	fs.Int64("max-import-bytes", defaultMaxImportBytes, "")
+	fs.Int64("max-replication-bytes", defaultMaxReplicationBytes, "")
+	fs.Bool("standby", false, "")
+	fs.String("replicate-token", "", "")
+	fs.Bool("self-check", true, "")
+	fs.String("ocf-compression", "null", "")
+	fs.Int("ocf-block-records", 0, "")
+	fs.Int("ocf-sync-interval", 0, "")
+	fs.Duration("artifact-max-age", 0, "")
+	fs.Int64("artifact-max-logs", 0, "")
+	fs.Int64("artifact-max-bytes", 0, "")
+	fs.Duration("artifact-retention-interval", 10*time.Minute, "")
+	fs.Int("sink-queue", 0, "")
+	fs.Int("sink-batch", 64, "")
+	fs.String("sink-fsync", sinkFsyncNone, "")
+	fs.Duration("sink-fsync-interval", time.Second, "")
+	fs.String("config", "", "")
+	fs.Bool("print-config", false, "")
+	return fs
+}
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	return path
+}
+
+func TestApplyConfigPrecedence(t *testing.T) {
+	path := writeConfigFile(t, `
+addr: ":9000"
+artifact-dir: /srv/artifacts
+warmup: 50
+self-check: false
+shard-backends:
+  - http://a:8080
+  - http://b:8080
+`)
+	fs := newConfigFlagSet()
+	if err := fs.Parse([]string{"-addr", ":7000"}); err != nil {
+		t.Fatalf("Failed to parse flags: %v", err)
+	}
+	sources, err := applyConfig(fs, path, []string{"AVRO_JSON_ARTIFACT_DIR=/env/artifacts", "HOME=/root"})
+	if err != nil {
+		t.Fatalf("Failed to apply config: %v", err)
+	}
+
+	want := map[string][2]string{
+		"addr":           {":7000", sourceFlag},
+		"artifact-dir":   {"/env/artifacts", sourceEnv},
+		"warmup":         {"50", sourceFile},
+		"self-check":     {"false", sourceFile},
+		"shard-backends": {"http://a:8080,http://b:8080", sourceFile},
+		"tcp-addr":       {":8081", sourceDefault},
+	}
+	for name, w := range want {
+		if got := fs.Lookup(name).Value.String(); got != w[0] || sources[name] != w[1] {
+			t.Errorf("%s = %q from %s, want %q from %s", name, got, sources[name], w[0], w[1])
+		}
+	}
+	if err := validateConfig(fs); err != nil {
+		t.Errorf("Expected a valid config, got %v", err)
+	}
+
+	// The printed config reads back to the same values.
+	var out bytes.Buffer
+	if err := printConfig(&out, fs, sources, nil); err != nil {
+		t.Fatalf("Failed to print config: %v", err)
+	}
+	if !strings.Contains(out.String(), "# env") || strings.Contains(out.String(), "print-config") {
+		t.Errorf("unexpected printed config:\n%s", out.String())
+	}
+	printed, err := readConfigFile(writeConfigFile(t, out.String()))
+	if err != nil {
+		t.Fatalf("Failed to read printed config: %v", err)
+	}
+	for name := range want {
+		if printed[name] != fs.Lookup(name).Value.String() {
+			t.Errorf("printed %s = %q, want %q", name, printed[name], fs.Lookup(name).Value.String())
+		}
+	}
+}
+
+func TestApplyConfigRejectsInvalidSettings(t *testing.T) {
+	cases := map[string]struct {
+		file    string
+		environ []string
+		want    string
+	}{
+		"unknown key":     {"adr: :9000\n", nil, `unknown setting "adr"`},
+		"config in file":  {"config: other.yaml\n", nil, `unknown setting "config"`},
+		"bad int":         {"warmup: lots\n", nil, "warmup"},
+		"nested":          {"addr: {host: x}\n", nil, "expected a scalar or a list"},
+		"unknown env":     {"", []string{"AVRO_JSON_ADR=:9000"}, "AVRO_JSON_ADR"},
+		"bad env bool":    {"", []string{"AVRO_JSON_SELF_CHECK=maybe"}, "AVRO_JSON_SELF_CHECK"},
+		"malformed yaml":  {"addr: [\n", nil, "config.yaml"},
+		"missing file":    {"-", nil, "no such file"},
+		"env for flagset": {"", []string{"AVRO_JSON_CONFIG=x.yaml"}, ""},
+	}
+	for name, c := range cases {
+		path := ""
+		switch c.file {
+		case "":
+		case "-":
+			path = filepath.Join(t.TempDir(), "missing.yaml")
+		default:
+			path = writeConfigFile(t, c.file)
+		}
+		_, err := applyConfig(newConfigFlagSet(), path, c.environ)
+		if c.want == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: error %v, want it to mention %q", name, err, c.want)
+		}
+	}
+
+	for name, args := range map[string][]string{
+		"bad addr":       {"-addr", "8080"},
+		"bad origin":     {"-cors-origins", "example.com"},
+		"mixed wildcard": {"-cors-origins", "*,https://a.example"},
+		"bad backend":    {"-shard-backends", "a:8080"},
+		"negative limit": {"-max-body-bytes", "-1"},
+		"unknown flag":   {"-features", "delta-encoding,warp-drive"},
+		"bad codec":      {"-ocf-compression", "deflate,logdata=zstd"},
+		"negative block": {"-ocf-block-records", "-1"},
+		"negative age":   {"-artifact-max-age", "-1h"},
+		"negative logs":  {"-artifact-max-logs", "-5"},
+		"zero interval":  {"-artifact-retention-interval", "0s"},
+		"zero batch":     {"-sink-batch", "0"},
+		"fsync policy":   {"-sink-fsync", "always"},
+		"open standby":   {"-standby"},
+		"zero transfer":  {"-max-replication-bytes", "0"},
+		"tenant frames":  {"-tenant-file", "tenants.json"},
+	} {
+		fs := newConfigFlagSet()
+		fs.Parse(args)
+		if err := validateConfig(fs); err == nil {
+			t.Errorf("%s: expected a validation error", name)
+		}
+	}
+}
+
+func TestAllowedOrigin(t *testing.T) {
+	wildcard, _ := parseCORSOrigins("*")
+	listed, err := parseCORSOrigins("https://console.example.com, http://localhost:3000")
+	if err != nil {
+		t.Fatalf("Failed to parse origins: %v", err)
+	}
+	cases := []struct {
+		origins []string
+		origin  string
+		want    string
+	}{
+		{wildcard, "https://x.example", "*"},
+		{wildcard, "", "*"},
+		{listed, "http://localhost:3000", "http://localhost:3000"},
+		{listed, "https://evil.example", ""},
+		{listed, "", ""},
+		{nil, "https://console.example.com", ""},
+	}
+	for _, c := range cases {
+		if got := allowedOrigin(c.origins, c.origin); got != c.want {
+			t.Errorf("allowedOrigin(%v, %q) = %q, want %q", c.origins, c.origin, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/homveloper/exp-avro-json/server/logdb"
+)
+
+// dbSink stores every log's encodings and compression stats in one
+// embedded database file (server/logdb), which /stats/compression
+// aggregates without reading the OCF or artifact directories.
+type dbSink struct {
+	db *logdb.DB
+}
+
+type dbSinkConfig struct {
+	Path string `json:"path"`
+}
+
+// logDB is the db sink's database, nil when none is configured.
+var logDB *logdb.DB
+
+func newDBSink(config dbSinkConfig) (Sink, error) {
+	if config.Path == "" {
+		return nil, errors.New("path is required")
+	}
+	if logDB != nil {
+		return nil, errors.New("only one db sink may be configured")
+	}
+	if tenants != nil {
+		// The file is neither split by project nor sealed.
+		return nil, errors.New("the db sink is not available in multi-tenant mode")
+	}
+	if err := os.MkdirAll(filepath.Dir(config.Path), 0755); err != nil {
+		return nil, err
+	}
+	db, err := logdb.Open(config.Path)
+	if err != nil {
+		return nil, err
+	}
+	logDB = db
+	return dbSink{db: db}, nil
+}
+
+func (s dbSink) Write(ctx context.Context, record sinkRecord) error {
+	encoded := record.Encoded
+	return s.db.Put(logdb.Record{
+		ID:      record.ID,
+		Project: record.Project,
+		LogType: record.LogType,
+		Time:    record.Received,
+		Sizes: logdb.Sizes{
+			OriginalJSON: int64(record.OriginalSize),
+			WrapperAvro:  int64(len(encoded.Wrapper)),
+			LogDataAvro:  int64(len(encoded.LogData)),
+			WrapperJSON:  int64(len(encoded.WrapperJSON)),
+		},
+		Wrapper: encoded.Wrapper,
+		LogData: encoded.LogData,
+	})
+}
+
+func (s dbSink) Sync() error { return s.db.Sync() }
+
+func (s dbSink) Close() error { return s.db.Close() }
+
+func (s dbSink) Dir() string { return filepath.Dir(s.db.Stats().Path) }
+
+func (s dbSink) Stats() gin.H { return gin.H{"db": s.db.Stats()} }
+
+// compressionStatsHandler serves GET /stats/compression: the db sink's logs
+// aggregated per group, with their byte totals and mean compression
+// ratios.
+//
+// Query parameters: since (a duration such as 24h, up to now) or from and
+// to (RFC 3339 or Unix ms, to exclusive) bound the time logs were received;
+// project and logType select logs; group_by is logType, project or empty
+// for one group of everything selected.
+func compressionStatsHandler(c *gin.Context) {
+	if logDB == nil {
+		respondError(c, http.StatusNotFound, codeNotFound, "No db sink is configured")
+		return
+	}
+	q := logdb.Query{Project: c.Query("project"), LogType: c.Query("logType"), GroupBy: c.Query("group_by")}
+	if s := c.Query("since"); s != "" {
+		if c.Query("from") != "" {
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, "since and from are exclusive")
+			return
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, "since must be a positive duration such as 24h")
+			return
+		}
+		q.From = time.Now().Add(-d)
+	}
+	for _, bound := range []struct {
+		param string
+		dst   *time.Time
+	}{{"from", &q.From}, {"to", &q.To}} {
+		if c.Query(bound.param) == "" {
+			continue
+		}
+		t, err := parseExportTime(c.Query(bound.param))
+		if err != nil {
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, bound.param+": "+err.Error())
+			return
+		}
+		*bound.dst = t
+	}
+	groups, err := logDB.Aggregate(q)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, strings.TrimPrefix(err.Error(), "logdb: "))
+		return
+	}
+	resp := gin.H{"groups": groups}
+	if !q.From.IsZero() {
+		resp["from"] = q.From.UTC()
+	}
+	if !q.To.IsZero() {
+		resp["to"] = q.To.UTC()
+	}
+	c.JSON(http.StatusOK, resp)
+}
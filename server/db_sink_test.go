@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/homveloper/exp-avro-json/server/logdb"
+	"go.uber.org/zap"
+)
+
+func TestDBSinkAggregatesCompression(t *testing.T) {
+	logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	sink, err := newDBSink(dbSinkConfig{Path: filepath.Join(t.TempDir(), "db", "logs.db")})
+	if err != nil {
+		t.Fatalf("Failed to open db sink: %v", err)
+	}
+	db := logDB
+	defer func() { db.Close(); logDB = nil }()
+	if _, err := newDBSink(dbSinkConfig{Path: filepath.Join(t.TempDir(), "other.db")}); err == nil {
+		t.Error("expected a second db sink to be rejected")
+	}
+
+	now := time.Now()
+	for i, logType := range []string{"login", "purchase", "login"} {
+		record := testSinkRecord(t, "p")
+		record.ID, record.LogType, record.OriginalSize = string(rune('a'+i)), logType, 400
+		record.Received = now.Add(-time.Duration(i) * time.Hour)
+		if i == 2 {
+			record.Received = now.Add(-48 * time.Hour)
+		}
+		if err := sink.Write(context.Background(), record); err != nil {
+			t.Fatalf("Failed to write log: %v", err)
+		}
+	}
+	stored, err := logDB.Get("a")
+	if err != nil || stored.LogType != "login" || len(stored.Wrapper) == 0 {
+		t.Fatalf("expected the log's encodings to be stored, got %+v: %v", stored, err)
+	}
+
+	r := gin.New()
+	r.GET("/stats/compression", compressionStatsHandler)
+	get := func(target string) (int, []logdb.Group) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		var resp struct {
+			Groups []logdb.Group `json:"groups"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp.Groups
+	}
+
+	code, groups := get("/stats/compression?since=24h&group_by=logType")
+	if code != http.StatusOK || len(groups) != 2 || groups[0].Key != "login" || groups[0].Logs != 1 {
+		t.Fatalf("expected one login and one purchase in the last day, got %d %+v", code, groups)
+	}
+	want := float64(stored.Sizes.WrapperAvro) / 400
+	if login := groups[0]; login.MeanWrapperRatio != want || login.Bytes.OriginalJSON != 400 {
+		t.Errorf("unexpected login group %+v, want wrapper ratio %v", login, want)
+	}
+	if _, groups := get("/stats/compression?logType=login"); len(groups) != 1 || groups[0].Logs != 2 {
+		t.Errorf("expected both logins without a time bound, got %+v", groups)
+	}
+	for _, target := range []string{
+		"/stats/compression?since=yesterday",
+		"/stats/compression?since=1h&from=0",
+		"/stats/compression?to=soon",
+		"/stats/compression?group_by=issuer",
+	} {
+		if code, _ := get(target); code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", target, code)
+		}
+	}
+
+	logDB = nil
+	if code, _ := get("/stats/compression"); code != http.StatusNotFound {
+		t.Errorf("expected 404 without a db sink, got %d", code)
+	}
+}
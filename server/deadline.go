@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// deadlineHeader lets a client give /log and /log/binary a latency budget:
+// an absolute time (RFC 3339 or Unix milliseconds) or a Go duration
+// measured from when the request arrived, such as 250ms. The server
+// reports whether processing and persistence finished within it, records
+// the stage that overran, and skips optional stages once less than
+// -deadline-reserve is left.
+const deadlineHeader = "X-Deadline"
+
+// Stages of a logged request, in order. Decode covers binding, decoding
+// and encoding, everything before the log is stored.
+const (
+	stageDecode    = "decode"
+	stageArtifacts = "artifacts"
+	stageSinks     = "sinks"
+	stageStats     = "stats"
+)
+
+var deadlineStages = []string{stageDecode, stageArtifacts, stageSinks, stageStats}
+
+// Optional parts of the stats stage that a tight budget skips. Block stats
+// cover every size that takes compressing the log: OCF blocks and gzipped
+// JSON.
+const (
+	optionalBlockStats  = "block_stats"
+	optionalExperiments = "experiments"
+)
+
+// deadlineReserve is -deadline-reserve: optional stages are skipped when
+// less than this is left of a request's budget. 0 never skips.
+var deadlineReserve time.Duration
+
+const deadlineContextKey = "deadline"
+
+// requestDeadline tracks one request's budget across its stages. Its
+// methods do nothing on a nil receiver, so handlers call them whether or
+// not the client sent a deadline.
+type requestDeadline struct {
+	start, deadline time.Time
+
+	stage      string
+	stageStart time.Time
+	stages     map[string]time.Duration
+	missedIn   string // the stage running when the deadline passed
+	skipped    []string
+	end        time.Time
+}
+
+// trackDeadline parses X-Deadline and, once the handler returns, records
+// the outcome in /stats. Requests without the header are not tracked.
+func trackDeadline(c *gin.Context) {
+	value := c.GetHeader(deadlineHeader)
+	if value == "" {
+		c.Next()
+		return
+	}
+	now := time.Now()
+	deadline, err := parseDeadline(value, now)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	d := &requestDeadline{start: now, deadline: deadline, stage: stageDecode, stageStart: now, stages: make(map[string]time.Duration)}
+	c.Set(deadlineContextKey, d)
+	c.Next()
+	d.finish()
+	if !isWarmup(c.Request.Context()) {
+		deadlineTotals.record(d)
+	}
+}
+
+func parseDeadline(value string, now time.Time) (time.Time, error) {
+	if budget, err := time.ParseDuration(value); err == nil && budget > 0 {
+		return now.Add(budget), nil
+	}
+	if t, err := parseExportTime(value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%s %q must be an RFC 3339 time, Unix milliseconds or a positive duration such as 250ms", deadlineHeader, value)
+}
+
+// requestDeadlineOf returns the request's deadline, or nil.
+func requestDeadlineOf(c *gin.Context) *requestDeadline {
+	d, _ := c.Get(deadlineContextKey)
+	dd, _ := d.(*requestDeadline)
+	return dd
+}
+
+// enter ends the current stage and starts stage.
+func (d *requestDeadline) enter(stage string) {
+	if d == nil || !d.end.IsZero() {
+		return
+	}
+	now := time.Now()
+	d.closeStage(now)
+	d.stage, d.stageStart = stage, now
+}
+
+func (d *requestDeadline) closeStage(now time.Time) {
+	d.stages[d.stage] += now.Sub(d.stageStart)
+	if d.missedIn == "" && now.After(d.deadline) {
+		d.missedIn = d.stage
+	}
+}
+
+// skip reports whether the optional stage should be skipped because less
+// than deadlineReserve is left, and records it if so.
+func (d *requestDeadline) skip(optional string) bool {
+	if d == nil || deadlineReserve <= 0 || time.Until(d.deadline) >= deadlineReserve {
+		return false
+	}
+	d.skipped = append(d.skipped, optional)
+	return true
+}
+
+// finish ends the last stage. Later calls keep the first end.
+func (d *requestDeadline) finish() {
+	if d == nil || !d.end.IsZero() {
+		return
+	}
+	d.end = time.Now()
+	d.closeStage(d.end)
+}
+
+// report finishes the request's tracking, as processing and persistence
+// are done, and adds its outcome to resp.
+func (d *requestDeadline) report(c *gin.Context, resp gin.H) {
+	if d == nil {
+		return
+	}
+	d.finish()
+	met := d.missedIn == ""
+	c.Header("X-Deadline-Met", strconv.FormatBool(met))
+	stages := gin.H{}
+	for stage, took := range d.stages {
+		stages[stage] = durationMS(took)
+	}
+	out := gin.H{
+		"budget_ms":    durationMS(d.deadline.Sub(d.start)),
+		"elapsed_ms":   durationMS(d.end.Sub(d.start)),
+		"remaining_ms": durationMS(d.deadline.Sub(d.end)),
+		"met":          met,
+		"stages_ms":    stages,
+	}
+	if !met {
+		out["missed_in"] = d.missedIn
+	}
+	if len(d.skipped) > 0 {
+		out["skipped"] = d.skipped
+		c.Header("X-Deadline-Skipped", strings.Join(d.skipped, ","))
+	}
+	resp["deadline"] = out
+}
+
+func durationMS(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// deadlineStats counts the outcomes of tracked requests for /stats.
+type deadlineStats struct {
+	mu       sync.Mutex
+	requests int64
+	met      int64
+	missedIn map[string]int64
+	skipped  map[string]int64
+	overrun  time.Duration // total time past the deadline of missed requests
+}
+
+var deadlineTotals = deadlineStats{missedIn: map[string]int64{}, skipped: map[string]int64{}}
+
+func (s *deadlineStats) record(d *requestDeadline) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	if d.missedIn == "" {
+		s.met++
+	} else {
+		s.missedIn[d.missedIn]++
+		s.overrun += d.end.Sub(d.deadline)
+	}
+	for _, optional := range d.skipped {
+		s.skipped[optional]++
+	}
+}
+
+func (s *deadlineStats) snapshot() gin.H {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.requests == 0 {
+		return nil
+	}
+	missed := s.requests - s.met
+	byStage := gin.H{}
+	for _, stage := range deadlineStages {
+		if n := s.missedIn[stage]; n > 0 {
+			byStage[stage] = n
+		}
+	}
+	skipped := gin.H{}
+	for name, n := range s.skipped {
+		skipped[name] = n
+	}
+	out := gin.H{
+		"requests":         s.requests,
+		"met":              s.met,
+		"missed":           missed,
+		"miss_rate":        float64(missed) / float64(s.requests),
+		"missed_by_stage":  byStage,
+		"skipped_optional": skipped,
+		"reserve_ms":       durationMS(deadlineReserve),
+		"mean_overrun_ms":  0.0,
+	}
+	if missed > 0 {
+		out["mean_overrun_ms"] = durationMS(s.overrun / time.Duration(missed))
+	}
+	return out
+}
+
+func (s *deadlineStats) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests, s.met, s.overrun = 0, 0, 0
+	s.missedIn = map[string]int64{}
+	s.skipped = map[string]int64{}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func TestParseDeadline(t *testing.T) {
+	now := time.UnixMilli(1700000000000).UTC()
+	cases := map[string]time.Time{
+		"250ms":                  now.Add(250 * time.Millisecond),
+		"1700000001000":          time.UnixMilli(1700000001000).UTC(),
+		"2023-11-14T22:13:21.5Z": time.Date(2023, 11, 14, 22, 13, 21, 5e8, time.UTC),
+	}
+	for value, want := range cases {
+		if got, err := parseDeadline(value, now); err != nil || !got.Equal(want) {
+			t.Errorf("%s: got %v, %v; want %v", value, got, err, want)
+		}
+	}
+	for _, bad := range []string{"-1s", "0s", "soon"} {
+		if _, err := parseDeadline(bad, now); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestLogDeadline(t *testing.T) {
+	logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	defer deadlineTotals.reset()
+	defer func() { deadlineReserve = 0 }()
+	r := gin.New()
+	r.POST("/log", trackDeadline, logHandler)
+	post := func(deadline string) (*httptest.ResponseRecorder, map[string]interface{}) {
+		t.Helper()
+		body, _ := json.Marshal(warmupPayload(1))
+		req := httptest.NewRequest(http.MethodPost, "/log", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if deadline != "" {
+			req.Header.Set(deadlineHeader, deadline)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var resp struct {
+			Deadline map[string]interface{} `json:"deadline"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w, resp.Deadline
+	}
+
+	if _, d := post(""); d != nil {
+		t.Errorf("expected no deadline report without the header, got %v", d)
+	}
+	w, d := post("10s")
+	if w.Code != http.StatusOK || d["met"] != true || w.Header().Get("X-Deadline-Met") != "true" {
+		t.Fatalf("expected a met deadline, got %d %v", w.Code, d)
+	}
+	if stages, _ := d["stages_ms"].(map[string]interface{}); len(stages) != len(deadlineStages) {
+		t.Errorf("expected a time for every stage, got %v", d["stages_ms"])
+	}
+
+	// A deadline that passed before the request arrived is missed in the
+	// first stage.
+	w, d = post("1")
+	if d["met"] != false || d["missed_in"] != stageDecode || w.Header().Get("X-Deadline-Met") != "false" {
+		t.Errorf("expected a missed deadline, got %v", d)
+	}
+
+	deadlineReserve = time.Hour
+	w, d = post("10s")
+	if skipped, _ := d["skipped"].([]interface{}); len(skipped) != 2 || w.Header().Get("X-Deadline-Skipped") != optionalBlockStats+","+optionalExperiments {
+		t.Errorf("expected the optional stages to be skipped, got %v", d)
+	}
+
+	if w, _ := post("soon"); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid deadline, got %d", w.Code)
+	}
+	stats := deadlineTotals.snapshot()
+	if stats["requests"] != int64(3) || stats["missed"] != int64(1) || stats["missed_by_stage"].(gin.H)[stageDecode] != int64(1) {
+		t.Errorf("unexpected deadline stats: %v", stats)
+	}
+}
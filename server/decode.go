@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+	"github.com/homveloper/exp-avro-json/server/pkg/columnarjson"
+	"github.com/homveloper/exp-avro-json/server/registry"
+	"go.uber.org/zap"
+)
+
+// decodeRequest is the JSON form of a /decode request. Raw requests send the
+// datum as the body instead, with the schema in the X-Avro-Schema header or
+// the schema query parameter and the other fields as query parameters of
+// the same name.
+type decodeRequest struct {
+	// Schema and Version name the writer schema the datum was encoded with;
+	// version 0 means the latest. A datum in Avro single-object encoding
+	// names its schema by fingerprint, so Schema is then optional.
+	Schema      string `json:"schema"`
+	Version     int    `json:"version"`
+	Data        string `json:"data" binding:"required"`
+	StripUnions bool   `json:"strip_unions"`
+	// ReaderSchema and ReaderVersion, when either is set, resolve the datum
+	// into another registered schema. ReaderSchema defaults to Schema, so
+	// reader_version alone reads old data with a newer version.
+	ReaderSchema  string `json:"reader_schema"`
+	ReaderVersion int    `json:"reader_version"`
+}
+
+// decodeHandler converts one Avro binary datum back to JSON. The body is
+// either raw Avro (application/avro or application/octet-stream), base64
+// text (text/plain) or a JSON decodeRequest. Single-object encoded data is
+// recognized by its header and decoded without it.
+func decodeHandler(c *gin.Context) {
+	var req decodeRequest
+	var data []byte
+	var err error
+
+	mediaType, _, _ := mime.ParseMediaType(c.ContentType())
+	switch mediaType {
+	case "application/json":
+		if err := c.ShouldBindJSON(&req); err != nil {
+			requestLogger(c).Error("Failed to bind decode request", zap.Error(err))
+			respondBindError(c, err)
+			return
+		}
+		if data, err = decodeBase64(req.Data); err != nil {
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, "data is not valid base64")
+			return
+		}
+	case avroContentType, "application/octet-stream", "text/plain":
+		req.Schema = c.GetHeader(avroSchemaHeader)
+		if req.Schema == "" {
+			req.Schema = c.Query("schema")
+		}
+		req.StripUnions, _ = strconv.ParseBool(c.Query("strip_unions"))
+		req.Version, _ = strconv.Atoi(c.Query("version"))
+		req.ReaderSchema = c.Query("reader_schema")
+		req.ReaderVersion, _ = strconv.Atoi(c.Query("reader_version"))
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			requestLogger(c).Error("Failed to read decode request", zap.Error(err))
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+			return
+		}
+		data = body
+		if mediaType == "text/plain" {
+			if data, err = decodeBase64(string(body)); err != nil {
+				respondError(c, http.StatusBadRequest, codeInvalidRequest, "body is not valid base64")
+				return
+			}
+		}
+	default:
+		respondError(c, http.StatusUnsupportedMediaType, codeUnsupportedMediaType, "Content-Type must be application/json, "+avroContentType+", application/octet-stream or text/plain")
+		return
+	}
+
+	// A single-object datum names its schema by fingerprint, and its
+	// version when the request does not. Plain binary may start with the
+	// marker too; only a matching fingerprint makes it a single object.
+	var schema registry.Schema
+	single := false
+	switch {
+	case req.Schema == "":
+		fingerprint, _, err := avrojson.SingleObjectFingerprint(data)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, "schema is required unless data is single-object encoded")
+			return
+		}
+		if schema, err = schemaRegistry.LookupFingerprint(fingerprint); err != nil {
+			respondError(c, http.StatusBadRequest, codeUnknownSchema, "No registered schema has fingerprint "+avrojson.FormatFingerprint(fingerprint))
+			return
+		}
+		req.Schema, single = schema.Name, true
+	case req.Version == 0:
+		if schema, single = singleObjectVersion(req.Schema, data); !single {
+			schema, err = resolveSchema(req.Schema, 0)
+		}
+	default:
+		if schema, err = resolveSchema(req.Schema, req.Version); err == nil {
+			fingerprint, _, ferr := avrojson.SingleObjectFingerprint(data)
+			single = ferr == nil && avrojson.FormatFingerprint(fingerprint) == schema.Fingerprint
+		}
+	}
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeUnknownSchema, "Unknown schema "+strconv.Quote(req.Schema)+" version "+strconv.Itoa(req.Version))
+		return
+	}
+	if single {
+		data = data[avrojson.SingleObjectHeaderSize:]
+	}
+	codec, err := avrojson.DefaultCache.Get(schema.Schema)
+	if err != nil {
+		requestLogger(c).Error("Failed to create Avro codec", zap.String("schema", req.Schema), zap.Error(err))
+		respondError(c, http.StatusInternalServerError, codeInternal, "Failed to create Avro codec")
+		return
+	}
+
+	var resolver *avrojson.Resolver
+	reader := schema
+	if req.ReaderSchema != "" || req.ReaderVersion != 0 {
+		if req.ReaderSchema == "" {
+			req.ReaderSchema = req.Schema
+		}
+		if reader, err = resolveSchema(req.ReaderSchema, req.ReaderVersion); err != nil {
+			respondError(c, http.StatusBadRequest, codeUnknownSchema, "Unknown reader schema "+strconv.Quote(req.ReaderSchema)+" version "+strconv.Itoa(req.ReaderVersion))
+			return
+		}
+		if resolver, err = avrojson.DefaultCache.Resolver(schema.Schema, reader.Schema); err != nil {
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, "Reader schema cannot read writer schema: "+err.Error())
+			return
+		}
+		codec = resolver.Reader()
+	}
+
+	var record interface{}
+	if resolver != nil {
+		record, err = resolver.Decode(data)
+	} else {
+		record, err = codec.DecodeNative(data)
+	}
+	if err != nil {
+		requestLogger(c).Error("Failed to decode Avro datum",
+			zap.String("schema", req.Schema),
+			zap.Int("size_bytes", len(data)),
+			zap.Error(err))
+		respondError(c, http.StatusBadRequest, codeValidationFailed, "Data is not a valid "+req.Schema+" Avro datum: "+err.Error())
+		return
+	}
+	// encoding/json cannot write NaN or infinities.
+	if record, err = codec.FiniteNative(record); err != nil {
+		respondDataError(c, "Data cannot be written as JSON", err)
+		return
+	}
+	if req.StripUnions {
+		if record, err = codec.StripUnions(record); err != nil {
+			requestLogger(c).Error("Failed to strip union wrappers", zap.Error(err))
+			respondError(c, http.StatusInternalServerError, codeEncodeFailed, "Failed to strip union wrappers")
+			return
+		}
+	}
+
+	resp := gin.H{
+		"schema":       schema.Name,
+		"version":      schema.Version,
+		"avro_bytes":   len(data),
+		"strip_unions": req.StripUnions,
+		"record":       record,
+	}
+	if single {
+		resp["single_object"] = true
+	}
+	if resolver != nil {
+		resp["reader_schema"] = reader.Name
+		resp["reader_version"] = reader.Version
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// decodeColumnarHandler expands a columnar container, {schema, field_order,
+// rows} as columnarjson writes it or {schema, field_order, data} as the
+// optimization experiments do, back into one JSON object per row. Rows
+// whose length differs from field_order, or values that do not match the
+// schema, fail the whole request.
+func decodeColumnarHandler(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		requestLogger(c).Error("Failed to read columnar decode request", zap.Error(err))
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	records, err := columnarjson.Objects(body)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"count":          len(records),
+		"columnar_bytes": len(body),
+		"records":        records,
+	})
+}
+
+// decodeBase64 accepts standard and URL-safe base64, with or without padding.
+func decodeBase64(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if data, err := enc.DecodeString(s); err == nil {
+			return data, nil
+		}
+	}
+	return nil, errors.New("invalid base64")
+}
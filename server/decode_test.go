@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+	"go.uber.org/zap"
+)
+
+func newDecodeTestEngine() *gin.Engine {
+	logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	if err := openSchemaRegistry(""); err != nil {
+		panic(err)
+	}
+	r := gin.New()
+	r.POST("/decode", decodeHandler)
+	r.POST("/decode/columnar", decodeColumnarHandler)
+	return r
+}
+
+type decodeResponse struct {
+	Schema    string                 `json:"schema"`
+	AvroBytes int                    `json:"avro_bytes"`
+	Record    map[string]interface{} `json:"record"`
+}
+
+func TestDecodeRoundTrip(t *testing.T) {
+	r := newDecodeTestEngine()
+
+	binary, err := avrojson.Encode(avrojson.LogDataSchema, avrojson.LogData{
+		Timestamp: time.UnixMilli(1700000000000).UTC(),
+		Logtype:   "user_action",
+		Version:   "1.0",
+		Issuer:    "client",
+		Metadata:  map[string]string{"level": "12"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode log data: %v", err)
+	}
+
+	send := func(contentType string, body []byte, target string) decodeResponse {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200 for %s, got %d: %s", contentType, w.Code, w.Body.String())
+		}
+		var resp decodeResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+		return resp
+	}
+
+	raw := send(avroContentType, binary, "/decode?schema=LogData")
+	if raw.AvroBytes != len(binary) || raw.Record["issuer"] != "client" {
+		t.Errorf("unexpected raw decode response: %+v", raw)
+	}
+	if _, wrapped := raw.Record["metadata"].(map[string]interface{})["map"]; !wrapped {
+		t.Errorf("expected Avro JSON union wrapper by default, got %v", raw.Record["metadata"])
+	}
+
+	envelope, _ := json.Marshal(gin.H{
+		"schema":       "LogData",
+		"data":         base64.StdEncoding.EncodeToString(binary),
+		"strip_unions": true,
+	})
+	stripped := send("application/json", envelope, "/decode")
+	metadata, _ := stripped.Record["metadata"].(map[string]interface{})
+	if metadata["level"] != "12" {
+		t.Errorf("expected stripped metadata, got %v", stripped.Record["metadata"])
+	}
+	if stripped.Record["domainData"] != nil {
+		t.Errorf("expected null domainData, got %v", stripped.Record["domainData"])
+	}
+
+	text := send("text/plain", []byte(base64.RawURLEncoding.EncodeToString(binary)), "/decode?schema=LogData&strip_unions=true")
+	if text.Record["logtype"] != "user_action" {
+		t.Errorf("unexpected base64 text decode response: %+v", text)
+	}
+}
+
+func TestDecodeRejectsInvalidInput(t *testing.T) {
+	r := newDecodeTestEngine()
+
+	cases := []struct {
+		name        string
+		target      string
+		contentType string
+		body        string
+		want        int
+	}{
+		{"unsupported content type", "/decode", "application/xml", "<x/>", http.StatusUnsupportedMediaType},
+		{"missing schema", "/decode", avroContentType, "\x02", http.StatusBadRequest},
+		{"invalid base64", "/decode", "application/json", `{"schema":"LogData","data":"!!"}`, http.StatusBadRequest},
+		{"invalid datum", "/decode?schema=LogWrapper", avroContentType, "\x02", http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodPost, tc.target, bytes.NewReader([]byte(tc.body)))
+		req.Header.Set("Content-Type", tc.contentType)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tc.want {
+			t.Errorf("%s: expected %d, got %d: %s", tc.name, tc.want, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestDecodeWithReaderSchema(t *testing.T) {
+	r := newDecodeTestEngine()
+
+	v1 := `{"type":"record","name":"Event","namespace":"exp","fields":[{"name":"kind","type":"string"},{"name":"count","type":"int"}]}`
+	v2 := `{"type":"record","name":"Event","namespace":"exp","fields":[{"name":"kind","type":"string"},{"name":"count","type":"long"},{"name":"source","type":"string","default":"unknown"}]}`
+	v3 := `{"type":"record","name":"Event","namespace":"exp","fields":[{"name":"kind","type":"string"},{"name":"region","type":"string"}]}`
+	for _, schema := range []string{v1, v2, v3} {
+		if _, _, err := schemaRegistry.Register("exp.Event", schema); err != nil {
+			t.Fatalf("Failed to register schema: %v", err)
+		}
+	}
+	binary, err := avrojson.Encode(v1, map[string]interface{}{"kind": "click", "count": 3})
+	if err != nil {
+		t.Fatalf("Failed to encode event: %v", err)
+	}
+
+	post := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, target, bytes.NewReader(binary))
+		req.Header.Set("Content-Type", avroContentType)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := post("/decode?schema=exp.Event&version=1&reader_version=2")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		decodeResponse
+		ReaderVersion int `json:"reader_version"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if resp.ReaderVersion != 2 || resp.Record["source"] != "unknown" || resp.Record["count"] != float64(3) {
+		t.Errorf("unexpected resolved record: %+v", resp)
+	}
+
+	if w := post("/decode?schema=exp.Event&version=1&reader_version=3"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an incompatible reader, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := post("/decode?schema=exp.Event&version=1&reader_version=9"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown reader version, got %d", w.Code)
+	}
+}
+
+func TestDecodeSingleObject(t *testing.T) {
+	r := newDecodeTestEngine()
+
+	v1 := `{"type":"record","name":"Event","namespace":"exp","fields":[{"name":"kind","type":"string"}]}`
+	v2 := `{"type":"record","name":"Event","namespace":"exp","fields":[{"name":"kind","type":"string"},{"name":"source","type":"string","default":"unknown"}]}`
+	for _, schema := range []string{v1, v2} {
+		if _, _, err := schemaRegistry.Register("exp.Event", schema); err != nil {
+			t.Fatalf("Failed to register schema: %v", err)
+		}
+	}
+	codec, _ := avrojson.DefaultCache.Get(v1)
+	single, err := codec.EncodeSingle(map[string]interface{}{"kind": "click"})
+	if err != nil {
+		t.Fatalf("Failed to encode event: %v", err)
+	}
+
+	post := func(target, contentType string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	envelope, _ := json.Marshal(gin.H{"data": base64.StdEncoding.EncodeToString(single)})
+	// The header names the schema and its version, even where the latest
+	// version would be used otherwise.
+	for _, tc := range []struct {
+		target, contentType string
+		body                []byte
+	}{
+		{"/decode", avroContentType, single},
+		{"/decode", "application/json", envelope},
+		{"/decode?schema=exp.Event", avroContentType, single},
+		{"/decode?schema=exp.Event&version=1", avroContentType, single},
+	} {
+		w := post(tc.target, tc.contentType, tc.body)
+		var resp struct {
+			decodeResponse
+			Version      int  `json:"version"`
+			SingleObject bool `json:"single_object"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if w.Code != http.StatusOK || resp.Schema != "exp.Event" || resp.Version != 1 || !resp.SingleObject || resp.Record["kind"] != "click" {
+			t.Errorf("%s (%s): unexpected response %d: %s", tc.target, tc.contentType, w.Code, w.Body.String())
+		}
+	}
+
+	unknown, _ := avrojson.DefaultCache.Get(`{"type":"record","name":"Other","fields":[{"name":"kind","type":"string"}]}`)
+	other, _ := unknown.EncodeSingle(map[string]interface{}{"kind": "click"})
+	if w := post("/decode", avroContentType, other); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unregistered fingerprint, got %d", w.Code)
+	}
+}
+
+func TestDecodeColumnar(t *testing.T) {
+	r := newDecodeTestEngine()
+	schema := `{"type":"record","name":"SimpleRecord","fields":[
+		{"name":"id","type":"long"},
+		{"name":"name","type":"string"},
+		{"name":"tags","type":{"type":"array","items":"string"}},
+		{"name":"settings","type":{"type":"map","values":"string"}}
+	]}`
+	records := generateTestRecords(3)
+	rows := make([]interface{}, len(records))
+	for i, record := range records {
+		rows[i] = []interface{}{record.ID, record.Name, record.Tags, record.Settings}
+	}
+	post := func(data interface{}) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]interface{}{
+			"schema":      schema,
+			"field_order": []string{"id", "name", "tags", "settings"},
+			"data":        data,
+		})
+		req := httptest.NewRequest(http.MethodPost, "/decode/columnar", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := post(rows)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Count   int               `json:"count"`
+		Records []json.RawMessage `json:"records"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if resp.Count != 3 || len(resp.Records) != 3 {
+		t.Fatalf("expected 3 records, got %s", w.Body)
+	}
+	var got SimpleRecord
+	if err := json.Unmarshal(resp.Records[1], &got); err != nil {
+		t.Fatalf("Failed to parse record: %v", err)
+	}
+	want := records[1]
+	if got.ID != want.ID || got.Name != want.Name || len(got.Tags) != len(want.Tags) || got.Settings["theme"] != want.Settings["theme"] {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	if w := post([]interface{}{[]interface{}{1, "ann", []string{}}}); w.Code != http.StatusBadRequest || !bytes.Contains(w.Body.Bytes(), []byte("row 0: 3 values for the 4 fields")) {
+		t.Errorf("Expected 400 for a short row, got %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestDecodeNonFiniteDoubles(t *testing.T) {
+	r := newDecodeTestEngine()
+	schema := `{"type":"record","name":"Reading","namespace":"exp","fields":[{"name":"value","type":"double"}]}`
+	if _, _, err := schemaRegistry.Register("exp.Reading", schema); err != nil {
+		t.Fatalf("Failed to register schema: %v", err)
+	}
+	// Binary holds NaN, whatever the policy.
+	codec, err := avrojson.NewCodec(schema)
+	if err != nil {
+		t.Fatalf("Failed to create codec: %v", err)
+	}
+	binary, err := codec.Goavro().BinaryFromNative(nil, map[string]interface{}{"value": math.NaN()})
+	if err != nil {
+		t.Fatalf("Failed to encode reading: %v", err)
+	}
+	post := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/decode?schema=exp.Reading", bytes.NewReader(binary))
+		req.Header.Set("Content-Type", avroContentType)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := post()
+	var e apiError
+	json.Unmarshal(w.Body.Bytes(), &e)
+	if w.Code != http.StatusBadRequest || e.Code != codeValidationFailed || e.Field != "value" {
+		t.Errorf("expected NaN to be rejected at value, got %d: %s", w.Code, w.Body.String())
+	}
+
+	avrojson.SetNonFinite(avrojson.NonFiniteString)
+	defer avrojson.SetNonFinite(avrojson.NonFiniteReject)
+	w = post()
+	var resp decodeResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusOK || resp.Record["value"] != "NaN" {
+		t.Errorf("expected NaN written as a string, got %d: %s", w.Code, w.Body.String())
+	}
+}
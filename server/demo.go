@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/homveloper/exp-avro-json/server/broker"
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+	"go.uber.org/zap"
+)
+
+// Demo mode runs the whole pipeline in one process:
+//
+//	producer (logHandler) → broker topic → consumer (decoder + indexer)
+//
+// The producer only knows how to publish Avro binaries, the consumer only
+// knows how to decode them; the broker is the sole contract between them.
+// A message names the schema its wrapper body was written with by its
+// fingerprint in the bodyFingerprint header, so project, logType, inferred
+// and versioned bodies decode as well as the built-in LogData.
+const (
+	demoTopic        = "logs.wrapper.avro"
+	demoIndexerGroup = "indexer"
+	demoRecentLimit  = 50
+)
+
+var demoBroker *broker.Broker
+
+// publishDemoRecord hands an encoded wrapper record, whose body is of
+// bodySchema, to the broker. It is a no-op unless demo mode is enabled.
+func publishDemoRecord(ctx context.Context, logID string, req LogRequest, wrapperBinary []byte, bodySchema string) {
+	if demoBroker == nil {
+		return
+	}
+	codec, err := avrojson.DefaultCache.Get(bodySchema)
+	if err != nil {
+		logger.Warn("Failed to publish demo record", zap.Error(err))
+		return
+	}
+	err = demoBroker.Publish(ctx, demoTopic, broker.Message{
+		Key:   req.ProjectName,
+		Value: wrapperBinary,
+		Headers: map[string]string{
+			"logID":           logID,
+			"schema":          "LogWrapper",
+			"bodyFingerprint": avrojson.FormatFingerprint(codec.Fingerprint()),
+			"logType":         req.LogType,
+			"logLevel":        req.LogLevel,
+		},
+	})
+	if err != nil {
+		logger.Warn("Failed to publish demo record", zap.Error(err))
+	}
+}
+
+type demoRecord struct {
+	MessageID   uint64           `json:"message_id"`
+	LogID       string           `json:"log_id"`
+	ProjectName string           `json:"projectName"`
+	LogType     string           `json:"logType"`
+	LogLevel    string           `json:"logLevel"`
+	AvroBytes   int              `json:"avro_bytes"`
+	Body        avrojson.LogData `json:"body"`
+	IndexedAt   time.Time        `json:"indexed_at"`
+}
+
+// demoIndex is the consumer side state: counters plus the latest records.
+type demoIndex struct {
+	mu         sync.RWMutex
+	total      int
+	failures   int
+	avroBytes  int
+	byProject  map[string]int
+	byLogType  map[string]int
+	byLogLevel map[string]int
+	recent     []demoRecord
+}
+
+func newDemoIndex() *demoIndex {
+	return &demoIndex{
+		byProject:  make(map[string]int),
+		byLogType:  make(map[string]int),
+		byLogLevel: make(map[string]int),
+	}
+}
+
+func (idx *demoIndex) add(rec demoRecord) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.total++
+	idx.avroBytes += rec.AvroBytes
+	idx.byProject[rec.ProjectName]++
+	idx.byLogType[rec.LogType]++
+	idx.byLogLevel[rec.LogLevel]++
+	idx.recent = append(idx.recent, rec)
+	if len(idx.recent) > demoRecentLimit {
+		idx.recent = idx.recent[len(idx.recent)-demoRecentLimit:]
+	}
+}
+
+func (idx *demoIndex) fail() {
+	idx.mu.Lock()
+	idx.failures++
+	idx.mu.Unlock()
+}
+
+func (idx *demoIndex) snapshot() gin.H {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	recent := make([]demoRecord, len(idx.recent))
+	copy(recent, idx.recent)
+	return gin.H{
+		"indexed":      idx.total,
+		"failures":     idx.failures,
+		"avro_bytes":   idx.avroBytes,
+		"by_project":   copyCounts(idx.byProject),
+		"by_log_type":  copyCounts(idx.byLogType),
+		"by_log_level": copyCounts(idx.byLogLevel),
+		"recent":       recent,
+	}
+}
+
+func copyCounts(m map[string]int) map[string]int {
+	out := make(map[string]int, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+// runDemoIndexer consumes wrapper binaries until the subscription closes,
+// decoding both the wrapper and its Avro JSON body.
+func runDemoIndexer(messages <-chan broker.Message, idx *demoIndex) error {
+	for msg := range messages {
+		rec, err := decodeDemoRecord(msg)
+		if err != nil {
+			idx.fail()
+			logger.Warn("Demo indexer failed to decode record", zap.Uint64("message_id", msg.ID), zap.Error(err))
+		} else {
+			idx.add(rec)
+		}
+		demoBroker.Ack(demoIndexerGroup, msg)
+	}
+	return nil
+}
+
+// decodeDemoRecord decodes a message's wrapper and its body, with the
+// schema of the message's bodyFingerprint.
+func decodeDemoRecord(msg broker.Message) (demoRecord, error) {
+	bodySchema, err := demoBodySchema(msg.Headers["bodyFingerprint"])
+	if err != nil {
+		return demoRecord{}, err
+	}
+	var wrapper avrojson.LogWrapper
+	if err := avrojson.Decode(avrojson.WrapperSchema, msg.Value, &wrapper); err != nil {
+		return demoRecord{}, fmt.Errorf("decode wrapper: %w", err)
+	}
+	codec, err := avrojson.DefaultCache.Get(bodySchema)
+	if err != nil {
+		return demoRecord{}, err
+	}
+	var body avrojson.LogData
+	if err := codec.DecodeJSON([]byte(wrapper.Body), &body); err != nil {
+		return demoRecord{}, fmt.Errorf("decode log data: %w", err)
+	}
+
+	return demoRecord{
+		MessageID:   msg.ID,
+		LogID:       msg.Headers["logID"],
+		ProjectName: wrapper.ProjectName,
+		LogType:     wrapper.LogType,
+		LogLevel:    wrapper.LogLevel,
+		AvroBytes:   len(msg.Value),
+		Body:        body,
+		IndexedAt:   time.Now(),
+	}, nil
+}
+
+// demoBodySchema returns the schema with the hex fingerprint, the
+// built-in LogData's or a registered one.
+func demoBodySchema(fingerprint string) (string, error) {
+	codec, err := avrojson.DefaultCache.Get(avrojson.LogDataSchema)
+	if err != nil {
+		return "", err
+	}
+	if fingerprint == avrojson.FormatFingerprint(codec.Fingerprint()) {
+		return avrojson.LogDataSchema, nil
+	}
+	n, err := strconv.ParseUint(fingerprint, 16, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid body fingerprint %q", fingerprint)
+	}
+	if schemaRegistry == nil {
+		return "", fmt.Errorf("no registry to look up body fingerprint %s", fingerprint)
+	}
+	s, err := schemaRegistry.LookupFingerprint(n)
+	if err != nil {
+		return "", fmt.Errorf("body fingerprint %s: %w", fingerprint, err)
+	}
+	return s.Schema, nil
+}
+
+// startDemoPipeline wires the broker and consumer and registers the
+// inspection endpoint.
+func startDemoPipeline(r *gin.Engine, bufferSize int) {
+	demoBroker = broker.New(bufferSize)
+	idx := newDemoIndex()
+	messages := demoBroker.Subscribe(demoTopic, demoIndexerGroup)
+
+	go func() {
+		if err := runDemoIndexer(messages, idx); err != nil {
+			logger.Error("Demo indexer stopped", zap.Error(err))
+		}
+	}()
+
+	r.GET("/demo/index", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"index":  idx.snapshot(),
+			"broker": demoBroker.Stats(),
+		})
+	})
+
+	logger.Info("Demo pipeline started",
+		zap.String("topic", demoTopic),
+		zap.String("consumer_group", demoIndexerGroup),
+		zap.Int("buffer_size", bufferSize))
+}
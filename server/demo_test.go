@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/homveloper/exp-avro-json/server/broker"
+)
+
+func TestDemoIndexerDecodesBodySchemas(t *testing.T) {
+	r := newSchemaTestEngine(t)
+	if w := doJSON(r, http.MethodPost, "/schemas", gin.H{"name": logTypeSubject("USER_ACTION"), "schema": userActionSchema(t)}); w.Code != http.StatusCreated {
+		t.Fatalf("Failed to register USER_ACTION schema: %d %s", w.Code, w.Body.String())
+	}
+	demoBroker = broker.New(4)
+	defer func() { demoBroker = nil }()
+	messages := demoBroker.Subscribe(demoTopic, demoIndexerGroup)
+
+	for _, req := range []LogRequest{
+		warmupPayload(1),
+		userActionRequest(map[string]interface{}{"login_method": "password", "success": true, "duration_ms": 42}),
+	} {
+		encoded, err := encodeLogRequest(req)
+		if err != nil {
+			t.Fatalf("Failed to encode %s log: %v", req.LogType, err)
+		}
+		publishDemoRecord(context.Background(), "id", req, encoded.Wrapper, encoded.LogDataSchema)
+		rec, err := decodeDemoRecord(<-messages)
+		if err != nil {
+			t.Fatalf("Failed to decode %s record: %v", req.LogType, err)
+		}
+		if rec.LogType != req.LogType || rec.Body.Logtype != req.LogBody.Logtype {
+			t.Errorf("unexpected %s record %+v", req.LogType, rec)
+		}
+	}
+
+	if _, err := decodeDemoRecord(broker.Message{Headers: map[string]string{"bodyFingerprint": "0000000000000001"}}); err == nil {
+		t.Error("expected a record of an unknown body schema to fail")
+	}
+}
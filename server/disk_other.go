@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || freebsd)
+
+package main
+
+import "errors"
+
+// diskFree cannot tell free space where there is no statfs.
+func diskFree(dir string) (int64, error) {
+	return 0, errors.New("free disk space is not available on this platform")
+}
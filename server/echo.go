@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Echo policies control how much of the Avro JSON encodings /log returns.
+// Echoing both strings in full roughly doubles response bandwidth for large
+// payloads, so benchmarks can truncate or drop them. The server default
+// comes from -echo and -echo-max-bytes; ?echo= and ?echo_bytes= override it
+// per request.
+const (
+	echoFull     = "full"
+	echoTruncate = "truncate"
+	echoOmit     = "omit"
+)
+
+type echoPolicy struct {
+	Mode     string `json:"policy"`
+	MaxBytes int    `json:"max_bytes,omitempty"`
+}
+
+// The default truncates: the complete encodings are downloadable through
+// the artifact links in the response.
+var defaultEcho = echoPolicy{Mode: echoTruncate, MaxBytes: 1024}
+
+func parseEchoPolicy(mode string, maxBytes int) (echoPolicy, error) {
+	switch mode {
+	case echoFull, echoOmit:
+		return echoPolicy{Mode: mode}, nil
+	case echoTruncate:
+		if maxBytes < 1 {
+			return echoPolicy{}, fmt.Errorf("echo max bytes must be positive, got %d", maxBytes)
+		}
+		return echoPolicy{Mode: mode, MaxBytes: maxBytes}, nil
+	}
+	return echoPolicy{}, fmt.Errorf("unknown echo policy %q (expected full, truncate or omit)", mode)
+}
+
+// requestEchoPolicy applies the request's query overrides to defaultEcho.
+func requestEchoPolicy(c *gin.Context) (echoPolicy, error) {
+	mode, maxBytes := defaultEcho.Mode, defaultEcho.MaxBytes
+	if v := c.Query("echo"); v != "" {
+		mode = v
+	}
+	if v := c.Query("echo_bytes"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return echoPolicy{}, fmt.Errorf("echo_bytes must be an integer")
+		}
+		maxBytes = n
+		if c.Query("echo") == "" {
+			mode = echoTruncate
+		}
+	}
+	if mode == echoTruncate && maxBytes == 0 {
+		maxBytes = 1024
+	}
+	return parseEchoPolicy(mode, maxBytes)
+}
+
+// apply adds the Avro JSON encodings to resp according to the policy. Any
+// policy other than full also reports the original sizes under "echo".
+func (p echoPolicy) apply(resp gin.H, wrapperJSON, logDataJSON []byte) {
+	if p.Mode == echoFull {
+		resp["wrapper_avro_json"] = string(wrapperJSON)
+		resp["logdata_avro_json"] = string(logDataJSON)
+		return
+	}
+
+	echo := gin.H{
+		"policy":                 p.Mode,
+		"wrapper_avro_json_size": len(wrapperJSON),
+		"logdata_avro_json_size": len(logDataJSON),
+	}
+	if p.Mode == echoTruncate {
+		wrapper, wrapperCut := truncateUTF8(wrapperJSON, p.MaxBytes)
+		logData, logDataCut := truncateUTF8(logDataJSON, p.MaxBytes)
+		resp["wrapper_avro_json"] = wrapper
+		resp["logdata_avro_json"] = logData
+		echo["max_bytes"] = p.MaxBytes
+		echo["truncated"] = wrapperCut || logDataCut
+	}
+	resp["echo"] = echo
+}
+
+// truncateUTF8 returns at most n bytes of b without splitting a rune.
+func truncateUTF8(b []byte, n int) (string, bool) {
+	if len(b) <= n {
+		return string(b), false
+	}
+	for n > 0 && !utf8.RuneStart(b[n]) {
+		n--
+	}
+	return string(b[:n]), true
+}
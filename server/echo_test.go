@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func postLog(t *testing.T, target string) (int, map[string]interface{}) {
+	t.Helper()
+	logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/log", logHandler)
+
+	body, _ := json.Marshal(warmupPayload(2))
+	req := httptest.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var resp map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	return w.Code, resp
+}
+
+func TestLogEchoPolicies(t *testing.T) {
+	code, full := postLog(t, "/log?echo=full")
+	if code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %v", code, full)
+	}
+	if _, ok := full["echo"]; ok {
+		t.Errorf("full policy should keep the original response shape: %v", full)
+	}
+	fullLogData := full["logdata_avro_json"].(string)
+
+	_, truncated := postLog(t, "/log?echo_bytes=32")
+	echo := truncated["echo"].(map[string]interface{})
+	if echo["policy"] != echoTruncate || echo["truncated"] != true {
+		t.Errorf("unexpected echo block: %v", echo)
+	}
+	// goavro does not keep map order stable, so only the length is comparable.
+	if got := truncated["logdata_avro_json"].(string); len(got) != 32 {
+		t.Errorf("expected 32 bytes, got %q", got)
+	}
+	if int(echo["logdata_avro_json_size"].(float64)) != len(fullLogData) {
+		t.Errorf("echo should report the full size: %v", echo)
+	}
+
+	_, byDefault := postLog(t, "/log")
+	if echo, _ := byDefault["echo"].(map[string]interface{}); echo["policy"] != echoTruncate {
+		t.Errorf("expected responses to be truncated by default: %v", byDefault["echo"])
+	}
+
+	_, omitted := postLog(t, "/log?echo=omit")
+	if _, ok := omitted["wrapper_avro_json"]; ok {
+		t.Errorf("omit policy still returned wrapper_avro_json")
+	}
+	stats, _ := omitted["compression_stats"].(map[string]interface{})
+	if stats == nil {
+		t.Errorf("omit policy dropped compression stats")
+	} else if size, _ := stats["gzip_json_size"].(float64); size == 0 || size >= stats["original_json_size"].(float64) {
+		t.Errorf("expected a gzipped JSON size below the JSON size: %v", stats)
+	}
+
+	for _, target := range []string{"/log?echo=some", "/log?echo=truncate&echo_bytes=-1", "/log?echo_bytes=x"} {
+		if code, resp := postLog(t, target); code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d: %v", target, code, resp)
+		}
+	}
+}
+
+func TestTruncateUTF8(t *testing.T) {
+	s := []byte(strings.Repeat("가", 4)) // 3 bytes per rune
+	got, cut := truncateUTF8(s, 5)
+	if !cut || got != "가" || !utf8.ValidString(got) {
+		t.Errorf("truncateUTF8 split a rune: %q", got)
+	}
+	if got, cut := truncateUTF8(s, 100); cut || got != string(s) {
+		t.Errorf("short input should be returned whole")
+	}
+}
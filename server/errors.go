@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+)
+
+// Error codes of failed responses. Clients branch on these; the messages
+// are for people and may change.
+const (
+	// codeInvalidRequest is a body, parameter or header that cannot be
+	// parsed or is out of range.
+	codeInvalidRequest = "invalid_request"
+	// codeValidationFailed is a request that parses but does not fit its
+	// schema: a required field is missing, a value has the wrong type or
+	// an Avro datum does not decode. Field names the offending field when
+	// it is known.
+	codeValidationFailed = "validation_failed"
+	// codeUnknownSchema is a schema name, version or fingerprint that is
+	// not registered.
+	codeUnknownSchema = "unknown_schema"
+	// codeSchemaPinned is a body of another version than the project's
+	// hard pin.
+	codeSchemaPinned = "schema_pinned"
+	// codeEncodeFailed is a valid request the server failed to convert
+	// between JSON and Avro.
+	codeEncodeFailed = "encode_failed"
+	// codeStorageFailed is a failed read or write of the artifact store or
+	// the OCF files.
+	codeStorageFailed = "storage_failed"
+	// codeSinkFailed is a log a sink failed to write. Sinks never fail the
+	// request, so it appears in the sink_errors of a logged response.
+	codeSinkFailed = "sink_failed"
+	// codePluginRejected is a log a plugin's transform or filter stage
+	// refused; plugin names it.
+	codePluginRejected = "plugin_rejected"
+
+	codeNotFound             = "not_found"
+	codeConflict             = "conflict"
+	codeUnauthorized         = "unauthorized"
+	codeForbidden            = "forbidden"
+	codeUnsupportedMediaType = "unsupported_media_type"
+	codeNotAcceptable        = "not_acceptable"
+	codeBodyTooLarge         = "body_too_large"
+	codeResponseTooLarge     = "response_too_large"
+	codeQuotaExceeded        = "quota_exceeded"
+	codeUpgradeRequired      = "upgrade_required"
+	codeNotImplemented       = "not_implemented"
+	codeBackendUnavailable   = "backend_unavailable"
+	codeInternal             = "internal"
+)
+
+// apiError is the body of every failed response. Message is sent under
+// the "message" key and, for clients that read it before codes existed,
+// under "error" too.
+type apiError struct {
+	Code      string `json:"code"`
+	Message   string `json:"error"`
+	Field     string `json:"field,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+func (e apiError) MarshalJSON() ([]byte, error) {
+	type plain apiError
+	return json.Marshal(struct {
+		plain
+		Text string `json:"message"`
+	}{plain(e), e.Message})
+}
+
+// respondError ends the request with status and an apiError of code.
+func respondError(c *gin.Context, status int, code, message string) {
+	respondErrorWith(c, status, apiError{Code: code, Message: message}, nil)
+}
+
+// respondErrorWith ends the request with e, its request ID filled in, and
+// extra keys such as the values a parameter accepts next to its fields.
+func respondErrorWith(c *gin.Context, status int, e apiError, extra gin.H) {
+	e.RequestID = requestID(c)
+	if len(extra) == 0 {
+		c.AbortWithStatusJSON(status, e)
+		return
+	}
+	body := gin.H{"code": e.Code, "message": e.Message, "error": e.Message, "request_id": e.RequestID}
+	if e.Field != "" {
+		body["field"] = e.Field
+	}
+	for k, v := range extra {
+		body[k] = v
+	}
+	c.AbortWithStatusJSON(status, body)
+}
+
+// errorBody encodes an apiError for responses written without a gin
+// context, such as transport frames.
+func errorBody(code, message string) []byte {
+	body, _ := json.Marshal(apiError{Code: code, Message: message})
+	return body
+}
+
+// respondBindError answers a failed ShouldBindJSON: validation_failed with
+// the field for a missing field or a value of the wrong type, otherwise
+// invalid_request.
+func respondBindError(c *gin.Context, err error) {
+	e := apiError{Code: codeInvalidRequest, Message: err.Error()}
+	if field, ok := bindErrorField(err); ok {
+		e.Code, e.Field = codeValidationFailed, field
+	}
+	respondErrorWith(c, http.StatusBadRequest, e, nil)
+}
+
+// respondDataError answers client data that failed to convert with
+// validation_failed, naming the field of a NaN or infinite value the
+// -non-finite policy rejected.
+func respondDataError(c *gin.Context, message string, err error) {
+	e := apiError{Code: codeValidationFailed, Message: message + ": " + err.Error()}
+	var nf *avrojson.NonFiniteError
+	if errors.As(err, &nf) {
+		e.Field = nf.Path
+	}
+	respondErrorWith(c, http.StatusBadRequest, e, nil)
+}
+
+// bindErrorField returns the JSON path of the field a binding error is
+// about, such as body.timestamp.
+func bindErrorField(err error) (string, bool) {
+	var invalid validator.ValidationErrors
+	if errors.As(err, &invalid) && len(invalid) > 0 {
+		// The namespace starts with the request type's name.
+		ns := invalid[0].Namespace()
+		if i := strings.IndexByte(ns, '.'); i >= 0 {
+			ns = ns[i+1:]
+		}
+		return ns, true
+	}
+	var wrongType *json.UnmarshalTypeError
+	if errors.As(err, &wrongType) {
+		return wrongType.Field, true
+	}
+	return "", false
+}
+
+func init() {
+	// Report fields by their JSON names rather than the Go ones.
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(f reflect.StructField) string {
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "" || name == "-" {
+				return f.Name
+			}
+			return name
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestErrorResponses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(requestIDMiddleware)
+	r.POST("/bind", func(c *gin.Context) {
+		var req LogRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondBindError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+	r.GET("/extra", func(c *gin.Context) {
+		respondErrorWith(c, http.StatusConflict, apiError{Code: codeConflict, Message: "taken"}, gin.H{"version": 2})
+	})
+	post := func(body, requestID string) (*httptest.ResponseRecorder, apiError) {
+		req := httptest.NewRequest(http.MethodPost, "/bind", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if requestID != "" {
+			req.Header.Set(requestIDHeader, requestID)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var e apiError
+		json.Unmarshal(w.Body.Bytes(), &e)
+		return w, e
+	}
+
+	valid := `{"projectName":"p","projectVersion":"1","logLevel":"info","logType":"t","logSource":"s","body":{"timestamp":1,"logtype":"t","version":"1","issuer":"i"}}`
+	for name, c := range map[string]struct {
+		body, code, field string
+	}{
+		"missing field": {strings.Replace(valid, `"issuer":"i"`, `"issuer":""`, 1), codeValidationFailed, "body.issuer"},
+		"wrong type":    {strings.Replace(valid, `"timestamp":1`, `"timestamp":"soon"`, 1), codeValidationFailed, "body.timestamp"},
+		"not JSON":      {`{"projectName":`, codeInvalidRequest, ""},
+	} {
+		w, e := post(c.body, "")
+		if w.Code != http.StatusBadRequest || e.Code != c.code || e.Field != c.field || e.Message == "" {
+			t.Errorf("%s: unexpected response %d %s", name, w.Code, w.Body.String())
+		}
+		var body map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &body)
+		if body["message"] != e.Message {
+			t.Errorf("%s: expected the message under both message and error, got %s", name, w.Body.String())
+		}
+		if e.RequestID == "" || w.Header().Get(requestIDHeader) != e.RequestID {
+			t.Errorf("%s: expected the request ID %q in the body and header", name, w.Header().Get(requestIDHeader))
+		}
+	}
+
+	if w, e := post(`{}`, "trace-42"); e.RequestID != "trace-42" || w.Header().Get(requestIDHeader) != "trace-42" {
+		t.Errorf("expected the caller's request ID to be kept, got %q", e.RequestID)
+	}
+	if _, e := post(`{}`, "forged\tline"); e.RequestID == "" || e.RequestID == "forged\tline" {
+		t.Errorf("expected an unusable request ID to be replaced, got %q", e.RequestID)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/extra", nil))
+	var extra map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &extra)
+	if extra["message"] != "taken" || extra["error"] != "taken" || extra["version"] != float64(2) {
+		t.Errorf("expected the message and extra keys, got %s", w.Body.String())
+	}
+	if w, _ := post(valid, ""); w.Code != http.StatusNoContent || w.Header().Get(requestIDHeader) == "" {
+		t.Errorf("expected a request ID on successful responses too, got %d %v", w.Code, w.Header())
+	}
+}
@@ -0,0 +1,426 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/homveloper/exp-avro-json/server/ocf"
+)
+
+// Experiments compare encoding strategies on live /log traffic. Each one
+// takes a fraction of the logs of the projects its feature flag is on for
+// (all projects without one) and assigns each log to an arm at random by
+// weight. The arm's strategy encodes the log and its size, latency and
+// errors are recorded; the log itself is still stored as usual. Loaded from
+// -experiment-file:
+//
+//	{"experiments": [{"name": "block-codec", "fraction": 0.2,
+//	  "arms": [{"name": "control", "strategy": "avro-binary"},
+//	           {"name": "snappy", "strategy": "avro-snappy", "weight": 2}]}]}
+//
+// The first arm is the control the others are compared with in
+// GET /stats/experiments.
+type experimentConfig struct {
+	Name     string          `json:"name"`
+	Feature  string          `json:"feature"`
+	Fraction float64         `json:"fraction"`
+	Arms     []experimentArm `json:"arms"`
+}
+
+type experimentArm struct {
+	Name     string `json:"name"`
+	Strategy string `json:"strategy"`
+	Weight   int    `json:"weight"`
+}
+
+// encodingStrategy encodes a log and returns its size in bytes.
+type encodingStrategy func(req LogRequest) (int, error)
+
+// encodingStrategies are the strategies arms can use. Experimental
+// encoders register theirs here.
+var encodingStrategies = map[string]encodingStrategy{
+	// The LogWrapper datum /log stores.
+	"avro-binary": func(req LogRequest) (int, error) {
+		encoded, err := encodeLogRequest(req)
+		if err != nil {
+			return 0, err
+		}
+		return len(encoded.Wrapper), nil
+	},
+	"avro-json": func(req LogRequest) (int, error) {
+		encoded, err := encodeLogRequest(req)
+		if err != nil {
+			return 0, err
+		}
+		return len(encoded.WrapperJSON), nil
+	},
+	"avro-deflate": blockStrategy(ocf.CompressionDeflate),
+	"avro-snappy":  blockStrategy(ocf.CompressionSnappy),
+	"json": func(req LogRequest) (int, error) {
+		data, err := json.Marshal(req)
+		return len(data), err
+	},
+}
+
+// blockStrategy measures the LogWrapper datum as an OCF block compressed
+// with compression.
+func blockStrategy(compression string) encodingStrategy {
+	return func(req LogRequest) (int, error) {
+		encoded, err := encodeLogRequest(req)
+		if err != nil {
+			return 0, err
+		}
+		return ocf.BlockSize(compression, encoded.Wrapper)
+	}
+}
+
+// latencyReservoir is how many latencies each arm keeps for percentiles.
+const latencyReservoir = 1024
+
+type experiment struct {
+	config     experimentConfig
+	strategies []encodingStrategy
+	total      int // sum of arm weights
+
+	mu      sync.Mutex
+	started time.Time
+	arms    []*armOutcomes
+}
+
+// armOutcomes accumulates one arm's results. Sizes and latencies use
+// Welford's running mean and variance; errors count separately.
+type armOutcomes struct {
+	samples   int64
+	errors    int64
+	size      runningStats
+	latency   runningStats // microseconds
+	reservoir []float64
+	seen      int64
+}
+
+type runningStats struct {
+	n    int64
+	mean float64
+	m2   float64
+}
+
+func (s *runningStats) add(x float64) {
+	s.n++
+	d := x - s.mean
+	s.mean += d / float64(s.n)
+	s.m2 += d * (x - s.mean)
+}
+
+func (s runningStats) variance() float64 {
+	if s.n < 2 {
+		return 0
+	}
+	return s.m2 / float64(s.n-1)
+}
+
+var (
+	experimentsMu sync.RWMutex
+	experiments   []*experiment
+)
+
+func loadExperiments(path string) error {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var file struct {
+		Experiments []experimentConfig `json:"experiments"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("parse experiment file: %w", err)
+	}
+	var loaded []*experiment
+	names := make(map[string]bool)
+	for _, config := range file.Experiments {
+		e, err := newExperiment(config)
+		if err != nil {
+			return err
+		}
+		if names[config.Name] {
+			return fmt.Errorf("experiment %q is defined twice", config.Name)
+		}
+		names[config.Name] = true
+		loaded = append(loaded, e)
+	}
+	experimentsMu.Lock()
+	experiments = loaded
+	experimentsMu.Unlock()
+	return nil
+}
+
+func newExperiment(config experimentConfig) (*experiment, error) {
+	if config.Name == "" {
+		return nil, errors.New("experiment without a name")
+	}
+	if config.Feature != "" {
+		if err := checkFeature(config.Feature); err != nil {
+			return nil, fmt.Errorf("experiment %q: %w", config.Name, err)
+		}
+	}
+	if config.Fraction == 0 {
+		config.Fraction = 1
+	}
+	if config.Fraction < 0 || config.Fraction > 1 {
+		return nil, fmt.Errorf("experiment %q: fraction must be in (0, 1]", config.Name)
+	}
+	if len(config.Arms) < 2 {
+		return nil, fmt.Errorf("experiment %q needs a control and at least one other arm", config.Name)
+	}
+	e := &experiment{started: time.Now()}
+	arms := make(map[string]bool)
+	for i := range config.Arms {
+		arm := &config.Arms[i]
+		strategy, ok := encodingStrategies[arm.Strategy]
+		if !ok {
+			return nil, fmt.Errorf("experiment %q: arm %q has unknown strategy %q", config.Name, arm.Name, arm.Strategy)
+		}
+		if arm.Name == "" || arms[arm.Name] {
+			return nil, fmt.Errorf("experiment %q: arm names must be set and unique", config.Name)
+		}
+		arms[arm.Name] = true
+		if arm.Weight == 0 {
+			arm.Weight = 1
+		}
+		if arm.Weight < 0 {
+			return nil, fmt.Errorf("experiment %q: arm %q has a negative weight", config.Name, arm.Name)
+		}
+		e.strategies = append(e.strategies, strategy)
+		e.total += arm.Weight
+		e.arms = append(e.arms, &armOutcomes{})
+	}
+	e.config = config
+	return e, nil
+}
+
+// runExperiments assigns the log to an arm of every experiment it enters,
+// records the outcome and reports the assignments in resp.
+func runExperiments(resp gin.H, req LogRequest) {
+	experimentsMu.RLock()
+	defer experimentsMu.RUnlock()
+	if len(experiments) == 0 {
+		return
+	}
+	assigned := gin.H{}
+	for _, e := range experiments {
+		if e.config.Feature != "" && !features.Enabled(e.config.Feature, req.ProjectName) {
+			continue
+		}
+		if rand.Float64() >= e.config.Fraction {
+			continue
+		}
+		arm := e.pick(rand.Intn(e.total))
+		start := time.Now()
+		size, err := e.strategies[arm](req)
+		e.record(arm, size, time.Since(start), err)
+		assigned[e.config.Name] = e.config.Arms[arm].Name
+	}
+	if len(assigned) > 0 {
+		resp["experiments"] = assigned
+	}
+}
+
+func (e *experiment) pick(n int) int {
+	for i, arm := range e.config.Arms {
+		if n < arm.Weight {
+			return i
+		}
+		n -= arm.Weight
+	}
+	return len(e.config.Arms) - 1
+}
+
+func (e *experiment) record(arm, size int, latency time.Duration, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	o := e.arms[arm]
+	o.samples++
+	if err != nil {
+		o.errors++
+		return
+	}
+	o.size.add(float64(size))
+	us := float64(latency) / float64(time.Microsecond)
+	o.latency.add(us)
+	// Reservoir sampling keeps a uniform sample of every latency seen.
+	o.seen++
+	if len(o.reservoir) < latencyReservoir {
+		o.reservoir = append(o.reservoir, us)
+	} else if i := rand.Int63n(o.seen); i < latencyReservoir {
+		o.reservoir[i] = us
+	}
+}
+
+func (e *experiment) reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.started = time.Now()
+	for i := range e.arms {
+		e.arms[i] = &armOutcomes{}
+	}
+}
+
+// significance is the p-value below which a difference is reported as
+// significant, given at least minSignificantSamples per arm.
+const (
+	significance          = 0.05
+	minSignificantSamples = 30
+)
+
+// comparison tests one metric of an arm against the control. PValue is
+// two-sided, from the normal approximation to Welch's t-test (or to the
+// two-proportion z-test for error rates), which needs a few dozen samples
+// per arm to be trustworthy.
+type comparison struct {
+	Control     float64 `json:"control"`
+	Arm         float64 `json:"arm"`
+	Diff        float64 `json:"diff"`
+	Relative    string  `json:"relative,omitempty"`
+	Statistic   float64 `json:"statistic"`
+	PValue      float64 `json:"p_value"`
+	Significant bool    `json:"significant"`
+}
+
+func (e *experiment) status() gin.H {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	arms := make([]gin.H, len(e.arms))
+	for i, o := range e.arms {
+		latencies := append([]float64(nil), o.reservoir...)
+		sort.Float64s(latencies)
+		arm := e.config.Arms[i]
+		arms[i] = gin.H{
+			"name":       arm.Name,
+			"strategy":   arm.Strategy,
+			"weight":     arm.Weight,
+			"samples":    o.samples,
+			"errors":     o.errors,
+			"error_rate": errorRate(o),
+			"size_bytes": gin.H{"mean": o.size.mean, "stddev": math.Sqrt(o.size.variance())},
+			"latency_us": gin.H{
+				"mean":   o.latency.mean,
+				"stddev": math.Sqrt(o.latency.variance()),
+				"p50":    quantile(latencies, 0.50),
+				"p99":    quantile(latencies, 0.99),
+			},
+		}
+	}
+
+	control := e.arms[0]
+	var comparisons []gin.H
+	for i, o := range e.arms[1:] {
+		enough := control.samples >= minSignificantSamples && o.samples >= minSignificantSamples
+		comparisons = append(comparisons, gin.H{
+			"arm":        e.config.Arms[i+1].Name,
+			"control":    e.config.Arms[0].Name,
+			"size_bytes": welch(control.size, o.size, enough),
+			"latency_us": welch(control.latency, o.latency, enough),
+			"error_rate": proportions(control, o, enough),
+		})
+	}
+
+	out := gin.H{
+		"name":        e.config.Name,
+		"fraction":    e.config.Fraction,
+		"started":     e.started,
+		"arms":        arms,
+		"comparisons": comparisons,
+	}
+	if e.config.Feature != "" {
+		out["feature"] = e.config.Feature
+	}
+	return out
+}
+
+func welch(control, arm runningStats, enough bool) comparison {
+	c := comparison{Control: control.mean, Arm: arm.mean, Diff: arm.mean - control.mean, PValue: 1}
+	if control.mean != 0 {
+		c.Relative = fmt.Sprintf("%+.2f%%", c.Diff/control.mean*100)
+	}
+	if control.n < 2 || arm.n < 2 {
+		return c
+	}
+	se := math.Sqrt(control.variance()/float64(control.n) + arm.variance()/float64(arm.n))
+	if se == 0 {
+		if c.Diff != 0 {
+			c.PValue = 0
+			c.Significant = enough
+		}
+		return c
+	}
+	c.Statistic = c.Diff / se
+	c.PValue = math.Erfc(math.Abs(c.Statistic) / math.Sqrt2)
+	c.Significant = enough && c.PValue < significance
+	return c
+}
+
+func proportions(control, arm *armOutcomes, enough bool) comparison {
+	p1, p2 := errorRate(control), errorRate(arm)
+	c := comparison{Control: p1, Arm: p2, Diff: p2 - p1, PValue: 1}
+	if control.samples == 0 || arm.samples == 0 {
+		return c
+	}
+	pooled := float64(control.errors+arm.errors) / float64(control.samples+arm.samples)
+	se := math.Sqrt(pooled * (1 - pooled) * (1/float64(control.samples) + 1/float64(arm.samples)))
+	if se == 0 {
+		return c
+	}
+	c.Statistic = c.Diff / se
+	c.PValue = math.Erfc(math.Abs(c.Statistic) / math.Sqrt2)
+	c.Significant = enough && c.PValue < significance
+	return c
+}
+
+func errorRate(o *armOutcomes) float64 {
+	if o.samples == 0 {
+		return 0
+	}
+	return float64(o.errors) / float64(o.samples)
+}
+
+// quantile returns the q-th quantile of sorted by nearest rank.
+func quantile(sorted []float64, q float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(q*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
+
+func experimentsHandler(c *gin.Context) {
+	experimentsMu.RLock()
+	defer experimentsMu.RUnlock()
+	out := make([]gin.H, 0, len(experiments))
+	for _, e := range experiments {
+		out = append(out, e.status())
+	}
+	c.JSON(http.StatusOK, gin.H{"experiments": out})
+}
+
+func resetExperimentsHandler(c *gin.Context) {
+	experimentsMu.RLock()
+	defer experimentsMu.RUnlock()
+	for _, e := range experiments {
+		e.reset()
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "reset"})
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func TestLoadExperiments(t *testing.T) {
+	defer func() { experiments = nil }()
+	cases := []struct {
+		name, config, wantErr string
+	}{
+		{"unknown strategy", `{"experiments": [{"name": "e", "arms": [{"name": "a", "strategy": "avro-binary"}, {"name": "b", "strategy": "zstd"}]}]}`, "zstd"},
+		{"single arm", `{"experiments": [{"name": "e", "arms": [{"name": "a", "strategy": "avro-binary"}]}]}`, "at least one other arm"},
+		{"fraction", `{"experiments": [{"name": "e", "fraction": 1.5, "arms": [{"name": "a", "strategy": "json"}, {"name": "b", "strategy": "avro-json"}]}]}`, "fraction"},
+		{"unknown feature", `{"experiments": [{"name": "e", "feature": "warp-drive", "arms": [{"name": "a", "strategy": "json"}, {"name": "b", "strategy": "avro-json"}]}]}`, "warp-drive"},
+		{"duplicate arm", `{"experiments": [{"name": "e", "arms": [{"name": "a", "strategy": "json"}, {"name": "a", "strategy": "avro-json"}]}]}`, "unique"},
+	}
+	path := filepath.Join(t.TempDir(), "experiments.json")
+	for _, c := range cases {
+		if err := os.WriteFile(path, []byte(c.config), 0644); err != nil {
+			t.Fatalf("Failed to write experiment file: %v", err)
+		}
+		if err := loadExperiments(path); err == nil || !strings.Contains(err.Error(), c.wantErr) {
+			t.Errorf("%s: expected an error mentioning %q, got %v", c.name, c.wantErr, err)
+		}
+	}
+
+	config := `{"experiments": [{"name": "block-codec", "arms": [{"name": "control", "strategy": "avro-binary"}, {"name": "snappy", "strategy": "avro-snappy", "weight": 3}]}]}`
+	os.WriteFile(path, []byte(config), 0644)
+	if err := loadExperiments(path); err != nil {
+		t.Fatalf("Failed to load experiments: %v", err)
+	}
+	e := experiments[0]
+	if e.config.Fraction != 1 || e.config.Arms[0].Weight != 1 || e.total != 4 {
+		t.Errorf("unexpected defaults: %+v, total weight %d", e.config, e.total)
+	}
+	if e.pick(0) != 0 || e.pick(1) != 1 || e.pick(3) != 1 {
+		t.Error("expected picks to follow the arm weights")
+	}
+}
+
+func TestExperimentComparison(t *testing.T) {
+	var control, same, larger runningStats
+	for i := 0; i < 100; i++ {
+		x := float64(100 + i%10)
+		control.add(x)
+		same.add(x)
+		larger.add(x + 5)
+	}
+	if c := welch(control, same, true); c.Significant || c.PValue != 1 {
+		t.Errorf("expected identical arms to be indistinguishable: %+v", c)
+	}
+	c := welch(control, larger, true)
+	if !c.Significant || c.Diff != 5 || c.PValue > 1e-6 {
+		t.Errorf("expected a significant difference of 5: %+v", c)
+	}
+	if welch(control, larger, false).Significant {
+		t.Error("expected too few samples to never be significant")
+	}
+
+	clean := &armOutcomes{samples: 1000, errors: 10}
+	failing := &armOutcomes{samples: 1000, errors: 100}
+	if c := proportions(clean, failing, true); !c.Significant || c.Arm != 0.1 {
+		t.Errorf("expected the error rate difference to be significant: %+v", c)
+	}
+	if got := quantile([]float64{1, 2, 3, 4}, 0.5); got != 2 {
+		t.Errorf("median = %v, want 2", got)
+	}
+}
+
+func TestExperimentsEndpoint(t *testing.T) {
+	logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	defer func() {
+		experiments = nil
+		features = newFeatureFlags(featureConfig{})
+	}()
+	path := filepath.Join(t.TempDir(), "experiments.json")
+	config := `{"experiments": [
+		{"name": "binary-vs-json", "arms": [{"name": "binary", "strategy": "avro-binary"}, {"name": "json", "strategy": "json"}]},
+		{"name": "gated", "feature": "delta-encoding", "arms": [{"name": "a", "strategy": "avro-binary"}, {"name": "b", "strategy": "avro-deflate"}]}]}`
+	if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to write experiment file: %v", err)
+	}
+	if err := loadExperiments(path); err != nil {
+		t.Fatalf("Failed to load experiments: %v", err)
+	}
+	features.set("warmup", featureDeltaEncoding, false)
+
+	r := gin.New()
+	r.POST("/log", logHandler)
+	r.GET("/stats/experiments", experimentsHandler)
+	r.DELETE("/stats/experiments", resetExperimentsHandler)
+
+	body, _ := json.Marshal(warmupPayload(1))
+	for i := 0; i < 200; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/log", strings.NewReader(string(body)))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected the log to pass, got %d: %s", w.Code, w.Body.String())
+		}
+		var resp struct {
+			Experiments map[string]string `json:"experiments"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if arm := resp.Experiments["binary-vs-json"]; arm != "binary" && arm != "json" {
+			t.Fatalf("expected an arm assignment, got %v", resp.Experiments)
+		}
+		if _, ok := resp.Experiments["gated"]; ok {
+			t.Fatal("expected the gated experiment to skip a project with its flag off")
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stats/experiments", nil))
+	var stats struct {
+		Experiments []struct {
+			Name string `json:"name"`
+			Arms []struct {
+				Name    string `json:"name"`
+				Samples int    `json:"samples"`
+			} `json:"arms"`
+			Comparisons []struct {
+				Size comparison `json:"size_bytes"`
+			} `json:"comparisons"`
+		} `json:"experiments"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("Failed to decode stats: %v", err)
+	}
+	e := stats.Experiments[0]
+	if e.Arms[0].Samples+e.Arms[1].Samples != 200 || e.Arms[0].Samples == 0 || e.Arms[1].Samples == 0 {
+		t.Errorf("expected 200 logs split between the arms: %+v", e.Arms)
+	}
+	// The same log every time: JSON is larger with no variance.
+	if size := e.Comparisons[0].Size; size.Diff <= 0 || !size.Significant {
+		t.Errorf("expected JSON to be significantly larger than Avro: %+v", size)
+	}
+	if gated := stats.Experiments[1]; gated.Arms[0].Samples+gated.Arms[1].Samples != 0 {
+		t.Errorf("expected no samples for the gated experiment: %+v", gated.Arms)
+	}
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, "/stats/experiments", nil))
+	if n := experiments[0].arms[0].samples; n != 0 {
+		t.Errorf("expected reset to clear the samples, got %d", n)
+	}
+}
@@ -0,0 +1,475 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/homveloper/exp-avro-json/server/ocf"
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+	"github.com/homveloper/exp-avro-json/server/pkg/columnarjson"
+	"github.com/homveloper/exp-avro-json/server/seal"
+	"github.com/linkedin/goavro/v2"
+	"go.uber.org/zap"
+)
+
+// exportBatch is how many records an OCF export packs into one block.
+const exportBatch = 500
+
+// exportWorkers is how many goroutines decode each source file's blocks
+// during an export; -export-workers sets it.
+var exportWorkers = runtime.GOMAXPROCS(0)
+
+// ocfSource is one container file in the OCF store.
+type ocfSource struct {
+	Path   string
+	Schema string    // writer schema from the file header
+	key    *seal.Key // the store's key, for sealed files
+	live   bool      // still being written, so a sealed file has no end yet
+}
+
+// open opens the file for reading, decrypting it if it is sealed.
+func (s ocfSource) open() (io.ReadCloser, error) {
+	if s.live {
+		return ocf.OpenLiveFile(s.Path, s.key)
+	}
+	return ocf.OpenFile(s.Path, s.key)
+}
+
+// sources returns the store's container files in name order, which is
+// creation order within each stream.
+func (s *ocfStore) sources() ([]ocfSource, error) {
+	// Write the logs waiting in partly filled blocks, so a read sees every
+	// log accepted so far.
+	if err := s.flush(); err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*.avro"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	// Taken after the glob, so every file found that is still open is in
+	// it; one closed since has its final frame.
+	live := make(map[string]bool)
+	for _, path := range s.openFiles() {
+		live[path] = true
+	}
+	var sources []ocfSource
+	for _, path := range paths {
+		src := ocfSource{Path: path, key: s.key, live: live[path]}
+		f, err := src.open()
+		if err != nil {
+			return nil, err
+		}
+		reader, err := goavro.NewOCFReader(f)
+		f.Close()
+		if err != nil {
+			// A file whose header is not flushed yet has no records either.
+			logger.Warn("Skipping unreadable OCF file", zap.String("file", path), zap.Error(err))
+			continue
+		}
+		src.Schema = reader.Codec().Schema()
+		sources = append(sources, src)
+	}
+	return sources, nil
+}
+
+// timeRange bounds exported records by a timestamp field, [From, To).
+type timeRange struct {
+	Field    string
+	From, To time.Time
+}
+
+func (r timeRange) bounded() bool { return !r.From.IsZero() || !r.To.IsZero() }
+
+// parseExportTime accepts RFC 3339 or Unix milliseconds.
+func parseExportTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.UnixMilli(ms).UTC(), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: use RFC 3339 or Unix milliseconds", s)
+	}
+	return t, nil
+}
+
+// contains reports whether record falls in the range. Plain long fields are
+// read as Unix milliseconds.
+func (r timeRange) contains(record interface{}) bool {
+	if !r.bounded() {
+		return true
+	}
+	fields, ok := record.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	var t time.Time
+	switch v := fields[r.Field].(type) {
+	case time.Time:
+		t = v
+	case int64:
+		t = time.UnixMilli(v)
+	case int32:
+		t = time.UnixMilli(int64(v))
+	default:
+		return false
+	}
+	return (r.From.IsZero() || !t.Before(r.From)) && (r.To.IsZero() || t.Before(r.To))
+}
+
+// exportSource is a source file selected for an export, with the resolver
+// mapping its records onto the reader schema when its writer schema differs.
+type exportSource struct {
+	ocfSource
+	resolver *avrojson.Resolver
+}
+
+// exportHandler serves GET /logs/export: every stored record of one schema
+// subject in a time range, resolved to one reader version and streamed as a
+// single OCF or NDJSON download.
+//
+// Query parameters: schema (default LogData) and version (default latest)
+// pick the reader schema; from and to (RFC 3339 or Unix ms, to exclusive)
+// filter on time_field (default timestamp); format is ocf, ndjson,
+// columnar (columnarjson's schema, field_order and rows), parquet or auto,
+// which picks the smallest of the others for the records, see
+// format_policy.go; strip_unions=true writes NDJSON without union
+// wrappers. Records appear in storage order. The format is sent as the
+// X-Export-Format header and the record count as the X-Export-Records
+// trailer.
+func exportHandler(c *gin.Context) {
+	store := requestOCFStore(c)
+	if store == nil {
+		return
+	}
+	format := c.DefaultQuery("format", "ocf")
+	switch format {
+	case "ocf", "ndjson", "columnar", "auto":
+	case "parquet":
+		respondError(c, http.StatusNotImplemented, codeNotImplemented, "Parquet export needs a Parquet encoder, which this build does not include; use format=ocf, ndjson or columnar")
+		return
+	default:
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "format must be ocf, ndjson, columnar, auto or parquet")
+		return
+	}
+
+	name := c.DefaultQuery("schema", "LogData")
+	version, _ := strconv.Atoi(c.Query("version"))
+	reader, err := resolveSchema(name, version)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeUnknownSchema, "Unknown schema "+strconv.Quote(name)+" version "+strconv.Itoa(version))
+		return
+	}
+	readerCodec, err := avrojson.DefaultCache.Get(reader.Schema)
+	if err != nil {
+		requestLogger(c).Error("Failed to create Avro codec", zap.String("schema", name), zap.Error(err))
+		respondError(c, http.StatusInternalServerError, codeInternal, "Failed to create Avro codec")
+		return
+	}
+
+	window := timeRange{Field: c.DefaultQuery("time_field", "timestamp")}
+	for _, bound := range []struct {
+		param string
+		dst   *time.Time
+	}{{"from", &window.From}, {"to", &window.To}} {
+		if *bound.dst, err = parseExportTime(c.Query(bound.param)); err != nil {
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, bound.param+": "+err.Error())
+			return
+		}
+	}
+	if window.bounded() && !hasField(readerCodec, window.Field) {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("%s has no field %q to filter on; set time_field", reader.Name, window.Field))
+		return
+	}
+	stripUnions, _ := strconv.ParseBool(c.Query("strip_unions"))
+
+	sources, err := selectExportSources(store, reader.Name, reader.Schema, readerCodec)
+	if err != nil {
+		respondError(c, http.StatusUnprocessableEntity, codeInvalidRequest, err.Error())
+		return
+	}
+
+	var enc *exportEncoder
+	begin := func(chosen string) error {
+		f := exportFormats[chosen]
+		c.Header("Content-Type", f.contentType)
+		c.Header("Content-Disposition", `attachment; filename="`+exportFileName(reader.Name, window)+f.ext+`"`)
+		c.Header("X-Export-Files", strconv.Itoa(len(sources)))
+		c.Header(exportFormatHeader, chosen)
+		c.Header("Trailer", "X-Export-Records")
+		c.Status(http.StatusOK)
+		var err error
+		enc, err = newExportEncoder(chosen, c.Writer, readerCodec, stripUnions)
+		return err
+	}
+	emit := func(record interface{}) error { return enc.emit(record) }
+	var sample []interface{}
+	var decision formatDecision
+	choose := func(more bool) error {
+		candidates := []string{"ndjson", "columnar"}
+		var notes []string
+		if acceptsMediaType(c.GetHeader("Accept"), avroContentType) {
+			candidates = append(candidates, "ocf")
+		} else {
+			notes = append(notes, "ocf not considered: the request does not accept "+avroContentType)
+		}
+		sizes, err := measureFormats(candidates, sample, readerCodec, stripUnions)
+		if err != nil {
+			return err
+		}
+		decision = chooseFormat(sizes, len(sample), more, notes)
+		c.Header(exportFormatReasonHeader, decision.reason)
+		if err := begin(decision.format); err != nil {
+			return err
+		}
+		for _, record := range sample {
+			if err := enc.emit(record); err != nil {
+				return err
+			}
+		}
+		sample = nil
+		return nil
+	}
+	if format == "auto" {
+		// Records are held back until the sample is full or the export
+		// ends, so the choice sees as many of them as it can.
+		emit = func(record interface{}) error {
+			if enc != nil {
+				return enc.emit(record)
+			}
+			sample = append(sample, record)
+			if len(sample) == autoFormatSample {
+				return choose(true)
+			}
+			return nil
+		}
+	} else if err := begin(format); err != nil {
+		requestLogger(c).Error("Failed to start export", zap.String("format", format), zap.Error(err))
+		return
+	}
+
+	records, err := streamExport(c, sources, window, emit)
+	if err == nil && enc == nil {
+		err = choose(false)
+	}
+	if enc == nil {
+		// Nothing was sent yet, so the failure can still be reported.
+		requestLogger(c).Error("OCF export failed", zap.String("schema", reader.Name), zap.Error(err))
+		respondError(c, http.StatusInternalServerError, codeStorageFailed, "Export failed")
+		return
+	}
+	defer enc.close()
+	if err == nil {
+		err = enc.finish()
+	}
+	c.Writer.Header().Set("X-Export-Records", strconv.Itoa(records))
+	if err != nil {
+		// The status line is gone; a truncated body and missing records
+		// are all a client can notice.
+		requestLogger(c).Error("OCF export aborted", zap.String("schema", reader.Name), zap.Int("records", records), zap.Error(err))
+		return
+	}
+	fields := []zap.Field{
+		zap.String("schema", reader.Name),
+		zap.Int("version", reader.Version),
+		zap.String("format", c.Writer.Header().Get(exportFormatHeader)),
+		zap.Int("files", len(sources)),
+		zap.Int("records", records),
+	}
+	if decision.reason != "" {
+		fields = append(fields, zap.String("format_reason", decision.reason))
+	}
+	requestLogger(c).Info("OCF export completed", fields...)
+}
+
+// exportFormats are the formats /logs/export writes, with their file
+// extensions and content types.
+var exportFormats = map[string]struct{ ext, contentType string }{
+	"ocf":      {".avro", avroContentType},
+	"ndjson":   {".ndjson", "application/x-ndjson"},
+	"columnar": {".json", "application/json"},
+}
+
+// exportEncoder writes exported records to a writer in one format. finish
+// writes what is buffered and ends the download; close releases what the
+// encoder holds.
+type exportEncoder struct {
+	emit   func(record interface{}) error
+	finish func() error
+	close  func()
+}
+
+func newExportEncoder(format string, w io.Writer, codec *avrojson.Codec, stripUnions bool) (*exportEncoder, error) {
+	flush := func() {
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+	enc := &exportEncoder{close: func() {}}
+	switch format {
+	case "ocf":
+		ow, err := goavro.NewOCFWriter(goavro.OCFConfig{W: w, Codec: codec.Goavro()})
+		if err != nil {
+			return nil, err
+		}
+		batch := make([]interface{}, 0, exportBatch)
+		enc.finish = func() error {
+			if len(batch) == 0 {
+				return nil
+			}
+			err := ow.Append(batch)
+			batch = batch[:0]
+			flush()
+			return err
+		}
+		enc.emit = func(record interface{}) error {
+			batch = append(batch, record)
+			if len(batch) == exportBatch {
+				return enc.finish()
+			}
+			return nil
+		}
+	case "ndjson":
+		dec := codec.Decoders().Get()
+		enc.close = func() { codec.Decoders().Put(dec) }
+		enc.emit = func(record interface{}) error {
+			var line []byte
+			var err error
+			if stripUnions {
+				var plain interface{}
+				if plain, err = codec.StripUnions(record); err == nil {
+					line, err = json.Marshal(plain)
+				}
+			} else {
+				line, err = dec.NativeJSON(record)
+			}
+			if err != nil {
+				return err
+			}
+			_, err = w.Write(append(line, '\n'))
+			return err
+		}
+		enc.finish = func() error { flush(); return nil }
+	case "columnar":
+		cc, err := columnarjson.New(codec.Schema())
+		if err != nil {
+			return nil, err
+		}
+		cw := cc.NewWriter(w)
+		enc.emit = cw.Write
+		enc.finish = func() error {
+			err := cw.Close()
+			flush()
+			return err
+		}
+	default:
+		return nil, fmt.Errorf("unknown export format %q", format)
+	}
+	return enc, nil
+}
+
+// selectExportSources picks the files whose writer schema is registered
+// under subject and prepares a resolver for each writer version that
+// differs from the reader.
+func selectExportSources(store *ocfStore, subject, readerSchema string, reader *avrojson.Codec) ([]exportSource, error) {
+	all, err := store.sources()
+	if err != nil {
+		return nil, err
+	}
+	var selected []exportSource
+	for _, src := range all {
+		writer, err := schemaRegistry.Lookup(src.Schema)
+		if err != nil || writer.Name != subject {
+			continue
+		}
+		s := exportSource{ocfSource: src}
+		if writer.Canonical != reader.Canonical() {
+			if s.resolver, err = avrojson.DefaultCache.Resolver(writer.Schema, readerSchema); err != nil {
+				return nil, fmt.Errorf("%s (%s v%d) cannot be read as the requested version: %w", filepath.Base(src.Path), writer.Name, writer.Version, err)
+			}
+		}
+		selected = append(selected, s)
+	}
+	return selected, nil
+}
+
+// streamExport feeds every in-range record of sources to emit, returning
+// how many were emitted.
+func streamExport(c *gin.Context, sources []exportSource, window timeRange, emit func(interface{}) error) (int, error) {
+	records := 0
+	for _, src := range sources {
+		if err := c.Request.Context().Err(); err != nil {
+			return records, err
+		}
+		f, err := src.open()
+		if err != nil {
+			return records, err
+		}
+		_, _, err = ocf.ScanParallel(f, exportWorkers, func(record interface{}) error {
+			if src.resolver != nil {
+				var err error
+				if record, err = src.resolver.Resolve(record); err != nil {
+					return err
+				}
+			}
+			if !window.contains(record) {
+				return nil
+			}
+			records++
+			return emit(record)
+		})
+		f.Close()
+		var scanErr *ocf.ScanError
+		if errors.As(err, &scanErr) {
+			// The file is still being appended to and its last block is
+			// incomplete; everything before it was exported.
+			requestLogger(c).Warn("Stopped at an unreadable OCF block", zap.String("file", src.Path), zap.Error(err))
+			continue
+		}
+		if err != nil {
+			return records, err
+		}
+	}
+	return records, nil
+}
+
+func hasField(codec *avrojson.Codec, name string) bool {
+	var schema struct {
+		Fields []struct {
+			Name string `json:"name"`
+		} `json:"fields"`
+	}
+	if json.Unmarshal([]byte(codec.Schema()), &schema) != nil {
+		return false
+	}
+	for _, f := range schema.Fields {
+		if f.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func exportFileName(subject string, window timeRange) string {
+	name := unsafeFileChars.ReplaceAllString(subject, "_")
+	if !window.From.IsZero() {
+		name += "-from-" + window.From.UTC().Format("20060102T150405Z")
+	}
+	if !window.To.IsZero() {
+		name += "-to-" + window.To.UTC().Format("20060102T150405Z")
+	}
+	return name
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/homveloper/exp-avro-json/server/ocf"
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+	"github.com/homveloper/exp-avro-json/server/pkg/columnarjson"
+	"go.uber.org/zap"
+)
+
+func TestExportTimeRange(t *testing.T) {
+	logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	if err := openSchemaRegistry(""); err != nil {
+		t.Fatalf("Failed to open schema registry: %v", err)
+	}
+	if err := openOCFLogs(t.TempDir(), ocfTuning{}); err != nil {
+		t.Fatalf("Failed to open OCF logs: %v", err)
+	}
+	defer func() { ocfLogs.wrapper, ocfLogs.logData = nil, nil }()
+
+	for i, ts := range []int64{1000, 2000, 3000} {
+		encoded, err := avrojson.EncodeLog(avrojson.LogWrapper{ProjectName: "p"},
+			avrojson.LogData{Timestamp: time.UnixMilli(ts).UTC(), Logtype: "t", Version: "1", Issuer: string(rune('a' + i))})
+		if err != nil {
+			t.Fatalf("Failed to encode log: %v", err)
+		}
+		writeOCFLog(t, encoded)
+	}
+
+	// A second LogData version, as if imported from another producer.
+	v2Schema := strings.Replace(avrojson.LogDataSchema, `{"name": "issuer", "type": "string"},`,
+		`{"name": "issuer", "type": "string"}, {"name": "region", "type": "string", "default": "eu"},`, 1)
+	v2, _, err := schemaRegistry.Register("LogData", v2Schema)
+	if err != nil || v2.Version != 2 {
+		t.Fatalf("Failed to register LogData v2: %v %+v", err, v2)
+	}
+	w, err := ocfLogs.writerFor(v2)
+	if err != nil {
+		t.Fatalf("Failed to open v2 stream: %v", err)
+	}
+	if err := w.AppendNative(map[string]interface{}{
+		"timestamp": int64(2500), "logtype": "t", "version": "2", "issuer": "d", "region": "us", "metadata": nil, "domainData": nil,
+	}); err != nil {
+		t.Fatalf("Failed to append v2 record: %v", err)
+	}
+
+	r := gin.New()
+	r.GET("/logs/export", exportHandler)
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+
+	resp := get("/logs/export?format=ndjson&version=2&from=2000&to=1970-01-01T00:00:03Z&strip_unions=true")
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+	var regions []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var record map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("Failed to parse NDJSON line %q: %v", scanner.Text(), err)
+		}
+		regions = append(regions, record["issuer"].(string)+"/"+record["region"].(string))
+	}
+	sort.Strings(regions)
+	if strings.Join(regions, ",") != "b/eu,d/us" {
+		t.Errorf("unexpected exported records %v", regions)
+	}
+	if got := resp.Result().Trailer.Get("X-Export-Records"); got != "2" {
+		t.Errorf("Expected X-Export-Records trailer 2, got %q", got)
+	}
+
+	resp = get("/logs/export?format=ocf")
+	if resp.Code != http.StatusOK || resp.Header().Get("Content-Type") != avroContentType {
+		t.Fatalf("Expected an Avro download, got %d %s", resp.Code, resp.Header().Get("Content-Type"))
+	}
+	schema, n, err := ocf.Scan(bytes.NewReader(resp.Body.Bytes()), func(interface{}) error { return nil })
+	if err != nil || n != 4 {
+		t.Fatalf("Expected all 4 records in the OCF export, got %d: %v", n, err)
+	}
+	if s, err := schemaRegistry.Lookup(schema); err != nil || s.Version != 2 {
+		t.Errorf("Expected the export to embed the latest version, got %+v: %v", s, err)
+	}
+
+	for target, want := range map[string]int{
+		"/logs/export?format=parquet":                  http.StatusNotImplemented,
+		"/logs/export?format=xml":                      http.StatusBadRequest,
+		"/logs/export?schema=LogWrapper&from=0":        http.StatusBadRequest,
+		"/logs/export?from=yesterday":                  http.StatusBadRequest,
+		"/logs/export?schema=Nope":                     http.StatusBadRequest,
+		"/logs/export?schema=LogWrapper&format=ndjson": http.StatusOK,
+	} {
+		if got := get(target).Code; got != want {
+			t.Errorf("%s: expected %d, got %d", target, want, got)
+		}
+	}
+}
+
+func TestExportFormats(t *testing.T) {
+	logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	if err := openSchemaRegistry(""); err != nil {
+		t.Fatalf("Failed to open schema registry: %v", err)
+	}
+	if err := openOCFLogs(t.TempDir(), ocfTuning{}); err != nil {
+		t.Fatalf("Failed to open OCF logs: %v", err)
+	}
+	defer func() { ocfLogs.wrapper, ocfLogs.logData = nil, nil }()
+	r := gin.New()
+	r.GET("/logs/export", exportHandler)
+	get := func(target, accept string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Accept", accept)
+		r.ServeHTTP(w, req)
+		return w
+	}
+	addLogs := func(n int) {
+		for i := 0; i < n; i++ {
+			encoded, err := avrojson.EncodeLog(avrojson.LogWrapper{ProjectName: "p"}, avrojson.LogData{
+				Timestamp: time.UnixMilli(int64(1700000000000 + i)).UTC(), Logtype: "user_action", Version: "1.0", Issuer: "game_server",
+				Metadata: map[string]string{"session": "s-1"},
+			})
+			if err != nil {
+				t.Fatalf("Failed to encode log: %v", err)
+			}
+			writeOCFLog(t, encoded)
+		}
+	}
+
+	// A couple of logs do not pay for the schema columnar JSON embeds.
+	addLogs(2)
+	resp := get("/logs/export?format=auto", "")
+	if resp.Code != http.StatusOK || resp.Header().Get(exportFormatHeader) != "ndjson" || resp.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("Expected NDJSON for 2 logs, got %d %s: %s", resp.Code, resp.Header().Get(exportFormatHeader), resp.Header().Get(exportFormatReasonHeader))
+	}
+	if reason := resp.Header().Get(exportFormatReasonHeader); !strings.Contains(reason, "the 2 records") || !strings.Contains(reason, "ocf not considered") {
+		t.Errorf("unexpected reason %q", reason)
+	}
+	if lines := strings.Count(resp.Body.String(), "\n"); lines != 2 {
+		t.Errorf("expected 2 NDJSON lines, got %d", lines)
+	}
+
+	// Past the break-even point columnar JSON wins, and Avro binary wins
+	// for clients that read it.
+	addLogs(40)
+	resp = get("/logs/export?format=auto", "application/json")
+	if resp.Header().Get(exportFormatHeader) != "columnar" {
+		t.Fatalf("Expected columnar JSON for 42 logs, got %s: %s", resp.Header().Get(exportFormatHeader), resp.Header().Get(exportFormatReasonHeader))
+	}
+	var logs []avrojson.LogData
+	if err := columnarjson.Unmarshal(resp.Body.Bytes(), &logs); err != nil || len(logs) != 42 || logs[41].Metadata.(map[string]string)["session"] != "s-1" {
+		t.Fatalf("Failed to read the columnar export: %d logs, %v", len(logs), err)
+	}
+	if got := resp.Result().Trailer.Get("X-Export-Records"); got != "42" {
+		t.Errorf("Expected X-Export-Records trailer 42, got %q", got)
+	}
+
+	resp = get("/logs/export?format=auto", "application/json, application/avro")
+	if resp.Header().Get(exportFormatHeader) != "ocf" || resp.Header().Get("Content-Type") != avroContentType {
+		t.Fatalf("Expected OCF for a client accepting Avro, got %s: %s", resp.Header().Get(exportFormatHeader), resp.Header().Get(exportFormatReasonHeader))
+	}
+	if _, n, err := ocf.Scan(bytes.NewReader(resp.Body.Bytes()), func(interface{}) error { return nil }); err != nil || n != 42 {
+		t.Errorf("Expected 42 records in the OCF export, got %d: %v", n, err)
+	}
+
+	// Asked for by name, columnar JSON is written whatever the count.
+	resp = get("/logs/export?format=columnar&from=1700000000039", "")
+	if err := columnarjson.Unmarshal(resp.Body.Bytes(), &logs); err != nil || len(logs) != 1 || resp.Header().Get(exportFormatReasonHeader) != "" {
+		t.Errorf("Expected 1 columnar log, got %d: %v", len(logs), err)
+	}
+}
@@ -0,0 +1,911 @@
+// Package expr evaluates small expressions over JSON-like values, so config
+// files can express field transforms and routing predicates without
+// compiling code. Expressions have no loops, assignments or access to
+// anything but the values they are given, and each evaluation runs under
+// an operation budget and a time limit.
+//
+// The language has JSON literals (numbers, 'single' or "double" quoted
+// strings, true, false, null and [lists]), names looked up in the
+// environment, .field and [index] access, calls of the built-in functions
+// and, by increasing precedence:
+//
+//	c ? a : b
+//	||
+//	&&
+//	==  !=
+//	<  <=  >  >=  in
+//	+  -
+//	*  /  %
+//	!  - (unary)
+//
+// Missing names, fields and indexes are null. Numbers are int64 when
+// integral and float64 otherwise; + - * % keep integers integral, / always
+// divides as floats, and + also joins strings. Comparisons take two
+// numbers or two strings, == any values, && || ! only booleans. "x in y"
+// tests for an element of a list, a key of an object or a substring.
+//
+// Functions: len(x), lower(s), upper(s), trim(s), contains(s, sub),
+// startsWith(s, prefix), endsWith(s, suffix), string(x), int(x),
+// float(x), now() (Unix milliseconds) and coalesce(a, b, ...), the first
+// argument that is not null.
+package expr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var (
+	// ErrOpLimit is an evaluation that ran out of its operation budget.
+	ErrOpLimit = errors.New("expr: operation limit exceeded")
+	// ErrTimeout is an evaluation that ran past its time limit.
+	ErrTimeout = errors.New("expr: time limit exceeded")
+)
+
+// Limits bound one evaluation. Zero values take the defaults.
+type Limits struct {
+	// MaxOps caps the nodes evaluated, 10000 by default.
+	MaxOps int
+	// Timeout caps the time spent, 10ms by default.
+	Timeout time.Duration
+}
+
+const (
+	defaultMaxOps  = 10000
+	defaultTimeout = 10 * time.Millisecond
+	// checkEvery is how many operations pass between clock reads.
+	checkEvery = 64
+)
+
+// Program is a compiled expression. It is safe for concurrent use.
+type Program struct {
+	source string
+	root   node
+}
+
+// Compile parses source.
+func Compile(source string) (*Program, error) {
+	p := &parser{src: source}
+	p.next()
+	root, err := p.ternary()
+	if p.err != nil {
+		err = p.err
+	} else if err == nil && p.tok.kind != tokEOF {
+		err = p.errorf("unexpected %s", p.tok)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("expr: %q: %w", source, err)
+	}
+	return &Program{source: source, root: root}, nil
+}
+
+// String returns the expression's source.
+func (p *Program) String() string { return p.source }
+
+// Eval evaluates the expression with the names of env, values as
+// encoding/json decodes them (json.Number included) or plain Go ints and
+// floats.
+func (p *Program) Eval(env map[string]interface{}, limits Limits) (interface{}, error) {
+	if limits.MaxOps <= 0 {
+		limits.MaxOps = defaultMaxOps
+	}
+	if limits.Timeout <= 0 {
+		limits.Timeout = defaultTimeout
+	}
+	e := &evaluator{env: env, ops: limits.MaxOps, deadline: time.Now().Add(limits.Timeout)}
+	return e.eval(p.root)
+}
+
+// EvalBool evaluates a predicate, which must yield a boolean.
+func (p *Program) EvalBool(env map[string]interface{}, limits Limits) (bool, error) {
+	v, err := p.Eval(env, limits)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("expr: %q is %s, not a boolean", p.source, typeName(v))
+	}
+	return b, nil
+}
+
+// Tokens.
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokOp
+)
+
+type token struct {
+	kind tokKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of expression"
+	}
+	return strconv.Quote(t.text)
+}
+
+type parser struct {
+	src string
+	pos int
+	tok token
+	err error
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("at %d: %s", p.tok.pos, fmt.Sprintf(format, args...))
+}
+
+// next reads the next token into p.tok, recording lexing errors.
+func (p *parser) next() {
+	for p.pos < len(p.src) && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+	start := p.pos
+	if p.pos >= len(p.src) {
+		p.tok = token{kind: tokEOF, pos: start}
+		return
+	}
+	c := p.src[p.pos]
+	switch {
+	case c >= '0' && c <= '9':
+		for p.pos < len(p.src) {
+			ch := p.src[p.pos]
+			if ch >= '0' && ch <= '9' || ch == '.' {
+				p.pos++
+				continue
+			}
+			if ch != 'e' && ch != 'E' {
+				break
+			}
+			p.pos++
+			if p.pos < len(p.src) && (p.src[p.pos] == '+' || p.src[p.pos] == '-') {
+				p.pos++
+			}
+		}
+		p.tok = token{kind: tokNumber, text: p.src[start:p.pos], pos: start}
+	case c == '_' || unicode.IsLetter(rune(c)):
+		for p.pos < len(p.src) && (p.src[p.pos] == '_' || unicode.IsLetter(rune(p.src[p.pos])) || unicode.IsDigit(rune(p.src[p.pos]))) {
+			p.pos++
+		}
+		p.tok = token{kind: tokIdent, text: p.src[start:p.pos], pos: start}
+	case c == '\'' || c == '"':
+		var b strings.Builder
+		p.pos++
+		for {
+			if p.pos >= len(p.src) {
+				p.tok = token{kind: tokString, pos: start}
+				if p.err == nil {
+					p.err = fmt.Errorf("at %d: unterminated string", start)
+				}
+				return
+			}
+			ch := p.src[p.pos]
+			p.pos++
+			if ch == c {
+				break
+			}
+			if ch == '\\' && p.pos < len(p.src) {
+				esc := p.src[p.pos]
+				p.pos++
+				switch esc {
+				case 'n':
+					ch = '\n'
+				case 't':
+					ch = '\t'
+				default:
+					ch = esc
+				}
+			}
+			b.WriteByte(ch)
+		}
+		p.tok = token{kind: tokString, text: b.String(), pos: start}
+	default:
+		for _, op := range []string{"==", "!=", "<=", ">=", "&&", "||"} {
+			if strings.HasPrefix(p.src[p.pos:], op) {
+				p.pos += 2
+				p.tok = token{kind: tokOp, text: op, pos: start}
+				return
+			}
+		}
+		if strings.IndexByte("+-*/%<>!?:.,()[]", c) < 0 {
+			p.tok = token{kind: tokOp, text: string(c), pos: start}
+			if p.err == nil {
+				p.err = fmt.Errorf("at %d: unexpected character %q", start, c)
+			}
+			p.pos++
+			return
+		}
+		p.pos++
+		p.tok = token{kind: tokOp, text: string(c), pos: start}
+	}
+}
+
+func (p *parser) is(op string) bool {
+	return (p.tok.kind == tokOp || p.tok.kind == tokIdent && op == "in") && p.tok.text == op
+}
+
+func (p *parser) expect(op string) error {
+	if p.err != nil {
+		return p.err
+	}
+	if !p.is(op) {
+		return p.errorf("expected %q, got %s", op, p.tok)
+	}
+	p.next()
+	return nil
+}
+
+// Nodes.
+
+type node interface{}
+
+type (
+	literal  struct{ value interface{} }
+	name     struct{ name string }
+	listNode struct{ items []node }
+	field    struct {
+		x    node
+		name string
+	}
+	index struct{ x, i node }
+	unary struct {
+		op string
+		x  node
+	}
+	binary struct {
+		op   string
+		x, y node
+	}
+	cond struct{ c, a, b node }
+	call struct {
+		fn   string
+		args []node
+	}
+)
+
+func (p *parser) ternary() (node, error) {
+	c, err := p.binaryLevel(0)
+	if err != nil || !p.is("?") {
+		return c, err
+	}
+	p.next()
+	a, err := p.ternary()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	b, err := p.ternary()
+	if err != nil {
+		return nil, err
+	}
+	return cond{c, a, b}, nil
+}
+
+// levels lists the binary operators by increasing precedence.
+var levels = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!="},
+	{"<", "<=", ">", ">=", "in"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *parser) binaryLevel(level int) (node, error) {
+	if level == len(levels) {
+		return p.unaryExpr()
+	}
+	x, err := p.binaryLevel(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := ""
+		for _, candidate := range levels[level] {
+			if p.is(candidate) {
+				op = candidate
+			}
+		}
+		if op == "" {
+			return x, nil
+		}
+		p.next()
+		y, err := p.binaryLevel(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		x = binary{op, x, y}
+	}
+}
+
+func (p *parser) unaryExpr() (node, error) {
+	if p.is("!") || p.is("-") {
+		op := p.tok.text
+		p.next()
+		x, err := p.unaryExpr()
+		if err != nil {
+			return nil, err
+		}
+		return unary{op, x}, nil
+	}
+	x, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.is("."):
+			p.next()
+			if p.tok.kind != tokIdent {
+				return nil, p.errorf("expected a field name, got %s", p.tok)
+			}
+			x = field{x, p.tok.text}
+			p.next()
+		case p.is("["):
+			p.next()
+			i, err := p.ternary()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			x = index{x, i}
+		default:
+			return x, nil
+		}
+	}
+}
+
+func (p *parser) primary() (node, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	tok := p.tok
+	switch tok.kind {
+	case tokNumber:
+		p.next()
+		if n, err := strconv.ParseInt(tok.text, 10, 64); err == nil {
+			return literal{n}, nil
+		}
+		f, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("at %d: invalid number %s", tok.pos, tok.text)
+		}
+		return literal{f}, nil
+	case tokString:
+		p.next()
+		return literal{tok.text}, nil
+	case tokIdent:
+		p.next()
+		switch tok.text {
+		case "true":
+			return literal{true}, nil
+		case "false":
+			return literal{false}, nil
+		case "null":
+			return literal{nil}, nil
+		}
+		if !p.is("(") {
+			return name{tok.text}, nil
+		}
+		if _, ok := functions[tok.text]; !ok {
+			return nil, fmt.Errorf("at %d: unknown function %s", tok.pos, tok.text)
+		}
+		p.next()
+		var args []node
+		for !p.is(")") {
+			arg, err := p.ternary()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if !p.is(",") {
+				break
+			}
+			p.next()
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return call{tok.text, args}, nil
+	}
+	switch {
+	case p.is("("):
+		p.next()
+		x, err := p.ternary()
+		if err != nil {
+			return nil, err
+		}
+		return x, p.expect(")")
+	case p.is("["):
+		p.next()
+		var items []node
+		for !p.is("]") {
+			item, err := p.ternary()
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+			if !p.is(",") {
+				break
+			}
+			p.next()
+		}
+		return listNode{items}, p.expect("]")
+	}
+	return nil, p.errorf("unexpected %s", tok)
+}
+
+// Evaluation.
+
+type evaluator struct {
+	env      map[string]interface{}
+	ops      int
+	deadline time.Time
+}
+
+func (e *evaluator) step() error {
+	e.ops--
+	if e.ops < 0 {
+		return ErrOpLimit
+	}
+	if e.ops%checkEvery == 0 && time.Now().After(e.deadline) {
+		return ErrTimeout
+	}
+	return nil
+}
+
+func (e *evaluator) eval(n node) (interface{}, error) {
+	if err := e.step(); err != nil {
+		return nil, err
+	}
+	switch n := n.(type) {
+	case literal:
+		return n.value, nil
+	case name:
+		return normalize(e.env[n.name]), nil
+	case listNode:
+		items := make([]interface{}, len(n.items))
+		for i, item := range n.items {
+			v, err := e.eval(item)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = v
+		}
+		return items, nil
+	case field:
+		x, err := e.eval(n.x)
+		if err != nil {
+			return nil, err
+		}
+		m, _ := x.(map[string]interface{})
+		return normalize(m[n.name]), nil
+	case index:
+		x, err := e.eval(n.x)
+		if err != nil {
+			return nil, err
+		}
+		i, err := e.eval(n.i)
+		if err != nil {
+			return nil, err
+		}
+		switch x := x.(type) {
+		case map[string]interface{}:
+			key, ok := i.(string)
+			if !ok {
+				return nil, fmt.Errorf("expr: object index is %s, not a string", typeName(i))
+			}
+			return normalize(x[key]), nil
+		case []interface{}:
+			k, ok := i.(int64)
+			if !ok {
+				return nil, fmt.Errorf("expr: list index is %s, not an integer", typeName(i))
+			}
+			if k < 0 || k >= int64(len(x)) {
+				return nil, nil
+			}
+			return normalize(x[k]), nil
+		}
+		return nil, nil
+	case unary:
+		x, err := e.eval(n.x)
+		if err != nil {
+			return nil, err
+		}
+		if n.op == "!" {
+			b, ok := x.(bool)
+			if !ok {
+				return nil, fmt.Errorf("expr: ! of %s", typeName(x))
+			}
+			return !b, nil
+		}
+		switch x := x.(type) {
+		case int64:
+			return -x, nil
+		case float64:
+			return -x, nil
+		}
+		return nil, fmt.Errorf("expr: - of %s", typeName(x))
+	case cond:
+		c, err := e.eval(n.c)
+		if err != nil {
+			return nil, err
+		}
+		b, ok := c.(bool)
+		if !ok {
+			return nil, fmt.Errorf("expr: condition is %s, not a boolean", typeName(c))
+		}
+		if b {
+			return e.eval(n.a)
+		}
+		return e.eval(n.b)
+	case binary:
+		return e.binary(n)
+	case call:
+		args := make([]interface{}, len(n.args))
+		for i, arg := range n.args {
+			v, err := e.eval(arg)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = v
+		}
+		return functions[n.fn](args)
+	}
+	return nil, fmt.Errorf("expr: unknown node %T", n)
+}
+
+func (e *evaluator) binary(n binary) (interface{}, error) {
+	x, err := e.eval(n.x)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "&&" || n.op == "||" {
+		a, ok := x.(bool)
+		if !ok {
+			return nil, fmt.Errorf("expr: %s of %s", n.op, typeName(x))
+		}
+		if a == (n.op == "||") {
+			return a, nil
+		}
+		y, err := e.eval(n.y)
+		if err != nil {
+			return nil, err
+		}
+		b, ok := y.(bool)
+		if !ok {
+			return nil, fmt.Errorf("expr: %s of %s", n.op, typeName(y))
+		}
+		return b, nil
+	}
+	y, err := e.eval(n.y)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "==":
+		return equal(x, y), nil
+	case "!=":
+		return !equal(x, y), nil
+	case "in":
+		return contains(y, x)
+	case "<", "<=", ">", ">=":
+		c, err := compare(x, y)
+		if err != nil {
+			return nil, err
+		}
+		switch n.op {
+		case "<":
+			return c < 0, nil
+		case "<=":
+			return c <= 0, nil
+		case ">":
+			return c > 0, nil
+		}
+		return c >= 0, nil
+	}
+	if a, ok := x.(string); ok && n.op == "+" {
+		if b, ok := y.(string); ok {
+			return a + b, nil
+		}
+	}
+	return arithmetic(n.op, x, y)
+}
+
+func arithmetic(op string, x, y interface{}) (interface{}, error) {
+	a, aInt := x.(int64)
+	b, bInt := y.(int64)
+	if aInt && bInt && op != "/" {
+		switch op {
+		case "+":
+			return a + b, nil
+		case "-":
+			return a - b, nil
+		case "*":
+			return a * b, nil
+		case "%":
+			if b == 0 {
+				return nil, errors.New("expr: modulo by zero")
+			}
+			return a % b, nil
+		}
+	}
+	f, fok := toFloat(x)
+	g, gok := toFloat(y)
+	if !fok || !gok || op == "%" {
+		return nil, fmt.Errorf("expr: %s %s %s", typeName(x), op, typeName(y))
+	}
+	switch op {
+	case "+":
+		return f + g, nil
+	case "-":
+		return f - g, nil
+	case "*":
+		return f * g, nil
+	}
+	if g == 0 {
+		return nil, errors.New("expr: division by zero")
+	}
+	return f / g, nil
+}
+
+// normalize turns the numbers of decoded JSON and Go callers into int64
+// and float64.
+func normalize(v interface{}) interface{} {
+	switch n := v.(type) {
+	case json.Number:
+		if i, err := n.Int64(); err == nil {
+			return i
+		}
+		f, _ := n.Float64()
+		return f
+	case int:
+		return int64(n)
+	case int32:
+		return int64(n)
+	case float32:
+		return float64(n)
+	case float64:
+		if n == math.Trunc(n) && math.Abs(n) <= 1<<53 {
+			return int64(n)
+		}
+	}
+	return v
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+func equal(x, y interface{}) bool {
+	if f, ok := toFloat(x); ok {
+		g, ok := toFloat(y)
+		return ok && f == g
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+func compare(x, y interface{}) (int, error) {
+	if f, ok := toFloat(x); ok {
+		if g, ok := toFloat(y); ok {
+			switch {
+			case f < g:
+				return -1, nil
+			case f > g:
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+	if a, ok := x.(string); ok {
+		if b, ok := y.(string); ok {
+			return strings.Compare(a, b), nil
+		}
+	}
+	return 0, fmt.Errorf("expr: cannot compare %s with %s", typeName(x), typeName(y))
+}
+
+func contains(container, v interface{}) (bool, error) {
+	switch c := container.(type) {
+	case []interface{}:
+		for _, item := range c {
+			if equal(normalize(item), v) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case map[string]interface{}:
+		key, ok := v.(string)
+		if !ok {
+			return false, fmt.Errorf("expr: %s in object", typeName(v))
+		}
+		_, found := c[key]
+		return found, nil
+	case string:
+		sub, ok := v.(string)
+		if !ok {
+			return false, fmt.Errorf("expr: %s in string", typeName(v))
+		}
+		return strings.Contains(c, sub), nil
+	case nil:
+		return false, nil
+	}
+	return false, fmt.Errorf("expr: in %s", typeName(container))
+}
+
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case int64, float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "list"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// Functions.
+
+var functions = map[string]func(args []interface{}) (interface{}, error){
+	"len": func(args []interface{}) (interface{}, error) {
+		if err := arity("len", args, 1); err != nil {
+			return nil, err
+		}
+		switch v := args[0].(type) {
+		case string:
+			return int64(len(v)), nil
+		case []interface{}:
+			return int64(len(v)), nil
+		case map[string]interface{}:
+			return int64(len(v)), nil
+		case nil:
+			return int64(0), nil
+		}
+		return nil, fmt.Errorf("expr: len of %s", typeName(args[0]))
+	},
+	"lower":      stringFunc("lower", strings.ToLower),
+	"upper":      stringFunc("upper", strings.ToUpper),
+	"trim":       stringFunc("trim", strings.TrimSpace),
+	"contains":   stringPredicate("contains", strings.Contains),
+	"startsWith": stringPredicate("startsWith", strings.HasPrefix),
+	"endsWith":   stringPredicate("endsWith", strings.HasSuffix),
+	"string": func(args []interface{}) (interface{}, error) {
+		if err := arity("string", args, 1); err != nil {
+			return nil, err
+		}
+		switch v := args[0].(type) {
+		case string:
+			return v, nil
+		case int64:
+			return strconv.FormatInt(v, 10), nil
+		case float64:
+			return strconv.FormatFloat(v, 'g', -1, 64), nil
+		}
+		text, err := json.Marshal(args[0])
+		return string(text), err
+	},
+	"int": func(args []interface{}) (interface{}, error) {
+		if err := arity("int", args, 1); err != nil {
+			return nil, err
+		}
+		switch v := args[0].(type) {
+		case int64:
+			return v, nil
+		case float64:
+			return int64(v), nil
+		case string:
+			if n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64); err == nil {
+				return n, nil
+			}
+			f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil {
+				return nil, fmt.Errorf("expr: int of %q", v)
+			}
+			return int64(f), nil
+		case bool:
+			if v {
+				return int64(1), nil
+			}
+			return int64(0), nil
+		}
+		return nil, fmt.Errorf("expr: int of %s", typeName(args[0]))
+	},
+	"float": func(args []interface{}) (interface{}, error) {
+		if err := arity("float", args, 1); err != nil {
+			return nil, err
+		}
+		if f, ok := toFloat(args[0]); ok {
+			return f, nil
+		}
+		if s, ok := args[0].(string); ok {
+			f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+			if err != nil {
+				return nil, fmt.Errorf("expr: float of %q", s)
+			}
+			return f, nil
+		}
+		return nil, fmt.Errorf("expr: float of %s", typeName(args[0]))
+	},
+	"now": func(args []interface{}) (interface{}, error) {
+		if err := arity("now", args, 0); err != nil {
+			return nil, err
+		}
+		return time.Now().UnixMilli(), nil
+	},
+	"coalesce": func(args []interface{}) (interface{}, error) {
+		for _, v := range args {
+			if v != nil {
+				return v, nil
+			}
+		}
+		return nil, nil
+	},
+}
+
+func arity(fn string, args []interface{}, n int) error {
+	if len(args) != n {
+		return fmt.Errorf("expr: %s takes %d arguments, got %d", fn, n, len(args))
+	}
+	return nil
+}
+
+func stringFunc(fn string, f func(string) string) func([]interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		if err := arity(fn, args, 1); err != nil {
+			return nil, err
+		}
+		s, ok := args[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("expr: %s of %s", fn, typeName(args[0]))
+		}
+		return f(s), nil
+	}
+}
+
+func stringPredicate(fn string, f func(s, sub string) bool) func([]interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		if err := arity(fn, args, 2); err != nil {
+			return nil, err
+		}
+		s, ok1 := args[0].(string)
+		sub, ok2 := args[1].(string)
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("expr: %s of %s and %s", fn, typeName(args[0]), typeName(args[1]))
+		}
+		return f(s, sub), nil
+	}
+}
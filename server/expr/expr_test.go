@@ -0,0 +1,94 @@
+package expr
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEval(t *testing.T) {
+	var env map[string]interface{}
+	dec := json.NewDecoder(strings.NewReader(`{"logLevel":"DEBUG","projectName":"raid",
+		"body":{"domainData":{"score":0.5,"level":3,"tags":["a","b"],"email":"a@example.com"}}}`))
+	dec.UseNumber()
+	if err := dec.Decode(&env); err != nil {
+		t.Fatalf("Failed to decode env: %v", err)
+	}
+	for source, want := range map[string]interface{}{
+		`logLevel == "DEBUG" && projectName != 'other'`:                 true,
+		`body.domainData.level * 2 + 1`:                                 int64(7),
+		`body.domainData.score * 100`:                                   float64(50),
+		`body.domainData.level / 2`:                                     1.5,
+		`body.domainData.level % 2`:                                     int64(1),
+		`body.domainData["tags"][1]`:                                    "b",
+		`body.domainData.tags[5]`:                                       nil,
+		`body.missing.deeper`:                                           nil,
+		`"b" in body.domainData.tags`:                                   true,
+		`"level" in body.domainData`:                                    true,
+		`"@" in body.domainData.email`:                                  true,
+		`logLevel in ["INFO", "WARN"]`:                                  false,
+		`upper(projectName) + "-" + string(body.domainData.level)`:      "RAID-3",
+		`len(body.domainData.tags) >= 2 ? "many" : "few"`:               "many",
+		`coalesce(body.nothing, lower(logLevel))`:                       "debug",
+		`!(body.domainData.level < 3) && startsWith(projectName, "ra")`: true,
+		`int("42") + int(2.9) - -1`:                                     int64(45),
+		`float("1e3")`:                                                  float64(1000),
+	} {
+		p, err := Compile(source)
+		if err != nil {
+			t.Errorf("Failed to compile %s: %v", source, err)
+			continue
+		}
+		got, err := p.Eval(env, Limits{})
+		if err != nil {
+			t.Errorf("Failed to evaluate %s: %v", source, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s = %#v, want %#v", source, got, want)
+		}
+	}
+
+	for _, source := range []string{`logLevel ==`, `(1 + 2`, `"open`, `1 # 2`, `nope(1)`, `a.`, `1 2`} {
+		if _, err := Compile(source); err == nil {
+			t.Errorf("expected %s to fail to compile", source)
+		}
+	}
+	for _, source := range []string{`logLevel && true`, `projectName < 3`, `1 / 0`, `upper(3)`, `len(1, 2)`, `-"a"`} {
+		p, err := Compile(source)
+		if err != nil {
+			t.Fatalf("Failed to compile %s: %v", source, err)
+		}
+		if _, err := p.Eval(env, Limits{}); err == nil {
+			t.Errorf("expected %s to fail", source)
+		}
+	}
+	p, _ := Compile(`projectName`)
+	if _, err := p.EvalBool(env, Limits{}); err == nil {
+		t.Error("expected a string predicate to fail")
+	}
+}
+
+func TestEvalLimits(t *testing.T) {
+	source := "1" + strings.Repeat(" + 1", 200)
+	p, err := Compile(source)
+	if err != nil {
+		t.Fatalf("Failed to compile: %v", err)
+	}
+	if v, err := p.Eval(nil, Limits{}); err != nil || v != int64(201) {
+		t.Errorf("expected 201 within the default limits, got %v, %v", v, err)
+	}
+	if _, err := p.Eval(nil, Limits{MaxOps: 100}); !errors.Is(err, ErrOpLimit) {
+		t.Errorf("expected ErrOpLimit, got %v", err)
+	}
+	if _, err := p.Eval(nil, Limits{Timeout: 1}); !errors.Is(err, ErrTimeout) {
+		t.Errorf("expected ErrTimeout, got %v", err)
+	}
+	// Short circuits skip the other side.
+	p, _ = Compile(`false && (1 / 0 == 1)`)
+	if v, err := p.Eval(nil, Limits{}); err != nil || v != false {
+		t.Errorf("expected false, got %v, %v", v, err)
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Feature flags gate experimental encoders. Every flag is off unless
+// -features turns it on for all projects or -feature-file sets it:
+//
+//	{"default": {"delta-encoding": true},
+//	 "projects": {"big-game": {"delta-encoding": false, "adaptive-encoder": true}}}
+//
+// A project's entry overrides the default flag by flag. The admin routes
+// change flags at runtime; those changes last until the next restart. /log
+// and /log/binary responses report the flags that applied to the log.
+const (
+	featureAdaptiveEncoder = "adaptive-encoder"
+	featureDeltaEncoding   = "delta-encoding"
+	featureNestedWrapper   = "nested-wrapper"
+)
+
+// knownFeatures describes every flag; names outside it are rejected so a
+// typo cannot silently leave a feature off.
+var knownFeatures = map[string]string{
+	featureAdaptiveEncoder: "pick the smallest encoding per log from observed sizes",
+	featureDeltaEncoding:   "encode logs as deltas against the project's previous log",
+	featureNestedWrapper:   "embed LogData in LogWrapper as a nested record instead of a JSON string",
+}
+
+// featureHeader lists the flags enabled for a log, comma-separated.
+const featureHeader = "X-Feature-Flags"
+
+type featureConfig struct {
+	Default  map[string]bool            `json:"default"`
+	Projects map[string]map[string]bool `json:"projects"`
+}
+
+type featureFlags struct {
+	mu     sync.RWMutex
+	config featureConfig
+}
+
+var features = newFeatureFlags(featureConfig{})
+
+func newFeatureFlags(config featureConfig) *featureFlags {
+	if config.Default == nil {
+		config.Default = make(map[string]bool)
+	}
+	if config.Projects == nil {
+		config.Projects = make(map[string]map[string]bool)
+	}
+	return &featureFlags{config: config}
+}
+
+// loadFeatureFlags reads path, when set, and turns on the flags listed in
+// enabled for every project that does not override them.
+func loadFeatureFlags(path string, enabled []string) error {
+	var config featureConfig
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, &config); err != nil {
+			return fmt.Errorf("parse feature file: %w", err)
+		}
+	}
+	for name := range config.Default {
+		if err := checkFeature(name); err != nil {
+			return err
+		}
+	}
+	for project, flags := range config.Projects {
+		for name := range flags {
+			if err := checkFeature(name); err != nil {
+				return fmt.Errorf("project %q: %w", project, err)
+			}
+		}
+	}
+	f := newFeatureFlags(config)
+	for _, name := range enabled {
+		if err := checkFeature(name); err != nil {
+			return err
+		}
+		if _, set := f.config.Default[name]; !set {
+			f.config.Default[name] = true
+		}
+	}
+	features = f
+	return nil
+}
+
+func checkFeature(name string) error {
+	if _, ok := knownFeatures[name]; !ok {
+		return fmt.Errorf("unknown feature flag %q (known: %s)", name, strings.Join(featureNames(), ", "))
+	}
+	return nil
+}
+
+func featureNames() []string {
+	names := make([]string, 0, len(knownFeatures))
+	for name := range knownFeatures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Enabled reports whether flag name is on for project.
+func (f *featureFlags) Enabled(name, project string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if on, ok := f.config.Projects[project][name]; ok {
+		return on
+	}
+	return f.config.Default[name]
+}
+
+// forProject returns the state of every flag for project.
+func (f *featureFlags) forProject(project string) map[string]bool {
+	out := make(map[string]bool, len(knownFeatures))
+	for name := range knownFeatures {
+		out[name] = f.Enabled(name, project)
+	}
+	return out
+}
+
+// set changes a flag for project, or the default when project is empty.
+func (f *featureFlags) set(project, name string, enabled bool) error {
+	if err := checkFeature(name); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if project == "" {
+		f.config.Default[name] = enabled
+		return nil
+	}
+	if f.config.Projects[project] == nil {
+		f.config.Projects[project] = make(map[string]bool)
+	}
+	f.config.Projects[project][name] = enabled
+	return nil
+}
+
+// clear removes project's override of a flag and reports whether it had
+// one.
+func (f *featureFlags) clear(project, name string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	flags := f.config.Projects[project]
+	if _, ok := flags[name]; !ok {
+		return false
+	}
+	delete(flags, name)
+	if len(flags) == 0 {
+		delete(f.config.Projects, project)
+	}
+	return true
+}
+
+type featureStatus struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Default     bool            `json:"default"`
+	Projects    map[string]bool `json:"projects,omitempty"`
+}
+
+func (f *featureFlags) status() []featureStatus {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	var out []featureStatus
+	for _, name := range featureNames() {
+		s := featureStatus{Name: name, Description: knownFeatures[name], Default: f.config.Default[name]}
+		for project, flags := range f.config.Projects {
+			if on, ok := flags[name]; ok {
+				if s.Projects == nil {
+					s.Projects = make(map[string]bool)
+				}
+				s.Projects[project] = on
+			}
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+// reportFeatures records the flags that applied to a log of project in its
+// response, as the features object and the X-Feature-Flags header.
+func reportFeatures(c *gin.Context, resp gin.H, project string) {
+	state := features.forProject(project)
+	var enabled []string
+	for _, name := range featureNames() {
+		if state[name] {
+			enabled = append(enabled, name)
+		}
+	}
+	if len(enabled) > 0 {
+		c.Header(featureHeader, strings.Join(enabled, ","))
+	}
+	resp["features"] = state
+}
+
+type setFeatureRequest struct {
+	Enabled *bool `json:"enabled" binding:"required"`
+}
+
+func registerFeatureRoutes(r *gin.Engine) {
+	r.GET("/features", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"features": features.status()})
+	})
+	r.PUT("/features/:flag", func(c *gin.Context) {
+		setFeatureHandler(c, "")
+	})
+	r.GET("/projects/:project/features", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"project": c.Param("project"), "features": features.forProject(c.Param("project"))})
+	})
+	r.PUT("/projects/:project/features/:flag", func(c *gin.Context) {
+		setFeatureHandler(c, c.Param("project"))
+	})
+	r.DELETE("/projects/:project/features/:flag", func(c *gin.Context) {
+		project, flag := c.Param("project"), c.Param("flag")
+		if !features.clear(project, flag) {
+			respondError(c, http.StatusNotFound, codeNotFound, "Project "+strconv.Quote(project)+" does not override "+strconv.Quote(flag))
+			return
+		}
+		logger.Info("Feature flag override removed", zap.String("project", project), zap.String("flag", flag))
+		c.JSON(http.StatusOK, gin.H{"status": "cleared", "project": project, "flag": flag, "enabled": features.Enabled(flag, project)})
+	})
+}
+
+func setFeatureHandler(c *gin.Context, project string) {
+	flag := c.Param("flag")
+	var req setFeatureRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		requestLogger(c).Error("Failed to bind feature flag request", zap.Error(err))
+		respondBindError(c, err)
+		return
+	}
+	if err := features.set(project, flag, *req.Enabled); err != nil {
+		respondError(c, http.StatusNotFound, codeNotFound, err.Error())
+		return
+	}
+	requestLogger(c).Info("Feature flag changed", zap.String("project", project), zap.String("flag", flag), zap.Bool("enabled", *req.Enabled))
+	resp := gin.H{"flag": flag, "enabled": *req.Enabled}
+	if project != "" {
+		resp["project"] = project
+	}
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func TestLoadFeatureFlags(t *testing.T) {
+	defer func() { features = newFeatureFlags(featureConfig{}) }()
+	path := filepath.Join(t.TempDir(), "features.json")
+	config := `{"default": {"nested-wrapper": false},
+		"projects": {"big-game": {"delta-encoding": false, "adaptive-encoder": true}}}`
+	if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to write feature file: %v", err)
+	}
+	if err := loadFeatureFlags(path, []string{featureDeltaEncoding, featureNestedWrapper}); err != nil {
+		t.Fatalf("Failed to load feature flags: %v", err)
+	}
+
+	cases := []struct {
+		flag, project string
+		want          bool
+	}{
+		{featureDeltaEncoding, "web", true},       // -features
+		{featureNestedWrapper, "web", false},      // the file's default wins over -features
+		{featureDeltaEncoding, "big-game", false}, // project override
+		{featureAdaptiveEncoder, "big-game", true},
+		{featureAdaptiveEncoder, "web", false},
+	}
+	for _, c := range cases {
+		if got := features.Enabled(c.flag, c.project); got != c.want {
+			t.Errorf("%s for %s = %v, want %v", c.flag, c.project, got, c.want)
+		}
+	}
+
+	if err := loadFeatureFlags("", []string{"warp-drive"}); err == nil {
+		t.Error("expected an unknown flag to be rejected")
+	}
+	os.WriteFile(path, []byte(`{"projects": {"p": {"delta-encodeing": true}}}`), 0644)
+	if err := loadFeatureFlags(path, nil); err == nil || !strings.Contains(err.Error(), "delta-encodeing") {
+		t.Errorf("expected a misspelled flag in the file to be rejected, got %v", err)
+	}
+}
+
+func TestFeatureFlagRoutes(t *testing.T) {
+	logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	features = newFeatureFlags(featureConfig{})
+	defer func() { features = newFeatureFlags(featureConfig{}) }()
+
+	r := gin.New()
+	registerFeatureRoutes(r)
+	r.POST("/log", logHandler)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do(http.MethodPut, "/features/delta-encoding", `{"enabled": true}`); w.Code != http.StatusOK {
+		t.Fatalf("expected the default to change, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodPut, "/projects/warmup/features/nested-wrapper", `{"enabled": true}`); w.Code != http.StatusOK {
+		t.Fatalf("expected the override to be set, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodPut, "/features/warp-drive", `{"enabled": true}`); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown flag, got %d", w.Code)
+	}
+	if w := do(http.MethodPut, "/features/delta-encoding", `{}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without enabled, got %d", w.Code)
+	}
+
+	// Logs report the flags that applied to them.
+	body, _ := json.Marshal(warmupPayload(1))
+	w := do(http.MethodPost, "/log", string(body))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected the log to pass, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get(featureHeader); got != "delta-encoding,nested-wrapper" {
+		t.Errorf("%s = %q", featureHeader, got)
+	}
+	var resp struct {
+		Features map[string]bool `json:"features"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if !resp.Features[featureDeltaEncoding] || !resp.Features[featureNestedWrapper] || resp.Features[featureAdaptiveEncoder] {
+		t.Errorf("unexpected features in response: %v", resp.Features)
+	}
+
+	w = do(http.MethodGet, "/features", "")
+	if !bytes.Contains(w.Body.Bytes(), []byte(`"projects":{"warmup":true}`)) {
+		t.Errorf("expected the override in the status: %s", w.Body.String())
+	}
+	if w := do(http.MethodDelete, "/projects/warmup/features/nested-wrapper", ""); w.Code != http.StatusOK {
+		t.Errorf("expected the override to be removed, got %d", w.Code)
+	}
+	if w := do(http.MethodDelete, "/projects/warmup/features/nested-wrapper", ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a missing override, got %d", w.Code)
+	}
+	if features.Enabled(featureNestedWrapper, "warmup") {
+		t.Error("expected nested-wrapper to fall back to the default")
+	}
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/homveloper/exp-avro-json/server/logpb"
+)
+
+// The sample data of the encoding benchmarks, shared with POST /benchmark:
+// a user's game characters (avro_json_benchmark_test.go,
+// memory_analysis_benchmark_test.go) and the flat records of the
+// optimization threshold analysis (threshold_test.go). Their protobuf forms
+// are the messages of logpb/bench.proto.
+
+type UserCharacterStorage struct {
+	UserID     string      `json:"user_id"`
+	Characters []Character `json:"characters"`
+}
+
+type Character struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Level      int       `json:"level"`
+	Experience int       `json:"experience"`
+	Stats      Stats     `json:"stats"`
+	Inventory  []Item    `json:"inventory"`
+	Skills     []Skill   `json:"skills"`
+	Equipment  Equipment `json:"equipment"`
+	Quests     []Quest   `json:"quests"`
+	Metadata   Metadata  `json:"metadata"`
+}
+
+type Stats struct {
+	Health   int `json:"health"`
+	Mana     int `json:"mana"`
+	Strength int `json:"strength"`
+	Defense  int `json:"defense"`
+	Agility  int `json:"agility"`
+	Magic    int `json:"magic"`
+}
+
+type Item struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Quantity int    `json:"quantity"`
+	Rarity   string `json:"rarity"`
+}
+
+type Skill struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Level    int    `json:"level"`
+	Cooldown int    `json:"cooldown"`
+}
+
+type Equipment struct {
+	Weapon    string `json:"weapon"`
+	Armor     string `json:"armor"`
+	Accessory string `json:"accessory"`
+}
+
+type Quest struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Progress int    `json:"progress"`
+	Status   string `json:"status"`
+}
+
+type Metadata struct {
+	CreatedAt    string `json:"created_at"`
+	LastModified string `json:"last_modified"`
+	PlayTime     int    `json:"play_time"`
+}
+
+const userCharacterSchema = `{
+	"type": "record",
+	"name": "UserCharacterStorage",
+	"fields": [
+		{"name": "user_id", "type": "string"},
+		{
+			"name": "characters",
+			"type": {
+				"type": "array",
+				"items": {
+					"type": "record",
+					"name": "Character",
+					"fields": [
+						{"name": "id", "type": "string"},
+						{"name": "name", "type": "string"},
+						{"name": "level", "type": "int"},
+						{"name": "experience", "type": "int"},
+						{
+							"name": "stats",
+							"type": {
+								"type": "record",
+								"name": "Stats",
+								"fields": [
+									{"name": "health", "type": "int"},
+									{"name": "mana", "type": "int"},
+									{"name": "strength", "type": "int"},
+									{"name": "defense", "type": "int"},
+									{"name": "agility", "type": "int"},
+									{"name": "magic", "type": "int"}
+								]
+							}
+						},
+						{
+							"name": "inventory",
+							"type": {
+								"type": "array",
+								"items": {
+									"type": "record",
+									"name": "Item",
+									"fields": [
+										{"name": "id", "type": "string"},
+										{"name": "name", "type": "string"},
+										{"name": "type", "type": "string"},
+										{"name": "quantity", "type": "int"},
+										{"name": "rarity", "type": "string"}
+									]
+								}
+							}
+						},
+						{
+							"name": "skills",
+							"type": {
+								"type": "array",
+								"items": {
+									"type": "record",
+									"name": "Skill",
+									"fields": [
+										{"name": "id", "type": "string"},
+										{"name": "name", "type": "string"},
+										{"name": "level", "type": "int"},
+										{"name": "cooldown", "type": "int"}
+									]
+								}
+							}
+						},
+						{
+							"name": "equipment",
+							"type": {
+								"type": "record",
+								"name": "Equipment",
+								"fields": [
+									{"name": "weapon", "type": "string"},
+									{"name": "armor", "type": "string"},
+									{"name": "accessory", "type": "string"}
+								]
+							}
+						},
+						{
+							"name": "quests",
+							"type": {
+								"type": "array",
+								"items": {
+									"type": "record",
+									"name": "Quest",
+									"fields": [
+										{"name": "id", "type": "string"},
+										{"name": "name", "type": "string"},
+										{"name": "progress", "type": "int"},
+										{"name": "status", "type": "string"}
+									]
+								}
+							}
+						},
+						{
+							"name": "metadata",
+							"type": {
+								"type": "record",
+								"name": "Metadata",
+								"fields": [
+									{"name": "created_at", "type": "string"},
+									{"name": "last_modified", "type": "string"},
+									{"name": "play_time", "type": "int"}
+								]
+							}
+						}
+					]
+				}
+			}
+		}
+	]
+}`
+
+// gofakeit을 사용하여 더미 캐릭터 데이터 생성
+func generateDummyCharacters(count int) UserCharacterStorage {
+	storage := UserCharacterStorage{
+		UserID:     gofakeit.UUID(),
+		Characters: make([]Character, count),
+	}
+
+	for i := 0; i < count; i++ {
+		char := Character{
+			ID:         gofakeit.UUID(),
+			Name:       gofakeit.Username(),
+			Level:      gofakeit.Number(1, 100),
+			Experience: gofakeit.Number(0, 100000),
+			Stats: Stats{
+				Health:   gofakeit.Number(100, 10000),
+				Mana:     gofakeit.Number(50, 5000),
+				Strength: gofakeit.Number(10, 100),
+				Defense:  gofakeit.Number(10, 100),
+				Agility:  gofakeit.Number(10, 100),
+				Magic:    gofakeit.Number(10, 100),
+			},
+			Equipment: Equipment{
+				Weapon:    gofakeit.Word(),
+				Armor:     gofakeit.Word(),
+				Accessory: gofakeit.Word(),
+			},
+			Metadata: Metadata{
+				CreatedAt:    gofakeit.Date().Format("2006-01-02 15:04:05"),
+				LastModified: gofakeit.Date().Format("2006-01-02 15:04:05"),
+				PlayTime:     gofakeit.Number(0, 10000),
+			},
+		}
+
+		// Generate inventory
+		itemCount := gofakeit.Number(5, 20)
+		char.Inventory = make([]Item, itemCount)
+		for j := 0; j < itemCount; j++ {
+			char.Inventory[j] = Item{
+				ID:       gofakeit.UUID(),
+				Name:     gofakeit.Word(),
+				Type:     gofakeit.RandomString([]string{"weapon", "armor", "consumable", "material"}),
+				Quantity: gofakeit.Number(1, 99),
+				Rarity:   gofakeit.RandomString([]string{"common", "rare", "epic", "legendary"}),
+			}
+		}
+
+		// Generate skills
+		skillCount := gofakeit.Number(3, 10)
+		char.Skills = make([]Skill, skillCount)
+		for j := 0; j < skillCount; j++ {
+			char.Skills[j] = Skill{
+				ID:       gofakeit.UUID(),
+				Name:     gofakeit.Word(),
+				Level:    gofakeit.Number(1, 10),
+				Cooldown: gofakeit.Number(0, 300),
+			}
+		}
+
+		// Generate quests
+		questCount := gofakeit.Number(2, 8)
+		char.Quests = make([]Quest, questCount)
+		for j := 0; j < questCount; j++ {
+			char.Quests[j] = Quest{
+				ID:       gofakeit.UUID(),
+				Name:     gofakeit.Sentence(3),
+				Progress: gofakeit.Number(0, 100),
+				Status:   gofakeit.RandomString([]string{"active", "completed", "failed", "abandoned"}),
+			}
+		}
+
+		storage.Characters[i] = char
+	}
+
+	return storage
+}
+
+// Simple test structure
+type SimpleRecord struct {
+	ID       int64             `json:"id"`
+	Name     string            `json:"name"`
+	Email    string            `json:"email"`
+	Active   bool              `json:"active"`
+	Score    float64           `json:"score"`
+	Tags     []string          `json:"tags"`
+	Settings map[string]string `json:"settings"`
+}
+
+const simpleRecordSchema = `{
+	"type": "record",
+	"name": "SimpleRecord",
+	"fields": [
+		{"name": "id", "type": "long"},
+		{"name": "name", "type": "string"},
+		{"name": "email", "type": "string"},
+		{"name": "active", "type": "boolean"},
+		{"name": "score", "type": "double"},
+		{"name": "tags", "type": {"type": "array", "items": "string"}},
+		{"name": "settings", "type": {"type": "map", "values": "string"}}
+	]
+}`
+
+func generateTestRecords(count int) []SimpleRecord {
+	records := make([]SimpleRecord, count)
+	for i := 0; i < count; i++ {
+		records[i] = SimpleRecord{
+			ID:     int64(i + 1000),
+			Name:   fmt.Sprintf("User_%d", i),
+			Email:  fmt.Sprintf("user%d@example.com", i),
+			Active: i%2 == 0,
+			Score:  float64(60 + (i % 40)),
+			Tags:   []string{fmt.Sprintf("tag_%d", i%5), "common"},
+			Settings: map[string]string{
+				"theme": []string{"light", "dark"}[i%2],
+				"lang":  []string{"ko", "en"}[i%2],
+			},
+		}
+	}
+	return records
+}
+
+func (s UserCharacterStorage) protobuf() *logpb.UserCharacterStorage {
+	m := &logpb.UserCharacterStorage{UserID: s.UserID, Characters: make([]*logpb.Character, len(s.Characters))}
+	for i, c := range s.Characters {
+		pc := &logpb.Character{
+			ID:         c.ID,
+			Name:       c.Name,
+			Level:      int32(c.Level),
+			Experience: int32(c.Experience),
+			Stats: &logpb.Stats{
+				Health:   int32(c.Stats.Health),
+				Mana:     int32(c.Stats.Mana),
+				Strength: int32(c.Stats.Strength),
+				Defense:  int32(c.Stats.Defense),
+				Agility:  int32(c.Stats.Agility),
+				Magic:    int32(c.Stats.Magic),
+			},
+			Equipment: &logpb.Equipment{Weapon: c.Equipment.Weapon, Armor: c.Equipment.Armor, Accessory: c.Equipment.Accessory},
+			Metadata:  &logpb.Metadata{CreatedAt: c.Metadata.CreatedAt, LastModified: c.Metadata.LastModified, PlayTime: int32(c.Metadata.PlayTime)},
+		}
+		for _, item := range c.Inventory {
+			pc.Inventory = append(pc.Inventory, &logpb.Item{ID: item.ID, Name: item.Name, Type: item.Type, Quantity: int32(item.Quantity), Rarity: item.Rarity})
+		}
+		for _, skill := range c.Skills {
+			pc.Skills = append(pc.Skills, &logpb.Skill{ID: skill.ID, Name: skill.Name, Level: int32(skill.Level), Cooldown: int32(skill.Cooldown)})
+		}
+		for _, quest := range c.Quests {
+			pc.Quests = append(pc.Quests, &logpb.Quest{ID: quest.ID, Name: quest.Name, Progress: int32(quest.Progress), Status: quest.Status})
+		}
+		m.Characters[i] = pc
+	}
+	return m
+}
+
+func (r SimpleRecord) protobuf() *logpb.SimpleRecord {
+	return &logpb.SimpleRecord{
+		ID:       r.ID,
+		Name:     r.Name,
+		Email:    r.Email,
+		Active:   r.Active,
+		Score:    r.Score,
+		Tags:     r.Tags,
+		Settings: r.Settings,
+	}
+}
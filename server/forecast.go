@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Forecasts warn before a project runs out of its daily quota or the
+// storage disk fills up, rather than when requests start failing. Every
+// -forecast-interval the forecaster samples each project's stored bytes
+// and quota usage and the free space of -forecast-disk-dir, smooths their
+// growth rates with an exponentially weighted moving average, and projects
+// them linearly: a quota is at risk when its rate exhausts it before the
+// midnight reset, the disk when its rate fills it, and either only when
+// that happens within -forecast-horizon. GET /stats/forecast reports the
+// latest forecasts; with -forecast-webhook each newly at-risk forecast is
+// also POSTed there once, quotas once per day and the disk again only
+// after it recovered.
+
+// forecastAlpha weighs the latest sample's rate in the moving average.
+const forecastAlpha = 0.3
+
+// rateEWMA smooths the growth rate of a value, per second.
+type rateEWMA struct {
+	// resets marks counters set back to zero now and then, such as the
+	// quota usage at midnight.
+	resets bool
+	rate   float64
+	last   float64
+	primed bool
+	seen   bool
+}
+
+// observe records the value dt after the previous one. A counter that
+// resets and fell since counts as grown from zero.
+func (r *rateEWMA) observe(value float64, dt time.Duration) {
+	if !r.seen || dt <= 0 {
+		r.last, r.seen = value, true
+		return
+	}
+	delta := value - r.last
+	if r.resets && delta < 0 {
+		delta = value
+	}
+	rate := delta / dt.Seconds()
+	if r.primed {
+		rate = forecastAlpha*rate + (1-forecastAlpha)*r.rate
+	}
+	r.rate, r.last, r.primed = rate, value, true
+}
+
+func (r *rateEWMA) perHour() float64 { return r.rate * 3600 }
+
+// exhaustsAt returns when the counter reaches limit at its current rate, or
+// false when it does not grow.
+func (r *rateEWMA) exhaustsAt(now time.Time, used, limit float64) (time.Time, bool) {
+	if !r.primed || r.rate <= 0 {
+		return time.Time{}, false
+	}
+	left := math.Max(limit-used, 0) / r.rate
+	if left > (100 * 365 * 24 * time.Hour).Seconds() {
+		return time.Time{}, false
+	}
+	return now.Add(time.Duration(left * float64(time.Second))), true
+}
+
+// quotaForecast projects one quota of a project.
+type quotaForecast struct {
+	Quota       string     `json:"quota"`
+	Limit       int64      `json:"limit"`
+	Used        int64      `json:"used"`
+	RatePerHour float64    `json:"rate_per_hour"`
+	ExhaustsAt  *time.Time `json:"exhausts_at,omitempty"`
+	AtRisk      bool       `json:"at_risk"`
+}
+
+// projectForecast reports a project's storage growth and quota forecasts.
+type projectForecast struct {
+	StoredBytes       int64           `json:"stored_bytes"`
+	StoredBytesPerDay float64         `json:"stored_bytes_per_day"`
+	Quotas            []quotaForecast `json:"quotas,omitempty"`
+}
+
+// diskForecast projects the free space of the storage disk.
+type diskForecast struct {
+	Dir         string     `json:"dir"`
+	FreeBytes   int64      `json:"free_bytes"`
+	BytesPerDay float64    `json:"bytes_per_day"`
+	ExhaustsAt  *time.Time `json:"exhausts_at,omitempty"`
+	AtRisk      bool       `json:"at_risk"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// forecastAlert is the body POSTed to -forecast-webhook.
+type forecastAlert struct {
+	Kind        string    `json:"kind"` // quota or disk
+	Project     string    `json:"project,omitempty"`
+	Quota       string    `json:"quota,omitempty"`
+	Dir         string    `json:"dir,omitempty"`
+	Limit       int64     `json:"limit,omitempty"`
+	Used        int64     `json:"used,omitempty"`
+	FreeBytes   int64     `json:"free_bytes,omitempty"`
+	RatePerHour float64   `json:"rate_per_hour"`
+	ExhaustsAt  time.Time `json:"exhausts_at"`
+}
+
+// forecaster samples growth and keeps the latest forecasts.
+type forecaster struct {
+	horizon time.Duration
+	dir     string
+	webhook string
+	client  *http.Client
+	free    func(dir string) (int64, error)
+
+	mu       sync.Mutex
+	stored   map[string]int64 // bytes stored per project since start
+	rates    map[string]*rateEWMA
+	diskRate rateEWMA
+	last     time.Time
+	sampled  time.Time
+	projects map[string]projectForecast
+	disk     *diskForecast
+	alerted  map[string]bool
+}
+
+var forecasts *forecaster
+
+func newForecaster(horizon time.Duration, dir, webhook string) *forecaster {
+	return &forecaster{
+		horizon:  horizon,
+		dir:      dir,
+		webhook:  webhook,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		free:     diskFree,
+		stored:   make(map[string]int64),
+		rates:    make(map[string]*rateEWMA),
+		projects: make(map[string]projectForecast),
+		alerted:  make(map[string]bool),
+	}
+}
+
+// recordStorageGrowth counts size bytes stored for project.
+func recordStorageGrowth(project string, size int) {
+	if forecasts == nil {
+		return
+	}
+	forecasts.mu.Lock()
+	forecasts.stored[project] += int64(size)
+	forecasts.mu.Unlock()
+}
+
+// rate returns the rate of the counter key, which starts at zero.
+func (f *forecaster) rate(key string, resets bool) *rateEWMA {
+	r := f.rates[key]
+	if r == nil {
+		r = &rateEWMA{resets: resets, seen: true}
+		f.rates[key] = r
+	}
+	return r
+}
+
+// sample updates the forecasts as of now and returns the alerts for
+// forecasts that became at risk.
+func (f *forecaster) sample(now time.Time) []forecastAlert {
+	var usage map[string]quotaUsage
+	var limits map[string]quotaLimits
+	var resetsAt time.Time
+	if q := quotas; q != nil {
+		q.mu.Lock()
+		usage, limits = make(map[string]quotaUsage, len(q.usage)), make(map[string]quotaLimits, len(q.usage))
+		for project, u := range q.usage {
+			usage[project], limits[project] = *u, q.limits(project)
+		}
+		resetsAt = q.day.AddDate(0, 0, 1)
+		q.mu.Unlock()
+	}
+	var free int64
+	var freeErr error
+	if f.dir != "" {
+		free, freeErr = f.free(f.dir)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var dt time.Duration
+	if !f.last.IsZero() {
+		dt = now.Sub(f.last)
+	}
+	if !utcDay(now).Equal(utcDay(f.last)) {
+		// Quotas alert once per day.
+		for key := range f.alerted {
+			if key != "disk" {
+				delete(f.alerted, key)
+			}
+		}
+	}
+	f.last, f.sampled = now, now
+	horizon := now.Add(f.horizon)
+	var alerts []forecastAlert
+
+	projects := make(map[string]projectForecast, len(f.stored))
+	for project, stored := range f.stored {
+		r := f.rate("stored/"+project, false)
+		r.observe(float64(stored), dt)
+		projects[project] = projectForecast{StoredBytes: stored, StoredBytesPerDay: r.perHour() * 24}
+	}
+	for project, u := range usage {
+		p := projects[project]
+		l := limits[project]
+		for _, q := range []struct {
+			name  string
+			limit int64
+			used  int64
+		}{{"events_per_day", l.EventsPerDay, u.Events}, {"bytes_per_day", l.BytesPerDay, u.Bytes}} {
+			key := "quota/" + project + "/" + q.name
+			r := f.rate(key, true)
+			r.observe(float64(q.used), dt)
+			if q.limit <= 0 {
+				continue
+			}
+			qf := quotaForecast{Quota: q.name, Limit: q.limit, Used: q.used, RatePerHour: r.perHour()}
+			if at, ok := r.exhaustsAt(now, float64(q.used), float64(q.limit)); ok {
+				qf.ExhaustsAt = &at
+				qf.AtRisk = at.Before(horizon) && at.Before(resetsAt)
+				if f.alert(key, qf.AtRisk) {
+					alerts = append(alerts, forecastAlert{Kind: "quota", Project: project, Quota: q.name,
+						Limit: q.limit, Used: q.used, RatePerHour: qf.RatePerHour, ExhaustsAt: at})
+				}
+			}
+			p.Quotas = append(p.Quotas, qf)
+		}
+		projects[project] = p
+	}
+	f.projects = projects
+
+	f.disk = nil
+	if f.dir != "" {
+		d := &diskForecast{Dir: f.dir}
+		if freeErr != nil {
+			d.Error = freeErr.Error()
+		} else {
+			// Consumption is the fall of the free space.
+			r := &f.diskRate
+			r.observe(-float64(free), dt)
+			d.FreeBytes, d.BytesPerDay = free, r.perHour()*24
+			if at, ok := r.exhaustsAt(now, 0, float64(free)); ok {
+				d.ExhaustsAt = &at
+				d.AtRisk = at.Before(horizon)
+			}
+			if f.alert("disk", d.AtRisk) {
+				alerts = append(alerts, forecastAlert{Kind: "disk", Dir: f.dir, FreeBytes: free, RatePerHour: r.perHour(), ExhaustsAt: *d.ExhaustsAt})
+			} else if !d.AtRisk {
+				delete(f.alerted, "disk")
+			}
+		}
+		f.disk = d
+	}
+	return alerts
+}
+
+// alert reports whether a forecast at risk has not been alerted yet,
+// marking it alerted.
+func (f *forecaster) alert(key string, atRisk bool) bool {
+	if !atRisk || f.alerted[key] {
+		return false
+	}
+	f.alerted[key] = true
+	return true
+}
+
+// status reports the latest forecasts.
+func (f *forecaster) status() gin.H {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	names := make([]string, 0, len(f.projects))
+	for name := range f.projects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	projects := gin.H{}
+	for _, name := range names {
+		projects[name] = f.projects[name]
+	}
+	resp := gin.H{"horizon": f.horizon.String(), "projects": projects}
+	if !f.sampled.IsZero() {
+		resp["sampled_at"] = f.sampled
+	}
+	if f.disk != nil {
+		resp["disk"] = f.disk
+	}
+	return resp
+}
+
+// sendAlert POSTs alert to the webhook, logging failures; alerts are not
+// retried, as the next breach is a new one.
+func (f *forecaster) sendAlert(ctx context.Context, alert forecastAlert) {
+	logger.Warn("Forecast at risk",
+		zap.String("kind", alert.Kind),
+		zap.String("project", alert.Project),
+		zap.String("quota", alert.Quota),
+		zap.Time("exhausts_at", alert.ExhaustsAt))
+	if f.webhook == "" {
+		return
+	}
+	body, _ := json.Marshal(alert)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.webhook, bytes.NewReader(body))
+	if err != nil {
+		logger.Error("Failed to build forecast alert", zap.Error(err))
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := f.client.Do(req)
+	if err != nil {
+		logger.Error("Failed to send forecast alert", zap.String("webhook", f.webhook), zap.Error(err))
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		logger.Error("Forecast webhook rejected alert", zap.String("webhook", f.webhook), zap.Int("status", resp.StatusCode))
+	}
+}
+
+// runForecasts samples every interval until ctx is done.
+func runForecasts(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	forecasts.sample(time.Now())
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, alert := range forecasts.sample(now) {
+				forecasts.sendAlert(ctx, alert)
+			}
+		}
+	}
+}
+
+func forecastHandler(c *gin.Context) {
+	if forecasts == nil {
+		respondError(c, http.StatusNotFound, codeNotFound, "Forecasting is disabled")
+		return
+	}
+	c.JSON(http.StatusOK, forecasts.status())
+}
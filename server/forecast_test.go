@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func TestForecasterAlertsAhead(t *testing.T) {
+	logger = zap.NewNop()
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	quotas = newQuotaTracker(quotaConfig{Default: quotaLimits{EventsPerDay: 100}}, now)
+	defer func() { quotas = nil }()
+	forecasts = newForecaster(6*time.Hour, "/data", "")
+	defer func() { forecasts = nil }()
+	free := int64(1000)
+	forecasts.free = func(string) (int64, error) { return free, nil }
+
+	// Each minute the project logs 10 events of 50 bytes and the disk
+	// loses 100 bytes.
+	step := func() []forecastAlert {
+		for i := 0; i < 10; i++ {
+			quotas.reserve("raid", 50)
+			recordStorageGrowth("raid", 50)
+		}
+		free -= 100
+		now = now.Add(time.Minute)
+		return forecasts.sample(now)
+	}
+	if alerts := forecasts.sample(now); len(alerts) != 0 {
+		t.Fatalf("expected no alerts before a rate is known, got %+v", alerts)
+	}
+	alerts := step()
+	if len(alerts) != 2 || alerts[0].Kind != "quota" || alerts[0].Quota != "events_per_day" || alerts[1].Kind != "disk" {
+		t.Fatalf("expected a quota and a disk alert, got %+v", alerts)
+	}
+	if want := now.Add(9 * time.Minute); !alerts[0].ExhaustsAt.Equal(want) || alerts[0].RatePerHour != 600 {
+		t.Errorf("expected the quota to run out at %v at 600 events/h, got %+v", want, alerts[0])
+	}
+	if want := now.Add(9 * time.Minute); !alerts[1].ExhaustsAt.Equal(want) || alerts[1].FreeBytes != 900 {
+		t.Errorf("expected the disk to fill at %v, got %+v", want, alerts[1])
+	}
+	if alerts := step(); len(alerts) != 0 {
+		t.Errorf("expected alerts to fire once, got %+v", alerts)
+	}
+
+	status := forecasts.status()
+	p := status["projects"].(gin.H)["raid"].(projectForecast)
+	if p.StoredBytes != 1000 || math.Abs(p.StoredBytesPerDay-500*60*24) > 1e-6 || len(p.Quotas) != 1 || !p.Quotas[0].AtRisk {
+		t.Errorf("unexpected project forecast %+v", p)
+	}
+
+	// Free space recovering clears the disk alert, and the next fall
+	// fires it again.
+	free = 100000
+	now = now.Add(time.Minute)
+	forecasts.sample(now)
+	if d := forecasts.status()["disk"].(*diskForecast); d.AtRisk {
+		t.Errorf("expected the disk to recover, got %+v", d)
+	}
+	free = 1000
+	now = now.Add(time.Minute)
+	if alerts := forecasts.sample(now); len(alerts) != 1 || alerts[0].Kind != "disk" {
+		t.Errorf("expected the disk to alert again, got %+v", alerts)
+	}
+}
+
+func TestForecastWebhookAndHandler(t *testing.T) {
+	logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	received := make(chan forecastAlert, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert forecastAlert
+		json.NewDecoder(r.Body).Decode(&alert)
+		received <- alert
+	}))
+	defer srv.Close()
+
+	r := gin.New()
+	r.GET("/stats/forecast", forecastHandler)
+	if w := doJSON(r, http.MethodGet, "/stats/forecast", nil); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 with forecasting off, got %d", w.Code)
+	}
+
+	forecasts = newForecaster(time.Hour, "", srv.URL)
+	defer func() { forecasts = nil }()
+	forecasts.sendAlert(context.Background(), forecastAlert{Kind: "quota", Project: "raid", Quota: "bytes_per_day"})
+	if alert := <-received; alert.Project != "raid" || alert.Quota != "bytes_per_day" {
+		t.Errorf("unexpected alert %+v", alert)
+	}
+
+	recordStorageGrowth("raid", 10)
+	forecasts.sample(time.Now())
+	w := doJSON(r, http.MethodGet, "/stats/forecast", nil)
+	var resp struct {
+		Horizon  string                     `json:"horizon"`
+		Projects map[string]projectForecast `json:"projects"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusOK || resp.Horizon != "1h0m0s" || resp.Projects["raid"].StoredBytes != 10 {
+		t.Errorf("unexpected forecast response %d: %s", w.Code, w.Body.String())
+	}
+}
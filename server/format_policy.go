@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"mime"
+	"strings"
+
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+)
+
+// Automatic format selection puts the break-even analysis of
+// threshold_test.go to use. Columnar JSON writes the schema once and every
+// record as an array of values, so it only beats plain JSON past a number
+// of records that depends on the schema and the records; Avro binary is
+// smaller still but needs a client that reads Avro. GET /logs/export with
+// format=auto encodes the first autoFormatSample records in every format
+// the client takes, streams the smallest and names it and why in the
+// X-Export-Format and X-Export-Format-Reason headers.
+const autoFormatSample = exportBatch
+
+const (
+	exportFormatHeader       = "X-Export-Format"
+	exportFormatReasonHeader = "X-Export-Format-Reason"
+)
+
+// formatSize is what a sample of records takes in one format: the bytes
+// written for no records at all, such as an embedded schema, and for the
+// whole sample.
+type formatSize struct {
+	format string
+	fixed  int
+	total  int
+}
+
+type formatDecision struct {
+	format string
+	reason string
+}
+
+// chooseFormat picks the smallest of sizes for a sample of records, which
+// is only the start of the batch when more is set. The first size is the
+// baseline the others' break-even point is given against, and wins ties,
+// so plain JSON is kept unless another format saves bytes. notes, such as
+// formats the client cannot take, end the reason.
+func chooseFormat(sizes []formatSize, records int, more bool, notes []string) formatDecision {
+	base := sizes[0]
+	if records == 0 {
+		return formatDecision{format: base.format, reason: strings.Join(append([]string{"no records to compare formats on"}, notes...), "; ")}
+	}
+	best := base
+	for _, s := range sizes[1:] {
+		if s.total < best.total {
+			best = s
+		}
+	}
+	sample := fmt.Sprintf("the %d records", records)
+	if more {
+		sample = fmt.Sprintf("the first %d records", records)
+	}
+	parts := make([]string, len(sizes))
+	for i, s := range sizes {
+		parts[i] = fmt.Sprintf("%s %d bytes", s.format, s.total)
+		if i > 0 {
+			parts[i] += " (" + breakEven(base, s, records) + ")"
+		}
+	}
+	reason := fmt.Sprintf("%s is smallest for %s: %s", best.format, sample, strings.Join(parts, ", "))
+	return formatDecision{format: best.format, reason: strings.Join(append([]string{reason}, notes...), "; ")}
+}
+
+// breakEven describes from how many records s is smaller than base,
+// projecting both from their per-record size in the sample.
+func breakEven(base, s formatSize, records int) string {
+	perBase := float64(base.total-base.fixed) / float64(records)
+	per := float64(s.total-s.fixed) / float64(records)
+	if per >= perBase {
+		if s.fixed < base.fixed {
+			return "smaller at any count"
+		}
+		return "never breaks even"
+	}
+	n := int(math.Ceil(float64(s.fixed-base.fixed) / (perBase - per)))
+	if n < 1 {
+		return "smaller at any count"
+	}
+	return fmt.Sprintf("breaks even at %d records", n)
+}
+
+// measureFormats encodes records in each of formats as the export would,
+// counting the bytes instead of sending them.
+func measureFormats(formats []string, records []interface{}, codec *avrojson.Codec, stripUnions bool) ([]formatSize, error) {
+	sizes := make([]formatSize, len(formats))
+	for i, format := range formats {
+		sizes[i].format = format
+		for _, sample := range []struct {
+			records []interface{}
+			size    *int
+		}{{nil, &sizes[i].fixed}, {records, &sizes[i].total}} {
+			var n byteCounter
+			enc, err := newExportEncoder(format, &n, codec, stripUnions)
+			if err != nil {
+				return nil, err
+			}
+			for _, record := range sample.records {
+				if err = enc.emit(record); err != nil {
+					break
+				}
+			}
+			if err == nil {
+				err = enc.finish()
+			}
+			enc.close()
+			if err != nil {
+				return nil, fmt.Errorf("measure %s: %w", format, err)
+			}
+			*sample.size = int(n)
+		}
+	}
+	return sizes, nil
+}
+
+// byteCounter is an io.Writer that only counts.
+type byteCounter int64
+
+func (n *byteCounter) Write(p []byte) (int, error) {
+	*n += byteCounter(len(p))
+	return len(p), nil
+}
+
+// acceptsMediaType reports whether an Accept header names mediaType with a
+// non-zero quality. Wildcards do not count: a client that did not ask for
+// Avro by name is not assumed to read it.
+func acceptsMediaType(accept, mediaType string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		t, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || t != mediaType {
+			continue
+		}
+		if q, ok := params["q"]; ok && strings.Trim(q, "0.") == "" {
+			continue
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestChooseFormat(t *testing.T) {
+	// Plain JSON has no fixed part; columnar JSON pays 400 bytes of schema
+	// and saves 60 bytes a record, so it breaks even at 7 records.
+	sizes := func(records int) []formatSize {
+		return []formatSize{
+			{format: "ndjson", total: 100 * records},
+			{format: "columnar", fixed: 400, total: 400 + 40*records},
+		}
+	}
+	for _, c := range []struct {
+		records int
+		more    bool
+		want    string
+		reason  string
+	}{
+		{0, false, "ndjson", "no records"},
+		{3, false, "ndjson", "ndjson is smallest for the 3 records: ndjson 300 bytes, columnar 520 bytes (breaks even at 7 records)"},
+		{6, false, "ndjson", "breaks even at 7 records"},
+		{7, false, "columnar", "columnar 680 bytes"},
+		{8, false, "columnar", "columnar is smallest for the 8 records"},
+		{500, true, "columnar", "for the first 500 records"},
+	} {
+		d := chooseFormat(sizes(c.records), c.records, c.more, []string{"ocf not considered"})
+		if d.format != c.want || !strings.Contains(d.reason, c.reason) || !strings.HasSuffix(d.reason, "; ocf not considered") {
+			t.Errorf("%d records: got %s (%s), want %s (%s)", c.records, d.format, d.reason, c.want, c.reason)
+		}
+	}
+
+	if got := breakEven(formatSize{total: 100}, formatSize{total: 120}, 1); got != "never breaks even" {
+		t.Errorf("a larger format: %s", got)
+	}
+	if got := breakEven(formatSize{fixed: 50, total: 150}, formatSize{fixed: 10, total: 60}, 1); got != "smaller at any count" {
+		t.Errorf("a format smaller in every part: %s", got)
+	}
+}
+
+func TestAcceptsMediaType(t *testing.T) {
+	for accept, want := range map[string]bool{
+		"":                 false,
+		"*/*":              false,
+		"application/avro": true,
+		"application/json, application/avro;q=0.5": true,
+		"application/avro;q=0":                     false,
+		"application/avro;q=0.0, */*":              false,
+		"text/html, application/avro; q=1":         true,
+	} {
+		if got := acceptsMediaType(accept, avroContentType); got != want {
+			t.Errorf("%q: got %v, want %v", accept, got, want)
+		}
+	}
+}
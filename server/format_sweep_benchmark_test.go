@@ -0,0 +1,40 @@
+// 포맷 스윕 벤치마크 실행 방법:
+// 1. 전체 스윕 실행: go test -run=^$ -bench=FormatSweep -benchmem
+// 2. 리포트 생성: go run ./cmd/benchreport -out report.md (HTML 은 -format html)
+// POST /benchmark 의 모든 포맷을 캐릭터 수별로 측정한다. encoded_bytes 는
+// 인코딩 결과 크기로, benchreport 가 json 대비 크기 비율을 계산한다.
+
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+var formatSweepCharacters = []int{1, 5, 10, 20, 50, 100}
+
+func BenchmarkFormatSweep(b *testing.B) {
+	for _, count := range formatSweepCharacters {
+		sample, err := generateBenchmarkSample(fmt.Sprintf("%d characters", count))
+		if err != nil {
+			b.Fatalf("Failed to generate sample: %v", err)
+		}
+		for _, format := range benchmarkFormats {
+			encode, err := format.prepare(sample)
+			if err != nil {
+				continue
+			}
+			b.Run(fmt.Sprintf("characters=%d/%s", count, format.name), func(b *testing.B) {
+				size, err := encode()
+				if err != nil {
+					b.Fatalf("Failed to encode: %v", err)
+				}
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					encode()
+				}
+				b.ReportMetric(float64(size), "encoded_bytes")
+			})
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/homveloper/exp-avro-json/server/logpb"
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+)
+
+// LogService (logpb/log_service.proto) is served over h2c like the frame
+// transport, but with protobuf messages instead of JSON frames. Each RPC
+// converts its request and dispatches it to the regular routes, so the
+// encoding path is the one /log and /decode use.
+const grpcServicePrefix = "/exp.avrojson.LogService/"
+
+// gRPC status codes used by the service.
+const (
+	grpcOK                 = 0
+	grpcInvalidArgument    = 3
+	grpcNotFound           = 5
+	grpcResourceExhausted  = 8
+	grpcFailedPrecondition = 9
+	grpcInternal           = 13
+	grpcUnavailable        = 14
+)
+
+// grpcCodeFor maps the status of a dispatched request to a gRPC code.
+func grpcCodeFor(status int) int {
+	switch {
+	case status < 300:
+		return grpcOK
+	case status == http.StatusNotFound:
+		return grpcNotFound
+	case status == http.StatusConflict:
+		return grpcFailedPrecondition
+	case status == http.StatusTooManyRequests || status == http.StatusRequestEntityTooLarge:
+		return grpcResourceExhausted
+	case status == http.StatusServiceUnavailable:
+		return grpcUnavailable
+	case status < 500:
+		return grpcInvalidArgument
+	}
+	return grpcInternal
+}
+
+// grpcMethod handles one unary call. A non-zero code fails the call with
+// message as the status message.
+type grpcMethod func(handler http.Handler, request []byte, remote, authorization string) (resp logpb.Message, code int, message string)
+
+func registerGRPCService(r *gin.Engine) {
+	r.POST(grpcServicePrefix+"Ping", grpcServiceHandler(r, grpcPing))
+	r.POST(grpcServicePrefix+"Log", grpcServiceHandler(r, grpcLog))
+	r.POST(grpcServicePrefix+"LogBatch", grpcServiceHandler(r, grpcLogBatch))
+	r.POST(grpcServicePrefix+"Decode", grpcServiceHandler(r, grpcDecode))
+}
+
+func grpcServiceHandler(handler http.Handler, method grpcMethod) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		request, err := readGRPCMessage(c.Request.Body)
+		if err != nil {
+			writeGRPCStatus(c, grpcInvalidArgument, err.Error())
+			return
+		}
+		resp, code, message := method(handler, request, c.Request.RemoteAddr, c.GetHeader("Authorization"))
+		if code != grpcOK {
+			writeGRPCStatus(c, code, message)
+			return
+		}
+		writeGRPCMessage(c, resp.Marshal())
+	}
+}
+
+// dispatchJSON sends a JSON request to path and decodes the JSON response
+// into out. A failed request returns its gRPC code and error message.
+func dispatchJSON(handler http.Handler, path string, body interface{}, remote, authorization string, out interface{}) (int, string) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return grpcInternal, err.Error()
+	}
+	status, resp := dispatchRequest(handler, path, "application/json", data, "grpc", remote, authorization)
+	return decodeDispatched(status, resp, out)
+}
+
+// decodeDispatched decodes a dispatched JSON response into out, or returns
+// the gRPC code and error message of a failed one.
+func decodeDispatched(status int, body []byte, out interface{}) (int, string) {
+	if code := grpcCodeFor(status); code != grpcOK {
+		var failure struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(body, &failure) != nil || failure.Error == "" {
+			failure.Error = fmt.Sprintf("request failed with HTTP status %d", status)
+		}
+		return code, failure.Error
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return grpcInternal, "Failed to parse response: " + err.Error()
+	}
+	return grpcOK, ""
+}
+
+func grpcPing(handler http.Handler, request []byte, remote, authorization string) (logpb.Message, int, string) {
+	var req logpb.PingRequest
+	if err := req.Unmarshal(request); err != nil {
+		return nil, grpcInvalidArgument, err.Error()
+	}
+	var resp PingResponse
+	if code, message := dispatchJSON(handler, "/ping", PingRequest{Data: req.Data}, remote, authorization, &resp); code != grpcOK {
+		return nil, code, message
+	}
+	echo, _ := resp.Echo.(string)
+	return &logpb.PingResponse{Status: resp.Status, Timestamp: resp.Timestamp, Message: resp.Message, Echo: echo}, grpcOK, ""
+}
+
+func grpcLog(handler http.Handler, request []byte, remote, authorization string) (logpb.Message, int, string) {
+	var req logpb.LogRequest
+	if err := req.Unmarshal(request); err != nil {
+		return nil, grpcInvalidArgument, err.Error()
+	}
+	resp, code, message := logProtobuf(handler, &req, len(request), remote, authorization)
+	if code != grpcOK {
+		return nil, code, message
+	}
+	return resp, grpcOK, ""
+}
+
+func grpcLogBatch(handler http.Handler, request []byte, remote, authorization string) (logpb.Message, int, string) {
+	var req logpb.LogBatchRequest
+	if err := req.Unmarshal(request); err != nil {
+		return nil, grpcInvalidArgument, err.Error()
+	}
+	out := &logpb.LogBatchResponse{Results: make([]*logpb.LogResult, 0, len(req.Logs))}
+	for _, log := range req.Logs {
+		resp, code, message := logProtobuf(handler, log, len(log.Marshal()), remote, authorization)
+		out.Results = append(out.Results, &logpb.LogResult{Code: int32(code), Error: message, Log: resp})
+		if code == grpcOK {
+			out.Logged++
+		} else {
+			out.Failed++
+		}
+	}
+	return out, grpcOK, ""
+}
+
+// protobuf converts a /log request to the LogService message, as a
+// protobuf client would send it; metadata and domainData become string maps
+// as for Avro.
+func (req LogRequest) protobuf() *logpb.LogRequest {
+	return &logpb.LogRequest{
+		ProjectName:    req.ProjectName,
+		ProjectVersion: req.ProjectVersion,
+		LogLevel:       req.LogLevel,
+		LogType:        req.LogType,
+		LogSource:      req.LogSource,
+		Body:           req.LogBody.protobuf(),
+	}
+}
+
+func (body LogData) protobuf() *logpb.LogBody {
+	m := &logpb.LogBody{
+		Timestamp: body.Timestamp,
+		Logtype:   body.Logtype,
+		Version:   body.Version,
+		Issuer:    body.Issuer,
+	}
+	if body.Metadata != nil {
+		m.Metadata = avrojson.StringMap(body.Metadata)
+	}
+	if body.DomainData != nil {
+		m.DomainData = avrojson.StringMap(body.DomainData)
+	}
+	return m
+}
+
+// logProtobuf sends one protobuf log through /log. size is the length of
+// its encoded message, reported next to the JSON and Avro sizes.
+func logProtobuf(handler http.Handler, log *logpb.LogRequest, size int, remote, authorization string) (*logpb.LogResponse, int, string) {
+	if log.Body == nil {
+		return nil, grpcInvalidArgument, "body is required"
+	}
+	req := LogRequest{
+		ProjectName:    log.ProjectName,
+		ProjectVersion: log.ProjectVersion,
+		LogLevel:       log.LogLevel,
+		LogType:        log.LogType,
+		LogSource:      log.LogSource,
+		LogBody: LogData{
+			Timestamp: log.Body.Timestamp,
+			Logtype:   log.Body.Logtype,
+			Version:   log.Body.Version,
+			Issuer:    log.Body.Issuer,
+		},
+	}
+	// Leave absent maps out rather than sending empty objects.
+	if len(log.Body.Metadata) > 0 {
+		req.LogBody.Metadata = log.Body.Metadata
+	}
+	if len(log.Body.DomainData) > 0 {
+		req.LogBody.DomainData = log.Body.DomainData
+	}
+
+	var resp struct {
+		Status string `json:"status"`
+		ID     string `json:"id"`
+		Stats  struct {
+			OriginalJSONSize   int64  `json:"original_json_size"`
+			WrapperAvroSize    int64  `json:"wrapper_avro_size"`
+			LogDataAvroSize    int64  `json:"logdata_avro_size"`
+			WrapperJSONSize    int64  `json:"wrapper_json_size"`
+			WrapperCompression string `json:"wrapper_compression"`
+			LogDataCompression string `json:"logdata_compression"`
+		} `json:"compression_stats"`
+	}
+	if code, message := dispatchJSON(handler, "/log", req, remote, authorization, &resp); code != grpcOK {
+		return nil, code, message
+	}
+	stats := &logpb.CompressionStats{
+		OriginalJSONSize:   resp.Stats.OriginalJSONSize,
+		ProtobufSize:       int64(size),
+		WrapperAvroSize:    resp.Stats.WrapperAvroSize,
+		LogDataAvroSize:    resp.Stats.LogDataAvroSize,
+		WrapperJSONSize:    resp.Stats.WrapperJSONSize,
+		WrapperCompression: resp.Stats.WrapperCompression,
+		LogDataCompression: resp.Stats.LogDataCompression,
+	}
+	if stats.OriginalJSONSize > 0 {
+		stats.ProtobufCompression = fmt.Sprintf("%.2f%%", float64(size)/float64(stats.OriginalJSONSize)*100)
+	}
+	return &logpb.LogResponse{Status: resp.Status, ID: resp.ID, CompressionStats: stats}, grpcOK, ""
+}
+
+func grpcDecode(handler http.Handler, request []byte, remote, authorization string) (logpb.Message, int, string) {
+	var req logpb.DecodeRequest
+	if err := req.Unmarshal(request); err != nil {
+		return nil, grpcInvalidArgument, err.Error()
+	}
+	query := url.Values{
+		"schema":       {req.Schema},
+		"version":      {strconv.Itoa(int(req.Version))},
+		"strip_unions": {strconv.FormatBool(req.StripUnions)},
+	}
+	var resp struct {
+		Schema  string          `json:"schema"`
+		Version int32           `json:"version"`
+		Record  json.RawMessage `json:"record"`
+	}
+	status, body := dispatchRequest(handler, "/decode?"+query.Encode(), avroContentType, req.Data, "grpc", remote, authorization)
+	if code, message := decodeDispatched(status, body, &resp); code != grpcOK {
+		return nil, code, message
+	}
+	return &logpb.DecodeResponse{Schema: resp.Schema, Version: resp.Version, RecordJSON: string(resp.Record)}, grpcOK, ""
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/homveloper/exp-avro-json/server/logpb"
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+)
+
+func newGRPCServiceTestEngine(t *testing.T) *gin.Engine {
+	r := newSchemaTestEngine(t)
+	r.POST("/ping", pingHandler)
+	r.POST("/log", logHandler)
+	registerGRPCService(r)
+	return r
+}
+
+// callGRPC makes a unary call and returns the gRPC status and, on success,
+// the response message.
+func callGRPC(t *testing.T, r *gin.Engine, method string, req, resp logpb.Message) (int, string) {
+	t.Helper()
+	message := req.Marshal()
+	body := make([]byte, 5+len(message))
+	binary.BigEndian.PutUint32(body[1:5], uint32(len(message)))
+	copy(body[5:], message)
+
+	httpReq := httptest.NewRequest(http.MethodPost, grpcServicePrefix+method, bytes.NewReader(body))
+	httpReq.Header.Set("Content-Type", "application/grpc")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httpReq)
+
+	code, err := strconv.Atoi(w.Header().Get("Grpc-Status"))
+	if err != nil {
+		t.Fatalf("missing grpc-status: %v", w.Header())
+	}
+	if code != grpcOK {
+		return code, w.Header().Get("Grpc-Message")
+	}
+	out := w.Body.Bytes()
+	if len(out) < 5 || int(binary.BigEndian.Uint32(out[1:5])) != len(out)-5 {
+		t.Fatalf("malformed gRPC response message: %x", out)
+	}
+	if err := resp.Unmarshal(out[5:]); err != nil {
+		t.Fatalf("Failed to unmarshal %s response: %v", method, err)
+	}
+	return code, ""
+}
+
+func protobufWarmupLog(i int) *logpb.LogRequest {
+	req := warmupPayload(i)
+	return &logpb.LogRequest{
+		ProjectName:    req.ProjectName,
+		ProjectVersion: req.ProjectVersion,
+		LogLevel:       req.LogLevel,
+		LogType:        req.LogType,
+		LogSource:      req.LogSource,
+		Body: &logpb.LogBody{
+			Timestamp: req.LogBody.Timestamp,
+			Logtype:   req.LogBody.Logtype,
+			Version:   req.LogBody.Version,
+			Issuer:    req.LogBody.Issuer,
+			Metadata:  map[string]string{"level": "12"},
+		},
+	}
+}
+
+func TestGRPCServicePingAndLog(t *testing.T) {
+	r := newGRPCServiceTestEngine(t)
+
+	var ping logpb.PingResponse
+	if code, msg := callGRPC(t, r, "Ping", &logpb.PingRequest{Data: "hello"}, &ping); code != grpcOK {
+		t.Fatalf("Ping failed: %d %s", code, msg)
+	}
+	if ping.Status != "ok" || ping.Echo != "hello" {
+		t.Errorf("unexpected ping response: %+v", ping)
+	}
+
+	log := protobufWarmupLog(1)
+	var resp logpb.LogResponse
+	if code, msg := callGRPC(t, r, "Log", log, &resp); code != grpcOK {
+		t.Fatalf("Log failed: %d %s", code, msg)
+	}
+	stats := resp.CompressionStats
+	if resp.Status != "logged" || stats == nil || stats.ProtobufSize != int64(len(log.Marshal())) || stats.WrapperAvroSize == 0 {
+		t.Fatalf("unexpected log response: %+v %+v", resp, stats)
+	}
+	if stats.ProtobufSize >= stats.OriginalJSONSize || stats.ProtobufCompression == "" {
+		t.Errorf("expected the protobuf request to be smaller than its JSON form: %+v", stats)
+	}
+
+	missing := &logpb.LogRequest{ProjectName: "game"}
+	if code, _ := callGRPC(t, r, "Log", missing, &resp); code != grpcInvalidArgument {
+		t.Errorf("expected INVALID_ARGUMENT for a log without body, got %d", code)
+	}
+}
+
+func TestGRPCServiceLogBatchReportsEachLog(t *testing.T) {
+	r := newGRPCServiceTestEngine(t)
+
+	invalid := protobufWarmupLog(2)
+	invalid.LogLevel = ""
+	var resp logpb.LogBatchResponse
+	code, msg := callGRPC(t, r, "LogBatch", &logpb.LogBatchRequest{Logs: []*logpb.LogRequest{protobufWarmupLog(1), invalid, protobufWarmupLog(3)}}, &resp)
+	if code != grpcOK {
+		t.Fatalf("LogBatch failed: %d %s", code, msg)
+	}
+	if resp.Logged != 2 || resp.Failed != 1 || len(resp.Results) != 3 {
+		t.Fatalf("unexpected batch totals: %+v", resp)
+	}
+	if r := resp.Results[1]; r.Code != grpcInvalidArgument || r.Error == "" || r.Log != nil {
+		t.Errorf("expected the second log to fail validation, got %+v", r)
+	}
+	if r := resp.Results[2]; r.Code != grpcOK || r.Log.Status != "logged" {
+		t.Errorf("expected the log after a failure to be logged, got %+v", r)
+	}
+}
+
+func TestGRPCServiceDecode(t *testing.T) {
+	r := newGRPCServiceTestEngine(t)
+
+	data, err := avrojson.Encode(avrojson.LogDataSchema, avrojson.LogData{Timestamp: time.UnixMilli(5).UTC(), Logtype: "t", Version: "1", Issuer: "i", Metadata: map[string]string{"k": "v"}})
+	if err != nil {
+		t.Fatalf("Failed to encode log data: %v", err)
+	}
+	var resp logpb.DecodeResponse
+	if code, msg := callGRPC(t, r, "Decode", &logpb.DecodeRequest{Schema: "LogData", Data: data, StripUnions: true}, &resp); code != grpcOK {
+		t.Fatalf("Decode failed: %d %s", code, msg)
+	}
+	var record map[string]interface{}
+	if err := json.Unmarshal([]byte(resp.RecordJSON), &record); err != nil {
+		t.Fatalf("Failed to parse record JSON %q: %v", resp.RecordJSON, err)
+	}
+	if resp.Schema != "LogData" || resp.Version != 1 || record["issuer"] != "i" || record["metadata"].(map[string]interface{})["k"] != "v" {
+		t.Errorf("unexpected decode response: %+v", resp)
+	}
+
+	if code, _ := callGRPC(t, r, "Decode", &logpb.DecodeRequest{Schema: "Nope", Data: data}, &resp); code != grpcInvalidArgument {
+		t.Errorf("expected INVALID_ARGUMENT for an unknown schema, got %d", code)
+	}
+}
@@ -0,0 +1,257 @@
+// Package ids generates the unique IDs that name logs, imports and container
+// files. Every kind embeds its creation time and sorts lexicographically in
+// generation order, so directory listings and manifests read chronologically
+// and an ID alone tells when a record entered the system.
+package ids
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Generator kinds.
+const (
+	ULID      = "ulid"
+	KSUID     = "ksuid"
+	Snowflake = "snowflake"
+)
+
+// Kinds lists the supported generators.
+var Kinds = []string{ULID, KSUID, Snowflake}
+
+// ErrInvalid is returned by Time for a string that is not an ID of the
+// generator's kind.
+var ErrInvalid = errors.New("ids: invalid id")
+
+// Generator produces unique IDs. It is safe for concurrent use, and each
+// ID it returns sorts after the previous one, even within one clock tick.
+type Generator interface {
+	Kind() string
+	New() string
+	// Time returns when id was generated, at the kind's resolution.
+	Time(id string) (time.Time, error)
+}
+
+// New returns a generator of kind. node distinguishes snowflake
+// generators running at the same time and must be in [0, MaxNode]; the
+// other kinds ignore it.
+func New(kind string, node int) (Generator, error) {
+	switch kind {
+	case ULID:
+		return NewULID(), nil
+	case KSUID:
+		return NewKSUID(), nil
+	case Snowflake:
+		return NewSnowflake(node)
+	}
+	return nil, fmt.Errorf("ids: unknown kind %q; use one of %v", kind, Kinds)
+}
+
+// NodeFor derives a snowflake node number from an instance name, for
+// deployments that do not assign node numbers explicitly.
+func NodeFor(name string) int {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return int(h.Sum32() % (MaxNode + 1))
+}
+
+// increment adds one to b as a big-endian number and reports overflow.
+func increment(b []byte) bool {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i]++
+		if b[i] != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// ulid is a 48-bit Unix millisecond timestamp followed by 80 random bits,
+// in Crockford base32 (26 characters). IDs from the same millisecond
+// increment the random part, as in the ULID spec's monotonic mode.
+type ulid struct {
+	now func() time.Time
+
+	mu      sync.Mutex
+	lastMs  uint64
+	entropy [10]byte
+}
+
+// NewULID returns a ULID generator.
+func NewULID() Generator { return &ulid{now: time.Now} }
+
+func (g *ulid) Kind() string { return ULID }
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+func (g *ulid) New() string {
+	g.mu.Lock()
+	ms := uint64(g.now().UnixMilli())
+	if ms > g.lastMs {
+		g.lastMs = ms
+		rand.Read(g.entropy[:])
+	} else if increment(g.entropy[:]) {
+		// 2^80 IDs in one millisecond: borrow the next one.
+		g.lastMs++
+	}
+	var b [16]byte
+	for i := 0; i < 6; i++ {
+		b[i] = byte(g.lastMs >> (40 - 8*i))
+	}
+	copy(b[6:], g.entropy[:])
+	g.mu.Unlock()
+
+	// 26 characters hold 130 bits; the two leading bits are zero.
+	n := new(big.Int).SetBytes(b[:])
+	var out [26]byte
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i] = crockford[n.Uint64()&31]
+		n.Rsh(n, 5)
+	}
+	return string(out[:])
+}
+
+func (g *ulid) Time(id string) (time.Time, error) {
+	if len(id) != 26 {
+		return time.Time{}, ErrInvalid
+	}
+	var ms uint64
+	for i := 0; i < 10; i++ {
+		v := strings.IndexByte(crockford, id[i])
+		if v < 0 || (i == 0 && v > 7) {
+			return time.Time{}, ErrInvalid
+		}
+		ms = ms<<5 | uint64(v)
+	}
+	return time.UnixMilli(int64(ms)).UTC(), nil
+}
+
+// ksuid is a 32-bit timestamp in seconds since the KSUID epoch followed by
+// 128 random bits, in base62 (27 characters). IDs from the same second
+// increment the random part.
+type ksuid struct {
+	now func() time.Time
+
+	mu      sync.Mutex
+	lastSec uint32
+	payload [16]byte
+}
+
+// ksuidEpoch is the KSUID epoch, 2014-05-13T16:53:20Z.
+const ksuidEpoch = 1400000000
+
+// NewKSUID returns a KSUID generator.
+func NewKSUID() Generator { return &ksuid{now: time.Now} }
+
+func (g *ksuid) Kind() string { return KSUID }
+
+// base62 is in ASCII order, so equal-length IDs sort numerically.
+const base62 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+func (g *ksuid) New() string {
+	g.mu.Lock()
+	sec := uint32(g.now().Unix() - ksuidEpoch)
+	if sec > g.lastSec {
+		g.lastSec = sec
+		rand.Read(g.payload[:])
+	} else if increment(g.payload[:]) {
+		g.lastSec++
+	}
+	var b [20]byte
+	b[0], b[1], b[2], b[3] = byte(g.lastSec>>24), byte(g.lastSec>>16), byte(g.lastSec>>8), byte(g.lastSec)
+	copy(b[4:], g.payload[:])
+	g.mu.Unlock()
+
+	n := new(big.Int).SetBytes(b[:])
+	radix, digit := big.NewInt(62), new(big.Int)
+	var out [27]byte
+	for i := len(out) - 1; i >= 0; i-- {
+		n.DivMod(n, radix, digit)
+		out[i] = base62[digit.Int64()]
+	}
+	return string(out[:])
+}
+
+func (g *ksuid) Time(id string) (time.Time, error) {
+	if len(id) != 27 {
+		return time.Time{}, ErrInvalid
+	}
+	n, radix := new(big.Int), big.NewInt(62)
+	for i := 0; i < len(id); i++ {
+		v := strings.IndexByte(base62, id[i])
+		if v < 0 {
+			return time.Time{}, ErrInvalid
+		}
+		n.Mul(n, radix).Add(n, big.NewInt(int64(v)))
+	}
+	if n.BitLen() > 160 {
+		return time.Time{}, ErrInvalid
+	}
+	sec := new(big.Int).Rsh(n, 128).Int64()
+	return time.Unix(sec+ksuidEpoch, 0).UTC(), nil
+}
+
+// Snowflake layout: 41 bits of milliseconds since SnowflakeEpoch, 10 bits
+// of node and 12 bits of sequence within the millisecond.
+const (
+	nodeBits = 10
+	seqBits  = 12
+	// MaxNode is the largest snowflake node number.
+	MaxNode = 1<<nodeBits - 1
+)
+
+// SnowflakeEpoch is the zero time of snowflake IDs, 2020-01-01T00:00:00Z.
+var SnowflakeEpoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// snowflake is a 63-bit integer written as 19 zero-padded decimal digits,
+// so the string form sorts like the number.
+type snowflake struct {
+	now  func() time.Time
+	node int64
+
+	mu     sync.Mutex
+	lastMs int64
+	seq    int64
+}
+
+// NewSnowflake returns a snowflake generator for node.
+func NewSnowflake(node int) (Generator, error) {
+	if node < 0 || node > MaxNode {
+		return nil, fmt.Errorf("ids: snowflake node %d outside [0, %d]", node, MaxNode)
+	}
+	return &snowflake{now: time.Now, node: int64(node), lastMs: -1}, nil
+}
+
+func (g *snowflake) Kind() string { return Snowflake }
+
+func (g *snowflake) New() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	ms := g.now().Sub(SnowflakeEpoch).Milliseconds()
+	if ms > g.lastMs {
+		g.lastMs, g.seq = ms, 0
+	} else if g.seq++; g.seq == 1<<seqBits {
+		// The sequence is exhausted: borrow the next millisecond rather
+		// than block.
+		g.lastMs, g.seq = g.lastMs+1, 0
+	}
+	return fmt.Sprintf("%019d", g.lastMs<<(nodeBits+seqBits)|g.node<<seqBits|g.seq)
+}
+
+func (g *snowflake) Time(id string) (time.Time, error) {
+	if len(id) != 19 {
+		return time.Time{}, ErrInvalid
+	}
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || n < 0 {
+		return time.Time{}, ErrInvalid
+	}
+	return SnowflakeEpoch.Add(time.Duration(n>>(nodeBits+seqBits)) * time.Millisecond), nil
+}
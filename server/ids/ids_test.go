@@ -0,0 +1,73 @@
+package ids
+
+import (
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestGeneratorsSortAndEmbedTime(t *testing.T) {
+	at := time.Date(2025, 3, 4, 5, 6, 7, 0, time.UTC)
+	for _, kind := range Kinds {
+		g, err := New(kind, 7)
+		if err != nil {
+			t.Fatalf("Failed to create %s generator: %v", kind, err)
+		}
+		setClock(g, func() time.Time { return at })
+
+		// Many IDs in one clock tick must still be unique and ordered.
+		var generated []string
+		for i := 0; i < 5000; i++ {
+			generated = append(generated, g.New())
+		}
+		if !sort.StringsAreSorted(generated) {
+			t.Errorf("%s IDs are not generated in sort order", kind)
+		}
+		seen := map[string]bool{}
+		for _, id := range generated {
+			if seen[id] {
+				t.Fatalf("%s generated %s twice", kind, id)
+			}
+			seen[id] = true
+		}
+
+		got, err := g.Time(generated[0])
+		if err != nil {
+			t.Fatalf("Failed to read %s time of %s: %v", kind, generated[0], err)
+		}
+		if !got.Equal(at) {
+			t.Errorf("%s ID %s carries time %v, want %v", kind, generated[0], got, at)
+		}
+
+		setClock(g, func() time.Time { return at.Add(time.Hour) })
+		if later := g.New(); later <= generated[len(generated)-1] {
+			t.Errorf("%s ID %s from a later time sorts before %s", kind, later, generated[len(generated)-1])
+		}
+		if _, err := g.Time("not-an-id"); err != ErrInvalid {
+			t.Errorf("%s: expected ErrInvalid for a malformed ID, got %v", kind, err)
+		}
+	}
+}
+
+func TestNewRejectsBadConfig(t *testing.T) {
+	if _, err := New("uuid", 0); err == nil {
+		t.Error("Expected an unknown kind to be rejected")
+	}
+	if _, err := New(Snowflake, MaxNode+1); err == nil {
+		t.Error("Expected an out-of-range node to be rejected")
+	}
+	if n := NodeFor("node-a"); n < 0 || n > MaxNode || n != NodeFor("node-a") {
+		t.Errorf("unstable or out-of-range node %d", n)
+	}
+}
+
+func setClock(g Generator, now func() time.Time) {
+	switch g := g.(type) {
+	case *ulid:
+		g.now = now
+	case *ksuid:
+		g.now = now
+	case *snowflake:
+		g.now = now
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/homveloper/exp-avro-json/server/ocf"
+	"github.com/homveloper/exp-avro-json/server/registry"
+	"go.uber.org/zap"
+)
+
+// importBatch is how many imported records are appended per OCF block.
+const importBatch = 500
+
+// importManifest records one imported file. Manifests are kept under
+// <ocf-dir>/imports/ so every record in the store can be traced back to
+// the upload it came from.
+type importManifest struct {
+	ID          string    `json:"id"`
+	ImportedAt  time.Time `json:"imported_at"`
+	Source      string    `json:"source"`
+	Schema      string    `json:"schema"`
+	Version     int       `json:"version"`
+	Fingerprint string    `json:"fingerprint"`
+	Registered  bool      `json:"registered"`
+	Records     int       `json:"records"`
+	Files       []string  `json:"files"`
+}
+
+// pendingImport is an uploaded file that passed validation.
+type pendingImport struct {
+	header     *multipart.FileHeader
+	schema     registry.Schema
+	registered bool
+}
+
+// importHandler serves POST /logs/import: a multipart upload of one or more
+// Avro container files in "file" fields. Every file is read in full and its
+// writer schema matched against the registry before anything is stored, so
+// a bad upload imports nothing. ?register=true registers unknown schemas
+// instead of rejecting them.
+func importHandler(c *gin.Context) {
+	store := requestOCFStore(c)
+	if store == nil {
+		return
+	}
+	form, err := c.MultipartForm()
+	if bodyTooLarge(c, err) {
+		return
+	}
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Expected a multipart upload: "+err.Error())
+		return
+	}
+	headers := form.File["file"]
+	if len(headers) == 0 {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, `No "file" parts in the upload`)
+		return
+	}
+	register := c.Query("register") == "true"
+
+	var pending []pendingImport
+	for _, header := range headers {
+		p, status, code, err := validateImport(header, register)
+		if err != nil {
+			respondErrorWith(c, status, apiError{Code: code, Message: err.Error()}, gin.H{"file": header.Filename})
+			return
+		}
+		pending = append(pending, p)
+	}
+
+	var manifests []importManifest
+	for _, p := range pending {
+		m, err := storeImport(store, p)
+		if err != nil {
+			requestLogger(c).Error("Failed to import OCF file", zap.String("file", p.header.Filename), zap.Error(err))
+			respondErrorWith(c, http.StatusInternalServerError, apiError{Code: codeSinkFailed, Message: "Failed to import OCF file"}, gin.H{"file": p.header.Filename, "imported": manifests})
+			return
+		}
+		requestLogger(c).Info("Imported OCF file",
+			zap.String("id", m.ID),
+			zap.String("file", m.Source),
+			zap.String("schema", m.Schema),
+			zap.Int("version", m.Version),
+			zap.Int("records", m.Records))
+		manifests = append(manifests, m)
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "imported", "imports": manifests})
+}
+
+// validateImport reads an uploaded file end to end and resolves its schema,
+// returning the HTTP status and error code to report on failure.
+func validateImport(header *multipart.FileHeader, register bool) (pendingImport, int, string, error) {
+	p := pendingImport{header: header}
+	f, err := header.Open()
+	if err != nil {
+		return p, http.StatusBadRequest, codeInvalidRequest, err
+	}
+	defer f.Close()
+	schema, _, err := ocf.Scan(f, func(interface{}) error { return nil })
+	if err != nil {
+		return p, http.StatusBadRequest, codeValidationFailed, err
+	}
+
+	s, err := schemaRegistry.Lookup(schema)
+	if errors.Is(err, registry.ErrNotFound) && register {
+		s, p.registered, err = schemaRegistry.Register("", schema)
+	}
+	switch {
+	case errors.Is(err, registry.ErrNotFound):
+		return p, http.StatusUnprocessableEntity, codeUnknownSchema, errors.New("writer schema is not registered; register it or pass register=true")
+	case errors.Is(err, registry.ErrInvalidSchema):
+		return p, http.StatusBadRequest, codeInvalidRequest, err
+	case err != nil:
+		return p, http.StatusInternalServerError, codeInternal, err
+	}
+	p.schema = s
+	return p, 0, "", nil
+}
+
+// storeImport appends a validated file's records to the stream of its
+// schema in store and writes the import manifest.
+func storeImport(store *ocfStore, p pendingImport) (importManifest, error) {
+	m := importManifest{
+		ID:          logIDs.New(),
+		ImportedAt:  time.Now().UTC(),
+		Source:      p.header.Filename,
+		Schema:      p.schema.Name,
+		Version:     p.schema.Version,
+		Fingerprint: p.schema.Fingerprint,
+		Registered:  p.registered,
+	}
+	w, err := store.writerFor(p.schema)
+	if err != nil {
+		return m, err
+	}
+	f, err := p.header.Open()
+	if err != nil {
+		return m, err
+	}
+	defer f.Close()
+
+	files := map[string]bool{}
+	batch := make([]interface{}, 0, importBatch)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		// Flush so the batch is in the file Stats names, even when the
+		// stream batches appends into larger blocks.
+		if err := w.AppendNative(batch...); err != nil {
+			return err
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		m.Records += len(batch)
+		if file := filepath.Base(w.Stats().File); !files[file] {
+			files[file] = true
+			m.Files = append(m.Files, file)
+		}
+		batch = batch[:0]
+		return nil
+	}
+	_, _, err = ocf.Scan(f, func(record interface{}) error {
+		batch = append(batch, record)
+		if len(batch) == importBatch {
+			return flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		return m, err
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return m, err
+	}
+	dir := filepath.Join(store.dir, "imports")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return m, err
+	}
+	return m, os.WriteFile(filepath.Join(dir, m.ID+".json"), data, 0644)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+	"github.com/linkedin/goavro/v2"
+	"go.uber.org/zap"
+)
+
+func buildOCF(t *testing.T, schema string, records ...interface{}) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := goavro.NewOCFWriter(goavro.OCFConfig{W: &buf, Schema: schema})
+	if err != nil {
+		t.Fatalf("Failed to create OCF writer: %v", err)
+	}
+	if err := w.Append(records); err != nil {
+		t.Fatalf("Failed to append records: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestImportOCF(t *testing.T) {
+	logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	if err := openSchemaRegistry(""); err != nil {
+		t.Fatalf("Failed to open schema registry: %v", err)
+	}
+	dir := t.TempDir()
+	if err := openOCFLogs(dir, ocfTuning{}); err != nil {
+		t.Fatalf("Failed to open OCF logs: %v", err)
+	}
+	defer func() { ocfLogs.wrapper, ocfLogs.logData = nil, nil }()
+	r := gin.New()
+	r.POST("/logs/import", importHandler)
+
+	upload := func(target string, files map[string][]byte) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		for name, data := range files {
+			part, _ := mw.CreateFormFile("file", name)
+			part.Write(data)
+		}
+		mw.Close()
+		req := httptest.NewRequest(http.MethodPost, target, &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	event := `{"type":"record","name":"Imported","namespace":"ext","fields":[{"name":"kind","type":"string"}]}`
+	eventFile := buildOCF(t, event, map[string]interface{}{"kind": "a"}, map[string]interface{}{"kind": "b"})
+	logDataFile := buildOCF(t, avrojson.LogDataSchema, map[string]interface{}{
+		"timestamp": int64(1), "logtype": "t", "version": "1", "issuer": "ext", "metadata": nil, "domainData": nil,
+	})
+
+	if w := upload("/logs/import", map[string][]byte{"events.avro": eventFile}); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected 422 for an unregistered schema, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := upload("/logs/import", map[string][]byte{"junk.avro": []byte("junk")}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a non-OCF file, got %d", w.Code)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Expected rejected uploads to store nothing, found %d entries", len(entries))
+	}
+
+	w := upload("/logs/import?register=true", map[string][]byte{"events.avro": eventFile, "logdata.avro": logDataFile})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Imports []importManifest `json:"imports"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if len(resp.Imports) != 2 {
+		t.Fatalf("Expected two imports, got %+v", resp.Imports)
+	}
+	for _, m := range resp.Imports {
+		switch m.Schema {
+		case "ext.Imported":
+			if m.Records != 2 || !m.Registered || m.Version != 1 {
+				t.Errorf("unexpected import %+v", m)
+			}
+		case "LogData":
+			if m.Records != 1 || m.Registered || len(m.Files) != 1 || m.Files[0] != filepath.Base(ocfLogs.logData.Stats().File) {
+				t.Errorf("expected LogData records to join the logdata stream, got %+v", m)
+			}
+		default:
+			t.Errorf("unexpected import %+v", m)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "imports", m.ID+".json")); err != nil {
+			t.Errorf("Missing manifest for %s: %v", m.ID, err)
+		}
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "ext.Imported-v1-*.avro")); len(files) != 1 {
+		t.Errorf("Expected one ext.Imported stream file, found %v", files)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/homveloper/exp-avro-json/server/lease"
+	"go.uber.org/zap"
+)
+
+// Leader jobs are background tasks such as compaction and retention that
+// must run on exactly one instance when several share a storage backend.
+// Without -lease-file the instance is assumed to be alone and always leads.
+type leaderJob struct {
+	name     string
+	interval time.Duration
+	run      func(ctx context.Context) error
+}
+
+var (
+	leaderJobsMu sync.Mutex
+	leaderJobs   []leaderJob
+	elector      *lease.Elector
+)
+
+// registerLeaderJob schedules run every interval while this instance is the
+// leader. It must be called before startLeaderJobs.
+func registerLeaderJob(name string, interval time.Duration, run func(ctx context.Context) error) {
+	leaderJobsMu.Lock()
+	defer leaderJobsMu.Unlock()
+	leaderJobs = append(leaderJobs, leaderJob{name: name, interval: interval, run: run})
+}
+
+// leaderContext returns the context a leader job runs with, cancelled as
+// soon as this instance stops leading, and false when it does not lead.
+func leaderContext(ctx context.Context) (context.Context, context.CancelFunc, bool) {
+	if elector == nil {
+		ctx, cancel := context.WithCancel(ctx)
+		return ctx, cancel, true
+	}
+	return elector.Context(ctx)
+}
+
+// startLeaderJobs campaigns for the lease when leaseFile is set and starts
+// the registered job loops.
+func startLeaderJobs(ctx context.Context, leaseFile, nodeID string, ttl time.Duration) error {
+	if leaseFile != "" {
+		l, err := lease.NewFileLease(leaseFile, nodeID, ttl)
+		if err != nil {
+			return err
+		}
+		elector = lease.NewElector(l)
+		elector.OnChange(func(leader bool) {
+			if leader {
+				logger.Info("Acquired job leadership", zap.String("node_id", nodeID), zap.String("lease_file", leaseFile))
+			} else {
+				logger.Info("Lost job leadership", zap.String("node_id", nodeID), zap.String("lease_file", leaseFile))
+			}
+		})
+		go elector.Run(ctx)
+	}
+
+	leaderJobsMu.Lock()
+	jobs := append([]leaderJob(nil), leaderJobs...)
+	leaderJobsMu.Unlock()
+	for _, job := range jobs {
+		go runLeaderJob(ctx, job)
+	}
+	return nil
+}
+
+func runLeaderJob(ctx context.Context, job leaderJob) {
+	ticker := time.NewTicker(job.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		jobCtx, cancel, ok := leaderContext(ctx)
+		if !ok {
+			continue
+		}
+
+		start := time.Now()
+		err := job.run(jobCtx)
+		cancel()
+		if err != nil {
+			logger.Error("Leader job failed", zap.String("job", job.name), zap.Error(err))
+			continue
+		}
+		logger.Debug("Leader job finished", zap.String("job", job.name), zap.Duration("duration", time.Since(start)))
+	}
+}
+
+// leaderStatus describes job leadership for /stats.
+func leaderStatus() interface{} {
+	leaderJobsMu.Lock()
+	names := make([]string, len(leaderJobs))
+	for i, job := range leaderJobs {
+		names[i] = job.name
+	}
+	leaderJobsMu.Unlock()
+
+	if elector == nil {
+		return map[string]interface{}{"mode": "standalone", "leader": true, "jobs": names}
+	}
+	return map[string]interface{}{"mode": "lease", "lease": elector.Status(), "leader": elector.IsLeader(), "jobs": names}
+}
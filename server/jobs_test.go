@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/homveloper/exp-avro-json/server/lease"
+	"go.uber.org/zap"
+)
+
+func TestLeaderJobRunsOnlyOnLeader(t *testing.T) {
+	logger = zap.NewNop()
+	defer func() { elector = nil }()
+
+	path := filepath.Join(t.TempDir(), "jobs.lease")
+	other, err := lease.NewFileLease(path, "other-node", time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create lease: %v", err)
+	}
+	if _, ok, err := other.TryAcquire(); !ok || err != nil {
+		t.Fatalf("Failed to acquire lease for other node: %v, %v", ok, err)
+	}
+
+	// A short TTL makes the elector retry every 100ms.
+	self, err := lease.NewFileLease(path, "this-node", 300*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Failed to create lease: %v", err)
+	}
+	elector = lease.NewElector(self)
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cancel()
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		elector.Run(ctx)
+	}()
+
+	var runs atomic.Int32
+	go func() {
+		defer wg.Done()
+		runLeaderJob(ctx, leaderJob{
+			name:     "test",
+			interval: 10 * time.Millisecond,
+			run: func(context.Context) error {
+				runs.Add(1)
+				return nil
+			},
+		})
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	if n := runs.Load(); n != 0 {
+		t.Fatalf("expected follower to skip the job, ran %d times", n)
+	}
+
+	if err := other.Release(); err != nil {
+		t.Fatalf("Failed to release lease: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for runs.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if runs.Load() == 0 {
+		t.Error("expected the job to run after this node became leader")
+	}
+}
+
+func TestLeaderJobStopsWithLeadership(t *testing.T) {
+	logger = zap.NewNop()
+	defer func() { elector = nil }()
+
+	path := filepath.Join(t.TempDir(), "jobs.lease")
+	self, err := lease.NewFileLease(path, "this-node", 300*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Failed to create lease: %v", err)
+	}
+	other, err := lease.NewFileLease(path, "other-node", time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create lease: %v", err)
+	}
+	elector = lease.NewElector(self)
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cancel()
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		elector.Run(ctx)
+	}()
+
+	started, stopped := make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	go func() {
+		defer wg.Done()
+		runLeaderJob(ctx, leaderJob{
+			name:     "test",
+			interval: 10 * time.Millisecond,
+			run: func(jobCtx context.Context) error {
+				once.Do(func() {
+					close(started)
+					<-jobCtx.Done()
+					close(stopped)
+				})
+				return nil
+			},
+		})
+	}()
+
+	select {
+	case <-started:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the job to start on the leader")
+	}
+	// Another node takes the lease over while the job is still running;
+	// either may find the elector mid-renewal and retry.
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		self.Release()
+		if _, ok, _ := other.TryAcquire(); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Failed to acquire lease for other node")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Error("expected the running job to be cancelled when leadership was lost")
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// The Kafka sink produces every log's wrapper binary, which carries the
+// body, to a topic through a Confluent REST Proxy (v2 API), keyed by
+// project so a project's logs stay in one partition. Records are batched
+// in the background; Write only queues, and fails when the queue is full
+// rather than holding up the request.
+type kafkaSinkConfig struct {
+	RestProxy string `json:"rest_proxy"`
+	Topic     string `json:"topic"`
+	// BatchSize is the most records per produce request.
+	BatchSize int `json:"batch_size"`
+	// LingerMillis is how long a partial batch waits for more records.
+	LingerMillis int `json:"linger_ms"`
+	QueueSize    int `json:"queue_size"`
+	// Retries is how many times a batch is resent on server and network
+	// errors.
+	Retries int `json:"retries"`
+}
+
+type kafkaSink struct {
+	endpoint  string
+	client    *http.Client
+	batchSize int
+	linger    time.Duration
+	retries   int
+	queue     chan kafkaRecord
+	// stop asks run to send what is queued and return, closing stopped.
+	stop      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
+
+	// Overridden by tests.
+	backoff time.Duration
+
+	produced atomic.Int64
+	failed   atomic.Int64
+	batches  atomic.Int64
+
+	mu        sync.Mutex
+	lastError string
+}
+
+// kafkaRecord is one record of a binary produce request.
+type kafkaRecord struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+}
+
+func newKafkaSink(config kafkaSinkConfig) (Sink, error) {
+	if config.RestProxy == "" || config.Topic == "" {
+		return nil, errors.New("rest_proxy and topic are required")
+	}
+	u, err := url.Parse(config.RestProxy)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid rest_proxy %q", config.RestProxy)
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+	if config.LingerMillis <= 0 {
+		config.LingerMillis = 100
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = 10000
+	}
+	if config.Retries < 0 {
+		return nil, fmt.Errorf("negative retries %d", config.Retries)
+	}
+	s := &kafkaSink{
+		endpoint:  strings.TrimSuffix(config.RestProxy, "/") + "/topics/" + url.PathEscape(config.Topic),
+		client:    &http.Client{Timeout: 10 * time.Second},
+		batchSize: config.BatchSize,
+		linger:    time.Duration(config.LingerMillis) * time.Millisecond,
+		retries:   config.Retries,
+		queue:     make(chan kafkaRecord, config.QueueSize),
+		stop:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+		backoff:   100 * time.Millisecond,
+	}
+	go s.run()
+	return s, nil
+}
+
+func (s *kafkaSink) Write(ctx context.Context, record sinkRecord) error {
+	select {
+	case s.queue <- kafkaRecord{Key: []byte(record.Project), Value: record.Encoded.Wrapper}:
+		return nil
+	default:
+		return errors.New("kafka produce queue is full")
+	}
+}
+
+// run sends a batch once it is full or its first record has waited for
+// the linger time.
+func (s *kafkaSink) run() {
+	var batch []kafkaRecord
+	var linger <-chan time.Time
+	for {
+		select {
+		case record := <-s.queue:
+			batch = append(batch, record)
+			if len(batch) == 1 {
+				linger = time.After(s.linger)
+			}
+			if len(batch) < s.batchSize {
+				continue
+			}
+		case <-linger:
+		case <-s.stop:
+			s.drain(batch)
+			close(s.stopped)
+			return
+		}
+		s.send(batch)
+		batch, linger = nil, nil
+	}
+}
+
+// drain sends batch and every queued record in full batches.
+func (s *kafkaSink) drain(batch []kafkaRecord) {
+	for {
+		select {
+		case record := <-s.queue:
+			batch = append(batch, record)
+			if len(batch) < s.batchSize {
+				continue
+			}
+		default:
+			if len(batch) > 0 {
+				s.send(batch)
+			}
+			return
+		}
+		s.send(batch)
+		batch = nil
+	}
+}
+
+// Close sends the queued records, retrying as usual, and stops the
+// background sender; records written afterwards are not sent.
+func (s *kafkaSink) Close() error {
+	s.closeOnce.Do(func() { close(s.stop) })
+	<-s.stopped
+	return nil
+}
+
+func (s *kafkaSink) send(batch []kafkaRecord) {
+	s.batches.Add(1)
+	failed, err := s.produce(batch)
+	if err != nil {
+		failed = len(batch)
+	}
+	s.produced.Add(int64(len(batch) - failed))
+	if failed == 0 {
+		return
+	}
+	s.failed.Add(int64(failed))
+	if err == nil {
+		err = fmt.Errorf("%d of %d records rejected", failed, len(batch))
+	}
+	s.mu.Lock()
+	s.lastError = err.Error()
+	s.mu.Unlock()
+	logger.Error("Failed to produce logs to Kafka", zap.String("endpoint", s.endpoint), zap.Int("records", failed), zap.Error(err))
+}
+
+// produce posts batch, retrying with exponential backoff, and returns how
+// many records the proxy reported as failed.
+func (s *kafkaSink) produce(batch []kafkaRecord) (int, error) {
+	body, err := json.Marshal(struct {
+		Records []kafkaRecord `json:"records"`
+	}{batch})
+	if err != nil {
+		return 0, err
+	}
+	var lastErr error
+	for attempt := 0; attempt <= s.retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(s.backoff << (attempt - 1))
+		}
+		failed, retry, err := s.post(body)
+		if err == nil {
+			return failed, nil
+		}
+		lastErr = err
+		if !retry {
+			break
+		}
+	}
+	return 0, lastErr
+}
+
+func (s *kafkaSink) post(body []byte) (failed int, retry bool, err error) {
+	req, err := http.NewRequest(http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return 0, false, err
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.binary.v2+json")
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, true, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, true, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("REST proxy returned HTTP %d: %s", resp.StatusCode, bytes.TrimSpace(data))
+		return 0, resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests, err
+	}
+	var result struct {
+		Offsets []struct {
+			ErrorCode *int `json:"error_code"`
+		} `json:"offsets"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return 0, false, fmt.Errorf("malformed produce response: %w", err)
+	}
+	for _, offset := range result.Offsets {
+		if offset.ErrorCode != nil {
+			failed++
+		}
+	}
+	return failed, false, nil
+}
+
+func (s *kafkaSink) Stats() gin.H {
+	s.mu.Lock()
+	lastError := s.lastError
+	s.mu.Unlock()
+	stats := gin.H{
+		"endpoint": s.endpoint,
+		"produced": s.produced.Load(),
+		"failed":   s.failed.Load(),
+		"batches":  s.batches.Load(),
+		"pending":  len(s.queue),
+	}
+	if lastError != "" {
+		stats["last_error"] = lastError
+	}
+	return stats
+}
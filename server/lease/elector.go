@@ -0,0 +1,147 @@
+package lease
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Status is a snapshot of an Elector's view of the lease.
+type Status struct {
+	Node      string    `json:"node"`
+	Holder    string    `json:"holder"`
+	Leader    bool      `json:"leader"`
+	Term      uint64    `json:"term"`
+	ExpiresAt time.Time `json:"expires_at"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// Elector keeps trying to acquire or renew a lease and tracks whether this
+// node is currently the leader.
+type Elector struct {
+	lease    *FileLease
+	interval time.Duration
+
+	mu     sync.RWMutex
+	status Status
+	// lost is closed when the term this node leads ends.
+	lost     chan struct{}
+	onChange []func(leader bool)
+}
+
+// NewElector renews the lease every third of its TTL, leaving two attempts
+// before it lapses.
+func NewElector(l *FileLease) *Elector {
+	return &Elector{
+		lease:    l,
+		interval: l.TTL() / 3,
+		status:   Status{Node: l.Holder()},
+	}
+}
+
+// OnChange registers fn to be called whenever leadership is gained or lost.
+// It must be called before Run.
+func (e *Elector) OnChange(fn func(leader bool)) {
+	e.onChange = append(e.onChange, fn)
+}
+
+// IsLeader reports whether this node held a valid lease at the last attempt.
+// Leadership is dropped as soon as the local view of the lease expires, even
+// if renewals keep failing.
+func (e *Elector) IsLeader() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.status.Leader && time.Now().Before(e.status.ExpiresAt)
+}
+
+func (e *Elector) Status() Status {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	s := e.status
+	s.Leader = s.Leader && time.Now().Before(s.ExpiresAt)
+	return s
+}
+
+// Context returns a context for work done as leader, cancelled as soon as
+// this node stops leading or parent is done, so the work cannot outlive the
+// term it started in. It reports false when this node does not lead; the
+// caller must call cancel otherwise.
+func (e *Elector) Context(parent context.Context) (context.Context, context.CancelFunc, bool) {
+	e.mu.RLock()
+	lost := e.lost
+	leader := e.status.Leader && time.Now().Before(e.status.ExpiresAt)
+	e.mu.RUnlock()
+	if !leader || lost == nil {
+		return nil, nil, false
+	}
+	ctx, cancel := context.WithCancel(parent)
+	go func() {
+		select {
+		case <-lost:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel, true
+}
+
+// Run campaigns until ctx is done and then releases the lease if held.
+func (e *Elector) Run(ctx context.Context) {
+	e.step()
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if e.IsLeader() {
+				e.lease.Release()
+			}
+			e.set(Status{Node: e.lease.Holder()}, nil)
+			return
+		case <-ticker.C:
+			e.step()
+		}
+	}
+}
+
+func (e *Elector) step() {
+	rec, leader, err := e.lease.TryAcquire()
+	if errors.Is(err, ErrBusy) {
+		// Someone else is mid-update; keep the previous view until the
+		// next tick, as long as our own lease has not run out.
+		e.mu.RLock()
+		s := e.status
+		e.mu.RUnlock()
+		if s.Leader && !time.Now().Before(s.ExpiresAt) {
+			s.Leader = false
+			e.set(s, err)
+		}
+		return
+	}
+	s := Status{Node: e.lease.Holder(), Holder: rec.Holder, Leader: leader, Term: rec.Term, ExpiresAt: rec.ExpiresAt}
+	e.set(s, err)
+}
+
+func (e *Elector) set(s Status, err error) {
+	if err != nil {
+		s.LastError = err.Error()
+	}
+	e.mu.Lock()
+	was, term := e.status.Leader, e.status.Term
+	e.status = s
+	if e.lost != nil && (!s.Leader || s.Term != term) {
+		close(e.lost)
+		e.lost = nil
+	}
+	if s.Leader && e.lost == nil {
+		e.lost = make(chan struct{})
+	}
+	e.mu.Unlock()
+
+	if was != s.Leader {
+		for _, fn := range e.onChange {
+			fn(s.Leader)
+		}
+	}
+}
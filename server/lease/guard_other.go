@@ -0,0 +1,55 @@
+//go:build !unix
+
+package lease
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// guarded runs fn while holding the guard file, created with O_EXCL where
+// there is no flock. A guard left behind by a node that crashed mid-update
+// is broken once it is older than the TTL.
+func (l *FileLease) guarded(fn func() error) error {
+	guard := l.path + ".guard"
+	f, err := os.OpenFile(guard, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if errors.Is(err, os.ErrExist) {
+		if err := l.breakGuard(guard); err != nil {
+			return err
+		}
+		f, err = os.OpenFile(guard, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	}
+	if errors.Is(err, os.ErrExist) {
+		return ErrBusy
+	}
+	if err != nil {
+		return err
+	}
+	f.WriteString(l.holder)
+	f.Close()
+	defer os.Remove(guard)
+
+	return fn()
+}
+
+// breakGuard removes a stale guard. It is renamed aside first and only
+// removed if it is still the file found stale: when another node broke it
+// and took a fresh guard in between, that guard is put back.
+func (l *FileLease) breakGuard(guard string) error {
+	stale, err := os.Stat(guard)
+	if err != nil || l.now().Sub(stale.ModTime()) < l.ttl {
+		return ErrBusy
+	}
+	aside := fmt.Sprintf("%s.%s.stale", guard, l.holder)
+	if err := os.Rename(guard, aside); err != nil {
+		return ErrBusy
+	}
+	if moved, err := os.Stat(aside); err != nil || !os.SameFile(stale, moved) {
+		if os.Link(aside, guard) == nil {
+			os.Remove(aside)
+		}
+		return ErrBusy
+	}
+	return os.Remove(aside)
+}
@@ -0,0 +1,29 @@
+//go:build unix
+
+package lease
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// guarded runs fn while holding an exclusive flock on the guard file. The
+// lock goes with the process, so a node that crashed mid-update leaves no
+// guard to break, and the file itself is never removed.
+func (l *FileLease) guarded(fn func() error) error {
+	f, err := os.OpenFile(l.path+".guard", os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return ErrBusy
+		}
+		return err
+	}
+	defer syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+
+	return fn()
+}
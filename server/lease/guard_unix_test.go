@@ -0,0 +1,47 @@
+//go:build unix
+
+package lease
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileLeaseGuard(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.lease")
+	clock := time.Now()
+	a := newTestLease(t, path, "node-a", &clock)
+
+	// A guard held by a live node is never broken, however old.
+	held := make(chan struct{})
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		a.guarded(func() error {
+			close(held)
+			<-done
+			return nil
+		})
+		close(finished)
+	}()
+	<-held
+	if _, _, err := a.TryAcquire(); err != ErrBusy {
+		t.Errorf("expected ErrBusy while the guard is held, got %v", err)
+	}
+	clock = clock.Add(time.Minute)
+	if _, _, err := a.TryAcquire(); err != ErrBusy {
+		t.Errorf("expected an old guard that is still held to stay, got %v", err)
+	}
+	close(done)
+	<-finished
+
+	// The guard file of a node that crashed holds no lock.
+	if err := os.WriteFile(path+".guard", []byte("node-b"), 0o644); err != nil {
+		t.Fatalf("Failed to write guard: %v", err)
+	}
+	if _, ok, err := a.TryAcquire(); err != nil || !ok {
+		t.Errorf("expected a guard nobody holds not to get in the way, got %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,143 @@
+// Package lease provides lease-based leader election over a shared
+// filesystem, so that only one of several instances sharing a storage
+// backend runs singleton background work such as compaction and retention.
+//
+// The lease is a small JSON file naming the current holder and its expiry.
+// Holders renew it well before it expires; other nodes take over once it
+// lapses. Updates are serialized by a guard file: flocked where there is
+// flock, which the kernel releases when its holder dies and Linux maps to
+// an NFS lock on NFS mounts, and created with O_EXCL elsewhere. Clock skew
+// between nodes must stay well below the TTL.
+package lease
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrBusy is returned when another node is updating the lease concurrently.
+var ErrBusy = errors.New("lease: guard held by another node")
+
+// Record is the content of the lease file.
+type Record struct {
+	Holder     string    `json:"holder"`
+	Term       uint64    `json:"term"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// Expired reports whether the lease has lapsed at now.
+func (r Record) Expired(now time.Time) bool {
+	return r.Holder == "" || !now.Before(r.ExpiresAt)
+}
+
+// FileLease is one node's handle on a lease file.
+type FileLease struct {
+	path   string
+	holder string
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+// NewFileLease returns a handle for holder on the lease stored at path.
+func NewFileLease(path, holder string, ttl time.Duration) (*FileLease, error) {
+	if holder == "" {
+		return nil, errors.New("lease: holder ID is required")
+	}
+	if ttl <= 0 {
+		return nil, errors.New("lease: TTL must be positive")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	return &FileLease{path: path, holder: holder, ttl: ttl, now: time.Now}, nil
+}
+
+// Holder returns the ID this handle acquires the lease as.
+func (l *FileLease) Holder() string { return l.holder }
+
+// TTL returns the lease duration.
+func (l *FileLease) TTL() time.Duration { return l.ttl }
+
+// TryAcquire takes the lease if it is free or expired, or renews it if this
+// node already holds it. It returns the lease record after the attempt and
+// whether this node is the holder. The term increases every time the lease
+// changes hands and can be used as a fencing token.
+func (l *FileLease) TryAcquire() (Record, bool, error) {
+	var rec Record
+	err := l.guarded(func() error {
+		current, err := l.read()
+		if err != nil {
+			return err
+		}
+		now := l.now()
+		switch {
+		case current.Holder == l.holder && !current.Expired(now):
+			current.ExpiresAt = now.Add(l.ttl)
+		case current.Expired(now):
+			current = Record{
+				Holder:     l.holder,
+				Term:       current.Term + 1,
+				AcquiredAt: now,
+				ExpiresAt:  now.Add(l.ttl),
+			}
+		default:
+			rec = current
+			return nil
+		}
+		rec = current
+		return l.write(current)
+	})
+	return rec, err == nil && rec.Holder == l.holder, err
+}
+
+// Release gives the lease up early if this node holds it, so another node
+// can take over without waiting for the TTL.
+func (l *FileLease) Release() error {
+	return l.guarded(func() error {
+		current, err := l.read()
+		if err != nil || current.Holder != l.holder {
+			return err
+		}
+		current.ExpiresAt = l.now()
+		return l.write(current)
+	})
+}
+
+// Read returns the current lease record without modifying it.
+func (l *FileLease) Read() (Record, error) {
+	return l.read()
+}
+
+func (l *FileLease) read() (Record, error) {
+	var rec Record
+	data, err := os.ReadFile(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return rec, nil
+	}
+	if err != nil {
+		return rec, err
+	}
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return rec, fmt.Errorf("lease: corrupt lease file %s: %w", l.path, err)
+	}
+	return rec, nil
+}
+
+// write replaces the lease file atomically so readers never see a partial
+// record.
+func (l *FileLease) write(rec Record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	tmp := fmt.Sprintf("%s.%s.tmp", l.path, l.holder)
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, l.path)
+}
@@ -0,0 +1,130 @@
+package lease
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestLease(t *testing.T, path, holder string, clock *time.Time) *FileLease {
+	t.Helper()
+	l, err := NewFileLease(path, holder, 10*time.Second)
+	if err != nil {
+		t.Fatalf("Failed to create lease: %v", err)
+	}
+	l.now = func() time.Time { return *clock }
+	return l
+}
+
+func TestFileLeaseSingleHolder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.lease")
+	clock := time.Unix(1700000000, 0)
+	a := newTestLease(t, path, "node-a", &clock)
+	b := newTestLease(t, path, "node-b", &clock)
+
+	rec, ok, err := a.TryAcquire()
+	if err != nil || !ok {
+		t.Fatalf("expected node-a to acquire the free lease, got %v, %v", ok, err)
+	}
+	if rec.Term != 1 {
+		t.Errorf("expected term 1, got %d", rec.Term)
+	}
+	if _, ok, _ := b.TryAcquire(); ok {
+		t.Fatal("expected node-b to be refused while node-a holds the lease")
+	}
+
+	// Renewals keep the lease and the term.
+	clock = clock.Add(5 * time.Second)
+	if rec, ok, _ := a.TryAcquire(); !ok || rec.Term != 1 {
+		t.Errorf("expected node-a to renew in term 1, got %v, %d", ok, rec.Term)
+	}
+
+	// Once node-a stops renewing, node-b takes over in a new term.
+	clock = clock.Add(11 * time.Second)
+	rec, ok, err = b.TryAcquire()
+	if err != nil || !ok {
+		t.Fatalf("expected node-b to take over the expired lease, got %v, %v", ok, err)
+	}
+	if rec.Term != 2 {
+		t.Errorf("expected term 2 after takeover, got %d", rec.Term)
+	}
+	if _, ok, _ := a.TryAcquire(); ok {
+		t.Error("expected node-a to have lost the lease")
+	}
+}
+
+func TestFileLeaseRelease(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.lease")
+	clock := time.Unix(1700000000, 0)
+	a := newTestLease(t, path, "node-a", &clock)
+	b := newTestLease(t, path, "node-b", &clock)
+
+	a.TryAcquire()
+	if err := b.Release(); err != nil {
+		t.Fatalf("Failed to release as non-holder: %v", err)
+	}
+	if _, ok, _ := b.TryAcquire(); ok {
+		t.Fatal("expected release by a non-holder to be ignored")
+	}
+
+	if err := a.Release(); err != nil {
+		t.Fatalf("Failed to release lease: %v", err)
+	}
+	if _, ok, _ := b.TryAcquire(); !ok {
+		t.Error("expected node-b to acquire the released lease immediately")
+	}
+}
+
+func TestElectorReportsLeadership(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.lease")
+	l, err := NewFileLease(path, "node-a", time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create lease: %v", err)
+	}
+	e := NewElector(l)
+
+	changes := make(chan bool, 2)
+	e.OnChange(func(leader bool) { changes <- leader })
+	e.step()
+	if !e.IsLeader() {
+		t.Fatalf("expected elector to lead an uncontested lease: %+v", e.Status())
+	}
+	if got := <-changes; !got {
+		t.Error("expected a leadership gained notification")
+	}
+}
+
+func TestElectorContextEndsWithTerm(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.lease")
+	l, err := NewFileLease(path, "node-a", time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create lease: %v", err)
+	}
+	other, err := NewFileLease(path, "node-b", time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create lease: %v", err)
+	}
+	e := NewElector(l)
+	if _, _, ok := e.Context(context.Background()); ok {
+		t.Fatal("expected no leader context before the lease is held")
+	}
+	e.step()
+	ctx, cancel, ok := e.Context(context.Background())
+	if !ok {
+		t.Fatalf("expected a leader context: %+v", e.Status())
+	}
+	defer cancel()
+
+	// node-b takes over; the next step ends node-a's term and its work.
+	l.Release()
+	if _, ok, _ := other.TryAcquire(); !ok {
+		t.Fatal("expected node-b to acquire the released lease")
+	}
+	e.step()
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Error("expected the leader context to be cancelled when leadership is lost")
+	}
+}
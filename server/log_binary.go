@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+	"github.com/homveloper/exp-avro-json/server/registry"
+	"go.uber.org/zap"
+)
+
+// Binary ingest lets clients that already encode Avro skip the JSON hop.
+// The body is a single datum of one of the registered schemas, chosen with
+// the X-Avro-Schema header or the schema query parameter:
+//
+//	LogWrapper (default)  a complete wrapper whose body is LogData Avro JSON
+//	LogData               the log body only; wrapper fields come from the
+//	                      projectName, projectVersion, logLevel, logType and
+//	                      logSource query parameters
+//
+// The log body is of the built-in LogData schema unless the
+// X-Avro-Schema-Version header or version query parameter names another
+// registered LogData version.
+//
+// A body in Avro single-object encoding, whose header carries the schema
+// fingerprint, names its own schema: LogWrapper, or the LogData version
+// with that fingerprint. The schema and version parameters are then
+// optional but must agree with it when given.
+const (
+	avroContentType         = "application/avro"
+	avroSchemaHeader        = "X-Avro-Schema"
+	avroSchemaVersionHeader = "X-Avro-Schema-Version"
+)
+
+var ingestSchemas = avrojson.BuiltinSchemas()
+
+func logBinaryHandler(c *gin.Context) {
+	if mediaType, _, _ := mime.ParseMediaType(c.ContentType()); mediaType != avroContentType {
+		respondError(c, http.StatusUnsupportedMediaType, codeUnsupportedMediaType, "Content-Type must be "+avroContentType)
+		return
+	}
+
+	schemaName := c.GetHeader(avroSchemaHeader)
+	if schemaName == "" {
+		schemaName = c.Query("schema")
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		requestLogger(c).Error("Failed to read binary log request", zap.Error(err))
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	single, isSingle := singleObjectLogSchema(body)
+	if isSingle {
+		if schemaName != "" && schemaName != single.Name {
+			respondError(c, http.StatusBadRequest, codeValidationFailed, "Body is a single-object "+single.Name+" datum, not "+schemaName)
+			return
+		}
+		schemaName = single.Name
+		body = body[avrojson.SingleObjectHeaderSize:]
+	}
+	if schemaName == "" {
+		schemaName = "LogWrapper"
+	}
+	if _, ok := ingestSchemas[schemaName]; !ok {
+		respondError(c, http.StatusBadRequest, codeUnknownSchema, "Unknown schema "+schemaName+" (expected LogWrapper or LogData)")
+		return
+	}
+
+	var bodySchema string
+	if isSingle && single.Name == bodySubject {
+		// The fingerprint picked the version; the parameters may only
+		// repeat it.
+		if v := binaryBodyVersion(c); v != "" && v != strconv.Itoa(single.Version) {
+			respondError(c, http.StatusBadRequest, codeValidationFailed, "Body is a single-object "+bodySubject+" version "+strconv.Itoa(single.Version)+" datum, not version "+v)
+			return
+		}
+		if single.Schema != avrojson.LogDataSchema {
+			bodySchema = single.Schema
+		}
+	} else {
+		var ok bool
+		if bodySchema, ok = binaryBodySchema(c); !ok {
+			return
+		}
+	}
+
+	plainUnions, err := requestPlainUnions(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	if plainUnions && schemaName == "LogWrapper" {
+		schema := bodySchema
+		if schema == "" {
+			schema = avrojson.LogDataSchema
+		}
+		if body, err = wrapPlainBody(body, schema); err != nil {
+			respondError(c, http.StatusBadRequest, codeValidationFailed, "Body is not a valid LogWrapper Avro datum: "+err.Error())
+			return
+		}
+	}
+
+	var wrapper avrojson.LogWrapper
+	var data avrojson.LogData
+	var encoded *avrojson.EncodedLog
+	if bodySchema == "" {
+		switch schemaName {
+		case "LogWrapper":
+			wrapper, data, err = avrojson.DecodeLog(body)
+		case "LogData":
+			err = avrojson.Decode(avrojson.LogDataSchema, body, &data)
+			wrapper = binaryWrapperFromQuery(c)
+		}
+	} else {
+		wrapper, encoded, err = decodeVersionedBody(c, schemaName, bodySchema, body)
+		if err == nil {
+			err = json.Unmarshal(encoded.LogDataJSON, &data)
+		}
+	}
+	if err != nil {
+		requestLogger(c).Error("Failed to decode binary log request",
+			zap.String("schema", schemaName),
+			zap.Int("size_bytes", len(body)),
+			zap.Error(err))
+		respondDataError(c, "Body is not a valid "+schemaName+" Avro datum", err)
+		return
+	}
+	if wrapper.ProjectName == "" || wrapper.ProjectVersion == "" || wrapper.LogLevel == "" || wrapper.LogType == "" || wrapper.LogSource == "" {
+		respondError(c, http.StatusBadRequest, codeValidationFailed, "projectName, projectVersion, logLevel, logType and logSource are required")
+		return
+	}
+
+	req := LogRequest{
+		ProjectName:    wrapper.ProjectName,
+		ProjectVersion: wrapper.ProjectVersion,
+		LogLevel:       wrapper.LogLevel,
+		LogType:        wrapper.LogType,
+		LogSource:      wrapper.LogSource,
+		LogBody: LogData{
+			Timestamp:  data.Timestamp.UnixMilli(),
+			Logtype:    data.Logtype,
+			Version:    data.Version,
+			Issuer:     data.Issuer,
+			Metadata:   requestObject(data.Metadata),
+			DomainData: requestObject(data.DomainData),
+		},
+	}
+	received, _ := json.Marshal(req)
+	if !applyPlugins(c, &req) {
+		return
+	}
+	// Report savings against the JSON request the client did not send.
+	equivalentJSON, _ := json.Marshal(req)
+
+	wrapper = avrojson.LogWrapper{
+		ProjectName:    req.ProjectName,
+		ProjectVersion: req.ProjectVersion,
+		LogLevel:       req.LogLevel,
+		LogType:        req.LogType,
+		LogSource:      req.LogSource,
+	}
+	stored := req
+	stored.LogBody.Metadata = withRequestID(req.LogBody.Metadata, requestID(c))
+	if encoded == nil {
+		// Re-encode so stored records are normalized regardless of how the
+		// client formatted the wrapper body.
+		if encoded, err = encodeBuiltinLogRequest(stored, wrapper); err != nil {
+			requestLogger(c).Error("Failed to encode log to Avro", zap.Error(err))
+			respondError(c, http.StatusInternalServerError, codeEncodeFailed, "Failed to encode log to Avro")
+			return
+		}
+	} else if text, _ := json.Marshal(stored); !bytes.Equal(received, text) {
+		if encoded, err = reencodeVersionedBody(stored, wrapper, bodySchema, encoded); err != nil {
+			respondDataError(c, "Log does not fit its "+bodySubject+" version", err)
+			return
+		}
+	}
+
+	requestLogger(c).Info("Binary log received",
+		zap.String("schema", schemaName),
+		zap.Bool("single_object", isSingle),
+		zap.Int("received_bytes", len(body)))
+	respondLogged(c, req, encoded, equivalentJSON)
+}
+
+func binaryWrapperFromQuery(c *gin.Context) avrojson.LogWrapper {
+	return avrojson.LogWrapper{
+		ProjectName:    c.Query("projectName"),
+		ProjectVersion: c.Query("projectVersion"),
+		LogLevel:       c.Query("logLevel"),
+		LogType:        c.Query("logType"),
+		LogSource:      c.Query("logSource"),
+	}
+}
+
+// binaryBodySchema resolves the requested LogData version, returning "" for
+// the built-in one.
+func binaryBodySchema(c *gin.Context) (string, bool) {
+	v := binaryBodyVersion(c)
+	if v == "" {
+		return "", true
+	}
+	version, err := strconv.Atoi(v)
+	if err != nil || version < 1 {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, avroSchemaVersionHeader+" must be a positive integer")
+		return "", false
+	}
+	s, err := resolveSchema(bodySubject, version)
+	if err != nil {
+		respondError(c, http.StatusNotFound, codeUnknownSchema, bodySubject+" version "+v+" is not registered")
+		return "", false
+	}
+	if s.Schema == avrojson.LogDataSchema {
+		return "", true
+	}
+	return s.Schema, true
+}
+
+func binaryBodyVersion(c *gin.Context) string {
+	if v := c.GetHeader(avroSchemaVersionHeader); v != "" {
+		return v
+	}
+	return c.Query("version")
+}
+
+// decodeVersionedBody reads a datum whose log body is of bodySchema and
+// wraps it unchanged, so the body keeps the fields of its own version.
+func decodeVersionedBody(c *gin.Context, schemaName, bodySchema string, body []byte) (avrojson.LogWrapper, *avrojson.EncodedLog, error) {
+	var wrapper avrojson.LogWrapper
+	logData := body
+	if schemaName == "LogWrapper" {
+		if err := avrojson.Decode(avrojson.WrapperSchema, body, &wrapper); err != nil {
+			return wrapper, nil, err
+		}
+		codec, err := avrojson.DefaultCache.Get(bodySchema)
+		if err != nil {
+			return wrapper, nil, err
+		}
+		if logData, err = codec.JSONToBinary([]byte(wrapper.Body)); err != nil {
+			return wrapper, nil, fmt.Errorf("decode log data: %w", err)
+		}
+	} else {
+		wrapper = binaryWrapperFromQuery(c)
+	}
+	encoded, err := avrojson.EncodeLogBinary(wrapper, bodySchema, logData)
+	return wrapper, encoded, err
+}
+
+// requestObject gives a decoded string map the type of the objects of a
+// JSON /log request, so that plugins see both alike.
+func requestObject(v interface{}) interface{} {
+	m, ok := v.(map[string]string)
+	if !ok {
+		return v
+	}
+	out := make(map[string]interface{}, len(m))
+	for k, s := range m {
+		out[k] = s
+	}
+	return out
+}
+
+// reencodeVersionedBody encodes req, rewritten by a plugin or given its
+// request ID, with bodySchema, the version its body was sent in: req's fields replace the
+// ones they came from in the decoded body, which keeps the fields only
+// that version has.
+func reencodeVersionedBody(req LogRequest, wrapper avrojson.LogWrapper, bodySchema string, encoded *avrojson.EncodedLog) (*avrojson.EncodedLog, error) {
+	codec, err := avrojson.DefaultCache.Get(bodySchema)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := codec.StripUnionsJSON(encoded.LogDataJSON)
+	if err != nil {
+		return nil, err
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(plain, &body); err != nil {
+		return nil, err
+	}
+	body["timestamp"] = req.LogBody.Timestamp
+	body["logtype"] = req.LogBody.Logtype
+	body["version"] = req.LogBody.Version
+	body["issuer"] = req.LogBody.Issuer
+	body["metadata"] = req.LogBody.Metadata
+	body["domainData"] = req.LogBody.DomainData
+	if plain, err = json.Marshal(body); err != nil {
+		return nil, err
+	}
+	text, err := codec.WrapUnionsJSON(plain)
+	if err != nil {
+		return nil, err
+	}
+	logData, err := codec.JSONToBinary(text)
+	if err != nil {
+		return nil, err
+	}
+	return avrojson.EncodeLogBinary(wrapper, bodySchema, logData)
+}
+
+// singleObjectLogSchema returns the schema of a single-object encoded body
+// when its fingerprint is LogWrapper's or a registered LogData version's.
+// Any other body, including plain binary that happens to start with the
+// single-object marker, is read as before.
+func singleObjectLogSchema(body []byte) (registry.Schema, bool) {
+	for _, name := range []string{"LogWrapper", bodySubject} {
+		if s, ok := singleObjectVersion(name, body); ok {
+			return s, true
+		}
+	}
+	return registry.Schema{}, false
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+	"go.uber.org/zap"
+)
+
+func newBinaryTestEngine() *gin.Engine {
+	logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/log/binary", logBinaryHandler)
+	return r
+}
+
+func postAvro(r *gin.Engine, target, contentType string, body []byte, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestLogBinaryWrapper(t *testing.T) {
+	r := newBinaryTestEngine()
+
+	encoded, err := avrojson.EncodeLog(avrojson.LogWrapper{
+		ProjectName:    "game-server",
+		ProjectVersion: "1.0.0",
+		LogLevel:       "info",
+		LogType:        "user_action",
+		LogSource:      "game_client",
+	}, avrojson.LogData{
+		Timestamp: time.UnixMilli(1700000000000).UTC(),
+		Logtype:   "user_action",
+		Version:   "1.0",
+		Issuer:    "client",
+		// Carrying the request's ID already, the body is stored as sent.
+		Metadata: map[string]string{"level": "12", requestIDMetadataKey: "req-1"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode log: %v", err)
+	}
+
+	w := postAvro(r, "/log/binary", "application/avro", encoded.Wrapper, map[string]string{requestIDHeader: "req-1"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Status string                 `json:"status"`
+		Stats  map[string]interface{} `json:"compression_stats"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if resp.Status != "logged" {
+		t.Errorf("expected status logged, got %q", resp.Status)
+	}
+	if got := int(resp.Stats["wrapper_avro_size"].(float64)); got != len(encoded.Wrapper) {
+		t.Errorf("expected wrapper size %d, got %d", len(encoded.Wrapper), got)
+	}
+}
+
+func TestLogBinaryLogDataWithQueryWrapper(t *testing.T) {
+	r := newBinaryTestEngine()
+
+	data, err := avrojson.Encode(avrojson.LogDataSchema, avrojson.LogData{
+		Timestamp: time.UnixMilli(1).UTC(), Logtype: "t", Version: "1", Issuer: "i",
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode log data: %v", err)
+	}
+
+	target := "/log/binary?projectName=p&projectVersion=1&logLevel=info&logType=t&logSource=s"
+	if w := postAvro(r, target, "application/avro", data, map[string]string{avroSchemaHeader: "LogData"}); w.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := postAvro(r, "/log/binary?schema=LogData", "application/avro", data, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without wrapper fields, got %d", w.Code)
+	}
+}
+
+func TestLogBinaryRejectsInvalidInput(t *testing.T) {
+	r := newBinaryTestEngine()
+
+	valid, _ := avrojson.Encode(avrojson.LogDataSchema, avrojson.LogData{Timestamp: time.UnixMilli(1).UTC(), Logtype: "t", Version: "1", Issuer: "i"})
+	cases := []struct {
+		name        string
+		target      string
+		contentType string
+		body        []byte
+		want        int
+	}{
+		{"json content type", "/log/binary", "application/json", []byte("{}"), http.StatusUnsupportedMediaType},
+		{"unknown schema", "/log/binary?schema=Nope", "application/avro", valid, http.StatusBadRequest},
+		{"truncated datum", "/log/binary?schema=LogData", "application/avro", valid[:len(valid)-2], http.StatusBadRequest},
+		{"trailing bytes", "/log/binary?schema=LogData&projectName=p", "application/avro", append(valid, 0x00), http.StatusBadRequest},
+		{"wrapper with invalid body", "/log/binary", "application/avro; charset=binary", valid, http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		if w := postAvro(r, tc.target, tc.contentType, tc.body, nil); w.Code != tc.want {
+			t.Errorf("%s: expected %d, got %d: %s", tc.name, tc.want, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestLogBinarySingleObject(t *testing.T) {
+	r := newBinaryTestEngine()
+	if err := openSchemaRegistry(""); err != nil {
+		t.Fatalf("Failed to open schema registry: %v", err)
+	}
+	v2 := strings.Replace(avrojson.LogDataSchema, `"fields": [`, `"fields": [{"name": "region", "type": "string", "default": "unknown"},`, 1)
+	s2, _, err := schemaRegistry.Register(bodySubject, v2)
+	if err != nil {
+		t.Fatalf("Failed to register LogData v2: %v", err)
+	}
+
+	encoded, err := avrojson.EncodeLog(avrojson.LogWrapper{ProjectName: "p", ProjectVersion: "1", LogLevel: "info", LogType: "t", LogSource: "s"}, avrojson.LogData{Timestamp: time.UnixMilli(1).UTC(), Logtype: "t", Version: "1", Issuer: "i"})
+	if err != nil {
+		t.Fatalf("Failed to encode log: %v", err)
+	}
+	wrapper, _, err := encoded.SingleObjects()
+	if err != nil {
+		t.Fatalf("Failed to encode single objects: %v", err)
+	}
+	if w := postAvro(r, "/log/binary", "application/avro", wrapper, nil); w.Code != http.StatusOK {
+		t.Errorf("expected a single-object wrapper to be logged, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// The fingerprint selects LogData v2 without a version parameter.
+	codec, _ := avrojson.DefaultCache.Get(v2)
+	logData, err := codec.EncodeNativeSingle(map[string]interface{}{
+		"region": "eu", "timestamp": int64(1), "logtype": "t", "version": "1", "issuer": "i",
+		"metadata": nil, "domainData": nil,
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode LogData v2: %v", err)
+	}
+	query := "/log/binary?echo=full&projectName=p&projectVersion=1&logLevel=info&logType=t&logSource=s"
+	w := postAvro(r, query, "application/avro", logData, map[string]string{requestIDHeader: "req-2"})
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `\"region\":\"eu\"`) {
+		t.Errorf("expected a v2 log body, got %d: %s", w.Code, w.Body.String())
+	}
+	// Like the built-in body, it is stored with the request's ID.
+	if !strings.Contains(w.Body.String(), `\"`+requestIDMetadataKey+`\":\"req-2\"`) {
+		t.Errorf("expected the v2 log body to carry the request ID, got %s", w.Body.String())
+	}
+	if w := postAvro(r, query+"&version="+strconv.Itoa(s2.Version), "application/avro", logData, nil); w.Code != http.StatusOK {
+		t.Errorf("expected a matching version to be accepted, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := postAvro(r, query+"&version=1", "application/avro", logData, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("expected a conflicting version to be rejected, got %d", w.Code)
+	}
+	if w := postAvro(r, "/log/binary?schema=LogData", "application/avro", wrapper, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("expected a conflicting schema to be rejected, got %d", w.Code)
+	}
+}
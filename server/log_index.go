@@ -0,0 +1,333 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/homveloper/exp-avro-json/server/ocf"
+	"go.uber.org/zap"
+)
+
+// logIndexEntry locates one stored LogWrapper record: the block it was
+// written in and its place in that block.
+type logIndexEntry struct {
+	// Timestamp is the LogData timestamp carried in the body, in Unix
+	// milliseconds; zero when the body has none.
+	Timestamp int64
+	Project   string
+	LogType   string
+	File      string
+	Offset    int64
+	Index     int
+	// seq orders entries with the same timestamp by when they were added.
+	seq uint64
+}
+
+func (e logIndexEntry) before(ts int64, seq uint64) bool {
+	return e.Timestamp < ts || (e.Timestamp == ts && e.seq < seq)
+}
+
+// logIndex is an in-memory index of an OCF store's wrapper stream, sorted
+// by timestamp, so /logs reads only the blocks holding matching records.
+// The file sink's stores keep one, fed by every block their wrapper writer
+// writes and rebuilt from the existing files when the store is opened.
+type logIndex struct {
+	mu      sync.RWMutex
+	entries []logIndexEntry
+	seq     uint64
+}
+
+func newLogIndex() *logIndex { return &logIndex{} }
+
+// addBlock indexes the records of one wrapper block; it is the wrapper
+// writer's ocf.Options.OnBlock.
+func (x *logIndex) addBlock(file string, offset int64, records []interface{}) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for i, record := range records {
+		fields, _ := record.(map[string]interface{})
+		project, _ := fields["projectName"].(string)
+		logType, _ := fields["logType"].(string)
+		body, _ := fields["body"].(string)
+		var data struct {
+			Timestamp int64 `json:"timestamp"`
+		}
+		json.Unmarshal([]byte(body), &data)
+		x.seq++
+		e := logIndexEntry{Timestamp: data.Timestamp, Project: project, LogType: logType, File: file, Offset: offset, Index: i, seq: x.seq}
+		// Logs mostly arrive in time order, so the entry usually goes last.
+		at := sort.Search(len(x.entries), func(j int) bool { return !x.entries[j].before(e.Timestamp, e.seq) })
+		x.entries = append(x.entries, logIndexEntry{})
+		copy(x.entries[at+1:], x.entries[at:])
+		x.entries[at] = e
+	}
+}
+
+// rebuild indexes the wrapper files already in dir, read with store's key.
+// A file that cannot be read is indexed up to its last readable block.
+func (x *logIndex) rebuild(dir string, store *ocfStore) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "wrapper-*.avro"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		src := ocfSource{Path: path, key: store.key}
+		f, err := src.open()
+		if err != nil {
+			return err
+		}
+		_, err = ocf.ScanBlocks(f, func(offset int64, records []interface{}) error {
+			x.addBlock(path, offset, records)
+			return nil
+		})
+		f.Close()
+		if err != nil {
+			logger.Warn("Indexed OCF file up to an unreadable block", zap.String("file", path), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+func (x *logIndex) len() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return len(x.entries)
+}
+
+// logQuery selects index entries: From inclusive and To exclusive, both
+// Unix milliseconds with zero unbounded, and LogType and Project matched
+// exactly when set.
+type logQuery struct {
+	From, To int64
+	LogType  string
+	Project  string
+	// After resumes a previous query at the entry its cursor names.
+	After *logCursor
+	Limit int
+}
+
+// logCursor names an entry by its place in the index order, so a page
+// resumes correctly while logs are added.
+type logCursor struct {
+	Timestamp int64
+	Seq       uint64
+}
+
+func (c logCursor) String() string { return fmt.Sprintf("%d.%d", c.Timestamp, c.Seq) }
+
+func parseLogCursor(s string) (*logCursor, error) {
+	ts, seq, ok := strings.Cut(s, ".")
+	c := &logCursor{}
+	var err error
+	if ok {
+		if c.Timestamp, err = strconv.ParseInt(ts, 10, 64); err == nil {
+			c.Seq, err = strconv.ParseUint(seq, 10, 64)
+		}
+	}
+	if !ok || err != nil {
+		return nil, fmt.Errorf("invalid cursor %q", s)
+	}
+	return c, nil
+}
+
+// query returns up to q.Limit matching entries in timestamp order and the
+// cursor of the next match, nil when there is none.
+func (x *logIndex) query(q logQuery) ([]logIndexEntry, *logCursor) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	start := 0
+	if q.From != 0 {
+		start = sort.Search(len(x.entries), func(i int) bool { return !x.entries[i].before(q.From, 0) })
+	}
+	if q.After != nil {
+		after := sort.Search(len(x.entries), func(i int) bool { return !x.entries[i].before(q.After.Timestamp, q.After.Seq) })
+		start = max(start, after)
+	}
+	var matches []logIndexEntry
+	for _, e := range x.entries[start:] {
+		if q.To != 0 && e.Timestamp >= q.To {
+			break
+		}
+		if (q.LogType != "" && e.LogType != q.LogType) || (q.Project != "" && e.Project != q.Project) {
+			continue
+		}
+		if len(matches) == q.Limit {
+			return matches, &logCursor{e.Timestamp, e.seq}
+		}
+		matches = append(matches, e)
+	}
+	return matches, nil
+}
+
+// Page sizes of GET /logs.
+const (
+	defaultLogsLimit = 100
+	maxLogsLimit     = 1000
+)
+
+// queryLog is one record of a /logs response: the wrapper fields, with the
+// LogData body as the Avro JSON it was stored as, and where it is stored.
+type queryLog struct {
+	Timestamp      int64           `json:"timestamp"`
+	ProjectName    string          `json:"projectName"`
+	ProjectVersion string          `json:"projectVersion"`
+	LogLevel       string          `json:"logLevel"`
+	LogType        string          `json:"logType"`
+	LogSource      string          `json:"logSource"`
+	Body           json.RawMessage `json:"body"`
+	File           string          `json:"file"`
+	Offset         int64           `json:"offset"`
+	Index          int             `json:"index"`
+}
+
+// logsHandler serves GET /logs: the stored logs in a time range, found in
+// the store's index and decoded from the blocks holding them, as JSON in
+// timestamp order.
+//
+// Query parameters: from and to (RFC 3339 or Unix ms, to exclusive) bound
+// the LogData timestamp; logType and project match the wrapper's logType
+// and projectName; limit (default 100, at most 1000) sizes the page and
+// cursor, the next_cursor of the previous page, continues it.
+func logsHandler(c *gin.Context) {
+	store := requestOCFStore(c)
+	if store == nil {
+		return
+	}
+	if store.index == nil {
+		respondError(c, http.StatusNotFound, codeNotFound, "The log index is disabled")
+		return
+	}
+	q := logQuery{LogType: c.Query("logType"), Project: c.Query("project"), Limit: defaultLogsLimit}
+	for _, bound := range []struct {
+		param string
+		dst   *int64
+	}{{"from", &q.From}, {"to", &q.To}} {
+		t, err := parseExportTime(c.Query(bound.param))
+		if err != nil {
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, bound.param+": "+err.Error())
+			return
+		}
+		if !t.IsZero() {
+			*bound.dst = t.UnixMilli()
+		}
+	}
+	if s := c.Query("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxLogsLimit {
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("limit must be an integer from 1 to %d", maxLogsLimit))
+			return
+		}
+		q.Limit = n
+	}
+	if s := c.Query("cursor"); s != "" {
+		var err error
+		if q.After, err = parseLogCursor(s); err != nil {
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+			return
+		}
+	}
+	// Write the logs waiting in partly filled blocks, so they are indexed.
+	if err := store.flush(); err != nil {
+		requestLogger(c).Error("Failed to flush OCF logs", zap.Error(err))
+		respondError(c, http.StatusInternalServerError, codeStorageFailed, "Failed to flush OCF logs")
+		return
+	}
+
+	entries, next := store.index.query(q)
+	logs, err := readIndexedLogs(store, entries)
+	if err != nil {
+		requestLogger(c).Error("Failed to read indexed logs", zap.Error(err))
+		respondError(c, http.StatusInternalServerError, codeStorageFailed, "Failed to read stored logs")
+		return
+	}
+	resp := gin.H{"logs": logs, "count": len(logs)}
+	if next != nil {
+		resp["next_cursor"] = next.String()
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// readIndexedLogs decodes the records entries point at, reading each
+// block once and mapping each plain file once. Entries of files removed since they were indexed are
+// skipped.
+func readIndexedLogs(store *ocfStore, entries []logIndexEntry) ([]queryLog, error) {
+	type blockRef struct {
+		file   string
+		offset int64
+	}
+	blocks := make(map[blockRef][]interface{})
+	mapped := make(map[string]*ocf.MappedFile)
+	defer func() {
+		for _, m := range mapped {
+			m.Close()
+		}
+	}()
+	logs := make([]queryLog, 0, len(entries))
+	for _, e := range entries {
+		ref := blockRef{e.File, e.Offset}
+		records, ok := blocks[ref]
+		if !ok {
+			var err error
+			records, err = readStoredBlock(mapped, store, e.File, e.Offset)
+			if errors.Is(err, os.ErrNotExist) {
+				logger.Warn("Skipping logs of a removed OCF file", zap.String("file", e.File))
+			} else if err != nil {
+				return nil, err
+			}
+			blocks[ref] = records
+		}
+		if e.Index >= len(records) {
+			continue
+		}
+		fields, _ := records[e.Index].(map[string]interface{})
+		str := func(name string) string { s, _ := fields[name].(string); return s }
+		log := queryLog{
+			Timestamp:      e.Timestamp,
+			ProjectName:    str("projectName"),
+			ProjectVersion: str("projectVersion"),
+			LogLevel:       str("logLevel"),
+			LogType:        str("logType"),
+			LogSource:      str("logSource"),
+			Body:           json.RawMessage(str("body")),
+			File:           filepath.Base(e.File),
+			Offset:         e.Offset,
+			Index:          e.Index,
+		}
+		if !json.Valid(log.Body) {
+			log.Body, _ = json.Marshal(str("body"))
+		}
+		logs = append(logs, log)
+	}
+	return logs, nil
+}
+
+// readStoredBlock reads the block at offset of file, one of store's files.
+// Plain files are mapped and kept in mapped, so a query reading many blocks
+// of a large file neither reopens it nor parses its header per block, and
+// pages in only the blocks read; sealed files are decrypted up to the
+// block.
+func readStoredBlock(mapped map[string]*ocf.MappedFile, store *ocfStore, file string, offset int64) ([]interface{}, error) {
+	m, ok := mapped[file]
+	if !ok && store.key == nil {
+		var err error
+		if m, err = ocf.Map(file); err != nil {
+			return nil, err
+		}
+		mapped[file] = m
+	}
+	if m != nil {
+		return m.BlockAt(offset)
+	}
+	_, records, err := ocf.ReadBlockAt(file, store.key, offset)
+	return records, err
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+	"go.uber.org/zap"
+)
+
+type logsResponse struct {
+	Logs []struct {
+		Timestamp int64                  `json:"timestamp"`
+		LogType   string                 `json:"logType"`
+		Body      map[string]interface{} `json:"body"`
+		File      string                 `json:"file"`
+	} `json:"logs"`
+	Count      int    `json:"count"`
+	NextCursor string `json:"next_cursor"`
+}
+
+func writeIndexedLogs(t *testing.T, timestamps []int64) {
+	t.Helper()
+	for i, ts := range timestamps {
+		logType := "login"
+		if i%2 == 1 {
+			logType = "purchase"
+		}
+		encoded, err := avrojson.EncodeLog(avrojson.LogWrapper{ProjectName: "p", LogType: logType},
+			avrojson.LogData{Timestamp: time.UnixMilli(ts).UTC(), Logtype: logType, Version: "1", Issuer: "issuer-" + logType})
+		if err != nil {
+			t.Fatalf("Failed to encode log: %v", err)
+		}
+		writeOCFLog(t, encoded)
+	}
+}
+
+func TestLogsQueryPaginates(t *testing.T) {
+	logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	if err := openOCFLogs(t.TempDir(), ocfTuning{BlockRecords: 2}); err != nil {
+		t.Fatalf("Failed to open OCF logs: %v", err)
+	}
+	defer func() { ocfLogs.wrapper, ocfLogs.logData = nil, nil }()
+	writeIndexedLogs(t, []int64{3000, 1000, 2000, 4000, 5000})
+
+	r := gin.New()
+	r.GET("/logs", logsHandler)
+	query := func(target string) (int, logsResponse) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		var resp logsResponse
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+		}
+		return w.Code, resp
+	}
+
+	// The last log waits in a partly filled block until the query flushes it.
+	var got []int64
+	target := "/logs?from=1000&to=1970-01-01T00:00:05Z&limit=2"
+	for pages := 0; target != ""; pages++ {
+		code, resp := query(target)
+		if code != http.StatusOK || pages > 2 {
+			t.Fatalf("unexpected page %d: %d %+v", pages, code, resp)
+		}
+		for _, log := range resp.Logs {
+			got = append(got, log.Timestamp)
+		}
+		target = ""
+		if resp.NextCursor != "" {
+			target = "/logs?from=1000&to=1970-01-01T00:00:05Z&limit=2&cursor=" + resp.NextCursor
+		}
+	}
+	if len(got) != 4 || got[0] != 1000 || got[3] != 4000 {
+		t.Errorf("expected the logs from 1000 to 4000 in time order, got %v", got)
+	}
+
+	code, resp := query("/logs?logType=purchase")
+	if code != http.StatusOK || resp.Count != 2 || resp.NextCursor != "" {
+		t.Fatalf("expected the 2 purchase logs, got %d %+v", code, resp)
+	}
+	if log := resp.Logs[0]; log.Timestamp != 1000 || log.Body["issuer"] != "issuer-purchase" || log.File == "" {
+		t.Errorf("unexpected log %+v", log)
+	}
+	if ocfLogs.stats()["indexed_logs"] != 5 {
+		t.Errorf("expected 5 indexed logs in the stats, got %v", ocfLogs.stats()["indexed_logs"])
+	}
+
+	for _, target := range []string{"/logs?from=yesterday", "/logs?limit=0", "/logs?limit=1001", "/logs?cursor=next"} {
+		if code, _ := query(target); code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", target, code)
+		}
+	}
+}
+
+func TestLogIndexRebuildsOnOpen(t *testing.T) {
+	logger = zap.NewNop()
+	dir := t.TempDir()
+	if err := openOCFLogs(dir, ocfTuning{MaxRecords: 2}); err != nil {
+		t.Fatalf("Failed to open OCF logs: %v", err)
+	}
+	writeIndexedLogs(t, []int64{1000, 2000, 3000})
+	ocfLogs.wrapper.Close()
+	ocfLogs.logData.Close()
+
+	if err := openOCFLogs(dir, ocfTuning{}); err != nil {
+		t.Fatalf("Failed to reopen OCF logs: %v", err)
+	}
+	defer func() { ocfLogs.wrapper, ocfLogs.logData = nil, nil }()
+	if n := ocfLogs.index.len(); n != 3 {
+		t.Fatalf("expected the 3 stored logs to be indexed, got %d", n)
+	}
+	entries, next := ocfLogs.index.query(logQuery{From: 2000, Limit: 10})
+	if len(entries) != 2 || next != nil {
+		t.Fatalf("unexpected entries %+v", entries)
+	}
+	logs, err := readIndexedLogs(&ocfLogs, entries)
+	if err != nil {
+		t.Fatalf("Failed to read indexed logs: %v", err)
+	}
+	if len(logs) != 2 || logs[1].Timestamp != 3000 || logs[1].File == logs[0].File {
+		t.Errorf("expected logs from both rolled files, got %+v", logs)
+	}
+}
@@ -0,0 +1,351 @@
+// Package logdb is an embedded database of encoded logs and their
+// compression stats, kept in one append-only file instead of loose files,
+// so questions such as the mean compression ratio per logType over the
+// last day are answered from memory rather than by scanning directories.
+//
+// Neither SQLite nor Bolt is in the server's dependency set, so the file
+// format is the package's own: an 8-byte header followed by one frame per
+// log, a little-endian uint32 payload length, the payload's CRC-32C and the
+// payload. Open reads every frame once to build the in-memory index of
+// times, projects, log types and stats; the encodings stay on disk until
+// Get reads them.
+package logdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// fileHeader starts every database file; the last byte is the format
+// version.
+var fileHeader = []byte("LOGDB\x00\n\x01")
+
+const frameHeaderSize = 8
+
+// maxPayload bounds the allocation a corrupt frame length can cause.
+const maxPayload = 64 << 20
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+var (
+	// ErrNotFound is returned by Get for unknown IDs.
+	ErrNotFound = errors.New("logdb: log not found")
+	// ErrExists is returned by Put for an ID already stored.
+	ErrExists = errors.New("logdb: log already stored")
+	// ErrClosed is returned after Close.
+	ErrClosed = errors.New("logdb: closed")
+)
+
+// Sizes are the compression stats of one log, in bytes.
+type Sizes struct {
+	OriginalJSON int64 `json:"original_json"`
+	WrapperAvro  int64 `json:"wrapper_avro"`
+	LogDataAvro  int64 `json:"logdata_avro"`
+	WrapperJSON  int64 `json:"wrapper_json"`
+}
+
+func (s *Sizes) add(d Sizes) {
+	s.OriginalJSON += d.OriginalJSON
+	s.WrapperAvro += d.WrapperAvro
+	s.LogDataAvro += d.LogDataAvro
+	s.WrapperJSON += d.WrapperJSON
+}
+
+// Record is one stored log: its encodings, what it was indexed by and its
+// stats.
+type Record struct {
+	ID      string
+	Project string
+	LogType string
+	Time    time.Time
+	Sizes   Sizes
+	// Wrapper and LogData are the Avro binary encodings.
+	Wrapper []byte
+	LogData []byte
+}
+
+// entry is a record in the in-memory index, without its encodings.
+type entry struct {
+	offset  int64
+	time    int64 // Unix nanoseconds
+	id      string
+	project string
+	logType string
+	sizes   Sizes
+}
+
+// Stats describes the database file.
+type Stats struct {
+	Path      string `json:"path"`
+	Logs      int64  `json:"logs"`
+	FileBytes int64  `json:"file_bytes"`
+	// TruncatedBytes is the unreadable tail Open cut off, the frames of
+	// writes a crash interrupted.
+	TruncatedBytes int64 `json:"truncated_bytes"`
+}
+
+// DB is an open database file. It is safe for concurrent use.
+type DB struct {
+	path string
+
+	mu        sync.RWMutex
+	f         *os.File
+	size      int64
+	entries   []entry
+	byID      map[string]int64 // frame offsets
+	truncated int64
+}
+
+// Open opens or creates the database file at path and indexes its logs.
+// A torn or corrupt frame ends the readable part of the file; it and any
+// bytes after it are truncated, so the next Put starts on a frame
+// boundary.
+func Open(path string) (*DB, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	db := &DB{path: path, f: f, byID: make(map[string]int64)}
+	if err := db.load(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func (db *DB) load() error {
+	info, err := db.f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		if _, err := db.f.Write(fileHeader); err != nil {
+			return err
+		}
+		db.size = int64(len(fileHeader))
+		return nil
+	}
+	r := io.NewSectionReader(db.f, 0, info.Size())
+	head := make([]byte, len(fileHeader))
+	if _, err := io.ReadFull(r, head); err != nil || !bytes.Equal(head, fileHeader) {
+		return fmt.Errorf("logdb: %s is not a log database", db.path)
+	}
+	offset := int64(len(fileHeader))
+	for offset < info.Size() {
+		e, next, err := readEntry(r, offset)
+		if err != nil {
+			break
+		}
+		db.index(e)
+		offset = next
+	}
+	if offset < info.Size() {
+		db.truncated = info.Size() - offset
+		if err := db.f.Truncate(offset); err != nil {
+			return err
+		}
+	}
+	db.size = offset
+	return nil
+}
+
+// readEntry reads the frame at offset and returns its index entry and the
+// offset of the next frame.
+func readEntry(r io.ReaderAt, offset int64) (entry, int64, error) {
+	payload, err := readFrame(r, offset)
+	if err != nil {
+		return entry{}, 0, err
+	}
+	rec, err := decodeRecord(payload, false)
+	if err != nil {
+		return entry{}, 0, err
+	}
+	e := entry{offset: offset, time: rec.Time.UnixNano(), id: rec.ID, project: rec.Project, logType: rec.LogType, sizes: rec.Sizes}
+	return e, offset + frameHeaderSize + int64(len(payload)), nil
+}
+
+func readFrame(r io.ReaderAt, offset int64) ([]byte, error) {
+	var head [frameHeaderSize]byte
+	if _, err := r.ReadAt(head[:], offset); err != nil {
+		return nil, err
+	}
+	n := binary.LittleEndian.Uint32(head[:4])
+	if n > maxPayload {
+		return nil, fmt.Errorf("logdb: frame of %d bytes at %d", n, offset)
+	}
+	payload := make([]byte, n)
+	if _, err := r.ReadAt(payload, offset+frameHeaderSize); err != nil {
+		return nil, err
+	}
+	if crc32.Checksum(payload, castagnoli) != binary.LittleEndian.Uint32(head[4:]) {
+		return nil, fmt.Errorf("logdb: checksum mismatch at %d", offset)
+	}
+	return payload, nil
+}
+
+// index adds e, keeping the entries in time order. Logs are mostly put in
+// time order, so e usually goes last.
+func (db *DB) index(e entry) {
+	at := sort.Search(len(db.entries), func(i int) bool { return db.entries[i].time > e.time })
+	db.entries = append(db.entries, entry{})
+	copy(db.entries[at+1:], db.entries[at:])
+	db.entries[at] = e
+	db.byID[e.id] = e.offset
+}
+
+// Put appends r as one write.
+func (db *DB) Put(r Record) error {
+	payload := encodeRecord(r)
+	if len(payload) > maxPayload {
+		return fmt.Errorf("logdb: record of %d bytes exceeds %d", len(payload), maxPayload)
+	}
+	frame := make([]byte, frameHeaderSize, frameHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(frame[:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(frame[4:], crc32.Checksum(payload, castagnoli))
+	frame = append(frame, payload...)
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.f == nil {
+		return ErrClosed
+	}
+	if _, ok := db.byID[r.ID]; ok {
+		return fmt.Errorf("%w: %s", ErrExists, r.ID)
+	}
+	if _, err := db.f.WriteAt(frame, db.size); err != nil {
+		// Cut a partial frame so later frames stay readable.
+		db.f.Truncate(db.size)
+		return err
+	}
+	e := entry{offset: db.size, time: r.Time.UnixNano(), id: r.ID, project: r.Project, logType: r.LogType, sizes: r.Sizes}
+	db.size += int64(len(frame))
+	db.index(e)
+	return nil
+}
+
+// Get reads the record of log id, encodings included.
+func (db *DB) Get(id string) (Record, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.f == nil {
+		return Record{}, ErrClosed
+	}
+	offset, ok := db.byID[id]
+	if !ok {
+		return Record{}, ErrNotFound
+	}
+	payload, err := readFrame(db.f, offset)
+	if err != nil {
+		return Record{}, err
+	}
+	return decodeRecord(payload, true)
+}
+
+// Sync commits the file to stable storage.
+func (db *DB) Sync() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.f == nil {
+		return ErrClosed
+	}
+	return db.f.Sync()
+}
+
+// Stats returns the size of the database.
+func (db *DB) Stats() Stats {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return Stats{Path: db.path, Logs: int64(len(db.entries)), FileBytes: db.size, TruncatedBytes: db.truncated}
+}
+
+// Close closes the file.
+func (db *DB) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.f == nil {
+		return nil
+	}
+	err := db.f.Close()
+	db.f = nil
+	return err
+}
+
+// encodeRecord lays out a payload: the ID, project and log type as
+// length-prefixed strings, the time in Unix nanoseconds and the sizes as
+// varints, then the two encodings as length-prefixed bytes.
+func encodeRecord(r Record) []byte {
+	buf := make([]byte, 0, 64+len(r.ID)+len(r.Project)+len(r.LogType)+len(r.Wrapper)+len(r.LogData))
+	for _, s := range []string{r.ID, r.Project, r.LogType} {
+		buf = binary.AppendUvarint(buf, uint64(len(s)))
+		buf = append(buf, s...)
+	}
+	buf = binary.AppendVarint(buf, r.Time.UnixNano())
+	for _, n := range []int64{r.Sizes.OriginalJSON, r.Sizes.WrapperAvro, r.Sizes.LogDataAvro, r.Sizes.WrapperJSON} {
+		buf = binary.AppendVarint(buf, n)
+	}
+	for _, b := range [][]byte{r.Wrapper, r.LogData} {
+		buf = binary.AppendUvarint(buf, uint64(len(b)))
+		buf = append(buf, b...)
+	}
+	return buf
+}
+
+var errShortRecord = errors.New("logdb: truncated record")
+
+// decodeRecord reverses encodeRecord, skipping the encodings unless
+// encodings is set.
+func decodeRecord(data []byte, encodings bool) (Record, error) {
+	var r Record
+	next := func() ([]byte, error) {
+		n, k := binary.Uvarint(data)
+		if k <= 0 || n > uint64(len(data)-k) {
+			return nil, errShortRecord
+		}
+		b := data[k : k+int(n)]
+		data = data[k+int(n):]
+		return b, nil
+	}
+	varint := func() (int64, error) {
+		n, k := binary.Varint(data)
+		if k <= 0 {
+			return 0, errShortRecord
+		}
+		data = data[k:]
+		return n, nil
+	}
+	for _, dst := range []*string{&r.ID, &r.Project, &r.LogType} {
+		b, err := next()
+		if err != nil {
+			return r, err
+		}
+		*dst = string(b)
+	}
+	ns, err := varint()
+	if err != nil {
+		return r, err
+	}
+	r.Time = time.Unix(0, ns).UTC()
+	for _, dst := range []*int64{&r.Sizes.OriginalJSON, &r.Sizes.WrapperAvro, &r.Sizes.LogDataAvro, &r.Sizes.WrapperJSON} {
+		if *dst, err = varint(); err != nil {
+			return r, err
+		}
+	}
+	for _, dst := range []*[]byte{&r.Wrapper, &r.LogData} {
+		b, err := next()
+		if err != nil {
+			return r, err
+		}
+		if encodings {
+			*dst = append([]byte(nil), b...)
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,118 @@
+package logdb
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func putTestLogs(t *testing.T, db *DB, base time.Time) {
+	t.Helper()
+	for i, logType := range []string{"login", "purchase", "login", "login"} {
+		r := Record{
+			ID:      string(rune('a' + i)),
+			Project: "p",
+			LogType: logType,
+			Time:    base.Add(time.Duration(i) * time.Hour),
+			Sizes:   Sizes{OriginalJSON: 100, WrapperAvro: int64(40 + 10*i), LogDataAvro: 30, WrapperJSON: 120},
+			Wrapper: []byte{byte(i), 1, 2},
+			LogData: []byte{byte(i)},
+		}
+		if err := db.Put(r); err != nil {
+			t.Fatalf("Failed to put record: %v", err)
+		}
+	}
+}
+
+func TestPutGetAndReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs.db")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	putTestLogs(t, db, base)
+	if err := db.Put(Record{ID: "a"}); !errors.Is(err, ErrExists) {
+		t.Errorf("expected ErrExists for a repeated ID, got %v", err)
+	}
+	want, err := db.Get("b")
+	if err != nil {
+		t.Fatalf("Failed to get record: %v", err)
+	}
+	if want.LogType != "purchase" || !want.Time.Equal(base.Add(time.Hour)) || string(want.Wrapper) != "\x01\x01\x02" {
+		t.Errorf("unexpected record %+v", want)
+	}
+	if _, err := db.Get("missing"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	size := db.Stats().FileBytes
+	db.Close()
+
+	// A torn frame at the end, as a crash mid-write leaves, is cut off.
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	f.Write([]byte{200, 0, 0, 0, 1, 2})
+	f.Close()
+
+	db, err = Open(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+	if stats := db.Stats(); stats.Logs != 4 || stats.FileBytes != size || stats.TruncatedBytes != 6 {
+		t.Errorf("unexpected stats after reopening %+v", stats)
+	}
+	if got, err := db.Get("b"); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("expected the same record after reopening, got %+v: %v", got, err)
+	}
+	if err := db.Put(Record{ID: "e", Time: base}); err != nil {
+		t.Fatalf("Failed to put after recovery: %v", err)
+	}
+}
+
+func TestOpenRejectsOtherFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	os.WriteFile(path, []byte("not a database"), 0644)
+	if _, err := Open(path); err == nil {
+		t.Error("expected a file without the header to be rejected")
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "logs.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	putTestLogs(t, db, base)
+
+	groups, err := db.Aggregate(Query{GroupBy: GroupLogType})
+	if err != nil {
+		t.Fatalf("Failed to aggregate: %v", err)
+	}
+	if len(groups) != 2 || groups[0].Key != "login" || groups[0].Logs != 3 || groups[1].Logs != 1 {
+		t.Fatalf("unexpected groups %+v", groups)
+	}
+	// Logins a, c and d have wrapper sizes 40, 60 and 70 of 100 JSON bytes.
+	login := groups[0]
+	if login.Bytes.WrapperAvro != 170 || login.MeanWrapperRatio < 0.566 || login.MeanWrapperRatio > 0.567 || login.MeanLogDataRatio != 0.3 {
+		t.Errorf("unexpected login group %+v", login)
+	}
+	if !login.First.Equal(base) || !login.Last.Equal(base.Add(3*time.Hour)) {
+		t.Errorf("unexpected login span %v to %v", login.First, login.Last)
+	}
+
+	groups, _ = db.Aggregate(Query{From: base.Add(time.Hour), To: base.Add(3 * time.Hour), LogType: "login"})
+	if len(groups) != 1 || groups[0].Logs != 1 || groups[0].Bytes.WrapperAvro != 60 {
+		t.Errorf("expected only log c in the window, got %+v", groups)
+	}
+	if groups, _ := db.Aggregate(Query{Project: "other"}); len(groups) != 0 {
+		t.Errorf("expected no groups for another project, got %+v", groups)
+	}
+	if _, err := db.Aggregate(Query{GroupBy: "issuer"}); err == nil {
+		t.Error("expected an unknown group field to fail")
+	}
+}
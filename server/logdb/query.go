@@ -0,0 +1,98 @@
+package logdb
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Fields Query.GroupBy accepts.
+const (
+	GroupNone    = ""
+	GroupLogType = "logType"
+	GroupProject = "project"
+)
+
+// Query selects logs by time, [From, To) with zero bounds open, and by
+// project and log type when set, and groups them by GroupBy.
+type Query struct {
+	From, To time.Time
+	Project  string
+	LogType  string
+	GroupBy  string
+}
+
+// Group aggregates the logs sharing a GroupBy value. The Mean ratios
+// average each log's encoded size over its original JSON size, so every
+// log counts the same; dividing the byte totals instead weighs them by
+// size.
+type Group struct {
+	Key              string    `json:"key"`
+	Logs             int64     `json:"logs"`
+	Bytes            Sizes     `json:"bytes"`
+	MeanWrapperRatio float64   `json:"mean_wrapper_ratio"`
+	MeanLogDataRatio float64   `json:"mean_logdata_ratio"`
+	First            time.Time `json:"first"`
+	Last             time.Time `json:"last"`
+}
+
+// Aggregate answers q from the in-memory index, returning the groups in
+// key order.
+func (db *DB) Aggregate(q Query) ([]Group, error) {
+	switch q.GroupBy {
+	case GroupNone, GroupLogType, GroupProject:
+	default:
+		return nil, fmt.Errorf("logdb: cannot group by %q", q.GroupBy)
+	}
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	start := 0
+	if !q.From.IsZero() {
+		from := q.From.UnixNano()
+		start = sort.Search(len(db.entries), func(i int) bool { return db.entries[i].time >= from })
+	}
+	type sums struct {
+		Group
+		wrapperRatio, logDataRatio float64
+		ratios                     int64
+	}
+	groups := make(map[string]*sums)
+	for _, e := range db.entries[start:] {
+		if !q.To.IsZero() && e.time >= q.To.UnixNano() {
+			break
+		}
+		if (q.Project != "" && e.project != q.Project) || (q.LogType != "" && e.logType != q.LogType) {
+			continue
+		}
+		key := ""
+		switch q.GroupBy {
+		case GroupLogType:
+			key = e.logType
+		case GroupProject:
+			key = e.project
+		}
+		g := groups[key]
+		if g == nil {
+			g = &sums{Group: Group{Key: key, First: time.Unix(0, e.time).UTC()}}
+			groups[key] = g
+		}
+		g.Logs++
+		g.Bytes.add(e.sizes)
+		g.Last = time.Unix(0, e.time).UTC()
+		if e.sizes.OriginalJSON > 0 {
+			g.wrapperRatio += float64(e.sizes.WrapperAvro) / float64(e.sizes.OriginalJSON)
+			g.logDataRatio += float64(e.sizes.LogDataAvro) / float64(e.sizes.OriginalJSON)
+			g.ratios++
+		}
+	}
+	out := make([]Group, 0, len(groups))
+	for _, g := range groups {
+		if g.ratios > 0 {
+			g.MeanWrapperRatio = g.wrapperRatio / float64(g.ratios)
+			g.MeanLogDataRatio = g.logDataRatio / float64(g.ratios)
+		}
+		out = append(out, g.Group)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out, nil
+}
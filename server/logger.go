@@ -9,9 +9,8 @@ import (
 	"go.uber.org/zap/zapcore"
 )
 
-func setupLogger() (*zap.Logger, error) {
+func setupLogger(logsDir string) (*zap.Logger, error) {
 	// Create logs directory if it doesn't exist
-	logsDir := "logs"
 	if err := os.MkdirAll(logsDir, 0755); err != nil {
 		return nil, err
 	}
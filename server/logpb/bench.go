@@ -0,0 +1,376 @@
+package logpb
+
+import (
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Messages of bench.proto.
+
+type UserCharacterStorage struct {
+	UserID     string
+	Characters []*Character
+}
+
+type Character struct {
+	ID         string
+	Name       string
+	Level      int32
+	Experience int32
+	Stats      *Stats
+	Inventory  []*Item
+	Skills     []*Skill
+	Equipment  *Equipment
+	Quests     []*Quest
+	Metadata   *Metadata
+}
+
+type Stats struct {
+	Health   int32
+	Mana     int32
+	Strength int32
+	Defense  int32
+	Agility  int32
+	Magic    int32
+}
+
+type Item struct {
+	ID       string
+	Name     string
+	Type     string
+	Quantity int32
+	Rarity   string
+}
+
+type Skill struct {
+	ID       string
+	Name     string
+	Level    int32
+	Cooldown int32
+}
+
+type Equipment struct {
+	Weapon    string
+	Armor     string
+	Accessory string
+}
+
+type Quest struct {
+	ID       string
+	Name     string
+	Progress int32
+	Status   string
+}
+
+type Metadata struct {
+	CreatedAt    string
+	LastModified string
+	PlayTime     int32
+}
+
+type SimpleRecord struct {
+	ID       int64
+	Name     string
+	Email    string
+	Active   bool
+	Score    float64
+	Tags     []string
+	Settings map[string]string
+}
+
+func appendDouble(b []byte, num protowire.Number, v float64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, math.Float64bits(v))
+}
+
+func consumeDouble(typ protowire.Type, b []byte, dst *float64) int {
+	if typ != protowire.Fixed64Type {
+		return errWireType
+	}
+	v, n := protowire.ConsumeFixed64(b)
+	if n >= 0 {
+		*dst = math.Float64frombits(v)
+	}
+	return n
+}
+
+func (m *UserCharacterStorage) Marshal() []byte {
+	b := appendString(nil, 1, m.UserID)
+	for _, c := range m.Characters {
+		b = appendMessage(b, 2, c)
+	}
+	return b
+}
+
+func (m *UserCharacterStorage) Unmarshal(b []byte) error {
+	*m = UserCharacterStorage{}
+	return unmarshal(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return consumeString(typ, b, &m.UserID)
+		case 2:
+			c := &Character{}
+			m.Characters = append(m.Characters, c)
+			return consumeMessage(typ, b, c)
+		}
+		return 0
+	})
+}
+
+func (m *Character) Marshal() []byte {
+	b := appendString(nil, 1, m.ID)
+	b = appendString(b, 2, m.Name)
+	b = appendVarint(b, 3, uint64(m.Level))
+	b = appendVarint(b, 4, uint64(m.Experience))
+	if m.Stats != nil {
+		b = appendMessage(b, 5, m.Stats)
+	}
+	for _, item := range m.Inventory {
+		b = appendMessage(b, 6, item)
+	}
+	for _, skill := range m.Skills {
+		b = appendMessage(b, 7, skill)
+	}
+	if m.Equipment != nil {
+		b = appendMessage(b, 8, m.Equipment)
+	}
+	for _, quest := range m.Quests {
+		b = appendMessage(b, 9, quest)
+	}
+	if m.Metadata != nil {
+		b = appendMessage(b, 10, m.Metadata)
+	}
+	return b
+}
+
+func (m *Character) Unmarshal(b []byte) error {
+	*m = Character{}
+	return unmarshal(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return consumeString(typ, b, &m.ID)
+		case 2:
+			return consumeString(typ, b, &m.Name)
+		case 3:
+			return consumeInt32(typ, b, &m.Level)
+		case 4:
+			return consumeInt32(typ, b, &m.Experience)
+		case 5:
+			m.Stats = &Stats{}
+			return consumeMessage(typ, b, m.Stats)
+		case 6:
+			item := &Item{}
+			m.Inventory = append(m.Inventory, item)
+			return consumeMessage(typ, b, item)
+		case 7:
+			skill := &Skill{}
+			m.Skills = append(m.Skills, skill)
+			return consumeMessage(typ, b, skill)
+		case 8:
+			m.Equipment = &Equipment{}
+			return consumeMessage(typ, b, m.Equipment)
+		case 9:
+			quest := &Quest{}
+			m.Quests = append(m.Quests, quest)
+			return consumeMessage(typ, b, quest)
+		case 10:
+			m.Metadata = &Metadata{}
+			return consumeMessage(typ, b, m.Metadata)
+		}
+		return 0
+	})
+}
+
+func (m *Stats) Marshal() []byte {
+	b := appendVarint(nil, 1, uint64(m.Health))
+	b = appendVarint(b, 2, uint64(m.Mana))
+	b = appendVarint(b, 3, uint64(m.Strength))
+	b = appendVarint(b, 4, uint64(m.Defense))
+	b = appendVarint(b, 5, uint64(m.Agility))
+	return appendVarint(b, 6, uint64(m.Magic))
+}
+
+func (m *Stats) Unmarshal(b []byte) error {
+	*m = Stats{}
+	return unmarshal(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return consumeInt32(typ, b, &m.Health)
+		case 2:
+			return consumeInt32(typ, b, &m.Mana)
+		case 3:
+			return consumeInt32(typ, b, &m.Strength)
+		case 4:
+			return consumeInt32(typ, b, &m.Defense)
+		case 5:
+			return consumeInt32(typ, b, &m.Agility)
+		case 6:
+			return consumeInt32(typ, b, &m.Magic)
+		}
+		return 0
+	})
+}
+
+func (m *Item) Marshal() []byte {
+	b := appendString(nil, 1, m.ID)
+	b = appendString(b, 2, m.Name)
+	b = appendString(b, 3, m.Type)
+	b = appendVarint(b, 4, uint64(m.Quantity))
+	return appendString(b, 5, m.Rarity)
+}
+
+func (m *Item) Unmarshal(b []byte) error {
+	*m = Item{}
+	return unmarshal(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return consumeString(typ, b, &m.ID)
+		case 2:
+			return consumeString(typ, b, &m.Name)
+		case 3:
+			return consumeString(typ, b, &m.Type)
+		case 4:
+			return consumeInt32(typ, b, &m.Quantity)
+		case 5:
+			return consumeString(typ, b, &m.Rarity)
+		}
+		return 0
+	})
+}
+
+func (m *Skill) Marshal() []byte {
+	b := appendString(nil, 1, m.ID)
+	b = appendString(b, 2, m.Name)
+	b = appendVarint(b, 3, uint64(m.Level))
+	return appendVarint(b, 4, uint64(m.Cooldown))
+}
+
+func (m *Skill) Unmarshal(b []byte) error {
+	*m = Skill{}
+	return unmarshal(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return consumeString(typ, b, &m.ID)
+		case 2:
+			return consumeString(typ, b, &m.Name)
+		case 3:
+			return consumeInt32(typ, b, &m.Level)
+		case 4:
+			return consumeInt32(typ, b, &m.Cooldown)
+		}
+		return 0
+	})
+}
+
+func (m *Equipment) Marshal() []byte {
+	b := appendString(nil, 1, m.Weapon)
+	b = appendString(b, 2, m.Armor)
+	return appendString(b, 3, m.Accessory)
+}
+
+func (m *Equipment) Unmarshal(b []byte) error {
+	*m = Equipment{}
+	return unmarshal(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return consumeString(typ, b, &m.Weapon)
+		case 2:
+			return consumeString(typ, b, &m.Armor)
+		case 3:
+			return consumeString(typ, b, &m.Accessory)
+		}
+		return 0
+	})
+}
+
+func (m *Quest) Marshal() []byte {
+	b := appendString(nil, 1, m.ID)
+	b = appendString(b, 2, m.Name)
+	b = appendVarint(b, 3, uint64(m.Progress))
+	return appendString(b, 4, m.Status)
+}
+
+func (m *Quest) Unmarshal(b []byte) error {
+	*m = Quest{}
+	return unmarshal(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return consumeString(typ, b, &m.ID)
+		case 2:
+			return consumeString(typ, b, &m.Name)
+		case 3:
+			return consumeInt32(typ, b, &m.Progress)
+		case 4:
+			return consumeString(typ, b, &m.Status)
+		}
+		return 0
+	})
+}
+
+func (m *Metadata) Marshal() []byte {
+	b := appendString(nil, 1, m.CreatedAt)
+	b = appendString(b, 2, m.LastModified)
+	return appendVarint(b, 3, uint64(m.PlayTime))
+}
+
+func (m *Metadata) Unmarshal(b []byte) error {
+	*m = Metadata{}
+	return unmarshal(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return consumeString(typ, b, &m.CreatedAt)
+		case 2:
+			return consumeString(typ, b, &m.LastModified)
+		case 3:
+			return consumeInt32(typ, b, &m.PlayTime)
+		}
+		return 0
+	})
+}
+
+func (m *SimpleRecord) Marshal() []byte {
+	b := appendVarint(nil, 1, uint64(m.ID))
+	b = appendString(b, 2, m.Name)
+	b = appendString(b, 3, m.Email)
+	b = appendVarint(b, 4, protowire.EncodeBool(m.Active))
+	b = appendDouble(b, 5, m.Score)
+	for _, tag := range m.Tags {
+		// Repeated elements are written even when empty.
+		b = protowire.AppendTag(b, 6, protowire.BytesType)
+		b = protowire.AppendString(b, tag)
+	}
+	return appendMap(b, 7, m.Settings)
+}
+
+func (m *SimpleRecord) Unmarshal(b []byte) error {
+	*m = SimpleRecord{}
+	return unmarshal(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return consumeInt64(typ, b, &m.ID)
+		case 2:
+			return consumeString(typ, b, &m.Name)
+		case 3:
+			return consumeString(typ, b, &m.Email)
+		case 4:
+			var v uint64
+			n := consumeVarint(typ, b, &v)
+			m.Active = protowire.DecodeBool(v)
+			return n
+		case 5:
+			return consumeDouble(typ, b, &m.Score)
+		case 6:
+			var tag string
+			n := consumeString(typ, b, &tag)
+			m.Tags = append(m.Tags, tag)
+			return n
+		case 7:
+			return consumeMapEntry(typ, b, &m.Settings)
+		}
+		return 0
+	})
+}
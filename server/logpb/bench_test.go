@@ -0,0 +1,46 @@
+package logpb
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestBenchRoundTrip(t *testing.T) {
+	storage := &UserCharacterStorage{
+		UserID: "u1",
+		Characters: []*Character{{
+			ID:         "c1",
+			Name:       "ann",
+			Level:      7,
+			Experience: -1,
+			Stats:      &Stats{Health: 100, Magic: 3},
+			Inventory:  []*Item{{ID: "i1", Type: "weapon", Quantity: 2}, {}},
+			Skills:     []*Skill{{Name: "dash", Cooldown: 30}},
+			Equipment:  &Equipment{Weapon: "sword"},
+			Quests:     []*Quest{{ID: "q1", Progress: 50, Status: "active"}},
+			Metadata:   &Metadata{CreatedAt: "2024-01-01 00:00:00", PlayTime: 90},
+		}, {Name: "bob"}},
+	}
+	var gotStorage UserCharacterStorage
+	if err := gotStorage.Unmarshal(storage.Marshal()); err != nil {
+		t.Fatalf("Failed to unmarshal UserCharacterStorage: %v", err)
+	}
+	if !reflect.DeepEqual(&gotStorage, storage) {
+		t.Errorf("UserCharacterStorage mismatch:\n got %+v\nwant %+v", gotStorage, storage)
+	}
+
+	record := &SimpleRecord{ID: 1000, Name: "User_0", Active: true, Score: 60.5, Tags: []string{"tag_0", ""}, Settings: map[string]string{"theme": "dark"}}
+	var gotRecord SimpleRecord
+	if err := gotRecord.Unmarshal(record.Marshal()); err != nil {
+		t.Fatalf("Failed to unmarshal SimpleRecord: %v", err)
+	}
+	if !reflect.DeepEqual(&gotRecord, record) {
+		t.Errorf("SimpleRecord mismatch:\n got %+v\nwant %+v", gotRecord, record)
+	}
+
+	// A double is field 5, wire type 1, then 8 little-endian bytes.
+	if got, want := (&SimpleRecord{Score: 1}).Marshal(), []byte{0x29, 0, 0, 0, 0, 0, 0, 0xf0, 0x3f}; !bytes.Equal(got, want) {
+		t.Errorf("SimpleRecord = %x, want %x", got, want)
+	}
+}
@@ -0,0 +1,552 @@
+// Package logpb holds the messages of LogService (log_service.proto), and
+// of the serialization benchmarks (bench.proto), with hand-written
+// protobuf codecs built on protowire. They follow the proto3
+// wire format, so clients generated from the .proto interoperate, without
+// the server needing a protoc toolchain. Fields are written in number order
+// and zero values are omitted; unknown fields are skipped when decoding.
+package logpb
+
+import (
+	"fmt"
+	"sort"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Message is implemented by every LogService message.
+type Message interface {
+	Marshal() []byte
+	Unmarshal(b []byte) error
+}
+
+type PingRequest struct {
+	Data string
+}
+
+type PingResponse struct {
+	Status    string
+	Timestamp int64
+	Message   string
+	Echo      string
+}
+
+type LogBody struct {
+	Timestamp  int64
+	Logtype    string
+	Version    string
+	Issuer     string
+	Metadata   map[string]string
+	DomainData map[string]string
+}
+
+type LogRequest struct {
+	ProjectName    string
+	ProjectVersion string
+	LogLevel       string
+	LogType        string
+	LogSource      string
+	Body           *LogBody
+}
+
+type CompressionStats struct {
+	OriginalJSONSize    int64
+	ProtobufSize        int64
+	WrapperAvroSize     int64
+	LogDataAvroSize     int64
+	WrapperJSONSize     int64
+	WrapperCompression  string
+	LogDataCompression  string
+	ProtobufCompression string
+}
+
+type LogResponse struct {
+	Status           string
+	ID               string
+	CompressionStats *CompressionStats
+}
+
+type LogBatchRequest struct {
+	Logs []*LogRequest
+}
+
+type LogResult struct {
+	Code  int32
+	Error string
+	Log   *LogResponse
+}
+
+type LogBatchResponse struct {
+	Results []*LogResult
+	Logged  int32
+	Failed  int32
+}
+
+type DecodeRequest struct {
+	Schema      string
+	Version     int32
+	Data        []byte
+	StripUnions bool
+}
+
+type DecodeResponse struct {
+	Schema     string
+	Version    int32
+	RecordJSON string
+}
+
+// Encoding helpers. Each skips the zero value, as proto3 does.
+
+func appendString(b []byte, num protowire.Number, v string) []byte {
+	if v == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
+
+func appendBytes(b []byte, num protowire.Number, v []byte) []byte {
+	if len(v) == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+func appendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+// appendMessage writes a set submessage, even an empty one.
+func appendMessage(b []byte, num protowire.Number, m Message) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, m.Marshal())
+}
+
+// appendMap writes a map<string, string> as entries sorted by key, so equal
+// maps encode identically.
+func appendMap(b []byte, num protowire.Number, m map[string]string) []byte {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		var entry []byte
+		entry = appendString(entry, 1, k)
+		entry = appendString(entry, 2, m[k])
+		b = protowire.AppendTag(b, num, protowire.BytesType)
+		b = protowire.AppendBytes(b, entry)
+	}
+	return b
+}
+
+// Decoding helpers. A field function consumes the value of one field and
+// returns its length, a negative protowire error code, one of the codes
+// below, or 0 for a field it does not know, which is then skipped.
+const (
+	errWireType = -100
+	// errInvalid reports a submessage or map entry that failed to decode.
+	errInvalid = -101
+)
+
+type fieldFunc func(num protowire.Number, typ protowire.Type, b []byte) int
+
+func unmarshal(b []byte, field fieldFunc) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		n = field(num, typ, b)
+		if n == 0 {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		switch n {
+		case errWireType:
+			return fmt.Errorf("logpb: field %d has unexpected wire type %d", num, typ)
+		case errInvalid:
+			return fmt.Errorf("logpb: field %d is not a valid message", num)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+func consumeString(typ protowire.Type, b []byte, dst *string) int {
+	if typ != protowire.BytesType {
+		return errWireType
+	}
+	v, n := protowire.ConsumeString(b)
+	if n >= 0 {
+		*dst = v
+	}
+	return n
+}
+
+func consumeBytes(typ protowire.Type, b []byte, dst *[]byte) int {
+	if typ != protowire.BytesType {
+		return errWireType
+	}
+	v, n := protowire.ConsumeBytes(b)
+	if n >= 0 {
+		*dst = append([]byte(nil), v...)
+	}
+	return n
+}
+
+func consumeVarint(typ protowire.Type, b []byte, dst *uint64) int {
+	if typ != protowire.VarintType {
+		return errWireType
+	}
+	v, n := protowire.ConsumeVarint(b)
+	if n >= 0 {
+		*dst = v
+	}
+	return n
+}
+
+func consumeInt64(typ protowire.Type, b []byte, dst *int64) int {
+	var v uint64
+	n := consumeVarint(typ, b, &v)
+	*dst = int64(v)
+	return n
+}
+
+func consumeInt32(typ protowire.Type, b []byte, dst *int32) int {
+	var v uint64
+	n := consumeVarint(typ, b, &v)
+	*dst = int32(v)
+	return n
+}
+
+func consumeMessage(typ protowire.Type, b []byte, m Message) int {
+	if typ != protowire.BytesType {
+		return errWireType
+	}
+	v, n := protowire.ConsumeBytes(b)
+	if n < 0 {
+		return n
+	}
+	if err := m.Unmarshal(v); err != nil {
+		return errInvalid
+	}
+	return n
+}
+
+func consumeMapEntry(typ protowire.Type, b []byte, dst *map[string]string) int {
+	if typ != protowire.BytesType {
+		return errWireType
+	}
+	v, n := protowire.ConsumeBytes(b)
+	if n < 0 {
+		return n
+	}
+	var key, value string
+	err := unmarshal(v, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return consumeString(typ, b, &key)
+		case 2:
+			return consumeString(typ, b, &value)
+		}
+		return 0
+	})
+	if err != nil {
+		return errInvalid
+	}
+	if *dst == nil {
+		*dst = make(map[string]string)
+	}
+	(*dst)[key] = value
+	return n
+}
+
+func (m *PingRequest) Marshal() []byte {
+	return appendString(nil, 1, m.Data)
+}
+
+func (m *PingRequest) Unmarshal(b []byte) error {
+	*m = PingRequest{}
+	return unmarshal(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		if num == 1 {
+			return consumeString(typ, b, &m.Data)
+		}
+		return 0
+	})
+}
+
+func (m *PingResponse) Marshal() []byte {
+	b := appendString(nil, 1, m.Status)
+	b = appendVarint(b, 2, uint64(m.Timestamp))
+	b = appendString(b, 3, m.Message)
+	return appendString(b, 4, m.Echo)
+}
+
+func (m *PingResponse) Unmarshal(b []byte) error {
+	*m = PingResponse{}
+	return unmarshal(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return consumeString(typ, b, &m.Status)
+		case 2:
+			return consumeInt64(typ, b, &m.Timestamp)
+		case 3:
+			return consumeString(typ, b, &m.Message)
+		case 4:
+			return consumeString(typ, b, &m.Echo)
+		}
+		return 0
+	})
+}
+
+func (m *LogBody) Marshal() []byte {
+	b := appendVarint(nil, 1, uint64(m.Timestamp))
+	b = appendString(b, 2, m.Logtype)
+	b = appendString(b, 3, m.Version)
+	b = appendString(b, 4, m.Issuer)
+	b = appendMap(b, 5, m.Metadata)
+	return appendMap(b, 6, m.DomainData)
+}
+
+func (m *LogBody) Unmarshal(b []byte) error {
+	*m = LogBody{}
+	return unmarshal(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return consumeInt64(typ, b, &m.Timestamp)
+		case 2:
+			return consumeString(typ, b, &m.Logtype)
+		case 3:
+			return consumeString(typ, b, &m.Version)
+		case 4:
+			return consumeString(typ, b, &m.Issuer)
+		case 5:
+			return consumeMapEntry(typ, b, &m.Metadata)
+		case 6:
+			return consumeMapEntry(typ, b, &m.DomainData)
+		}
+		return 0
+	})
+}
+
+func (m *LogRequest) Marshal() []byte {
+	b := appendString(nil, 1, m.ProjectName)
+	b = appendString(b, 2, m.ProjectVersion)
+	b = appendString(b, 3, m.LogLevel)
+	b = appendString(b, 4, m.LogType)
+	b = appendString(b, 5, m.LogSource)
+	if m.Body != nil {
+		b = appendMessage(b, 6, m.Body)
+	}
+	return b
+}
+
+func (m *LogRequest) Unmarshal(b []byte) error {
+	*m = LogRequest{}
+	return unmarshal(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return consumeString(typ, b, &m.ProjectName)
+		case 2:
+			return consumeString(typ, b, &m.ProjectVersion)
+		case 3:
+			return consumeString(typ, b, &m.LogLevel)
+		case 4:
+			return consumeString(typ, b, &m.LogType)
+		case 5:
+			return consumeString(typ, b, &m.LogSource)
+		case 6:
+			m.Body = &LogBody{}
+			return consumeMessage(typ, b, m.Body)
+		}
+		return 0
+	})
+}
+
+func (m *CompressionStats) Marshal() []byte {
+	b := appendVarint(nil, 1, uint64(m.OriginalJSONSize))
+	b = appendVarint(b, 2, uint64(m.ProtobufSize))
+	b = appendVarint(b, 3, uint64(m.WrapperAvroSize))
+	b = appendVarint(b, 4, uint64(m.LogDataAvroSize))
+	b = appendVarint(b, 5, uint64(m.WrapperJSONSize))
+	b = appendString(b, 6, m.WrapperCompression)
+	b = appendString(b, 7, m.LogDataCompression)
+	return appendString(b, 8, m.ProtobufCompression)
+}
+
+func (m *CompressionStats) Unmarshal(b []byte) error {
+	*m = CompressionStats{}
+	return unmarshal(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return consumeInt64(typ, b, &m.OriginalJSONSize)
+		case 2:
+			return consumeInt64(typ, b, &m.ProtobufSize)
+		case 3:
+			return consumeInt64(typ, b, &m.WrapperAvroSize)
+		case 4:
+			return consumeInt64(typ, b, &m.LogDataAvroSize)
+		case 5:
+			return consumeInt64(typ, b, &m.WrapperJSONSize)
+		case 6:
+			return consumeString(typ, b, &m.WrapperCompression)
+		case 7:
+			return consumeString(typ, b, &m.LogDataCompression)
+		case 8:
+			return consumeString(typ, b, &m.ProtobufCompression)
+		}
+		return 0
+	})
+}
+
+func (m *LogResponse) Marshal() []byte {
+	b := appendString(nil, 1, m.Status)
+	b = appendString(b, 2, m.ID)
+	if m.CompressionStats != nil {
+		b = appendMessage(b, 3, m.CompressionStats)
+	}
+	return b
+}
+
+func (m *LogResponse) Unmarshal(b []byte) error {
+	*m = LogResponse{}
+	return unmarshal(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return consumeString(typ, b, &m.Status)
+		case 2:
+			return consumeString(typ, b, &m.ID)
+		case 3:
+			m.CompressionStats = &CompressionStats{}
+			return consumeMessage(typ, b, m.CompressionStats)
+		}
+		return 0
+	})
+}
+
+func (m *LogBatchRequest) Marshal() []byte {
+	var b []byte
+	for _, log := range m.Logs {
+		b = appendMessage(b, 1, log)
+	}
+	return b
+}
+
+func (m *LogBatchRequest) Unmarshal(b []byte) error {
+	*m = LogBatchRequest{}
+	return unmarshal(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		if num == 1 {
+			log := &LogRequest{}
+			m.Logs = append(m.Logs, log)
+			return consumeMessage(typ, b, log)
+		}
+		return 0
+	})
+}
+
+func (m *LogResult) Marshal() []byte {
+	b := appendVarint(nil, 1, uint64(m.Code))
+	b = appendString(b, 2, m.Error)
+	if m.Log != nil {
+		b = appendMessage(b, 3, m.Log)
+	}
+	return b
+}
+
+func (m *LogResult) Unmarshal(b []byte) error {
+	*m = LogResult{}
+	return unmarshal(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return consumeInt32(typ, b, &m.Code)
+		case 2:
+			return consumeString(typ, b, &m.Error)
+		case 3:
+			m.Log = &LogResponse{}
+			return consumeMessage(typ, b, m.Log)
+		}
+		return 0
+	})
+}
+
+func (m *LogBatchResponse) Marshal() []byte {
+	var b []byte
+	for _, r := range m.Results {
+		b = appendMessage(b, 1, r)
+	}
+	b = appendVarint(b, 2, uint64(m.Logged))
+	return appendVarint(b, 3, uint64(m.Failed))
+}
+
+func (m *LogBatchResponse) Unmarshal(b []byte) error {
+	*m = LogBatchResponse{}
+	return unmarshal(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			r := &LogResult{}
+			m.Results = append(m.Results, r)
+			return consumeMessage(typ, b, r)
+		case 2:
+			return consumeInt32(typ, b, &m.Logged)
+		case 3:
+			return consumeInt32(typ, b, &m.Failed)
+		}
+		return 0
+	})
+}
+
+func (m *DecodeRequest) Marshal() []byte {
+	b := appendString(nil, 1, m.Schema)
+	b = appendVarint(b, 2, uint64(m.Version))
+	b = appendBytes(b, 3, m.Data)
+	return appendVarint(b, 4, protowire.EncodeBool(m.StripUnions))
+}
+
+func (m *DecodeRequest) Unmarshal(b []byte) error {
+	*m = DecodeRequest{}
+	return unmarshal(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return consumeString(typ, b, &m.Schema)
+		case 2:
+			return consumeInt32(typ, b, &m.Version)
+		case 3:
+			return consumeBytes(typ, b, &m.Data)
+		case 4:
+			var v uint64
+			n := consumeVarint(typ, b, &v)
+			m.StripUnions = protowire.DecodeBool(v)
+			return n
+		}
+		return 0
+	})
+}
+
+func (m *DecodeResponse) Marshal() []byte {
+	b := appendString(nil, 1, m.Schema)
+	b = appendVarint(b, 2, uint64(m.Version))
+	return appendString(b, 3, m.RecordJSON)
+}
+
+func (m *DecodeResponse) Unmarshal(b []byte) error {
+	*m = DecodeResponse{}
+	return unmarshal(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return consumeString(typ, b, &m.Schema)
+		case 2:
+			return consumeInt32(typ, b, &m.Version)
+		case 3:
+			return consumeString(typ, b, &m.RecordJSON)
+		}
+		return 0
+	})
+}
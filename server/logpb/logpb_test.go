@@ -0,0 +1,97 @@
+package logpb
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestWireFormat(t *testing.T) {
+	// Field 1, length-delimited "hi"; field 2 varint 150 (the protobuf
+	// documentation's example).
+	ping := (&PingRequest{Data: "hi"}).Marshal()
+	if want := []byte{0x0a, 0x02, 'h', 'i'}; !bytes.Equal(ping, want) {
+		t.Errorf("PingRequest = %x, want %x", ping, want)
+	}
+	decode := (&DecodeRequest{Version: 150}).Marshal()
+	if want := []byte{0x10, 0x96, 0x01}; !bytes.Equal(decode, want) {
+		t.Errorf("DecodeRequest = %x, want %x", decode, want)
+	}
+	if got := (&LogResponse{}).Marshal(); len(got) != 0 {
+		t.Errorf("expected zero values to be omitted, got %x", got)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	log := &LogRequest{
+		ProjectName:    "game",
+		ProjectVersion: "1.0",
+		LogLevel:       "info",
+		LogType:        "t",
+		LogSource:      "s",
+		Body: &LogBody{
+			Timestamp:  1700000000000,
+			Logtype:    "t",
+			Version:    "1",
+			Issuer:     "i",
+			Metadata:   map[string]string{"b": "2", "a": "1"},
+			DomainData: map[string]string{"": "empty key"},
+		},
+	}
+	var gotLog LogRequest
+	if err := gotLog.Unmarshal(log.Marshal()); err != nil {
+		t.Fatalf("Failed to unmarshal LogRequest: %v", err)
+	}
+	if !reflect.DeepEqual(&gotLog, log) {
+		t.Errorf("LogRequest mismatch:\n got %+v\nwant %+v", gotLog, log)
+	}
+
+	batch := &LogBatchResponse{
+		Results: []*LogResult{
+			{Log: &LogResponse{Status: "logged", ID: "x", CompressionStats: &CompressionStats{OriginalJSONSize: 200, ProtobufSize: 80, WrapperCompression: "40.00%"}}},
+			{Code: 3, Error: "bad"},
+		},
+		Logged: 1,
+		Failed: 1,
+	}
+	var gotBatch LogBatchResponse
+	if err := gotBatch.Unmarshal(batch.Marshal()); err != nil {
+		t.Fatalf("Failed to unmarshal LogBatchResponse: %v", err)
+	}
+	if !reflect.DeepEqual(&gotBatch, batch) {
+		t.Errorf("LogBatchResponse mismatch:\n got %+v\nwant %+v", gotBatch, batch)
+	}
+
+	decode := &DecodeRequest{Schema: "LogData", Version: -1, Data: []byte{0, 1}, StripUnions: true}
+	var gotDecode DecodeRequest
+	if err := gotDecode.Unmarshal(decode.Marshal()); err != nil || !reflect.DeepEqual(&gotDecode, decode) {
+		t.Errorf("DecodeRequest mismatch: got %+v, %v", gotDecode, err)
+	}
+}
+
+func TestUnmarshalSkipsUnknownFields(t *testing.T) {
+	b := protowire.AppendTag(nil, 99, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, 7)
+	b = append(b, (&PingRequest{Data: "kept"}).Marshal()...)
+	var req PingRequest
+	if err := req.Unmarshal(b); err != nil || req.Data != "kept" {
+		t.Errorf("expected the unknown field to be skipped, got %+v, %v", req, err)
+	}
+}
+
+func TestUnmarshalRejectsMalformedInput(t *testing.T) {
+	var req LogRequest
+	if err := req.Unmarshal([]byte{0x0a, 0x05, 'a'}); err == nil {
+		t.Error("expected a truncated string to be rejected")
+	}
+	// project_name sent as a varint.
+	if err := req.Unmarshal([]byte{0x08, 0x01}); err == nil {
+		t.Error("expected a wrong wire type to be rejected")
+	}
+	// A body whose timestamp is truncated.
+	if err := req.Unmarshal([]byte{0x32, 0x01, 0x08}); err == nil {
+		t.Error("expected a malformed submessage to be rejected")
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/homveloper/exp-avro-json/server/registry"
+)
+
+// A /log body can have a schema of its own per logType, so the domain
+// fields of e.g. USER_ACTION logs are encoded as a typed record rather than
+// the string map of the generic LogData. The latest version registered
+// under the subject LogData.<logType> encodes the bodies of JSON /log
+// requests with that logType whose project has no schema of its own; other
+// logTypes keep the built-in LogData. Such a schema follows the same rules
+// as project schemas (see project_schemas.go).
+//
+// A logType containing a dot, or named project or inferred, would share its
+// subject with another body schema (LogData.project.<projectName>,
+// LogData.<logType>.inferred or LogData.inferred), so it has no schema of
+// its own and is never inferred: its bodies keep the built-in LogData.
+
+// logTypeHasSubject reports whether logType names a body schema subject
+// of its own.
+func logTypeHasSubject(logType string) bool {
+	return logType != "" && !strings.Contains(logType, ".") && logType != "project" && logType != "inferred"
+}
+
+// logTypeSubject names the registry subject of logType's body schema.
+func logTypeSubject(logType string) string {
+	return bodySubject + "." + logType
+}
+
+// logTypeSchema returns the latest body schema registered for logType.
+func logTypeSchema(logType string) (registry.Schema, bool) {
+	if schemaRegistry == nil || !logTypeHasSubject(logType) {
+		return registry.Schema{}, false
+	}
+	s, err := resolveSchema(logTypeSubject(logType), 0)
+	return s, err == nil
+}
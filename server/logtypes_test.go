@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+)
+
+func TestLogTypeBodySchemas(t *testing.T) {
+	r := newSchemaTestEngine(t)
+	r.POST("/log", logHandler)
+
+	typed := userActionSchema(t)
+	if w := doJSON(r, http.MethodPost, "/schemas", gin.H{"name": logTypeSubject("USER_ACTION"), "schema": typed}); w.Code != http.StatusCreated {
+		t.Fatalf("Failed to register USER_ACTION schema: %d %s", w.Code, w.Body.String())
+	}
+
+	good := userActionRequest(map[string]interface{}{"login_method": "password", "success": true, "duration_ms": 42})
+	encoded, err := encodeLogRequest(good)
+	if err != nil {
+		t.Fatalf("Failed to encode USER_ACTION log: %v", err)
+	}
+	if encoded.LogDataSchema != typed {
+		t.Errorf("expected the USER_ACTION schema to encode the body, got %s", encoded.LogDataSchema)
+	}
+	if w := doJSON(r, http.MethodPost, "/log", good); w.Code != http.StatusOK {
+		t.Errorf("expected a typed body to be accepted, got %d: %s", w.Code, w.Body.String())
+	}
+
+	for name, domain := range map[string]map[string]interface{}{
+		"wrong type":    {"login_method": "password", "success": "yes", "duration_ms": 42},
+		"unknown field": {"login_method": "password", "success": true, "duration_ms": 42, "device": "mobile"},
+	} {
+		w := doJSON(r, http.MethodPost, "/log", userActionRequest(domain))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d: %s", name, w.Code, w.Body.String())
+			continue
+		}
+		var resp struct {
+			Code   string `json:"code"`
+			Field  string `json:"field"`
+			Schema string `json:"schema"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if resp.Code != codeValidationFailed || !strings.HasPrefix(resp.Field, "body.domainData.") || resp.Schema != "LogData.USER_ACTION" {
+			t.Errorf("%s: unexpected error response %s", name, w.Body.String())
+		}
+	}
+
+	// Other logTypes keep the generic body.
+	encoded, err = encodeLogRequest(warmupPayload(1))
+	if err != nil {
+		t.Fatalf("Failed to encode warmup log: %v", err)
+	}
+	if encoded.LogDataSchema != avrojson.LogDataSchema {
+		t.Errorf("expected the built-in LogData schema for other logTypes, got %s", encoded.LogDataSchema)
+	}
+
+	// LogTypes that would share another body schema's subject have none.
+	if w := doJSON(r, http.MethodPost, "/schemas", gin.H{"name": "LogData.USER_ACTION.inferred", "schema": typed}); w.Code != http.StatusCreated {
+		t.Fatalf("Failed to register inferred schema: %d %s", w.Code, w.Body.String())
+	}
+	bodyTypes = bodyTypesInfer
+	defer func() { bodyTypes = bodyTypesStrings }()
+	for _, logType := range []string{"USER_ACTION.inferred", "project", "inferred"} {
+		req := warmupPayload(1)
+		req.LogType = logType
+		encoded, err := encodeLogRequest(req)
+		if err != nil {
+			t.Fatalf("%s: failed to encode log: %v", logType, err)
+		}
+		if encoded.LogDataSchema != avrojson.LogDataSchema {
+			t.Errorf("%s: expected the built-in LogData schema, got %s", logType, encoded.LogDataSchema)
+		}
+	}
+	if _, err := schemaRegistry.Subject("LogData.project.inferred"); err == nil {
+		t.Error("expected logType project not to infer a schema under a project's subject")
+	}
+}
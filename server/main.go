@@ -1,61 +1,28 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/linkedin/goavro/v2"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/homveloper/exp-avro-json/server/artifact"
+	"github.com/homveloper/exp-avro-json/server/ids"
+	"github.com/homveloper/exp-avro-json/server/ocf"
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+	"github.com/homveloper/exp-avro-json/server/s3"
 	"go.uber.org/zap"
 )
 
-// Avro schema structures
-type AvroLogWrapper struct {
-	ProjectName    string `avro:"projectName"`
-	ProjectVersion string `avro:"projectVersion"`
-	Body           string `avro:"body"`
-	LogLevel       string `avro:"logLevel"`
-	LogType        string `avro:"logType"`
-	LogSource      string `avro:"logSource"`
-}
-
-type AvroLogData struct {
-	Timestamp  int64       `avro:"timestamp"`
-	Logtype    string      `avro:"logtype"`
-	Version    string      `avro:"version"`
-	Issuer     string      `avro:"issuer"`
-	Metadata   interface{} `avro:"metadata"`
-	DomainData interface{} `avro:"domainData"`
-}
-
-var wrapperSchema = `{
-	"type": "record",
-	"name": "LogWrapper",
-	"fields": [
-		{"name": "projectName", "type": "string"},
-		{"name": "projectVersion", "type": "string"},
-		{"name": "body", "type": "string"},
-		{"name": "logLevel", "type": "string"},
-		{"name": "logType", "type": "string"},
-		{"name": "logSource", "type": "string"}
-	]
-}`
-
-var logDataSchema = `{
-	"type": "record",
-	"name": "LogData",
-	"fields": [
-		{"name": "timestamp", "type": "long"},
-		{"name": "logtype", "type": "string"},
-		{"name": "version", "type": "string"},
-		{"name": "issuer", "type": "string"},
-		{"name": "metadata", "type": ["null", {"type": "map", "values": "string"}], "default": null},
-		{"name": "domainData", "type": ["null", {"type": "map", "values": "string"}], "default": null}
-	]
-}`
-
 type LogRequest struct {
 	ProjectName    string  `json:"projectName" binding:"required"`
 	ProjectVersion string  `json:"projectVersion" binding:"required"`
@@ -88,19 +55,256 @@ type PingResponse struct {
 var logger *zap.Logger
 
 func main() {
+	addr := flag.String("addr", ":8080", "listen address for the HTTP API")
+	tcpAddr := flag.String("tcp-addr", "", "listen address for the framed TCP transport, such as :8081 (empty disables)")
+	udpAddr := flag.String("udp-addr", "", "listen address for the UDP datagram transport, such as :8082 (empty disables)")
+	var tlsOpts tlsOptions
+	flag.StringVar(&tlsOpts.CertFile, "tls-cert", "", "server certificate (PEM); enables TLS on the HTTP and TCP listeners")
+	flag.StringVar(&tlsOpts.KeyFile, "tls-key", "", "server private key (PEM)")
+	flag.StringVar(&tlsOpts.ClientCAFile, "tls-client-ca", "", "CA bundle used to verify client certificates; enables mutual TLS")
+	allowedSANs := flag.String("tls-allowed-sans", "", "comma-separated client certificate SANs to accept (requires -tls-client-ca)")
+	demo := flag.Bool("demo", false, "run producer, in-memory broker and decoding indexer in this process")
+	demoBuffer := flag.Int("demo-buffer", 1024, "queue size of the demo broker's consumer groups")
+	shardBackends := flag.String("shard-backends", "", "comma-separated instance URLs; run as a router that shards /log by projectName")
+	shardReplicas := flag.Int("shard-replicas", 128, "virtual nodes per backend on the consistent hash ring")
+	leaseFile := flag.String("lease-file", "", "shared lease file electing the instance that runs compaction and retention jobs")
+	leaseTTL := flag.Duration("lease-ttl", 15*time.Second, "how long a job leadership lease stays valid without renewal")
+	nodeID := flag.String("node-id", defaultNodeID(), "instance identifier used for job leadership")
+	idKind := flag.String("id-kind", ids.ULID, "ID generator for logs, imports and OCF files: ulid, ksuid or snowflake")
+	idNode := flag.Int("id-node", -1, "snowflake node number in [0, 1023] (default derived from -node-id)")
+	artifactDir := flag.String("artifact-dir", "avro-logs", "directory storing each log's encodings for GET /logs/:id/artifact (empty disables)")
+	featureList := flag.String("features", "", "comma-separated experimental feature flags enabled for every project: "+strings.Join(featureNames(), ", "))
+	featureFile := flag.String("feature-file", "", "JSON file of default and per-project feature flags, overriding -features")
+	tenantFile := flag.String("tenant-file", "", "JSON file of tenants (project, API keys, encryption key); enables multi-tenant mode with per-project, encrypted storage (empty disables)")
+	experimentFile := flag.String("experiment-file", "", "JSON file of A/B experiments comparing encoding strategies on /log traffic (empty disables)")
+	quotaFile := flag.String("quota-file", "", "JSON file of per-project daily event and byte quotas (empty disables)")
+	forecastInterval := flag.Duration("forecast-interval", time.Minute, "time between samples of storage growth, quota usage and free disk space for /stats/forecast (0 disables)")
+	forecastHorizon := flag.Duration("forecast-horizon", 24*time.Hour, "how far ahead a forecast quota or disk exhaustion counts as at risk and alerts")
+	forecastDiskDir := flag.String("forecast-disk-dir", "avro-logs", "directory whose file system's free space is forecast (empty disables the disk forecast)")
+	forecastWebhook := flag.String("forecast-webhook", "", "URL POSTed a JSON alert when a quota or the disk is forecast to run out within -forecast-horizon")
+	replicateTo := flag.String("replicate-to", "", "URL of a standby instance receiving the completed files of -replicate-dir (empty disables)")
+	replicateDir := flag.String("replicate-dir", "avro-logs", "storage directory shipped to the -replicate-to standby, or received into with -standby")
+	replicateInterval := flag.Duration("replicate-interval", 30*time.Second, "time between syncs of -replicate-dir to the standby")
+	replicateToken := flag.String("replicate-token", "", "bearer token the primary sends and the standby requires on its replication endpoints")
+	standbyMode := flag.Bool("standby", false, "accept the files of a primary's -replicate-to into -replicate-dir")
+	filterFlush := flag.Duration("filter-flush", 30*time.Second, "how often the artifact store's Bloom filters are written to disk")
+	var retention artifact.Retention
+	flag.DurationVar(&retention.MaxAge, "artifact-max-age", 0, "remove stored log artifacts older than this (0 keeps them)")
+	flag.Int64Var(&retention.MaxLogs, "artifact-max-logs", 0, "keep at most this many logs' artifacts, removing the oldest (0 disables the limit)")
+	flag.Int64Var(&retention.MaxBytes, "artifact-max-bytes", 0, "keep at most this many bytes of artifact blobs, removing the oldest logs (0 disables the limit)")
+	retentionInterval := flag.Duration("artifact-retention-interval", 10*time.Minute, "how often the artifact retention limits are applied")
+	ocfDir := flag.String("ocf-dir", "avro-logs/ocf", "directory receiving every log as Avro Object Container Files (empty disables)")
+	var ocfOpts ocfTuning
+	flag.IntVar(&ocfOpts.MaxRecords, "ocf-max-records", 10000, "records per OCF file before rolling over to a new one (0 never rolls)")
+	flag.StringVar(&ocfOpts.Compression, "ocf-compression", ocf.CompressionNull, "OCF block codec (null, deflate or snappy), optionally with per-stream overrides such as deflate,wrapper=snappy")
+	flag.IntVar(&ocfOpts.BlockRecords, "ocf-block-records", 0, "records per OCF block; 0 or 1 writes every log as its own block unless -ocf-sync-interval is set")
+	flag.IntVar(&ocfOpts.SyncInterval, "ocf-sync-interval", 0, "uncompressed bytes per OCF block, as in Avro's DataFileWriter (0 disables)")
+	ocfFlushInterval := flag.Duration("ocf-flush-interval", time.Second, "longest a log waits in a partly filled OCF block before it is written; buffered logs are lost if the process is killed")
+	flag.IntVar(&exportWorkers, "export-workers", exportWorkers, "goroutines decoding OCF blocks in parallel for /logs/export (1 reads sequentially)")
+	dbPath := flag.String("db-path", "", "embedded database file receiving every log's encodings and compression stats for /stats/compression (empty disables)")
+	var s3Opts s3SinkOptions
+	flag.StringVar(&s3Opts.Bucket, "s3-bucket", "", "S3 bucket receiving every log as OCF files (empty disables; credentials from AWS_* variables)")
+	flag.StringVar(&s3Opts.Endpoint, "s3-endpoint", "", "S3-compatible endpoint URL (default AWS for -s3-region)")
+	flag.StringVar(&s3Opts.Region, "s3-region", "", "S3 region used for signing (default $AWS_REGION, then us-east-1)")
+	flag.StringVar(&s3Opts.Prefix, "s3-prefix", "avro-logs", "key prefix of uploaded OCF files")
+	flag.BoolVar(&s3Opts.PathStyle, "s3-path-style", false, "address the bucket in the path instead of the host name (MinIO and most self-hosted stores)")
+	flag.Int64Var(&s3Opts.PartSize, "s3-part-size", s3.DefaultPartSize, "files larger than this are sent as multipart uploads of this part size (minimum 5 MiB)")
+	flag.IntVar(&s3Opts.Retries, "s3-retries", 3, "retries of each S3 request on throttling, server and network errors")
+	flag.StringVar(&s3Opts.Dir, "s3-spool-dir", "avro-logs/s3-spool", "directory holding the S3 sink's OCF files until they are uploaded")
+	flag.BoolVar(&s3Opts.KeepLocal, "s3-keep-local", false, "keep OCF files in -s3-spool-dir once uploaded")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 10*time.Second, "how long in-flight requests may run after SIGINT or SIGTERM before buffered logs are flushed and the server exits")
+	sinkQueueSize := flag.Int("sink-queue", 0, "logs buffered for a background goroutine writing the sinks, taking sink writes off the request path; a full queue blocks requests (0 writes synchronously)")
+	sinkBatch := flag.Int("sink-batch", 64, "most queued logs written to the sinks between fsyncs with -sink-queue")
+	sinkFsync := flag.String("sink-fsync", sinkFsyncNone, "when queued writes are committed to disk: none leaves it to the OS, batch syncs every batch, interval every -sink-fsync-interval")
+	sinkFsyncEvery := flag.Duration("sink-fsync-interval", time.Second, "time between fsyncs with -sink-fsync interval")
+	sinkConfig := flag.String("sink-config", "", "JSON file listing the log sinks (file, stdout, kafka, s3); replaces the -ocf-* and -s3-* sinks")
+	pluginConfig := flag.String("plugin-config", "", "JSON file listing the compiled-in plugins run as /log transform, filter and sink stages, in order")
+	schemaDir := flag.String("schema-dir", "schemas", "directory persisting the schema registry (empty keeps it in memory)")
+	projectSchemaDir := flag.String("project-schemas", "", "directory of <projectName>.avsc files registered at startup as the body schemas of those projects' /log requests")
+	traceCodec := flag.Bool("trace-codec", false, "log a span for every goavro call (stage, schema, duration, size, error)")
+	echoMode := flag.String("echo", defaultEcho.Mode, "how /log returns the Avro JSON encodings: full, truncate or omit")
+	echoMaxBytes := flag.Int("echo-max-bytes", defaultEcho.MaxBytes, "bytes of each Avro JSON encoding kept by -echo truncate")
+	warmup := flag.Int("warmup", 0, "synthetic requests sent through the full pipeline before listening (0 disables)")
+	warmupReset := flag.Bool("warmup-reset", true, "reset codec metrics after warm-up so /stats only covers measured traffic")
+	jsonNumbers := flag.String("json-numbers", string(avrojson.JSONNumbersExact), "how numbers in JSON requests are parsed: exact keeps integers as int64 so IDs above 2^53 survive, float64 is encoding/json's default")
+	nonFinite := flag.String("non-finite", string(avrojson.NonFiniteReject), "what happens to NaN and infinite float and double values, which Avro JSON cannot hold: reject, null (where the union allows it), clamp or string")
+	selfCheck := flag.Bool("self-check", true, "round-trip every registered schema and probe every sink at startup, exiting on failure")
+	flag.BoolVar(&recordRequestIDs, "request-id-metadata", recordRequestIDs, "store each log's "+requestIDHeader+" in its metadata under "+requestIDMetadataKey)
+	corsOrigins := flag.String("cors-origins", "*", "comma-separated origins allowed by CORS, or * for any")
+	logDir := flag.String("log-dir", "logs", "directory receiving app.log and error.log")
+	configFile := flag.String("config", "", "YAML file of flag settings, overridden by "+envPrefix+"* variables and command-line flags (default $"+envName("config")+")")
+	maxBodyBytes := flag.Int64("max-body-bytes", defaultMaxBodyBytes, "largest request body accepted, answered with 413 beyond it (0 disables)")
+	flag.DurationVar(&deadlineReserve, "deadline-reserve", 0, "skip optional /log stages (block stats, experiments) when less than this is left of a request's "+deadlineHeader+" budget (0 never skips)")
+	bodyTypesMode := flag.String("body-types", bodyTypesStrings, "how /log bodies without a project or logType schema store metadata and domainData: strings as the built-in LogData's string maps, infer as records typed from the values and registered under LogData.<logType>.inferred")
+	maxImportBytes := flag.Int64("max-import-bytes", defaultMaxImportBytes, "largest POST /logs/import upload (0 disables)")
+	maxReplicationBytes := flag.Int64("max-replication-bytes", defaultMaxReplicationBytes, "largest file a -standby accepts on PUT /replication/files")
+	printCfg := flag.Bool("print-config", false, "print the effective configuration as YAML and exit")
+	restore := flag.String("restore", "", "archive of GET /admin/snapshot unpacked into this fresh instance before it starts; its configuration is written to -config (default "+snapshotDefaultConfig+") and used")
+	adminToken := flag.String("admin-token", "", "bearer token required by GET /admin/snapshot and POST /admin/warmup (empty disables both)")
+	flag.Parse()
+
 	var err error
-	logger, err = setupLogger()
+	cfgPath := configPath(*configFile)
+	if *restore != "" {
+		if cfgPath, err = restoreSnapshotConfig(*restore, cfgPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to restore snapshot: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	sources, err := applyConfig(flag.CommandLine, cfgPath, os.Environ())
+	if err == nil {
+		err = validateConfig(flag.CommandLine)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration:\n%v\n", err)
+		os.Exit(2)
+	}
+	if *printCfg {
+		if err := printConfig(os.Stdout, flag.CommandLine, sources, nil); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	configSources = sources
+	var restored snapshotManifest
+	if *restore != "" {
+		if restored, err = restoreSnapshot(*restore, flag.CommandLine); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to restore snapshot: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	tlsOpts.AllowedSANs = splitList(*allowedSANs)
+	allowedOrigins, _ := parseCORSOrigins(*corsOrigins)
+
+	logger, err = setupLogger(*logDir)
 	if err != nil {
 		panic(err)
 	}
 	defer logger.Sync()
+	if *restore != "" {
+		logger.Info("Restored snapshot", zap.String("file", *restore), zap.String("config", cfgPath),
+			zap.Time("created", restored.Created), zap.String("node", restored.Node), zap.Strings("sections", restored.Sections))
+		if len(restored.OmittedSecrets) > 0 {
+			logger.Warn("The snapshot left out secrets; set them by flag or environment",
+				zap.Strings("flags", restored.OmittedSecrets))
+		}
+	}
+
+	if defaultEcho, err = parseEchoPolicy(*echoMode, *echoMaxBytes); err != nil {
+		logger.Fatal("Invalid echo policy", zap.Error(err))
+	}
+
+	if err := setJSONNumbers(avrojson.JSONNumbers(*jsonNumbers)); err != nil {
+		logger.Fatal("Invalid JSON number mode", zap.Error(err))
+	}
+	if err := avrojson.SetNonFinite(avrojson.NonFinite(*nonFinite)); err != nil {
+		logger.Fatal("Invalid non-finite policy", zap.Error(err))
+	}
+	if bodyTypes, err = parseBodyTypes(*bodyTypesMode); err != nil {
+		logger.Fatal("Invalid body types", zap.Error(err))
+	}
+
+	tlsConfig, err := buildServerTLSConfig(tlsOpts)
+	if err != nil {
+		logger.Fatal("Invalid TLS configuration", zap.Error(err))
+	}
+
+	if *traceCodec {
+		avrojson.SetTracer(logCodecSpan)
+	}
+	if err := avrojson.DefaultCache.Warm(avrojson.WrapperSchema, avrojson.LogDataSchema); err != nil {
+		logger.Fatal("Failed to compile Avro schemas", zap.Error(err))
+	}
+	if *idNode < 0 {
+		*idNode = ids.NodeFor(*nodeID)
+	}
+	if logIDs, err = ids.New(*idKind, *idNode); err != nil {
+		logger.Fatal("Invalid ID generator", zap.Error(err))
+	}
+	if err := loadQuotas(*quotaFile); err != nil {
+		logger.Fatal("Failed to load quotas", zap.String("file", *quotaFile), zap.Error(err))
+	}
+	if *forecastInterval > 0 {
+		forecasts = newForecaster(*forecastHorizon, *forecastDiskDir, *forecastWebhook)
+	}
+	if err := loadFeatureFlags(*featureFile, splitList(*featureList)); err != nil {
+		logger.Fatal("Failed to load feature flags", zap.String("file", *featureFile), zap.Error(err))
+	}
+	if err := loadExperiments(*experimentFile); err != nil {
+		logger.Fatal("Failed to load experiments", zap.String("file", *experimentFile), zap.Error(err))
+	}
+	if err := loadTenants(*tenantFile); err != nil {
+		logger.Fatal("Failed to load tenants", zap.String("file", *tenantFile), zap.Error(err))
+	}
+	if err := openSchemaRegistry(*schemaDir); err != nil {
+		logger.Fatal("Failed to open schema registry", zap.String("dir", *schemaDir), zap.Error(err))
+	}
+	if *projectSchemaDir != "" {
+		if err := loadProjectSchemas(*projectSchemaDir); err != nil {
+			logger.Fatal("Failed to load project schemas", zap.String("dir", *projectSchemaDir), zap.Error(err))
+		}
+	}
+	if err := openArtifactStore(*artifactDir); err != nil {
+		logger.Fatal("Failed to open artifact store", zap.String("dir", *artifactDir), zap.Error(err))
+	}
+	if *sinkConfig != "" {
+		if err := loadSinkConfig(*sinkConfig); err != nil {
+			logger.Fatal("Failed to configure log sinks", zap.String("file", *sinkConfig), zap.Error(err))
+		}
+	} else {
+		ocfOpts.FlushIntervalMS = int(ocfFlushInterval.Milliseconds())
+		s3Opts.ocfTuning = ocfOpts
+		if err := openFlagSinks(fileSinkConfig{Dir: *ocfDir, ocfTuning: ocfOpts}, s3Opts, dbSinkConfig{Path: *dbPath}); err != nil {
+			logger.Fatal("Failed to configure log sinks", zap.Error(err))
+		}
+	}
+	if *pluginConfig != "" {
+		if err := loadPluginConfig(*pluginConfig); err != nil {
+			logger.Fatal("Failed to configure plugins", zap.String("file", *pluginConfig), zap.Error(err))
+		}
+		if err := startPlugins(context.Background()); err != nil {
+			logger.Fatal("Failed to start plugins", zap.Error(err))
+		}
+	}
+	if *standbyMode {
+		if err := os.MkdirAll(*replicateDir, 0755); err != nil {
+			logger.Fatal("Failed to create standby directory", zap.String("dir", *replicateDir), zap.Error(err))
+		}
+		standby = &standbyStore{dir: *replicateDir}
+	}
+	if *replicateTo != "" {
+		if *replicateInterval <= 0 {
+			logger.Fatal("-replicate-interval must be positive")
+		}
+		replication = newReplicator(*replicateDir, *replicateTo, *replicateToken, *replicateInterval)
+	}
+	if *sinkQueueSize > 0 {
+		sinkLogQueue = newSinkQueue(*sinkQueueSize, *sinkBatch, *sinkFsync, *sinkFsyncEvery)
+	}
+	if *selfCheck {
+		results, err := runSelfCheck(configuredSinks(*schemaDir, *leaseFile, *artifactDir))
+		logSelfCheck(results)
+		if err != nil {
+			logger.Fatal("Startup self-check failed", zap.Error(err))
+		}
+	}
 
 	r := gin.Default()
+	// Accept HTTP/2 prior-knowledge (h2c) so the client can compare HTTP/1.1,
+	// HTTP/2 and gRPC framing against the same handlers.
+	r.UseH2C = true
 
+	r.Use(requestIDMiddleware)
 	r.Use(func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Content-Type")
+		if origin := allowedOrigin(allowedOrigins, c.GetHeader("Origin")); origin != "" {
+			c.Header("Access-Control-Allow-Origin", origin)
+			if origin != "*" {
+				c.Header("Vary", "Origin")
+			}
+		}
+		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, "+avroSchemaHeader+", "+avroSchemaVersionHeader+", "+idempotencyHeader+", "+deadlineHeader+", "+requestIDHeader)
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -109,12 +313,122 @@ func main() {
 
 		c.Next()
 	})
+	r.Use(bodyLimits{
+		max:       *maxBodyBytes,
+		routes:    map[string]int64{"/logs/import": *maxImportBytes, "/replication/files/*path": *maxReplicationBytes},
+		streaming: map[string]bool{"/logs/import": true, "/replication/files/*path": true},
+	}.middleware())
 
 	r.POST("/ping", pingHandler)
-	r.POST("/log", logHandler)
+	backends := splitList(*shardBackends)
+	if len(backends) > 0 {
+		router, err := newShardRouter(backends, *shardReplicas)
+		if err != nil {
+			logger.Fatal("Invalid shard backends", zap.Error(err))
+		}
+		r.POST("/log", router.logHandler)
+		r.POST("/log/binary", router.logBinaryHandler)
+		r.GET("/shards", router.shardsHandler)
+		r.GET("/projects/:project/pin", router.projectHandler)
+		r.PUT("/projects/:project/pin", router.projectHandler)
+		r.DELETE("/projects/:project/pin", router.projectHandler)
+		logger.Info("Routing /log by projectName", zap.Strings("backends", backends))
+	} else {
+		r.POST("/log", trackDeadline, requireTenant, logHandler)
+		r.POST("/log/binary", trackDeadline, requireTenant, logBinaryHandler)
+		registerWarmupRoutes(r, *adminToken, defaultWarmupRequests(*warmup))
+		r.POST("/logs/import", requireTenant, importHandler)
+		r.GET("/logs/export", requireTenant, exportHandler)
+		r.GET("/logs/replay", requireTenant, replayHandler)
+		r.GET("/logs", requireTenant, logsHandler)
+		registerPinRoutes(r)
+		registerFeatureRoutes(r)
+	}
+	r.POST("/decode", decodeHandler)
+	r.POST("/validate", validateHandler)
+	r.POST("/decode/columnar", decodeColumnarHandler)
+	r.POST("/benchmark", benchmarkHandler)
+	r.GET("/logs/:id/artifact", requireTenant, artifactHandler)
+	registerSchemaRoutes(r)
+	r.GET("/stats", statsHandler)
+	r.DELETE("/stats/codec", resetCodecStatsHandler)
+	r.GET("/stats/experiments", experimentsHandler)
+	r.GET("/stats/compression", compressionStatsHandler)
+	r.GET("/stats/forecast", forecastHandler)
+	r.DELETE("/stats/experiments", resetExperimentsHandler)
+	registerReplicationRoutes(r, *replicateToken)
+	registerSnapshotRoutes(r, *adminToken)
+	r.POST(grpcTransportPath, grpcTransportHandler(r))
+	registerGRPCService(r)
+	r.GET(websocketPath, websocketLogHandler(r))
+
+	if *demo {
+		startDemoPipeline(r, *demoBuffer)
+	}
+
+	if artifactStore != nil || tenantArtifactDir != "" {
+		go flushArtifactFilters(context.Background(), *filterFlush)
+	}
+	if quotas != nil {
+		go runQuotaResets(context.Background())
+	}
+	if forecasts != nil {
+		go runForecasts(context.Background(), *forecastInterval)
+	}
+	if replication != nil {
+		go runReplication(context.Background())
+	}
+	scheduleArtifactRetention(retention, *retentionInterval)
+	if err := startLeaderJobs(context.Background(), *leaseFile, *nodeID, *leaseTTL); err != nil {
+		logger.Fatal("Failed to start leader jobs", zap.Error(err))
+	}
+
+	if *tcpAddr != "" {
+		go func() {
+			if err := serveTCPTransport(*tcpAddr, r, tlsConfig); err != nil {
+				logger.Error("TCP transport stopped", zap.Error(err))
+			}
+		}()
+	}
+	if *udpAddr != "" && tlsConfig != nil {
+		// There is no DTLS support, so a plaintext UDP listener would bypass
+		// client authentication entirely.
+		logger.Warn("UDP transport disabled because TLS is enabled", zap.String("addr", *udpAddr))
+	} else if *udpAddr != "" {
+		go func() {
+			if err := serveUDPTransport(*udpAddr, r); err != nil {
+				logger.Error("UDP transport stopped", zap.Error(err))
+			}
+		}()
+	}
 
-	fmt.Println("Server starting on :8080")
-	r.Run(":8080")
+	if *warmup > 0 && len(backends) > 0 {
+		logger.Warn("Warm-up skipped in router mode; warm up the backends instead")
+	} else if *warmup > 0 {
+		report, err := runWarmup(context.Background(), r, *warmup, *warmupReset)
+		if err != nil {
+			logger.Fatal("Warm-up failed", zap.Error(err))
+		}
+		logWarmup(report)
+	}
+
+	srv := &http.Server{Addr: *addr, Handler: r.Handler(), TLSConfig: tlsConfig}
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	stopped := shutdownOn(srv, stop, *shutdownTimeout)
+	if tlsConfig != nil {
+		fmt.Printf("Server starting on %s (TLS)\n", *addr)
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		fmt.Printf("Server starting on %s\n", *addr)
+		err = srv.ListenAndServe()
+	}
+	if !errors.Is(err, http.ErrServerClosed) {
+		logger.Fatal("Server stopped", zap.Error(err))
+	}
+	<-stopped
+	flushForExit()
+	logger.Info("Server stopped")
 }
 
 func pingHandler(c *gin.Context) {
@@ -122,13 +436,13 @@ func pingHandler(c *gin.Context) {
 
 	var req PingRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		logger.Error("Failed to bind ping request",
+		requestLogger(c).Error("Failed to bind ping request",
 			zap.String("method", c.Request.Method),
 			zap.String("path", c.Request.URL.Path),
 			zap.String("client_ip", c.ClientIP()),
 			zap.String("error", err.Error()),
 			zap.Duration("duration", time.Since(start)))
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
 		return
 	}
 
@@ -139,7 +453,7 @@ func pingHandler(c *gin.Context) {
 		Echo:      req.Data,
 	}
 
-	logger.Info("Ping request processed",
+	requestLogger(c).Info("Ping request processed",
 		zap.String("method", c.Request.Method),
 		zap.String("path", c.Request.URL.Path),
 		zap.String("client_ip", c.ClientIP()),
@@ -150,133 +464,326 @@ func pingHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+// setJSONNumbers applies mode to request binding as well as to the avrojson
+// conversions, so numbers in metadata and domainData are parsed once and
+// never pass through float64 in exact mode.
+func setJSONNumbers(mode avrojson.JSONNumbers) error {
+	if err := avrojson.SetJSONNumbers(mode); err != nil {
+		return err
+	}
+	binding.EnableDecoderUseNumber = mode == avrojson.JSONNumbersExact
+	return nil
+}
+
 func logHandler(c *gin.Context) {
 	var req LogRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		logger.Error("Failed to bind log request", zap.Error(err))
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		requestLogger(c).Error("Failed to bind log request", zap.Error(err))
+		respondBindError(c, err)
 		return
 	}
 
-	wrapperCodec, err := goavro.NewCodec(wrapperSchema)
-	if err != nil {
-		logger.Error("Failed to create wrapper Avro codec", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create wrapper Avro codec"})
+	if !applyPlugins(c, &req) {
 		return
 	}
 
-	logDataCodec, err := goavro.NewCodec(logDataSchema)
+	originalJSON, _ := json.Marshal(req)
+	if _, typed := bodySchema(req); !typed {
+		req.LogBody.Metadata = withRequestID(req.LogBody.Metadata, requestID(c))
+	}
+
+	encoded, err := encodeLogRequest(req)
+	var bodyErr *bodySchemaError
+	if errors.As(err, &bodyErr) {
+		respondBodySchemaError(c, bodyErr)
+		return
+	}
 	if err != nil {
-		logger.Error("Failed to create log data Avro codec", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create log data Avro codec"})
+		requestLogger(c).Error("Failed to encode log to Avro", zap.Error(err))
+		respondError(c, http.StatusInternalServerError, codeEncodeFailed, "Failed to encode log to Avro")
 		return
 	}
 
+	respondLogged(c, req, encoded, originalJSON)
+}
+
+// applyPlugins runs the plugins over req. It reports false, having
+// answered the request, when a plugin rejects or drops the log.
+func applyPlugins(c *gin.Context, req *LogRequest) bool {
+	plugin, keep, err := runPlugins(c.Request.Context(), req)
+	if err != nil {
+		respondErrorWith(c, http.StatusBadRequest, apiError{Code: codePluginRejected, Message: err.Error()}, gin.H{"plugin": plugin})
+		return false
+	}
+	if !keep {
+		c.JSON(http.StatusOK, gin.H{"status": "filtered", "plugin": plugin, "request_id": requestID(c)})
+		return false
+	}
+	return true
+}
+
+// encodeLogRequest converts a /log request to LogWrapper and LogData and
+// encodes them, the body with its project's or logType's schema when one
+// is registered or, with -body-types=infer, one inferred from it.
+func encodeLogRequest(req LogRequest) (*avrojson.EncodedLog, error) {
+	wrapper := avrojson.LogWrapper{
+		ProjectName:    req.ProjectName,
+		ProjectVersion: req.ProjectVersion,
+		LogLevel:       req.LogLevel,
+		LogType:        req.LogType,
+		LogSource:      req.LogSource,
+	}
+	if s, ok := bodySchema(req); ok {
+		return encodeTypedLogRequest(req, wrapper, s)
+	}
+	if s, inferred, ok, err := inferLogRequest(req); err != nil {
+		return nil, err
+	} else if ok {
+		return encodeTypedLogRequest(inferred, wrapper, s)
+	}
+	return encodeBuiltinLogRequest(req, wrapper)
+}
+
+// encodeBuiltinLogRequest encodes the body of req with the built-in
+// LogData.
+func encodeBuiltinLogRequest(req LogRequest, wrapper avrojson.LogWrapper) (*avrojson.EncodedLog, error) {
 	// Convert metadata and domainData to Avro-compatible format
 	var metadataForAvro interface{}
 	if req.LogBody.Metadata != nil {
-		metadataForAvro = convertToAvroMap(req.LogBody.Metadata)
+		metadataForAvro = avrojson.StringMap(req.LogBody.Metadata)
 	}
 
 	var domainDataForAvro interface{}
 	if req.LogBody.DomainData != nil {
-		domainDataForAvro = convertToAvroMap(req.LogBody.DomainData)
+		domainDataForAvro = avrojson.StringMap(req.LogBody.DomainData)
 	}
 
-	// Create Avro LogData struct
-	avroLogData := AvroLogData{
-		Timestamp:  req.LogBody.Timestamp,
+	return avrojson.EncodeLog(wrapper, avrojson.LogData{
+		Timestamp:  time.UnixMilli(req.LogBody.Timestamp).UTC(),
 		Logtype:    req.LogBody.Logtype,
 		Version:    req.LogBody.Version,
 		Issuer:     req.LogBody.Issuer,
 		Metadata:   metadataForAvro,
 		DomainData: domainDataForAvro,
-	}
-
-	// Convert struct to map for goavro
-	logDataRecord := structToMap(avroLogData)
+	})
+}
 
-	logDataBinary, err := logDataCodec.BinaryFromNative(nil, logDataRecord)
-	if err != nil {
-		logger.Error("Failed to encode log data to Avro binary", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode log data to Avro"})
+// respondLogged stores and publishes an encoded log and reports its
+// compression stats. originalJSON is the JSON request the log was sent as,
+// or would have been sent as for binary ingest.
+func respondLogged(c *gin.Context, req LogRequest, encoded *avrojson.EncodedLog, originalJSON []byte) {
+	if !checkTenantProject(c, req.ProjectName) {
 		return
 	}
-
-	logDataNative, _, err := logDataCodec.NativeFromBinary(logDataBinary)
+	echo, err := requestEchoPolicy(c)
 	if err != nil {
-		logger.Error("Failed to decode log data from Avro binary", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode log data from Avro"})
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
 		return
 	}
-
-	logDataJSON, err := logDataCodec.TextualFromNative(nil, logDataNative)
+	plainUnions, err := requestPlainUnions(c)
 	if err != nil {
-		logger.Error("Failed to convert log data to JSON", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to convert log data to JSON"})
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
 		return
 	}
-
-	// Create Avro LogWrapper struct
-	avroWrapper := AvroLogWrapper{
+	c.Header("Vary", "Accept")
+	mediaType, ok := negotiateMediaType(c.GetHeader("Accept"), logResponseTypes)
+	if !ok {
+		respondError(c, http.StatusNotAcceptable, codeNotAcceptable, "Accept must allow one of "+strings.Join(logResponseTypes, ", "))
+		return
+	}
+	encoded, schemaPin, ok := applyBodyPin(c, avrojson.LogWrapper{
 		ProjectName:    req.ProjectName,
 		ProjectVersion: req.ProjectVersion,
-		Body:           string(logDataJSON),
 		LogLevel:       req.LogLevel,
 		LogType:        req.LogType,
 		LogSource:      req.LogSource,
+	}, encoded)
+	if !ok {
+		return
 	}
 
-	// Convert struct to map for goavro
-	wrapperRecord := structToMap(avroWrapper)
+	wrapperBinary, wrapperJSON := encoded.Wrapper, encoded.WrapperJSON
+	logDataBinary, logDataJSON := encoded.LogData, encoded.LogDataJSON
 
-	wrapperBinary, err := wrapperCodec.BinaryFromNative(nil, wrapperRecord)
-	if err != nil {
-		logger.Error("Failed to encode wrapper to Avro binary", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode wrapper to Avro"})
-		return
+	originalSize := len(originalJSON)
+	wrapperAvroSize := len(wrapperBinary)
+	logDataAvroSize := len(logDataBinary)
+	wrapperJSONSize := len(wrapperJSON)
+
+	echoWrapperJSON, echoLogDataJSON := wrapperJSON, logDataJSON
+	if plainUnions {
+		if echoWrapperJSON, echoLogDataJSON, err = plainLogJSON(encoded); err != nil {
+			requestLogger(c).Error("Failed to strip union wrappers", zap.Error(err))
+			respondError(c, http.StatusInternalServerError, codeEncodeFailed, "Failed to strip union wrappers")
+			return
+		}
 	}
 
-	wrapperNative, _, err := wrapperCodec.NativeFromBinary(wrapperBinary)
+	deadline := requestDeadlineOf(c)
+	deadline.enter(stageArtifacts)
+	var logID string
+	var artifacts gin.H
+	var idempotencyKey string
+	store, err := requestArtifacts(c)
 	if err != nil {
-		logger.Error("Failed to decode wrapper from Avro binary", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode wrapper from Avro"})
+		requestLogger(c).Error("Failed to open tenant artifact store", zap.Error(err))
+		respondError(c, http.StatusInternalServerError, codeStorageFailed, "Failed to open artifact storage")
 		return
 	}
+	if !isWarmup(c.Request.Context()) {
+		logID = logIDs.New()
+		if idempotencyKey, ok = claimIdempotencyKey(c, store, logID); !ok {
+			return
+		}
+		// Repeats answered above are free; everything else counts.
+		if !enforceQuota(c, req.ProjectName, originalSize) {
+			releaseIdempotencyKey(store, idempotencyKey, logID)
+			return
+		}
+	}
+	if store != nil && logID != "" {
+		var err error
+		if artifacts, err = storeLogArtifacts(store, logID, encoded, originalJSON); err != nil {
+			requestLogger(c).Error("Failed to store log artifacts", zap.Error(err))
+			releaseIdempotencyKey(store, idempotencyKey, logID)
+			respondError(c, http.StatusInternalServerError, codeStorageFailed, "Failed to store log artifacts")
+			return
+		}
+	}
 
-	wrapperJSON, err := wrapperCodec.TextualFromNative(nil, wrapperNative)
-	if err != nil {
-		logger.Error("Failed to convert wrapper to JSON", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to convert wrapper to JSON"})
+	deadline.enter(stageSinks)
+	var sinkErrors []apiError
+	if !isWarmup(c.Request.Context()) {
+		publishDemoRecord(c.Request.Context(), logID, req, wrapperBinary, encoded.LogDataSchema)
+		sinkErrors = logToSinks(c.Request.Context(), sinkRecord{ID: logID, Project: req.ProjectName, LogType: req.LogType, Received: time.Now(), OriginalSize: originalSize, Encoded: encoded})
+		recordStorageGrowth(req.ProjectName, wrapperAvroSize)
+
+		requestLogger(c).Info("Log processed",
+			zap.String("id", logID),
+			zap.Int("original_json_size", originalSize),
+			zap.Int("wrapper_avro_size", wrapperAvroSize),
+			zap.Int("logdata_avro_size", logDataAvroSize),
+			zap.Int("wrapper_json_size", wrapperJSONSize))
+		requestLogger(c).Debug("Avro JSON output",
+			zap.String("wrapper_avro_json", string(wrapperJSON)),
+			zap.String("logdata_avro_json", string(logDataJSON)))
+	}
+	if logID != "" {
+		c.Header("X-Log-ID", logID)
+	}
+	if respondLogEncoding(c, mediaType, encoded) {
 		return
 	}
 
-	originalJSON, _ := json.Marshal(req)
-	originalSize := len(originalJSON)
-	wrapperAvroSize := len(wrapperBinary)
-	logDataAvroSize := len(logDataBinary)
-	wrapperJSONSize := len(wrapperJSON)
+	deadline.enter(stageStats)
+	compressionStats := gin.H{
+		"original_json_size":  originalSize,
+		"wrapper_avro_size":   wrapperAvroSize,
+		"logdata_avro_size":   logDataAvroSize,
+		"wrapper_json_size":   wrapperJSONSize,
+		"wrapper_compression": fmt.Sprintf("%.2f%%", float64(wrapperAvroSize)/float64(originalSize)*100),
+		"logdata_compression": fmt.Sprintf("%.2f%%", float64(logDataAvroSize)/float64(originalSize)*100),
+	}
+	if !deadline.skip(optionalBlockStats) {
+		addBlockStats(compressionStats, encoded, originalSize)
+		addCompressedJSONStats(compressionStats, originalJSON)
+	}
+	resp := gin.H{
+		"status":            "logged",
+		"request_id":        requestID(c),
+		"compression_stats": compressionStats,
+	}
+	if logID != "" {
+		resp["id"] = logID
+	}
+	if artifacts != nil {
+		resp["artifacts"] = artifacts
+	}
+	if schemaPin != nil {
+		resp["schema_pin"] = schemaPin
+	}
+	if len(sinkErrors) > 0 {
+		for i := range sinkErrors {
+			sinkErrors[i].RequestID = requestID(c)
+		}
+		resp["sink_errors"] = sinkErrors
+	}
+	reportFeatures(c, resp, req.ProjectName)
+	if !isWarmup(c.Request.Context()) && !deadline.skip(optionalExperiments) {
+		runExperiments(resp, req)
+	}
+	deadline.report(c, resp)
+	echo.apply(resp, echoWrapperJSON, echoLogDataJSON)
+	c.JSON(http.StatusOK, resp)
+}
 
-	logger.Info("Log processed",
-		zap.Int("original_json_size", originalSize),
-		zap.Int("wrapper_avro_size", wrapperAvroSize),
-		zap.Int("logdata_avro_size", logDataAvroSize),
-		zap.Int("wrapper_json_size", wrapperJSONSize))
-	logger.Debug("Avro JSON output",
-		zap.String("wrapper_avro_json", string(wrapperJSON)),
-		zap.String("logdata_avro_json", string(logDataJSON)))
-
-	c.JSON(http.StatusOK, gin.H{
-		"status": "logged",
-		"compression_stats": gin.H{
-			"original_json_size":  originalSize,
-			"wrapper_avro_size":   wrapperAvroSize,
-			"logdata_avro_size":   logDataAvroSize,
-			"wrapper_json_size":   wrapperJSONSize,
-			"wrapper_compression": fmt.Sprintf("%.2f%%", float64(wrapperAvroSize)/float64(originalSize)*100),
-			"logdata_compression": fmt.Sprintf("%.2f%%", float64(logDataAvroSize)/float64(originalSize)*100),
-		},
-		"wrapper_avro_json": string(wrapperJSON),
-		"logdata_avro_json": string(logDataJSON),
-	})
+func statsHandler(c *gin.Context) {
+	stats := gin.H{
+		"codec_cache": avrojson.DefaultCache.Stats(),
+		"codec":       avrojson.DefaultMetrics.Snapshot(),
+		"jobs":        leaderStatus(),
+		"self_check":  selfCheckStatus(),
+		"warmup":      warmupStatus(),
+	}
+	if artifactStore != nil {
+		stats["artifacts"] = artifactStore.Stats()
+		stats["artifact_filters"] = artifactStore.FilterStats()
+		if artifactRetention.Enabled() {
+			stats["artifact_retention"] = artifactStore.RetentionStats()
+		}
+	}
+	if tenants != nil {
+		stats["tenants"] = tenantStatus()
+	}
+	if len(sinks) > 0 {
+		stats["sinks"] = sinkStats()
+	}
+	if len(plugins) > 0 {
+		stats["plugins"] = pluginStats()
+	}
+	if status := replicationStatus(); status != nil {
+		stats["replication"] = status
+	}
+	if sinkLogQueue != nil {
+		stats["sink_queue"] = sinkLogQueue.stats()
+	}
+	if ocf := ocfLogStats(); ocf != nil {
+		stats["ocf"] = ocf
+	}
+	if quotas != nil {
+		stats["quotas"] = quotaStatus()
+	}
+	if deadlines := deadlineTotals.snapshot(); deadlines != nil {
+		stats["deadlines"] = deadlines
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+func resetCodecStatsHandler(c *gin.Context) {
+	avrojson.DefaultMetrics.Reset()
+	c.JSON(http.StatusOK, gin.H{"status": "reset"})
+}
+
+func logCodecSpan(span avrojson.Span) {
+	fields := []zap.Field{
+		zap.String("schema", span.Schema),
+		zap.String("fingerprint", span.Fingerprint),
+		zap.String("stage", string(span.Stage)),
+		zap.Time("start", span.Start),
+		zap.Duration("duration", span.Duration),
+		zap.Int("bytes", span.Bytes),
+	}
+	if span.Err != nil {
+		logger.Warn("Avro codec span", append(fields, zap.String("error_type", span.ErrorType), zap.Error(span.Err))...)
+		return
+	}
+	logger.Debug("Avro codec span", fields...)
+}
+
+func defaultNodeID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "node"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
 }
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+	"go.uber.org/zap"
+)
+
+func TestLogKeepsLargeIntegerIDs(t *testing.T) {
+	logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	if err := setJSONNumbers(avrojson.JSONNumbersExact); err != nil {
+		t.Fatalf("Failed to set JSON number mode: %v", err)
+	}
+	r := gin.New()
+	r.POST("/log", logHandler)
+	r.POST("/ping", pingHandler)
+
+	post := func(path, body string) string {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200 from %s, got %d: %s", path, w.Code, w.Body.String())
+		}
+		return w.Body.String()
+	}
+
+	// 2^53 + 1 would be rounded to ...992 by a float64.
+	logBody := `{"projectName":"p","projectVersion":"1","logLevel":"INFO","logType":"WEB","logSource":"test",` +
+		`"body":{"timestamp":1700000000000,"logtype":"t","version":"1","issuer":"i",` +
+		`"metadata":{"user_id":9007199254740993},"domainData":{"order":{"id":9007199254740995}}}}`
+	var resp struct {
+		LogDataJSON string `json:"logdata_avro_json"`
+	}
+	if err := json.Unmarshal([]byte(post("/log", logBody)), &resp); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	for _, want := range []string{`"user_id":"9007199254740993"`, `9007199254740995`} {
+		if !strings.Contains(resp.LogDataJSON, want) {
+			t.Errorf("logdata %s lacks %s", resp.LogDataJSON, want)
+		}
+	}
+
+	if echo := post("/ping", `{"data":{"id":9007199254740993}}`); !bytes.Contains([]byte(echo), []byte(`"id":9007199254740993`)) {
+		t.Errorf("ping echo lost precision: %s", echo)
+	}
+}
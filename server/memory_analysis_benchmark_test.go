@@ -5,6 +5,7 @@ import (
 	"runtime"
 	"testing"
 
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
 	"github.com/linkedin/goavro/v2"
 )
 
@@ -37,7 +38,7 @@ func BenchmarkMemoryAvroBinary(b *testing.B) {
 	codec, _ := goavro.NewCodec(userCharacterSchema)
 
 	// Convert to map for Avro
-	dataMap := convertToAvroMap(data)
+	dataMap := avrojson.StringMap(data)
 
 	b.ResetTimer()
 
@@ -65,7 +66,7 @@ func BenchmarkMemoryAvroJSON(b *testing.B) {
 	codec, _ := goavro.NewCodec(userCharacterSchema)
 
 	// Convert to map for Avro
-	dataMap := convertToAvroMap(data)
+	dataMap := avrojson.StringMap(data)
 
 	b.ResetTimer()
 
@@ -88,10 +89,82 @@ func BenchmarkMemoryAvroJSON(b *testing.B) {
 		m2.NumGC-m1.NumGC)
 }
 
+func BenchmarkMemoryMessagePack(b *testing.B) {
+	data := generateDummyCharacters(20)
+
+	b.ResetTimer()
+
+	var m1, m2 runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&m1)
+
+	for i := 0; i < b.N; i++ {
+		packed, _ := marshalMsgpack(data)
+		_ = packed
+	}
+
+	runtime.GC()
+	runtime.ReadMemStats(&m2)
+
+	b.Logf("Memory: Alloc=%d KB, TotalAlloc=%d KB, Sys=%d KB, NumGC=%d",
+		(m2.Alloc-m1.Alloc)/1024,
+		(m2.TotalAlloc-m1.TotalAlloc)/1024,
+		(m2.Sys-m1.Sys)/1024,
+		m2.NumGC-m1.NumGC)
+}
+
+func BenchmarkMemoryCBOR(b *testing.B) {
+	data := generateDummyCharacters(20)
+
+	b.ResetTimer()
+
+	var m1, m2 runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&m1)
+
+	for i := 0; i < b.N; i++ {
+		cborData, _ := marshalCBOR(data)
+		_ = cborData
+	}
+
+	runtime.GC()
+	runtime.ReadMemStats(&m2)
+
+	b.Logf("Memory: Alloc=%d KB, TotalAlloc=%d KB, Sys=%d KB, NumGC=%d",
+		(m2.Alloc-m1.Alloc)/1024,
+		(m2.TotalAlloc-m1.TotalAlloc)/1024,
+		(m2.Sys-m1.Sys)/1024,
+		m2.NumGC-m1.NumGC)
+}
+
+func BenchmarkMemoryProtobuf(b *testing.B) {
+	data := generateDummyCharacters(20).protobuf()
+
+	b.ResetTimer()
+
+	var m1, m2 runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&m1)
+
+	for i := 0; i < b.N; i++ {
+		protoData := data.Marshal()
+		_ = protoData
+	}
+
+	runtime.GC()
+	runtime.ReadMemStats(&m2)
+
+	b.Logf("Memory: Alloc=%d KB, TotalAlloc=%d KB, Sys=%d KB, NumGC=%d",
+		(m2.Alloc-m1.Alloc)/1024,
+		(m2.TotalAlloc-m1.TotalAlloc)/1024,
+		(m2.Sys-m1.Sys)/1024,
+		m2.NumGC-m1.NumGC)
+}
+
 func TestMemoryComparison(t *testing.T) {
 	data := generateDummyCharacters(20)
 	codec, _ := goavro.NewCodec(userCharacterSchema)
-	dataMap := convertToAvroMap(data)
+	dataMap := avrojson.StringMap(data)
 
 	t.Log("=== Memory Usage Comparison ===")
 
@@ -106,6 +179,16 @@ func TestMemoryComparison(t *testing.T) {
 	t.Logf("Standard JSON: %d bytes, Memory: %d KB allocated",
 		len(jsonData), (m2.TotalAlloc-m1.TotalAlloc)/1024)
 
+	// Gzipped JSON
+	runtime.GC()
+	runtime.ReadMemStats(&m1)
+
+	gzipJSONSize, _ := gzipSize(jsonData)
+
+	runtime.ReadMemStats(&m2)
+	t.Logf("Gzipped JSON: %d bytes, Memory: %d KB allocated",
+		gzipJSONSize, (m2.TotalAlloc-m1.TotalAlloc)/1024)
+
 	// Avro Binary
 	runtime.GC()
 	runtime.ReadMemStats(&m1)
@@ -126,7 +209,41 @@ func TestMemoryComparison(t *testing.T) {
 	t.Logf("Avro JSON: %d bytes, Memory: %d KB allocated",
 		len(avroJsonData), (m2.TotalAlloc-m1.TotalAlloc)/1024)
 
-	t.Logf("Size ratio - Binary/JSON: %.2f", float64(len(binaryData))/float64(len(jsonData)))
+	// MessagePack
+	runtime.GC()
+	runtime.ReadMemStats(&m1)
+
+	msgpackData, _ := marshalMsgpack(data)
+
+	runtime.ReadMemStats(&m2)
+	t.Logf("MessagePack: %d bytes, Memory: %d KB allocated",
+		len(msgpackData), (m2.TotalAlloc-m1.TotalAlloc)/1024)
+
+	// CBOR
+	runtime.GC()
+	runtime.ReadMemStats(&m1)
+
+	cborData, _ := marshalCBOR(data)
+
+	runtime.ReadMemStats(&m2)
+	t.Logf("CBOR: %d bytes, Memory: %d KB allocated",
+		len(cborData), (m2.TotalAlloc-m1.TotalAlloc)/1024)
+
+	// Protobuf
+	message := data.protobuf()
+	runtime.GC()
+	runtime.ReadMemStats(&m1)
+
+	protoData := message.Marshal()
+
+	runtime.ReadMemStats(&m2)
+	t.Logf("Protobuf: %d bytes, Memory: %d KB allocated",
+		len(protoData), (m2.TotalAlloc-m1.TotalAlloc)/1024)
+
+	t.Logf("Size ratio - Binary/JSON: %.2f, Gzip/JSON: %.2f, MessagePack/JSON: %.2f, CBOR/JSON: %.2f, Protobuf/JSON: %.2f",
+		float64(len(binaryData))/float64(len(jsonData)), float64(gzipJSONSize)/float64(len(jsonData)),
+		float64(len(msgpackData))/float64(len(jsonData)),
+		float64(len(cborData))/float64(len(jsonData)), float64(len(protoData))/float64(len(jsonData)))
 }
 
 func TestDetailedMemoryAnalysis(t *testing.T) {
@@ -137,7 +254,7 @@ func TestDetailedMemoryAnalysis(t *testing.T) {
 
 		data := generateDummyCharacters(size)
 		codec, _ := goavro.NewCodec(userCharacterSchema)
-		dataMap := convertToAvroMap(data)
+		dataMap := avrojson.StringMap(data)
 
 		// Measure each method
 		methods := map[string]func() ([]byte, error){
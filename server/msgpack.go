@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/ugorji/go/codec"
+)
+
+// MessagePack is the schema-less binary format the Avro encodings are
+// measured against: it drops JSON's text overhead but, unlike Avro, still
+// writes every field name with every record. Structs are encoded with
+// their json tags, as encoding/json names them.
+var msgpackHandle = func() *codec.MsgpackHandle {
+	h := &codec.MsgpackHandle{}
+	// Write the current spec's str8 and bin types.
+	h.WriteExt = true
+	return h
+}()
+
+// marshalMsgpack encodes v as MessagePack.
+func marshalMsgpack(v interface{}) ([]byte, error) {
+	var out []byte
+	err := codec.NewEncoderBytes(&out, msgpackHandle).Encode(v)
+	return out, err
+}
+
+// plainNumbers replaces the json.Number values of a decoded JSON value
+// with int64 or float64, which MessagePack and CBOR encode as numbers
+// rather than strings.
+func plainNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			out[key] = plainNumbers(value)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, value := range v {
+			out[i] = plainNumbers(value)
+		}
+		return out
+	}
+	return v
+}
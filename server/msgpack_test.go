@@ -0,0 +1,31 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ugorji/go/codec"
+)
+
+func TestMarshalMsgpack(t *testing.T) {
+	data := generateDummyCharacters(2)
+	packed, err := marshalMsgpack(data)
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+	var decoded map[string]interface{}
+	if err := codec.NewDecoderBytes(packed, msgpackHandle).Decode(&decoded); err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if decoded["user_id"] != data.UserID || len(decoded["characters"].([]interface{})) != 2 {
+		t.Errorf("expected json tag names and both characters, got %v", decoded)
+	}
+	plain, _ := json.Marshal(data)
+	if len(packed) >= len(plain) {
+		t.Errorf("MessagePack is %d bytes, JSON %d", len(packed), len(plain))
+	}
+
+	if got := plainNumbers(map[string]interface{}{"n": json.Number("7"), "f": []interface{}{json.Number("1.5")}}); got.(map[string]interface{})["n"] != int64(7) || got.(map[string]interface{})["f"].([]interface{})[0] != 1.5 {
+		t.Errorf("numbers not converted: %v", got)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+)
+
+// /log answers in the encoding the Accept header asks for:
+//
+//	application/json       (default) the JSON envelope of status, stats and
+//	                       the echoed Avro JSON strings
+//	application/avro       the LogWrapper Avro binary datum
+//	application/avro+json  the LogWrapper Avro JSON
+//
+// The raw encodings are sent whole, regardless of the echo policy, with the
+// log ID in X-Log-ID and the schema in X-Avro-Schema; the stats are left
+// out, so clients that want them ask for JSON.
+const avroJSONContentType = "application/avro+json"
+
+var logResponseTypes = []string{gin.MIMEJSON, avroContentType, avroJSONContentType}
+
+// negotiateMediaType picks the offer the Accept header prefers: the one of
+// highest quality, where an exact match outranks type/* and */*, and the
+// earliest offer on a tie. An empty header takes the first offer. ok is
+// false when the header accepts none of them.
+func negotiateMediaType(accept string, offers []string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return offers[0], true
+	}
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		if q := acceptQuality(accept, offer); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best, best != ""
+}
+
+// acceptQuality returns the quality the most specific range of accept that
+// matches mediaType gives it, or 0.
+func acceptQuality(accept, mediaType string) float64 {
+	major, _, _ := strings.Cut(mediaType, "/")
+	q, specificity := 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		t, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		var s int
+		switch {
+		case t == mediaType:
+			s = 2
+		case t == major+"/*":
+			s = 1
+		case t == "*/*":
+			s = 0
+		default:
+			continue
+		}
+		if s < specificity {
+			continue
+		}
+		specificity, q = s, 1
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				q = 0
+			}
+		}
+	}
+	return q
+}
+
+// respondLogEncoding sends the raw wrapper encoding for avro and avro+json,
+// and reports false for the JSON envelope.
+func respondLogEncoding(c *gin.Context, mediaType string, encoded *avrojson.EncodedLog) bool {
+	var body []byte
+	switch mediaType {
+	case avroContentType:
+		body = encoded.Wrapper
+	case avroJSONContentType:
+		body = encoded.WrapperJSON
+	default:
+		return false
+	}
+	c.Header(avroSchemaHeader, "LogWrapper")
+	c.Data(http.StatusOK, mediaType, body)
+	return true
+}
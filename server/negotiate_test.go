@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+	"go.uber.org/zap"
+)
+
+func TestNegotiateMediaType(t *testing.T) {
+	for _, tc := range []struct {
+		accept string
+		want   string
+		ok     bool
+	}{
+		{"", gin.MIMEJSON, true},
+		{"*/*", gin.MIMEJSON, true},
+		{"application/avro", avroContentType, true},
+		{"application/avro+json", avroJSONContentType, true},
+		{"application/*", gin.MIMEJSON, true},
+		{"application/json;q=0.5, application/avro", avroContentType, true},
+		{"application/avro;q=0, */*", gin.MIMEJSON, true},
+		{"application/avro+json;q=0.9, application/json;q=0.8", avroJSONContentType, true},
+		{"text/html,application/xhtml+xml,*/*;q=0.8", gin.MIMEJSON, true},
+		{"text/plain", "", false},
+		{"application/json;q=0", "", false},
+	} {
+		got, ok := negotiateMediaType(tc.accept, logResponseTypes)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("%q: got %q, %v, want %q, %v", tc.accept, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestLogAcceptEncodings(t *testing.T) {
+	logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/log", logHandler)
+	body, _ := json.Marshal(warmupPayload(2))
+	send := func(accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/log", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send(avroContentType)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != avroContentType {
+		t.Fatalf("Expected 200 %s, got %d %s: %s", avroContentType, w.Code, w.Header().Get("Content-Type"), w.Body)
+	}
+	if w.Header().Get(avroSchemaHeader) != "LogWrapper" {
+		t.Errorf("expected %s LogWrapper, got %q", avroSchemaHeader, w.Header().Get(avroSchemaHeader))
+	}
+	codec, err := avrojson.NewCodec(avrojson.WrapperSchema)
+	if err != nil {
+		t.Fatalf("Failed to create codec: %v", err)
+	}
+	var wrapper avrojson.LogWrapper
+	if err := codec.Decode(w.Body.Bytes(), &wrapper); err != nil {
+		t.Fatalf("Failed to decode the Avro body: %v", err)
+	}
+	if wrapper.ProjectName == "" || wrapper.Body == "" {
+		t.Errorf("unexpected wrapper: %+v", wrapper)
+	}
+
+	w = send(avroJSONContentType)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != avroJSONContentType {
+		t.Fatalf("Expected 200 %s, got %d %s: %s", avroJSONContentType, w.Code, w.Header().Get("Content-Type"), w.Body)
+	}
+	var avroJSON map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &avroJSON); err != nil {
+		t.Fatalf("Failed to parse the Avro JSON body: %v", err)
+	}
+	if avroJSON["projectName"] != wrapper.ProjectName || avroJSON["status"] != nil {
+		t.Errorf("expected the bare wrapper, got %v", avroJSON)
+	}
+
+	w = send(gin.MIMEJSON)
+	var envelope map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &envelope); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if envelope["status"] != "logged" {
+		t.Errorf("expected the JSON envelope, got %v", envelope)
+	}
+
+	if w = send("text/plain"); w.Code != http.StatusNotAcceptable {
+		t.Errorf("Expected 406, got %d: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,116 @@
+package ocf
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/homveloper/exp-avro-json/server/seal"
+	"github.com/linkedin/goavro/v2"
+)
+
+// ScanBlocks reads the Object Container File in r block by block, calling
+// fn with each block's offset, as ReadBlockAt takes it, and its records in
+// goavro's native form. It returns the writer schema from the file's
+// header. An unreadable block ends the scan with a *ScanError before fn
+// sees any of its records; fn's errors are returned as is.
+func ScanBlocks(r io.Reader, fn func(offset int64, records []interface{}) error) (string, error) {
+	cr := &countingReader{r: r}
+	br := bufio.NewReaderSize(cr, 1<<16)
+	h, err := readHeader(br)
+	if err != nil {
+		return "", fmt.Errorf("ocf: %w", err)
+	}
+	codec, err := goavro.NewCodec(h.schema)
+	if err != nil {
+		return "", fmt.Errorf("ocf: %w", err)
+	}
+	n := 0
+	for {
+		offset := cr.n - int64(br.Buffered())
+		b, err := readBlock(br, h.sync)
+		if err == io.EOF {
+			return h.schema, nil
+		}
+		if err != nil {
+			return h.schema, &ScanError{Record: n, Err: err}
+		}
+		b.decode(codec, h.compression)
+		if b.err != nil {
+			return h.schema, &ScanError{Record: n + len(b.records), Err: b.err}
+		}
+		if err := fn(offset, b.records); err != nil {
+			return h.schema, err
+		}
+		n += len(b.records)
+	}
+}
+
+// ReadBlockAt reads the block starting at offset in the container file at
+// path and returns the file's writer schema and the block's records.
+// Offsets are those Options.OnBlock and ScanBlocks report. Plain files
+// are read from the offset on; sealed files, which need the key they were
+// written with, are decrypted from the start up to it.
+func ReadBlockAt(path string, key *seal.Key, offset int64) (string, []interface{}, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+	fr := bufio.NewReader(f)
+	var r io.Reader = fr
+	if head, _ := fr.Peek(seal.HeaderSize); key != nil {
+		// Only the frames up to the block are read, so the file may
+		// still be open.
+		r = key.NewLiveReader(fr)
+	} else if seal.IsSealed(head) {
+		return "", nil, fmt.Errorf("%w: %s", ErrSealed, path)
+	}
+	cr := &countingReader{r: r}
+	br := bufio.NewReader(cr)
+	h, err := readHeader(br)
+	if err != nil {
+		return "", nil, fmt.Errorf("ocf: %s: %w", path, err)
+	}
+	pos := cr.n - int64(br.Buffered())
+	if offset < pos {
+		return h.schema, nil, fmt.Errorf("ocf: %s: offset %d is inside the header", path, offset)
+	}
+	if key == nil {
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			return h.schema, nil, err
+		}
+		br.Reset(f)
+	} else if _, err := br.Discard(int(offset - pos)); err != nil {
+		return h.schema, nil, fmt.Errorf("ocf: %s: offset %d: %w", path, offset, unexpectedEOF(err))
+	}
+	b, err := readBlock(br, h.sync)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return h.schema, nil, fmt.Errorf("ocf: %s: offset %d: %w", path, offset, err)
+	}
+	codec, err := goavro.NewCodec(h.schema)
+	if err != nil {
+		return h.schema, nil, fmt.Errorf("ocf: %w", err)
+	}
+	b.decode(codec, h.compression)
+	if b.err != nil {
+		return h.schema, nil, fmt.Errorf("ocf: %s: offset %d: %w", path, offset, b.err)
+	}
+	return h.schema, b.records, nil
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,76 @@
+package ocf
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/homveloper/exp-avro-json/server/seal"
+)
+
+func TestBlockOffsets(t *testing.T) {
+	key, err := seal.NewKey(make([]byte, seal.KeySize))
+	if err != nil {
+		t.Fatalf("Failed to create key: %v", err)
+	}
+	for _, key := range []*seal.Key{nil, key} {
+		type written struct {
+			offset  int64
+			records []interface{}
+		}
+		var blocks []written
+		w, err := Open(t.TempDir(), testSchema, Options{
+			Compression:  CompressionDeflate,
+			BlockRecords: 3,
+			Key:          key,
+			OnBlock: func(path string, offset int64, records []interface{}) {
+				blocks = append(blocks, written{offset, records})
+			},
+		})
+		if err != nil {
+			t.Fatalf("Failed to open writer: %v", err)
+		}
+		for i := 0; i < 7; i++ {
+			if err := w.AppendNative(map[string]interface{}{"kind": "click", "count": int32(i)}); err != nil {
+				t.Fatalf("Failed to append event: %v", err)
+			}
+		}
+		path := w.Stats().File
+		w.Close()
+		if len(blocks) != 3 || len(blocks[2].records) != 1 {
+			t.Fatalf("expected blocks of 3, 3 and 1 records, got %v", blocks)
+		}
+
+		f, err := OpenFile(path, key)
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", path, err)
+		}
+		var scanned []int64
+		_, err = ScanBlocks(f, func(offset int64, records []interface{}) error {
+			scanned = append(scanned, offset)
+			return nil
+		})
+		f.Close()
+		if err != nil {
+			t.Fatalf("Failed to scan blocks: %v", err)
+		}
+
+		for i, b := range blocks {
+			if i >= len(scanned) || scanned[i] != b.offset {
+				t.Errorf("sealed %v: expected ScanBlocks offsets %v to match the writer's, block %d at %d", key != nil, scanned, i, b.offset)
+			}
+			schema, records, err := ReadBlockAt(path, key, b.offset)
+			if err != nil {
+				t.Fatalf("Failed to read block at %d: %v", b.offset, err)
+			}
+			if schema == "" || !reflect.DeepEqual(records, b.records) {
+				t.Errorf("block at %d: got %v, want %v", b.offset, records, b.records)
+			}
+		}
+		if _, _, err := ReadBlockAt(path, key, 4); err == nil {
+			t.Error("expected an offset inside the header to fail")
+		}
+		if _, _, err := ReadBlockAt(path, key, blocks[2].offset+1); err == nil {
+			t.Error("expected an offset off a block boundary to fail")
+		}
+	}
+}
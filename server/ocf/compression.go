@@ -0,0 +1,94 @@
+package ocf
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/golang/snappy"
+	"github.com/linkedin/goavro/v2"
+)
+
+// Compression codecs for container file blocks. goavro v2.14 implements
+// only these three; zstd, which newer Avro implementations add, is not
+// available to its OCF writer.
+const (
+	CompressionNull    = goavro.CompressionNullLabel
+	CompressionDeflate = goavro.CompressionDeflateLabel
+	CompressionSnappy  = goavro.CompressionSnappyLabel
+)
+
+// Compressions lists the supported codecs.
+var Compressions = []string{CompressionNull, CompressionDeflate, CompressionSnappy}
+
+// CheckCompression reports whether name is a supported block codec.
+func CheckCompression(name string) error {
+	for _, c := range Compressions {
+		if name == c {
+			return nil
+		}
+	}
+	if name == "zstd" {
+		return fmt.Errorf("ocf: zstd is not supported by goavro's OCF writer; use one of %v", Compressions)
+	}
+	return fmt.Errorf("ocf: unknown compression %q; use one of %v", name, Compressions)
+}
+
+// BlockSize returns how many bytes data, the binary of the records in one
+// block, occupies in a container file compressed with name: raw deflate, or
+// snappy followed by the CRC-32 of the uncompressed data.
+func BlockSize(name string, data []byte) (int, error) {
+	switch name {
+	case CompressionNull:
+		return len(data), nil
+	case CompressionDeflate:
+		var buf bytes.Buffer
+		w, err := flate.NewWriter(&buf, flate.DefaultCompression)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := w.Write(data); err != nil {
+			return 0, err
+		}
+		if err := w.Close(); err != nil {
+			return 0, err
+		}
+		return buf.Len(), nil
+	case CompressionSnappy:
+		return len(snappy.Encode(nil, data)) + 4, nil
+	}
+	return 0, CheckCompression(name)
+}
+
+// decompressBlock reverses the block compression BlockSize measures.
+func decompressBlock(name string, data []byte) ([]byte, error) {
+	switch name {
+	case CompressionNull:
+		return data, nil
+	case CompressionDeflate:
+		r := flate.NewReader(bytes.NewReader(data))
+		defer r.Close()
+		out, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("cannot inflate block: %w", err)
+		}
+		return out, nil
+	case CompressionSnappy:
+		if len(data) < 4 {
+			return nil, errors.New("snappy block is too short for its checksum")
+		}
+		out, err := snappy.Decode(nil, data[:len(data)-4])
+		if err != nil {
+			return nil, fmt.Errorf("cannot decompress snappy block: %w", err)
+		}
+		if crc32.ChecksumIEEE(out) != binary.BigEndian.Uint32(data[len(data)-4:]) {
+			return nil, errors.New("snappy block checksum mismatch")
+		}
+		return out, nil
+	}
+	return nil, CheckCompression(name)
+}
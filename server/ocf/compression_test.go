@@ -0,0 +1,62 @@
+package ocf
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+func TestWriterCompressesBlocks(t *testing.T) {
+	codec, _ := goavro.NewCodec(testSchema)
+	var records []interface{}
+	var binary []byte
+	for i := 0; i < 100; i++ {
+		record := map[string]interface{}{"kind": "click", "count": i % 4}
+		records = append(records, record)
+		binary, _ = codec.BinaryFromNative(binary, record)
+	}
+
+	for _, name := range Compressions {
+		w, err := Open(t.TempDir(), testSchema, Options{Compression: name})
+		if err != nil {
+			t.Fatalf("Failed to open %s writer: %v", name, err)
+		}
+		if err := w.AppendNative(records...); err != nil {
+			t.Fatalf("Failed to append with %s: %v", name, err)
+		}
+		path := w.Stats().File
+		w.Close()
+
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", path, err)
+		}
+		_, n, err := Scan(f, func(interface{}) error { return nil })
+		f.Close()
+		if err != nil || n != len(records) {
+			t.Errorf("%s: read back %d records: %v", name, n, err)
+		}
+
+		size, err := BlockSize(name, binary)
+		if err != nil {
+			t.Fatalf("Failed to measure %s block: %v", name, err)
+		}
+		if name == CompressionNull && size != len(binary) {
+			t.Errorf("null block is %d bytes, want %d", size, len(binary))
+		}
+		if name != CompressionNull && size >= len(binary) {
+			t.Errorf("%s block is %d bytes, not smaller than %d", name, size, len(binary))
+		}
+	}
+}
+
+func TestRejectsUnsupportedCompression(t *testing.T) {
+	if _, err := Open(t.TempDir(), testSchema, Options{Compression: "zstd"}); err == nil || !strings.Contains(err.Error(), "zstd is not supported") {
+		t.Errorf("Expected zstd to be rejected, got %v", err)
+	}
+	if _, err := BlockSize("lz4", []byte("x")); err == nil {
+		t.Error("Expected an error for an unknown codec")
+	}
+}
@@ -0,0 +1,197 @@
+package ocf
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/homveloper/exp-avro-json/server/seal"
+	"github.com/linkedin/goavro/v2"
+)
+
+// MappedFile is a container file mapped into memory, for searches and
+// replays of large files that read a few of their blocks: blocks are
+// located from their headers alone, so the blocks before and between the
+// ones read are skipped without being decompressed or copied, and the
+// operating system pages in only what is touched. Sealed files cannot be
+// mapped, as they must be decrypted from the start.
+//
+// The mapping holds the file as it was when mapped; blocks appended later
+// are not seen, and a block still being written reads as incomplete.
+// MappedFile is safe for concurrent use until Close.
+type MappedFile struct {
+	path  string
+	data  []byte
+	unmap func() error
+	h     *header
+	codec *goavro.Codec
+	// first is the offset of the first block, right after the header.
+	first int64
+}
+
+// BlockInfo locates one block of a MappedFile.
+type BlockInfo struct {
+	// Offset is where the block starts, as ReadBlockAt and the OnBlock
+	// option give it.
+	Offset  int64
+	Records int64
+	// Size is the block's data size, compressed.
+	Size int64
+}
+
+// Map maps the plain container file at path. Sealed files fail with
+// ErrSealed.
+func Map(path string) (*MappedFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	data, unmap, err := mapFile(f, info.Size())
+	if err != nil {
+		return nil, fmt.Errorf("ocf: map %s: %w", path, err)
+	}
+	m := &MappedFile{path: path, data: data, unmap: unmap}
+	if seal.IsSealed(data) {
+		m.Close()
+		return nil, fmt.Errorf("%w: %s", ErrSealed, path)
+	}
+	r := bytes.NewReader(data)
+	br := bufio.NewReader(r)
+	if m.h, err = readHeader(br); err != nil {
+		m.Close()
+		return nil, fmt.Errorf("ocf: %s: %w", path, err)
+	}
+	m.first = int64(len(data)) - int64(r.Len()) - int64(br.Buffered())
+	if m.codec, err = goavro.NewCodec(m.h.schema); err != nil {
+		m.Close()
+		return nil, fmt.Errorf("ocf: %w", err)
+	}
+	return m, nil
+}
+
+// Schema returns the writer schema from the file's header.
+func (m *MappedFile) Schema() string { return m.h.schema }
+
+// Size returns the size of the mapped file.
+func (m *MappedFile) Size() int64 { return int64(len(m.data)) }
+
+// Close unmaps the file. Records read from it stay valid.
+func (m *MappedFile) Close() error {
+	if m.unmap == nil {
+		return nil
+	}
+	err := m.unmap()
+	m.data, m.unmap = nil, nil
+	return err
+}
+
+// blockAt parses the header of the block at offset and checks its sync
+// marker, returning its data and the offset of the next block, or io.EOF
+// at the end of the file.
+func (m *MappedFile) blockAt(offset int64) (BlockInfo, []byte, int64, error) {
+	if offset < m.first || offset > int64(len(m.data)) {
+		return BlockInfo{}, nil, 0, fmt.Errorf("offset %d is outside the blocks", offset)
+	}
+	if offset == int64(len(m.data)) {
+		return BlockInfo{}, nil, 0, io.EOF
+	}
+	rest := m.data[offset:]
+	count, n := binary.Varint(rest)
+	if n <= 0 {
+		return BlockInfo{}, nil, 0, errors.New("cannot read block count: unexpected EOF")
+	}
+	size, n2 := binary.Varint(rest[n:])
+	if n2 <= 0 {
+		return BlockInfo{}, nil, 0, errors.New("cannot read block size: unexpected EOF")
+	}
+	if count < 0 || size < 0 || size > maxBlockBytes {
+		return BlockInfo{}, nil, 0, fmt.Errorf("invalid block of %d records in %d bytes", count, size)
+	}
+	start := int64(n + n2)
+	end := start + size + int64(len(m.h.sync))
+	if end > int64(len(rest)) {
+		return BlockInfo{}, nil, 0, errors.New("cannot read block data: unexpected EOF")
+	}
+	if !bytes.Equal(rest[start+size:end], m.h.sync) {
+		return BlockInfo{}, nil, 0, errors.New("sync marker mismatch")
+	}
+	return BlockInfo{Offset: offset, Records: count, Size: size}, rest[start : start+size], offset + end, nil
+}
+
+// Blocks calls fn with every block from the one at offset on, 0 starting
+// at the first, reading only block headers. An unreadable block ends the
+// walk with a *ScanError, whose Record counts the records walked; fn's
+// errors are returned as is.
+func (m *MappedFile) Blocks(offset int64, fn func(BlockInfo) error) error {
+	if offset == 0 {
+		offset = m.first
+	}
+	n := 0
+	for {
+		info, _, next, err := m.blockAt(offset)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return &ScanError{Record: n, Err: fmt.Errorf("%s: offset %d: %w", m.path, offset, err)}
+		}
+		if err := fn(info); err != nil {
+			return err
+		}
+		n += int(info.Records)
+		offset = next
+	}
+}
+
+// BlockAt decompresses and decodes the block at offset.
+func (m *MappedFile) BlockAt(offset int64) ([]interface{}, error) {
+	info, data, _, err := m.blockAt(offset)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ocf: %s: offset %d: %w", m.path, offset, err)
+	}
+	if m.h.compression == CompressionNull {
+		// goavro's bytes and fixed values point into the data they are
+		// decoded from, which must not be the mapping.
+		data = bytes.Clone(data)
+	}
+	b := &block{count: info.Records, data: data, done: make(chan struct{})}
+	b.decode(m.codec, m.h.compression)
+	if b.err != nil {
+		return nil, fmt.Errorf("ocf: %s: offset %d: %w", m.path, offset, b.err)
+	}
+	return b.records, nil
+}
+
+// Resync returns the offset of the first readable block that starts after
+// offset, found by the sync marker ending the block before it, so a reader
+// can continue past a corrupt block or start mid-file. It reports false
+// when no readable block follows.
+func (m *MappedFile) Resync(offset int64) (int64, bool) {
+	if offset < m.first {
+		offset = m.first
+	}
+	for pos := offset + 1; pos < int64(len(m.data)); {
+		i := bytes.Index(m.data[pos:], m.h.sync)
+		if i < 0 {
+			return 0, false
+		}
+		at := pos + int64(i) + int64(len(m.h.sync))
+		if _, _, _, err := m.blockAt(at); err == nil {
+			return at, true
+		}
+		pos += int64(i) + 1
+	}
+	return 0, false
+}
@@ -0,0 +1,17 @@
+//go:build !unix
+
+package ocf
+
+import (
+	"io"
+	"os"
+)
+
+// mapFile reads f into memory where there is no mmap.
+func mapFile(f *os.File, size int64) ([]byte, func() error, error) {
+	data := make([]byte, size)
+	if _, err := io.ReadFull(f, data); err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return nil }, nil
+}
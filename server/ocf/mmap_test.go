@@ -0,0 +1,142 @@
+package ocf
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/homveloper/exp-avro-json/server/seal"
+	"github.com/linkedin/goavro/v2"
+)
+
+// writeTestFile writes blocks blocks of perBlock events.
+func writeTestFile(t testing.TB, w *os.File, compression string, blocks, perBlock int) {
+	codec, err := goavro.NewCodec(testSchema)
+	if err != nil {
+		t.Fatalf("Failed to compile schema: %v", err)
+	}
+	ow, err := goavro.NewOCFWriter(goavro.OCFConfig{W: w, Codec: codec, CompressionName: compression})
+	if err != nil {
+		t.Fatalf("Failed to create OCF writer: %v", err)
+	}
+	batch := make([]interface{}, perBlock)
+	for b := 0; b < blocks; b++ {
+		for i := range batch {
+			batch[i] = map[string]interface{}{"kind": fmt.Sprintf("event-%d-%d", b, i), "count": int32(b*perBlock + i)}
+		}
+		if err := ow.Append(batch); err != nil {
+			t.Fatalf("Failed to append block: %v", err)
+		}
+	}
+}
+
+func TestMappedFileReadsBlocks(t *testing.T) {
+	for _, compression := range Compressions {
+		path := filepath.Join(t.TempDir(), "events.avro")
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+		writeTestFile(t, f, compression, 4, 5)
+		f.Close()
+
+		var want []int64
+		var wantRecords [][]interface{}
+		f, _ = os.Open(path)
+		ScanBlocks(f, func(offset int64, records []interface{}) error {
+			want, wantRecords = append(want, offset), append(wantRecords, records)
+			return nil
+		})
+		f.Close()
+
+		m, err := Map(path)
+		if err != nil {
+			t.Fatalf("Failed to map %s: %v", path, err)
+		}
+		var blocks []BlockInfo
+		if err := m.Blocks(0, func(b BlockInfo) error { blocks = append(blocks, b); return nil }); err != nil {
+			t.Fatalf("%s: failed to walk blocks: %v", compression, err)
+		}
+		if len(blocks) != len(want) {
+			t.Fatalf("%s: expected %d blocks, got %+v", compression, len(want), blocks)
+		}
+		for i, b := range blocks {
+			if b.Offset != want[i] || b.Records != 5 {
+				t.Errorf("%s: block %d is %+v, expected offset %d", compression, i, b, want[i])
+			}
+		}
+		// Starting at the third block skips the first two.
+		var rest []BlockInfo
+		m.Blocks(want[2], func(b BlockInfo) error { rest = append(rest, b); return nil })
+		if len(rest) != 2 || rest[0].Offset != want[2] {
+			t.Errorf("%s: expected the walk from block 3 to see 2 blocks, got %+v", compression, rest)
+		}
+
+		records, err := m.BlockAt(want[3])
+		if err != nil {
+			t.Fatalf("%s: failed to read block: %v", compression, err)
+		}
+		m.Close()
+		// Records outlive the mapping.
+		if !reflect.DeepEqual(records, wantRecords[3]) {
+			t.Errorf("%s: expected %v, got %v", compression, wantRecords[3], records)
+		}
+	}
+}
+
+func TestMappedFileResync(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.avro")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	writeTestFile(t, f, CompressionNull, 4, 2)
+	f.Close()
+	m, err := Map(path)
+	if err != nil {
+		t.Fatalf("Failed to map file: %v", err)
+	}
+	var offsets []int64
+	m.Blocks(0, func(b BlockInfo) error { offsets = append(offsets, b.Offset); return nil })
+	m.Close()
+
+	// Break the second block's sync marker, which hides where the third
+	// starts too.
+	data, _ := os.ReadFile(path)
+	data[offsets[2]-1] ^= 0xff
+	os.WriteFile(path, data, 0644)
+	if m, err = Map(path); err != nil {
+		t.Fatalf("Failed to map file: %v", err)
+	}
+	defer m.Close()
+	var scanErr *ScanError
+	if err := m.Blocks(0, func(BlockInfo) error { return nil }); !errors.As(err, &scanErr) || scanErr.Record != 2 {
+		t.Errorf("expected the walk to stop after 2 records, got %v", err)
+	}
+	if next, ok := m.Resync(offsets[1]); !ok || next != offsets[3] {
+		t.Errorf("expected to resync at %d, got %d, %v", offsets[3], next, ok)
+	}
+	if _, ok := m.Resync(offsets[3]); ok {
+		t.Error("expected no block after the last one")
+	}
+}
+
+func TestMapRejectsSealedFiles(t *testing.T) {
+	key, err := seal.NewKey(make([]byte, seal.KeySize))
+	if err != nil {
+		t.Fatalf("Failed to create key: %v", err)
+	}
+	w, err := Open(t.TempDir(), testSchema, Options{Key: key})
+	if err != nil {
+		t.Fatalf("Failed to open writer: %v", err)
+	}
+	w.AppendNative(map[string]interface{}{"kind": "click", "count": int32(1)})
+	path := w.Stats().File
+	w.Close()
+	if _, err := Map(path); !errors.Is(err, ErrSealed) {
+		t.Errorf("expected ErrSealed, got %v", err)
+	}
+}
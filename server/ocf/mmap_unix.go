@@ -0,0 +1,20 @@
+//go:build unix
+
+package ocf
+
+import (
+	"os"
+	"syscall"
+)
+
+// mapFile maps size bytes of f read-only; an empty file needs no mapping.
+func mapFile(f *os.File, size int64) ([]byte, func() error, error) {
+	if size == 0 {
+		return nil, func() error { return nil }, nil
+	}
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return syscall.Munmap(data) }, nil
+}
@@ -0,0 +1,121 @@
+package ocf
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+// ScanParallel is Scan with the file's blocks decompressed and decoded by
+// workers goroutines. Records still reach fn one at a time, in file order,
+// on the calling goroutine, and errors are reported as Scan reports them.
+// At most a few blocks per worker are held in memory. workers below 2 scan
+// sequentially.
+func ScanParallel(r io.Reader, workers int, fn func(record interface{}) error) (string, int, error) {
+	if workers < 2 {
+		return Scan(r, fn)
+	}
+	br := bufio.NewReaderSize(r, 1<<16)
+	h, err := readHeader(br)
+	if err != nil {
+		return "", 0, fmt.Errorf("ocf: %w", err)
+	}
+	codec, err := goavro.NewCodec(h.schema)
+	if err != nil {
+		return "", 0, fmt.Errorf("ocf: %w", err)
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	// pending keeps the blocks in file order for the merge below; jobs
+	// hands the same blocks to whichever worker is free.
+	pending := make(chan *block, 2*workers)
+	jobs := make(chan *block, workers)
+	go func() {
+		defer close(pending)
+		defer close(jobs)
+		for {
+			b, err := readBlock(br, h.sync)
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				b = &block{err: err, done: make(chan struct{})}
+				close(b.done)
+				select {
+				case pending <- b:
+				case <-stop:
+				}
+				return
+			}
+			select {
+			case pending <- b:
+			case <-stop:
+				return
+			}
+			select {
+			case jobs <- b:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	for i := 0; i < workers; i++ {
+		go func() {
+			for b := range jobs {
+				b.decode(codec, h.compression)
+			}
+		}()
+	}
+
+	n := 0
+	for b := range pending {
+		<-b.done
+		for _, record := range b.records {
+			if err := fn(record); err != nil {
+				return h.schema, n, err
+			}
+			n++
+		}
+		if b.err != nil {
+			return h.schema, n, &ScanError{Record: n, Err: b.err}
+		}
+	}
+	return h.schema, n, nil
+}
+
+// readBlock reads the next block, returning io.EOF at the clean end of the
+// file.
+func readBlock(r *bufio.Reader, sync []byte) (*block, error) {
+	count, err := binary.ReadVarint(r)
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read block count: %w", err)
+	}
+	size, err := binary.ReadVarint(r)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read block size: %w", unexpectedEOF(err))
+	}
+	if count < 0 || size < 0 || size > maxBlockBytes {
+		return nil, fmt.Errorf("invalid block of %d records in %d bytes", count, size)
+	}
+	b := &block{count: count, data: make([]byte, size), done: make(chan struct{})}
+	if _, err := io.ReadFull(r, b.data); err != nil {
+		return nil, fmt.Errorf("cannot read block data: %w", unexpectedEOF(err))
+	}
+	marker := make([]byte, len(sync))
+	if _, err := io.ReadFull(r, marker); err != nil {
+		return nil, fmt.Errorf("cannot read sync marker: %w", unexpectedEOF(err))
+	}
+	if !bytes.Equal(marker, sync) {
+		return nil, errors.New("sync marker mismatch")
+	}
+	return b, nil
+}
@@ -0,0 +1,125 @@
+package ocf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func scanAll(t *testing.T, data []byte, workers int) ([]interface{}, int, error) {
+	var records []interface{}
+	_, n, err := ScanParallel(bytes.NewReader(data), workers, func(record interface{}) error {
+		records = append(records, record)
+		return nil
+	})
+	return records, n, err
+}
+
+func TestScanParallelMatchesScan(t *testing.T) {
+	for _, compression := range Compressions {
+		path := filepath.Join(t.TempDir(), "events.avro")
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+		writeTestFile(t, f, compression, 37, 11)
+		f.Close()
+		data, _ := os.ReadFile(path)
+
+		want, wantN, err := scanAll(t, data, 1)
+		if err != nil || wantN != 37*11 {
+			t.Fatalf("%s: sequential scan read %d records: %v", compression, wantN, err)
+		}
+		got, n, err := scanAll(t, data, 4)
+		if err != nil {
+			t.Fatalf("%s: Failed to scan in parallel: %v", compression, err)
+		}
+		if n != wantN || !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: parallel scan read %d records out of order or differently", compression, n)
+		}
+
+		// A file cut inside its last block fails like Scan does, after
+		// every complete block.
+		cut := data[:len(data)-20]
+		_, seqN, seqErr := scanAll(t, cut, 1)
+		_, parN, parErr := scanAll(t, cut, 4)
+		var scanErr *ScanError
+		if !errors.As(parErr, &scanErr) || !errors.As(seqErr, &scanErr) || parN != seqN || parN != 36*11 {
+			t.Errorf("%s: truncated file gave %d records (%v), sequential %d (%v)", compression, parN, parErr, seqN, seqErr)
+		}
+	}
+}
+
+func TestScanParallelStopsOnCallbackError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.avro")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	writeTestFile(t, f, CompressionNull, 50, 10)
+	f.Close()
+	data, _ := os.ReadFile(path)
+
+	stop := errors.New("stop")
+	_, n, err := ScanParallel(bytes.NewReader(data), 4, func(record interface{}) error {
+		if record.(map[string]interface{})["count"].(int32) == 123 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || n != 123 {
+		t.Errorf("expected the callback's error after 123 records, got %d: %v", n, err)
+	}
+
+	if _, _, err := ScanParallel(bytes.NewReader([]byte("not an OCF file")), 4, func(interface{}) error { return nil }); err == nil {
+		t.Error("expected an invalid header to be rejected")
+	}
+}
+
+// benchmarkScan reads a deflate file holding OCF_BENCH_MB megabytes of
+// records (default 64), written once to the temp directory and reused.
+// Throughput is reported against the compressed file size. Set
+// OCF_BENCH_MB=4096 to compare on multi-GB partitions:
+//
+//	OCF_BENCH_MB=4096 go test ./ocf -run '^$' -bench Scan -benchtime 1x
+func benchmarkScan(b *testing.B, workers int) {
+	mb := 64
+	if v, err := strconv.Atoi(os.Getenv("OCF_BENCH_MB")); err == nil && v > 0 {
+		mb = v
+	}
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("ocf-bench-%dmb.avro", mb))
+	if _, err := os.Stat(path); err != nil {
+		f, err := os.Create(path)
+		if err != nil {
+			b.Fatalf("Failed to create file: %v", err)
+		}
+		// About 40 bytes per event before compression.
+		writeTestFile(b, f, CompressionDeflate, mb*(1<<20)/(500*40), 500)
+		f.Close()
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		b.Fatalf("Failed to stat %s: %v", path, err)
+	}
+	b.SetBytes(info.Size())
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f, err := os.Open(path)
+		if err != nil {
+			b.Fatalf("Failed to open %s: %v", path, err)
+		}
+		if _, _, err := ScanParallel(f, workers, func(interface{}) error { return nil }); err != nil {
+			b.Fatalf("Failed to scan: %v", err)
+		}
+		f.Close()
+	}
+}
+
+func BenchmarkScanSequential(b *testing.B) { benchmarkScan(b, 1) }
+func BenchmarkScanParallel4(b *testing.B)  { benchmarkScan(b, 4) }
+func BenchmarkScanParallel8(b *testing.B)  { benchmarkScan(b, 8) }
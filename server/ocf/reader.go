@@ -0,0 +1,211 @@
+package ocf
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/homveloper/exp-avro-json/server/seal"
+	"github.com/linkedin/goavro/v2"
+)
+
+// ScanError reports a block or record Scan could not read, as opposed to
+// an error returned by the callback. A file that is still being appended to
+// can end in an incomplete block.
+type ScanError struct {
+	Record int // records read before the failure
+	Err    error
+}
+
+func (e *ScanError) Error() string { return fmt.Sprintf("ocf: record %d: %v", e.Record, e.Err) }
+
+func (e *ScanError) Unwrap() error { return e.Err }
+
+// Scan reads the Object Container File in r, calling fn with every record
+// in goavro's native form, and returns the writer schema from the file's
+// header and the number of records read. An unreadable block ends the scan
+// with a *ScanError; fn's errors are returned as is.
+func Scan(r io.Reader, fn func(record interface{}) error) (string, int, error) {
+	reader, err := goavro.NewOCFReader(r)
+	if err != nil {
+		return "", 0, fmt.Errorf("ocf: %w", err)
+	}
+	schema := reader.Codec().Schema()
+	n := 0
+	for reader.Scan() {
+		record, err := reader.Read()
+		if err != nil {
+			return schema, n, &ScanError{Record: n, Err: err}
+		}
+		if err := fn(record); err != nil {
+			return schema, n, err
+		}
+		n++
+	}
+	if err := reader.Err(); err != nil {
+		return schema, n, &ScanError{Record: n, Err: err}
+	}
+	return schema, n, nil
+}
+
+// ErrSealed is returned by OpenFile for an encrypted file opened without
+// a key.
+var ErrSealed = errors.New("ocf: file is encrypted")
+
+// OpenFile opens the container file at path for Scan or goavro's reader.
+// Files written with Options.Key need the same key, which decrypts them as
+// they are read; a nil key opens plain files only. A sealed file the
+// writer did not close fails at its end with seal.ErrUnfinished.
+func OpenFile(path string, key *seal.Key) (io.ReadCloser, error) {
+	return openFile(path, key, false)
+}
+
+// OpenLiveFile is OpenFile for a file that may still be appended to: a
+// sealed one ends after its last complete frame.
+func OpenLiveFile(path string, key *seal.Key) (io.ReadCloser, error) {
+	return openFile(path, key, true)
+}
+
+func openFile(path string, key *seal.Key, live bool) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(f)
+	head, _ := br.Peek(seal.HeaderSize)
+	if key == nil {
+		if seal.IsSealed(head) {
+			f.Close()
+			return nil, fmt.Errorf("%w: %s", ErrSealed, path)
+		}
+		return readCloser{br, f}, nil
+	}
+	if live {
+		return readCloser{key.NewLiveReader(br), f}, nil
+	}
+	return readCloser{key.NewReader(br), f}, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// ocfMagic starts every Object Container File.
+var ocfMagic = []byte("Obj\x01")
+
+type header struct {
+	schema      string
+	compression string
+	sync        []byte
+}
+
+// readHeader reads the magic, the metadata map and the sync marker.
+func readHeader(r *bufio.Reader) (*header, error) {
+	magic := make([]byte, len(ocfMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, fmt.Errorf("cannot read magic: %w", err)
+	}
+	if !bytes.Equal(magic, ocfMagic) {
+		return nil, fmt.Errorf("invalid magic %q", magic)
+	}
+	meta := make(map[string][]byte)
+	for {
+		count, err := binary.ReadVarint(r)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read metadata: %w", err)
+		}
+		if count == 0 {
+			break
+		}
+		if count < 0 {
+			// A negative count is followed by the block's size in bytes.
+			count = -count
+			if _, err := binary.ReadVarint(r); err != nil {
+				return nil, fmt.Errorf("cannot read metadata: %w", err)
+			}
+		}
+		for i := int64(0); i < count; i++ {
+			key, err := readBytes(r)
+			if err != nil {
+				return nil, fmt.Errorf("cannot read metadata: %w", err)
+			}
+			value, err := readBytes(r)
+			if err != nil {
+				return nil, fmt.Errorf("cannot read metadata: %w", err)
+			}
+			meta[string(key)] = value
+		}
+	}
+	h := &header{schema: string(meta["avro.schema"]), compression: string(meta["avro.codec"]), sync: make([]byte, 16)}
+	if h.schema == "" {
+		return nil, errors.New("header has no avro.schema")
+	}
+	if h.compression == "" {
+		h.compression = CompressionNull
+	}
+	if err := CheckCompression(h.compression); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(r, h.sync); err != nil {
+		return nil, fmt.Errorf("cannot read sync marker: %w", err)
+	}
+	return h, nil
+}
+
+// maxBlockBytes bounds the allocation a corrupt block size can cause.
+const maxBlockBytes = 1 << 30
+
+// block is one container file block on its way through a worker.
+type block struct {
+	count   int64
+	data    []byte
+	records []interface{}
+	err     error
+	done    chan struct{}
+}
+
+// decode fills b.records, keeping the records before a failing one like
+// goavro's reader does.
+func (b *block) decode(codec *goavro.Codec, compression string) {
+	defer close(b.done)
+	data, err := decompressBlock(compression, b.data)
+	if err != nil {
+		b.err = err
+		return
+	}
+	b.data = nil
+	b.records = make([]interface{}, 0, b.count)
+	for i := int64(0); i < b.count; i++ {
+		var record interface{}
+		if record, data, err = codec.NativeFromBinary(data); err != nil {
+			b.err = fmt.Errorf("cannot decode record: %w", err)
+			return
+		}
+		b.records = append(b.records, record)
+	}
+}
+
+func readBytes(r *bufio.Reader) ([]byte, error) {
+	size, err := binary.ReadVarint(r)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if size < 0 || size > maxBlockBytes {
+		return nil, fmt.Errorf("invalid length %d", size)
+	}
+	buf := make([]byte, size)
+	_, err = io.ReadFull(r, buf)
+	return buf, unexpectedEOF(err)
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,386 @@
+// Package ocf writes Avro Object Container Files: self-describing files that
+// embed the writer schema in their header and separate blocks of records
+// with sync markers, so standard Avro tooling (avro-tools, fastavro, Spark)
+// can read the logs without knowing the schema in advance.
+package ocf
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/homveloper/exp-avro-json/server/ids"
+	"github.com/homveloper/exp-avro-json/server/seal"
+	"github.com/linkedin/goavro/v2"
+)
+
+// Options configures a Writer.
+type Options struct {
+	// Prefix starts every file name; files are named <prefix>-<id>.avro.
+	Prefix string
+	// IDs names the files. IDs sort in creation order, so listing a
+	// stream's files by name lists them oldest first. Nil uses a ULID
+	// generator.
+	IDs ids.Generator
+	// MaxRecords rolls over to a new file after this many records. Zero
+	// keeps appending to one file for the writer's lifetime.
+	MaxRecords int
+	// Compression is the block codec, one of Compressions; empty means
+	// CompressionNull. It is recorded in each file's header.
+	Compression string
+	// BlockRecords and SyncInterval batch appended records into larger
+	// blocks: a block is written once it holds BlockRecords records or
+	// SyncInterval bytes of uncompressed binary, whichever comes first,
+	// like the sync interval of Avro's Java DataFileWriter. Zero disables
+	// that limit; with both zero, or BlockRecords 1, every append is its
+	// own block. Larger blocks compress better but records are not in the
+	// file until their block is written.
+	BlockRecords int
+	SyncInterval int
+	// FlushInterval writes a partly filled block once its first record has
+	// waited this long, bounding how stale the files are. Zero waits for
+	// the block to fill, a roll-over, Flush or Close.
+	FlushInterval time.Duration
+	// Key, when set, encrypts the files: each is a sealed stream whose
+	// frames are the header and the blocks, ended when the file is closed,
+	// readable with OpenFile and the same key but no longer by other Avro
+	// tools.
+	Key *seal.Key
+	// OnFileClosed, when set, is called with the path of each file once it
+	// is complete: on roll-over and on Close. It runs with the writer
+	// locked, so it must not block or call back into the writer.
+	OnFileClosed func(path string)
+	// OnBlock, when set, is called after each block is written with the
+	// file's path, the block's offset in the file, as ReadBlockAt takes
+	// it, and the block's records. Offsets in sealed files count the
+	// decrypted stream. Like OnFileClosed it runs with the writer locked.
+	OnBlock func(path string, offset int64, records []interface{})
+}
+
+// Stats describes what a Writer has written since it was opened.
+type Stats struct {
+	File    string `json:"file"`
+	Files   int64  `json:"files"`
+	Records int64  `json:"records"`
+	Blocks  int64  `json:"blocks"`
+	// Buffered counts records waiting for their block to be written; they
+	// are not in Records yet.
+	Buffered int64 `json:"buffered"`
+}
+
+// ErrClosed is returned by Append after Close.
+var ErrClosed = errors.New("ocf: writer closed")
+
+// Writer appends records of one schema to rolling container files in a
+// directory. It is safe for concurrent use.
+type Writer struct {
+	dir   string
+	codec *goavro.Codec
+	opts  Options
+
+	mu     sync.Mutex
+	file   *os.File
+	ocf    *goavro.OCFWriter
+	out    *countingWriter
+	sealer *seal.Writer
+	inFile int
+	stats  Stats
+	closed bool
+
+	// buf holds the records of the block being filled, bufBytes their
+	// binary size, and flushErr the failure of a timed flush, returned by
+	// the next call.
+	buf      []interface{}
+	bufBytes int
+	timer    *time.Timer
+	flushErr error
+}
+
+// Open creates dir if needed and returns a writer for records of schema.
+// The first file is created on the first Append.
+func Open(dir, schema string, opts Options) (*Writer, error) {
+	codec, err := goavro.NewCodec(schema)
+	if err != nil {
+		return nil, fmt.Errorf("ocf: %w", err)
+	}
+	if opts.Prefix == "" {
+		opts.Prefix = "log"
+	}
+	if opts.IDs == nil {
+		opts.IDs = ids.NewULID()
+	}
+	if opts.Compression == "" {
+		opts.Compression = CompressionNull
+	}
+	if err := CheckCompression(opts.Compression); err != nil {
+		return nil, err
+	}
+	if opts.MaxRecords < 0 {
+		return nil, fmt.Errorf("ocf: negative MaxRecords %d", opts.MaxRecords)
+	}
+	if opts.BlockRecords < 0 || opts.SyncInterval < 0 || opts.FlushInterval < 0 {
+		return nil, fmt.Errorf("ocf: negative block limit")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Writer{dir: dir, codec: codec, opts: opts}, nil
+}
+
+// Dir returns the directory the writer's files are created in.
+func (w *Writer) Dir() string { return w.dir }
+
+// Prefix returns the prefix of the writer's file names.
+func (w *Writer) Prefix() string { return w.opts.Prefix }
+
+// Compression returns the writer's block codec.
+func (w *Writer) Compression() string { return w.opts.Compression }
+
+// Append adds one datum, given as Avro binary of the writer's schema. It is
+// its own block, readable as soon as Append returns, unless the options
+// batch records into larger blocks.
+func (w *Writer) Append(binary []byte) error {
+	native, rest, err := w.codec.NativeFromBinary(binary)
+	if err != nil {
+		return fmt.Errorf("ocf: %w", err)
+	}
+	if len(rest) > 0 {
+		return fmt.Errorf("ocf: %d trailing bytes after datum", len(rest))
+	}
+	return w.add([]interface{}{native}, len(binary))
+}
+
+// AppendNative adds records in goavro's native form, as one block unless
+// the options batch records into larger blocks.
+func (w *Writer) AppendNative(records ...interface{}) error {
+	size := 0
+	if w.batching() && w.opts.SyncInterval > 0 {
+		for _, record := range records {
+			binary, err := w.codec.BinaryFromNative(nil, record)
+			if err != nil {
+				return fmt.Errorf("ocf: %w", err)
+			}
+			size += len(binary)
+		}
+	}
+	return w.add(records, size)
+}
+
+// batching reports whether appends are collected into larger blocks.
+func (w *Writer) batching() bool {
+	return w.opts.BlockRecords > 1 || (w.opts.BlockRecords == 0 && w.opts.SyncInterval > 0)
+}
+
+func (w *Writer) add(records []interface{}, size int) error {
+	if len(records) == 0 {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return ErrClosed
+	}
+	if err := w.flushErr; err != nil {
+		w.flushErr = nil
+		return err
+	}
+	if !w.batching() {
+		return w.writeBlock(records)
+	}
+	w.buf = append(w.buf, records...)
+	w.bufBytes += size
+	w.stats.Buffered = int64(len(w.buf))
+	full := (w.opts.BlockRecords > 0 && len(w.buf) >= w.opts.BlockRecords) ||
+		(w.opts.SyncInterval > 0 && w.bufBytes >= w.opts.SyncInterval)
+	if room := w.opts.MaxRecords - w.inFile; w.opts.MaxRecords > 0 {
+		// A block never spans files, so one that fills the file is
+		// written now. A full file is rolled by the next block.
+		if room <= 0 {
+			room = w.opts.MaxRecords
+		}
+		full = full || len(w.buf) >= room
+	}
+	if full {
+		return w.flushLocked()
+	}
+	if w.timer == nil && w.opts.FlushInterval > 0 {
+		w.timer = time.AfterFunc(w.opts.FlushInterval, w.timedFlush)
+	}
+	return nil
+}
+
+func (w *Writer) timedFlush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.timer = nil
+	if err := w.flushLocked(); err != nil {
+		w.flushErr = err
+	}
+}
+
+// Flush writes the records waiting for their block to fill.
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.flushErr; err != nil {
+		w.flushErr = nil
+		return err
+	}
+	return w.flushLocked()
+}
+
+// Sync flushes like Flush and commits the current file to stable storage.
+func (w *Writer) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.flushErr; err != nil {
+		w.flushErr = nil
+		return err
+	}
+	if err := w.flushLocked(); err != nil {
+		return err
+	}
+	if w.file == nil {
+		return nil
+	}
+	return w.file.Sync()
+}
+
+func (w *Writer) flushLocked() error {
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	if len(w.buf) == 0 {
+		return nil
+	}
+	records := w.buf
+	w.buf, w.bufBytes, w.stats.Buffered = nil, 0, 0
+	return w.writeBlock(records)
+}
+
+// writeBlock writes records as one block, rolling over first if the
+// current file is full.
+func (w *Writer) writeBlock(records []interface{}) error {
+	if w.ocf == nil || (w.opts.MaxRecords > 0 && w.inFile+len(records) > w.opts.MaxRecords && w.inFile > 0) {
+		if err := w.roll(); err != nil {
+			return err
+		}
+	}
+	offset := w.out.n
+	if err := w.ocf.Append(records); err != nil {
+		return fmt.Errorf("ocf: %s: %w", w.file.Name(), err)
+	}
+	w.inFile += len(records)
+	w.stats.Records += int64(len(records))
+	w.stats.Blocks++
+	if w.opts.OnBlock != nil {
+		w.opts.OnBlock(w.file.Name(), offset, records)
+	}
+	return nil
+}
+
+// roll closes the current file and starts the next one.
+func (w *Writer) roll() error {
+	if err := w.closeFile(); err != nil {
+		return err
+	}
+	var file *os.File
+	for {
+		// IDs are unique per generator; another process sharing the
+		// directory could still have taken the name.
+		name := w.opts.Prefix + "-" + w.opts.IDs.New() + ".avro"
+		var err error
+		file, err = os.OpenFile(filepath.Join(w.dir, name), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return err
+		}
+	}
+	var sink io.Writer = file
+	var sealer *seal.Writer
+	if w.opts.Key != nil {
+		sealer = w.opts.Key.NewWriter(file)
+		sink = sealer
+	}
+	out := &countingWriter{w: sink}
+	ocf, err := goavro.NewOCFWriter(goavro.OCFConfig{W: out, Codec: w.codec, CompressionName: w.opts.Compression})
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return fmt.Errorf("ocf: %w", err)
+	}
+	w.file, w.ocf, w.out, w.sealer, w.inFile = file, ocf, out, sealer, 0
+	w.stats.File = file.Name()
+	w.stats.Files++
+	return nil
+}
+
+func (w *Writer) closeFile() error {
+	if w.file == nil {
+		return nil
+	}
+	path := w.file.Name()
+	var err error
+	if w.sealer != nil {
+		err = w.sealer.Close()
+	}
+	err = errors.Join(err, w.file.Close())
+	w.file, w.ocf, w.out, w.sealer = nil, nil, nil, nil
+	if err == nil && w.opts.OnFileClosed != nil {
+		w.opts.OnFileClosed(path)
+	}
+	return err
+}
+
+// Current returns the path of the file being written, or "" between files
+// and after Close. Every other file of the writer is complete.
+func (w *Writer) Current() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return ""
+	}
+	return w.file.Name()
+}
+
+// Stats returns the writer's totals and current file.
+func (w *Writer) Stats() Stats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.stats
+}
+
+// Close writes any buffered records and closes the current file.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	err := w.flushLocked()
+	if err == nil {
+		err, w.flushErr = w.flushErr, nil
+	}
+	return errors.Join(err, w.closeFile())
+}
+
+// countingWriter counts the bytes written through it, which are the
+// offsets of the blocks goavro writes with one Write each.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,316 @@
+package ocf
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/homveloper/exp-avro-json/server/seal"
+	"github.com/linkedin/goavro/v2"
+)
+
+const testSchema = `{"type":"record","name":"Event","fields":[{"name":"kind","type":"string"},{"name":"count","type":"int"}]}`
+
+func TestWriterAppendsAndRolls(t *testing.T) {
+	dir := t.TempDir()
+	var closed []string
+	w, err := Open(dir, testSchema, Options{Prefix: "events", MaxRecords: 2, OnFileClosed: func(path string) { closed = append(closed, path) }})
+	if err != nil {
+		t.Fatalf("Failed to open writer: %v", err)
+	}
+	codec, _ := goavro.NewCodec(testSchema)
+	var binary []byte
+	for i := 0; i < 3; i++ {
+		binary, err = codec.BinaryFromNative(nil, map[string]interface{}{"kind": "click", "count": i})
+		if err != nil {
+			t.Fatalf("Failed to encode event: %v", err)
+		}
+		if err := w.Append(binary); err != nil {
+			t.Fatalf("Failed to append event: %v", err)
+		}
+	}
+	if current := w.Current(); current == "" || len(closed) != 1 || current == closed[0] {
+		t.Errorf("expected the second file to be current, got %q after %v", current, closed)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to close writer: %v", err)
+	}
+	if current := w.Current(); current != "" {
+		t.Errorf("expected no current file after Close, got %q", current)
+	}
+	if err := w.Append(binary); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed after Close, got %v", err)
+	}
+	stats := w.Stats()
+	if stats.Files != 2 || stats.Records != 3 || stats.Blocks != 3 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "events-*.avro"))
+	if len(files) != 2 {
+		t.Fatalf("Expected 2 files, found %v", files)
+	}
+	if strings.Join(closed, " ") != strings.Join(files, " ") {
+		t.Errorf("expected OnFileClosed for %v in order, got %v", files, closed)
+	}
+	var counts []int32
+	for _, path := range files {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", path, err)
+		}
+		r, err := goavro.NewOCFReader(f)
+		if err != nil {
+			t.Fatalf("Failed to read OCF header of %s: %v", path, err)
+		}
+		if r.Codec().CanonicalSchema() != codec.CanonicalSchema() {
+			t.Errorf("%s embeds schema %s", path, r.Codec().Schema())
+		}
+		for r.Scan() {
+			record, err := r.Read()
+			if err != nil {
+				t.Fatalf("Failed to read record: %v", err)
+			}
+			counts = append(counts, record.(map[string]interface{})["count"].(int32))
+		}
+		f.Close()
+	}
+	if len(counts) != 3 || counts[0] != 0 || counts[2] != 2 {
+		t.Errorf("unexpected records %v", counts)
+	}
+}
+
+func TestWriterRejectsForeignData(t *testing.T) {
+	w, err := Open(t.TempDir(), testSchema, Options{})
+	if err != nil {
+		t.Fatalf("Failed to open writer: %v", err)
+	}
+	defer w.Close()
+	if err := w.Append([]byte{0x02}); err == nil {
+		t.Error("Expected a truncated datum to be rejected")
+	}
+	if _, err := Open(t.TempDir(), `{"type":"nope"}`, Options{}); err == nil {
+		t.Error("Expected an invalid schema to be rejected")
+	}
+}
+
+func TestScanReadsWriterOutput(t *testing.T) {
+	dir := t.TempDir()
+	w, err := Open(dir, testSchema, Options{})
+	if err != nil {
+		t.Fatalf("Failed to open writer: %v", err)
+	}
+	records := []interface{}{
+		map[string]interface{}{"kind": "a", "count": 1},
+		map[string]interface{}{"kind": "b", "count": 2},
+	}
+	if err := w.AppendNative(records...); err != nil {
+		t.Fatalf("Failed to append records: %v", err)
+	}
+	path := w.Stats().File
+	w.Close()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", path, err)
+	}
+	defer f.Close()
+	var kinds []string
+	schema, n, err := Scan(f, func(record interface{}) error {
+		kinds = append(kinds, record.(map[string]interface{})["kind"].(string))
+		return nil
+	})
+	if err != nil || n != 2 || len(kinds) != 2 || kinds[1] != "b" {
+		t.Fatalf("unexpected scan result %v (%d records): %v", kinds, n, err)
+	}
+	if codec, _ := goavro.NewCodec(schema); codec == nil {
+		t.Errorf("header schema %s does not compile", schema)
+	}
+
+	if _, _, err := Scan(strings.NewReader("not an ocf"), func(interface{}) error { return nil }); err == nil {
+		t.Error("Expected an error for a non-OCF stream")
+	}
+}
+
+// blockCounts returns the record count of each block in the file at path.
+func blockCounts(t *testing.T, path string) []int64 {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", path, err)
+	}
+	defer f.Close()
+	br := bufio.NewReader(f)
+	h, err := readHeader(br)
+	if err != nil {
+		t.Fatalf("Failed to read header of %s: %v", path, err)
+	}
+	var counts []int64
+	for {
+		b, err := readBlock(br, h.sync)
+		if err == io.EOF {
+			return counts
+		}
+		if err != nil {
+			t.Fatalf("Failed to read block of %s: %v", path, err)
+		}
+		counts = append(counts, b.count)
+	}
+}
+
+func TestWriterBatchesBlocks(t *testing.T) {
+	dir := t.TempDir()
+	w, err := Open(dir, testSchema, Options{Prefix: "events", MaxRecords: 10, BlockRecords: 4})
+	if err != nil {
+		t.Fatalf("Failed to open writer: %v", err)
+	}
+	for i := 0; i < 11; i++ {
+		if err := w.AppendNative(map[string]interface{}{"kind": "click", "count": i}); err != nil {
+			t.Fatalf("Failed to append event: %v", err)
+		}
+	}
+	// The third block is cut short so it does not cross into the next file.
+	if stats := w.Stats(); stats.Records != 10 || stats.Blocks != 3 || stats.Buffered != 1 || stats.Files != 1 {
+		t.Errorf("unexpected stats before flush %+v", stats)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	if stats := w.Stats(); stats.Records != 11 || stats.Buffered != 0 || stats.Files != 2 {
+		t.Errorf("unexpected stats after flush %+v", stats)
+	}
+	w.Close()
+	files, _ := filepath.Glob(filepath.Join(dir, "events-*.avro"))
+	if len(files) != 2 {
+		t.Fatalf("Expected 2 files, found %v", files)
+	}
+	if got := blockCounts(t, files[0]); !reflect.DeepEqual(got, []int64{4, 4, 2}) {
+		t.Errorf("first file has blocks of %v records", got)
+	}
+
+	// SyncInterval cuts blocks by size: every event here is 8 bytes.
+	dir = t.TempDir()
+	w, err = Open(dir, testSchema, Options{SyncInterval: 24})
+	if err != nil {
+		t.Fatalf("Failed to open writer: %v", err)
+	}
+	codec, _ := goavro.NewCodec(testSchema)
+	for i := 0; i < 7; i++ {
+		binary, _ := codec.BinaryFromNative(nil, map[string]interface{}{"kind": "scroll", "count": i})
+		if err := w.Append(binary); err != nil {
+			t.Fatalf("Failed to append event: %v", err)
+		}
+	}
+	path := w.Stats().File
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to close writer: %v", err)
+	}
+	if got := blockCounts(t, path); !reflect.DeepEqual(got, []int64{3, 3, 1}) {
+		t.Errorf("expected Close to write the partial block: blocks of %v records", got)
+	}
+
+	if _, err := Open(t.TempDir(), testSchema, Options{BlockRecords: -1}); err == nil {
+		t.Error("Expected a negative block limit to be rejected")
+	}
+}
+
+func TestWriterFlushInterval(t *testing.T) {
+	w, err := Open(t.TempDir(), testSchema, Options{BlockRecords: 100, FlushInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Failed to open writer: %v", err)
+	}
+	defer w.Close()
+	if err := w.AppendNative(map[string]interface{}{"kind": "click", "count": 1}); err != nil {
+		t.Fatalf("Failed to append event: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for w.Stats().Records == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the buffered record to be written, stats %+v", w.Stats())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if stats := w.Stats(); stats.Blocks != 1 || stats.Buffered != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestWriterEncryptsFiles(t *testing.T) {
+	key, err := seal.NewKey(make([]byte, seal.KeySize))
+	if err != nil {
+		t.Fatalf("Failed to create key: %v", err)
+	}
+	w, err := Open(t.TempDir(), testSchema, Options{Key: key, Compression: CompressionDeflate})
+	if err != nil {
+		t.Fatalf("Failed to open writer: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := w.AppendNative(map[string]interface{}{"kind": "purchase", "count": i}); err != nil {
+			t.Fatalf("Failed to append event: %v", err)
+		}
+	}
+	path := w.Stats().File
+	w.Close()
+
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "Event") {
+		t.Error("expected the embedded schema to be encrypted")
+	}
+	if _, err := OpenFile(path, nil); !errors.Is(err, ErrSealed) {
+		t.Errorf("expected ErrSealed without a key, got %v", err)
+	}
+	f, err := OpenFile(path, key)
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", path, err)
+	}
+	defer f.Close()
+	if _, n, err := Scan(f, func(interface{}) error { return nil }); err != nil || n != 3 {
+		t.Errorf("read %d records: %v", n, err)
+	}
+}
+
+func TestSealedFileEndsOnClose(t *testing.T) {
+	key, err := seal.NewKey(make([]byte, seal.KeySize))
+	if err != nil {
+		t.Fatalf("Failed to create key: %v", err)
+	}
+	w, err := Open(t.TempDir(), testSchema, Options{Key: key})
+	if err != nil {
+		t.Fatalf("Failed to open writer: %v", err)
+	}
+	defer w.Close()
+	if err := w.AppendNative(map[string]interface{}{"kind": "purchase", "count": 1}); err != nil {
+		t.Fatalf("Failed to append event: %v", err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	path := w.Current()
+
+	scan := func(open func(string, *seal.Key) (io.ReadCloser, error)) (int, error) {
+		f, err := open(path, key)
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", path, err)
+		}
+		defer f.Close()
+		_, n, err := Scan(f, func(interface{}) error { return nil })
+		return n, err
+	}
+	// Until the writer closes the file, it only reads as a live file.
+	var scanErr *ScanError
+	if n, err := scan(OpenFile); n != 1 || !errors.As(err, &scanErr) {
+		t.Errorf("expected the open file to end unfinished after 1 record, got %d: %v", n, err)
+	}
+	if n, err := scan(OpenLiveFile); n != 1 || err != nil {
+		t.Errorf("live read gave %d records: %v", n, err)
+	}
+	w.Close()
+	if n, err := scan(OpenFile); n != 1 || err != nil {
+		t.Errorf("closed file read %d records: %v", n, err)
+	}
+}
@@ -0,0 +1,91 @@
+// OCF 튜닝 벤치마크 실행 방법:
+// 1. 전체 스윕 실행: go test -run=^$ -bench=OCFTuning -benchmem
+// 2. 코덱 하나만 실행: go test -run=^$ -bench='OCFTuning/deflate' -benchmem
+// bytes/log 는 로그 하나가 OCF 파일에서 차지하는 크기 (wrapper + logdata),
+// MB/s 는 같은 로그의 JSON 크기 기준 처리량이다.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/homveloper/exp-avro-json/server/ocf"
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+)
+
+// ocfTuningSweep lists the block limits the sweep tries with every codec:
+// one block per log, as the server writes by default, then blocks cut by
+// record count and by Avro's byte-based sync interval.
+var ocfTuningSweep = []struct {
+	blockRecords, syncInterval int
+}{
+	{1, 0},
+	{16, 0},
+	{128, 0},
+	{1024, 0},
+	{0, 16 << 10},
+	{0, 64 << 10},
+	{0, 256 << 10},
+}
+
+// tuningPayloads encodes warm-up logs, whose domain data varies in size
+// like the logs clients send, and returns them with their mean JSON size.
+func tuningPayloads(b *testing.B) ([]*avrojson.EncodedLog, int) {
+	logs := make([]*avrojson.EncodedLog, 256)
+	jsonBytes := 0
+	for i := range logs {
+		req := warmupPayload(i)
+		encoded, err := encodeLogRequest(req)
+		if err != nil {
+			b.Fatalf("Failed to encode log: %v", err)
+		}
+		data, _ := json.Marshal(req)
+		jsonBytes += len(data)
+		logs[i] = encoded
+	}
+	return logs, jsonBytes / len(logs)
+}
+
+func BenchmarkOCFTuning(b *testing.B) {
+	logs, jsonSize := tuningPayloads(b)
+	for _, compression := range ocf.Compressions {
+		for _, sweep := range ocfTuningSweep {
+			name := fmt.Sprintf("%s/records=%d/sync=%d", compression, sweep.blockRecords, sweep.syncInterval)
+			b.Run(name, func(b *testing.B) {
+				dir := b.TempDir()
+				var store ocfStore
+				tuning := ocfTuning{Compression: compression, BlockRecords: sweep.blockRecords, SyncInterval: sweep.syncInterval}
+				if err := store.open(dir, tuning, nil); err != nil {
+					b.Fatalf("Failed to open OCF store: %v", err)
+				}
+				b.SetBytes(int64(jsonSize))
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if err := store.append(logs[i%len(logs)]); err != nil {
+						b.Fatalf("Failed to append log: %v", err)
+					}
+				}
+				if err := store.wrapper.Close(); err != nil {
+					b.Fatalf("Failed to close wrapper stream: %v", err)
+				}
+				if err := store.logData.Close(); err != nil {
+					b.Fatalf("Failed to close log data stream: %v", err)
+				}
+				b.StopTimer()
+
+				paths, _ := filepath.Glob(filepath.Join(dir, "*.avro"))
+				var size int64
+				for _, path := range paths {
+					if info, err := os.Stat(path); err == nil {
+						size += info.Size()
+					}
+				}
+				b.ReportMetric(float64(size)/float64(b.N), "bytes/log")
+			})
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+	"github.com/homveloper/exp-avro-json/server/registry"
+	"go.uber.org/zap"
+)
+
+// Projects pin the LogData version their bodies are stored with, so a new
+// body schema registered by one team does not change another team's
+// records until it moves its pin:
+//
+//	soft  bodies of other versions are resolved to the pinned version, with
+//	      a warning logged
+//	hard  bodies of other versions are rejected with 409
+//
+// JSON /log bodies are of the built-in LogData version; /log/binary bodies
+// are of the version named by X-Avro-Schema-Version, defaulting to the
+// built-in one. Bodies encoded with a logType's own schema (logtypes.go)
+// are not versions of this subject, so pins leave them alone.
+const bodySubject = "LogData"
+
+type setPinRequest struct {
+	Version int    `json:"version" binding:"required"`
+	Mode    string `json:"mode" binding:"required"`
+}
+
+func registerPinRoutes(r *gin.Engine) {
+	r.GET("/pins", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"pins": schemaRegistry.Pins("")})
+	})
+	r.GET("/projects/:project/pin", func(c *gin.Context) {
+		p, ok := schemaRegistry.GetPin(c.Param("project"), bodySubject)
+		if !ok {
+			respondError(c, http.StatusNotFound, codeNotFound, "Project "+strconv.Quote(c.Param("project"))+" has no body schema pin")
+			return
+		}
+		c.JSON(http.StatusOK, p)
+	})
+	r.PUT("/projects/:project/pin", setPinHandler)
+	r.DELETE("/projects/:project/pin", func(c *gin.Context) {
+		project := c.Param("project")
+		if err := schemaRegistry.Unpin(project, bodySubject); err != nil {
+			if errors.Is(err, registry.ErrNotFound) {
+				respondError(c, http.StatusNotFound, codeNotFound, "Project "+strconv.Quote(project)+" has no body schema pin")
+				return
+			}
+			logger.Error("Failed to remove schema pin", zap.String("project", project), zap.Error(err))
+			respondError(c, http.StatusInternalServerError, codeInternal, "Failed to remove schema pin")
+			return
+		}
+		logger.Info("Schema pin removed", zap.String("project", project))
+		c.JSON(http.StatusOK, gin.H{"status": "unpinned", "project": project})
+	})
+}
+
+func setPinHandler(c *gin.Context) {
+	project := c.Param("project")
+	var req setPinRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		requestLogger(c).Error("Failed to bind pin request", zap.Error(err))
+		respondBindError(c, err)
+		return
+	}
+	p, err := schemaRegistry.SetPin(project, bodySubject, req.Version, req.Mode)
+	switch {
+	case errors.Is(err, registry.ErrInvalidPin):
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	case errors.Is(err, registry.ErrNotFound):
+		respondError(c, http.StatusNotFound, codeUnknownSchema, bodySubject+" version "+strconv.Itoa(req.Version)+" is not registered")
+		return
+	case err != nil:
+		requestLogger(c).Error("Failed to set schema pin", zap.String("project", project), zap.Error(err))
+		respondError(c, http.StatusInternalServerError, codeInternal, "Failed to set schema pin")
+		return
+	}
+	requestLogger(c).Info("Schema pinned",
+		zap.String("project", project),
+		zap.Int("version", p.Version),
+		zap.String("mode", p.Mode))
+	c.JSON(http.StatusOK, p)
+}
+
+// applyBodyPin checks an encoded log against its project's pin. A soft pin
+// re-encodes a mismatched body as the pinned version; a hard pin answers
+// 409 and returns false. The returned block describes the pin for the
+// response, and is nil for unpinned projects.
+func applyBodyPin(c *gin.Context, wrapper avrojson.LogWrapper, encoded *avrojson.EncodedLog) (*avrojson.EncodedLog, gin.H, bool) {
+	if schemaRegistry == nil {
+		return encoded, nil, true
+	}
+	pin, ok := schemaRegistry.GetPin(wrapper.ProjectName, bodySubject)
+	if !ok {
+		return encoded, nil, true
+	}
+	payload, err := schemaRegistry.Lookup(encoded.LogDataSchema)
+	if err != nil {
+		requestLogger(c).Error("Failed to look up log body schema", zap.Error(err))
+		respondError(c, http.StatusInternalServerError, codeInternal, "Failed to look up log body schema")
+		return nil, nil, false
+	}
+	if payload.Name != bodySubject {
+		return encoded, nil, true
+	}
+	info := gin.H{
+		"mode":            pin.Mode,
+		"pinned_version":  pin.Version,
+		"payload_version": payload.Version,
+		"resolved":        false,
+	}
+	if payload.Version == pin.Version {
+		return encoded, info, true
+	}
+
+	if pin.Mode == registry.PinHard {
+		respondErrorWith(c, http.StatusConflict, apiError{
+			Code: codeSchemaPinned,
+			Message: "Project " + strconv.Quote(wrapper.ProjectName) + " is pinned to " + bodySubject +
+				" version " + strconv.Itoa(pin.Version) + "; body is version " + strconv.Itoa(payload.Version),
+		}, gin.H{
+			"project":         wrapper.ProjectName,
+			"pinned_version":  pin.Version,
+			"payload_version": payload.Version,
+		})
+		return nil, nil, false
+	}
+
+	pinned, err := resolveSchema(bodySubject, pin.Version)
+	if err == nil {
+		encoded, err = resolveBody(wrapper, encoded, payload, pinned)
+	}
+	if err != nil {
+		requestLogger(c).Error("Failed to resolve log body to pinned version",
+			zap.String("project", wrapper.ProjectName),
+			zap.Int("pinned_version", pin.Version),
+			zap.Int("payload_version", payload.Version),
+			zap.Error(err))
+		respondErrorWith(c, http.StatusUnprocessableEntity, apiError{
+			Code:    codeEncodeFailed,
+			Message: "Body version " + strconv.Itoa(payload.Version) + " cannot be resolved to pinned version " + strconv.Itoa(pin.Version) + ": " + err.Error(),
+		}, gin.H{
+			"project":         wrapper.ProjectName,
+			"pinned_version":  pin.Version,
+			"payload_version": payload.Version,
+		})
+		return nil, nil, false
+	}
+	requestLogger(c).Warn("Log body does not match pinned schema version",
+		zap.String("project", wrapper.ProjectName),
+		zap.Int("pinned_version", pin.Version),
+		zap.Int("payload_version", payload.Version))
+	info["resolved"] = true
+	return encoded, info, true
+}
+
+// resolveBody re-encodes the body of encoded from payload to pinned with
+// Avro schema resolution.
+func resolveBody(wrapper avrojson.LogWrapper, encoded *avrojson.EncodedLog, payload, pinned registry.Schema) (*avrojson.EncodedLog, error) {
+	resolver, err := avrojson.DefaultCache.Resolver(payload.Schema, pinned.Schema)
+	if err != nil {
+		return nil, err
+	}
+	logData, err := resolver.Reencode(encoded.LogData)
+	if err != nil {
+		return nil, err
+	}
+	return avrojson.EncodeLogBinary(wrapper, pinned.Schema, logData)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+)
+
+// logDataV2 adds a defaulted field to the built-in LogData schema.
+func logDataV2(t *testing.T) string {
+	t.Helper()
+	var schema map[string]interface{}
+	if err := json.Unmarshal([]byte(avrojson.LogDataSchema), &schema); err != nil {
+		t.Fatalf("Failed to parse LogData schema: %v", err)
+	}
+	schema["fields"] = append(schema["fields"].([]interface{}),
+		map[string]interface{}{"name": "region", "type": "string", "default": "unknown"})
+	data, _ := json.Marshal(schema)
+	return string(data)
+}
+
+func TestBodySchemaPins(t *testing.T) {
+	r := newSchemaTestEngine(t)
+	registerPinRoutes(r)
+	r.POST("/log", logHandler)
+	r.POST("/log/binary", logBinaryHandler)
+
+	v2 := logDataV2(t)
+	if w := doJSON(r, http.MethodPost, "/schemas", gin.H{"name": "LogData", "schema": v2}); w.Code != http.StatusCreated {
+		t.Fatalf("Failed to register LogData v2: %d %s", w.Code, w.Body.String())
+	}
+	project := warmupPayload(1).ProjectName
+
+	if w := doJSON(r, http.MethodPut, "/projects/"+project+"/pin", gin.H{"version": 9, "mode": "soft"}); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 pinning an unregistered version, got %d", w.Code)
+	}
+	if w := doJSON(r, http.MethodPut, "/projects/"+project+"/pin", gin.H{"version": 2, "mode": "soft"}); w.Code != http.StatusOK {
+		t.Fatalf("Failed to set soft pin: %d %s", w.Code, w.Body.String())
+	}
+	w := doJSON(r, http.MethodPost, "/log", warmupPayload(1))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected soft pin to accept a v1 body, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		SchemaPin struct {
+			Mode           string `json:"mode"`
+			PinnedVersion  int    `json:"pinned_version"`
+			PayloadVersion int    `json:"payload_version"`
+			Resolved       bool   `json:"resolved"`
+		} `json:"schema_pin"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if pin := resp.SchemaPin; pin.Mode != "soft" || pin.PinnedVersion != 2 || pin.PayloadVersion != 1 || !pin.Resolved {
+		t.Errorf("unexpected schema_pin: %s", w.Body.String())
+	}
+
+	if w := doJSON(r, http.MethodPut, "/projects/"+project+"/pin", gin.H{"version": 2, "mode": "hard"}); w.Code != http.StatusOK {
+		t.Fatalf("Failed to set hard pin: %d %s", w.Code, w.Body.String())
+	}
+	if w := doJSON(r, http.MethodPost, "/log", warmupPayload(1)); w.Code != http.StatusConflict {
+		t.Errorf("expected hard pin to reject a v1 body with 409, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// A v2 body sent as binary matches the hard pin.
+	codec, err := avrojson.NewCodec(v2)
+	if err != nil {
+		t.Fatalf("Failed to compile LogData v2: %v", err)
+	}
+	body, err := codec.JSONToBinary([]byte(`{"timestamp":1,"logtype":"t","version":"1","issuer":"i","metadata":null,"domainData":null,"region":"eu"}`))
+	if err != nil {
+		t.Fatalf("Failed to encode v2 body: %v", err)
+	}
+	target := "/log/binary?schema=LogData&version=2&projectName=" + project + "&projectVersion=1&logLevel=info&logType=t&logSource=s"
+	if w := postAvro(r, target, "application/avro", body, nil); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"resolved":false`) {
+		t.Errorf("expected a v2 binary body to pass the hard pin, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if w := doJSON(r, http.MethodDelete, "/schemas/LogData/versions/2", nil); w.Code != http.StatusConflict {
+		t.Errorf("expected deleting a pinned version to conflict, got %d", w.Code)
+	}
+	if w := doJSON(r, http.MethodDelete, "/projects/"+project+"/pin", nil); w.Code != http.StatusOK {
+		t.Fatalf("Failed to remove pin: %d %s", w.Code, w.Body.String())
+	}
+	if w := doJSON(r, http.MethodPost, "/log", warmupPayload(1)); w.Code != http.StatusOK || strings.Contains(w.Body.String(), "schema_pin") {
+		t.Errorf("expected an unpinned project to log without a pin block, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestResolveBodyFillsPinnedDefaults(t *testing.T) {
+	newSchemaTestEngine(t)
+	v2, _, err := schemaRegistry.Register("LogData", logDataV2(t))
+	if err != nil {
+		t.Fatalf("Failed to register LogData v2: %v", err)
+	}
+	v1, err := schemaRegistry.Lookup(avrojson.LogDataSchema)
+	if err != nil {
+		t.Fatalf("Failed to look up built-in LogData: %v", err)
+	}
+	wrapper := avrojson.LogWrapper{ProjectName: "p", ProjectVersion: "1", LogLevel: "info", LogType: "t", LogSource: "s"}
+	encoded, err := avrojson.EncodeLog(wrapper, avrojson.LogData{Timestamp: time.UnixMilli(1).UTC(), Logtype: "t", Version: "1", Issuer: "i"})
+	if err != nil {
+		t.Fatalf("Failed to encode log: %v", err)
+	}
+
+	resolved, err := resolveBody(wrapper, encoded, v1, v2)
+	if err != nil {
+		t.Fatalf("Failed to resolve body: %v", err)
+	}
+	if resolved.LogDataSchema != v2.Schema || !strings.Contains(string(resolved.LogDataJSON), `"region":"unknown"`) {
+		t.Errorf("expected the body in v2 with the default region, got %s", resolved.LogDataJSON)
+	}
+	if !strings.Contains(string(resolved.WrapperJSON), `region`) {
+		t.Errorf("expected the wrapper body to carry the resolved record, got %s", resolved.WrapperJSON)
+	}
+}
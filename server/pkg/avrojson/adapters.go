@@ -0,0 +1,129 @@
+package avrojson
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// AvroMarshaler is implemented by types that choose their own Avro
+// representation, such as ID types with unexported fields. AvroSchema is
+// the JSON of the Avro type SchemaOf generates for the type, and
+// MarshalAvro returns the value in goavro's native form for it.
+type AvroMarshaler interface {
+	AvroSchema() string
+	MarshalAvro() (interface{}, error)
+}
+
+// AvroUnmarshaler is implemented by pointers to types that read
+// themselves back from the native value their MarshalAvro produced.
+type AvroUnmarshaler interface {
+	UnmarshalAvro(native interface{}) error
+}
+
+// Adapter converts a Go type the caller does not own, such as
+// decimal.Decimal, to and from an Avro representation. Register it with
+// RegisterAdapter.
+type Adapter struct {
+	// Schema is the JSON of the Avro type SchemaOf generates, such as
+	// `"string"` or `{"type":"bytes","logicalType":"decimal",...}`.
+	Schema string
+	// ToAvro returns v, a value of the adapted type, in goavro's native
+	// form.
+	ToAvro func(v interface{}) (interface{}, error)
+	// FromAvro returns a value of the adapted type for a native value.
+	FromAvro func(native interface{}) (interface{}, error)
+}
+
+var (
+	adaptersMu sync.RWMutex
+	adapters   = map[reflect.Type]Adapter{}
+
+	avroMarshalerType   = reflect.TypeOf((*AvroMarshaler)(nil)).Elem()
+	avroUnmarshalerType = reflect.TypeOf((*AvroUnmarshaler)(nil)).Elem()
+)
+
+// RegisterAdapter makes ToNative, FromNative, the codecs and SchemaOf use
+// a for the type of example. Adapters take precedence over AvroMarshaler
+// and the built-in conversions; pointers to the type become nullable
+// unions as usual.
+func RegisterAdapter(example interface{}, a Adapter) error {
+	t := reflect.TypeOf(example)
+	if t == nil {
+		return errors.New("avrojson: RegisterAdapter needs a typed example value")
+	}
+	if a.ToAvro == nil || a.FromAvro == nil {
+		return fmt.Errorf("avrojson: adapter for %v needs ToAvro and FromAvro", t)
+	}
+	if !json.Valid([]byte(a.Schema)) {
+		return fmt.Errorf("avrojson: adapter for %v has invalid schema %q", t, a.Schema)
+	}
+	adaptersMu.Lock()
+	defer adaptersMu.Unlock()
+	if _, ok := adapters[t]; ok {
+		return fmt.Errorf("avrojson: an adapter for %v is already registered", t)
+	}
+	adapters[t] = a
+	return nil
+}
+
+func adapterFor(t reflect.Type) (Adapter, bool) {
+	adaptersMu.RLock()
+	defer adaptersMu.RUnlock()
+	a, ok := adapters[t]
+	return a, ok
+}
+
+// adaptedSchema returns the Avro type of an adapted or self-marshaling t.
+func adaptedSchema(t reflect.Type) (json.RawMessage, bool) {
+	if a, ok := adapterFor(t); ok {
+		return json.RawMessage(a.Schema), true
+	}
+	if t.Implements(avroMarshalerType) {
+		return json.RawMessage(reflect.Zero(t).Interface().(AvroMarshaler).AvroSchema()), true
+	}
+	return nil, false
+}
+
+// adaptToNative converts v with its adapter or MarshalAvro, reporting
+// false when v's type has neither.
+func adaptToNative(v reflect.Value) (interface{}, bool, error) {
+	t := v.Type()
+	if a, ok := adapterFor(t); ok {
+		native, err := a.ToAvro(v.Interface())
+		return native, true, err
+	}
+	if t.Implements(avroMarshalerType) {
+		native, err := v.Interface().(AvroMarshaler).MarshalAvro()
+		return native, true, err
+	}
+	if v.CanAddr() && reflect.PointerTo(t).Implements(avroMarshalerType) {
+		native, err := v.Addr().Interface().(AvroMarshaler).MarshalAvro()
+		return native, true, err
+	}
+	return nil, false, nil
+}
+
+// adaptFromNative stores native in v with its adapter or UnmarshalAvro,
+// reporting false when v's type has neither.
+func adaptFromNative(native interface{}, v reflect.Value) (bool, error) {
+	t := v.Type()
+	if a, ok := adapterFor(t); ok {
+		out, err := a.FromAvro(native)
+		if err != nil {
+			return true, err
+		}
+		rv := reflect.ValueOf(out)
+		if !rv.IsValid() || rv.Type() != t {
+			return true, fmt.Errorf("avrojson: adapter for %v returned %T", t, out)
+		}
+		v.Set(rv)
+		return true, nil
+	}
+	if reflect.PointerTo(t).Implements(avroUnmarshalerType) {
+		return true, v.Addr().Interface().(AvroUnmarshaler).UnmarshalAvro(native)
+	}
+	return false, nil
+}
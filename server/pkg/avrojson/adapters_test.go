@@ -0,0 +1,121 @@
+package avrojson
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// testCents stands in for a type the caller does not own, like
+// decimal.Decimal, and is adapted to a "12.34" string.
+type testCents int64
+
+// testUserID converts itself; unexported fields make encoding/json see
+// nothing in it.
+type testUserID struct {
+	n uint32
+}
+
+func (id testUserID) AvroSchema() string { return `"string"` }
+
+func (id testUserID) MarshalAvro() (interface{}, error) {
+	return fmt.Sprintf("u-%d", id.n), nil
+}
+
+func (id *testUserID) UnmarshalAvro(native interface{}) error {
+	s, _ := native.(string)
+	n, err := strconv.ParseUint(strings.TrimPrefix(s, "u-"), 10, 32)
+	if err != nil || !strings.HasPrefix(s, "u-") {
+		return fmt.Errorf("invalid user ID %q", s)
+	}
+	id.n = uint32(n)
+	return nil
+}
+
+func init() {
+	err := RegisterAdapter(testCents(0), Adapter{
+		Schema: `"string"`,
+		ToAvro: func(v interface{}) (interface{}, error) {
+			c := v.(testCents)
+			return fmt.Sprintf("%d.%02d", c/100, c%100), nil
+		},
+		FromAvro: func(native interface{}) (interface{}, error) {
+			s, _ := native.(string)
+			whole, frac, _ := strings.Cut(s, ".")
+			n, err := strconv.ParseInt(whole+frac, 10, 64)
+			return testCents(n), err
+		},
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+type testOrder struct {
+	Buyer    testUserID   `json:"buyer"`
+	Total    testCents    `json:"total"`
+	Discount *testCents   `json:"discount"`
+	Sellers  []testUserID `json:"sellers"`
+}
+
+func TestAdaptersRoundTrip(t *testing.T) {
+	schema, err := SchemaOf(testOrder{})
+	if err != nil {
+		t.Fatalf("Failed to generate schema: %v", err)
+	}
+	for _, want := range []string{`"name":"buyer","type":"string"`, `"name":"discount","type":["null","string"]`, `"items":"string"`} {
+		if !strings.Contains(schema, want) {
+			t.Errorf("schema %s lacks %s", schema, want)
+		}
+	}
+	codec, err := NewCodec(schema)
+	if err != nil {
+		t.Fatalf("Failed to compile %s: %v", schema, err)
+	}
+
+	discount := testCents(250)
+	in := testOrder{Buyer: testUserID{42}, Total: 1999, Discount: &discount, Sellers: []testUserID{{7}, {8}}}
+	data, err := codec.Encode(in)
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	native, _ := codec.DecodeNative(data)
+	record := native.(map[string]interface{})
+	if record["buyer"] != "u-42" || record["total"] != "19.99" {
+		t.Errorf("unexpected native record %v", record)
+	}
+
+	var out testOrder
+	if err := codec.Decode(data, &out); err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if out.Buyer != in.Buyer || out.Total != in.Total || out.Discount == nil || *out.Discount != discount ||
+		len(out.Sellers) != 2 || out.Sellers[1].n != 8 {
+		t.Errorf("round trip gave %+v, want %+v", out, in)
+	}
+
+	// Decode errors from the adapted type surface.
+	bad, _ := codec.EncodeNative(map[string]interface{}{"buyer": "x", "total": "1.00", "discount": nil, "sellers": []interface{}{}})
+	if err := codec.Decode(bad, &out); err == nil {
+		t.Error("Expected an invalid user ID to fail decoding")
+	}
+}
+
+func TestRegisterAdapterRejectsInvalidAdapters(t *testing.T) {
+	noop := func(v interface{}) (interface{}, error) { return v, nil }
+	cases := map[string]struct {
+		example interface{}
+		adapter Adapter
+	}{
+		"untyped nil":    {nil, Adapter{Schema: `"string"`, ToAvro: noop, FromAvro: noop}},
+		"missing funcs":  {struct{ A int }{}, Adapter{Schema: `"string"`}},
+		"invalid schema": {struct{ B int }{}, Adapter{Schema: `string`, ToAvro: noop, FromAvro: noop}},
+		"duplicate":      {testCents(0), Adapter{Schema: `"long"`, ToAvro: noop, FromAvro: noop}},
+	}
+	for name, c := range cases {
+		if err := RegisterAdapter(c.example, c.adapter); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package avrojson
+
+import (
+	"crypto/sha256"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Cache keeps compiled codecs keyed by a fingerprint of the schema text, so
+// callers never re-parse a schema on the hot path. Texts that differ only
+// in whitespace, attribute order or docs share one codec, compiled from
+// the first of them. It is safe for concurrent use.
+type Cache struct {
+	codecs     sync.Map // [32]byte of the text → *Codec
+	normalized sync.Map // [32]byte of the normalized text → *Codec
+	resolvers  sync.Map // [2]*Codec → *Resolver
+
+	hits          atomic.Uint64
+	misses        atomic.Uint64
+	compileErrors atomic.Uint64
+	compileNanos  atomic.Int64
+}
+
+// CacheStats reports how often a Cache avoided compiling a schema.
+type CacheStats struct {
+	Entries       int     `json:"entries"`
+	Hits          uint64  `json:"hits"`
+	Misses        uint64  `json:"misses"`
+	HitRatio      float64 `json:"hit_ratio"`
+	CompileErrors uint64  `json:"compile_errors"`
+	CompileTimeMs float64 `json:"compile_time_ms"`
+}
+
+// DefaultCache is used by the package-level Encode, Decode, EncodeLog and
+// DecodeLog functions.
+var DefaultCache = NewCache()
+
+func NewCache() *Cache {
+	return &Cache{}
+}
+
+// Get returns the compiled codec for schema, compiling it on first use.
+func (c *Cache) Get(schema string) (*Codec, error) {
+	key := sha256.Sum256([]byte(schema))
+	if codec, ok := c.codecs.Load(key); ok {
+		c.hits.Add(1)
+		return codec.(*Codec), nil
+	}
+
+	// A new text may still be an equivalent of a compiled schema.
+	normalized, normErr := normalizeSchema(schema)
+	normalizedKey := sha256.Sum256([]byte(normalized))
+	if normErr == nil {
+		if codec, ok := c.normalized.Load(normalizedKey); ok {
+			c.hits.Add(1)
+			actual, _ := c.codecs.LoadOrStore(key, codec)
+			return actual.(*Codec), nil
+		}
+	}
+
+	c.misses.Add(1)
+	start := time.Now()
+	codec, err := NewCodec(schema)
+	c.compileNanos.Add(int64(time.Since(start)))
+	if err != nil {
+		c.compileErrors.Add(1)
+		return nil, err
+	}
+
+	// Concurrent misses may compile the same schema twice; keep the first.
+	var actual interface{} = codec
+	if normErr == nil {
+		actual, _ = c.normalized.LoadOrStore(normalizedKey, codec)
+	}
+	actual, _ = c.codecs.LoadOrStore(key, actual)
+	return actual.(*Codec), nil
+}
+
+// Resolver returns the resolver reading data written with writerSchema as
+// readerSchema, building it on first use. Incompatible pairs are not cached.
+func (c *Cache) Resolver(writerSchema, readerSchema string) (*Resolver, error) {
+	writer, err := c.Get(writerSchema)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := c.Get(readerSchema)
+	if err != nil {
+		return nil, err
+	}
+	key := [2]*Codec{writer, reader}
+	if r, ok := c.resolvers.Load(key); ok {
+		return r.(*Resolver), nil
+	}
+	r, err := newResolver(writer, reader)
+	if err != nil {
+		return nil, err
+	}
+	actual, _ := c.resolvers.LoadOrStore(key, r)
+	return actual.(*Resolver), nil
+}
+
+// Warm compiles the given schemas ahead of the first request.
+func (c *Cache) Warm(schemas ...string) error {
+	for _, schema := range schemas {
+		if _, err := c.Get(schema); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Cache) Stats() CacheStats {
+	entries := 0
+	c.normalized.Range(func(_, _ interface{}) bool {
+		entries++
+		return true
+	})
+
+	hits, misses := c.hits.Load(), c.misses.Load()
+	var ratio float64
+	if total := hits + misses; total > 0 {
+		ratio = float64(hits) / float64(total)
+	}
+	return CacheStats{
+		Entries:       entries,
+		Hits:          hits,
+		Misses:        misses,
+		HitRatio:      ratio,
+		CompileErrors: c.compileErrors.Load(),
+		CompileTimeMs: float64(c.compileNanos.Load()) / float64(time.Millisecond),
+	}
+}
+
+// Encode converts v to Avro binary with schema, using DefaultCache.
+func Encode(schema string, v interface{}) ([]byte, error) {
+	codec, err := DefaultCache.Get(schema)
+	if err != nil {
+		return nil, err
+	}
+	return codec.Encode(v)
+}
+
+// Decode reads Avro binary written with schema into v, using DefaultCache.
+func Decode(schema string, data []byte, v interface{}) error {
+	codec, err := DefaultCache.Get(schema)
+	if err != nil {
+		return err
+	}
+	return codec.Decode(data, v)
+}
@@ -0,0 +1,94 @@
+package avrojson
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestCodecCacheReusesCompiledCodecs(t *testing.T) {
+	cache := NewCache()
+
+	first, err := cache.Get(WrapperSchema)
+	if err != nil {
+		t.Fatalf("Failed to compile wrapper schema: %v", err)
+	}
+	second, err := cache.Get(WrapperSchema)
+	if err != nil {
+		t.Fatalf("Failed to load wrapper schema: %v", err)
+	}
+	if first != second {
+		t.Error("expected the cached codec instance to be reused")
+	}
+
+	stats := cache.Stats()
+	if stats.Entries != 1 || stats.Hits != 1 || stats.Misses != 1 {
+		t.Errorf("unexpected cache stats: %+v", stats)
+	}
+}
+
+func TestCodecCacheSharesEquivalentSchemas(t *testing.T) {
+	cache := NewCache()
+	first, err := cache.Get(`{"type":"record","name":"R","fields":[{"name":"a","type":"int","default":1}]}`)
+	if err != nil {
+		t.Fatalf("Failed to compile schema: %v", err)
+	}
+	// Whitespace, attribute order and docs do not make a new codec...
+	same, err := cache.Get(`{ "fields": [{"doc": "A.", "default": 1, "type": "int", "name": "a"}], "name": "R", "type": "record" }`)
+	if err != nil {
+		t.Fatalf("Failed to compile schema: %v", err)
+	}
+	if same != first {
+		t.Error("expected an equivalent schema to reuse the codec")
+	}
+	// ...but a default, which changes encoding, does.
+	other, err := cache.Get(`{"type":"record","name":"R","fields":[{"name":"a","type":"int","default":2}]}`)
+	if err != nil {
+		t.Fatalf("Failed to compile schema: %v", err)
+	}
+	if other == first {
+		t.Error("expected a different default to compile a new codec")
+	}
+	if stats := cache.Stats(); stats.Entries != 2 || stats.Hits != 1 || stats.Misses != 2 {
+		t.Errorf("unexpected cache stats: %+v", stats)
+	}
+}
+
+func TestCodecCacheConcurrentAccess(t *testing.T) {
+	cache := NewCache()
+	if err := cache.Warm(WrapperSchema, LogDataSchema); err != nil {
+		t.Fatalf("Failed to warm cache: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if _, err := cache.Get(LogDataSchema); err != nil {
+					t.Errorf("get failed: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	stats := cache.Stats()
+	if stats.Misses != 2 {
+		t.Errorf("expected only the warm-up misses, got %d", stats.Misses)
+	}
+	if stats.Hits != 3200 {
+		t.Errorf("expected 3200 hits, got %d", stats.Hits)
+	}
+}
+
+func TestCodecCacheInvalidSchema(t *testing.T) {
+	cache := NewCache()
+	if _, err := cache.Get(`{"type": "nope"}`); err == nil {
+		t.Fatal("expected invalid schema to fail")
+	}
+	if stats := cache.Stats(); stats.Entries != 0 || stats.CompileErrors != 1 {
+		t.Errorf("expected failed compile to be counted and not cached, got %+v", stats)
+	}
+}
@@ -0,0 +1,253 @@
+package avrojson
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// goavro's canonical form deviates from the specification: it keeps
+// {"type": "long"} for logical types, appends nested namespaces to the
+// enclosing one, ignores the namespace of dotted names and writes large
+// fixed sizes as 1e+06. Fingerprints of such schemas then differ from those
+// of other Avro implementations, so the form and its fingerprint are
+// computed here instead.
+
+// Canonical returns the Parsing Canonical Form of schema as the Avro
+// specification defines it: names are fully qualified, only the attributes
+// that affect parsing are kept (name, type, fields, symbols, items, values
+// and size, in that order), primitives and logical types are reduced to
+// their type name and no whitespace is left. Schemas that differ only in
+// formatting, attribute order, docs, aliases or defaults share the form.
+func Canonical(schema string) (string, error) {
+	dec := json.NewDecoder(strings.NewReader(schema))
+	dec.UseNumber()
+	var root interface{}
+	if err := dec.Decode(&root); err != nil {
+		return "", fmt.Errorf("avrojson: invalid schema: %w", err)
+	}
+	w := &canonicalWriter{named: make(map[string]bool)}
+	if err := w.write(root, ""); err != nil {
+		return "", fmt.Errorf("avrojson: invalid schema: %w", err)
+	}
+	return w.b.String(), nil
+}
+
+type canonicalWriter struct {
+	b     strings.Builder
+	named map[string]bool
+}
+
+func (w *canonicalWriter) write(node interface{}, namespace string) error {
+	switch n := node.(type) {
+	case string:
+		w.quote(resolveName(n, namespace, func(full string) bool { return w.named[full] }))
+		return nil
+
+	case []interface{}:
+		w.b.WriteByte('[')
+		for i, branch := range n {
+			if i > 0 {
+				w.b.WriteByte(',')
+			}
+			if err := w.write(branch, namespace); err != nil {
+				return err
+			}
+		}
+		w.b.WriteByte(']')
+		return nil
+
+	case map[string]interface{}:
+		t, ok := n["type"].(string)
+		if !ok {
+			// {"type": <schema>} is that schema.
+			if n["type"] == nil {
+				return fmt.Errorf("object without a type")
+			}
+			return w.write(n["type"], namespace)
+		}
+		switch t {
+		case "record", "error", "enum", "fixed":
+			return w.writeNamed(n, t, namespace)
+		case "array", "map":
+			key := "items"
+			if t == "map" {
+				key = "values"
+			}
+			w.b.WriteString(`{"type":`)
+			w.quote(t)
+			w.b.WriteString(`,"` + key + `":`)
+			if err := w.write(n[key], namespace); err != nil {
+				return fmt.Errorf("%s %s: %w", t, key, err)
+			}
+			w.b.WriteByte('}')
+			return nil
+		}
+		// Primitives, logical types included, and references.
+		return w.write(t, namespace)
+	}
+	return fmt.Errorf("unexpected %T in schema", node)
+}
+
+func (w *canonicalWriter) writeNamed(n map[string]interface{}, t, namespace string) error {
+	name, _ := n["name"].(string)
+	if name == "" {
+		return fmt.Errorf("%s without a name", t)
+	}
+	name, namespace = namedType(n, namespace, false)
+	// Register before writing fields so recursive references resolve.
+	w.named[name] = true
+
+	w.b.WriteString(`{"name":`)
+	w.quote(name)
+	w.b.WriteString(`,"type":`)
+	w.quote(t)
+	switch t {
+	case "enum":
+		w.b.WriteString(`,"symbols":[`)
+		symbols, _ := n["symbols"].([]interface{})
+		for i, s := range symbols {
+			if i > 0 {
+				w.b.WriteByte(',')
+			}
+			symbol, _ := s.(string)
+			w.quote(symbol)
+		}
+		w.b.WriteByte(']')
+	case "fixed":
+		size, err := canonicalSize(n["size"])
+		if err != nil {
+			return fmt.Errorf("fixed %s: %w", name, err)
+		}
+		w.b.WriteString(`,"size":` + strconv.FormatUint(size, 10))
+	default:
+		w.b.WriteString(`,"fields":[`)
+		fields, _ := n["fields"].([]interface{})
+		for i, f := range fields {
+			field, ok := f.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("record %s: field %d is not an object", name, i)
+			}
+			if i > 0 {
+				w.b.WriteByte(',')
+			}
+			fieldName, _ := field["name"].(string)
+			w.b.WriteString(`{"name":`)
+			w.quote(fieldName)
+			w.b.WriteString(`,"type":`)
+			if err := w.write(field["type"], namespace); err != nil {
+				return fmt.Errorf("record %s field %q: %w", name, fieldName, err)
+			}
+			w.b.WriteByte('}')
+		}
+		w.b.WriteByte(']')
+	}
+	w.b.WriteByte('}')
+	return nil
+}
+
+// quote writes s as a JSON string. Avro names and symbols need no escapes,
+// and the specification asks for literal UTF-8 rather than \u escapes.
+func (w *canonicalWriter) quote(s string) {
+	w.b.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			w.b.WriteByte('\\')
+			w.b.WriteRune(r)
+		case r < ' ':
+			fmt.Fprintf(&w.b, `\u%04x`, r)
+		default:
+			w.b.WriteRune(r)
+		}
+	}
+	w.b.WriteByte('"')
+}
+
+// canonicalSize reads a fixed size, which some writers quote or pad.
+func canonicalSize(v interface{}) (uint64, error) {
+	var text string
+	switch s := v.(type) {
+	case json.Number:
+		text = s.String()
+	case string:
+		text = s
+	default:
+		return 0, fmt.Errorf("size %v is not an integer", v)
+	}
+	size, err := strconv.ParseUint(text, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("size %v is not an integer", v)
+	}
+	return size, nil
+}
+
+// rabinEmpty is the CRC-64-AVRO fingerprint of empty input.
+const rabinEmpty uint64 = 0xc15d213aa4d7a795
+
+var rabinTable = func() (table [256]uint64) {
+	for i := range table {
+		fp := uint64(i)
+		for j := 0; j < 8; j++ {
+			fp = (fp >> 1) ^ (rabinEmpty & -(fp & 1))
+		}
+		table[i] = fp
+	}
+	return table
+}()
+
+// Rabin returns the 64-bit Rabin fingerprint (CRC-64-AVRO) of canonical, a
+// schema in Parsing Canonical Form, as single-object headers and the schema
+// registry use it.
+func Rabin(canonical string) uint64 {
+	fp := rabinEmpty
+	for i := 0; i < len(canonical); i++ {
+		fp = (fp >> 8) ^ rabinTable[byte(fp)^canonical[i]]
+	}
+	return fp
+}
+
+// normalizeSchema rewrites schema compactly with sorted attributes and
+// without docs, so texts that differ only in those share a cache entry.
+// Unlike Canonical it keeps everything that changes how a codec behaves:
+// logical types, defaults, aliases and names as written.
+func normalizeSchema(schema string) (string, error) {
+	dec := json.NewDecoder(strings.NewReader(schema))
+	dec.UseNumber()
+	var root interface{}
+	if err := dec.Decode(&root); err != nil {
+		return "", err
+	}
+	stripDocs(root)
+	// encoding/json writes map keys sorted.
+	out, err := json.Marshal(root)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// stripDocs removes the doc attributes of a parsed schema and its fields,
+// leaving default values, which may hold a "doc" key of their own, alone.
+func stripDocs(node interface{}) {
+	switch n := node.(type) {
+	case []interface{}:
+		for _, branch := range n {
+			stripDocs(branch)
+		}
+	case map[string]interface{}:
+		delete(n, "doc")
+		stripDocs(n["type"])
+		stripDocs(n["items"])
+		stripDocs(n["values"])
+		if fields, ok := n["fields"].([]interface{}); ok {
+			for _, f := range fields {
+				if field, ok := f.(map[string]interface{}); ok {
+					delete(field, "doc")
+					stripDocs(field["type"])
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package avrojson
+
+import (
+	"testing"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+func TestCanonicalForm(t *testing.T) {
+	cases := map[string]struct{ schema, want string }{
+		"primitive object": {`{"type":"int"}`, `"int"`},
+		"logical type":     {`{"type":"long","logicalType":"timestamp-millis"}`, `"long"`},
+		"stripped attributes": {
+			`{"doc":"d","fields":[{"default":1,"doc":"f","type":"int","name":"a","order":"descending"}],"aliases":["Old"],"name":"R","type":"record"}`,
+			`{"name":"R","type":"record","fields":[{"name":"a","type":"int"}]}`,
+		},
+		"nested namespace replaces": {
+			`{"type":"record","name":"R","namespace":"a","fields":[{"name":"in","type":{"type":"record","name":"I","namespace":"b","fields":[]}}]}`,
+			`{"name":"a.R","type":"record","fields":[{"name":"in","type":{"name":"b.I","type":"record","fields":[]}}]}`,
+		},
+		"dotted name sets the namespace": {
+			`{"type":"record","name":"x.R","namespace":"ignored","fields":[{"name":"f","type":{"type":"fixed","name":"F","size":1000000}}]}`,
+			`{"name":"x.R","type":"record","fields":[{"name":"f","type":{"name":"x.F","type":"fixed","size":1000000}}]}`,
+		},
+		"references and field names": {
+			`{"type":"record","name":"Node","namespace":"t","fields":[{"name":"Node","type":["null","Node"]},{"name":"kind","type":{"type":"enum","name":"Kind","symbols":["Node"]}},{"name":"k2","type":"Kind"}]}`,
+			`{"name":"t.Node","type":"record","fields":[{"name":"Node","type":["null","t.Node"]},{"name":"kind","type":{"name":"t.Kind","type":"enum","symbols":["Node"]}},{"name":"k2","type":"t.Kind"}]}`,
+		},
+		"arrays and maps": {
+			`{"type":"map","values":{"type":"array","items":{"type":"string","avro.java.string":"String"}}}`,
+			`{"type":"map","values":{"type":"array","items":"string"}}`,
+		},
+		"quoted size": {`{"type":"fixed","name":"F","size":"016"}`, `{"name":"F","type":"fixed","size":16}`},
+	}
+	for name, tc := range cases {
+		got, err := Canonical(tc.schema)
+		if err != nil {
+			t.Errorf("%s: Failed to canonicalize: %v", name, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s:\n got %s\nwant %s", name, got, tc.want)
+		}
+	}
+	if _, err := Canonical(`{"type":"record","fields":[]}`); err == nil {
+		t.Error("expected a record without a name to fail")
+	}
+}
+
+func TestRabinMatchesGoavro(t *testing.T) {
+	// goavro's canonical form is right for schemas without logical types or
+	// nested namespaces, so both fingerprints must agree there.
+	for _, schema := range []string{`"null"`, `"string"`, WrapperSchema, `{"type":"array","items":{"type":"enum","name":"E","symbols":["A","B"]}}`} {
+		codec, err := goavro.NewCodec(schema)
+		if err != nil {
+			t.Fatalf("Failed to compile %s: %v", schema, err)
+		}
+		canonical, err := Canonical(schema)
+		if err != nil {
+			t.Fatalf("Failed to canonicalize %s: %v", schema, err)
+		}
+		if canonical != codec.CanonicalSchema() || Rabin(canonical) != codec.Rabin {
+			t.Errorf("%s: got %s %x, goavro %s %x", schema, canonical, Rabin(canonical), codec.CanonicalSchema(), codec.Rabin)
+		}
+	}
+}
+
+func TestEquivalentSchemasShareFingerprints(t *testing.T) {
+	a := `{"type":"record","name":"Event","namespace":"exp","fields":[{"name":"at","type":{"type":"long","logicalType":"timestamp-millis"}}]}`
+	b := `{
+		"namespace": "exp", "doc": "An event.", "name": "Event", "type": "record",
+		"fields": [{"type": {"logicalType": "timestamp-millis", "type": "long"}, "doc": "When.", "name": "at"}]
+	}`
+	first, err := NewCodec(a)
+	if err != nil {
+		t.Fatalf("Failed to compile schema: %v", err)
+	}
+	second, err := NewCodec(b)
+	if err != nil {
+		t.Fatalf("Failed to compile schema: %v", err)
+	}
+	if first.Canonical() != second.Canonical() || first.Fingerprint() != second.Fingerprint() {
+		t.Errorf("expected equal forms, got %s (%x) and %s (%x)", first.Canonical(), first.Fingerprint(), second.Canonical(), second.Fingerprint())
+	}
+	if first.Canonical() != `{"name":"exp.Event","type":"record","fields":[{"name":"at","type":"long"}]}` {
+		t.Errorf("unexpected canonical form %s", first.Canonical())
+	}
+}
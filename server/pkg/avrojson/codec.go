@@ -0,0 +1,214 @@
+package avrojson
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+// Codec converts Go values, Avro binary and Avro JSON for one schema. It is
+// safe for concurrent use. Every goavro call is recorded in DefaultMetrics.
+type Codec struct {
+	codec *goavro.Codec
+	// canonical is the schema's Parsing Canonical Form and rabin its
+	// fingerprint.
+	canonical string
+	rabin     uint64
+	metrics   *schemaMetrics
+	naming    atomic.Value // string form of the Naming
+	rawJSON   atomic.Value // string form of the RawJSON mode
+
+	// parsed is the schema every walk over it starts from and tree its
+	// resolution tree, each built on first use.
+	parsed struct {
+		once   sync.Once
+		schema *parsedSchema
+		err    error
+	}
+	tree struct {
+		once sync.Once
+		root *schemaNode
+		err  error
+	}
+
+	decoders struct {
+		once sync.Once
+		pool *DecoderPool
+	}
+}
+
+// NewCodec compiles schema. Prefer Cache.Get on hot paths.
+func NewCodec(schema string) (*Codec, error) {
+	return newCodec(schema, DefaultMetrics)
+}
+
+func newCodec(schema string, metrics *Metrics) (*Codec, error) {
+	codec, err := goavro.NewCodec(schema)
+	if err != nil {
+		return nil, err
+	}
+	canonical, err := Canonical(schema)
+	if err != nil {
+		return nil, err
+	}
+	rabin := Rabin(canonical)
+	name, fingerprint := schemaIdentity(rabin, canonical)
+	return &Codec{codec: codec, canonical: canonical, rabin: rabin, metrics: metrics.forSchema(name, fingerprint)}, nil
+}
+
+// Canonical returns the Parsing Canonical Form of the codec's schema.
+func (c *Codec) Canonical() string { return c.canonical }
+
+// Schema returns the schema the codec was compiled from.
+func (c *Codec) Schema() string { return c.codec.Schema() }
+
+// Goavro exposes the underlying goavro codec for operations not wrapped
+// here, such as OCF readers and writers. Calls made through it are not
+// instrumented.
+func (c *Codec) Goavro() *goavro.Codec { return c.codec }
+
+// Encode converts v, a struct with json tags or a native map, to Avro
+// binary. Field names follow the codec's Naming, and plain values of
+// ["null", T] unions, such as non-nil pointers, are wrapped for goavro.
+func (c *Codec) Encode(v interface{}) ([]byte, error) {
+	native, err := c.converter().toNativeMap(v)
+	if err != nil {
+		return nil, err
+	}
+	renamed, err := c.toSchemaNames(native)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := c.wrapNullable(renamed)
+	if err != nil {
+		return nil, err
+	}
+	return c.binaryFromNative(wrapped)
+}
+
+// EncodeNative converts a value already in goavro's native form, such as
+// the output of avrogen's AvroNative methods, to Avro binary.
+func (c *Codec) EncodeNative(native interface{}) ([]byte, error) {
+	return c.binaryFromNative(native)
+}
+
+// Decode reads one Avro binary datum into v. Bytes left over after the
+// datum are reported as an error.
+func (c *Codec) Decode(data []byte, v interface{}) error {
+	native, err := c.nativeFromBinary(data)
+	if err != nil {
+		return err
+	}
+	return c.fromNative(native, v)
+}
+
+// DecodeNative reads one Avro binary datum into goavro's native form, in
+// which unions are {"type": value} maps.
+func (c *Codec) DecodeNative(data []byte) (interface{}, error) {
+	return c.nativeFromBinary(data)
+}
+
+// BinaryToJSON converts Avro binary to its Avro JSON encoding.
+func (c *Codec) BinaryToJSON(data []byte) ([]byte, error) {
+	native, err := c.nativeFromBinary(data)
+	if err != nil {
+		return nil, err
+	}
+	return c.textualFromNative(native)
+}
+
+// JSONToBinary converts Avro JSON to Avro binary.
+func (c *Codec) JSONToBinary(text []byte) ([]byte, error) {
+	native, err := c.nativeFromTextual(text)
+	if err != nil {
+		return nil, err
+	}
+	return c.binaryFromNative(native)
+}
+
+// DecodeJSON reads Avro JSON into v.
+func (c *Codec) DecodeJSON(text []byte, v interface{}) error {
+	native, err := c.nativeFromTextual(text)
+	if err != nil {
+		return err
+	}
+	return c.fromNative(native, v)
+}
+
+// fromNative fills v from a decoded native value, unwrapping nullable
+// unions for structs and renaming fields to the codec's Naming.
+func (c *Codec) fromNative(native interface{}, v interface{}) error {
+	unwrapped, err := c.unwrapNullable(native, v)
+	if err != nil {
+		return err
+	}
+	renamed, err := c.fromSchemaNames(unwrapped)
+	if err != nil {
+		return err
+	}
+	return c.converter().fromNativePtr(renamed, v)
+}
+
+func (c *Codec) converter() converter {
+	return converter{rawJSON: c.RawJSON()}
+}
+
+// The instrumented goavro stages.
+
+func (c *Codec) binaryFromNative(native interface{}) ([]byte, error) {
+	native, err := c.finiteForBinary(native)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.checkLogical(native); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	out, err := c.codec.BinaryFromNative(nil, native)
+	c.instrument(binaryFromNativeStage, start, len(out), err)
+	return out, err
+}
+
+func (c *Codec) nativeFromBinary(data []byte) (interface{}, error) {
+	start := time.Now()
+	native, rest, err := c.codec.NativeFromBinary(data)
+	if err == nil && len(rest) > 0 {
+		err = fmt.Errorf("cannot decode binary %s: %d trailing bytes after datum", c.metrics.name, len(rest))
+	}
+	c.instrument(nativeFromBinaryStage, start, len(data), err)
+	return native, err
+}
+
+func (c *Codec) textualFromNative(native interface{}) ([]byte, error) {
+	return c.appendTextual(nil, native)
+}
+
+// appendTextual appends the Avro JSON of native to buf, NaN and infinite
+// values written as NonFinitePolicy says.
+func (c *Codec) appendTextual(buf []byte, native interface{}) ([]byte, error) {
+	return c.appendFiniteTextual(buf, native)
+}
+
+func (c *Codec) textualStage(buf []byte, native interface{}) ([]byte, error) {
+	start := time.Now()
+	out, err := c.codec.TextualFromNative(buf, native)
+	c.instrument(textualFromNativeStage, start, len(out)-len(buf), err)
+	return out, err
+}
+
+func (c *Codec) nativeFromTextual(text []byte) (interface{}, error) {
+	text, restore, err := c.finiteText(text)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	native, _, err := c.codec.NativeFromTextual(text)
+	c.instrument(nativeFromTextualStage, start, len(text), err)
+	if err == nil && restore != nil {
+		native = restore(native)
+	}
+	return native, err
+}
@@ -0,0 +1,107 @@
+package avrojson
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CompatibilityMode says which way a new schema version must resolve with
+// an old one, as schema registries name it.
+type CompatibilityMode string
+
+const (
+	// CompatibilityBackward: the new schema reads data written with the old.
+	CompatibilityBackward CompatibilityMode = "BACKWARD"
+	// CompatibilityForward: the old schema reads data written with the new.
+	CompatibilityForward CompatibilityMode = "FORWARD"
+	// CompatibilityFull is both.
+	CompatibilityFull CompatibilityMode = "FULL"
+)
+
+// ParseCompatibilityMode reads a mode name, ignoring case.
+func ParseCompatibilityMode(s string) (CompatibilityMode, error) {
+	switch mode := CompatibilityMode(strings.ToUpper(s)); mode {
+	case CompatibilityBackward, CompatibilityForward, CompatibilityFull:
+		return mode, nil
+	}
+	return "", fmt.Errorf("avrojson: unknown compatibility mode %q (want BACKWARD, FORWARD or FULL)", s)
+}
+
+// Directions of an Incompatibility.
+const (
+	// DirectionBackward: the new schema cannot read data of the old one.
+	DirectionBackward = "backward"
+	// DirectionForward: the old schema cannot read data of the new one.
+	DirectionForward = "forward"
+)
+
+// Incompatibility is one reason data written with one schema cannot be
+// read with another.
+type Incompatibility struct {
+	// Direction is set by CheckCompatibility.
+	Direction string `json:"direction,omitempty"`
+	// Path locates the type in the reader schema, e.g. "lines.[].quantity";
+	// it is empty for the top-level type.
+	Path string `json:"path"`
+	// WriterType and ReaderType name the two types by their union keys;
+	// WriterType is empty for a reader field the writer does not have.
+	WriterType string `json:"writer_type,omitempty"`
+	ReaderType string `json:"reader_type"`
+	Message    string `json:"message"`
+}
+
+// Incompatibilities returns every reason data written with writerSchema
+// cannot be read with readerSchema, none when it always can. Unlike
+// NewResolver, which accepts a writer union as long as one branch resolves,
+// every branch must: a datum of an unreadable branch fails to resolve. It
+// returns an error only when a schema does not compile.
+func Incompatibilities(writerSchema, readerSchema string) ([]Incompatibility, error) {
+	w, err := compileSchemaTree(writerSchema)
+	if err != nil {
+		return nil, fmt.Errorf("avrojson: writer schema: %w", err)
+	}
+	r, err := compileSchemaTree(readerSchema)
+	if err != nil {
+		return nil, fmt.Errorf("avrojson: reader schema: %w", err)
+	}
+	c := &resolvabilityCheck{strict: true, seen: make(map[[2]*schemaNode]bool)}
+	c.check(w, r, "")
+	return c.issues, nil
+}
+
+// CheckCompatibility returns every incompatibility of newSchema with
+// oldSchema under mode, backward ones first.
+func CheckCompatibility(oldSchema, newSchema string, mode CompatibilityMode) ([]Incompatibility, error) {
+	var issues []Incompatibility
+	if mode == CompatibilityBackward || mode == CompatibilityFull {
+		found, err := Incompatibilities(oldSchema, newSchema)
+		if err != nil {
+			return nil, err
+		}
+		for _, issue := range found {
+			issue.Direction = DirectionBackward
+			issues = append(issues, issue)
+		}
+	}
+	if mode == CompatibilityForward || mode == CompatibilityFull {
+		found, err := Incompatibilities(newSchema, oldSchema)
+		if err != nil {
+			return nil, err
+		}
+		for _, issue := range found {
+			issue.Direction = DirectionForward
+			issues = append(issues, issue)
+		}
+	}
+	return issues, nil
+}
+
+// compileSchemaTree returns the tree of schema's cached codec, so the tree
+// parser never sees a schema the codecs would reject.
+func compileSchemaTree(schema string) (*schemaNode, error) {
+	codec, err := DefaultCache.Get(schema)
+	if err != nil {
+		return nil, err
+	}
+	return codec.typeTree()
+}
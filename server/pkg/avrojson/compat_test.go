@@ -0,0 +1,86 @@
+package avrojson
+
+import "testing"
+
+const compatOld = `{"type":"record","name":"Event","fields":[
+	{"name":"a","type":"int"},
+	{"name":"b","type":"string"},
+	{"name":"e","type":{"type":"enum","name":"Kind","symbols":["X","Y"]}}
+]}`
+
+const compatNew = `{"type":"record","name":"Event","fields":[
+	{"name":"a","type":"long"},
+	{"name":"c","type":"string"},
+	{"name":"e","type":{"type":"enum","name":"Kind","symbols":["X"]}},
+	{"name":"d","type":["null","string"],"default":null}
+]}`
+
+func TestCheckCompatibilityReportsEveryIncompatibility(t *testing.T) {
+	type want struct{ direction, path, writer, reader string }
+	cases := map[CompatibilityMode][]want{
+		CompatibilityBackward: {
+			{DirectionBackward, "c", "", "string"},
+			{DirectionBackward, "e", "Kind", "Kind"},
+		},
+		CompatibilityForward: {
+			{DirectionForward, "a", "long", "int"},
+			{DirectionForward, "b", "", "string"},
+		},
+		CompatibilityFull: {
+			{DirectionBackward, "c", "", "string"},
+			{DirectionBackward, "e", "Kind", "Kind"},
+			{DirectionForward, "a", "long", "int"},
+			{DirectionForward, "b", "", "string"},
+		},
+	}
+	for mode, expected := range cases {
+		issues, err := CheckCompatibility(compatOld, compatNew, mode)
+		if err != nil {
+			t.Fatalf("Failed to check %s compatibility: %v", mode, err)
+		}
+		if len(issues) != len(expected) {
+			t.Fatalf("%s: expected %d incompatibilities, got %+v", mode, len(expected), issues)
+		}
+		for i, w := range expected {
+			got := issues[i]
+			if got.Direction != w.direction || got.Path != w.path || got.WriterType != w.writer || got.ReaderType != w.reader || got.Message == "" {
+				t.Errorf("%s %d: expected %+v, got %+v", mode, i, w, got)
+			}
+		}
+	}
+
+	issues, err := CheckCompatibility(compatOld, compatOld, CompatibilityFull)
+	if err != nil || len(issues) != 0 {
+		t.Errorf("expected a schema to be compatible with itself, got %+v, %v", issues, err)
+	}
+	if _, err := CheckCompatibility(compatOld, `{"type":"nope"}`, CompatibilityBackward); err == nil {
+		t.Error("expected an invalid schema to fail")
+	}
+}
+
+func TestIncompatibilitiesRequireEveryWriterBranch(t *testing.T) {
+	writer := `{"type":"record","name":"R","fields":[{"name":"v","type":["null","string"]}]}`
+	reader := `{"type":"record","name":"R","fields":[{"name":"v","type":"string"}]}`
+
+	// The resolver accepts it since strings still resolve...
+	if _, err := NewResolver(writer, reader); err != nil {
+		t.Fatalf("Failed to create resolver: %v", err)
+	}
+	// ...but a gate must not, as nulls do not.
+	issues, err := Incompatibilities(writer, reader)
+	if err != nil {
+		t.Fatalf("Failed to check compatibility: %v", err)
+	}
+	if len(issues) != 1 || issues[0].Path != "v" || issues[0].WriterType != "null" {
+		t.Errorf("expected the null branch of v to be reported, got %+v", issues)
+	}
+}
+
+func TestParseCompatibilityMode(t *testing.T) {
+	if mode, err := ParseCompatibilityMode("full"); err != nil || mode != CompatibilityFull {
+		t.Errorf("expected FULL, got %q, %v", mode, err)
+	}
+	if _, err := ParseCompatibilityMode("TRANSITIVE"); err == nil {
+		t.Error("expected an unknown mode to fail")
+	}
+}
@@ -0,0 +1,529 @@
+package avrojson
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RawJSON selects how json.RawMessage fields are converted.
+type RawJSON string
+
+const (
+	// RawJSONString stores the raw JSON text in a string field, the type
+	// SchemaOf generates, and reads it back unchanged.
+	RawJSONString RawJSON = ""
+	// RawJSONParse stores the parsed JSON value, for schemas whose field
+	// is a map, array or record, and reads the native value back as JSON.
+	RawJSONParse RawJSON = "parse"
+)
+
+// SetRawJSON sets how the codec converts json.RawMessage fields. Like
+// SetNaming, the setting is shared by every user of the codec.
+func (c *Codec) SetRawJSON(mode RawJSON) {
+	c.rawJSON.Store(string(mode))
+}
+
+// RawJSON returns the codec's json.RawMessage mode, RawJSONString unless
+// SetRawJSON was called.
+func (c *Codec) RawJSON() RawJSON {
+	mode, _ := c.rawJSON.Load().(string)
+	return RawJSON(mode)
+}
+
+// SetRawJSON compiles schema if needed and sets the json.RawMessage mode
+// of its codec.
+func (c *Cache) SetRawJSON(schema string, mode RawJSON) error {
+	codec, err := c.Get(schema)
+	if err != nil {
+		return err
+	}
+	codec.SetRawJSON(mode)
+	return nil
+}
+
+var (
+	rawMessageType      = reflect.TypeOf(json.RawMessage(nil))
+	jsonMarshalerType   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// converter turns Go values into goavro's native form and back. Struct
+// fields are named and skipped like encoding/json does, and values keep
+// the Go types goavro understands:
+//
+//	time.Time        time.Time, for timestamp-millis and the other time types
+//	time.Duration    int64 milliseconds
+//	json.RawMessage  string or parsed value, per RawJSON
+//	big.Rat, big.Int *big.Rat, for decimals
+//	[]byte, [N]byte  []byte
+//	integers         int64
+//	json.Number      int64 or float64, in interface{} values; see SetJSONNumbers
+//
+// Registered adapters and AvroMarshaler types convert themselves first.
+// Types with their own JSON or text marshaling, such as LogData, go
+// through encoding/json as before.
+type converter struct {
+	rawJSON RawJSON
+}
+
+func (cv converter) toNative(v reflect.Value) (interface{}, error) {
+	if !v.IsValid() {
+		return nil, nil
+	}
+	if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil() {
+		return nil, nil
+	}
+	if v.Kind() == reflect.Ptr {
+		// Pointers are only adapted when registered as such; otherwise
+		// the value they point to is.
+		if a, ok := adapterFor(v.Type()); ok {
+			return a.ToAvro(v.Interface())
+		}
+	} else if native, ok, err := adaptToNative(v); ok {
+		return native, err
+	}
+	switch v.Type() {
+	case timeType:
+		return v.Interface().(time.Time), nil
+	case durationType:
+		return v.Interface().(time.Duration).Milliseconds(), nil
+	case rawMessageType:
+		raw := v.Interface().(json.RawMessage)
+		if len(raw) == 0 {
+			return nil, nil
+		}
+		if cv.rawJSON == RawJSONParse {
+			var parsed interface{}
+			if err := unmarshalJSON(raw, &parsed); err != nil {
+				return nil, fmt.Errorf("avrojson: invalid json.RawMessage: %w", err)
+			}
+			return parsed, nil
+		}
+		return string(raw), nil
+	case ratType:
+		r := v.Interface().(big.Rat)
+		return new(big.Rat).Set(&r), nil
+	case bigIntType:
+		i := v.Interface().(big.Int)
+		return new(big.Rat).SetInt(&i), nil
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.Kind() == reflect.Ptr && v.Type().Elem() == ratType {
+			return new(big.Rat).Set(v.Interface().(*big.Rat)), nil
+		}
+		if v.Kind() == reflect.Ptr && v.Type().Elem() == bigIntType {
+			return new(big.Rat).SetInt(v.Interface().(*big.Int)), nil
+		}
+		// Marshalers with pointer receivers are only reachable here.
+		if v.Kind() == reflect.Ptr && marshalsItself(v.Type()) && !marshalsItself(v.Type().Elem()) {
+			return viaJSON(v.Interface())
+		}
+		// Numbers decoded with UseNumber are numbers, not strings.
+		if v.Kind() == reflect.Interface && v.Elem().Type() == jsonNumberType {
+			return numberValue(json.Number(v.Elem().String())), nil
+		}
+		return cv.toNative(v.Elem())
+	}
+	if marshalsItself(v.Type()) {
+		return viaJSON(v.Interface())
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n := v.Uint()
+		if n > math.MaxInt64 {
+			return nil, fmt.Errorf("avrojson: %d overflows long", n)
+		}
+		return int64(n), nil
+	case reflect.Float32:
+		return float32(v.Float()), nil
+	case reflect.Float64:
+		return v.Float(), nil
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil, nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return append([]byte(nil), v.Bytes()...), nil
+		}
+		return cv.listToNative(v)
+	case reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			out := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(out), v)
+			return out, nil
+		}
+		return cv.listToNative(v)
+	case reflect.Map:
+		if v.IsNil() {
+			return nil, nil
+		}
+		if v.Type().Key().Kind() != reflect.String {
+			return viaJSON(v.Interface())
+		}
+		out := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			value, err := cv.toNative(iter.Value())
+			if err != nil {
+				return nil, err
+			}
+			out[iter.Key().String()] = value
+		}
+		return out, nil
+	case reflect.Struct:
+		out := make(map[string]interface{})
+		for _, f := range jsonFields(v.Type()) {
+			fv, ok := fieldByIndex(v, f.index)
+			if !ok || (f.omitEmpty && isEmptyValue(fv)) {
+				continue
+			}
+			value, err := cv.toNative(fv)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", f.name, err)
+			}
+			out[f.name] = value
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("avrojson: cannot convert %v to an Avro value", v.Type())
+}
+
+func (cv converter) listToNative(v reflect.Value) (interface{}, error) {
+	out := make([]interface{}, v.Len())
+	for i := range out {
+		item, err := cv.toNative(v.Index(i))
+		if err != nil {
+			return nil, err
+		}
+		out[i] = item
+	}
+	return out, nil
+}
+
+// fromNative stores native in v, which must be settable.
+func (cv converter) fromNative(native interface{}, v reflect.Value) error {
+	t := v.Type()
+	if native == nil {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+			v.Set(reflect.Zero(t))
+		}
+		return nil
+	}
+	if ok, err := adaptFromNative(native, v); ok {
+		return err
+	}
+	switch t {
+	case timeType:
+		switch n := native.(type) {
+		case time.Time:
+			v.Set(reflect.ValueOf(n))
+			return nil
+		case int64:
+			v.Set(reflect.ValueOf(time.UnixMilli(n).UTC()))
+			return nil
+		}
+	case durationType:
+		switch n := native.(type) {
+		case time.Duration:
+			v.SetInt(int64(n))
+			return nil
+		case int64:
+			v.SetInt(int64(time.Duration(n) * time.Millisecond))
+			return nil
+		case int32:
+			v.SetInt(int64(time.Duration(n) * time.Millisecond))
+			return nil
+		case float64:
+			v.SetInt(int64(n * float64(time.Millisecond)))
+			return nil
+		}
+	case rawMessageType:
+		if s, ok := native.(string); ok && cv.rawJSON != RawJSONParse {
+			if !json.Valid([]byte(s)) {
+				return fmt.Errorf("avrojson: string %q is not valid JSON for a json.RawMessage", s)
+			}
+			v.SetBytes([]byte(s))
+			return nil
+		}
+		data, err := json.Marshal(native)
+		if err != nil {
+			return err
+		}
+		v.SetBytes(data)
+		return nil
+	case ratType:
+		if r, ok := native.(*big.Rat); ok {
+			v.Addr().Interface().(*big.Rat).Set(r)
+			return nil
+		}
+	case bigIntType:
+		if r, ok := native.(*big.Rat); ok {
+			if !r.IsInt() {
+				return fmt.Errorf("avrojson: decimal %s is not an integer", r.RatString())
+			}
+			v.Addr().Interface().(*big.Int).Set(r.Num())
+			return nil
+		}
+	}
+	if t.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(t.Elem()))
+		}
+		return cv.fromNative(native, v.Elem())
+	}
+	if t.Kind() == reflect.Interface || unmarshalsItself(t) {
+		return intoViaJSON(native, v)
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		m, ok := native.(map[string]interface{})
+		if !ok {
+			break
+		}
+		for _, f := range jsonFields(t) {
+			value, ok := m[f.name]
+			if !ok {
+				if value, ok = lookupFold(m, f.name); !ok {
+					continue
+				}
+			}
+			fv, ok := allocFieldByIndex(v, f.index)
+			if !ok {
+				continue
+			}
+			if err := cv.fromNative(value, fv); err != nil {
+				return fmt.Errorf("field %s: %w", f.name, err)
+			}
+		}
+		return nil
+	case reflect.Map:
+		m, ok := native.(map[string]interface{})
+		if !ok || t.Key().Kind() != reflect.String {
+			break
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMapWithSize(t, len(m)))
+		}
+		for key, value := range m {
+			elem := reflect.New(t.Elem()).Elem()
+			if err := cv.fromNative(value, elem); err != nil {
+				return fmt.Errorf("key %q: %w", key, err)
+			}
+			v.SetMapIndex(reflect.ValueOf(key).Convert(t.Key()), elem)
+		}
+		return nil
+	case reflect.Slice, reflect.Array:
+		if b, ok := native.([]byte); ok && t.Elem().Kind() == reflect.Uint8 {
+			if t.Kind() == reflect.Slice {
+				v.SetBytes(append([]byte(nil), b...))
+			} else if len(b) == t.Len() {
+				reflect.Copy(v, reflect.ValueOf(b))
+			} else {
+				return fmt.Errorf("avrojson: %d bytes for %v", len(b), t)
+			}
+			return nil
+		}
+		items, ok := native.([]interface{})
+		if !ok {
+			break
+		}
+		if t.Kind() == reflect.Slice {
+			v.Set(reflect.MakeSlice(t, len(items), len(items)))
+		} else if len(items) != t.Len() {
+			return fmt.Errorf("avrojson: %d items for %v", len(items), t)
+		}
+		for i, item := range items {
+			if err := cv.fromNative(item, v.Index(i)); err != nil {
+				return fmt.Errorf("item %d: %w", i, err)
+			}
+		}
+		return nil
+	case reflect.String:
+		if s, ok := native.(string); ok {
+			v.SetString(s)
+			return nil
+		}
+	case reflect.Bool:
+		if b, ok := native.(bool); ok {
+			v.SetBool(b)
+			return nil
+		}
+	}
+	// Numbers and any other mismatch get encoding/json's conversions and
+	// errors.
+	return intoViaJSON(native, v)
+}
+
+func marshalsItself(t reflect.Type) bool {
+	return t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType)
+}
+
+func unmarshalsItself(t reflect.Type) bool {
+	pt := reflect.PointerTo(t)
+	return pt.Implements(jsonUnmarshalerType) || pt.Implements(textUnmarshalerType)
+}
+
+// viaJSON converts v the way the JSON-based ToNative always has.
+func viaJSON(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out interface{}
+	if err := unmarshalJSON(data, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func intoViaJSON(native interface{}, v reflect.Value) error {
+	data, err := json.Marshal(native)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v.Addr().Interface())
+}
+
+// jsonField is a struct field as encoding/json sees it.
+type jsonField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+var jsonFieldCache sync.Map // reflect.Type -> []jsonField
+
+// jsonFields lists the fields of t encoding/json would encode, with the
+// fields of untagged embedded structs promoted. A field wins over promoted
+// fields of the same name, as the shallower one does in encoding/json.
+func jsonFields(t reflect.Type) []jsonField {
+	if cached, ok := jsonFieldCache.Load(t); ok {
+		return cached.([]jsonField)
+	}
+	var fields []jsonField
+	seen := map[string]bool{}
+	var promoted []jsonField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if sf.Anonymous && name == "" {
+			ft := sf.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				for _, f := range jsonFields(ft) {
+					f.index = append([]int{i}, f.index...)
+					promoted = append(promoted, f)
+				}
+				continue
+			}
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		omitEmpty := false
+		for _, opt := range strings.Split(opts, ",") {
+			if opt == "omitempty" {
+				omitEmpty = true
+			}
+		}
+		fields = append(fields, jsonField{name: name, index: []int{i}, omitEmpty: omitEmpty})
+		seen[name] = true
+	}
+	for _, f := range promoted {
+		if !seen[f.name] {
+			fields = append(fields, f)
+			seen[f.name] = true
+		}
+	}
+	jsonFieldCache.Store(t, fields)
+	return fields
+}
+
+// fieldByIndex follows index through embedded pointers, reporting false at
+// a nil one.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// allocFieldByIndex follows index, allocating nil embedded pointers. It
+// reports false at a nil pointer it may not set, as an unexported one.
+func allocFieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+func lookupFold(m map[string]interface{}, name string) (interface{}, bool) {
+	for key, value := range m {
+		if strings.EqualFold(key, name) {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// isEmptyValue reports whether omitempty drops v, as in encoding/json.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
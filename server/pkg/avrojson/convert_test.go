@@ -0,0 +1,104 @@
+package avrojson
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+type testTiming struct {
+	At      time.Time       `json:"at"`
+	Took    time.Duration   `json:"took"`
+	Payload json.RawMessage `json:"payload"`
+	Seen    *time.Time      `json:"seen"`
+	Retry   *time.Duration  `json:"retry"`
+}
+
+func TestConvertTimeTypesRoundTrip(t *testing.T) {
+	schema, err := SchemaOf(testTiming{})
+	if err != nil {
+		t.Fatalf("Failed to generate schema: %v", err)
+	}
+	codec, err := NewCodec(schema)
+	if err != nil {
+		t.Fatalf("Failed to compile %s: %v", schema, err)
+	}
+
+	seen := time.UnixMilli(1760400000123).UTC()
+	retry := 1500 * time.Millisecond
+	for name, in := range map[string]testTiming{
+		"set":   {At: time.UnixMilli(1760434245678).UTC(), Took: 2*time.Second + 250*time.Millisecond, Payload: json.RawMessage(`{"items":[1,2],"ok":true}`), Seen: &seen, Retry: &retry},
+		"empty": {At: time.UnixMilli(0).UTC(), Payload: json.RawMessage(`null`)},
+	} {
+		data, err := codec.Encode(in)
+		if err != nil {
+			t.Fatalf("%s: Failed to encode: %v", name, err)
+		}
+		var out testTiming
+		if err := codec.Decode(data, &out); err != nil {
+			t.Fatalf("%s: Failed to decode: %v", name, err)
+		}
+		if !out.At.Equal(in.At) || out.Took != in.Took || string(out.Payload) != string(in.Payload) {
+			t.Errorf("%s: round trip gave %+v, want %+v", name, out, in)
+		}
+		if (in.Seen == nil) != (out.Seen == nil) || (in.Seen != nil && !out.Seen.Equal(*in.Seen)) {
+			t.Errorf("%s: seen = %v, want %v", name, out.Seen, in.Seen)
+		}
+		if (in.Retry == nil) != (out.Retry == nil) || (in.Retry != nil && *out.Retry != *in.Retry) {
+			t.Errorf("%s: retry = %v, want %v", name, out.Retry, in.Retry)
+		}
+	}
+
+	// Durations are stored as milliseconds and raw JSON as its text.
+	data, _ := codec.Encode(testTiming{Took: 90 * time.Second, Payload: json.RawMessage(`[1]`)})
+	native, err := codec.DecodeNative(data)
+	if err != nil {
+		t.Fatalf("Failed to decode native: %v", err)
+	}
+	record := native.(map[string]interface{})
+	if record["took"] != int64(90000) || record["payload"] != "[1]" {
+		t.Errorf("unexpected native record %v", record)
+	}
+}
+
+func TestConvertRawJSONModes(t *testing.T) {
+	const schema = `{"type":"record","name":"Event","fields":[
+		{"name":"payload","type":["null",{"type":"map","values":"string"}],"default":null}
+	]}`
+	type event struct {
+		Payload json.RawMessage `json:"payload"`
+	}
+	codec, err := NewCodec(schema)
+	if err != nil {
+		t.Fatalf("Failed to compile schema: %v", err)
+	}
+	if _, err := codec.Encode(event{Payload: json.RawMessage(`{"a":"b"}`)}); err == nil {
+		t.Error("Expected raw JSON text not to fit a map field in string mode")
+	}
+
+	codec.SetRawJSON(RawJSONParse)
+	if codec.RawJSON() != RawJSONParse {
+		t.Fatalf("RawJSON = %q after SetRawJSON", codec.RawJSON())
+	}
+	data, err := codec.Encode(event{Payload: json.RawMessage(`{"a":"b"}`)})
+	if err != nil {
+		t.Fatalf("Failed to encode parsed raw JSON: %v", err)
+	}
+	var out event
+	if err := codec.Decode(data, &out); err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if string(out.Payload) != `{"a":"b"}` {
+		t.Errorf("payload = %s", out.Payload)
+	}
+
+	// String mode only reads back valid JSON.
+	strings, err := NewCodec(`{"type":"record","name":"Event","fields":[{"name":"payload","type":"string"}]}`)
+	if err != nil {
+		t.Fatalf("Failed to compile schema: %v", err)
+	}
+	data, _ = strings.EncodeNative(map[string]interface{}{"payload": "not json"})
+	if err := strings.Decode(data, &out); err == nil {
+		t.Error("Expected a non-JSON string to be rejected for a json.RawMessage")
+	}
+}
@@ -0,0 +1,76 @@
+package avrojson
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+)
+
+var bigIntType = reflect.TypeOf(big.Int{})
+
+// ParseDecimal parses a decimal string such as "-1234.50" or "1e-3"
+// exactly, for monetary values that must not pass through float64.
+// Fractions like "1/3" are rejected.
+func ParseDecimal(s string) (*big.Rat, error) {
+	if strings.Contains(s, "/") {
+		return nil, fmt.Errorf("avrojson: invalid decimal %q", s)
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, fmt.Errorf("avrojson: invalid decimal %q", s)
+	}
+	return r, nil
+}
+
+// FormatDecimal formats r with exactly scale decimal places, rounding
+// halves away from zero, e.g. "12.30" for scale 2.
+func FormatDecimal(r *big.Rat, scale int) string {
+	return r.FloatString(scale)
+}
+
+// DecimalAdapter returns an Adapter storing a decimal type, such as
+// shopspring's decimal.Decimal, as an Avro bytes decimal by way of
+// big.Rat:
+//
+//	avrojson.RegisterAdapter(decimal.Decimal{}, avrojson.DecimalAdapter(18, 2,
+//		func(v interface{}) (*big.Rat, error) { return v.(decimal.Decimal).Rat(), nil },
+//		func(r *big.Rat) (interface{}, error) { return decimal.NewFromBigRat(r, 2), nil }))
+//
+// Values with more digits than precision or scale allow fail to encode.
+func DecimalAdapter(precision, scale int, toRat func(v interface{}) (*big.Rat, error), fromRat func(r *big.Rat) (interface{}, error)) Adapter {
+	return Adapter{
+		Schema: fmt.Sprintf(`{"type":"bytes","logicalType":"decimal","precision":%d,"scale":%d}`, precision, scale),
+		ToAvro: func(v interface{}) (interface{}, error) {
+			r, err := toRat(v)
+			if err != nil {
+				return nil, err
+			}
+			if r == nil {
+				return nil, errors.New("avrojson: decimal adapter returned a nil *big.Rat")
+			}
+			return r, nil
+		},
+		FromAvro: func(native interface{}) (interface{}, error) {
+			r, ok := native.(*big.Rat)
+			if !ok {
+				return nil, fmt.Errorf("avrojson: expected a decimal, got %T", native)
+			}
+			return fromRat(r)
+		},
+	}
+}
+
+// checkDecimal reports whether r is representable with precision digits,
+// scale of them after the point. goavro would truncate the extra digits.
+func checkDecimal(r *big.Rat, precision, scale int) error {
+	unscaled := new(big.Rat).Mul(r, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil)))
+	if !unscaled.IsInt() {
+		return fmt.Errorf("decimal %s has more than %d decimal places", r.FloatString(scale+1), scale)
+	}
+	if digits := len(new(big.Int).Abs(unscaled.Num()).String()); digits > precision {
+		return fmt.Errorf("decimal %s exceeds precision %d", r.FloatString(scale), precision)
+	}
+	return nil
+}
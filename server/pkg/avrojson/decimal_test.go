@@ -0,0 +1,150 @@
+package avrojson
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+)
+
+// testMoney stands in for shopspring's decimal.Decimal: an unscaled
+// coefficient and a fixed number of cents.
+type testMoney struct {
+	cents *big.Int
+}
+
+func init() {
+	err := RegisterAdapter(testMoney{}, DecimalAdapter(18, 2,
+		func(v interface{}) (*big.Rat, error) {
+			return new(big.Rat).SetFrac(v.(testMoney).cents, big.NewInt(100)), nil
+		},
+		func(r *big.Rat) (interface{}, error) {
+			cents := new(big.Rat).Mul(r, big.NewRat(100, 1))
+			return testMoney{cents: cents.Num()}, nil
+		}))
+	if err != nil {
+		panic(err)
+	}
+}
+
+type testAccount struct {
+	Balance big.Rat   `json:"balance" avro:"balance,scale=2"`
+	Points  big.Int   `json:"points"`
+	Limit   *big.Rat  `json:"limit" avro:"limit,precision=10,scale=2"`
+	Fee     testMoney `json:"fee"`
+}
+
+func mustDecimal(t *testing.T, s string) *big.Rat {
+	t.Helper()
+	r, err := ParseDecimal(s)
+	if err != nil {
+		t.Fatalf("Failed to parse %s: %v", s, err)
+	}
+	return r
+}
+
+func TestDecimalRoundTrip(t *testing.T) {
+	schema, err := SchemaOf(testAccount{})
+	if err != nil {
+		t.Fatalf("Failed to generate schema: %v", err)
+	}
+	for _, want := range []string{
+		`"name":"balance","type":{"type":"bytes","logicalType":"decimal","precision":38,"scale":2}`,
+		`"name":"points","type":{"type":"bytes","logicalType":"decimal","precision":38,"scale":0}`,
+		`"name":"limit","type":["null",{"type":"bytes","logicalType":"decimal","precision":10,"scale":2}]`,
+		`"name":"fee","type":{"type":"bytes","logicalType":"decimal","precision":18,"scale":2}`,
+	} {
+		if !strings.Contains(schema, want) {
+			t.Errorf("schema %s lacks %s", schema, want)
+		}
+	}
+	codec, err := NewCodec(schema)
+	if err != nil {
+		t.Fatalf("Failed to compile %s: %v", schema, err)
+	}
+
+	points, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	in := testAccount{Limit: mustDecimal(t, "5000.00"), Fee: testMoney{big.NewInt(-250)}}
+	in.Balance.Set(mustDecimal(t, "1234567890123.45"))
+	in.Points.Set(points)
+	data, err := codec.Encode(in)
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	var out testAccount
+	if err := codec.Decode(data, &out); err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if FormatDecimal(&out.Balance, 2) != "1234567890123.45" || out.Points.Cmp(points) != 0 ||
+		out.Limit == nil || FormatDecimal(out.Limit, 2) != "5000.00" || out.Fee.cents.Int64() != -250 {
+		t.Errorf("round trip gave balance %s, points %s, limit %v, fee %v", out.Balance.RatString(), out.Points.String(), out.Limit, out.Fee.cents)
+	}
+}
+
+func TestDecimalValidation(t *testing.T) {
+	codec, err := NewCodec(`{"type":"record","name":"Order","fields":[
+		{"name":"total","type":{"type":"bytes","logicalType":"decimal","precision":6,"scale":2}},
+		{"name":"lines","type":{"type":"array","items":{"type":"record","name":"Line","fields":[
+			{"name":"price","type":["null",{"type":"bytes","logicalType":"decimal","precision":6,"scale":2}]}
+		]}}}
+	]}`)
+	if err != nil {
+		t.Fatalf("Failed to compile schema: %v", err)
+	}
+	order := func(total string, prices ...string) map[string]interface{} {
+		lines := make([]interface{}, len(prices))
+		for i, p := range prices {
+			lines[i] = map[string]interface{}{"price": map[string]interface{}{"bytes.decimal": mustDecimal(t, p)}}
+		}
+		return map[string]interface{}{"total": mustDecimal(t, total), "lines": lines}
+	}
+
+	if _, err := codec.EncodeNative(order("9999.99", "0.01", "-12.5")); err != nil {
+		t.Errorf("Expected values within precision and scale to encode: %v", err)
+	}
+	for want, native := range map[string]map[string]interface{}{
+		"total: decimal 1.005 has more than 2 decimal places": order("1.005"),
+		"total: decimal 10000.00 exceeds precision 6":         order("10000"),
+		"lines[1].price: decimal 0.001 has more than 2":       order("1", "2", "0.001"),
+	} {
+		_, err := codec.EncodeNative(native)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("error %v, want it to contain %q", err, want)
+		}
+	}
+
+	// big.Int only takes whole values, and only scale 0 in SchemaOf.
+	type whole struct {
+		N big.Int `json:"total"`
+	}
+	data, _ := NewCodec(`{"type":"record","name":"W","fields":[{"name":"total","type":{"type":"bytes","logicalType":"decimal","precision":6,"scale":2}}]}`)
+	encoded, err := data.EncodeNative(map[string]interface{}{"total": mustDecimal(t, "1.50")})
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	if err := data.Decode(encoded, &whole{}); err == nil {
+		t.Error("Expected a fractional decimal not to decode into a big.Int")
+	}
+	if _, err := SchemaOf(struct {
+		N big.Int `avro:"n,scale=2"`
+	}{}); err == nil {
+		t.Error("Expected a big.Int with scale 2 to be rejected")
+	}
+}
+
+func TestParseAndFormatDecimal(t *testing.T) {
+	sum := new(big.Rat).Add(mustDecimal(t, "0.1"), mustDecimal(t, "0.2"))
+	if got := FormatDecimal(sum, 2); got != "0.30" {
+		t.Errorf("0.1 + 0.2 = %s", got)
+	}
+	if got := FormatDecimal(mustDecimal(t, "-2.345"), 2); got != "-2.35" {
+		t.Errorf("rounded -2.345 = %s, want halves away from zero", got)
+	}
+	if got := FormatDecimal(mustDecimal(t, "1e-3"), 3); got != "0.001" {
+		t.Errorf("1e-3 = %s", got)
+	}
+	for _, bad := range []string{"1/3", "", "12,50", "abc"} {
+		if _, err := ParseDecimal(bad); err == nil {
+			t.Errorf("Expected %q to be rejected", bad)
+		}
+	}
+}
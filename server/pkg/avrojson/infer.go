@@ -0,0 +1,347 @@
+package avrojson
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// InferType returns an Avro type for value, a JSON value as encoding/json
+// decodes it into an interface{} (with or without UseNumber), and value
+// converted to fit it. It is an Inferrer that has observed value alone.
+func InferType(name string, value interface{}) (interface{}, interface{}) {
+	in := NewInferrer(name)
+	in.Observe(value)
+	return in.Type(), in.Convert(value)
+}
+
+// Inferrer synthesizes an Avro type for JSON values of any shape, so typed
+// fields keep their types where StringMap would store JSON text. Each
+// observed value widens the type to fit it as well as the values before:
+//
+//	null                           null
+//	true, false                    boolean
+//	integers within int64          long
+//	other finite numbers           double
+//	strings                        string
+//	objects                        record with a field per key, sorted
+//	arrays                         array of the type fitting every item
+//
+// A field some objects lack, or that is null in some, becomes ["null", T]
+// with a null default; longs seen with doubles become doubles; values of
+// kinds that do not mix, such as a string and a record, fall back to a
+// string holding their JSON text, as StringMap stores them. Records are
+// named after the inferrer's name, nested ones name_<key>, and array items
+// name_item. Objects whose keys are not Avro names become string maps,
+// and numbers a double would not hold, 1e400 or, decoded with UseNumber,
+// integers past int64, keep their text as strings.
+//
+// An Inferrer is not safe for concurrent use.
+type Inferrer struct {
+	name  string
+	shape *shape
+}
+
+// NewInferrer returns an Inferrer for a type named name.
+func NewInferrer(name string) *Inferrer {
+	return &Inferrer{name: name, shape: &shape{}}
+}
+
+// Observe widens the type to fit value.
+func (in *Inferrer) Observe(value interface{}) {
+	in.shape.merge(shapeOf(value))
+}
+
+// ObserveSchema widens the type to fit the values of schema, an Avro type
+// Type returned earlier, as a string or decoded JSON, so a type inferred
+// before, e.g. the latest version registered, keeps fitting its data.
+func (in *Inferrer) ObserveSchema(schema interface{}) error {
+	if text, ok := schema.(string); ok && strings.ContainsAny(text, "{[") {
+		if err := json.Unmarshal([]byte(text), &schema); err != nil {
+			return fmt.Errorf("avrojson: inferred schema: %w", err)
+		}
+	}
+	s, err := shapeOfSchema(schema)
+	if err != nil {
+		return fmt.Errorf("avrojson: inferred schema: %w", err)
+	}
+	in.shape.merge(s)
+	return nil
+}
+
+// Type returns the Avro type fitting every observed value, ready for
+// json.Marshal. Without observations it is null.
+func (in *Inferrer) Type() interface{} {
+	return in.shape.avroType(in.name)
+}
+
+// Convert returns value, one of the observed values, in the form Type
+// encodes: numbers as int64 or float64, values the type holds as strings
+// as their JSON text, and missing fields of records as nil.
+func (in *Inferrer) Convert(value interface{}) interface{} {
+	return in.shape.convert(value)
+}
+
+// Kinds of shape; the zero kind has seen no value yet.
+const (
+	kindNone    = ""
+	kindNull    = "null"
+	kindBoolean = "boolean"
+	kindLong    = "long"
+	kindDouble  = "double"
+	kindString  = "string"
+	kindRecord  = "record"
+	kindArray   = "array"
+	kindMap     = "map"
+)
+
+// shape is the type inferred for a value: its kind, whether it was null or
+// missing, and the shapes of a record's fields or an array's items.
+type shape struct {
+	kind     string
+	nullable bool
+	fields   map[string]*shape
+	items    *shape
+}
+
+func shapeOf(value interface{}) *shape {
+	switch v := value.(type) {
+	case nil:
+		return &shape{kind: kindNull}
+	case bool:
+		return &shape{kind: kindBoolean}
+	case string:
+		return &shape{kind: kindString}
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return &shape{kind: kindLong}
+		}
+		if f, err := v.Float64(); err == nil && !math.IsInf(f, 0) && strings.ContainsAny(string(v), ".eE") {
+			return &shape{kind: kindDouble}
+		}
+		return &shape{kind: kindString}
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) <= 1<<53 {
+			return &shape{kind: kindLong}
+		}
+		return &shape{kind: kindDouble}
+	case map[string]interface{}:
+		s := &shape{kind: kindRecord, fields: make(map[string]*shape, len(v))}
+		for k, field := range v {
+			if !avroName.MatchString(k) {
+				return &shape{kind: kindMap}
+			}
+			s.fields[k] = shapeOf(field)
+		}
+		return s
+	case []interface{}:
+		s := &shape{kind: kindArray, items: &shape{}}
+		for _, item := range v {
+			s.items.merge(shapeOf(item))
+		}
+		return s
+	}
+	// Values encoding/json does not produce keep their JSON text.
+	return &shape{kind: kindString}
+}
+
+// shapeOfSchema reads back a type avroType wrote.
+func shapeOfSchema(schema interface{}) (*shape, error) {
+	switch t := schema.(type) {
+	case string:
+		switch t {
+		case kindNull, kindBoolean, kindLong, kindDouble, kindString:
+			return &shape{kind: t}, nil
+		}
+	case []interface{}:
+		if len(t) == 2 && t[0] == kindNull {
+			s, err := shapeOfSchema(t[1])
+			if err != nil {
+				return nil, err
+			}
+			s.nullable = true
+			return s, nil
+		}
+	case map[string]interface{}:
+		switch t["type"] {
+		case kindRecord:
+			fields, _ := t["fields"].([]interface{})
+			s := &shape{kind: kindRecord, fields: make(map[string]*shape, len(fields))}
+			for _, f := range fields {
+				field, _ := f.(map[string]interface{})
+				name, _ := field["name"].(string)
+				fs, err := shapeOfSchema(field["type"])
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", name, err)
+				}
+				s.fields[name] = fs
+			}
+			return s, nil
+		case kindArray:
+			items, err := shapeOfSchema(t["items"])
+			if err != nil {
+				return nil, err
+			}
+			if items.kind == kindNull && !items.nullable {
+				// Items of arrays only seen empty.
+				items = &shape{}
+			}
+			return &shape{kind: kindArray, items: items}, nil
+		case kindMap:
+			if t["values"] == kindString {
+				return &shape{kind: kindMap}, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("unexpected type %v", schema)
+}
+
+// merge widens s to fit the values of o as well.
+func (s *shape) merge(o *shape) {
+	if o.kind == kindNone {
+		return
+	}
+	s.nullable = s.nullable || o.nullable
+	switch {
+	case o.kind == kindNull:
+		if s.kind == kindNone {
+			s.kind = kindNull
+		} else if s.kind != kindNull {
+			s.nullable = true
+		}
+		return
+	case s.kind == kindNull || s.kind == kindNone:
+		s.nullable = s.nullable || s.kind == kindNull
+		s.kind, s.fields, s.items = o.kind, o.fields, o.items
+		return
+	}
+	switch {
+	case s.kind == o.kind && s.kind == kindRecord:
+		for k, f := range s.fields {
+			if of, ok := o.fields[k]; ok {
+				f.merge(of)
+			} else {
+				f.nullable = true
+			}
+		}
+		for k, of := range o.fields {
+			if _, ok := s.fields[k]; !ok {
+				of.nullable = true
+				s.fields[k] = of
+			}
+		}
+	case s.kind == o.kind && s.kind == kindArray:
+		s.items.merge(o.items)
+	case s.kind == o.kind:
+	case (s.kind == kindLong && o.kind == kindDouble) || (s.kind == kindDouble && o.kind == kindLong):
+		s.kind = kindDouble
+	default:
+		s.kind, s.fields, s.items = kindString, nil, nil
+	}
+}
+
+func (s *shape) avroType(name string) interface{} {
+	var t interface{}
+	switch s.kind {
+	case kindNone, kindNull:
+		return kindNull
+	case kindRecord:
+		keys := make([]string, 0, len(s.fields))
+		for k := range s.fields {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		record := recordSchema{Type: kindRecord, Name: name, Fields: make([]fieldSchema, len(keys))}
+		for i, k := range keys {
+			f := s.fields[k]
+			record.Fields[i] = fieldSchema{Name: k, Type: f.avroType(name + "_" + k)}
+			if f.nullable || f.kind == kindNull {
+				record.Fields[i].Default = json.RawMessage("null")
+			}
+		}
+		t = record
+	case kindArray:
+		t = containerSchema{Type: kindArray, Items: s.items.avroType(name + "_item")}
+	case kindMap:
+		t = containerSchema{Type: kindMap, Values: kindString}
+	default:
+		t = s.kind
+	}
+	if s.nullable {
+		return []interface{}{kindNull, t}
+	}
+	return t
+}
+
+func (s *shape) convert(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	switch s.kind {
+	case kindLong:
+		switch v := value.(type) {
+		case json.Number:
+			n, _ := v.Int64()
+			return n
+		case float64:
+			return int64(v)
+		}
+	case kindDouble:
+		switch v := value.(type) {
+		case json.Number:
+			f, _ := v.Float64()
+			return f
+		case float64:
+			return v
+		}
+	case kindString:
+		return stringValue(value)
+	case kindMap:
+		if m, ok := value.(map[string]interface{}); ok {
+			return stringValues(m)
+		}
+	case kindRecord:
+		if m, ok := value.(map[string]interface{}); ok {
+			out := make(map[string]interface{}, len(s.fields))
+			for k, f := range s.fields {
+				out[k] = f.convert(m[k])
+			}
+			return out
+		}
+	case kindArray:
+		if items, ok := value.([]interface{}); ok {
+			out := make([]interface{}, len(items))
+			for i, item := range items {
+				out[i] = s.items.convert(item)
+			}
+			return out
+		}
+	}
+	return value
+}
+
+// avroName matches the names Avro allows for fields and records.
+var avroName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func stringValues(m map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		out[k] = stringValue(v)
+	}
+	return out
+}
+
+// stringValue converts v as StringMap converts map values.
+func stringValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case nil:
+		return ""
+	}
+	text, _ := json.Marshal(v)
+	return string(text)
+}
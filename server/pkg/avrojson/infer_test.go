@@ -0,0 +1,136 @@
+package avrojson
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestInferType(t *testing.T) {
+	text := `{"level":3,"score":1.5,"ok":true,"note":null,"id":123456789012345678901,
+		"pos":{"y":2,"x":1},"tags":["a","b"],"mixed":[1,"a"],"headers":{"x-trace":7}}`
+	dec := json.NewDecoder(strings.NewReader(text))
+	dec.UseNumber()
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+
+	typ, converted := InferType("Domain", value)
+	schema, err := json.Marshal(typ)
+	if err != nil {
+		t.Fatalf("Failed to marshal schema: %v", err)
+	}
+	want := `{"type":"record","name":"Domain","fields":[` +
+		`{"name":"headers","type":{"type":"map","values":"string"}},` +
+		`{"name":"id","type":"string"},` +
+		`{"name":"level","type":"long"},` +
+		`{"name":"mixed","type":{"type":"array","items":"string"}},` +
+		`{"name":"note","type":"null","default":null},` +
+		`{"name":"ok","type":"boolean"},` +
+		`{"name":"pos","type":{"type":"record","name":"Domain_pos","fields":[{"name":"x","type":"long"},{"name":"y","type":"long"}]}},` +
+		`{"name":"score","type":"double"},` +
+		`{"name":"tags","type":{"type":"array","items":"string"}}]}`
+	if string(schema) != want {
+		t.Fatalf("unexpected schema:\n%s\nwant\n%s", schema, want)
+	}
+
+	codec, err := NewCodec(string(schema))
+	if err != nil {
+		t.Fatalf("Failed to compile schema: %v", err)
+	}
+	binary, err := codec.EncodeNative(converted)
+	if err != nil {
+		t.Fatalf("Failed to encode the converted value: %v", err)
+	}
+	out, err := codec.BinaryToJSON(binary)
+	if err != nil {
+		t.Fatalf("Failed to convert to JSON: %v", err)
+	}
+	for _, part := range []string{`"level":3`, `"score":1.5`, `"id":"123456789012345678901"`, `"mixed":["1","a"]`, `"headers":{"x-trace":"7"}`} {
+		if !bytes.Contains(out, []byte(part)) {
+			t.Errorf("expected %s in %s", part, out)
+		}
+	}
+
+	// Arrays of records share one item type fitting them all.
+	var events interface{}
+	json.Unmarshal([]byte(`[{"n":1},{"n":2.5}]`), &events)
+	typ, _ = InferType("Events", events)
+	if got := marshalType(t, typ); got != `{"type":"array","items":{"type":"record","name":"Events_item","fields":[{"name":"n","type":"double"}]}}` {
+		t.Errorf("expected an array of Events_item records with a double n, got %s", got)
+	}
+}
+
+func TestInferrerMergesShapes(t *testing.T) {
+	in := NewInferrer("Domain")
+	bodies := []string{
+		`{"id":1,"name":"a","pos":{"x":1},"tags":[]}`,
+		`{"id":2.5,"pos":{"x":2,"y":3},"tags":["t"],"extra":null}`,
+		`{"id":3,"name":"b","pos":"none","tags":["u"],"extra":true}`,
+	}
+	var values []interface{}
+	for _, body := range bodies {
+		var v interface{}
+		json.Unmarshal([]byte(body), &v)
+		in.Observe(v)
+		values = append(values, v)
+	}
+	want := `{"type":"record","name":"Domain","fields":[` +
+		`{"name":"extra","type":["null","boolean"],"default":null},` +
+		`{"name":"id","type":"double"},` +
+		`{"name":"name","type":["null","string"],"default":null},` +
+		`{"name":"pos","type":"string"},` +
+		`{"name":"tags","type":{"type":"array","items":"string"}}]}`
+	schema := marshalType(t, in.Type())
+	if schema != want {
+		t.Fatalf("unexpected schema:\n%s\nwant\n%s", schema, want)
+	}
+
+	codec, err := NewCodec(schema)
+	if err != nil {
+		t.Fatalf("Failed to compile schema: %v", err)
+	}
+	binary, err := codec.Encode(in.Convert(values[1]))
+	if err != nil {
+		t.Fatalf("Failed to encode the converted value: %v", err)
+	}
+	out, err := codec.BinaryToJSON(binary)
+	if err != nil {
+		t.Fatalf("Failed to convert to JSON: %v", err)
+	}
+	for _, part := range []string{`"id":2.5`, `"name":null`, `"pos":"{\"x\":2,\"y\":3}"`} {
+		if !bytes.Contains(out, []byte(part)) {
+			t.Errorf("expected %s in %s", part, out)
+		}
+	}
+
+	// A type read back, seen with a new field, keeps fitting old values.
+	again := NewInferrer("Domain")
+	if err := again.ObserveSchema(schema); err != nil {
+		t.Fatalf("Failed to observe schema: %v", err)
+	}
+	if got := marshalType(t, again.Type()); got != want {
+		t.Errorf("expected the schema read back unchanged, got %s", got)
+	}
+	var v interface{}
+	json.Unmarshal([]byte(`{"id":4,"pos":"p","tags":[],"level":1}`), &v)
+	again.Observe(v)
+	if got := marshalType(t, again.Type()); !strings.Contains(got, `{"name":"level","type":["null","long"],"default":null}`) ||
+		!strings.Contains(got, `{"name":"id","type":"double"}`) {
+		t.Errorf("expected a nullable level next to the old fields, got %s", got)
+	}
+	if err := again.ObserveSchema(`{"type":"enum","name":"E","symbols":["A"]}`); err == nil {
+		t.Error("expected a type the inferrer does not write to fail")
+	}
+}
+
+func marshalType(t *testing.T, typ interface{}) string {
+	t.Helper()
+	text, err := json.Marshal(typ)
+	if err != nil {
+		t.Fatalf("Failed to marshal schema: %v", err)
+	}
+	return string(text)
+}
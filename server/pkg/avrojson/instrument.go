@@ -0,0 +1,304 @@
+package avrojson
+
+import (
+	"encoding/json"
+	"math/bits"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stage names one goavro conversion. Every Codec method is made of one or
+// two stages, and each is measured separately.
+type Stage string
+
+const (
+	StageBinaryFromNative  Stage = "binary_from_native"
+	StageNativeFromBinary  Stage = "native_from_binary"
+	StageTextualFromNative Stage = "textual_from_native"
+	StageNativeFromTextual Stage = "native_from_textual"
+)
+
+// Indexes into stages and schemaMetrics.stages.
+const (
+	binaryFromNativeStage = iota
+	nativeFromBinaryStage
+	textualFromNativeStage
+	nativeFromTextualStage
+)
+
+var stages = [...]Stage{
+	binaryFromNativeStage:  StageBinaryFromNative,
+	nativeFromBinaryStage:  StageNativeFromBinary,
+	textualFromNativeStage: StageTextualFromNative,
+	nativeFromTextualStage: StageNativeFromTextual,
+}
+
+// Span describes one instrumented goavro call. Bytes is the size of the
+// binary or textual side of the conversion: the output when encoding, the
+// input when decoding.
+type Span struct {
+	Schema      string
+	Fingerprint string
+	Stage       Stage
+	Start       time.Time
+	Duration    time.Duration
+	Bytes       int
+	Err         error
+	ErrorType   string
+}
+
+var tracer atomic.Pointer[func(Span)]
+
+// SetTracer installs fn to receive a Span for every goavro call, for example
+// to export them to a tracing backend. Pass nil to disable tracing. Metrics
+// are collected regardless.
+func SetTracer(fn func(Span)) {
+	if fn == nil {
+		tracer.Store(nil)
+		return
+	}
+	tracer.Store(&fn)
+}
+
+// latencyBuckets holds power-of-two microsecond buckets: bucket i counts
+// calls that took less than 2^i µs, the last one everything slower.
+const latencyBuckets = 24
+
+type stageMetrics struct {
+	calls      atomic.Uint64
+	errors     atomic.Uint64
+	bytes      atomic.Uint64
+	totalNanos atomic.Int64
+	maxNanos   atomic.Int64
+	latency    [latencyBuckets]atomic.Uint64
+
+	errMu      sync.Mutex
+	errorTypes map[string]uint64
+}
+
+func (m *stageMetrics) observe(d time.Duration, size int, errType string) {
+	m.calls.Add(1)
+	m.bytes.Add(uint64(size))
+	m.totalNanos.Add(int64(d))
+	for {
+		max := m.maxNanos.Load()
+		if int64(d) <= max || m.maxNanos.CompareAndSwap(max, int64(d)) {
+			break
+		}
+	}
+	bucket := bits.Len64(uint64(d / time.Microsecond))
+	if bucket >= latencyBuckets {
+		bucket = latencyBuckets - 1
+	}
+	m.latency[bucket].Add(1)
+
+	if errType != "" {
+		m.errors.Add(1)
+		m.errMu.Lock()
+		if m.errorTypes == nil {
+			m.errorTypes = make(map[string]uint64)
+		}
+		m.errorTypes[errType]++
+		m.errMu.Unlock()
+	}
+}
+
+func (m *stageMetrics) reset() {
+	m.calls.Store(0)
+	m.errors.Store(0)
+	m.bytes.Store(0)
+	m.totalNanos.Store(0)
+	m.maxNanos.Store(0)
+	for i := range m.latency {
+		m.latency[i].Store(0)
+	}
+	m.errMu.Lock()
+	m.errorTypes = nil
+	m.errMu.Unlock()
+}
+
+// percentile returns the upper bound of the bucket holding the p-th
+// percentile call, capped at the slowest call seen.
+func (m *stageMetrics) percentile(p float64, calls uint64) time.Duration {
+	if calls == 0 {
+		return 0
+	}
+	max := time.Duration(m.maxNanos.Load())
+	target := uint64(float64(calls)*p + 0.5)
+	if target == 0 {
+		target = 1
+	}
+	var seen uint64
+	for i := range m.latency {
+		seen += m.latency[i].Load()
+		if seen >= target {
+			if bound := time.Duration(uint64(1)<<i) * time.Microsecond; bound < max {
+				return bound
+			}
+			break
+		}
+	}
+	return max
+}
+
+type schemaMetrics struct {
+	name        string
+	fingerprint string
+	stages      [len(stages)]stageMetrics
+}
+
+// Metrics aggregates goavro call statistics per schema and stage.
+type Metrics struct {
+	schemas sync.Map // fingerprint → *schemaMetrics
+}
+
+// StageStats summarizes the calls of one stage for one schema.
+type StageStats struct {
+	Schema      string            `json:"schema"`
+	Fingerprint string            `json:"fingerprint"`
+	Stage       Stage             `json:"stage"`
+	Calls       uint64            `json:"calls"`
+	Errors      uint64            `json:"errors"`
+	ErrorTypes  map[string]uint64 `json:"error_types,omitempty"`
+	AvgBytes    float64           `json:"avg_bytes"`
+	AvgUs       float64           `json:"avg_us"`
+	P50Us       float64           `json:"p50_us"`
+	P99Us       float64           `json:"p99_us"`
+	MaxUs       float64           `json:"max_us"`
+}
+
+// DefaultMetrics collects the statistics of every Codec.
+var DefaultMetrics = &Metrics{}
+
+func (m *Metrics) forSchema(name, fingerprint string) *schemaMetrics {
+	if sm, ok := m.schemas.Load(fingerprint); ok {
+		return sm.(*schemaMetrics)
+	}
+	sm, _ := m.schemas.LoadOrStore(fingerprint, &schemaMetrics{name: name, fingerprint: fingerprint})
+	return sm.(*schemaMetrics)
+}
+
+// Snapshot returns the statistics of every stage that has been called,
+// ordered by schema and stage.
+func (m *Metrics) Snapshot() []StageStats {
+	var out []StageStats
+	m.schemas.Range(func(_, v interface{}) bool {
+		sm := v.(*schemaMetrics)
+		for i := range sm.stages {
+			st := &sm.stages[i]
+			calls := st.calls.Load()
+			if calls == 0 {
+				continue
+			}
+			stats := StageStats{
+				Schema:      sm.name,
+				Fingerprint: sm.fingerprint,
+				Stage:       stages[i],
+				Calls:       calls,
+				Errors:      st.errors.Load(),
+				AvgBytes:    float64(st.bytes.Load()) / float64(calls),
+				AvgUs:       float64(st.totalNanos.Load()) / float64(calls) / 1e3,
+				P50Us:       float64(st.percentile(0.50, calls)) / 1e3,
+				P99Us:       float64(st.percentile(0.99, calls)) / 1e3,
+				MaxUs:       float64(st.maxNanos.Load()) / 1e3,
+			}
+			st.errMu.Lock()
+			if len(st.errorTypes) > 0 {
+				stats.ErrorTypes = make(map[string]uint64, len(st.errorTypes))
+				for k, n := range st.errorTypes {
+					stats.ErrorTypes[k] = n
+				}
+			}
+			st.errMu.Unlock()
+			out = append(out, stats)
+		}
+		return true
+	})
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Schema != out[j].Schema {
+			return out[i].Schema < out[j].Schema
+		}
+		if out[i].Fingerprint != out[j].Fingerprint {
+			return out[i].Fingerprint < out[j].Fingerprint
+		}
+		return out[i].Stage < out[j].Stage
+	})
+	return out
+}
+
+// Reset zeroes all collected statistics. Codecs keep reporting into the
+// same entries.
+func (m *Metrics) Reset() {
+	m.schemas.Range(func(_, v interface{}) bool {
+		sm := v.(*schemaMetrics)
+		for i := range sm.stages {
+			sm.stages[i].reset()
+		}
+		return true
+	})
+}
+
+// instrument records a goavro call in the codec's metrics and hands it to
+// the tracer, if any.
+func (c *Codec) instrument(stage int, start time.Time, size int, err error) {
+	d := time.Since(start)
+	errType := ""
+	if err != nil {
+		errType = classifyError(err)
+	}
+	c.metrics.stages[stage].observe(d, size, errType)
+
+	if fn := tracer.Load(); fn != nil {
+		(*fn)(Span{
+			Schema:      c.metrics.name,
+			Fingerprint: c.metrics.fingerprint,
+			Stage:       stages[stage],
+			Start:       start,
+			Duration:    d,
+			Bytes:       size,
+			Err:         err,
+			ErrorType:   errType,
+		})
+	}
+}
+
+// classifyError maps goavro's free-form error messages to a small set of
+// categories suitable as metric labels.
+func classifyError(err error) string {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "short buffer"):
+		return "short_buffer"
+	case strings.Contains(msg, "trailing bytes"):
+		return "trailing_bytes"
+	case strings.Contains(msg, "no value provided"), strings.Contains(msg, "only found"):
+		return "missing_field"
+	case strings.Contains(msg, "union"):
+		return "union"
+	case strings.Contains(msg, "unexpected byte"), strings.Contains(msg, "cannot decode textual"):
+		return "syntax"
+	case strings.Contains(msg, "received:"), strings.Contains(msg, "expected"):
+		return "type_mismatch"
+	default:
+		return "other"
+	}
+}
+
+// schemaIdentity returns a readable schema name and its Rabin fingerprint.
+func schemaIdentity(rabin uint64, canonical string) (string, string) {
+	var named struct {
+		Name string `json:"name"`
+		Type string `json:"type"`
+	}
+	name := canonical
+	if json.Unmarshal([]byte(canonical), &named) == nil {
+		name = named.Name
+		if name == "" {
+			name = named.Type
+		}
+	}
+	return name, FormatFingerprint(rabin)
+}
@@ -0,0 +1,111 @@
+package avrojson
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestCodecRecordsStageMetrics(t *testing.T) {
+	metrics := &Metrics{}
+	codec, err := newCodec(`{"type":"record","name":"InstrumentedRecord","fields":[{"name":"id","type":"long"}]}`, metrics)
+	if err != nil {
+		t.Fatalf("Failed to create codec: %v", err)
+	}
+
+	var mu sync.Mutex
+	var spans []Span
+	SetTracer(func(s Span) {
+		mu.Lock()
+		spans = append(spans, s)
+		mu.Unlock()
+	})
+	defer SetTracer(nil)
+
+	binary, err := codec.Encode(map[string]interface{}{"id": 42})
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	if _, err := codec.BinaryToJSON(binary); err != nil {
+		t.Fatalf("Failed to convert to JSON: %v", err)
+	}
+	if _, err := codec.BinaryToJSON(nil); err == nil {
+		t.Fatal("expected decoding an empty buffer to fail")
+	}
+	if _, err := codec.Encode(map[string]interface{}{}); err == nil {
+		t.Fatal("expected encoding without the required field to fail")
+	}
+
+	got := make(map[Stage]StageStats)
+	for _, s := range metrics.Snapshot() {
+		got[s.Stage] = s
+	}
+
+	encode := got[StageBinaryFromNative]
+	if encode.Calls != 2 || encode.Errors != 1 || encode.ErrorTypes["missing_field"] != 1 {
+		t.Errorf("unexpected binary_from_native stats: %+v", encode)
+	}
+	if encode.AvgBytes != float64(len(binary))/2 {
+		t.Errorf("expected average output size %v, got %v", float64(len(binary))/2, encode.AvgBytes)
+	}
+	decode := got[StageNativeFromBinary]
+	if decode.Calls != 2 || decode.ErrorTypes["short_buffer"] != 1 {
+		t.Errorf("unexpected native_from_binary stats: %+v", decode)
+	}
+	if got[StageTextualFromNative].Calls != 1 {
+		t.Errorf("expected one textual_from_native call, got %+v", got[StageTextualFromNative])
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(spans) != 5 {
+		t.Fatalf("expected 5 spans, got %d", len(spans))
+	}
+	if spans[0].Stage != StageBinaryFromNative || spans[0].Bytes != len(binary) || spans[0].Err != nil {
+		t.Errorf("unexpected first span: %+v", spans[0])
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	codec, err := NewCodec(LogDataSchema)
+	if err != nil {
+		t.Fatalf("Failed to create codec: %v", err)
+	}
+
+	cases := map[string]error{}
+	_, cases["type_mismatch"] = codec.Encode(map[string]interface{}{
+		"timestamp": "not a long", "logtype": "t", "version": "v", "issuer": "i",
+	})
+	// Encode wraps nullable unions itself; the native form must be exact.
+	_, cases["union"] = codec.EncodeNative(map[string]interface{}{
+		"timestamp": 1, "logtype": "t", "version": "v", "issuer": "i", "metadata": map[string]string{"k": "v"},
+	})
+	_, cases["syntax"] = codec.JSONToBinary([]byte(`{"timestamp": tru}`))
+
+	for want, err := range cases {
+		if err == nil {
+			t.Errorf("expected an error for %s", want)
+			continue
+		}
+		if got := classifyError(err); got != want {
+			t.Errorf("expected %s for %q, got %s", want, err, got)
+		}
+	}
+}
+
+func TestMetricsReset(t *testing.T) {
+	metrics := &Metrics{}
+	codec, err := newCodec(WrapperSchema, metrics)
+	if err != nil {
+		t.Fatalf("Failed to create codec: %v", err)
+	}
+	codec.BinaryToJSON(nil)
+	metrics.Reset()
+	if stats := metrics.Snapshot(); len(stats) != 0 {
+		t.Fatalf("expected no stats after reset, got %+v", stats)
+	}
+
+	codec.BinaryToJSON(nil)
+	if stats := metrics.Snapshot(); len(stats) != 1 || stats[0].Calls != 1 {
+		t.Errorf("expected codecs to keep reporting after reset, got %+v", stats)
+	}
+}
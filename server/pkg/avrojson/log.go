@@ -0,0 +1,93 @@
+package avrojson
+
+import "fmt"
+
+// EncodedLog holds both levels of an encoded log together with their Avro
+// JSON forms. LogDataSchema is the schema LogData was written with.
+type EncodedLog struct {
+	Wrapper       []byte
+	LogData       []byte
+	WrapperJSON   []byte
+	LogDataJSON   []byte
+	LogDataSchema string
+}
+
+// EncodeLog encodes data with LogDataSchema, stores its Avro JSON form as
+// the wrapper body and encodes the wrapper with WrapperSchema. Any Body
+// already set on wrapper is replaced.
+func EncodeLog(wrapper LogWrapper, data LogData) (*EncodedLog, error) {
+	logDataCodec, err := DefaultCache.Get(LogDataSchema)
+	if err != nil {
+		return nil, fmt.Errorf("compile log data schema: %w", err)
+	}
+	logData, err := logDataCodec.Encode(data)
+	if err != nil {
+		return nil, fmt.Errorf("encode log data: %w", err)
+	}
+	return EncodeLogBinary(wrapper, LogDataSchema, logData)
+}
+
+// EncodeLogBinary wraps log data already encoded with dataSchema, which may
+// be any version of LogDataSchema, the way EncodeLog does.
+func EncodeLogBinary(wrapper LogWrapper, dataSchema string, logData []byte) (*EncodedLog, error) {
+	wrapperCodec, err := DefaultCache.Get(WrapperSchema)
+	if err != nil {
+		return nil, fmt.Errorf("compile wrapper schema: %w", err)
+	}
+	logDataCodec, err := DefaultCache.Get(dataSchema)
+	if err != nil {
+		return nil, fmt.Errorf("compile log data schema: %w", err)
+	}
+
+	out := &EncodedLog{LogData: logData, LogDataSchema: dataSchema}
+	if out.LogDataJSON, err = logDataCodec.BinaryToJSON(out.LogData); err != nil {
+		return nil, fmt.Errorf("convert log data to JSON: %w", err)
+	}
+
+	wrapper.Body = string(out.LogDataJSON)
+	if out.Wrapper, err = wrapperCodec.Encode(wrapper); err != nil {
+		return nil, fmt.Errorf("encode wrapper: %w", err)
+	}
+	if out.WrapperJSON, err = wrapperCodec.BinaryToJSON(out.Wrapper); err != nil {
+		return nil, fmt.Errorf("convert wrapper to JSON: %w", err)
+	}
+	return out, nil
+}
+
+// DecodeLog reverses EncodeLog, decoding the wrapper binary and the log data
+// carried in its body.
+func DecodeLog(wrapperBinary []byte) (LogWrapper, LogData, error) {
+	var wrapper LogWrapper
+	var data LogData
+
+	wrapperCodec, err := DefaultCache.Get(WrapperSchema)
+	if err != nil {
+		return wrapper, data, fmt.Errorf("compile wrapper schema: %w", err)
+	}
+	logDataCodec, err := DefaultCache.Get(LogDataSchema)
+	if err != nil {
+		return wrapper, data, fmt.Errorf("compile log data schema: %w", err)
+	}
+
+	if err := wrapperCodec.Decode(wrapperBinary, &wrapper); err != nil {
+		return wrapper, data, fmt.Errorf("decode wrapper: %w", err)
+	}
+	if err := logDataCodec.DecodeJSON([]byte(wrapper.Body), &data); err != nil {
+		return wrapper, data, fmt.Errorf("decode log data: %w", err)
+	}
+	return wrapper, data, nil
+}
+
+// SingleObjects returns the wrapper and log data in single-object
+// encoding, each prefixed with the fingerprint of its own schema.
+func (e *EncodedLog) SingleObjects() (wrapper, logData []byte, err error) {
+	wrapperCodec, err := DefaultCache.Get(WrapperSchema)
+	if err != nil {
+		return nil, nil, fmt.Errorf("compile wrapper schema: %w", err)
+	}
+	logDataCodec, err := DefaultCache.Get(e.LogDataSchema)
+	if err != nil {
+		return nil, nil, fmt.Errorf("compile log data schema: %w", err)
+	}
+	return wrapperCodec.SingleFromBinary(e.Wrapper), logDataCodec.SingleFromBinary(e.LogData), nil
+}
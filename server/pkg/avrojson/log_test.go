@@ -0,0 +1,136 @@
+package avrojson
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncodeDecodeLogRoundTrip(t *testing.T) {
+	wrapper := LogWrapper{
+		ProjectName:    "game-server",
+		ProjectVersion: "1.2.3",
+		LogLevel:       "info",
+		LogType:        "user_action",
+		LogSource:      "game_client",
+	}
+	data := LogData{
+		Timestamp: time.UnixMilli(1700000000000).UTC(),
+		Logtype:   "user_action",
+		Version:   "1.0",
+		Issuer:    "test_system",
+		Metadata: StringMap(map[string]interface{}{
+			"cpu":   42.5,
+			"host":  "node-1",
+			"empty": nil,
+		}),
+	}
+
+	encoded, err := EncodeLog(wrapper, data)
+	if err != nil {
+		t.Fatalf("Failed to encode log: %v", err)
+	}
+	if !strings.Contains(string(encoded.LogDataJSON), `"map"`) {
+		t.Errorf("expected Avro JSON union encoding, got %s", encoded.LogDataJSON)
+	}
+	// timestamp-millis keeps the wire and JSON forms of a plain long.
+	if !strings.Contains(string(encoded.LogDataJSON), `"timestamp":1700000000000`) {
+		t.Errorf("expected the timestamp as Unix milliseconds, got %s", encoded.LogDataJSON)
+	}
+
+	gotWrapper, gotData, err := DecodeLog(encoded.Wrapper)
+	if err != nil {
+		t.Fatalf("Failed to decode log: %v", err)
+	}
+
+	wrapper.Body = string(encoded.LogDataJSON)
+	if gotWrapper != wrapper {
+		t.Errorf("wrapper mismatch:\n got %+v\nwant %+v", gotWrapper, wrapper)
+	}
+	if !reflect.DeepEqual(gotData, data) {
+		t.Errorf("log data mismatch:\n got %#v\nwant %#v", gotData, data)
+	}
+}
+
+func TestEncodeLogBinaryKeepsBodySchema(t *testing.T) {
+	v2 := strings.Replace(LogDataSchema, `"fields": [`, `"fields": [{"name": "region", "type": "string", "default": "unknown"},`, 1)
+	if v2 == LogDataSchema {
+		t.Fatal("Failed to derive a second LogData version")
+	}
+	codec, err := NewCodec(v2)
+	if err != nil {
+		t.Fatalf("Failed to create codec: %v", err)
+	}
+	logData, err := codec.JSONToBinary([]byte(`{"region":"eu","timestamp":1,"logtype":"t","version":"1","issuer":"i","metadata":null,"domainData":null}`))
+	if err != nil {
+		t.Fatalf("Failed to encode log data: %v", err)
+	}
+
+	encoded, err := EncodeLogBinary(LogWrapper{ProjectName: "p"}, v2, logData)
+	if err != nil {
+		t.Fatalf("Failed to encode log: %v", err)
+	}
+	if encoded.LogDataSchema != v2 || !strings.Contains(string(encoded.WrapperJSON), `region`) {
+		t.Errorf("expected the wrapper body in the given schema, got %s", encoded.WrapperJSON)
+	}
+	if _, err := EncodeLogBinary(LogWrapper{}, v2, logData[:3]); err == nil {
+		t.Error("expected truncated log data to be rejected")
+	}
+}
+
+func TestCodecJSONConversions(t *testing.T) {
+	codec, err := NewCodec(LogDataSchema)
+	if err != nil {
+		t.Fatalf("Failed to create codec: %v", err)
+	}
+
+	text := []byte(`{"timestamp":1,"logtype":"t","version":"1","issuer":"i","metadata":null,"domainData":{"map":{"k":"v"}}}`)
+	binary, err := codec.JSONToBinary(text)
+	if err != nil {
+		t.Fatalf("Failed to convert JSON to binary: %v", err)
+	}
+
+	var data LogData
+	if err := codec.Decode(binary, &data); err != nil {
+		t.Fatalf("Failed to decode binary: %v", err)
+	}
+	if data.Metadata != nil {
+		t.Errorf("expected null metadata, got %#v", data.Metadata)
+	}
+	if !reflect.DeepEqual(data.DomainData, map[string]string{"k": "v"}) {
+		t.Errorf("unexpected domainData %#v", data.DomainData)
+	}
+
+	back, err := codec.BinaryToJSON(binary)
+	if err != nil {
+		t.Fatalf("Failed to convert binary to JSON: %v", err)
+	}
+	// goavro does not preserve field order in textual output.
+	var gotFields, wantFields map[string]interface{}
+	if err := json.Unmarshal(back, &gotFields); err != nil {
+		t.Fatalf("Failed to parse converted JSON %s: %v", back, err)
+	}
+	if err := json.Unmarshal(text, &wantFields); err != nil {
+		t.Fatalf("Failed to parse input JSON: %v", err)
+	}
+	if !reflect.DeepEqual(gotFields, wantFields) {
+		t.Errorf("JSON round trip mismatch:\n got %s\nwant %s", back, text)
+	}
+}
+
+func TestPackageLevelEncodeDecode(t *testing.T) {
+	in := LogWrapper{ProjectName: "p", ProjectVersion: "v", Body: "{}", LogLevel: "l", LogType: "t", LogSource: "s"}
+	data, err := Encode(WrapperSchema, in)
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	var out LogWrapper
+	if err := Decode(WrapperSchema, data, &out); err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if out != in {
+		t.Errorf("round trip mismatch: got %+v, want %+v", out, in)
+	}
+}
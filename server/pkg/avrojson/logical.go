@@ -0,0 +1,97 @@
+package avrojson
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// checkLogical validates the decimals and UUIDs in a native value of the
+// codec's schema before goavro encodes it; goavro would truncate decimals
+// and store any string as a uuid.
+func (c *Codec) checkLogical(native interface{}) error {
+	s, err := c.schemaTree()
+	if err != nil || !s.checked {
+		return nil
+	}
+	if err := s.checkLogical(s.root, native, ""); err != nil {
+		return fmt.Errorf("avrojson: %w", err)
+	}
+	return nil
+}
+
+func (s *parsedSchema) checkLogical(node, v interface{}, path string) error {
+	at := func(err error) error {
+		if err == nil || path == "" {
+			return err
+		}
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	switch n := node.(type) {
+	case string:
+		if def, ok := s.named[n]; ok {
+			return s.checkLogical(def, v, path)
+		}
+	case []interface{}:
+		wrapped, ok := v.(map[string]interface{})
+		if !ok || len(wrapped) != 1 {
+			return nil
+		}
+		for typeName, inner := range wrapped {
+			for _, branch := range n {
+				if branchName(branch) == typeName {
+					return s.checkLogical(branch, inner, path)
+				}
+			}
+		}
+	case map[string]interface{}:
+		switch n["logicalType"] {
+		case "decimal":
+			r, ok := v.(*big.Rat)
+			if !ok {
+				return nil
+			}
+			precision, _ := n["precision"].(float64)
+			scale, _ := n["scale"].(float64)
+			return at(checkDecimal(r, int(precision), int(scale)))
+		case "uuid":
+			if str, ok := v.(string); ok && n["type"] == "string" {
+				if _, err := ParseUUID(str); err != nil {
+					return at(fmt.Errorf("invalid UUID %q", str))
+				}
+			}
+			return nil
+		}
+		switch n["type"] {
+		case "record", "error":
+			rec, ok := v.(map[string]interface{})
+			if !ok {
+				return nil
+			}
+			fields, _ := n["fields"].([]interface{})
+			for _, f := range fields {
+				field, _ := f.(map[string]interface{})
+				name, _ := field["name"].(string)
+				if val, ok := rec[name]; ok {
+					if err := s.checkLogical(field["type"], val, joinPath(path, name)); err != nil {
+						return err
+					}
+				}
+			}
+		case "array":
+			items, _ := v.([]interface{})
+			for i, item := range items {
+				if err := s.checkLogical(n["items"], item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		case "map":
+			values, _ := v.(map[string]interface{})
+			for k, val := range values {
+				if err := s.checkLogical(n["values"], val, fmt.Sprintf("%s[%q]", path, k)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,7 @@
+// Package logschema holds typed Go structs for the built-in log schemas,
+// generated by cmd/avrogen from ../schemas. Unlike avrojson.LogData, whose
+// nullable maps are interface{} values converted through encoding/json,
+// these types encode straight to goavro's native form.
+package logschema
+
+//go:generate go run ../../../cmd/avrogen -pkg logschema -out logschema_gen.go ../schemas/LogWrapper.avsc ../schemas/LogData.avsc
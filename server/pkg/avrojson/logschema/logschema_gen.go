@@ -0,0 +1,238 @@
+// Code generated by avrogen. DO NOT EDIT.
+
+package logschema
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+)
+
+// LogWrapper is generated from the Avro record LogWrapper.
+type LogWrapper struct {
+	ProjectName    string `avro:"projectName" json:"projectName"`
+	ProjectVersion string `avro:"projectVersion" json:"projectVersion"`
+	Body           string `avro:"body" json:"body"`
+	LogLevel       string `avro:"logLevel" json:"logLevel"`
+	LogType        string `avro:"logType" json:"logType"`
+	LogSource      string `avro:"logSource" json:"logSource"`
+}
+
+// LogWrapperSchema is the Avro schema LogWrapper was generated from.
+const LogWrapperSchema = `{"type":"record","name":"LogWrapper","fields":[{"name":"projectName","type":"string"},{"name":"projectVersion","type":"string"},{"name":"body","type":"string"},{"name":"logLevel","type":"string"},{"name":"logType","type":"string"},{"name":"logSource","type":"string"}]}`
+
+// MarshalAvro encodes r as Avro binary with LogWrapperSchema.
+func (r *LogWrapper) MarshalAvro() ([]byte, error) {
+	codec, err := avrojson.DefaultCache.Get(LogWrapperSchema)
+	if err != nil {
+		return nil, err
+	}
+	return codec.EncodeNative(r.AvroNative())
+}
+
+// UnmarshalAvro decodes Avro binary written with LogWrapperSchema into r.
+func (r *LogWrapper) UnmarshalAvro(data []byte) error {
+	codec, err := avrojson.DefaultCache.Get(LogWrapperSchema)
+	if err != nil {
+		return err
+	}
+	native, err := codec.DecodeNative(data)
+	if err != nil {
+		return err
+	}
+	m, ok := native.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("LogWrapper: expected a record, got %T", native)
+	}
+	return r.FromAvroNative(m)
+}
+
+// AvroNative returns r in goavro's native form.
+func (r LogWrapper) AvroNative() map[string]interface{} {
+	return map[string]interface{}{
+		"projectName":    r.ProjectName,
+		"projectVersion": r.ProjectVersion,
+		"body":           r.Body,
+		"logLevel":       r.LogLevel,
+		"logType":        r.LogType,
+		"logSource":      r.LogSource,
+	}
+}
+
+// FromAvroNative fills r from goavro's native form of the record.
+func (r *LogWrapper) FromAvroNative(m map[string]interface{}) error {
+	if v0, ok := m["projectName"].(string); ok {
+		r.ProjectName = v0
+	} else {
+		return fmt.Errorf("LogWrapper.projectName: expected string, got %T", m["projectName"])
+	}
+	if v0, ok := m["projectVersion"].(string); ok {
+		r.ProjectVersion = v0
+	} else {
+		return fmt.Errorf("LogWrapper.projectVersion: expected string, got %T", m["projectVersion"])
+	}
+	if v0, ok := m["body"].(string); ok {
+		r.Body = v0
+	} else {
+		return fmt.Errorf("LogWrapper.body: expected string, got %T", m["body"])
+	}
+	if v0, ok := m["logLevel"].(string); ok {
+		r.LogLevel = v0
+	} else {
+		return fmt.Errorf("LogWrapper.logLevel: expected string, got %T", m["logLevel"])
+	}
+	if v0, ok := m["logType"].(string); ok {
+		r.LogType = v0
+	} else {
+		return fmt.Errorf("LogWrapper.logType: expected string, got %T", m["logType"])
+	}
+	if v0, ok := m["logSource"].(string); ok {
+		r.LogSource = v0
+	} else {
+		return fmt.Errorf("LogWrapper.logSource: expected string, got %T", m["logSource"])
+	}
+	return nil
+}
+
+// LogData is generated from the Avro record LogData.
+type LogData struct {
+	Timestamp  time.Time         `avro:"timestamp" json:"timestamp"`
+	Logtype    string            `avro:"logtype" json:"logtype"`
+	Version    string            `avro:"version" json:"version"`
+	Issuer     string            `avro:"issuer" json:"issuer"`
+	Metadata   map[string]string `avro:"metadata" json:"metadata"`
+	DomainData map[string]string `avro:"domainData" json:"domainData"`
+}
+
+// LogDataSchema is the Avro schema LogData was generated from.
+const LogDataSchema = `{"type":"record","name":"LogData","fields":[{"name":"timestamp","type":{"type":"long","logicalType":"timestamp-millis"}},{"name":"logtype","type":"string"},{"name":"version","type":"string"},{"name":"issuer","type":"string"},{"name":"metadata","type":["null",{"type":"map","values":"string"}],"default":null},{"name":"domainData","type":["null",{"type":"map","values":"string"}],"default":null}]}`
+
+// MarshalAvro encodes r as Avro binary with LogDataSchema.
+func (r *LogData) MarshalAvro() ([]byte, error) {
+	codec, err := avrojson.DefaultCache.Get(LogDataSchema)
+	if err != nil {
+		return nil, err
+	}
+	return codec.EncodeNative(r.AvroNative())
+}
+
+// UnmarshalAvro decodes Avro binary written with LogDataSchema into r.
+func (r *LogData) UnmarshalAvro(data []byte) error {
+	codec, err := avrojson.DefaultCache.Get(LogDataSchema)
+	if err != nil {
+		return err
+	}
+	native, err := codec.DecodeNative(data)
+	if err != nil {
+		return err
+	}
+	m, ok := native.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("LogData: expected a record, got %T", native)
+	}
+	return r.FromAvroNative(m)
+}
+
+// AvroNative returns r in goavro's native form.
+func (r LogData) AvroNative() map[string]interface{} {
+	return map[string]interface{}{
+		"timestamp": r.Timestamp,
+		"logtype":   r.Logtype,
+		"version":   r.Version,
+		"issuer":    r.Issuer,
+		"metadata": func() interface{} {
+			if r.Metadata == nil {
+				return nil
+			}
+			return map[string]interface{}{"map": func() map[string]interface{} {
+				out := make(map[string]interface{}, len(r.Metadata))
+				for k1, x1 := range r.Metadata {
+					out[k1] = x1
+				}
+				return out
+			}()}
+		}(),
+		"domainData": func() interface{} {
+			if r.DomainData == nil {
+				return nil
+			}
+			return map[string]interface{}{"map": func() map[string]interface{} {
+				out := make(map[string]interface{}, len(r.DomainData))
+				for k1, x1 := range r.DomainData {
+					out[k1] = x1
+				}
+				return out
+			}()}
+		}(),
+	}
+}
+
+// FromAvroNative fills r from goavro's native form of the record.
+func (r *LogData) FromAvroNative(m map[string]interface{}) error {
+	if v0, ok := m["timestamp"].(time.Time); ok {
+		r.Timestamp = v0
+	} else {
+		return fmt.Errorf("LogData.timestamp: expected time.Time, got %T", m["timestamp"])
+	}
+	if v0, ok := m["logtype"].(string); ok {
+		r.Logtype = v0
+	} else {
+		return fmt.Errorf("LogData.logtype: expected string, got %T", m["logtype"])
+	}
+	if v0, ok := m["version"].(string); ok {
+		r.Version = v0
+	} else {
+		return fmt.Errorf("LogData.version: expected string, got %T", m["version"])
+	}
+	if v0, ok := m["issuer"].(string); ok {
+		r.Issuer = v0
+	} else {
+		return fmt.Errorf("LogData.issuer: expected string, got %T", m["issuer"])
+	}
+	if m["metadata"] == nil {
+		r.Metadata = nil
+	} else if u0, ok := m["metadata"].(map[string]interface{}); ok && len(u0) == 1 {
+		var e0 map[string]string
+		if v1, ok := u0["map"].(map[string]interface{}); ok {
+			e0 = make(map[string]string, len(v1))
+			for k1, x1 := range v1 {
+				var e1 string
+				if v2, ok := x1.(string); ok {
+					e1 = v2
+				} else {
+					return fmt.Errorf("LogData.metadata{}: expected string, got %T", x1)
+				}
+				e0[k1] = e1
+			}
+		} else {
+			return fmt.Errorf("LogData.metadata: expected map, got %T", u0["map"])
+		}
+		r.Metadata = e0
+	} else {
+		return fmt.Errorf("LogData.metadata: expected union, got %T", m["metadata"])
+	}
+	if m["domainData"] == nil {
+		r.DomainData = nil
+	} else if u0, ok := m["domainData"].(map[string]interface{}); ok && len(u0) == 1 {
+		var e0 map[string]string
+		if v1, ok := u0["map"].(map[string]interface{}); ok {
+			e0 = make(map[string]string, len(v1))
+			for k1, x1 := range v1 {
+				var e1 string
+				if v2, ok := x1.(string); ok {
+					e1 = v2
+				} else {
+					return fmt.Errorf("LogData.domainData{}: expected string, got %T", x1)
+				}
+				e0[k1] = e1
+			}
+		} else {
+			return fmt.Errorf("LogData.domainData: expected map, got %T", u0["map"])
+		}
+		r.DomainData = e0
+	} else {
+		return fmt.Errorf("LogData.domainData: expected union, got %T", m["domainData"])
+	}
+	return nil
+}
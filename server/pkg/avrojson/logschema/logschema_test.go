@@ -0,0 +1,109 @@
+package logschema
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+)
+
+func TestGeneratedSchemasMatchBuiltins(t *testing.T) {
+	for name, schema := range map[string]string{
+		LogWrapperSchema: avrojson.WrapperSchema,
+		LogDataSchema:    avrojson.LogDataSchema,
+	} {
+		a, err := avrojson.NewCodec(name)
+		if err != nil {
+			t.Fatalf("Failed to compile generated schema: %v", err)
+		}
+		b, err := avrojson.NewCodec(schema)
+		if err != nil {
+			t.Fatalf("Failed to compile builtin schema: %v", err)
+		}
+		if a.Goavro().CanonicalSchema() != b.Goavro().CanonicalSchema() {
+			t.Errorf("generated schema drifted from %s; run go generate", b.Schema())
+		}
+	}
+}
+
+func TestTypedEncodingMatchesAvrojson(t *testing.T) {
+	typed := LogData{
+		Timestamp: time.UnixMilli(1700000000000).UTC(),
+		Logtype:   "user_action",
+		Version:   "1.0",
+		Issuer:    "client",
+		Metadata:  map[string]string{"level": "12"},
+	}
+	binary, err := typed.MarshalAvro()
+	if err != nil {
+		t.Fatalf("Failed to encode typed log data: %v", err)
+	}
+	want, err := avrojson.Encode(avrojson.LogDataSchema, avrojson.LogData{
+		Timestamp: typed.Timestamp,
+		Logtype:   typed.Logtype,
+		Version:   typed.Version,
+		Issuer:    typed.Issuer,
+		Metadata:  typed.Metadata,
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode log data: %v", err)
+	}
+	if !bytes.Equal(binary, want) {
+		t.Errorf("typed encoding differs:\n got %x\nwant %x", binary, want)
+	}
+
+	var back LogData
+	if err := back.UnmarshalAvro(binary); err != nil {
+		t.Fatalf("Failed to decode typed log data: %v", err)
+	}
+	if !reflect.DeepEqual(back, typed) {
+		t.Errorf("round trip mismatch:\n got %#v\nwant %#v", back, typed)
+	}
+
+	wrapper := LogWrapper{ProjectName: "game", ProjectVersion: "1", Body: "{}", LogLevel: "info", LogType: "t", LogSource: "s"}
+	wrapperBinary, err := wrapper.MarshalAvro()
+	if err != nil {
+		t.Fatalf("Failed to encode typed wrapper: %v", err)
+	}
+	codec, err := avrojson.NewCodec(avrojson.WrapperSchema)
+	if err != nil {
+		t.Fatalf("Failed to create codec: %v", err)
+	}
+	var gotWrapper avrojson.LogWrapper
+	if err := codec.Decode(wrapperBinary, &gotWrapper); err != nil {
+		t.Fatalf("Failed to decode typed wrapper: %v", err)
+	}
+	if gotWrapper != (avrojson.LogWrapper)(wrapper) {
+		t.Errorf("wrapper mismatch:\n got %+v\nwant %+v", gotWrapper, wrapper)
+	}
+}
+
+func TestFromAvroNativeRejectsWrongTypes(t *testing.T) {
+	var data LogData
+	err := data.FromAvroNative(map[string]interface{}{"timestamp": "soon"})
+	if err == nil {
+		t.Fatal("Expected an error for a string timestamp")
+	}
+}
+
+func BenchmarkTypedEncode(b *testing.B) {
+	data := LogData{Timestamp: time.UnixMilli(1).UTC(), Logtype: "t", Version: "1", Issuer: "i", Metadata: map[string]string{"k": "v"}}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := data.MarshalAvro(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkToNativeEncode(b *testing.B) {
+	data := avrojson.LogData{Timestamp: time.UnixMilli(1).UTC(), Logtype: "t", Version: "1", Issuer: "i", Metadata: map[string]string{"k": "v"}}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := avrojson.Encode(avrojson.LogDataSchema, data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
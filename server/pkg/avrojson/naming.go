@@ -0,0 +1,226 @@
+package avrojson
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Naming is the convention Go values use for record field names, relative
+// to the field names of the schema. Encode, Decode and DecodeJSON convert
+// between the two, so a struct with snake_case json tags can be used with
+// a camelCase schema such as WrapperSchema. EncodeNative, DecodeNative and
+// the JSON conversions work on goavro's native form and always use the
+// schema's names.
+type Naming string
+
+const (
+	// NamingExact uses the schema's field names unchanged.
+	NamingExact Naming = ""
+	// NamingSnakeCase maps projectName to project_name.
+	NamingSnakeCase Naming = "snake_case"
+	// NamingCamelCase maps project_name to projectName.
+	NamingCamelCase Naming = "camelCase"
+)
+
+// ParseNaming parses a naming name; "" and "exact" select NamingExact.
+func ParseNaming(s string) (Naming, error) {
+	switch s {
+	case "", "exact":
+		return NamingExact, nil
+	case string(NamingSnakeCase), "snake":
+		return NamingSnakeCase, nil
+	case string(NamingCamelCase), "camel":
+		return NamingCamelCase, nil
+	}
+	return "", fmt.Errorf("avrojson: unknown naming %q", s)
+}
+
+// Apply returns the Go-side name of the schema field name.
+func (n Naming) Apply(name string) string {
+	switch n {
+	case NamingSnakeCase:
+		return snakeCase(name)
+	case NamingCamelCase:
+		return camelCase(name)
+	}
+	return name
+}
+
+// snakeCase splits name before each upper-case letter that starts a word,
+// keeping acronyms together: userID becomes user_id and HTTPCode
+// http_code.
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 && runes[i-1] != '_' {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// camelCase joins the words of name, upper-casing the first letter of each
+// word after the first. Leading underscores are kept.
+func camelCase(name string) string {
+	trimmed := strings.TrimLeft(name, "_")
+	var b strings.Builder
+	b.WriteString(name[:len(name)-len(trimmed)])
+	for i, word := range strings.Split(trimmed, "_") {
+		if word == "" {
+			continue
+		}
+		if i > 0 {
+			runes := []rune(word)
+			runes[0] = unicode.ToUpper(runes[0])
+			word = string(runes)
+		}
+		b.WriteString(word)
+	}
+	return b.String()
+}
+
+// SetNaming sets the naming used when converting Go values for the codec's
+// schema. Codecs are shared by schema text, so with DefaultCache every
+// caller of that schema sees the change; use Cache.SetNaming to configure
+// one schema ahead of use.
+func (c *Codec) SetNaming(n Naming) {
+	c.naming.Store(string(n))
+}
+
+// Naming returns the codec's naming, NamingExact unless SetNaming was
+// called.
+func (c *Codec) Naming() Naming {
+	n, _ := c.naming.Load().(string)
+	return Naming(n)
+}
+
+// SetNaming compiles schema if needed and sets the naming of its codec.
+func (c *Cache) SetNaming(schema string, n Naming) error {
+	codec, err := c.Get(schema)
+	if err != nil {
+		return err
+	}
+	codec.SetNaming(n)
+	return nil
+}
+
+// toSchemaNames renames the record fields of a native value built from a
+// Go value to the schema's names. A field already present under its schema
+// name is left alone, so exact names keep working under any naming.
+func (c *Codec) toSchemaNames(native interface{}) (interface{}, error) {
+	n := c.Naming()
+	if n == NamingExact {
+		return native, nil
+	}
+	s, err := c.schemaTree()
+	if err != nil {
+		return nil, err
+	}
+	return s.rename(s.root, native, n, true), nil
+}
+
+// fromSchemaNames renames the record fields of a decoded native value to
+// the codec's naming.
+func (c *Codec) fromSchemaNames(native interface{}) (interface{}, error) {
+	n := c.Naming()
+	if n == NamingExact {
+		return native, nil
+	}
+	s, err := c.schemaTree()
+	if err != nil {
+		return nil, err
+	}
+	return s.rename(s.root, native, n, false), nil
+}
+
+// rename walks v along node like strip, renaming record fields between
+// schema names and n. toSchema selects the direction. Union wrappers are
+// kept.
+func (s *parsedSchema) rename(node, v interface{}, n Naming, toSchema bool) interface{} {
+	switch nd := node.(type) {
+	case string:
+		if def, ok := s.named[nd]; ok && !primitiveTypes[nd] {
+			return s.rename(def, v, n, toSchema)
+		}
+		return v
+	case []interface{}:
+		wrapped, ok := v.(map[string]interface{})
+		if !ok || len(wrapped) != 1 {
+			return v
+		}
+		for typeName, inner := range wrapped {
+			for _, branch := range nd {
+				if branchName(branch) == typeName {
+					return map[string]interface{}{typeName: s.rename(branch, inner, n, toSchema)}
+				}
+			}
+		}
+		return v
+	case map[string]interface{}:
+		t, ok := nd["type"].(string)
+		if !ok {
+			return s.rename(nd["type"], v, n, toSchema)
+		}
+		switch t {
+		case "record", "error":
+			rec, ok := v.(map[string]interface{})
+			if !ok {
+				return v
+			}
+			fields, _ := nd["fields"].([]interface{})
+			out := make(map[string]interface{}, len(rec))
+			if toSchema {
+				// goavro ignores keys that are not fields, as it would
+				// without a naming.
+				for k, val := range rec {
+					out[k] = val
+				}
+			}
+			for _, f := range fields {
+				field, _ := f.(map[string]interface{})
+				name, _ := field["name"].(string)
+				mapped := n.Apply(name)
+				if toSchema {
+					val, ok := rec[name]
+					if !ok {
+						val, ok = rec[mapped]
+					}
+					if ok {
+						out[name] = s.rename(field["type"], val, n, true)
+					}
+				} else if val, ok := rec[name]; ok {
+					out[mapped] = s.rename(field["type"], val, n, false)
+				}
+			}
+			return out
+		case "array":
+			items, ok := v.([]interface{})
+			if !ok {
+				return v
+			}
+			out := make([]interface{}, len(items))
+			for i, item := range items {
+				out[i] = s.rename(nd["items"], item, n, toSchema)
+			}
+			return out
+		case "map":
+			values, ok := v.(map[string]interface{})
+			if !ok {
+				return v
+			}
+			out := make(map[string]interface{}, len(values))
+			for k, val := range values {
+				out[k] = s.rename(nd["values"], val, n, toSchema)
+			}
+			return out
+		}
+	}
+	return v
+}
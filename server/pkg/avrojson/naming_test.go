@@ -0,0 +1,125 @@
+package avrojson
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNamingApply(t *testing.T) {
+	cases := []struct {
+		naming     Naming
+		name, want string
+	}{
+		{NamingSnakeCase, "projectName", "project_name"},
+		{NamingSnakeCase, "userID", "user_id"},
+		{NamingSnakeCase, "HTTPCode", "http_code"},
+		{NamingSnakeCase, "level2Name", "level2_name"},
+		{NamingSnakeCase, "log_type", "log_type"},
+		{NamingCamelCase, "project_name", "projectName"},
+		{NamingCamelCase, "_private_field", "_privateField"},
+		{NamingCamelCase, "logType", "logType"},
+		{NamingExact, "projectName", "projectName"},
+	}
+	for _, c := range cases {
+		if got := c.naming.Apply(c.name); got != c.want {
+			t.Errorf("%q.Apply(%q) = %q, want %q", c.naming, c.name, got, c.want)
+		}
+	}
+	if _, err := ParseNaming("kebab"); err == nil {
+		t.Error("Expected an unknown naming to be rejected")
+	}
+}
+
+type snakeWrapper struct {
+	ProjectName    string `json:"project_name"`
+	ProjectVersion string `json:"project_version"`
+	Body           string `json:"body"`
+	LogLevel       string `json:"log_level"`
+	LogType        string `json:"log_type"`
+	LogSource      string `json:"log_source"`
+}
+
+func TestNamingMapsSnakeCaseStructsToCamelCaseSchema(t *testing.T) {
+	cache := NewCache()
+	codec, err := cache.Get(WrapperSchema)
+	if err != nil {
+		t.Fatalf("Failed to compile wrapper schema: %v", err)
+	}
+	in := snakeWrapper{ProjectName: "game", ProjectVersion: "1.0", Body: "{}", LogLevel: "info", LogType: "t", LogSource: "s"}
+	if _, err := codec.Encode(in); err == nil {
+		t.Fatal("Expected snake_case keys to miss the camelCase fields without a naming")
+	}
+
+	if err := cache.SetNaming(WrapperSchema, NamingSnakeCase); err != nil {
+		t.Fatalf("Failed to set naming: %v", err)
+	}
+	data, err := codec.Encode(in)
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	exact, err := NewCodec(WrapperSchema)
+	if err != nil {
+		t.Fatalf("Failed to create codec: %v", err)
+	}
+	var wrapper LogWrapper
+	if err := exact.Decode(data, &wrapper); err != nil {
+		t.Fatalf("Failed to decode with exact names: %v", err)
+	}
+	if wrapper.ProjectName != "game" || wrapper.LogSource != "s" {
+		t.Errorf("unexpected wrapper: %+v", wrapper)
+	}
+
+	var out snakeWrapper
+	if err := codec.Decode(data, &out); err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if out != in {
+		t.Errorf("round trip mismatch: got %+v, want %+v", out, in)
+	}
+
+	// Exact names still encode under a naming.
+	if _, err := codec.Encode(LogWrapper{ProjectName: "game"}); err != nil {
+		t.Errorf("Failed to encode exact names under a naming: %v", err)
+	}
+}
+
+func TestNamingRenamesNestedRecords(t *testing.T) {
+	codec, err := NewCodec(`{"type":"record","name":"Order","namespace":"shop","fields":[
+		{"name":"order_id","type":"string"},
+		{"name":"ship_to","type":["null",{"type":"record","name":"Address","fields":[{"name":"zip_code","type":"string"}]}]},
+		{"name":"line_items","type":{"type":"array","items":{"type":"record","name":"Line","fields":[{"name":"unit_price","type":"long"}]}}}
+	]}`)
+	if err != nil {
+		t.Fatalf("Failed to create codec: %v", err)
+	}
+	codec.SetNaming(NamingCamelCase)
+	in := map[string]interface{}{
+		"orderId":   "o1",
+		"shipTo":    map[string]interface{}{"shop.Address": map[string]interface{}{"zipCode": "123"}},
+		"lineItems": []interface{}{map[string]interface{}{"unitPrice": 5}},
+	}
+	data, err := codec.Encode(in)
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	var out map[string]interface{}
+	if err := codec.Decode(data, &out); err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	want := map[string]interface{}{
+		"orderId":   "o1",
+		"shipTo":    map[string]interface{}{"shop.Address": map[string]interface{}{"zipCode": "123"}},
+		"lineItems": []interface{}{map[string]interface{}{"unitPrice": float64(5)}},
+	}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("got %v, want %v", out, want)
+	}
+
+	native, err := codec.DecodeNative(data)
+	if err != nil {
+		t.Fatalf("Failed to decode native: %v", err)
+	}
+	if _, ok := native.(map[string]interface{})["order_id"]; !ok {
+		t.Errorf("expected native values to keep schema names, got %v", native)
+	}
+}
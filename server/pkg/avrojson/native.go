@@ -0,0 +1,122 @@
+package avrojson
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// StringMap converts any JSON-encodable object to the map[string]string
+// form of the schema's map fields. String values are kept as is, null
+// becomes "" and every other value is stored as its JSON encoding.
+// Numbers keep their JSON text, so large integer IDs survive, unless
+// SetJSONNumbers chose float64.
+func StringMap(data interface{}) map[string]string {
+	result := make(map[string]string)
+
+	// Convert the data to JSON first, then to map[string]interface{}
+	jsonBytes, err := json.Marshal(data)
+	if err != nil {
+		return result
+	}
+
+	var dataMap map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(jsonBytes))
+	if JSONNumberMode() != JSONNumbersFloat64 {
+		dec.UseNumber()
+	}
+	err = dec.Decode(&dataMap)
+	if err != nil {
+		return result
+	}
+
+	// Convert all values to strings for Avro compatibility
+	for key, value := range dataMap {
+		switch v := value.(type) {
+		case string:
+			result[key] = v
+		case nil:
+			result[key] = ""
+		default:
+			// Convert any other type to JSON string
+			valueBytes, _ := json.Marshal(v)
+			result[key] = string(valueBytes)
+		}
+	}
+
+	return result
+}
+
+// ToNative converts a struct to the map[string]interface{} form goavro
+// encodes, naming fields by their json tags. time.Time, time.Duration,
+// json.RawMessage and big.Rat fields keep forms goavro can encode; see
+// converter. json.RawMessage fields become strings.
+func ToNative(v interface{}) (map[string]interface{}, error) {
+	return converter{}.toNativeMap(v)
+}
+
+// FromNative fills v, a non-nil pointer, from a goavro native value.
+func FromNative(native interface{}, v interface{}) error {
+	return converter{}.fromNativePtr(native, v)
+}
+
+func (cv converter) toNativeMap(v interface{}) (map[string]interface{}, error) {
+	if m, ok := v.(map[string]interface{}); ok {
+		return m, nil
+	}
+	native, err := cv.toNative(reflect.ValueOf(v))
+	if err != nil {
+		return nil, err
+	}
+	out, ok := native.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("avrojson: %T does not convert to a record", v)
+	}
+	return out, nil
+}
+
+func (cv converter) fromNativePtr(native interface{}, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("avrojson: cannot decode into non-pointer %T", v)
+	}
+	return cv.fromNative(native, rv.Elem())
+}
+
+// nullableUnion wraps v for a ["null", typeName] union.
+func nullableUnion(typeName string, v interface{}) interface{} {
+	switch m := v.(type) {
+	case nil:
+		return nil
+	case map[string]string:
+		if m == nil {
+			return nil
+		}
+	}
+	return map[string]interface{}{typeName: v}
+}
+
+// unwrapStringMap reverses nullableUnion for map-of-string unions. It also
+// accepts the plain map Decode leaves after unwrapping the union; values
+// that are neither are returned unchanged.
+func unwrapStringMap(typeName string, v interface{}) interface{} {
+	inner, ok := v.(map[string]interface{})
+	if !ok {
+		return v
+	}
+	if len(inner) == 1 {
+		if wrapped, ok := inner[typeName].(map[string]interface{}); ok {
+			inner = wrapped
+		}
+	}
+	out := make(map[string]string, len(inner))
+	for key, value := range inner {
+		s, ok := value.(string)
+		if !ok {
+			return inner
+		}
+		out[key] = s
+	}
+	return out
+}
@@ -0,0 +1,532 @@
+package avrojson
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"sync/atomic"
+)
+
+// NonFinite selects what happens to NaN and infinite float and double
+// values. Avro binary holds them, but JSON has no numbers for them: goavro
+// writes NaN as null and infinities as ±1e999, which it cannot read back,
+// encoding/json refuses them, and a float beyond float32's range fails
+// with a bare strconv error.
+type NonFinite string
+
+const (
+	// NonFiniteReject fails with a *NonFiniteError naming the field. It is
+	// the default.
+	NonFiniteReject NonFinite = "reject"
+	// NonFiniteNull turns the value into null where its union has a null
+	// branch and rejects it elsewhere.
+	NonFiniteNull NonFinite = "null"
+	// NonFiniteClamp replaces infinities with the largest finite value of
+	// the type, keeping the sign, and NaN with 0.
+	NonFiniteClamp NonFinite = "clamp"
+	// NonFiniteString keeps the values in Avro binary and writes them to
+	// JSON as the strings "NaN", "Infinity" and "-Infinity", which Avro
+	// JSON input then accepts as well.
+	NonFiniteString NonFinite = "string"
+)
+
+var nonFinite atomic.Value // NonFinite
+
+// SetNonFinite sets how codecs treat NaN and infinite floats and doubles.
+// It applies process-wide; the default is NonFiniteReject.
+func SetNonFinite(policy NonFinite) error {
+	switch policy {
+	case NonFiniteReject, NonFiniteNull, NonFiniteClamp, NonFiniteString:
+		nonFinite.Store(policy)
+		return nil
+	}
+	return fmt.Errorf("avrojson: unknown non-finite policy %q (expected reject, null, clamp or string)", policy)
+}
+
+// NonFinitePolicy returns the policy set by SetNonFinite.
+func NonFinitePolicy() NonFinite {
+	if policy, ok := nonFinite.Load().(NonFinite); ok {
+		return policy
+	}
+	return NonFiniteReject
+}
+
+// NonFiniteError is a NaN, an infinity or a float out of float32's range
+// that the NonFinite policy does not let through.
+type NonFiniteError struct {
+	// Path locates the value like ValidationError.Path; it is empty for a
+	// top-level value.
+	Path  string
+	Type  string // float or double
+	Value float64
+}
+
+func (e *NonFiniteError) Error() string {
+	at := e.Path
+	if at == "" {
+		at = "value"
+	}
+	if !math.IsNaN(e.Value) && !math.IsInf(e.Value, 0) {
+		return fmt.Sprintf("avrojson: %s: %s is out of range for %s", at, formatFloat(e.Value), e.Type)
+	}
+	return fmt.Sprintf("avrojson: %s: %s is not a finite %s", at, formatFloat(e.Value), e.Type)
+}
+
+// formatFloat names f as NonFiniteString writes it.
+func formatFloat(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// parseNonFinite reads the strings NonFiniteString writes.
+func parseNonFinite(s string) (float64, bool) {
+	switch s {
+	case "NaN":
+		return math.NaN(), true
+	case "Infinity":
+		return math.Inf(1), true
+	case "-Infinity":
+		return math.Inf(-1), true
+	}
+	return 0, false
+}
+
+// isNonFinite reports whether f cannot be written as a JSON number of typ.
+func isNonFinite(typ string, f float64) bool {
+	return math.IsNaN(f) || math.IsInf(f, 0) || (typ == "float" && math.Abs(f) > math.MaxFloat32)
+}
+
+// clampFloat returns the finite value NonFiniteClamp puts for f.
+func clampFloat(typ string, f float64) float64 {
+	if math.IsNaN(f) {
+		return 0
+	}
+	max := math.MaxFloat64
+	if typ == "float" {
+		max = math.MaxFloat32
+	}
+	return math.Copysign(max, f)
+}
+
+// nativeFloat returns the float of a native float or double value.
+func nativeFloat(v interface{}) (float64, bool) {
+	switch f := v.(type) {
+	case float64:
+		return f, true
+	case float32:
+		return float64(f), true
+	}
+	return 0, false
+}
+
+// sameFloatType returns f as the Go type of like, so clamped float32s stay
+// float32.
+func sameFloatType(like interface{}, f float64) interface{} {
+	if _, ok := like.(float32); ok {
+		return float32(f)
+	}
+	return f
+}
+
+// floatVisit decides the value of one float or double in a walk, reporting
+// whether it changed.
+type floatVisit func(typ string, v interface{}, path string) (interface{}, bool, error)
+
+// floatWalk applies visit to the float and double values of a native or
+// Avro JSON value, whose unions are both {"branch": value} maps, copying
+// only the containers that change. NonFiniteNull errors become null where
+// the value's own union allows it.
+type floatWalk struct {
+	s      *parsedSchema
+	toNull bool
+	// paths is set to give visit the paths of values; detecting passes
+	// leave it unset so finite data costs no allocations.
+	paths bool
+	visit floatVisit
+}
+
+func (w *floatWalk) field(path, name string) string {
+	if !w.paths {
+		return ""
+	}
+	return joinPath(path, name)
+}
+
+func (w *floatWalk) index(path string, i int) string {
+	if !w.paths {
+		return ""
+	}
+	return fmt.Sprintf("%s[%d]", path, i)
+}
+
+func (w *floatWalk) key(path, k string) string {
+	if !w.paths {
+		return ""
+	}
+	return fmt.Sprintf("%s[%q]", path, k)
+}
+
+func (w *floatWalk) walk(node, v interface{}, path string) (interface{}, bool, error) {
+	switch n := node.(type) {
+	case string:
+		if n == "float" || n == "double" {
+			return w.visit(n, v, path)
+		}
+		if def, ok := w.s.named[n]; ok && !primitiveTypes[n] {
+			return w.walk(def, v, path)
+		}
+		return v, false, nil
+	case []interface{}:
+		wrapped, ok := v.(map[string]interface{})
+		if !ok || len(wrapped) != 1 {
+			return v, false, nil
+		}
+		for typeName, inner := range wrapped {
+			for _, branch := range n {
+				if branchName(branch) != typeName {
+					continue
+				}
+				out, changed, err := w.walk(branch, inner, path)
+				var nf *NonFiniteError
+				if w.toNull && errors.As(err, &nf) && nf.Path == path && nullable(n) {
+					return nil, true, nil
+				}
+				if err != nil || !changed {
+					return v, false, err
+				}
+				return map[string]interface{}{typeName: out}, true, nil
+			}
+		}
+		return v, false, nil
+	case map[string]interface{}:
+		t, ok := n["type"].(string)
+		if !ok {
+			return w.walk(n["type"], v, path)
+		}
+		switch t {
+		case "record", "error":
+			rec, ok := v.(map[string]interface{})
+			if !ok {
+				return v, false, nil
+			}
+			var out map[string]interface{}
+			fields, _ := n["fields"].([]interface{})
+			for _, f := range fields {
+				field, _ := f.(map[string]interface{})
+				name, _ := field["name"].(string)
+				val, ok := rec[name]
+				if !ok {
+					continue
+				}
+				fixed, changed, err := w.walk(field["type"], val, w.field(path, name))
+				if err != nil {
+					return v, false, err
+				}
+				if changed {
+					if out == nil {
+						out = make(map[string]interface{}, len(rec))
+						for k, val := range rec {
+							out[k] = val
+						}
+					}
+					out[name] = fixed
+				}
+			}
+			if out == nil {
+				return v, false, nil
+			}
+			return out, true, nil
+		case "array":
+			items, ok := v.([]interface{})
+			if !ok {
+				return v, false, nil
+			}
+			var out []interface{}
+			for i, item := range items {
+				fixed, changed, err := w.walk(n["items"], item, w.index(path, i))
+				if err != nil {
+					return v, false, err
+				}
+				if changed {
+					if out == nil {
+						out = append([]interface{}(nil), items...)
+					}
+					out[i] = fixed
+				}
+			}
+			if out == nil {
+				return v, false, nil
+			}
+			return out, true, nil
+		case "map":
+			values, ok := v.(map[string]interface{})
+			if !ok {
+				return v, false, nil
+			}
+			var out map[string]interface{}
+			for k, val := range values {
+				fixed, changed, err := w.walk(n["values"], val, w.key(path, k))
+				if err != nil {
+					return v, false, err
+				}
+				if changed {
+					if out == nil {
+						out = make(map[string]interface{}, len(values))
+						for k, val := range values {
+							out[k] = val
+						}
+					}
+					out[k] = fixed
+				}
+			}
+			if out == nil {
+				return v, false, nil
+			}
+			return out, true, nil
+		}
+		return w.walk(t, v, path)
+	}
+	return v, false, nil
+}
+
+// applyNonFinite applies the policy to the non-finite values of native.
+// With NonFiniteString, keep reports whether they stay as they are, as
+// binary holds them; otherwise they are written with write.
+func (s *parsedSchema) applyNonFinite(native interface{}, policy NonFinite, keep bool, write func(typ string, v interface{}, f float64, path string) interface{}) (interface{}, error) {
+	if !s.floats || (keep && policy == NonFiniteString) || !s.hasNonFinite(native) {
+		return native, nil
+	}
+	w := &floatWalk{s: s, toNull: policy == NonFiniteNull, paths: true}
+	w.visit = func(typ string, v interface{}, path string) (interface{}, bool, error) {
+		f, ok := nativeFloat(v)
+		if !ok || !isNonFinite(typ, f) {
+			return v, false, nil
+		}
+		switch policy {
+		case NonFiniteClamp:
+			return sameFloatType(v, clampFloat(typ, f)), true, nil
+		case NonFiniteString:
+			return write(typ, v, f, path), true, nil
+		}
+		return v, false, &NonFiniteError{Path: path, Type: typ, Value: f}
+	}
+	out, _, err := w.walk(s.root, native, "")
+	return out, err
+}
+
+// hasNonFinite reports whether native holds a value the policy acts on.
+func (s *parsedSchema) hasNonFinite(native interface{}) bool {
+	found := false
+	w := &floatWalk{s: s}
+	w.visit = func(typ string, v interface{}, _ string) (interface{}, bool, error) {
+		if f, ok := nativeFloat(v); ok && isNonFinite(typ, f) {
+			found = true
+		}
+		return v, false, nil
+	}
+	w.walk(s.root, native, "")
+	return found
+}
+
+// mayHoldNonFinite reports whether Avro JSON text may hold a number too
+// large for a float or one of the strings NonFiniteString writes: the
+// numbers need an exponent of two digits or more digits than any float
+// has, so most text is passed to goavro without being parsed twice.
+func mayHoldNonFinite(text []byte) bool {
+	if bytes.Contains(text, []byte("NaN")) || bytes.Contains(text, []byte("Infinity")) {
+		return true
+	}
+	digits := 0
+	for i, b := range text {
+		switch {
+		case b >= '0' && b <= '9':
+			digits++
+			if digits > 38 {
+				return true
+			}
+		case (b == 'e' || b == 'E') && digits > 0:
+			j := i + 1
+			if j < len(text) && (text[j] == '+' || text[j] == '-') {
+				j++
+			}
+			if j+1 < len(text) && isDigit(text[j]) && isDigit(text[j+1]) {
+				return true
+			}
+			digits = 0
+		case b == '.':
+		default:
+			digits = 0
+		}
+	}
+	return false
+}
+
+func isDigit(b byte) bool { return b >= '0' && b <= '9' }
+
+// FiniteNative applies NonFinitePolicy to native, a value of the codec's
+// schema such as DecodeNative returns, so encoding/json can write it:
+// NonFiniteString replaces NaN and infinities with their strings.
+func (c *Codec) FiniteNative(native interface{}) (interface{}, error) {
+	s, err := c.schemaTree()
+	if err != nil {
+		return nil, err
+	}
+	return s.applyNonFinite(native, NonFinitePolicy(), false, func(_ string, _ interface{}, f float64, _ string) interface{} {
+		return formatFloat(f)
+	})
+}
+
+// finiteForBinary applies the policy before goavro encodes native.
+func (c *Codec) finiteForBinary(native interface{}) (interface{}, error) {
+	s, err := c.schemaTree()
+	if err != nil || !s.floats {
+		return native, nil
+	}
+	return s.applyNonFinite(native, NonFinitePolicy(), true, nil)
+}
+
+// appendFiniteTextual writes native as Avro JSON under the policy. goavro
+// cannot write a string for a double, so NonFiniteString has it write 0
+// and puts the strings in afterwards.
+func (c *Codec) appendFiniteTextual(buf []byte, native interface{}) ([]byte, error) {
+	s, err := c.schemaTree()
+	if err != nil || !s.floats {
+		return c.textualStage(buf, native)
+	}
+	marks := make(map[string]string)
+	fixed, err := s.applyNonFinite(native, NonFinitePolicy(), false, func(_ string, v interface{}, f float64, path string) interface{} {
+		marks[path] = formatFloat(f)
+		return sameFloatType(v, 0)
+	})
+	if err != nil {
+		return nil, err
+	}
+	out, err := c.textualStage(buf, fixed)
+	if err != nil || len(marks) == 0 {
+		return out, err
+	}
+
+	var text interface{}
+	dec := json.NewDecoder(bytes.NewReader(out[len(buf):]))
+	dec.UseNumber()
+	if err := dec.Decode(&text); err != nil {
+		return nil, err
+	}
+	w := &floatWalk{s: s, paths: true, visit: func(_ string, v interface{}, path string) (interface{}, bool, error) {
+		if mark, ok := marks[path]; ok {
+			return mark, true, nil
+		}
+		return v, false, nil
+	}}
+	patched, _, _ := w.walk(s.root, text, "")
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(patched); err != nil {
+		return nil, err
+	}
+	return append(out[:len(buf)], bytes.TrimSuffix(b.Bytes(), []byte("\n"))...), nil
+}
+
+// finiteText prepares Avro JSON text for goavro under the policy: numbers
+// a float or double cannot hold and the strings NonFiniteString writes
+// are rejected, nulled or clamped. With NonFiniteString they are read as
+// 0 and restore puts the real values into the native result.
+func (c *Codec) finiteText(text []byte) (out []byte, restore func(interface{}) interface{}, err error) {
+	s, err := c.schemaTree()
+	if err != nil || !s.floats || !mayHoldNonFinite(text) {
+		return text, nil, nil
+	}
+	var doc interface{}
+	dec := json.NewDecoder(bytes.NewReader(text))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		// goavro reports its own parse errors.
+		return text, nil, nil
+	}
+	policy := NonFinitePolicy()
+	marks := make(map[string]float64)
+	w := &floatWalk{s: s, toNull: policy == NonFiniteNull, paths: true}
+	w.visit = func(typ string, v interface{}, path string) (interface{}, bool, error) {
+		var f float64
+		switch x := v.(type) {
+		case json.Number:
+			bits := 64
+			if typ == "float" {
+				bits = 32
+			}
+			parsed, err := strconv.ParseFloat(string(x), bits)
+			if err == nil || !math.IsInf(parsed, 0) {
+				return v, false, nil
+			}
+			f = parsed
+		case string:
+			parsed, ok := parseNonFinite(x)
+			if !ok {
+				return v, false, nil
+			}
+			f = parsed
+		default:
+			return v, false, nil
+		}
+		switch policy {
+		case NonFiniteClamp:
+			bits := 64
+			if typ == "float" {
+				bits = 32
+			}
+			return json.Number(strconv.FormatFloat(clampFloat(typ, f), 'g', -1, bits)), true, nil
+		case NonFiniteString:
+			marks[path] = f
+			return json.Number("0"), true, nil
+		}
+		return v, false, &NonFiniteError{Path: path, Type: typ, Value: f}
+	}
+	fixed, changed, err := w.walk(s.root, doc, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	if !changed {
+		return text, nil, nil
+	}
+	if out, err = json.Marshal(fixed); err != nil {
+		return nil, nil, err
+	}
+	if len(marks) == 0 {
+		return out, nil, nil
+	}
+	return out, func(native interface{}) interface{} {
+		w := &floatWalk{s: s, paths: true, visit: func(_ string, v interface{}, path string) (interface{}, bool, error) {
+			if f, ok := marks[path]; ok {
+				return sameFloatType(v, f), true, nil
+			}
+			return v, false, nil
+		}}
+		restored, _, _ := w.walk(s.root, native, "")
+		return restored
+	}, nil
+}
+
+func nullable(node interface{}) bool {
+	if node == "null" {
+		return true
+	}
+	if union, ok := node.([]interface{}); ok {
+		for _, branch := range union {
+			if branch == "null" {
+				return true
+			}
+		}
+	}
+	return false
+}
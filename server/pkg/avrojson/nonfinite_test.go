@@ -0,0 +1,150 @@
+package avrojson
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+const nonFiniteSchema = `{"type":"record","name":"Reading","fields":[
+	{"name":"d","type":"double"},
+	{"name":"f","type":"float"},
+	{"name":"n","type":["null","double"]},
+	{"name":"series","type":{"type":"array","items":"double"}}
+]}`
+
+func withNonFinite(t *testing.T, policy NonFinite) {
+	t.Helper()
+	if err := SetNonFinite(policy); err != nil {
+		t.Fatalf("Failed to set policy: %v", err)
+	}
+	t.Cleanup(func() { SetNonFinite(NonFiniteReject) })
+}
+
+func reading(d, f, n float64, series ...float64) map[string]interface{} {
+	items := make([]interface{}, len(series))
+	for i, v := range series {
+		items[i] = v
+	}
+	return map[string]interface{}{"d": d, "f": f, "n": n, "series": items}
+}
+
+func TestNonFiniteReject(t *testing.T) {
+	codec, err := NewCodec(nonFiniteSchema)
+	if err != nil {
+		t.Fatalf("Failed to create codec: %v", err)
+	}
+	cases := map[string]struct {
+		value map[string]interface{}
+		path  string
+	}{
+		"NaN double":     {reading(math.NaN(), 1, 1), "d"},
+		"nullable":       {reading(1, 1, math.Inf(-1)), "n"},
+		"array item":     {reading(1, 1, 1, 0, math.Inf(1)), "series[1]"},
+		"float overflow": {reading(1, 1e300, 1), "f"},
+	}
+	for name, tc := range cases {
+		_, err := codec.Encode(tc.value)
+		var nf *NonFiniteError
+		if !errors.As(err, &nf) || nf.Path != tc.path {
+			t.Errorf("%s: expected a NonFiniteError at %q, got %v", name, tc.path, err)
+		}
+	}
+
+	_, err = codec.JSONToBinary([]byte(`{"d":1e999,"f":1,"n":null,"series":[]}`))
+	var nf *NonFiniteError
+	if !errors.As(err, &nf) || nf.Path != "d" || !strings.Contains(err.Error(), "not a finite double") {
+		t.Errorf("expected 1e999 to be rejected at d, got %v", err)
+	}
+	if _, err := codec.JSONToBinary([]byte(`{"d":1,"f":1e300,"n":null,"series":[]}`)); !errors.As(err, &nf) || nf.Path != "f" {
+		t.Errorf("expected a float out of range to be rejected at f, got %v", err)
+	}
+	if _, err := codec.JSONToBinary([]byte(`{"d":1.5e10,"f":2.5,"n":{"double":3},"series":[1e-5]}`)); err != nil {
+		t.Errorf("expected finite values to pass, got %v", err)
+	}
+}
+
+func TestNonFiniteNullAndClamp(t *testing.T) {
+	codec, err := NewCodec(nonFiniteSchema)
+	if err != nil {
+		t.Fatalf("Failed to create codec: %v", err)
+	}
+
+	withNonFinite(t, NonFiniteNull)
+	binary, err := codec.Encode(reading(1, 1, math.NaN()))
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	native, err := codec.DecodeNative(binary)
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if native.(map[string]interface{})["n"] != nil {
+		t.Errorf("expected NaN in a nullable union to become null, got %v", native)
+	}
+	if _, err := codec.Encode(reading(math.NaN(), 1, 1)); err == nil {
+		t.Error("expected NaN outside a nullable union to be rejected")
+	}
+	if _, err := codec.JSONToBinary([]byte(`{"d":1,"f":1,"n":{"double":"NaN"},"series":[]}`)); err != nil {
+		t.Errorf("expected \"NaN\" text in a nullable union to become null, got %v", err)
+	}
+
+	withNonFinite(t, NonFiniteClamp)
+	binary, err = codec.Encode(reading(math.Inf(-1), 1e300, math.NaN(), math.Inf(1)))
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	native, _ = codec.DecodeNative(binary)
+	got := native.(map[string]interface{})
+	if got["d"] != -math.MaxFloat64 || got["f"] != float32(math.MaxFloat32) || got["n"].(map[string]interface{})["double"] != 0.0 || got["series"].([]interface{})[0] != math.MaxFloat64 {
+		t.Errorf("unexpected clamped values: %v", got)
+	}
+	if _, err := codec.JSONToBinary([]byte(`{"d":-1e999,"f":1e39,"n":null,"series":[]}`)); err != nil {
+		t.Errorf("expected out of range text to be clamped, got %v", err)
+	}
+}
+
+func TestNonFiniteString(t *testing.T) {
+	codec, err := NewCodec(nonFiniteSchema)
+	if err != nil {
+		t.Fatalf("Failed to create codec: %v", err)
+	}
+	withNonFinite(t, NonFiniteString)
+
+	binary, err := codec.Encode(reading(math.NaN(), float64(float32(math.Inf(1))), math.Inf(-1), 2.5))
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	text, err := codec.BinaryToJSON(binary)
+	if err != nil {
+		t.Fatalf("Failed to convert to JSON: %v", err)
+	}
+	for _, want := range []string{`"d":"NaN"`, `"f":"Infinity"`, `"n":{"double":"-Infinity"}`, `"series":[2.5]`} {
+		if !strings.Contains(string(text), want) {
+			t.Errorf("expected %s in %s", want, text)
+		}
+	}
+	again, err := codec.JSONToBinary(text)
+	if err != nil {
+		t.Fatalf("Failed to read the JSON back: %v", err)
+	}
+	if string(again) != string(binary) {
+		t.Errorf("expected the JSON to round-trip to the same binary")
+	}
+
+	native, err := codec.DecodeNative(binary)
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	plain, err := codec.FiniteNative(native)
+	if err != nil {
+		t.Fatalf("Failed to apply the policy: %v", err)
+	}
+	if plain.(map[string]interface{})["d"] != "NaN" {
+		t.Errorf("expected FiniteNative to write NaN as a string, got %v", plain)
+	}
+	if err := SetNonFinite("ignore"); err == nil {
+		t.Error("expected an unknown policy to fail")
+	}
+}
@@ -0,0 +1,131 @@
+package avrojson
+
+import "reflect"
+
+// nullBranch returns the non-null branch of a ["null", T] union.
+func nullBranch(union []interface{}) (interface{}, bool) {
+	if len(union) != 2 {
+		return nil, false
+	}
+	switch {
+	case branchName(union[0]) == "null":
+		return union[1], true
+	case branchName(union[1]) == "null":
+		return union[0], true
+	}
+	return nil, false
+}
+
+// nullable walks v along node and converts the values of ["null", T]
+// unions between plain values, as Go structs hold them, and goavro's
+// {"T": value} form. wrap selects the direction. A value that is already a
+// single-key map naming T is taken as wrapped. Other unions are left to
+// the caller.
+func (s *parsedSchema) nullable(node, v interface{}, wrap bool) interface{} {
+	switch n := node.(type) {
+	case string:
+		if def, ok := s.named[n]; ok && !primitiveTypes[n] {
+			return s.nullable(def, v, wrap)
+		}
+		return v
+	case []interface{}:
+		if v == nil {
+			return nil
+		}
+		branch, ok := nullBranch(n)
+		if !ok {
+			return v
+		}
+		name := branchName(branch)
+		inner, wrapped := v, false
+		if m, ok := v.(map[string]interface{}); ok && len(m) == 1 {
+			if value, ok := m[name]; ok {
+				inner, wrapped = value, true
+			}
+		}
+		if !wrap && !wrapped {
+			return v
+		}
+		inner = s.nullable(branch, inner, wrap)
+		if wrap {
+			return map[string]interface{}{name: inner}
+		}
+		return inner
+	case map[string]interface{}:
+		t, ok := n["type"].(string)
+		if !ok {
+			return s.nullable(n["type"], v, wrap)
+		}
+		switch t {
+		case "record", "error":
+			rec, ok := v.(map[string]interface{})
+			if !ok {
+				return v
+			}
+			out := make(map[string]interface{}, len(rec))
+			for k, val := range rec {
+				out[k] = val
+			}
+			fields, _ := n["fields"].([]interface{})
+			for _, f := range fields {
+				field, _ := f.(map[string]interface{})
+				name, _ := field["name"].(string)
+				if val, ok := rec[name]; ok {
+					out[name] = s.nullable(field["type"], val, wrap)
+				}
+			}
+			return out
+		case "array":
+			items, ok := v.([]interface{})
+			if !ok {
+				return v
+			}
+			out := make([]interface{}, len(items))
+			for i, item := range items {
+				out[i] = s.nullable(n["items"], item, wrap)
+			}
+			return out
+		case "map":
+			values, ok := v.(map[string]interface{})
+			if !ok {
+				return v
+			}
+			out := make(map[string]interface{}, len(values))
+			for k, val := range values {
+				out[k] = s.nullable(n["values"], val, wrap)
+			}
+			return out
+		}
+	}
+	return v
+}
+
+// wrapNullable wraps the plain values a Go value leaves in ["null", T]
+// union positions, so pointer and omitempty fields encode without
+// hand-written union maps.
+func (c *Codec) wrapNullable(native interface{}) (interface{}, error) {
+	s, err := c.schemaTree()
+	if err != nil {
+		return nil, err
+	}
+	return s.nullable(s.root, native, true), nil
+}
+
+// unwrapNullable unwraps ["null", T] unions of a decoded native value when
+// v is a struct, whose pointer and omitempty fields hold plain values;
+// null stays null and leaves pointers nil. Maps and other targets keep
+// goavro's native form.
+func (c *Codec) unwrapNullable(native interface{}, v interface{}) (interface{}, error) {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return native, nil
+	}
+	s, err := c.schemaTree()
+	if err != nil {
+		return nil, err
+	}
+	return s.nullable(s.root, native, false), nil
+}
@@ -0,0 +1,93 @@
+package avrojson
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sync/atomic"
+)
+
+// JSONNumbers selects how numbers parsed from JSON text reach goavro.
+type JSONNumbers string
+
+const (
+	// JSONNumbersExact keeps integers that fit in an int64 as int64, so IDs
+	// above 2^53 arrive intact; other numbers become float64.
+	JSONNumbersExact JSONNumbers = "exact"
+	// JSONNumbersFloat64 parses every number as float64, as encoding/json
+	// does for interface{} values.
+	JSONNumbersFloat64 JSONNumbers = "float64"
+)
+
+var jsonNumbers atomic.Value // JSONNumbers
+
+var jsonNumberType = reflect.TypeOf(json.Number(""))
+
+// SetJSONNumbers sets how StringMap, RawJSONParse fields and types that
+// marshal themselves parse JSON numbers. It applies process-wide; the
+// default is JSONNumbersExact.
+func SetJSONNumbers(mode JSONNumbers) error {
+	switch mode {
+	case JSONNumbersExact, JSONNumbersFloat64:
+		jsonNumbers.Store(mode)
+		return nil
+	}
+	return fmt.Errorf("avrojson: unknown JSON number mode %q (expected %s or %s)", mode, JSONNumbersExact, JSONNumbersFloat64)
+}
+
+// JSONNumberMode returns the mode set by SetJSONNumbers.
+func JSONNumberMode() JSONNumbers {
+	if mode, ok := jsonNumbers.Load().(JSONNumbers); ok {
+		return mode
+	}
+	return JSONNumbersExact
+}
+
+// unmarshalJSON parses data into v like json.Unmarshal, keeping integers
+// exact unless SetJSONNumbers chose float64.
+func unmarshalJSON(data []byte, v *interface{}) error {
+	if JSONNumberMode() == JSONNumbersFloat64 {
+		return json.Unmarshal(data, v)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("avrojson: invalid JSON: data after top-level value")
+	}
+	*v = resolveNumbers(*v)
+	return nil
+}
+
+// resolveNumbers replaces the json.Numbers in a decoded value with the
+// int64 or float64 goavro expects.
+func resolveNumbers(v interface{}) interface{} {
+	switch t := v.(type) {
+	case json.Number:
+		return numberValue(t)
+	case map[string]interface{}:
+		for k, item := range t {
+			t[k] = resolveNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range t {
+			t[i] = resolveNumbers(item)
+		}
+	}
+	return v
+}
+
+// numberValue returns n as an int64 when it is an integer in range, and as
+// a float64 otherwise.
+func numberValue(n json.Number) interface{} {
+	if i, err := n.Int64(); err == nil && JSONNumberMode() != JSONNumbersFloat64 {
+		return i
+	}
+	f, _ := n.Float64()
+	return f
+}
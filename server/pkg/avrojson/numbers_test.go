@@ -0,0 +1,81 @@
+package avrojson
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// bigID is 2^53 + 1, the smallest integer float64 cannot hold.
+const bigID = 9007199254740993
+
+type testSelfMarshaled struct{ id int64 }
+
+func (s testSelfMarshaled) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{"id": s.id})
+}
+
+func TestJSONNumbersKeepLargeIntegers(t *testing.T) {
+	codec, err := NewCodec(`{"type":"record","name":"Account","fields":[{"name":"id","type":"long"}]}`)
+	if err != nil {
+		t.Fatalf("Failed to compile schema: %v", err)
+	}
+	decodeID := func(data []byte) interface{} {
+		t.Helper()
+		native, err := codec.DecodeNative(data)
+		if err != nil {
+			t.Fatalf("Failed to decode: %v", err)
+		}
+		return native.(map[string]interface{})["id"]
+	}
+
+	if got := StringMap(map[string]interface{}{"id": int64(bigID), "ratio": 0.5})["id"]; got != "9007199254740993" {
+		t.Errorf("StringMap id = %s", got)
+	}
+
+	// Types that marshal themselves go through JSON.
+	data, err := codec.Encode(testSelfMarshaled{bigID})
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	if id := decodeID(data); id != int64(bigID) {
+		t.Errorf("self-marshaled id = %v", id)
+	}
+
+	// json.Number values from a UseNumber decoder are numbers.
+	native, err := ToNative(struct {
+		ID interface{} `json:"id"`
+	}{json.Number("9007199254740993")})
+	if err != nil || native["id"] != int64(bigID) {
+		t.Errorf("ToNative json.Number = %v, %v", native["id"], err)
+	}
+
+	// Avro JSON is parsed by goavro, which keeps longs exact on its own.
+	data, err = codec.JSONToBinary([]byte(`{"id":9007199254740993}`))
+	if err != nil {
+		t.Fatalf("Failed to convert JSON: %v", err)
+	}
+	if id := decodeID(data); id != int64(bigID) {
+		t.Errorf("JSONToBinary id = %v", id)
+	}
+}
+
+func TestJSONNumbersFloat64Mode(t *testing.T) {
+	if err := SetJSONNumbers("decimal"); err == nil {
+		t.Error("Expected an unknown mode to be rejected")
+	}
+	if err := SetJSONNumbers(JSONNumbersFloat64); err != nil {
+		t.Fatalf("Failed to set mode: %v", err)
+	}
+	defer SetJSONNumbers(JSONNumbersExact)
+
+	if got := StringMap(map[string]interface{}{"id": int64(bigID)})["id"]; got != "9007199254740992" {
+		t.Errorf("StringMap id = %s, want the float64 rounding", got)
+	}
+	var parsed interface{}
+	if err := unmarshalJSON([]byte(`{"n":1}`), &parsed); err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if n := parsed.(map[string]interface{})["n"]; n != float64(1) {
+		t.Errorf("n = %#v, want float64", n)
+	}
+}
@@ -0,0 +1,160 @@
+package avrojson
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Every walk over a codec's schema, from union stripping and validation to
+// zero values and resolution, starts from one parse of it that the codec
+// caches: a parsedSchema, whose names are resolved here once.
+
+var primitiveTypes = map[string]bool{
+	"null": true, "boolean": true, "int": true, "long": true,
+	"float": true, "double": true, "bytes": true, "string": true,
+}
+
+// parsedSchema is a parsed schema with every name resolved as goavro
+// resolves it. Named types carry their full name and are defined once;
+// references are their full name, looked up in named. {"type": T} is
+// reduced to T, as in the canonical form, but logical types and the other
+// attributes are kept because goavro names union branches after them.
+type parsedSchema struct {
+	root  interface{}
+	named map[string]interface{}
+	// checked is set when the schema has decimal or uuid logical types,
+	// whose values the codec checks before encoding.
+	checked bool
+	// floats is set when it has float or double values, which may be
+	// NaN or infinite.
+	floats bool
+}
+
+func parseSchema(schema string) (*parsedSchema, error) {
+	var root interface{}
+	if err := json.Unmarshal([]byte(schema), &root); err != nil {
+		return nil, err
+	}
+	s := &parsedSchema{named: make(map[string]interface{})}
+	s.root = s.normalize(root, "")
+	return s, nil
+}
+
+// normalize rewrites node with its names resolved in namespace.
+func (s *parsedSchema) normalize(node interface{}, namespace string) interface{} {
+	switch n := node.(type) {
+	case string:
+		if n == "float" || n == "double" {
+			s.floats = true
+		}
+		return resolveName(n, namespace, func(full string) bool { return s.named[full] != nil })
+	case []interface{}:
+		out := make([]interface{}, len(n))
+		for i, branch := range n {
+			out[i] = s.normalize(branch, namespace)
+		}
+		return out
+	case map[string]interface{}:
+		t, ok := n["type"].(string)
+		if !ok {
+			return s.normalize(n["type"], namespace)
+		}
+		out := make(map[string]interface{}, len(n))
+		for k, v := range n {
+			out[k] = v
+		}
+		if lt := n["logicalType"]; lt == "decimal" || lt == "uuid" {
+			s.checked = true
+		}
+		switch t {
+		case "record", "error", "enum", "fixed":
+			name, inner := namedType(n, namespace, true)
+			delete(out, "namespace")
+			out["name"] = name
+			// Register before the fields so recursive references resolve.
+			s.named[name] = out
+			if fields, ok := n["fields"].([]interface{}); ok {
+				normalized := make([]interface{}, len(fields))
+				for i, f := range fields {
+					field, _ := f.(map[string]interface{})
+					copied := make(map[string]interface{}, len(field))
+					for k, v := range field {
+						copied[k] = v
+					}
+					copied["type"] = s.normalize(field["type"], inner)
+					normalized[i] = copied
+				}
+				out["fields"] = normalized
+			}
+			return out
+		case "array":
+			out["items"] = s.normalize(n["items"], namespace)
+			return out
+		case "map":
+			out["values"] = s.normalize(n["values"], namespace)
+			return out
+		}
+		if _, ok := n["logicalType"].(string); ok && primitiveTypes[t] {
+			return out
+		}
+		return s.normalize(t, namespace)
+	}
+	return node
+}
+
+// namespaceOf returns the namespace of a full name.
+func namespaceOf(full string) string {
+	if i := strings.LastIndexByte(full, '.'); i >= 0 {
+		return full[:i]
+	}
+	return ""
+}
+
+// namedType returns the full name of n, a named type defined in
+// namespace, and the namespace the names in its fields resolve in. A
+// dotted name is a full name; otherwise an explicit namespace, even an
+// empty one, replaces the enclosing one. goavro, whose names key the
+// branches of native unions, keeps the enclosing namespace for an empty
+// one instead; goavroNames follows it.
+func namedType(n map[string]interface{}, namespace string, goavroNames bool) (string, string) {
+	name, _ := n["name"].(string)
+	if strings.ContainsRune(name, '.') {
+		return name, namespaceOf(name)
+	}
+	if ns, ok := n["namespace"].(string); ok && (ns != "" || !goavroNames) {
+		namespace = ns
+	}
+	return fullName(name, namespace), namespace
+}
+
+// resolveName returns the full name a type name refers to in namespace,
+// defined reporting the full names defined so far. Primitive names are
+// never qualified; a short name prefers the type of the enclosing
+// namespace, then one of the null namespace.
+func resolveName(name, namespace string, defined func(full string) bool) string {
+	if primitiveTypes[name] || strings.ContainsRune(name, '.') {
+		return name
+	}
+	if full := fullName(name, namespace); defined(full) {
+		return full
+	}
+	if defined(name) {
+		return name
+	}
+	return fullName(name, namespace)
+}
+
+func fullName(name, namespace string) string {
+	if strings.Contains(name, ".") || namespace == "" {
+		return name
+	}
+	return namespace + "." + name
+}
+
+// schemaTree returns the codec's parsed schema, parsing it on first use.
+func (c *Codec) schemaTree() (*parsedSchema, error) {
+	c.parsed.once.Do(func() {
+		c.parsed.schema, c.parsed.err = parseSchema(c.codec.Schema())
+	})
+	return c.parsed.schema, c.parsed.err
+}
@@ -0,0 +1,57 @@
+package avrojson
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParsedSchemaResolvesNamesOnce(t *testing.T) {
+	// g refers to T of the null namespace from inside namespace n, and S
+	// has an explicit empty namespace, which goavro ignores.
+	schema := `{"type": "record", "name": "R", "fields": [
+		{"name": "t", "type": {"type": "record", "name": "T", "fields": []}},
+		{"name": "u", "type": {"type": "record", "name": "U", "namespace": "n", "fields": [
+			{"name": "g", "type": ["null", "T"]},
+			{"name": "s", "type": ["null", {"type": "record", "name": "S", "namespace": "", "fields": []}]}
+		]}}
+	]}`
+	codec, err := NewCodec(schema)
+	if err != nil {
+		t.Fatalf("Failed to create codec: %v", err)
+	}
+
+	plain := []byte(`{"t":{},"u":{"g":{},"s":{}}}`)
+	wrapped, err := codec.WrapUnionsJSON(plain)
+	if err != nil {
+		t.Fatalf("Failed to wrap unions: %v", err)
+	}
+	if want := `{"t":{},"u":{"g":{"T":{}},"s":{"n.S":{}}}}`; string(wrapped) != want {
+		t.Errorf("expected goavro's branch names %s, got %s", want, wrapped)
+	}
+	binary, err := codec.JSONToBinary(wrapped)
+	if err != nil {
+		t.Fatalf("expected goavro to accept the wrapped datum: %v", err)
+	}
+	if errs, err := codec.Validate(plain, ValidateOptions{PlainUnions: true}); err != nil || len(errs) != 0 {
+		t.Errorf("expected the plain datum to validate, got %v %v", errs, err)
+	}
+	if err := codec.SelfCheck(); err != nil {
+		t.Errorf("expected the zero value to round-trip: %v", err)
+	}
+	r, err := NewResolver(schema, schema)
+	if err != nil {
+		t.Fatalf("Failed to create resolver: %v", err)
+	}
+	if _, err := r.Reencode(binary); err != nil {
+		t.Errorf("expected the datum to resolve onto its own schema: %v", err)
+	}
+
+	// The canonical form follows the specification instead.
+	canonical, err := Canonical(schema)
+	if err != nil {
+		t.Fatalf("Failed to compute canonical form: %v", err)
+	}
+	if !strings.Contains(canonical, `{"name":"T","type":"record"`) || !strings.Contains(canonical, `["null","T"]`) || !strings.Contains(canonical, `{"name":"S","type":"record"`) {
+		t.Errorf("expected null-namespace names in %s", canonical)
+	}
+}
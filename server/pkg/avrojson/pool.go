@@ -0,0 +1,87 @@
+package avrojson
+
+import "sync"
+
+// DecoderPool hands out Decoders for one codec. A Decoder keeps its output
+// buffer between calls, so turning many records into Avro JSON, as export
+// and replay do, reuses memory instead of allocating it per record. The
+// pool is safe for concurrent use; each Decoder belongs to one goroutine
+// between Get and Put.
+type DecoderPool struct {
+	codec *Codec
+	pool  sync.Pool
+}
+
+// maxPooledBuffer caps the buffers kept in the pool, so one large record
+// does not pin its memory for the life of the process.
+const maxPooledBuffer = 64 << 10
+
+// NewDecoderPool returns a pool of decoders for codec.
+func NewDecoderPool(codec *Codec) *DecoderPool {
+	p := &DecoderPool{codec: codec}
+	p.pool.New = func() interface{} { return &Decoder{codec: codec, buf: make([]byte, 0, 1024)} }
+	return p
+}
+
+// Decoders returns the codec's shared decoder pool, created on first use.
+// Cached codecs keep theirs, so callers need not hold on to pools.
+func (c *Codec) Decoders() *DecoderPool {
+	c.decoders.once.Do(func() { c.decoders.pool = NewDecoderPool(c) })
+	return c.decoders.pool
+}
+
+// Get returns a decoder from the pool.
+func (p *DecoderPool) Get() *Decoder {
+	return p.pool.Get().(*Decoder)
+}
+
+// Put returns d to the pool. JSON output d returned must not be used
+// afterwards.
+func (p *DecoderPool) Put(d *Decoder) {
+	if cap(d.buf) > maxPooledBuffer {
+		return
+	}
+	d.buf = d.buf[:0]
+	p.pool.Put(d)
+}
+
+// Decoder decodes records of one schema, reusing its JSON output buffer.
+type Decoder struct {
+	codec *Codec
+	buf   []byte
+}
+
+// Codec returns the codec the decoder uses.
+func (d *Decoder) Codec() *Codec { return d.codec }
+
+// Native reads one Avro binary datum into goavro's native form.
+func (d *Decoder) Native(data []byte) (interface{}, error) {
+	return d.codec.nativeFromBinary(data)
+}
+
+// Decode reads one Avro binary datum into v, like Codec.Decode.
+func (d *Decoder) Decode(data []byte, v interface{}) error {
+	return d.codec.Decode(data, v)
+}
+
+// JSON converts one Avro binary datum to Avro JSON. The result is valid
+// until the decoder's next call or Put.
+func (d *Decoder) JSON(data []byte) ([]byte, error) {
+	native, err := d.codec.nativeFromBinary(data)
+	if err != nil {
+		return nil, err
+	}
+	return d.NativeJSON(native)
+}
+
+// NativeJSON converts a native value, such as a record read from an OCF
+// file, to Avro JSON. The result is valid until the decoder's next call or
+// Put.
+func (d *Decoder) NativeJSON(native interface{}) ([]byte, error) {
+	out, err := d.codec.appendTextual(d.buf[:0], native)
+	if err != nil {
+		return nil, err
+	}
+	d.buf = out
+	return out, nil
+}
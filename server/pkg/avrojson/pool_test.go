@@ -0,0 +1,50 @@
+package avrojson
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestDecoderPoolReusesBuffers(t *testing.T) {
+	codec, err := NewCodec(`{"type":"record","name":"Event","fields":[{"name":"name","type":"string"}]}`)
+	if err != nil {
+		t.Fatalf("Failed to compile schema: %v", err)
+	}
+	if codec.Decoders() != codec.Decoders() {
+		t.Error("Expected one shared pool per codec")
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				// Vary the length so a stale tail would show.
+				name := strings.Repeat("x", (g*50+i)%17)
+				data, err := codec.EncodeNative(map[string]interface{}{"name": name})
+				if err != nil {
+					t.Errorf("Failed to encode: %v", err)
+					return
+				}
+				want, _ := codec.BinaryToJSON(data)
+				dec := codec.Decoders().Get()
+				got, err := dec.JSON(data)
+				if err != nil || string(got) != string(want) {
+					t.Errorf("pooled JSON = %s, %v; want %s", got, err, want)
+				}
+				codec.Decoders().Put(dec)
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	// Oversized buffers are dropped rather than pooled.
+	dec := codec.Decoders().Get()
+	big, _ := codec.EncodeNative(map[string]interface{}{"name": strings.Repeat("y", maxPooledBuffer)})
+	if _, err := dec.JSON(big); err != nil {
+		t.Fatalf("Failed to convert large record: %v", err)
+	}
+	codec.Decoders().Put(dec)
+}
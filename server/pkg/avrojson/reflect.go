@@ -0,0 +1,363 @@
+package avrojson
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+// SchemaOf generates an Avro schema from the type of v, which must be a
+// struct or a pointer to one, so new log shapes don't need hand-written
+// schema JSON. Fields are named by their avro tag, then their json tag,
+// then the Go field name; "-" skips a field and embedded structs are
+// flattened like encoding/json does.
+//
+// Go types map to Avro as follows:
+//
+//	bool                          boolean
+//	int8, int16, int32, uint8/16  int
+//	int, int64, uint32, uint64    long
+//	float32, float64              float, double
+//	string, []byte                string, bytes
+//	[N]byte                       fixed of size N
+//	slices and arrays             array
+//	map[string]T                  map
+//	structs                       record named after the Go type
+//	pointers                      ["null", T] with a null default
+//	time.Time                     long timestamp-millis
+//	time.Duration                 long (milliseconds)
+//	json.RawMessage               string holding the JSON text
+//	big.Rat                       bytes decimal (precision 38, scale 9)
+//	big.Int                       bytes decimal (precision 38, scale 0)
+//	types implementing AvroEnum   enum
+//	adapted types                 their adapter's or AvroSchema's type
+//
+// Tag options after the name adjust a field: "nullable" (or "omitempty")
+// wraps it like a pointer, "logical=<type>" picks another logical type for
+// time.Time (timestamp-micros, date, ...) or a string (uuid), and
+// "precision=<p>" and "scale=<s>" configure decimals; values that do not
+// fit fail to encode rather than being truncated. A json omitempty
+// option makes a field nullable too, since ToNative leaves empty values
+// out and they must fall back to the null default. Encode wraps the set
+// values of nullable fields and Decode turns null back into nil pointers
+// and zero values. Interface fields have no Avro type and are rejected. The result is checked by compiling it with goavro.
+func SchemaOf(v interface{}) (string, error) {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return "", fmt.Errorf("avrojson: SchemaOf needs a struct, got %v", reflect.TypeOf(v))
+	}
+
+	g := &schemaGenerator{defined: make(map[reflect.Type]string), names: make(map[string]reflect.Type)}
+	schema, err := g.typeSchema(t, fieldOptions{}, t.Name())
+	if err != nil {
+		return "", err
+	}
+	out, err := json.Marshal(schema)
+	if err != nil {
+		return "", err
+	}
+	if _, err := goavro.NewCodec(string(out)); err != nil {
+		return "", fmt.Errorf("avrojson: generated schema does not compile: %w", err)
+	}
+	return string(out), nil
+}
+
+// AvroEnum is implemented by string types that should become Avro enums.
+type AvroEnum interface {
+	AvroSymbols() []string
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+	ratType      = reflect.TypeOf(big.Rat{})
+	enumType     = reflect.TypeOf((*AvroEnum)(nil)).Elem()
+)
+
+// The ordered schema shapes emitted by SchemaOf.
+type recordSchema struct {
+	Type   string        `json:"type"`
+	Name   string        `json:"name"`
+	Fields []fieldSchema `json:"fields"`
+}
+
+type fieldSchema struct {
+	Name    string          `json:"name"`
+	Type    interface{}     `json:"type"`
+	Default json.RawMessage `json:"default,omitempty"`
+}
+
+type enumSchema struct {
+	Type    string   `json:"type"`
+	Name    string   `json:"name"`
+	Symbols []string `json:"symbols"`
+}
+
+type fixedSchema struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+	Size int    `json:"size"`
+}
+
+type containerSchema struct {
+	Type   string      `json:"type"`
+	Items  interface{} `json:"items,omitempty"`
+	Values interface{} `json:"values,omitempty"`
+}
+
+type logicalSchema struct {
+	Type        string `json:"type"`
+	LogicalType string `json:"logicalType"`
+}
+
+// decimalSchema always spells out the scale: goavro panics on a second
+// bytes decimal without one.
+type decimalSchema struct {
+	Type        string `json:"type"`
+	LogicalType string `json:"logicalType"`
+	Precision   int    `json:"precision"`
+	Scale       int    `json:"scale"`
+}
+
+type fieldOptions struct {
+	nullable  bool
+	logical   string
+	precision int
+	scale     int
+	scaleSet  bool
+}
+
+func parseFieldTag(field reflect.StructField) (name string, opts fieldOptions, skip bool, err error) {
+	jsonName, jsonOpts, _ := strings.Cut(field.Tag.Get("json"), ",")
+	// ToNative drops empty omitempty fields, so they need a null default.
+	for _, opt := range strings.Split(jsonOpts, ",") {
+		if opt == "omitempty" {
+			opts.nullable = true
+		}
+	}
+	tag, ok := field.Tag.Lookup("avro")
+	if !ok {
+		tag = jsonName
+	}
+	if tag == "-" {
+		return "", opts, true, nil
+	}
+	parts := strings.Split(tag, ",")
+	name = parts[0]
+	if name == "" {
+		name = field.Name
+	}
+	for _, opt := range parts[1:] {
+		key, value, _ := strings.Cut(opt, "=")
+		switch key {
+		case "nullable", "omitempty":
+			opts.nullable = true
+		case "logical":
+			opts.logical = value
+		case "precision", "scale":
+			n, convErr := strconv.Atoi(value)
+			if convErr != nil || n < 0 {
+				return "", opts, false, fmt.Errorf("field %s: invalid %s %q", field.Name, key, value)
+			}
+			if key == "precision" {
+				opts.precision = n
+			} else {
+				opts.scale, opts.scaleSet = n, true
+			}
+		default:
+			return "", opts, false, fmt.Errorf("field %s: unknown avro tag option %q", field.Name, opt)
+		}
+	}
+	return name, opts, false, nil
+}
+
+type schemaGenerator struct {
+	defined map[reflect.Type]string // types emitted so far, by Avro name
+	names   map[string]reflect.Type
+}
+
+// define reserves an Avro name for t, reporting whether t was already
+// defined and may be referenced by name.
+func (g *schemaGenerator) define(t reflect.Type, fallback string) (string, bool, error) {
+	if name, ok := g.defined[t]; ok {
+		return name, true, nil
+	}
+	name := t.Name()
+	if name == "" {
+		name = fallback
+	}
+	if other, ok := g.names[name]; ok && other != t {
+		return "", false, fmt.Errorf("avrojson: types %v and %v both map to Avro name %q", other, t, name)
+	}
+	g.defined[t] = name
+	g.names[name] = t
+	return name, false, nil
+}
+
+// typeSchema returns the schema of t. fallback names anonymous named types
+// (fixed arrays) after the field holding them.
+func (g *schemaGenerator) typeSchema(t reflect.Type, opts fieldOptions, fallback string) (interface{}, error) {
+	if opts.nullable || t.Kind() == reflect.Ptr {
+		inner := t
+		if t.Kind() == reflect.Ptr {
+			inner = t.Elem()
+		}
+		opts.nullable = false
+		schema, err := g.typeSchema(inner, opts, fallback)
+		if err != nil {
+			return nil, err
+		}
+		if union, ok := schema.([]interface{}); ok {
+			return union, nil
+		}
+		return []interface{}{"null", schema}, nil
+	}
+
+	if schema, ok := adaptedSchema(t); ok {
+		return schema, nil
+	}
+	switch t {
+	case timeType:
+		logical := opts.logical
+		if logical == "" {
+			logical = "timestamp-millis"
+		}
+		base := "long"
+		if logical == "date" || logical == "time-millis" {
+			base = "int"
+		}
+		return logicalSchema{Type: base, LogicalType: logical}, nil
+	case durationType:
+		return "long", nil
+	case rawMessageType:
+		return "string", nil
+	case ratType, bigIntType:
+		precision, scale := opts.precision, opts.scale
+		if precision == 0 {
+			precision = 38
+		}
+		if !opts.scaleSet && t == ratType {
+			scale = 9
+		}
+		if t == bigIntType && scale != 0 {
+			return nil, fmt.Errorf("avrojson: big.Int decimals have scale 0, not %d", scale)
+		}
+		if scale > precision {
+			return nil, fmt.Errorf("avrojson: decimal scale %d exceeds precision %d", scale, precision)
+		}
+		return decimalSchema{Type: "bytes", LogicalType: "decimal", Precision: precision, Scale: scale}, nil
+	}
+
+	if t.Implements(enumType) && t.Kind() == reflect.String {
+		name, seen, err := g.define(t, fallback)
+		if err != nil || seen {
+			return name, err
+		}
+		symbols := reflect.Zero(t).Interface().(AvroEnum).AvroSymbols()
+		if len(symbols) == 0 {
+			return nil, fmt.Errorf("avrojson: enum %v has no symbols", t)
+		}
+		return enumSchema{Type: "enum", Name: name, Symbols: symbols}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean", nil
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		return "int", nil
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return "long", nil
+	case reflect.Float32:
+		return "float", nil
+	case reflect.Float64:
+		return "double", nil
+	case reflect.String:
+		if opts.logical != "" {
+			return logicalSchema{Type: "string", LogicalType: opts.logical}, nil
+		}
+		return "string", nil
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "bytes", nil
+		}
+		items, err := g.typeSchema(t.Elem(), fieldOptions{}, fallback+"Item")
+		if err != nil {
+			return nil, err
+		}
+		return containerSchema{Type: "array", Items: items}, nil
+	case reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			name, seen, err := g.define(t, fallback)
+			if err != nil || seen {
+				return name, err
+			}
+			return fixedSchema{Type: "fixed", Name: name, Size: t.Len()}, nil
+		}
+		items, err := g.typeSchema(t.Elem(), fieldOptions{}, fallback+"Item")
+		if err != nil {
+			return nil, err
+		}
+		return containerSchema{Type: "array", Items: items}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("avrojson: map keys must be strings, got %v", t.Key())
+		}
+		values, err := g.typeSchema(t.Elem(), fieldOptions{}, fallback+"Value")
+		if err != nil {
+			return nil, err
+		}
+		return containerSchema{Type: "map", Values: values}, nil
+	case reflect.Struct:
+		name, seen, err := g.define(t, fallback)
+		if err != nil || seen {
+			return name, err
+		}
+		record := recordSchema{Type: "record", Name: name, Fields: []fieldSchema{}}
+		if err := g.addFields(&record, t); err != nil {
+			return nil, err
+		}
+		return record, nil
+	}
+	return nil, fmt.Errorf("avrojson: %v has no Avro equivalent", t)
+}
+
+func (g *schemaGenerator) addFields(record *recordSchema, t reflect.Type) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && field.Tag.Get("avro") == "" && field.Tag.Get("json") == "" {
+			if err := g.addFields(record, field.Type); err != nil {
+				return err
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		name, opts, skip, err := parseFieldTag(field)
+		if err != nil {
+			return err
+		}
+		if skip {
+			continue
+		}
+		schema, err := g.typeSchema(field.Type, opts, name)
+		if err != nil {
+			return fmt.Errorf("field %s.%s: %w", t.Name(), field.Name, err)
+		}
+		f := fieldSchema{Name: name, Type: schema}
+		if union, ok := schema.([]interface{}); ok && union[0] == "null" {
+			f.Default = json.RawMessage("null")
+		}
+		record.Fields = append(record.Fields, f)
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package avrojson
+
+import (
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+type testLevel string
+
+func (testLevel) AvroSymbols() []string { return []string{"DEBUG", "INFO"} }
+
+type testAudit struct {
+	Actor   string `json:"actor"`
+	Comment string `json:"comment,omitempty"`
+}
+
+type testNode struct {
+	Value int32     `avro:"value"`
+	Next  *testNode `avro:"next"`
+}
+
+type testEvent struct {
+	testAudit
+	ID        int64              `avro:"id"`
+	Level     testLevel          `avro:"level"`
+	Tags      []string           `json:"tags"`
+	Counters  map[string]float64 `json:"counters"`
+	Payload   []byte             `avro:"payload"`
+	Hash      [4]byte            `avro:"hash"`
+	At        time.Time          `avro:"at"`
+	Day       time.Time          `avro:"day,logical=date"`
+	Elapsed   time.Duration      `avro:"elapsed"`
+	Price     big.Rat            `avro:"price,precision=10,scale=2"`
+	Reviewer  *testAudit         `avro:"reviewer"`
+	Note      string             `avro:"note,nullable"`
+	RequestID string             `avro:"requestId,logical=uuid"`
+	Head      testNode           `avro:"head"`
+	Internal  string             `avro:"-"`
+	hidden    string
+}
+
+func TestSchemaOfStruct(t *testing.T) {
+	schema, err := SchemaOf(&testEvent{})
+	if err != nil {
+		t.Fatalf("Failed to generate schema: %v", err)
+	}
+
+	var record struct {
+		Name   string `json:"name"`
+		Fields []struct {
+			Name string          `json:"name"`
+			Type json.RawMessage `json:"type"`
+		} `json:"fields"`
+	}
+	var raw struct {
+		Fields []map[string]interface{} `json:"fields"`
+	}
+	if err := json.Unmarshal([]byte(schema), &record); err != nil {
+		t.Fatalf("Failed to parse schema: %v", err)
+	}
+	json.Unmarshal([]byte(schema), &raw)
+	if record.Name != "testEvent" {
+		t.Errorf("record should be named after the Go type, got %q", record.Name)
+	}
+
+	types := map[string]string{}
+	var order []string
+	for i, f := range record.Fields {
+		types[f.Name] = string(f.Type)
+		order = append(order, f.Name)
+		if _, hasDefault := raw.Fields[i]["default"]; strings.HasPrefix(string(f.Type), `["null"`) && !hasDefault {
+			t.Errorf("nullable field %s has no null default", f.Name)
+		}
+	}
+	want := map[string]string{
+		"actor":     `"string"`,
+		"id":        `"long"`,
+		"level":     `{"type":"enum","name":"testLevel","symbols":["DEBUG","INFO"]}`,
+		"tags":      `{"type":"array","items":"string"}`,
+		"counters":  `{"type":"map","values":"double"}`,
+		"payload":   `"bytes"`,
+		"hash":      `{"type":"fixed","name":"hash","size":4}`,
+		"at":        `{"type":"long","logicalType":"timestamp-millis"}`,
+		"day":       `{"type":"int","logicalType":"date"}`,
+		"elapsed":   `"long"`,
+		"price":     `{"type":"bytes","logicalType":"decimal","precision":10,"scale":2}`,
+		"reviewer":  `["null",{"type":"record","name":"testAudit","fields":[{"name":"actor","type":"string"},{"name":"comment","type":["null","string"],"default":null}]}]`,
+		"note":      `["null","string"]`,
+		"requestId": `{"type":"string","logicalType":"uuid"}`,
+		"head":      `{"type":"record","name":"testNode","fields":[{"name":"value","type":"int"},{"name":"next","type":["null","testNode"],"default":null}]}`,
+	}
+	for name, typ := range want {
+		if types[name] != typ {
+			t.Errorf("field %s: expected %s, got %s", name, typ, types[name])
+		}
+	}
+	if order[0] != "actor" || order[1] != "comment" || order[2] != "id" {
+		t.Errorf("embedded fields should be flattened in declaration order: %v", order)
+	}
+	for _, skipped := range []string{"Internal", "hidden"} {
+		if _, ok := types[skipped]; ok {
+			t.Errorf("field %s should be skipped", skipped)
+		}
+	}
+}
+
+type testProfile struct {
+	Name     string            `json:"name"`
+	Nick     *string           `json:"nick"`
+	Age      *int32            `json:"age"`
+	Tags     map[string]string `json:"tags,omitempty"`
+	Manager  *testAudit        `json:"manager"`
+	Previous []*string         `json:"previous"`
+}
+
+func TestSchemaOfNullableFieldsRoundTrip(t *testing.T) {
+	schema, err := SchemaOf(testProfile{})
+	if err != nil {
+		t.Fatalf("Failed to generate schema: %v", err)
+	}
+	if !strings.Contains(schema, `{"name":"tags","type":["null",{"type":"map","values":"string"}],"default":null}`) {
+		t.Errorf("expected the omitempty map to be nullable: %s", schema)
+	}
+	codec, err := NewCodec(schema)
+	if err != nil {
+		t.Fatalf("Failed to create codec: %v", err)
+	}
+
+	nick, age, old := "ann", int32(30), "a"
+	full := testProfile{
+		Name:     "Ann",
+		Nick:     &nick,
+		Age:      &age,
+		Tags:     map[string]string{"team": "core"},
+		Manager:  &testAudit{Actor: "bob", Comment: "lead"},
+		Previous: []*string{&old, nil},
+	}
+	for _, in := range []testProfile{full, {Name: "Empty", Previous: []*string{}}} {
+		data, err := codec.Encode(in)
+		if err != nil {
+			t.Fatalf("Failed to encode %s: %v", in.Name, err)
+		}
+		var out testProfile
+		if err := codec.Decode(data, &out); err != nil {
+			t.Fatalf("Failed to decode %s: %v", in.Name, err)
+		}
+		got, _ := json.Marshal(out)
+		want, _ := json.Marshal(in)
+		if string(got) != string(want) {
+			t.Errorf("round trip mismatch:\n got %s\nwant %s", got, want)
+		}
+	}
+
+	// Decoding into a map keeps goavro's union form.
+	data, _ := codec.Encode(full)
+	var native map[string]interface{}
+	if err := codec.Decode(data, &native); err != nil {
+		t.Fatalf("Failed to decode into a map: %v", err)
+	}
+	if nick, ok := native["nick"].(map[string]interface{}); !ok || nick["string"] != "ann" {
+		t.Errorf("expected the union form in a map, got %v", native["nick"])
+	}
+}
+
+func TestSchemaOfMatchesBuiltinWrapper(t *testing.T) {
+	schema, err := SchemaOf(LogWrapper{})
+	if err != nil {
+		t.Fatalf("Failed to generate schema: %v", err)
+	}
+	generated, _ := goavro.NewCodec(schema)
+	builtin, _ := goavro.NewCodec(WrapperSchema)
+	if generated.CanonicalSchema() != builtin.CanonicalSchema() {
+		t.Errorf("generated schema %s differs from the built-in %s", generated.CanonicalSchema(), builtin.CanonicalSchema())
+	}
+}
+
+func TestSchemaOfRejectsUnsupportedTypes(t *testing.T) {
+	cases := map[string]interface{}{
+		"not a struct": 42,
+		"interface":    struct{ Any interface{} }{},
+		"int map key":  struct{ M map[int]string }{},
+		"unknown option": struct {
+			A string `avro:"a,sorted"`
+		}{},
+		"bad decimal": struct {
+			P big.Rat `avro:"p,precision=2,scale=3"`
+		}{},
+	}
+	for name, v := range cases {
+		if _, err := SchemaOf(v); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	// LogData's interface fields need the hand-written schema.
+	if _, err := SchemaOf(LogData{}); err == nil {
+		t.Error("expected LogData's interface fields to be rejected")
+	}
+}
@@ -0,0 +1,732 @@
+package avrojson
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// goavro decodes with the writer schema only, so schema evolution is done
+// here: a datum is decoded with the schema it was written with and its
+// native value is then projected onto the reader schema following the Avro
+// resolution rules. Reader fields missing from the writer take their
+// defaults, writer fields unknown to the reader are dropped, names match
+// through reader aliases, numbers are promoted (int → long → float →
+// double) and string and bytes convert into each other.
+
+// Resolver decodes data written with one schema into the shape of another.
+// It is safe for concurrent use.
+type Resolver struct {
+	writer       *Codec
+	reader       *Codec
+	writerSchema *schemaNode
+	readerSchema *schemaNode
+}
+
+// NewResolver compiles both schemas and checks that data written with
+// writerSchema can be read with readerSchema.
+func NewResolver(writerSchema, readerSchema string) (*Resolver, error) {
+	return DefaultCache.Resolver(writerSchema, readerSchema)
+}
+
+func newResolver(writer, reader *Codec) (*Resolver, error) {
+	w, err := writer.typeTree()
+	if err != nil {
+		return nil, fmt.Errorf("writer schema: %w", err)
+	}
+	r, err := reader.typeTree()
+	if err != nil {
+		return nil, fmt.Errorf("reader schema: %w", err)
+	}
+	if err := checkResolvable(w, r, "", make(map[[2]*schemaNode]bool)); err != nil {
+		return nil, err
+	}
+	return &Resolver{writer: writer, reader: reader, writerSchema: w, readerSchema: r}, nil
+}
+
+// Reader returns the codec of the reader schema, e.g. for StripUnions.
+func (r *Resolver) Reader() *Codec { return r.reader }
+
+// Decode reads one datum written with the writer schema and returns it as a
+// native value of the reader schema.
+func (r *Resolver) Decode(data []byte) (interface{}, error) {
+	native, err := r.writer.nativeFromBinary(data)
+	if err != nil {
+		return nil, err
+	}
+	return r.Resolve(native)
+}
+
+// Resolve converts a native value of the writer schema to the reader schema.
+func (r *Resolver) Resolve(native interface{}) (interface{}, error) {
+	return resolveValue(r.writerSchema, r.readerSchema, native, "")
+}
+
+// Reencode decodes data with the writer schema and encodes it again with the
+// reader schema, upgrading stored binaries.
+func (r *Resolver) Reencode(data []byte) ([]byte, error) {
+	native, err := r.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	return r.reader.binaryFromNative(native)
+}
+
+// schemaNode is a typed tree of a parsedSchema, with references resolved
+// to their definitions. Unlike the canonical form it keeps defaults,
+// aliases and logical types.
+type schemaNode struct {
+	kind    string // primitive name, record, enum, fixed, array, map or union
+	name    string // full name of named types
+	aliases []string
+	logical string
+	scale   int
+
+	fields      []schemaField
+	symbols     []string
+	enumDefault string
+	size        int
+	items       *schemaNode // array items and map values
+	branches    []*schemaNode
+}
+
+type schemaField struct {
+	name       string
+	aliases    []string
+	node       *schemaNode
+	def        interface{}
+	hasDefault bool
+}
+
+// typeTree returns the codec's schema as a tree, built from its parsed
+// schema on first use. The tree is shared, so it is never modified.
+func (c *Codec) typeTree() (*schemaNode, error) {
+	c.tree.once.Do(func() {
+		s, err := c.schemaTree()
+		if err != nil {
+			c.tree.err = err
+			return
+		}
+		p := &treeParser{schema: s, named: make(map[string]*schemaNode)}
+		c.tree.root, c.tree.err = p.parse(s.root)
+	})
+	return c.tree.root, c.tree.err
+}
+
+type treeParser struct {
+	schema *parsedSchema
+	named  map[string]*schemaNode
+}
+
+func (p *treeParser) parse(v interface{}) (*schemaNode, error) {
+	switch s := v.(type) {
+	case string:
+		if primitiveTypes[s] {
+			return &schemaNode{kind: s}, nil
+		}
+		if n, ok := p.named[s]; ok {
+			return n, nil
+		}
+		if def, ok := p.schema.named[s]; ok {
+			return p.parse(def)
+		}
+		return nil, fmt.Errorf("unknown type %q", s)
+
+	case []interface{}:
+		n := &schemaNode{kind: "union"}
+		for _, b := range s {
+			branch, err := p.parse(b)
+			if err != nil {
+				return nil, err
+			}
+			n.branches = append(n.branches, branch)
+		}
+		return n, nil
+
+	case map[string]interface{}:
+		t, _ := s["type"].(string)
+		logical, _ := s["logicalType"].(string)
+		switch t {
+		case "record", "error", "enum", "fixed":
+			return p.parseNamed(s, t, logical)
+		case "array":
+			items, err := p.parse(s["items"])
+			if err != nil {
+				return nil, err
+			}
+			return &schemaNode{kind: "array", items: items}, nil
+		case "map":
+			values, err := p.parse(s["values"])
+			if err != nil {
+				return nil, err
+			}
+			return &schemaNode{kind: "map", items: values}, nil
+		}
+		n, err := p.parse(t)
+		if err != nil {
+			return nil, err
+		}
+		if logical == "" || !primitiveTypes[t] {
+			return n, nil
+		}
+		scale, _ := s["scale"].(float64)
+		return &schemaNode{kind: t, logical: logical, scale: int(scale)}, nil
+	}
+	return nil, fmt.Errorf("unsupported schema node %v", v)
+}
+
+// parseNamed parses s, a named type of the parsed schema, so its name is
+// already full.
+func (p *treeParser) parseNamed(s map[string]interface{}, kind, logical string) (*schemaNode, error) {
+	name, _ := s["name"].(string)
+	if n, ok := p.named[name]; ok {
+		return n, nil
+	}
+	n := &schemaNode{kind: kind, name: name, logical: logical}
+	namespace := namespaceOf(name)
+	if aliases, ok := s["aliases"].([]interface{}); ok {
+		for _, a := range aliases {
+			if alias, ok := a.(string); ok {
+				n.aliases = append(n.aliases, fullName(alias, namespace))
+			}
+		}
+	}
+	// Register before parsing fields so recursive references resolve.
+	p.named[n.name] = n
+
+	switch kind {
+	case "enum":
+		for _, sym := range s["symbols"].([]interface{}) {
+			n.symbols = append(n.symbols, sym.(string))
+		}
+		n.enumDefault, _ = s["default"].(string)
+	case "fixed":
+		size, _ := s["size"].(float64)
+		n.size = int(size)
+		scale, _ := s["scale"].(float64)
+		n.scale = int(scale)
+	default:
+		fields, _ := s["fields"].([]interface{})
+		for _, f := range fields {
+			field, _ := f.(map[string]interface{})
+			name, _ := field["name"].(string)
+			node, err := p.parse(field["type"])
+			if err != nil {
+				return nil, fmt.Errorf("field %q: %w", name, err)
+			}
+			sf := schemaField{name: name, node: node}
+			sf.def, sf.hasDefault = field["default"]
+			if aliases, ok := field["aliases"].([]interface{}); ok {
+				for _, a := range aliases {
+					if alias, ok := a.(string); ok {
+						sf.aliases = append(sf.aliases, alias)
+					}
+				}
+			}
+			n.fields = append(n.fields, sf)
+		}
+	}
+	return n, nil
+}
+
+// unionKey is the key goavro uses for a union branch holding node.
+func (n *schemaNode) unionKey() string {
+	if n.name != "" {
+		return n.name
+	}
+	if n.logical != "" && primitiveTypes[n.kind] {
+		return n.kind + "." + n.logical
+	}
+	return n.kind
+}
+
+// matchesName reports whether reader type r accepts writer type w by name:
+// either the full names are equal or w's name is one of r's aliases.
+func (r *schemaNode) matchesName(w *schemaNode) bool {
+	if r.name == w.name {
+		return true
+	}
+	for _, alias := range r.aliases {
+		if alias == w.name {
+			return true
+		}
+	}
+	return false
+}
+
+// promotable lists the writer primitives each reader primitive accepts.
+var promotable = map[string][]string{
+	"long":   {"int"},
+	"float":  {"int", "long"},
+	"double": {"int", "long", "float"},
+	"string": {"bytes"},
+	"bytes":  {"string"},
+}
+
+// matches reports whether a writer type can be read as reader type r,
+// without looking inside records, arrays or maps.
+func (r *schemaNode) matches(w *schemaNode) bool {
+	if r.kind == "union" || w.kind == "union" {
+		return false
+	}
+	if r.kind == w.kind {
+		switch r.kind {
+		case "record", "error", "enum":
+			return r.matchesName(w)
+		case "fixed":
+			return r.matchesName(w) && r.size == w.size
+		}
+		return true
+	}
+	for _, k := range promotable[r.kind] {
+		if k == w.kind {
+			return true
+		}
+	}
+	return false
+}
+
+// readerBranch returns the first branch of reader union r that can read
+// writer type w.
+func (r *schemaNode) readerBranch(w *schemaNode) *schemaNode {
+	for _, b := range r.branches {
+		if b.kind == w.kind && b.matches(w) {
+			return b
+		}
+	}
+	for _, b := range r.branches {
+		if b.matches(w) {
+			return b
+		}
+	}
+	return nil
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func resolveError(path, format string, args ...interface{}) error {
+	if path == "" {
+		path = "<root>"
+	}
+	return fmt.Errorf("cannot resolve %s: %s", path, fmt.Sprintf(format, args...))
+}
+
+// checkResolvable verifies statically that every datum of w can be read
+// as r, reporting the first reason it cannot. seen breaks cycles through
+// recursive types.
+func checkResolvable(w, r *schemaNode, path string, seen map[[2]*schemaNode]bool) error {
+	c := &resolvabilityCheck{seen: seen}
+	c.check(w, r, path)
+	if len(c.issues) == 0 {
+		return nil
+	}
+	return resolveError(c.issues[0].Path, "%s", c.issues[0].Message)
+}
+
+// resolvabilityCheck collects every reason data of a writer schema cannot
+// be read with a reader schema. strict requires each writer union branch
+// to be readable instead of at least one, for compatibility gates that must
+// not accept a schema only some data resolves into.
+type resolvabilityCheck struct {
+	strict bool
+	seen   map[[2]*schemaNode]bool
+	issues []Incompatibility
+}
+
+func (c *resolvabilityCheck) fail(path string, w, r *schemaNode, format string, args ...interface{}) {
+	issue := Incompatibility{Path: path, ReaderType: r.unionKey(), Message: fmt.Sprintf(format, args...)}
+	if w != nil {
+		issue.WriterType = w.unionKey()
+	}
+	c.issues = append(c.issues, issue)
+}
+
+func (c *resolvabilityCheck) check(w, r *schemaNode, path string) {
+	if c.seen[[2]*schemaNode{w, r}] {
+		return
+	}
+	c.seen[[2]*schemaNode{w, r}] = true
+
+	if w.kind == "union" {
+		// Every writer branch must be readable. Branches that are not
+		// (e.g. a removed null) only fail for data actually using them,
+		// which the spec allows, but at least one must resolve.
+		before := len(c.issues)
+		readable := 0
+		for _, b := range w.branches {
+			n := len(c.issues)
+			c.check(b, r, path)
+			if len(c.issues) == n {
+				readable++
+			}
+		}
+		if readable > 0 && !c.strict {
+			c.issues = c.issues[:before]
+		}
+		return
+	}
+	if r.kind == "union" {
+		b := r.readerBranch(w)
+		if b == nil {
+			c.fail(path, w, r, "no branch of the reader union accepts %s", w.unionKey())
+			return
+		}
+		c.check(w, b, path)
+		return
+	}
+	if !r.matches(w) {
+		c.fail(path, w, r, "writer type %s does not match reader type %s", w.unionKey(), r.unionKey())
+		return
+	}
+
+	switch r.kind {
+	case "record", "error":
+		for _, rf := range r.fields {
+			wf := writerField(w, rf)
+			if wf == nil {
+				if !rf.hasDefault {
+					c.fail(joinPath(path, rf.name), nil, rf.node, "field is missing from the writer schema and has no default")
+				}
+				continue
+			}
+			c.check(wf.node, rf.node, joinPath(path, rf.name))
+		}
+	case "enum":
+		if r.enumDefault != "" {
+			return
+		}
+		for _, sym := range w.symbols {
+			if indexOf(r.symbols, sym) < 0 {
+				c.fail(path, w, r, "enum symbol %q is unknown to the reader and it has no default", sym)
+			}
+		}
+	case "array", "map":
+		c.check(w.items, r.items, joinPath(path, "[]"))
+		return
+	}
+	if r.logical == "decimal" && w.logical == "decimal" && r.scale != w.scale {
+		c.fail(path, w, r, "decimal scale changed from %d to %d", w.scale, r.scale)
+	}
+}
+
+// writerField finds the writer field read by reader field rf, by name or
+// by one of rf's aliases.
+func writerField(w *schemaNode, rf schemaField) *schemaField {
+	for i := range w.fields {
+		if w.fields[i].name == rf.name {
+			return &w.fields[i]
+		}
+	}
+	for _, alias := range rf.aliases {
+		for i := range w.fields {
+			if w.fields[i].name == alias {
+				return &w.fields[i]
+			}
+		}
+	}
+	return nil
+}
+
+func indexOf(list []string, s string) int {
+	for i, v := range list {
+		if v == s {
+			return i
+		}
+	}
+	return -1
+}
+
+func resolveValue(w, r *schemaNode, v interface{}, path string) (interface{}, error) {
+	if w.kind == "union" {
+		if v == nil {
+			for _, b := range w.branches {
+				if b.kind == "null" {
+					return resolveValue(b, r, nil, path)
+				}
+			}
+			return nil, resolveError(path, "null value for a union without a null branch")
+		}
+		wrapped, ok := v.(map[string]interface{})
+		if !ok || len(wrapped) != 1 {
+			return nil, resolveError(path, "expected a union value, got %T", v)
+		}
+		for key, inner := range wrapped {
+			for _, b := range w.branches {
+				if b.unionKey() == key {
+					return resolveValue(b, r, inner, path)
+				}
+			}
+			return nil, resolveError(path, "union branch %q is not in the writer schema", key)
+		}
+	}
+	if r.kind == "union" {
+		b := r.readerBranch(w)
+		if b == nil {
+			return nil, resolveError(path, "no branch of the reader union accepts %s", w.unionKey())
+		}
+		resolved, err := resolveValue(w, b, v, path)
+		if err != nil || b.kind == "null" {
+			return nil, err
+		}
+		return map[string]interface{}{b.unionKey(): resolved}, nil
+	}
+	if !r.matches(w) {
+		return nil, resolveError(path, "writer type %s does not match reader type %s", w.unionKey(), r.unionKey())
+	}
+
+	switch r.kind {
+	case "record", "error":
+		rec, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, resolveError(path, "expected a record, got %T", v)
+		}
+		out := make(map[string]interface{}, len(r.fields))
+		for _, rf := range r.fields {
+			fieldPath := joinPath(path, rf.name)
+			if wf := writerField(w, rf); wf != nil {
+				val, err := resolveValue(wf.node, rf.node, rec[wf.name], fieldPath)
+				if err != nil {
+					return nil, err
+				}
+				out[rf.name] = val
+				continue
+			}
+			if !rf.hasDefault {
+				return nil, resolveError(fieldPath, "field is missing from the writer schema and has no default")
+			}
+			val, err := defaultValue(rf.node, rf.def, fieldPath)
+			if err != nil {
+				return nil, err
+			}
+			out[rf.name] = val
+		}
+		return out, nil
+
+	case "enum":
+		sym, ok := v.(string)
+		if !ok {
+			return nil, resolveError(path, "expected an enum symbol, got %T", v)
+		}
+		if indexOf(r.symbols, sym) >= 0 {
+			return sym, nil
+		}
+		if r.enumDefault != "" {
+			return r.enumDefault, nil
+		}
+		return nil, resolveError(path, "enum symbol %q is unknown to the reader and it has no default", sym)
+
+	case "array":
+		items, ok := v.([]interface{})
+		if !ok {
+			return nil, resolveError(path, "expected an array, got %T", v)
+		}
+		out := make([]interface{}, len(items))
+		for i, item := range items {
+			val, err := resolveValue(w.items, r.items, item, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			out[i] = val
+		}
+		return out, nil
+
+	case "map":
+		values, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, resolveError(path, "expected a map, got %T", v)
+		}
+		out := make(map[string]interface{}, len(values))
+		for k, val := range values {
+			resolved, err := resolveValue(w.items, r.items, val, joinPath(path, k))
+			if err != nil {
+				return nil, err
+			}
+			out[k] = resolved
+		}
+		return out, nil
+	}
+	return resolvePrimitive(w, r, v, path)
+}
+
+// resolvePrimitive promotes a primitive value and converts between logical
+// types sharing an underlying type.
+func resolvePrimitive(w, r *schemaNode, v interface{}, path string) (interface{}, error) {
+	if w.logical == r.logical && w.kind == r.kind {
+		if r.logical == "decimal" && w.scale != r.scale {
+			return nil, resolveError(path, "decimal scale changed from %d to %d", w.scale, r.scale)
+		}
+		return v, nil
+	}
+	if w.logical == "decimal" || r.logical == "decimal" {
+		return nil, resolveError(path, "cannot convert between decimal and non-decimal %s", r.kind)
+	}
+
+	// Timestamps keep their instant and times their duration across
+	// precision changes. Otherwise, since goavro accepts plain numbers for
+	// every time logical type, values are lowered to the writer's
+	// underlying number before promotion.
+	switch v.(type) {
+	case time.Time:
+		if isTimestamp(r.logical) {
+			return v, nil
+		}
+	case time.Duration:
+		if r.logical == "time-millis" || r.logical == "time-micros" {
+			return v, nil
+		}
+	}
+	switch val := v.(type) {
+	case time.Time:
+		switch w.logical {
+		case "date":
+			v = int32(val.Unix() / 86400)
+		case "timestamp-micros", "local-timestamp-micros":
+			v = val.UnixMicro()
+		default:
+			v = val.UnixMilli()
+		}
+	case time.Duration:
+		if w.logical == "time-micros" {
+			v = val.Microseconds()
+		} else {
+			v = int32(val.Milliseconds())
+		}
+	}
+
+	switch r.kind {
+	case "long":
+		if n, ok := v.(int32); ok {
+			return int64(n), nil
+		}
+	case "float":
+		switch n := v.(type) {
+		case int32:
+			return float32(n), nil
+		case int64:
+			return float32(n), nil
+		}
+	case "double":
+		switch n := v.(type) {
+		case int32:
+			return float64(n), nil
+		case int64:
+			return float64(n), nil
+		case float32:
+			return float64(n), nil
+		}
+	case "string":
+		if b, ok := v.([]byte); ok {
+			return string(b), nil
+		}
+	case "bytes":
+		if s, ok := v.(string); ok {
+			return []byte(s), nil
+		}
+	}
+	return v, nil
+}
+
+func isTimestamp(logical string) bool {
+	switch logical {
+	case "timestamp-millis", "timestamp-micros", "local-timestamp-millis", "local-timestamp-micros":
+		return true
+	}
+	return false
+}
+
+// defaultValue converts a field default from its JSON encoding to the
+// native form goavro expects for node.
+func defaultValue(node *schemaNode, def interface{}, path string) (interface{}, error) {
+	switch node.kind {
+	case "union":
+		// Defaults of union fields belong to the first branch.
+		first := node.branches[0]
+		val, err := defaultValue(first, def, path)
+		if err != nil || first.kind == "null" {
+			return nil, err
+		}
+		return map[string]interface{}{first.unionKey(): val}, nil
+	case "null":
+		return nil, nil
+	case "boolean", "string", "enum":
+		return def, nil
+	case "int", "long", "float", "double":
+		n, ok := def.(float64)
+		if !ok {
+			return nil, resolveError(path, "default %v is not a number", def)
+		}
+		switch node.kind {
+		case "int":
+			return int32(n), nil
+		case "long":
+			return int64(n), nil
+		case "float":
+			return float32(n), nil
+		}
+		return n, nil
+	case "bytes", "fixed":
+		s, ok := def.(string)
+		if !ok {
+			return nil, resolveError(path, "default %v is not a string", def)
+		}
+		b := make([]byte, 0, len(s))
+		for _, r := range s {
+			b = append(b, byte(r))
+		}
+		if node.logical == "decimal" {
+			unscaled := new(big.Int).SetBytes(b)
+			if len(b) > 0 && b[0]&0x80 != 0 {
+				unscaled.Sub(unscaled, new(big.Int).Lsh(big.NewInt(1), uint(len(b)*8)))
+			}
+			denom := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(node.scale)), nil)
+			return new(big.Rat).SetFrac(unscaled, denom), nil
+		}
+		return b, nil
+	case "array":
+		items, _ := def.([]interface{})
+		out := make([]interface{}, len(items))
+		for i, item := range items {
+			val, err := defaultValue(node.items, item, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			out[i] = val
+		}
+		return out, nil
+	case "map":
+		values, _ := def.(map[string]interface{})
+		out := make(map[string]interface{}, len(values))
+		for k, val := range values {
+			resolved, err := defaultValue(node.items, val, joinPath(path, k))
+			if err != nil {
+				return nil, err
+			}
+			out[k] = resolved
+		}
+		return out, nil
+	case "record", "error":
+		obj, _ := def.(map[string]interface{})
+		out := make(map[string]interface{}, len(node.fields))
+		for _, f := range node.fields {
+			val, ok := obj[f.name]
+			if !ok {
+				if !f.hasDefault {
+					return nil, resolveError(joinPath(path, f.name), "record default lacks the field and it has no default")
+				}
+				val = f.def
+			}
+			resolved, err := defaultValue(f.node, val, joinPath(path, f.name))
+			if err != nil {
+				return nil, err
+			}
+			out[f.name] = resolved
+		}
+		return out, nil
+	}
+	return nil, resolveError(path, "unsupported default for %s", node.kind)
+}
@@ -0,0 +1,146 @@
+package avrojson
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const userV1 = `{"type":"record","name":"User","namespace":"exp","fields":[
+	{"name":"id","type":"int"},
+	{"name":"fullName","type":"string"},
+	{"name":"status","type":{"type":"enum","name":"Status","symbols":["ACTIVE","BANNED","PENDING"]}},
+	{"name":"legacy","type":"string"},
+	{"name":"seenAt","type":{"type":"long","logicalType":"timestamp-millis"}},
+	{"name":"tags","type":{"type":"array","items":"string"}}
+]}`
+
+const userV2 = `{"type":"record","name":"Account","namespace":"exp","aliases":["User"],"fields":[
+	{"name":"id","type":"long"},
+	{"name":"name","type":"string","aliases":["fullName"]},
+	{"name":"status","type":{"type":"enum","name":"Status","symbols":["ACTIVE","BANNED"],"default":"ACTIVE"}},
+	{"name":"seenAt","type":{"type":"long","logicalType":"timestamp-micros"}},
+	{"name":"tags","type":{"type":"array","items":"bytes"}},
+	{"name":"score","type":"double","default":1.5},
+	{"name":"nickname","type":["null","string"],"default":null},
+	{"name":"address","type":{"type":"record","name":"Address","fields":[
+		{"name":"city","type":"string","default":"Seoul"},
+		{"name":"zip","type":"string"}
+	]},"default":{"zip":"00000"}}
+]}`
+
+func TestResolverEvolvesRecord(t *testing.T) {
+	writer, err := NewCodec(userV1)
+	if err != nil {
+		t.Fatalf("Failed to create codec: %v", err)
+	}
+	seenAt := time.UnixMilli(1700000000123).UTC()
+	data, err := writer.binaryFromNative(map[string]interface{}{
+		"id": int32(7), "fullName": "Hong Gildong", "status": "PENDING", "legacy": "dropped",
+		"seenAt": seenAt, "tags": []interface{}{"a"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+
+	resolver, err := NewResolver(userV1, userV2)
+	if err != nil {
+		t.Fatalf("Failed to create resolver: %v", err)
+	}
+	native, err := resolver.Decode(data)
+	if err != nil {
+		t.Fatalf("Failed to resolve: %v", err)
+	}
+	rec := native.(map[string]interface{})
+
+	if rec["id"] != int64(7) {
+		t.Errorf("id not promoted to long: %#v", rec["id"])
+	}
+	if rec["name"] != "Hong Gildong" {
+		t.Errorf("aliased field not read: %#v", rec["name"])
+	}
+	if rec["status"] != "ACTIVE" {
+		t.Errorf("unknown enum symbol should fall back to the default: %#v", rec["status"])
+	}
+	if _, ok := rec["legacy"]; ok {
+		t.Errorf("field removed from the reader was kept")
+	}
+	if !rec["seenAt"].(time.Time).Equal(seenAt) {
+		t.Errorf("timestamp changed across precision: %v", rec["seenAt"])
+	}
+	if tags := rec["tags"].([]interface{}); string(tags[0].([]byte)) != "a" {
+		t.Errorf("string not converted to bytes: %#v", tags)
+	}
+	if rec["score"] != 1.5 || rec["nickname"] != nil {
+		t.Errorf("defaults not applied: %#v %#v", rec["score"], rec["nickname"])
+	}
+	address := rec["address"].(map[string]interface{})
+	if address["city"] != "Seoul" || address["zip"] != "00000" {
+		t.Errorf("record default not applied: %#v", address)
+	}
+
+	// The resolved value is valid for the reader schema.
+	upgraded, err := resolver.Reencode(data)
+	if err != nil {
+		t.Fatalf("Failed to re-encode with the reader schema: %v", err)
+	}
+	if _, err := resolver.Reader().DecodeNative(upgraded); err != nil {
+		t.Errorf("re-encoded datum does not decode: %v", err)
+	}
+}
+
+func TestResolverUnions(t *testing.T) {
+	writerSchema := `{"type":"record","name":"E","fields":[
+		{"name":"a","type":["null","int"]},
+		{"name":"b","type":"int"},
+		{"name":"c","type":["null","string"]}
+	]}`
+	readerSchema := `{"type":"record","name":"E","fields":[
+		{"name":"a","type":["null","double"]},
+		{"name":"b","type":["null","long"]},
+		{"name":"c","type":"string"}
+	]}`
+	writer, _ := NewCodec(writerSchema)
+	resolver, err := NewResolver(writerSchema, readerSchema)
+	if err != nil {
+		t.Fatalf("Failed to create resolver: %v", err)
+	}
+
+	data, _ := writer.binaryFromNative(map[string]interface{}{
+		"a": map[string]interface{}{"int": int32(2)}, "b": int32(3), "c": map[string]interface{}{"string": "x"},
+	})
+	native, err := resolver.Decode(data)
+	if err != nil {
+		t.Fatalf("Failed to resolve: %v", err)
+	}
+	rec := native.(map[string]interface{})
+	if rec["a"].(map[string]interface{})["double"] != float64(2) {
+		t.Errorf("union branch not promoted: %#v", rec["a"])
+	}
+	if rec["b"].(map[string]interface{})["long"] != int64(3) {
+		t.Errorf("value not wrapped into the reader union: %#v", rec["b"])
+	}
+	if rec["c"] != "x" {
+		t.Errorf("union not unwrapped for a non-union reader: %#v", rec["c"])
+	}
+
+	// Writer data using the null branch cannot be read as a plain string.
+	data, _ = writer.binaryFromNative(map[string]interface{}{"a": nil, "b": int32(0), "c": nil})
+	if _, err := resolver.Decode(data); err == nil || !strings.Contains(err.Error(), "c") {
+		t.Errorf("expected an error naming field c, got %v", err)
+	}
+}
+
+func TestResolverRejectsIncompatibleSchemas(t *testing.T) {
+	cases := map[string]string{
+		"missing default": `{"type":"record","name":"User","namespace":"exp","fields":[{"name":"id","type":"int"},{"name":"email","type":"string"}]}`,
+		"narrowing":       `{"type":"record","name":"User","namespace":"exp","fields":[{"name":"id","type":"string"}]}`,
+		"renamed record":  `{"type":"record","name":"Other","namespace":"exp","fields":[{"name":"id","type":"int"}]}`,
+		"enum symbol":     `{"type":"record","name":"User","namespace":"exp","fields":[{"name":"status","type":{"type":"enum","name":"Status","symbols":["ACTIVE"]}}]}`,
+	}
+	for name, reader := range cases {
+		if _, err := NewResolver(userV1, reader); err == nil {
+			t.Errorf("%s: expected the reader schema to be rejected", name)
+		}
+	}
+}
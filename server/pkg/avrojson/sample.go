@@ -0,0 +1,389 @@
+package avrojson
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/brianvoe/gofakeit/v6"
+)
+
+// maxSampleDepth is the depth past which samples take null branches and
+// empty collections, so recursive schemas terminate.
+const maxSampleDepth = 8
+
+// Sample timestamps fall in a fixed range, so a seed always gives the same
+// datum.
+var (
+	sampleTimeStart = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	sampleTimeEnd   = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// Sample returns a random native datum for the codec's schema, with values
+// chosen from field names where they suggest one: "email" fields get email
+// addresses, "userId" a UUID, "createdAt" a timestamp and so on. The same
+// seed gives the same datum; seed 0 picks one at random.
+func (c *Codec) Sample(seed int64) (interface{}, error) {
+	s, err := c.schemaTree()
+	if err != nil {
+		return nil, err
+	}
+	g := &sampler{schema: s, faker: gofakeit.New(seed)}
+	return g.value(s.root, nil, 0)
+}
+
+type sampler struct {
+	schema *parsedSchema
+	faker  *gofakeit.Faker
+}
+
+// value generates a datum for node; name holds the words of the enclosing
+// field's name.
+func (g *sampler) value(node interface{}, name []string, depth int) (interface{}, error) {
+	f := g.faker
+	switch n := node.(type) {
+	case string:
+		switch n {
+		case "null":
+			return nil, nil
+		case "boolean":
+			return f.Bool(), nil
+		case "int":
+			return int32(g.integer(name, 1000)), nil
+		case "long":
+			if hasWord(name, timeWords...) {
+				return f.DateRange(sampleTimeStart, sampleTimeEnd).UnixMilli(), nil
+			}
+			return g.integer(name, 1000000), nil
+		case "float":
+			return float32(g.real(name)), nil
+		case "double":
+			return g.real(name), nil
+		case "bytes":
+			return []byte(f.LetterN(uint(f.Number(4, 16)))), nil
+		case "string":
+			return g.text(name), nil
+		}
+		def, ok := g.schema.named[n]
+		if !ok {
+			return nil, fmt.Errorf("unknown type %q", n)
+		}
+		return g.value(def, name, depth+1)
+
+	case []interface{}:
+		if len(n) == 0 {
+			return nil, fmt.Errorf("empty union")
+		}
+		var branches []interface{}
+		for _, branch := range n {
+			if branch != "null" {
+				branches = append(branches, branch)
+			}
+		}
+		// Nullable values are mostly set, which makes for a more useful
+		// sample, but stop at the null branch once nesting gets deep.
+		if len(branches) < len(n) && (len(branches) == 0 || depth >= maxSampleDepth || f.Number(1, 5) == 1) {
+			return nil, nil
+		}
+		branch := branches[f.Number(0, len(branches)-1)]
+		inner, err := g.value(branch, name, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{branchName(branch): inner}, nil
+
+	case map[string]interface{}:
+		t, _ := n["type"].(string)
+		if logical, ok := n["logicalType"].(string); ok {
+			if logical == "uuid" && t == "string" {
+				return f.UUID(), nil
+			}
+			if goavroLogicalNames[t+"."+logical] {
+				return g.logical(logical, n)
+			}
+		}
+
+		switch t {
+		case "record", "error":
+			record := make(map[string]interface{})
+			fields, _ := n["fields"].([]interface{})
+			for _, fl := range fields {
+				field, _ := fl.(map[string]interface{})
+				fieldName, _ := field["name"].(string)
+				v, err := g.value(field["type"], nameWords(fieldName), depth+1)
+				if err != nil {
+					return nil, fmt.Errorf("field %q: %w", fieldName, err)
+				}
+				record[fieldName] = v
+			}
+			return record, nil
+		case "enum":
+			symbols, _ := n["symbols"].([]interface{})
+			if len(symbols) == 0 {
+				return nil, fmt.Errorf("enum %q has no symbols", n["name"])
+			}
+			return symbols[f.Number(0, len(symbols)-1)], nil
+		case "fixed":
+			size, _ := n["size"].(float64)
+			out := make([]byte, int(size))
+			f.Rand.Read(out)
+			return out, nil
+		case "array":
+			items := make([]interface{}, g.length(depth))
+			for i := range items {
+				v, err := g.value(n["items"], name, depth+1)
+				if err != nil {
+					return nil, err
+				}
+				items[i] = v
+			}
+			return items, nil
+		case "map":
+			values := make(map[string]interface{})
+			for i := g.length(depth); i > 0; i-- {
+				v, err := g.value(n["values"], name, depth+1)
+				if err != nil {
+					return nil, err
+				}
+				values[f.Noun()] = v
+			}
+			return values, nil
+		}
+		return g.value(t, name, depth+1)
+	}
+	return nil, fmt.Errorf("unsupported schema node %v", node)
+}
+
+// length picks a collection size: one to three entries, none once nesting
+// gets deep.
+func (g *sampler) length(depth int) int {
+	if depth >= maxSampleDepth {
+		return 0
+	}
+	return g.faker.Number(1, 3)
+}
+
+func (g *sampler) logical(logical string, n map[string]interface{}) (interface{}, error) {
+	f := g.faker
+	switch logical {
+	case "date":
+		return f.DateRange(sampleTimeStart, sampleTimeEnd).Truncate(24 * time.Hour), nil
+	case "time-millis", "time-micros":
+		return time.Duration(f.Number(0, 24*60*60-1)) * time.Second, nil
+	case "timestamp-millis", "timestamp-micros":
+		return f.DateRange(sampleTimeStart, sampleTimeEnd).Truncate(time.Millisecond), nil
+	case "decimal":
+		precision, _ := n["precision"].(float64)
+		scale, _ := n["scale"].(float64)
+		digits := int(precision)
+		if digits > 12 {
+			// Keep samples readable; any value within 12 digits is valid.
+			digits = 12
+		}
+		bound := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(digits)), nil)
+		unscaled := new(big.Int).Rand(f.Rand, bound)
+		return new(big.Rat).SetFrac(unscaled, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil)), nil
+	}
+	return nil, fmt.Errorf("unsupported logical type %q", logical)
+}
+
+var timeWords = []string{"time", "timestamp", "ts", "at", "date", "created", "updated", "modified", "expires", "millis"}
+
+// text returns a string suited to a field called name. Compound names such
+// as "userName" are matched whole, then the last word decides before the
+// others, so "projectVersion" gets a version rather than a project name.
+func (g *sampler) text(name []string) string {
+	f := g.faker
+	switch strings.Join(name, "") {
+	case "username", "nickname", "screenname", "gamertag":
+		return f.Username()
+	case "firstname", "givenname":
+		return f.FirstName()
+	case "lastname", "surname", "familyname":
+		return f.LastName()
+	case "useragent":
+		return f.UserAgent()
+	case "countrycode":
+		return f.CountryAbr()
+	case "zipcode", "postalcode", "postcode":
+		return f.Zip()
+	case "ipaddress", "ipv4":
+		return f.IPv4Address()
+	case "ipv6":
+		return f.IPv6Address()
+	case "macaddress":
+		return f.MacAddress()
+	}
+	if len(name) > 1 {
+		if s, ok := g.textFor(name[len(name)-1:]); ok {
+			return s
+		}
+	}
+	if s, ok := g.textFor(name); ok {
+		return s
+	}
+	return f.Word()
+}
+
+func (g *sampler) textFor(name []string) (string, bool) {
+	f := g.faker
+	switch {
+	case hasWord(name, "email", "mail"):
+		return f.Email(), true
+	case hasWord(name, "id", "uuid", "guid"):
+		return f.UUID(), true
+	case hasWord(name, "ip"):
+		return f.IPv4Address(), true
+	case hasWord(name, "url", "uri", "link", "website", "href", "avatar", "image"):
+		return f.URL(), true
+	case hasWord(name, "domain", "host", "hostname"):
+		return f.DomainName(), true
+	case hasWord(name, "user", "login", "player", "issuer", "author", "owner", "sender"):
+		return f.Username(), true
+	case hasWord(name, "project", "app", "application", "service"):
+		return f.AppName(), true
+	case hasWord(name, "product", "item"):
+		return f.ProductName(), true
+	case hasWord(name, "company", "organization", "org", "publisher"):
+		return f.Company(), true
+	case hasWord(name, "name"):
+		return f.Name(), true
+	case hasWord(name, "city"):
+		return f.City(), true
+	case hasWord(name, "country"):
+		return f.Country(), true
+	case hasWord(name, "state", "region", "province"):
+		return f.State(), true
+	case hasWord(name, "street", "address"):
+		return f.Street(), true
+	case hasWord(name, "zip"):
+		return f.Zip(), true
+	case hasWord(name, "phone", "mobile", "tel"):
+		return f.Phone(), true
+	case hasWord(name, "job"):
+		return f.JobTitle(), true
+	case hasWord(name, "color", "colour"):
+		return f.Color(), true
+	case hasWord(name, "currency"):
+		return f.CurrencyShort(), true
+	case hasWord(name, "language", "lang", "locale"):
+		return f.Language(), true
+	case hasWord(name, "version"):
+		return f.AppVersion(), true
+	case hasWord(name, "method"):
+		return f.HTTPMethod(), true
+	case hasWord(name, "level", "severity"):
+		return f.LogLevel("log"), true
+	case hasWord(name, "gender"):
+		return f.Gender(), true
+	case hasWord(name, "password", "secret", "token"):
+		return f.Password(true, true, true, false, false, 16), true
+	case hasWord(name, timeWords...):
+		return f.DateRange(sampleTimeStart, sampleTimeEnd).Format(time.RFC3339), true
+	case hasWord(name, "title", "subject", "headline"):
+		return f.Sentence(4), true
+	case hasWord(name, "description", "message", "msg", "comment", "text", "body", "summary", "note", "reason", "content"):
+		return f.Sentence(10), true
+	}
+	return "", false
+}
+
+// integer returns a whole number suited to a field called name, below limit
+// when nothing in the name suggests a range.
+func (g *sampler) integer(name []string, limit int) int64 {
+	f := g.faker
+	switch {
+	case hasWord(name, "age"):
+		return int64(f.Number(18, 80))
+	case hasWord(name, "level", "lvl", "rank"):
+		return int64(f.Number(1, 100))
+	case hasWord(name, "port"):
+		return int64(f.Number(1024, 65535))
+	case hasWord(name, "year"):
+		return int64(f.DateRange(sampleTimeStart, sampleTimeEnd).Year())
+	case hasWord(name, "month"):
+		return int64(f.Number(1, 12))
+	case hasWord(name, "day"):
+		return int64(f.Number(1, 28))
+	case hasWord(name, "hour"):
+		return int64(f.Number(0, 23))
+	case hasWord(name, "minute", "second"):
+		return int64(f.Number(0, 59))
+	case hasWord(name, "percent", "pct"):
+		return int64(f.Number(0, 100))
+	case hasWord(name, "status", "code"):
+		return int64(f.HTTPStatusCode())
+	case hasWord(name, timeWords...):
+		return f.DateRange(sampleTimeStart, sampleTimeEnd).Unix()
+	case hasWord(name, "score", "points", "xp", "experience", "exp", "gold", "coins"):
+		return int64(f.Number(0, 100000))
+	case hasWord(name, "count", "quantity", "qty", "num", "number", "size", "total", "attempts", "retries"):
+		return int64(f.Number(0, 100))
+	case hasWord(name, "id"):
+		return int64(f.Number(1, limit))
+	}
+	return int64(f.Number(0, limit))
+}
+
+// real returns a floating-point number suited to a field called name.
+func (g *sampler) real(name []string) float64 {
+	f := g.faker
+	switch {
+	case hasWord(name, "lat", "latitude"):
+		return f.Latitude()
+	case hasWord(name, "lon", "lng", "longitude"):
+		return f.Longitude()
+	case hasWord(name, "price", "cost", "amount", "balance", "fee", "total"):
+		return f.Price(1, 1000)
+	case hasWord(name, "ratio", "rate", "probability", "chance", "weight"):
+		return f.Float64Range(0, 1)
+	case hasWord(name, "percent", "pct"):
+		return f.Float64Range(0, 100)
+	}
+	return f.Float64Range(0, 1000)
+}
+
+// nameWords splits a field name into lower-case words at underscores,
+// dashes and case changes: "userID" and "user_id" both give [user id].
+func nameWords(name string) []string {
+	var words []string
+	var word []rune
+	runes := []rune(name)
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			if len(word) > 0 {
+				words = append(words, string(word))
+				word = nil
+			}
+			continue
+		}
+		if unicode.IsUpper(r) && len(word) > 0 {
+			prevLower := unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if prevLower || (unicode.IsUpper(runes[i-1]) && nextLower) {
+				words = append(words, string(word))
+				word = nil
+			}
+		}
+		word = append(word, unicode.ToLower(r))
+	}
+	if len(word) > 0 {
+		words = append(words, string(word))
+	}
+	return words
+}
+
+// hasWord reports whether name contains one of words, allowing a plural
+// "s" so that "tags" matches "tag".
+func hasWord(name []string, words ...string) bool {
+	for _, w := range name {
+		for _, want := range words {
+			if w == want || w == want+"s" {
+				return true
+			}
+		}
+	}
+	return false
+}
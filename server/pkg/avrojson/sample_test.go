@@ -0,0 +1,121 @@
+package avrojson
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const sampleSchema = `{"type":"record","name":"Order","namespace":"shop","fields":[
+	{"name":"orderId","type":"string"},
+	{"name":"customer_email","type":"string"},
+	{"name":"createdAt","type":{"type":"long","logicalType":"timestamp-millis"}},
+	{"name":"status","type":{"type":"enum","name":"Status","symbols":["NEW","PAID","SHIPPED"]}},
+	{"name":"total","type":{"type":"bytes","logicalType":"decimal","precision":9,"scale":2}},
+	{"name":"lines","type":{"type":"array","items":{"type":"record","name":"Line","fields":[
+		{"name":"sku","type":{"type":"fixed","name":"Sku","size":8}},
+		{"name":"quantity","type":"int"},
+		{"name":"price","type":["null",{"type":"bytes","logicalType":"decimal","precision":9,"scale":2}]}
+	]}}},
+	{"name":"attributes","type":{"type":"map","values":["null","string","long"]}},
+	{"name":"shipTo","type":["null",{"type":"record","name":"Address","fields":[
+		{"name":"city","type":"string"},{"name":"lat","type":"double"}
+	]}]},
+	{"name":"parent","type":["null","Order"]}
+]}`
+
+func TestSampleConformsToSchema(t *testing.T) {
+	codec, err := NewCodec(sampleSchema)
+	if err != nil {
+		t.Fatalf("Failed to create codec: %v", err)
+	}
+	for seed := int64(1); seed <= 50; seed++ {
+		native, err := codec.Sample(seed)
+		if err != nil {
+			t.Fatalf("seed %d: Failed to generate sample: %v", seed, err)
+		}
+		if _, err := codec.EncodeNative(native); err != nil {
+			t.Fatalf("seed %d: sample does not encode: %v", seed, err)
+		}
+	}
+}
+
+func TestSampleIsReproducible(t *testing.T) {
+	codec, err := NewCodec(sampleSchema)
+	if err != nil {
+		t.Fatalf("Failed to create codec: %v", err)
+	}
+	sample := func(seed int64) interface{} {
+		native, err := codec.Sample(seed)
+		if err != nil {
+			t.Fatalf("Failed to generate sample: %v", err)
+		}
+		return native
+	}
+	// Maps encode in random order, so compare the values, not the bytes.
+	if !reflect.DeepEqual(sample(42), sample(42)) {
+		t.Error("expected the same seed to give the same sample")
+	}
+	if reflect.DeepEqual(sample(42), sample(43)) {
+		t.Error("expected different seeds to give different samples")
+	}
+}
+
+func TestSampleUsesFieldNames(t *testing.T) {
+	codec, err := NewCodec(sampleSchema)
+	if err != nil {
+		t.Fatalf("Failed to create codec: %v", err)
+	}
+	native, err := codec.Sample(7)
+	if err != nil {
+		t.Fatalf("Failed to generate sample: %v", err)
+	}
+	order := native.(map[string]interface{})
+
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+	if id, _ := order["orderId"].(string); !uuid.MatchString(id) {
+		t.Errorf("expected orderId to be a UUID, got %q", id)
+	}
+	if email, _ := order["customer_email"].(string); !strings.Contains(email, "@") {
+		t.Errorf("expected customer_email to be an email address, got %q", email)
+	}
+	for _, line := range order["lines"].([]interface{}) {
+		if q := line.(map[string]interface{})["quantity"].(int32); q < 0 || q > 100 {
+			t.Errorf("expected a plausible quantity, got %d", q)
+		}
+	}
+}
+
+func TestNameWords(t *testing.T) {
+	tests := map[string]string{
+		"userID":         "user id",
+		"user_id":        "user id",
+		"createdAt":      "created at",
+		"HTTPStatusCode": "http status code",
+		"ipv4-address":   "ipv4 address",
+		"email":          "email",
+	}
+	for name, want := range tests {
+		if got := strings.Join(nameWords(name), " "); got != want {
+			t.Errorf("nameWords(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestSampleTextPrefersLastWord(t *testing.T) {
+	codec, err := NewCodec(`{"type":"record","name":"Build","fields":[{"name":"projectVersion","type":"string"}]}`)
+	if err != nil {
+		t.Fatalf("Failed to create codec: %v", err)
+	}
+	version := regexp.MustCompile(`^\d+\.\d+\.\d+$`)
+	for seed := int64(1); seed <= 5; seed++ {
+		native, err := codec.Sample(seed)
+		if err != nil {
+			t.Fatalf("Failed to generate sample: %v", err)
+		}
+		if v := native.(map[string]interface{})["projectVersion"].(string); !version.MatchString(v) {
+			t.Errorf("expected projectVersion to be a version, got %q", v)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+// Package avrojson converts the log pipeline's JSON records to and from
+// Avro. It carries the wrapper and log data schemas, the matching Go types
+// and a codec cache, so services can embed the conversion without running
+// the HTTP server.
+//
+// Logs are encoded in two levels: a LogData record is encoded with
+// LogDataSchema, and its Avro JSON form becomes the body of a LogWrapper
+// encoded with WrapperSchema.
+package avrojson
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// WrapperSchema describes the envelope stored and published for every log.
+// The built-in schemas live in schemas/*.avsc so they can be reviewed and
+// registered without going through Go source.
+//
+//go:embed schemas/LogWrapper.avsc
+var WrapperSchema string
+
+// LogDataSchema describes the log body carried inside the wrapper.
+//
+//go:embed schemas/LogData.avsc
+var LogDataSchema string
+
+// BuiltinSchemas maps the names of the schemas the log pipeline is built on
+// to their definitions.
+func BuiltinSchemas() map[string]string {
+	return map[string]string{
+		"LogWrapper": WrapperSchema,
+		"LogData":    LogDataSchema,
+	}
+}
+
+// LogWrapper is a record of WrapperSchema. Body holds the Avro JSON
+// encoding of a LogData record.
+//
+// The json tags mirror the avro names because ToNative goes through
+// encoding/json to build the native maps goavro expects.
+type LogWrapper struct {
+	ProjectName    string `avro:"projectName" json:"projectName"`
+	ProjectVersion string `avro:"projectVersion" json:"projectVersion"`
+	Body           string `avro:"body" json:"body"`
+	LogLevel       string `avro:"logLevel" json:"logLevel"`
+	LogType        string `avro:"logType" json:"logType"`
+	LogSource      string `avro:"logSource" json:"logSource"`
+}
+
+// LogData is a record of LogDataSchema. Timestamp is a timestamp-millis
+// long, so it keeps millisecond precision and decodes in UTC. Metadata and
+// DomainData are either nil or a map[string]string; StringMap converts
+// arbitrary JSON objects.
+type LogData struct {
+	Timestamp  time.Time   `avro:"timestamp" json:"timestamp"`
+	Logtype    string      `avro:"logtype" json:"logtype"`
+	Version    string      `avro:"version" json:"version"`
+	Issuer     string      `avro:"issuer" json:"issuer"`
+	Metadata   interface{} `avro:"metadata" json:"metadata"`
+	DomainData interface{} `avro:"domainData" json:"domainData"`
+}
+
+// MarshalJSON emits the goavro native form of the record: the timestamp
+// becomes Unix milliseconds and the nullable metadata/domainData fields
+// become {"map": ...} unions, or null when unset. ToNative relies on this
+// to produce maps goavro can encode.
+func (d LogData) MarshalJSON() ([]byte, error) {
+	type plain LogData
+	p := struct {
+		plain
+		Timestamp int64 `json:"timestamp"`
+	}{plain(d), d.Timestamp.UnixMilli()}
+	p.Metadata = nullableUnion("map", d.Metadata)
+	p.DomainData = nullableUnion("map", d.DomainData)
+	return json.Marshal(p)
+}
+
+// UnmarshalJSON accepts the native form produced by MarshalJSON, or the
+// time.Time goavro decodes timestamps to, and unwraps the unions back into
+// map[string]string values.
+func (d *LogData) UnmarshalJSON(data []byte) error {
+	type plain LogData
+	var p struct {
+		plain
+		Timestamp json.RawMessage `json:"timestamp"`
+	}
+	if err := json.Unmarshal(data, &p); err != nil {
+		return err
+	}
+	ts, err := unmarshalMillis(p.Timestamp)
+	if err != nil {
+		return fmt.Errorf("avrojson: LogData.timestamp: %w", err)
+	}
+	p.plain.Timestamp = ts
+	p.Metadata = unwrapStringMap("map", p.Metadata)
+	p.DomainData = unwrapStringMap("map", p.DomainData)
+	*d = LogData(p.plain)
+	return nil
+}
+
+// unmarshalMillis reads a timestamp given as Unix milliseconds or as an
+// RFC 3339 string. Missing and null timestamps are the zero time.
+func unmarshalMillis(raw json.RawMessage) (time.Time, error) {
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return time.Time{}, nil
+	}
+	if raw[0] == '"' {
+		var t time.Time
+		err := json.Unmarshal(raw, &t)
+		return t.UTC(), err
+	}
+	var ms int64
+	if err := json.Unmarshal(raw, &ms); err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(ms).UTC(), nil
+}
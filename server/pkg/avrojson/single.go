@@ -0,0 +1,102 @@
+package avrojson
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Avro single-object encoding prefixes a binary datum with the two marker
+// bytes C3 01 and the 8-byte little-endian Rabin fingerprint of the
+// writer schema's canonical form, so a stored record names its schema
+// without carrying it.
+const SingleObjectHeaderSize = 10
+
+var singleObjectMarker = [2]byte{0xC3, 0x01}
+
+// ErrNotSingleObject is returned for data that does not start with the
+// single-object marker.
+var ErrNotSingleObject = errors.New("avrojson: not single-object encoded")
+
+// IsSingleObject reports whether data starts with a single-object header.
+func IsSingleObject(data []byte) bool {
+	return len(data) >= SingleObjectHeaderSize && data[0] == singleObjectMarker[0] && data[1] == singleObjectMarker[1]
+}
+
+// SingleObjectFingerprint returns the schema fingerprint of a
+// single-object datum and the Avro binary that follows its header.
+func SingleObjectFingerprint(data []byte) (uint64, []byte, error) {
+	if !IsSingleObject(data) {
+		return 0, nil, ErrNotSingleObject
+	}
+	return binary.LittleEndian.Uint64(data[2:SingleObjectHeaderSize]), data[SingleObjectHeaderSize:], nil
+}
+
+// FormatFingerprint returns the hex form of a Rabin fingerprint used by the
+// schema registry and the codec metrics.
+func FormatFingerprint(fingerprint uint64) string {
+	return fmt.Sprintf("%016x", fingerprint)
+}
+
+// Fingerprint returns the Rabin fingerprint of the codec's canonical
+// schema, as single-object headers carry it.
+func (c *Codec) Fingerprint() uint64 { return c.rabin }
+
+// SingleFromBinary prefixes data, an Avro binary datum of the codec's
+// schema, with the single-object header.
+func (c *Codec) SingleFromBinary(data []byte) []byte {
+	out := make([]byte, SingleObjectHeaderSize, SingleObjectHeaderSize+len(data))
+	copy(out, singleObjectMarker[:])
+	binary.LittleEndian.PutUint64(out[2:], c.rabin)
+	return append(out, data...)
+}
+
+// EncodeSingle is Encode in single-object encoding.
+func (c *Codec) EncodeSingle(v interface{}) ([]byte, error) {
+	data, err := c.Encode(v)
+	if err != nil {
+		return nil, err
+	}
+	return c.SingleFromBinary(data), nil
+}
+
+// EncodeNativeSingle is EncodeNative in single-object encoding.
+func (c *Codec) EncodeNativeSingle(native interface{}) ([]byte, error) {
+	data, err := c.binaryFromNative(native)
+	if err != nil {
+		return nil, err
+	}
+	return c.SingleFromBinary(data), nil
+}
+
+// BinaryFromSingle checks that data is a single-object datum of the
+// codec's schema and returns its Avro binary.
+func (c *Codec) BinaryFromSingle(data []byte) ([]byte, error) {
+	fingerprint, body, err := SingleObjectFingerprint(data)
+	if err != nil {
+		return nil, err
+	}
+	if fingerprint != c.rabin {
+		return nil, fmt.Errorf("avrojson: single-object datum has schema fingerprint %s, not %s's %s",
+			FormatFingerprint(fingerprint), c.metrics.name, FormatFingerprint(c.rabin))
+	}
+	return body, nil
+}
+
+// DecodeSingle is Decode for a single-object datum.
+func (c *Codec) DecodeSingle(data []byte, v interface{}) error {
+	body, err := c.BinaryFromSingle(data)
+	if err != nil {
+		return err
+	}
+	return c.Decode(body, v)
+}
+
+// DecodeNativeSingle is DecodeNative for a single-object datum.
+func (c *Codec) DecodeNativeSingle(data []byte) (interface{}, error) {
+	body, err := c.BinaryFromSingle(data)
+	if err != nil {
+		return nil, err
+	}
+	return c.nativeFromBinary(body)
+}
@@ -0,0 +1,75 @@
+package avrojson
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSingleObjectRoundTrip(t *testing.T) {
+	codec, err := NewCodec(LogDataSchema)
+	if err != nil {
+		t.Fatalf("Failed to create codec: %v", err)
+	}
+	data := LogData{Timestamp: time.UnixMilli(1700000000000).UTC(), Logtype: "user_action", Version: "1.0", Issuer: "test_system"}
+	single, err := codec.EncodeSingle(data)
+	if err != nil {
+		t.Fatalf("Failed to encode single object: %v", err)
+	}
+	binary, _ := codec.Encode(data)
+	if !bytes.Equal(single[SingleObjectHeaderSize:], binary) || !bytes.HasPrefix(single, []byte{0xC3, 0x01}) {
+		t.Fatalf("expected the marker, fingerprint and binary datum, got % x", single)
+	}
+
+	fingerprint, body, err := SingleObjectFingerprint(single)
+	if err != nil || fingerprint != codec.Fingerprint() || !bytes.Equal(body, binary) {
+		t.Errorf("SingleObjectFingerprint gave %x, % x, %v", fingerprint, body, err)
+	}
+	// goavro reads the same encoding where its canonical form is the
+	// specification's, which it is not for LogData's timestamp-millis.
+	wrapperCodec, _ := NewCodec(WrapperSchema)
+	wrapperSingle, err := wrapperCodec.EncodeSingle(LogWrapper{ProjectName: "p", ProjectVersion: "1", Body: "{}", LogLevel: "info", LogType: "t", LogSource: "s"})
+	if err != nil {
+		t.Fatalf("Failed to encode single object: %v", err)
+	}
+	if _, _, err := wrapperCodec.Goavro().NativeFromSingle(wrapperSingle); err != nil {
+		t.Errorf("goavro rejected the single object: %v", err)
+	}
+	if codec.Fingerprint() == codec.Goavro().Rabin {
+		t.Errorf("expected LogData's fingerprint to differ from goavro's")
+	}
+
+	var back LogData
+	if err := codec.DecodeSingle(single, &back); err != nil || back.Issuer != "test_system" {
+		t.Errorf("DecodeSingle gave %+v, %v", back, err)
+	}
+	if _, err := codec.DecodeNativeSingle(binary); !errors.Is(err, ErrNotSingleObject) {
+		t.Errorf("expected plain binary to be rejected, got %v", err)
+	}
+
+	if _, err := wrapperCodec.DecodeNativeSingle(single); err == nil || !strings.Contains(err.Error(), FormatFingerprint(codec.Fingerprint())) {
+		t.Errorf("expected another schema's datum to be rejected, got %v", err)
+	}
+}
+
+func TestEncodedLogSingleObjects(t *testing.T) {
+	encoded, err := EncodeLog(LogWrapper{ProjectName: "p", ProjectVersion: "1", LogLevel: "info", LogType: "t", LogSource: "s"}, LogData{Timestamp: time.UnixMilli(1).UTC()})
+	if err != nil {
+		t.Fatalf("Failed to encode log: %v", err)
+	}
+	wrapper, logData, err := encoded.SingleObjects()
+	if err != nil {
+		t.Fatalf("Failed to encode single objects: %v", err)
+	}
+	for name, c := range map[string]struct {
+		schema string
+		single []byte
+	}{"wrapper": {WrapperSchema, wrapper}, "log data": {LogDataSchema, logData}} {
+		codec, _ := NewCodec(c.schema)
+		if _, err := codec.DecodeNativeSingle(c.single); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package avrojson
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// strip replaces every {"type": value} union wrapper in v with value.
+func (s *parsedSchema) strip(node, v interface{}) interface{} {
+	switch n := node.(type) {
+	case string:
+		if primitiveTypes[n] {
+			return v
+		}
+		if def, ok := s.named[n]; ok {
+			return s.strip(def, v)
+		}
+		return v
+	case []interface{}:
+		wrapped, ok := v.(map[string]interface{})
+		if !ok || len(wrapped) != 1 {
+			return v
+		}
+		for typeName, inner := range wrapped {
+			for _, branch := range n {
+				if branchName(branch) == typeName {
+					return s.strip(branch, inner)
+				}
+			}
+		}
+		return v
+	case map[string]interface{}:
+		switch t := n["type"].(type) {
+		case string:
+			switch t {
+			case "record", "error":
+				rec, ok := v.(map[string]interface{})
+				if !ok {
+					return v
+				}
+				out := make(map[string]interface{}, len(rec))
+				for k, val := range rec {
+					out[k] = val
+				}
+				fields, _ := n["fields"].([]interface{})
+				for _, f := range fields {
+					field, _ := f.(map[string]interface{})
+					name, _ := field["name"].(string)
+					if val, ok := rec[name]; ok {
+						out[name] = s.strip(field["type"], val)
+					}
+				}
+				return out
+			case "array":
+				items, ok := v.([]interface{})
+				if !ok {
+					return v
+				}
+				out := make([]interface{}, len(items))
+				for i, item := range items {
+					out[i] = s.strip(n["items"], item)
+				}
+				return out
+			case "map":
+				values, ok := v.(map[string]interface{})
+				if !ok {
+					return v
+				}
+				out := make(map[string]interface{}, len(values))
+				for k, val := range values {
+					out[k] = s.strip(n["values"], val)
+				}
+				return out
+			}
+			return v
+		default:
+			return s.strip(t, v)
+		}
+	}
+	return v
+}
+
+// wrap adds a {"type": value} wrapper to every plain value in a union
+// position of v. A value already wrapped as one of the union's branches is
+// kept; any other takes the first non-null branch it is valid for, as
+// Validate's PlainUnions reads it. A value no branch accepts is left for
+// the encoder to reject.
+func (s *parsedSchema) wrap(node, v interface{}) interface{} {
+	switch n := node.(type) {
+	case string:
+		if def, ok := s.named[n]; ok && !primitiveTypes[n] {
+			return s.wrap(def, v)
+		}
+		return v
+	case []interface{}:
+		if v == nil {
+			return nil
+		}
+		if wrapped, ok := v.(map[string]interface{}); ok && len(wrapped) == 1 {
+			for typeName, inner := range wrapped {
+				for _, branch := range n {
+					if branchName(branch) == typeName {
+						return map[string]interface{}{typeName: s.wrap(branch, inner)}
+					}
+				}
+			}
+		}
+		for _, branch := range n {
+			if branch == "null" {
+				continue
+			}
+			trial := &validator{schema: s, plain: true}
+			trial.check(branch, v, "", 0)
+			if len(trial.errs) == 0 {
+				return map[string]interface{}{branchName(branch): s.wrap(branch, v)}
+			}
+		}
+		return v
+	case map[string]interface{}:
+		t, ok := n["type"].(string)
+		if !ok {
+			return s.wrap(n["type"], v)
+		}
+		switch t {
+		case "record", "error":
+			rec, ok := v.(map[string]interface{})
+			if !ok {
+				return v
+			}
+			out := make(map[string]interface{}, len(rec))
+			for k, val := range rec {
+				out[k] = val
+			}
+			fields, _ := n["fields"].([]interface{})
+			for _, f := range fields {
+				field, _ := f.(map[string]interface{})
+				name, _ := field["name"].(string)
+				if val, ok := rec[name]; ok {
+					out[name] = s.wrap(field["type"], val)
+				}
+			}
+			return out
+		case "array":
+			items, ok := v.([]interface{})
+			if !ok {
+				return v
+			}
+			out := make([]interface{}, len(items))
+			for i, item := range items {
+				out[i] = s.wrap(n["items"], item)
+			}
+			return out
+		case "map":
+			values, ok := v.(map[string]interface{})
+			if !ok {
+				return v
+			}
+			out := make(map[string]interface{}, len(values))
+			for k, val := range values {
+				out[k] = s.wrap(n["values"], val)
+			}
+			return out
+		}
+	}
+	return v
+}
+
+// goavroLogicalNames are the logical types goavro names <type>.<logical>
+// in unions; it ignores the others.
+var goavroLogicalNames = map[string]bool{
+	"int.date":              true,
+	"int.time-millis":       true,
+	"long.time-micros":      true,
+	"long.timestamp-millis": true,
+	"long.timestamp-micros": true,
+	"bytes.decimal":         true,
+}
+
+// branchName returns the key goavro uses for a union branch: the full name
+// of named types, <type>.<logical> for the logical types goavro implements
+// and the type name otherwise.
+func branchName(branch interface{}) string {
+	switch b := branch.(type) {
+	case string:
+		return b
+	case map[string]interface{}:
+		t, _ := b["type"].(string)
+		switch t {
+		case "record", "error", "enum", "fixed":
+			name, _ := b["name"].(string)
+			return name
+		}
+		if logical, ok := b["logicalType"].(string); ok && goavroLogicalNames[t+"."+logical] {
+			return t + "." + logical
+		}
+		return t
+	}
+	return ""
+}
+
+// StripUnions removes goavro's union wrappers ({"string": "x"} becomes "x")
+// from a native value of the codec's schema, producing plain JSON-style
+// data. Only values in union positions of the schema are unwrapped, so maps
+// that happen to have a single key named like a type are left alone.
+func (c *Codec) StripUnions(native interface{}) (interface{}, error) {
+	s, err := c.schemaTree()
+	if err != nil {
+		return nil, err
+	}
+	return s.strip(s.root, native), nil
+}
+
+// WrapUnions is the inverse of StripUnions: it wraps the plain values in
+// union positions of v, a JSON-style value of the codec's schema, so
+// goavro accepts them. A value takes the first non-null branch it is valid
+// for; one already wrapped as a branch of its union is kept as it is.
+func (c *Codec) WrapUnions(v interface{}) (interface{}, error) {
+	s, err := c.schemaTree()
+	if err != nil {
+		return nil, err
+	}
+	return s.wrap(s.root, v), nil
+}
+
+// StripUnionsJSON rewrites text, Avro JSON of the codec's schema, without
+// union wrappers. Numbers keep their text.
+func (c *Codec) StripUnionsJSON(text []byte) ([]byte, error) {
+	return c.rewriteJSON(text, (*parsedSchema).strip)
+}
+
+// WrapUnionsJSON rewrites text, plain JSON as StripUnionsJSON writes it,
+// into Avro JSON of the codec's schema, ready for JSONToBinary.
+func (c *Codec) WrapUnionsJSON(text []byte) ([]byte, error) {
+	return c.rewriteJSON(text, (*parsedSchema).wrap)
+}
+
+func (c *Codec) rewriteJSON(text []byte, rewrite func(s *parsedSchema, node, v interface{}) interface{}) ([]byte, error) {
+	s, err := c.schemaTree()
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(text))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("avrojson: invalid JSON: %w", err)
+	}
+	var out bytes.Buffer
+	enc := json.NewEncoder(&out)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(rewrite(s, s.root, v)); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(out.Bytes(), []byte("\n")), nil
+}
@@ -0,0 +1,117 @@
+package avrojson
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStripUnions(t *testing.T) {
+	codec, err := NewCodec(`{
+		"type": "record",
+		"name": "Event",
+		"namespace": "exp",
+		"fields": [
+			{"name": "id", "type": "long"},
+			{"name": "note", "type": ["null", "string"]},
+			{"name": "tags", "type": {"type": "map", "values": "string"}},
+			{"name": "owner", "type": ["null", {"type": "record", "name": "User", "fields": [
+				{"name": "name", "type": "string"},
+				{"name": "nick", "type": ["null", "string"], "default": null}
+			]}]},
+			{"name": "history", "type": {"type": "array", "items": ["null", "exp.User"]}}
+		]
+	}`)
+	if err != nil {
+		t.Fatalf("Failed to create codec: %v", err)
+	}
+
+	binary, err := codec.Encode(map[string]interface{}{
+		"id":   1,
+		"note": map[string]interface{}{"string": "hello"},
+		// A plain map whose only key is a type name must survive.
+		"tags":  map[string]interface{}{"string": "not a union"},
+		"owner": map[string]interface{}{"exp.User": map[string]interface{}{"name": "ann", "nick": map[string]interface{}{"string": "a"}}},
+		"history": []interface{}{
+			nil,
+			map[string]interface{}{"exp.User": map[string]interface{}{"name": "bob", "nick": nil}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	native, err := codec.DecodeNative(binary)
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+
+	got, err := codec.StripUnions(native)
+	if err != nil {
+		t.Fatalf("Failed to strip unions: %v", err)
+	}
+	want := map[string]interface{}{
+		"id":    int64(1),
+		"note":  "hello",
+		"tags":  map[string]interface{}{"string": "not a union"},
+		"owner": map[string]interface{}{"name": "ann", "nick": "a"},
+		"history": []interface{}{
+			nil,
+			map[string]interface{}{"name": "bob", "nick": nil},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected stripped value:\n got %#v\nwant %#v", got, want)
+	}
+}
+
+func TestUnionsJSONRoundTrip(t *testing.T) {
+	codec, err := NewCodec(`{"type":"record","name":"Event","namespace":"exp","fields":[
+		{"name":"id","type":"long"},
+		{"name":"note","type":["null","string"]},
+		{"name":"raw","type":["null","bytes"]},
+		{"name":"value","type":["null","int","string"]},
+		{"name":"tags","type":{"type":"map","values":"string"}},
+		{"name":"owner","type":["null",{"type":"record","name":"User","fields":[{"name":"name","type":"string"}]}]}
+	]}`)
+	if err != nil {
+		t.Fatalf("Failed to create codec: %v", err)
+	}
+	wrapped := `{"id":9007199254740993,"note":{"string":"hi"},"raw":{"bytes":"ÿ\u0001"},"value":{"string":"7"},"tags":{"string":"not a union"},"owner":{"exp.User":{"name":"ann"}}}`
+	binary, err := codec.JSONToBinary([]byte(wrapped))
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+
+	plain, err := codec.StripUnionsJSON([]byte(wrapped))
+	if err != nil {
+		t.Fatalf("Failed to strip unions: %v", err)
+	}
+	want := `{"id":9007199254740993,"note":"hi","owner":{"name":"ann"},"raw":"ÿ\u0001","tags":{"string":"not a union"},"value":"7"}`
+	if string(plain) != want {
+		t.Errorf("unexpected plain JSON\n got %s\nwant %s", plain, want)
+	}
+
+	rewrapped, err := codec.WrapUnionsJSON(plain)
+	if err != nil {
+		t.Fatalf("Failed to wrap unions: %v", err)
+	}
+	again, err := codec.JSONToBinary(rewrapped)
+	if err != nil {
+		t.Fatalf("Failed to encode rewrapped JSON %s: %v", rewrapped, err)
+	}
+	if string(again) != string(binary) {
+		t.Errorf("expected the round trip to keep the datum, got %s", rewrapped)
+	}
+
+	// A plain value takes the first branch it fits.
+	rewrapped, err = codec.WrapUnionsJSON([]byte(`{"id":1,"note":null,"raw":null,"value":7,"tags":{},"owner":null}`))
+	if err != nil {
+		t.Fatalf("Failed to wrap unions: %v", err)
+	}
+	if !strings.Contains(string(rewrapped), `"value":{"int":7}`) {
+		t.Errorf("expected 7 to take the int branch, got %s", rewrapped)
+	}
+	if _, err := codec.WrapUnionsJSON([]byte(`{`)); err == nil {
+		t.Error("expected invalid JSON to fail")
+	}
+}
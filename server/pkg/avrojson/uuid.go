@@ -0,0 +1,76 @@
+package avrojson
+
+import (
+	"encoding/hex"
+	"fmt"
+)
+
+// UUID is an RFC 4122 UUID. It is stored as an Avro string with the uuid
+// logical type, in the canonical lowercase 8-4-4-4-12 form, and marshals
+// to JSON and text the same way.
+type UUID [16]byte
+
+// ParseUUID parses the canonical form of a UUID, in either case, as the
+// uuid logical type requires.
+func ParseUUID(s string) (UUID, error) {
+	var u UUID
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return u, fmt.Errorf("avrojson: invalid UUID %q", s)
+	}
+	digits := s[0:8] + s[9:13] + s[14:18] + s[19:23] + s[24:36]
+	if _, err := hex.Decode(u[:], []byte(digits)); err != nil {
+		return u, fmt.Errorf("avrojson: invalid UUID %q", s)
+	}
+	return u, nil
+}
+
+func (u UUID) String() string {
+	var buf [36]byte
+	hex.Encode(buf[0:8], u[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], u[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], u[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], u[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:36], u[10:16])
+	return string(buf[:])
+}
+
+// AvroSchema implements AvroMarshaler.
+func (UUID) AvroSchema() string {
+	return `{"type":"string","logicalType":"uuid"}`
+}
+
+// MarshalAvro implements AvroMarshaler.
+func (u UUID) MarshalAvro() (interface{}, error) {
+	return u.String(), nil
+}
+
+// UnmarshalAvro implements AvroUnmarshaler.
+func (u *UUID) UnmarshalAvro(native interface{}) error {
+	s, ok := native.(string)
+	if !ok {
+		return fmt.Errorf("avrojson: expected a UUID string, got %T", native)
+	}
+	parsed, err := ParseUUID(s)
+	if err != nil {
+		return err
+	}
+	*u = parsed
+	return nil
+}
+
+func (u UUID) MarshalText() ([]byte, error) {
+	return []byte(u.String()), nil
+}
+
+func (u *UUID) UnmarshalText(text []byte) error {
+	parsed, err := ParseUUID(string(text))
+	if err != nil {
+		return err
+	}
+	*u = parsed
+	return nil
+}
@@ -0,0 +1,100 @@
+package avrojson
+
+import (
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseUUID(t *testing.T) {
+	u, err := ParseUUID("6BA7B810-9DAD-11D1-80B4-00C04FD430C8")
+	if err != nil {
+		t.Fatalf("Failed to parse UUID: %v", err)
+	}
+	if got := u.String(); got != "6ba7b810-9dad-11d1-80b4-00c04fd430c8" {
+		t.Errorf("String() = %q", got)
+	}
+	for _, bad := range []string{"", "6ba7b8109dad11d180b400c04fd430c8", "6ba7b810-9dad-11d1-80b4-00c04fd430cg", "{6ba7b810-9dad-11d1-80b4-00c04fd430c8}"} {
+		if _, err := ParseUUID(bad); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+
+	text, _ := json.Marshal(map[string]UUID{"id": u})
+	if string(text) != `{"id":"6ba7b810-9dad-11d1-80b4-00c04fd430c8"}` {
+		t.Errorf("unexpected JSON %s", text)
+	}
+	var back map[string]UUID
+	if err := json.Unmarshal(text, &back); err != nil || back["id"] != u {
+		t.Errorf("JSON round trip gave %v, %v", back, err)
+	}
+}
+
+type testPayment struct {
+	ID      UUID      `json:"id"`
+	Payer   *UUID     `json:"payer"`
+	Amount  big.Rat   `avro:"amount,precision=12,scale=2" json:"amount"`
+	PaidAt  time.Time `json:"paidAt"`
+	Settled time.Time `avro:"settled,logical=date" json:"settled"`
+}
+
+func TestLogicalTypesRoundTrip(t *testing.T) {
+	schema, err := SchemaOf(testPayment{})
+	if err != nil {
+		t.Fatalf("Failed to generate schema: %v", err)
+	}
+	for _, want := range []string{
+		`{"name":"id","type":{"type":"string","logicalType":"uuid"}}`,
+		`"logicalType":"decimal","precision":12,"scale":2`,
+		`{"type":"long","logicalType":"timestamp-millis"}`,
+		`{"type":"int","logicalType":"date"}`,
+	} {
+		if !strings.Contains(schema, want) {
+			t.Errorf("schema lacks %s: %s", want, schema)
+		}
+	}
+	codec, err := NewCodec(schema)
+	if err != nil {
+		t.Fatalf("Failed to compile %s: %v", schema, err)
+	}
+
+	id, _ := ParseUUID("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	payer, _ := ParseUUID("00000000-0000-4000-8000-000000000001")
+	amount, _ := ParseDecimal("1234.50")
+	in := testPayment{
+		ID:      id,
+		Payer:   &payer,
+		Amount:  *amount,
+		PaidAt:  time.UnixMilli(1760434245678).UTC(),
+		Settled: time.Date(2025, 10, 14, 0, 0, 0, 0, time.UTC),
+	}
+	data, err := codec.Encode(in)
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	var out testPayment
+	if err := codec.Decode(data, &out); err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if out.ID != in.ID || out.Payer == nil || *out.Payer != payer || out.Amount.Cmp(amount) != 0 ||
+		!out.PaidAt.Equal(in.PaidAt) || !out.Settled.Equal(in.Settled) {
+		t.Errorf("round trip gave %+v, want %+v", out, in)
+	}
+
+	// The Avro JSON form keeps UUIDs as strings and timestamps as numbers.
+	text, err := codec.BinaryToJSON(data)
+	if err != nil {
+		t.Fatalf("Failed to convert to JSON: %v", err)
+	}
+	if !strings.Contains(string(text), `"id":"6ba7b810-9dad-11d1-80b4-00c04fd430c8"`) || !strings.Contains(string(text), `"paidAt":1760434245678`) {
+		t.Errorf("unexpected Avro JSON %s", text)
+	}
+
+	// uuid strings are checked on encode, whatever Go type they come from.
+	bad := strings.Replace(string(text), "6ba7b810-9dad", "not-a-uuid---", 1)
+	if _, err := codec.JSONToBinary([]byte(bad)); err == nil || !strings.Contains(err.Error(), "id: invalid UUID") {
+		t.Errorf("expected an invalid UUID to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,331 @@
+package avrojson
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ViolationUnknownField is a record field the schema does not have, which
+// the codec rejects. The other kinds Validate reports are those of
+// Violations.
+const ViolationUnknownField = "unknown-field"
+
+// maxValidationErrors bounds the errors Validate collects, so a large
+// document of the wrong shape does not produce one per value.
+const maxValidationErrors = 100
+
+// ValidationError is one place where a JSON document breaks the schema.
+type ValidationError struct {
+	Kind string `json:"kind"`
+	// Path locates the value, e.g. "lines[0].quantity"; it is empty for
+	// the top-level value.
+	Path string `json:"path"`
+	// Expected describes the schema type at Path and Actual the JSON type
+	// found there.
+	Expected string `json:"expected"`
+	Actual   string `json:"actual,omitempty"`
+	Message  string `json:"message"`
+}
+
+// ValidateOptions control how Validate reads the document.
+type ValidateOptions struct {
+	// PlainUnions accepts union values without their {"<branch>": value}
+	// wrapper, as StripUnions writes them; a value then matches the first
+	// branch it is valid for.
+	PlainUnions bool
+}
+
+// Validate checks text, a JSON document, against the codec's schema
+// without encoding it, returning every place it breaks the schema, up to
+// 100, in document order. It returns an error only when text is not JSON.
+// Validation follows the codec's Avro JSON rules: ints and longs are
+// integers in range, bytes and fixed values are strings, unknown record
+// fields are rejected and missing ones need a default.
+func (c *Codec) Validate(text []byte, opts ValidateOptions) ([]ValidationError, error) {
+	s, err := c.schemaTree()
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(text))
+	dec.UseNumber()
+	var root interface{}
+	if err := dec.Decode(&root); err != nil {
+		return nil, fmt.Errorf("avrojson: invalid JSON: %w", err)
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("avrojson: invalid JSON: data after the document")
+	}
+	v := &validator{schema: s, plain: opts.PlainUnions}
+	v.check(s.root, root, "", 0)
+	return v.errs, nil
+}
+
+type validator struct {
+	schema *parsedSchema
+	plain  bool
+	errs   []ValidationError
+}
+
+func (v *validator) fail(kind, path string, node, value interface{}, format string, args ...interface{}) {
+	if len(v.errs) >= maxValidationErrors {
+		return
+	}
+	v.errs = append(v.errs, ValidationError{
+		Kind:     kind,
+		Path:     path,
+		Expected: v.describe(node),
+		Actual:   jsonType(value),
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// check validates value against schema node at path. depth guards against
+// documents nested deeper than any sensible datum.
+func (v *validator) check(node, value interface{}, path string, depth int) {
+	if depth > 2*maxSampleDepth+64 {
+		v.fail(ViolationWrongType, path, node, value, "value is nested too deeply")
+		return
+	}
+	switch n := node.(type) {
+	case string:
+		v.checkPrimitive(n, value, path, depth)
+	case []interface{}:
+		v.checkUnion(n, value, path, depth)
+	case map[string]interface{}:
+		t, _ := n["type"].(string)
+		switch t {
+		case "record", "error":
+			rec, ok := value.(map[string]interface{})
+			if !ok {
+				v.fail(ViolationWrongType, path, node, value, "expected an object")
+				return
+			}
+			fields, _ := n["fields"].([]interface{})
+			known := make(map[string]bool, len(fields))
+			for _, f := range fields {
+				field, _ := f.(map[string]interface{})
+				name, _ := field["name"].(string)
+				known[name] = true
+				fieldPath := joinPath(path, name)
+				item, present := rec[name]
+				if !present {
+					if _, hasDefault := field["default"]; !hasDefault {
+						v.fail(ViolationMissingField, fieldPath, field["type"], removeValue, "required field %q is missing", name)
+					}
+					continue
+				}
+				if item == nil && !nullable(field["type"]) {
+					v.fail(ViolationNullField, fieldPath, field["type"], item, "field %q is not nullable", name)
+					continue
+				}
+				v.check(field["type"], item, fieldPath, depth+1)
+			}
+			names := make([]string, 0, len(rec))
+			for name := range rec {
+				if !known[name] {
+					names = append(names, name)
+				}
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				v.fail(ViolationUnknownField, joinPath(path, name), node, rec[name], "%s has no field %q", n["name"], name)
+			}
+		case "enum":
+			symbol, ok := value.(string)
+			if !ok {
+				v.fail(ViolationWrongType, path, node, value, "expected a string")
+				return
+			}
+			if symbols, _ := n["symbols"].([]interface{}); !containsSymbol(symbols, symbol) {
+				v.fail(ViolationUnknownSymbol, path, node, value, "%q is not a symbol of %s", symbol, n["name"])
+			}
+		case "fixed":
+			s, ok := value.(string)
+			if !ok {
+				v.fail(ViolationWrongType, path, node, value, "expected a string")
+				return
+			}
+			// Avro JSON writes each byte as the code point of its value.
+			if size, _ := n["size"].(float64); utf8.RuneCountInString(s) != int(size) {
+				v.fail(ViolationFixedSize, path, node, value, "expected %d bytes, got %d", int(size), utf8.RuneCountInString(s))
+			}
+		case "array":
+			items, ok := value.([]interface{})
+			if !ok {
+				v.fail(ViolationWrongType, path, node, value, "expected an array")
+				return
+			}
+			for i, item := range items {
+				v.check(n["items"], item, fmt.Sprintf("%s[%d]", path, i), depth+1)
+			}
+		case "map":
+			values, ok := value.(map[string]interface{})
+			if !ok {
+				v.fail(ViolationWrongType, path, node, value, "expected an object")
+				return
+			}
+			keys := make([]string, 0, len(values))
+			for k := range values {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				v.check(n["values"], values[k], fmt.Sprintf("%s[%q]", path, k), depth+1)
+			}
+		default:
+			// Logical types are written as their underlying type.
+			v.checkPrimitive(t, value, path, depth)
+		}
+	}
+}
+
+func (v *validator) checkPrimitive(name string, value interface{}, path string, depth int) {
+	ok := true
+	switch name {
+	case "null":
+		ok = value == nil
+	case "boolean":
+		_, ok = value.(bool)
+	case "int", "long":
+		num, isNum := value.(json.Number)
+		if !isNum {
+			ok = false
+			break
+		}
+		bits := 32
+		if name == "long" {
+			bits = 64
+		}
+		if _, err := strconv.ParseInt(string(num), 10, bits); err != nil {
+			if strings.ContainsAny(string(num), ".eE") {
+				v.fail(ViolationWrongType, path, name, value, "%s is not an integer", num)
+			} else {
+				v.fail(ViolationIntOverflow, path, name, value, "%s is out of range for %s", num, name)
+			}
+			return
+		}
+	case "float", "double":
+		_, ok = value.(json.Number)
+	case "bytes", "string":
+		_, ok = value.(string)
+	default:
+		if def, known := v.schema.named[name]; known {
+			v.check(def, value, path, depth+1)
+			return
+		}
+		v.fail(ViolationWrongType, path, name, value, "unknown type %q", name)
+		return
+	}
+	if !ok {
+		v.fail(ViolationWrongType, path, name, value, "expected %s", v.describe(name))
+	}
+}
+
+func (v *validator) checkUnion(branches []interface{}, value interface{}, path string, depth int) {
+	if value == nil {
+		if !nullable(branches) {
+			v.fail(ViolationWrongType, path, branches, value, "union has no null branch")
+		}
+		return
+	}
+	if wrapped, ok := value.(map[string]interface{}); ok && len(wrapped) == 1 {
+		for typeName, inner := range wrapped {
+			for _, branch := range branches {
+				if branchName(branch) == typeName {
+					v.check(branch, inner, path, depth+1)
+					return
+				}
+			}
+			if !v.plain {
+				v.fail(ViolationUnknownBranch, path, branches, value, "union has no branch %q", typeName)
+				return
+			}
+		}
+	}
+	if !v.plain {
+		v.fail(ViolationWrongType, path, branches, value, `expected a union value wrapped as {"<branch>": value}`)
+		return
+	}
+	// Without wrappers, the value is valid if any branch accepts it.
+	var tried []*validator
+	for _, branch := range branches {
+		if branch == "null" {
+			continue
+		}
+		trial := &validator{schema: v.schema, plain: true}
+		trial.check(branch, value, path, depth+1)
+		if len(trial.errs) == 0 {
+			return
+		}
+		tried = append(tried, trial)
+	}
+	// An optional value has one branch to blame, so its errors say more.
+	if len(tried) == 1 {
+		for _, e := range tried[0].errs {
+			if len(v.errs) < maxValidationErrors {
+				v.errs = append(v.errs, e)
+			}
+		}
+		return
+	}
+	v.fail(ViolationWrongType, path, branches, value, "value matches no branch of the union")
+}
+
+// describe names a schema node for ValidationError.Expected.
+func (v *validator) describe(node interface{}) string {
+	switch n := node.(type) {
+	case string:
+		if def, ok := v.schema.named[n]; ok && !primitiveTypes[n] {
+			return v.describe(def)
+		}
+		return n
+	case []interface{}:
+		names := make([]string, len(n))
+		for i, branch := range n {
+			names[i] = branchName(branch)
+		}
+		return "union [" + strings.Join(names, ", ") + "]"
+	case map[string]interface{}:
+		t, _ := n["type"].(string)
+		switch t {
+		case "record", "error", "enum":
+			return fmt.Sprintf("%s %s", t, n["name"])
+		case "fixed":
+			size, _ := n["size"].(float64)
+			return fmt.Sprintf("fixed %s (%d bytes)", n["name"], int(size))
+		case "array":
+			return "array of " + v.describe(n["items"])
+		case "map":
+			return "map of " + v.describe(n["values"])
+		}
+		if logical, ok := n["logicalType"].(string); ok {
+			return t + " (" + logical + ")"
+		}
+		return t
+	}
+	return ""
+}
+
+// jsonType names the JSON type of a decoded value.
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number, float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return ""
+}
@@ -0,0 +1,88 @@
+package avrojson
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateAgreesWithViolations(t *testing.T) {
+	codec, err := NewCodec(sampleSchema)
+	if err != nil {
+		t.Fatalf("Failed to create codec: %v", err)
+	}
+	native, err := codec.Sample(3)
+	if err != nil {
+		t.Fatalf("Failed to generate sample: %v", err)
+	}
+	binary, err := codec.EncodeNative(native)
+	if err != nil {
+		t.Fatalf("Failed to encode sample: %v", err)
+	}
+	text, err := codec.BinaryToJSON(binary)
+	if err != nil {
+		t.Fatalf("Failed to convert sample: %v", err)
+	}
+	if errs, err := codec.Validate(text, ValidateOptions{}); err != nil || len(errs) != 0 {
+		t.Fatalf("expected the sample to be valid, got %+v: %v", errs, err)
+	}
+
+	violations, err := codec.Violations(text)
+	if err != nil {
+		t.Fatalf("Failed to derive violations: %v", err)
+	}
+	// Every variant the codec rejects is reported at the changed value.
+	for _, v := range violations {
+		errs, err := codec.Validate(v.JSON, ValidateOptions{})
+		if err != nil {
+			t.Fatalf("Failed to validate %s: %v", v.JSON, err)
+		}
+		found := false
+		for _, e := range errs {
+			found = found || (e.Path == v.Path && e.Expected != "" && e.Message != "")
+		}
+		if !found {
+			t.Errorf("%s at %q: expected an error there, got %+v", v.Kind, v.Path, errs)
+		}
+	}
+}
+
+func TestValidateReportsEveryError(t *testing.T) {
+	codec, err := NewCodec(`{"type":"record","name":"R","fields":[
+		{"name":"id","type":"long"},
+		{"name":"tags","type":{"type":"array","items":"string"}},
+		{"name":"note","type":["null","string"],"default":null}]}`)
+	if err != nil {
+		t.Fatalf("Failed to create codec: %v", err)
+	}
+	errs, err := codec.Validate([]byte(`{"tags":["a",2],"note":"plain","extra":true}`), ValidateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to validate: %v", err)
+	}
+	var got []string
+	for _, e := range errs {
+		got = append(got, e.Kind+" "+e.Path+" "+e.Expected+"/"+e.Actual)
+	}
+	want := []string{
+		"missing-field id long/",
+		"wrong-type tags[1] string/number",
+		"wrong-type note union [null, string]/string",
+		"unknown-field extra record R/boolean",
+	}
+	if strings.Join(got, "; ") != strings.Join(want, "; ") {
+		t.Errorf("unexpected errors\n got %q\nwant %q", got, want)
+	}
+
+	// Plain unions take the value as it is.
+	errs, _ = codec.Validate([]byte(`{"id":1,"tags":[],"note":"plain"}`), ValidateOptions{PlainUnions: true})
+	if len(errs) != 0 {
+		t.Errorf("expected an unwrapped union value to be accepted, got %+v", errs)
+	}
+	// An optional value is checked against its one branch.
+	errs, _ = codec.Validate([]byte(`{"id":1,"tags":[],"note":3}`), ValidateOptions{PlainUnions: true})
+	if len(errs) != 1 || errs[0].Path != "note" || errs[0].Expected != "string" {
+		t.Errorf("expected the string branch of note to be reported, got %+v", errs)
+	}
+	if _, err := codec.Validate([]byte(`{"id":1} {}`), ValidateOptions{}); err == nil {
+		t.Error("expected trailing data to be rejected")
+	}
+}
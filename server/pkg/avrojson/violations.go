@@ -0,0 +1,253 @@
+package avrojson
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Violation kinds.
+const (
+	ViolationMissingField  = "missing-field"
+	ViolationNullField     = "null-field"
+	ViolationWrongType     = "wrong-type"
+	ViolationIntOverflow   = "int-overflow"
+	ViolationUnknownSymbol = "unknown-symbol"
+	ViolationFixedSize     = "fixed-size"
+	ViolationUnknownBranch = "unknown-branch"
+)
+
+// Violation is an Avro JSON datum that breaks the schema in one place.
+type Violation struct {
+	Kind string `json:"kind"`
+	// Path locates the change, e.g. "lines[0].quantity"; it is empty for
+	// the top-level value.
+	Path string `json:"path"`
+	// JSON is the whole datum with the one change.
+	JSON json.RawMessage `json:"json"`
+	// Error is what the codec reports for it.
+	Error string `json:"error"`
+}
+
+// Violations derives invalid variants of text, a valid Avro JSON datum of
+// the codec's schema such as one built from Sample: a required field left
+// out, a value of the wrong JSON type, an int out of range, an unknown enum
+// symbol or union branch and so on, at every position of the datum. Only
+// variants the codec rejects are returned, so each is a negative case for
+// another serializer.
+func (c *Codec) Violations(text []byte) ([]Violation, error) {
+	s, err := c.schemaTree()
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(text))
+	dec.UseNumber()
+	var root interface{}
+	if err := dec.Decode(&root); err != nil {
+		return nil, fmt.Errorf("avrojson: invalid JSON: %w", err)
+	}
+	if _, err := c.JSONToBinary(text); err != nil {
+		return nil, fmt.Errorf("avrojson: datum is not valid: %w", err)
+	}
+
+	v := &violationFinder{schema: s}
+	v.walk(s.root, root, nil, "")
+
+	out := make([]Violation, 0, len(v.edits))
+	for _, e := range v.edits {
+		changed, err := json.Marshal(e.apply(root))
+		if err != nil {
+			return nil, err
+		}
+		_, err = c.JSONToBinary(changed)
+		if err == nil {
+			// goavro tolerates this one, so it is no use as a negative case.
+			continue
+		}
+		out = append(out, Violation{Kind: e.kind, Path: e.path, JSON: changed, Error: err.Error()})
+	}
+	return out, nil
+}
+
+// removeValue marks an edit that deletes the field instead of replacing it.
+var removeValue = new(int)
+
+type violationEdit struct {
+	kind string
+	path string
+	// steps lead from the root to the changed value: object keys and
+	// array indexes.
+	steps []interface{}
+	value interface{}
+}
+
+// apply returns a copy of root with the edit made, sharing the parts it
+// does not touch.
+func (e violationEdit) apply(root interface{}) interface{} {
+	return replaceAt(root, e.steps, e.value)
+}
+
+func replaceAt(v interface{}, steps []interface{}, value interface{}) interface{} {
+	if len(steps) == 0 {
+		return value
+	}
+	switch t := v.(type) {
+	case map[string]interface{}:
+		key := steps[0].(string)
+		out := make(map[string]interface{}, len(t))
+		for k, item := range t {
+			out[k] = item
+		}
+		if len(steps) == 1 && value == removeValue {
+			delete(out, key)
+		} else {
+			out[key] = replaceAt(t[key], steps[1:], value)
+		}
+		return out
+	case []interface{}:
+		i := steps[0].(int)
+		out := append([]interface{}(nil), t...)
+		out[i] = replaceAt(t[i], steps[1:], value)
+		return out
+	}
+	return v
+}
+
+type violationFinder struct {
+	schema *parsedSchema
+	edits  []violationEdit
+	// seen keeps one edit per kind and schema position, so arrays and
+	// recursive types do not repeat the same case.
+	seen map[string]bool
+}
+
+func (v *violationFinder) add(kind, path string, steps []interface{}, value interface{}) {
+	if v.seen == nil {
+		v.seen = make(map[string]bool)
+	}
+	key := kind + " " + path
+	if v.seen[key] {
+		return
+	}
+	v.seen[key] = true
+	v.edits = append(v.edits, violationEdit{
+		kind:  kind,
+		path:  path,
+		steps: append([]interface{}(nil), steps...),
+		value: value,
+	})
+}
+
+// walk records the edits for the value at steps, of schema node.
+func (v *violationFinder) walk(node, value interface{}, steps []interface{}, path string) {
+	if len(steps) > 2*maxSampleDepth {
+		return
+	}
+	switch n := node.(type) {
+	case string:
+		switch n {
+		case "null":
+			v.add(ViolationWrongType, path, steps, "null")
+		case "boolean":
+			v.add(ViolationWrongType, path, steps, "true")
+		case "int":
+			v.add(ViolationWrongType, path, steps, "1")
+			v.add(ViolationIntOverflow, path, steps, json.Number("2147483648"))
+		case "long":
+			v.add(ViolationWrongType, path, steps, "1")
+			v.add(ViolationIntOverflow, path, steps, json.Number("9223372036854775808"))
+		case "float", "double":
+			v.add(ViolationWrongType, path, steps, "1.5")
+		case "bytes", "string":
+			v.add(ViolationWrongType, path, steps, json.Number("1"))
+		default:
+			if def, ok := v.schema.named[n]; ok {
+				v.walk(def, value, steps, path)
+			}
+		}
+
+	case []interface{}:
+		v.add(ViolationUnknownBranch, path, steps, map[string]interface{}{"no.such.Type": value})
+		wrapped, ok := value.(map[string]interface{})
+		if !ok || len(wrapped) != 1 {
+			return
+		}
+		for typeName, inner := range wrapped {
+			for _, branch := range n {
+				if branchName(branch) == typeName {
+					v.walk(branch, inner, append(steps, typeName), path)
+				}
+			}
+		}
+
+	case map[string]interface{}:
+		t, _ := n["type"].(string)
+		switch t {
+		case "record", "error":
+			v.add(ViolationWrongType, path, steps, "record")
+			rec, ok := value.(map[string]interface{})
+			if !ok {
+				return
+			}
+			fields, _ := n["fields"].([]interface{})
+			for _, f := range fields {
+				field, _ := f.(map[string]interface{})
+				name, _ := field["name"].(string)
+				fieldSteps := append(append([]interface{}(nil), steps...), name)
+				fieldPath := joinPath(path, name)
+				if _, hasDefault := field["default"]; !hasDefault {
+					v.add(ViolationMissingField, fieldPath, fieldSteps, removeValue)
+				}
+				if !nullable(field["type"]) {
+					v.add(ViolationNullField, fieldPath, fieldSteps, nil)
+				}
+				if item, ok := rec[name]; ok {
+					v.walk(field["type"], item, fieldSteps, fieldPath)
+				}
+			}
+		case "enum":
+			v.add(ViolationWrongType, path, steps, json.Number("0"))
+			symbols, _ := n["symbols"].([]interface{})
+			unknown := "NOT_A_SYMBOL"
+			for containsSymbol(symbols, unknown) {
+				unknown += "_"
+			}
+			v.add(ViolationUnknownSymbol, path, steps, unknown)
+		case "fixed":
+			v.add(ViolationWrongType, path, steps, json.Number("0"))
+			size, _ := n["size"].(float64)
+			v.add(ViolationFixedSize, path, steps, strings.Repeat("x", int(size)+1))
+		case "array":
+			v.add(ViolationWrongType, path, steps, "array")
+			items, _ := value.([]interface{})
+			if len(items) > 0 {
+				v.walk(n["items"], items[0], append(steps, 0), path+"[0]")
+			}
+		case "map":
+			v.add(ViolationWrongType, path, steps, "map")
+			values, _ := value.(map[string]interface{})
+			keys := make([]string, 0, len(values))
+			for k := range values {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			if len(keys) > 0 {
+				v.walk(n["values"], values[keys[0]], append(steps, keys[0]), fmt.Sprintf("%s[%q]", path, keys[0]))
+			}
+		default:
+			// Logical types are written as their underlying type.
+			v.walk(t, value, steps, path)
+		}
+	}
+}
+
+func containsSymbol(symbols []interface{}, s string) bool {
+	for _, symbol := range symbols {
+		if symbol == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package avrojson
+
+import "testing"
+
+func TestViolations(t *testing.T) {
+	codec, err := NewCodec(sampleSchema)
+	if err != nil {
+		t.Fatalf("Failed to create codec: %v", err)
+	}
+	native, err := codec.Sample(3)
+	if err != nil {
+		t.Fatalf("Failed to generate sample: %v", err)
+	}
+	binary, err := codec.EncodeNative(native)
+	if err != nil {
+		t.Fatalf("Failed to encode sample: %v", err)
+	}
+	text, err := codec.BinaryToJSON(binary)
+	if err != nil {
+		t.Fatalf("Failed to convert sample: %v", err)
+	}
+
+	violations, err := codec.Violations(text)
+	if err != nil {
+		t.Fatalf("Failed to derive violations: %v", err)
+	}
+	found := make(map[string]bool)
+	for _, v := range violations {
+		if _, err := codec.JSONToBinary(v.JSON); err == nil {
+			t.Errorf("%s at %q: expected the codec to reject %s", v.Kind, v.Path, v.JSON)
+		}
+		found[v.Kind+" "+v.Path] = true
+	}
+	for _, want := range []string{
+		"missing-field orderId",
+		"wrong-type customer_email",
+		"unknown-symbol status",
+		"int-overflow lines[0].quantity",
+		"fixed-size lines[0].sku",
+		"null-field createdAt",
+		"unknown-branch shipTo",
+	} {
+		if !found[want] {
+			t.Errorf("expected a %s violation", want)
+		}
+	}
+
+	if _, err := codec.Violations([]byte(`{"orderId":"x"}`)); err == nil {
+		t.Error("expected an invalid datum to be refused")
+	}
+}
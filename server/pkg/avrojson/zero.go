@@ -0,0 +1,150 @@
+package avrojson
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// maxZeroDepth bounds recursion for schemas that can only terminate through
+// a non-null branch.
+const maxZeroDepth = 32
+
+// ZeroValue returns the smallest valid native datum for the codec's schema:
+// zero numbers, empty strings (the nil UUID for uuids) and collections,
+// the first enum symbol and null for nullable unions. It is used to smoke-test codecs without sample
+// data.
+func (c *Codec) ZeroValue() (interface{}, error) {
+	s, err := c.schemaTree()
+	if err != nil {
+		return nil, err
+	}
+	z := &zeroBuilder{schema: s}
+	return z.value(s.root, 0)
+}
+
+type zeroBuilder struct {
+	schema *parsedSchema
+}
+
+func (z *zeroBuilder) value(node interface{}, depth int) (interface{}, error) {
+	if depth > maxZeroDepth {
+		return nil, fmt.Errorf("schema nests deeper than %d levels without a null branch", maxZeroDepth)
+	}
+
+	switch n := node.(type) {
+	case string:
+		switch n {
+		case "null":
+			return nil, nil
+		case "boolean":
+			return false, nil
+		case "int":
+			return int32(0), nil
+		case "long":
+			return int64(0), nil
+		case "float":
+			return float32(0), nil
+		case "double":
+			return float64(0), nil
+		case "bytes":
+			return []byte{}, nil
+		case "string":
+			return "", nil
+		}
+		def, ok := z.schema.named[n]
+		if !ok {
+			return nil, fmt.Errorf("unknown type %q", n)
+		}
+		return z.value(def, depth+1)
+
+	case []interface{}:
+		if len(n) == 0 {
+			return nil, fmt.Errorf("empty union")
+		}
+		for _, branch := range n {
+			if branch == "null" {
+				return nil, nil
+			}
+		}
+		inner, err := z.value(n[0], depth+1)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{branchName(n[0]): inner}, nil
+
+	case map[string]interface{}:
+		if logical, ok := n["logicalType"].(string); ok {
+			switch logical {
+			case "timestamp-millis", "timestamp-micros", "local-timestamp-millis", "local-timestamp-micros", "date":
+				return time.Unix(0, 0).UTC(), nil
+			case "time-millis", "time-micros":
+				return time.Duration(0), nil
+			case "decimal":
+				return big.NewRat(0, 1), nil
+			case "uuid":
+				if n["type"] == "string" {
+					return UUID{}.String(), nil
+				}
+			}
+		}
+
+		t, _ := n["type"].(string)
+		switch t {
+		case "enum":
+			symbols, _ := n["symbols"].([]interface{})
+			if len(symbols) == 0 {
+				return nil, fmt.Errorf("enum %q has no symbols", n["name"])
+			}
+			return symbols[0], nil
+		case "fixed":
+			size, _ := n["size"].(float64)
+			return make([]byte, int(size)), nil
+		case "record", "error":
+			record := make(map[string]interface{})
+			fields, _ := n["fields"].([]interface{})
+			for _, f := range fields {
+				field, _ := f.(map[string]interface{})
+				name, _ := field["name"].(string)
+				v, err := z.value(field["type"], depth+1)
+				if err != nil {
+					return nil, fmt.Errorf("field %q: %w", name, err)
+				}
+				record[name] = v
+			}
+			return record, nil
+		case "array":
+			return []interface{}{}, nil
+		case "map":
+			return map[string]interface{}{}, nil
+		default:
+			return z.value(t, depth+1)
+		}
+	}
+	return nil, fmt.Errorf("unsupported schema node %v", node)
+}
+
+// SelfCheck encodes and decodes the codec's zero value and verifies the
+// result re-encodes to the same bytes.
+func (c *Codec) SelfCheck() error {
+	zero, err := c.ZeroValue()
+	if err != nil {
+		return fmt.Errorf("build zero value: %w", err)
+	}
+	binary, err := c.binaryFromNative(zero)
+	if err != nil {
+		return fmt.Errorf("encode zero value: %w", err)
+	}
+	native, err := c.nativeFromBinary(binary)
+	if err != nil {
+		return fmt.Errorf("decode zero value: %w", err)
+	}
+	again, err := c.binaryFromNative(native)
+	if err != nil {
+		return fmt.Errorf("re-encode zero value: %w", err)
+	}
+	if string(again) != string(binary) {
+		return fmt.Errorf("round trip changed %d bytes into %d bytes", len(binary), len(again))
+	}
+	return nil
+}
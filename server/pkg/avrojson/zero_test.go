@@ -0,0 +1,42 @@
+package avrojson
+
+import "testing"
+
+func TestSelfCheckSchemaShapes(t *testing.T) {
+	schemas := map[string]string{
+		"LogWrapper": WrapperSchema,
+		"LogData":    LogDataSchema,
+		"primitive":  `"string"`,
+		"nested": `{"type":"record","name":"Outer","namespace":"exp","fields":[
+			{"name":"kind","type":{"type":"enum","name":"Kind","symbols":["A","B"]}},
+			{"name":"hash","type":{"type":"fixed","name":"Hash","size":4}},
+			{"name":"inner","type":{"type":"record","name":"Inner","fields":[{"name":"n","type":"int"}]}},
+			{"name":"more","type":{"type":"array","items":"Inner"}},
+			{"name":"pick","type":["Inner","string"]},
+			{"name":"at","type":{"type":"long","logicalType":"timestamp-millis"}},
+			{"name":"price","type":{"type":"bytes","logicalType":"decimal","precision":9,"scale":2}}
+		]}`,
+		"recursive": `{"type":"record","name":"Node","fields":[{"name":"next","type":["null","Node"]}]}`,
+	}
+	for name, schema := range schemas {
+		codec, err := NewCodec(schema)
+		if err != nil {
+			t.Fatalf("%s: Failed to create codec: %v", name, err)
+		}
+		if err := codec.SelfCheck(); err != nil {
+			t.Errorf("%s: self-check failed: %v", name, err)
+		}
+	}
+}
+
+func TestSelfCheckUnterminatedRecursion(t *testing.T) {
+	codec, err := NewCodec(`{"type":"record","name":"Loop","fields":[{"name":"next","type":{"type":"array","items":"Loop"}},{"name":"self","type":["Loop","null"]}]}`)
+	if err != nil {
+		t.Fatalf("Failed to create codec: %v", err)
+	}
+	// The null branch is preferred even when it is not first, so this
+	// terminates.
+	if err := codec.SelfCheck(); err != nil {
+		t.Errorf("expected recursion through a nullable union to terminate: %v", err)
+	}
+}
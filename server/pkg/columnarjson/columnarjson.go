@@ -0,0 +1,274 @@
+// Package columnarjson reads and writes the columnar JSON format: a batch of
+// records of one Avro record schema written once as the schema, the order
+// of the fields and one array of field values per record,
+//
+//	{
+//	  "schema": "{\"type\":\"record\",\"name\":\"User\",\"fields\":[...]}",
+//	  "field_order": ["id", "name", "email"],
+//	  "rows": [[1, "ann", "ann@example.com"], [2, "bob", null]]
+//	}
+//
+// so field names are not repeated for every record as in plain JSON, while
+// the document stays JSON any client can read. Nested records are arrays
+// too, in the order of their schema fields. Values of ["null", T] unions are
+// written plain and values of other unions as {"type": value}; bytes and
+// fixed are base64, decimals are strings and timestamps, dates and times
+// of day are integers of their unit.
+//
+// field_order lets a reader take rows written with the fields in another
+// order, or without the fields that have defaults; writers emit every
+// field in schema order. Readers also take the rows under "data", as the
+// optimization experiments of threshold_test.go write them.
+package columnarjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+	"github.com/linkedin/goavro/v2"
+)
+
+// document is the wire form, as documents are read; Writer writes it.
+type document struct {
+	Schema     string          `json:"schema"`
+	FieldOrder []string        `json:"field_order"`
+	Rows       [][]interface{} `json:"rows"`
+	Data       [][]interface{} `json:"data"`
+}
+
+// Codec writes and reads columnar documents of one record schema. It is
+// safe for concurrent use.
+type Codec struct {
+	schema string
+	root   *avroType
+}
+
+// New compiles schema, which must be a record.
+func New(schema string) (*Codec, error) {
+	if _, err := goavro.NewCodec(schema); err != nil {
+		return nil, fmt.Errorf("columnarjson: %w", err)
+	}
+	root, err := parseSchema(schema)
+	if err != nil {
+		return nil, err
+	}
+	if root.kind != "record" {
+		return nil, fmt.Errorf("columnarjson: schema is a %s, not a record", root.kind)
+	}
+	return &Codec{schema: schema, root: root}, nil
+}
+
+// Schema returns the schema the codec was compiled from.
+func (c *Codec) Schema() string { return c.schema }
+
+// FieldOrder returns the names of the record's fields in the order rows
+// hold them.
+func (c *Codec) FieldOrder() []string {
+	names := make([]string, len(c.root.fields))
+	for i, f := range c.root.fields {
+		names[i] = f.name
+	}
+	return names
+}
+
+// Marshal writes records, a slice or array of structs with json tags or of
+// goavro native maps, as a columnar document. Missing fields take their
+// schema defaults.
+func (c *Codec) Marshal(records interface{}) ([]byte, error) {
+	rv := reflect.ValueOf(records)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("columnarjson: cannot marshal %T, want a slice of records", records)
+	}
+	var buf bytes.Buffer
+	w := c.NewWriter(&buf)
+	for i := 0; i < rv.Len(); i++ {
+		if err := w.Write(rv.Index(i).Interface()); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal reads a document written with the codec's schema into v, a
+// pointer to a slice of structs or of map[string]interface{}. A document
+// of another schema is rejected; decode it with the package's Unmarshal.
+func (c *Codec) Unmarshal(data []byte, v interface{}) error {
+	doc, err := readDocument(data)
+	if err != nil {
+		return err
+	}
+	if doc.Schema != c.schema {
+		return errors.New("columnarjson: the document was written with another schema")
+	}
+	return c.unmarshal(doc, v)
+}
+
+// Unmarshal reads a columnar document into v, a pointer to a slice of
+// structs with json tags or of map[string]interface{}, with the schema the
+// document carries. Maps hold goavro's native values, such as time.Time for
+// timestamps and []byte for bytes, but the values of ["null", T] unions are
+// plain rather than wrapped.
+func Unmarshal(data []byte, v interface{}) error {
+	doc, err := readDocument(data)
+	if err != nil {
+		return err
+	}
+	c, err := New(doc.Schema)
+	if err != nil {
+		return err
+	}
+	return c.unmarshal(doc, v)
+}
+
+// Objects reads a columnar document into plain JSON objects, one per row
+// keyed by field name, with the schema the document carries. Every value is
+// checked against the schema; values are kept as written, nested records
+// become objects too and fields missing from field_order take their
+// defaults.
+func Objects(data []byte) ([]map[string]interface{}, error) {
+	doc, err := readDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	c, err := New(doc.Schema)
+	if err != nil {
+		return nil, err
+	}
+	columns, err := c.columns(doc.FieldOrder)
+	if err != nil {
+		return nil, err
+	}
+	objects := make([]map[string]interface{}, len(doc.Rows))
+	for i, row := range doc.Rows {
+		if objects[i], err = c.objectRow(columns, row); err != nil {
+			return nil, fmt.Errorf("columnarjson: row %d: %w", i, err)
+		}
+	}
+	return objects, nil
+}
+
+func readDocument(data []byte) (*document, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc document
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("columnarjson: invalid document: %w", err)
+	}
+	if doc.Schema == "" {
+		return nil, errors.New("columnarjson: invalid document: no schema")
+	}
+	if doc.Data != nil {
+		if doc.Rows != nil {
+			return nil, errors.New("columnarjson: invalid document: both rows and data")
+		}
+		doc.Rows, doc.Data = doc.Data, nil
+	}
+	return &doc, nil
+}
+
+func (c *Codec) unmarshal(doc *document, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("columnarjson: cannot unmarshal into %T, want a pointer to a slice", v)
+	}
+	columns, err := c.columns(doc.FieldOrder)
+	if err != nil {
+		return err
+	}
+	slice := rv.Elem()
+	out := reflect.MakeSlice(slice.Type(), len(doc.Rows), len(doc.Rows))
+	for i, row := range doc.Rows {
+		record, err := c.decodeRow(columns, row)
+		if err != nil {
+			return fmt.Errorf("columnarjson: row %d: %w", i, err)
+		}
+		elem := out.Index(i)
+		if elem.Kind() == reflect.Map && elem.Type().Key().Kind() == reflect.String && elem.Type().Elem().Kind() == reflect.Interface {
+			elem.Set(reflect.ValueOf(record).Convert(elem.Type()))
+			continue
+		}
+		if err := avrojson.FromNative(record, elem.Addr().Interface()); err != nil {
+			return fmt.Errorf("columnarjson: row %d: %w", i, err)
+		}
+	}
+	slice.Set(out)
+	return nil
+}
+
+// columns maps the document's field order to the schema's fields. Fields
+// missing from it must have defaults or be nullable.
+func (c *Codec) columns(order []string) ([]*avroField, error) {
+	columns := make([]*avroField, len(order))
+	seen := make(map[string]bool, len(order))
+	for i, name := range order {
+		index, ok := c.root.index[name]
+		if !ok {
+			return nil, fmt.Errorf("columnarjson: field_order names %q, which is not a field of %s", name, c.root.name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("columnarjson: field_order names %q twice", name)
+		}
+		seen[name] = true
+		columns[i] = c.root.fields[index]
+	}
+	for _, f := range c.root.fields {
+		if _, nullable := f.typ.nullable(); !seen[f.name] && !f.hasDefault && !nullable {
+			return nil, fmt.Errorf("columnarjson: field_order lacks %q, which has no default", f.name)
+		}
+	}
+	return columns, nil
+}
+
+func (c *Codec) decodeRow(columns []*avroField, row []interface{}) (map[string]interface{}, error) {
+	if len(row) != len(columns) {
+		return nil, fmt.Errorf("%d values for the %d fields of field_order", len(row), len(columns))
+	}
+	record := make(map[string]interface{}, len(c.root.fields))
+	for i, f := range columns {
+		value, err := f.typ.decode(row[i])
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", f.name, err)
+		}
+		record[f.name] = value
+	}
+	for _, f := range c.root.fields {
+		if _, ok := record[f.name]; ok {
+			continue
+		}
+		value, err := f.defaultValue()
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", f.name, err)
+		}
+		record[f.name] = value
+	}
+	return record, nil
+}
+
+func (c *Codec) objectRow(columns []*avroField, row []interface{}) (map[string]interface{}, error) {
+	record, err := c.decodeRow(columns, row)
+	if err != nil {
+		return nil, err
+	}
+	object := make(map[string]interface{}, len(c.root.fields))
+	for i, f := range columns {
+		object[f.name] = f.typ.object(row[i])
+	}
+	for _, f := range c.root.fields {
+		if _, ok := object[f.name]; ok {
+			continue
+		}
+		value, err := f.typ.encode(record[f.name])
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", f.name, err)
+		}
+		object[f.name] = f.typ.object(value)
+	}
+	return object, nil
+}
@@ -0,0 +1,328 @@
+package columnarjson
+
+import (
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+)
+
+type testItem struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	Quantity int32  `json:"quantity"`
+}
+
+type testCharacter struct {
+	ID        int64             `json:"id"`
+	Name      string            `json:"name"`
+	Level     int32             `json:"level"`
+	Score     float64           `json:"score"`
+	Active    bool              `json:"active"`
+	Nickname  *string           `json:"nickname"`
+	Tags      []string          `json:"tags"`
+	Settings  map[string]string `json:"settings"`
+	Items     []testItem        `json:"items"`
+	Avatar    []byte            `json:"avatar"`
+	Checksum  [4]byte           `json:"checksum"`
+	Balance   big.Rat           `json:"balance"`
+	CreatedAt time.Time         `json:"created_at"`
+	PlayTime  time.Duration     `json:"play_time"`
+}
+
+func testCharacters() []testCharacter {
+	nick := "ace"
+	var balance big.Rat
+	balance.SetString("1234.5")
+	return []testCharacter{
+		{
+			ID: 1, Name: "Warrior", Level: 42, Score: 98.5, Active: true, Nickname: &nick,
+			Tags: []string{"tank", "melee"}, Settings: map[string]string{"theme": "dark"},
+			Items:  []testItem{{ID: 10, Name: "Sword", Quantity: 1}, {ID: 11, Name: "Potion", Quantity: 5}},
+			Avatar: []byte{0, 1, 2, 255}, Checksum: [4]byte{0xde, 0xad, 0xbe, 0xef}, Balance: balance,
+			CreatedAt: time.UnixMilli(1700000000123).UTC(), PlayTime: 90 * time.Minute,
+		},
+		{ID: 2, Name: "Mage", Tags: []string{}, Settings: map[string]string{}, Items: []testItem{}, CreatedAt: time.UnixMilli(0).UTC()},
+	}
+}
+
+func TestStructRoundTrip(t *testing.T) {
+	schema, err := avrojson.SchemaOf(testCharacter{})
+	if err != nil {
+		t.Fatalf("Failed to generate schema: %v", err)
+	}
+	codec, err := New(schema)
+	if err != nil {
+		t.Fatalf("Failed to create codec: %v", err)
+	}
+	characters := testCharacters()
+	data, err := codec.Marshal(characters)
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+
+	var doc struct {
+		Schema     string          `json:"schema"`
+		FieldOrder []string        `json:"field_order"`
+		Rows       [][]interface{} `json:"rows"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("The document is not JSON: %v", err)
+	}
+	if doc.Schema != schema || !reflect.DeepEqual(doc.FieldOrder, codec.FieldOrder()) || len(doc.Rows) != 2 {
+		t.Fatalf("unexpected document %s", data)
+	}
+	if items := doc.Rows[0][8].([]interface{}); len(items) != 2 || !reflect.DeepEqual(items[0], []interface{}{10.0, "Sword", 1.0}) {
+		t.Errorf("expected nested records as arrays, got %v", doc.Rows[0][8])
+	}
+	if doc.Rows[0][5] != "ace" || doc.Rows[1][5] != nil {
+		t.Errorf("expected nullable values to be plain, got %v and %v", doc.Rows[0][5], doc.Rows[1][5])
+	}
+
+	var back []testCharacter
+	if err := Unmarshal(data, &back); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if len(back) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(back))
+	}
+	if back[0].Balance.Cmp(&characters[0].Balance) != 0 {
+		t.Errorf("balance %s, want %s", back[0].Balance.RatString(), characters[0].Balance.RatString())
+	}
+	for i := range back {
+		back[i].Balance, characters[i].Balance = big.Rat{}, big.Rat{}
+	}
+	if !reflect.DeepEqual(back, characters) {
+		t.Errorf("round trip changed the records:\n got %+v\nwant %+v", back, characters)
+	}
+
+	var again []testCharacter
+	if err := codec.Unmarshal(data, &again); err != nil || len(again) != 2 {
+		t.Errorf("Codec.Unmarshal gave %d records, %v", len(again), err)
+	}
+	other, _ := New(`{"type":"record","name":"Other","fields":[{"name":"id","type":"long"}]}`)
+	if err := other.Unmarshal(data, &again); err == nil {
+		t.Error("expected a document of another schema to be rejected")
+	}
+}
+
+func TestMapsAndUnions(t *testing.T) {
+	schema := `{"type":"record","name":"Event","namespace":"test","fields":[
+		{"name":"id","type":"long"},
+		{"name":"origin","type":{"type":"record","name":"Point","fields":[{"name":"x","type":"int"},{"name":"y","type":"int"}]}},
+		{"name":"payload","type":["null","string","long","Point"],"default":null},
+		{"name":"at","type":{"type":"long","logicalType":"timestamp-millis"}},
+		{"name":"kind","type":{"type":"enum","name":"Kind","symbols":["A","B"]}}
+	]}`
+	codec, err := New(schema)
+	if err != nil {
+		t.Fatalf("Failed to create codec: %v", err)
+	}
+	at := time.UnixMilli(1700000000000).UTC()
+	records := []map[string]interface{}{
+		{"id": int64(1), "payload": map[string]interface{}{"long": int64(7)}, "at": at, "kind": "A", "origin": map[string]interface{}{"x": int32(1), "y": int32(2)}},
+		{"id": int64(2), "payload": "text", "at": at, "kind": "B", "origin": map[string]interface{}{"x": int32(0), "y": int32(0)}},
+		{"id": int64(3), "at": at, "kind": "A", "origin": map[string]interface{}{"x": int32(3), "y": int32(4)},
+			"payload": map[string]interface{}{"test.Point": map[string]interface{}{"x": int32(5), "y": int32(6)}}},
+	}
+	data, err := codec.Marshal(records)
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+	if !strings.Contains(string(data), `[1,[1,2],{"long":7},1700000000000,"A"]`) {
+		t.Errorf("unexpected rows in %s", data)
+	}
+
+	var back []map[string]interface{}
+	if err := Unmarshal(data, &back); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	want := []map[string]interface{}{
+		{"id": int64(1), "payload": map[string]interface{}{"long": int64(7)}, "at": at, "kind": "A", "origin": map[string]interface{}{"x": int32(1), "y": int32(2)}},
+		{"id": int64(2), "payload": map[string]interface{}{"string": "text"}, "at": at, "kind": "B", "origin": map[string]interface{}{"x": int32(0), "y": int32(0)}},
+		{"id": int64(3), "at": at, "kind": "A", "origin": map[string]interface{}{"x": int32(3), "y": int32(4)},
+			"payload": map[string]interface{}{"test.Point": map[string]interface{}{"x": int32(5), "y": int32(6)}}},
+	}
+	if !reflect.DeepEqual(back, want) {
+		t.Errorf("round trip changed the records:\n got %v\nwant %v", back, want)
+	}
+
+	// The decoded maps are goavro's native form, so they encode as Avro.
+	avro, _ := avrojson.NewCodec(schema)
+	for i, record := range back {
+		if _, err := avro.EncodeNative(record); err != nil {
+			t.Errorf("record %d does not encode as Avro: %v", i, err)
+		}
+	}
+}
+
+func TestFieldOrderAndDefaults(t *testing.T) {
+	schema := `{"type":"record","name":"User","fields":[
+		{"name":"id","type":"long"},
+		{"name":"name","type":"string"},
+		{"name":"email","type":["null","string"]},
+		{"name":"role","type":"string","default":"member"}
+	]}`
+	data := []byte(`{"schema":` + jsonString(schema) + `,"field_order":["name","id"],"rows":[["ann",1],["bob",2]]}`)
+	type user struct {
+		ID    int64   `json:"id"`
+		Name  string  `json:"name"`
+		Email *string `json:"email"`
+		Role  string  `json:"role"`
+	}
+	var users []user
+	if err := Unmarshal(data, &users); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	want := []user{{ID: 1, Name: "ann", Role: "member"}, {ID: 2, Name: "bob", Role: "member"}}
+	if !reflect.DeepEqual(users, want) {
+		t.Errorf("got %+v, want %+v", users, want)
+	}
+
+	for name, doc := range map[string]string{
+		"missing field":  `"field_order":["role","email"],"rows":[]`,
+		"unknown field":  `"field_order":["id","name","age"],"rows":[]`,
+		"repeated field": `"field_order":["id","name","id"],"rows":[]`,
+		"short row":      `"field_order":["id","name"],"rows":[[1]]`,
+		"wrong type":     `"field_order":["id","name"],"rows":[["1","ann"]]`,
+	} {
+		if err := Unmarshal([]byte(`{"schema":`+jsonString(schema)+`,`+doc+`}`), &users); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	// Writers fill in defaults too, and reject missing required fields.
+	codec, _ := New(schema)
+	data, err := codec.Marshal([]map[string]interface{}{{"id": 3, "name": "cy"}})
+	if err != nil || !strings.Contains(string(data), `"rows":[[3,"cy",null,"member"]]`) {
+		t.Errorf("Marshal gave %s, %v", data, err)
+	}
+	if _, err := codec.Marshal([]map[string]interface{}{{"id": 3}}); err == nil || !strings.Contains(err.Error(), "field name is missing") {
+		t.Errorf("expected a missing field to be rejected, got %v", err)
+	}
+}
+
+func TestLogDataRoundTrip(t *testing.T) {
+	codec, err := New(avrojson.LogDataSchema)
+	if err != nil {
+		t.Fatalf("Failed to create codec: %v", err)
+	}
+	logs := []avrojson.LogData{
+		{Timestamp: time.UnixMilli(1700000000000).UTC(), Logtype: "login", Version: "1.0", Issuer: "auth", Metadata: map[string]string{"ip": "10.0.0.1"}},
+		{Timestamp: time.UnixMilli(1700000000001).UTC(), Logtype: "logout", Version: "1.0", Issuer: "auth"},
+	}
+	data, err := codec.Marshal(logs)
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+	var back []avrojson.LogData
+	if err := codec.Unmarshal(data, &back); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(back, logs) {
+		t.Errorf("round trip changed the logs:\n got %+v\nwant %+v", back, logs)
+	}
+
+	// The schema is written once, so batches soon beat plain JSON.
+	batch := make([]avrojson.LogData, 50)
+	for i := range batch {
+		batch[i] = logs[i%2]
+	}
+	columnar, _ := codec.Marshal(batch)
+	plain, _ := json.Marshal(batch)
+	if len(columnar) >= len(plain) {
+		t.Errorf("expected 50 logs to be smaller than plain JSON: %d bytes, %d plain", len(columnar), len(plain))
+	}
+}
+
+func TestNewRejectsNonRecords(t *testing.T) {
+	for _, schema := range []string{`"string"`, `{"type":"array","items":"int"}`, `{"type":"record"`} {
+		if _, err := New(schema); err == nil {
+			t.Errorf("%s: expected an error", schema)
+		}
+	}
+}
+
+func jsonString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+func TestWriterStreamsTheMarshaledDocument(t *testing.T) {
+	codec, _ := New(avrojson.LogDataSchema)
+	logs := []avrojson.LogData{
+		{Timestamp: time.UnixMilli(1).UTC(), Logtype: "a", Version: "1", Issuer: "x"},
+		{Timestamp: time.UnixMilli(2).UTC(), Logtype: "b", Version: "1", Issuer: "y", DomainData: map[string]string{"k": "v"}},
+	}
+	var buf strings.Builder
+	w := codec.NewWriter(&buf)
+	for _, log := range logs {
+		if err := w.Write(log); err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+	}
+	if err := w.Write(map[string]interface{}{"timestamp": "soon"}); err == nil {
+		t.Error("expected an invalid record to be rejected")
+	}
+	if err := w.Close(); err != nil || w.Rows() != 2 {
+		t.Fatalf("Close gave %v after %d rows", err, w.Rows())
+	}
+	marshaled, _ := codec.Marshal(logs)
+	if buf.String() != string(marshaled) {
+		t.Errorf("streamed %s\nmarshaled %s", buf.String(), marshaled)
+	}
+
+	buf.Reset()
+	empty := codec.NewWriter(&buf)
+	if err := empty.Close(); err != nil {
+		t.Fatalf("Failed to close an empty document: %v", err)
+	}
+	var back []map[string]interface{}
+	if err := Unmarshal([]byte(buf.String()), &back); err != nil || len(back) != 0 {
+		t.Errorf("empty document %s gave %v, %v", buf.String(), back, err)
+	}
+}
+
+func TestObjects(t *testing.T) {
+	// The container of threshold_test.go, with a nested record and a
+	// defaulted field added.
+	schema := `{"type":"record","name":"SimpleRecord","fields":[
+		{"name":"id","type":"long"},
+		{"name":"name","type":"string"},
+		{"name":"tags","type":{"type":"array","items":"string"}},
+		{"name":"settings","type":{"type":"map","values":"string"}},
+		{"name":"home","type":["null",{"type":"record","name":"Point","fields":[{"name":"x","type":"int"},{"name":"y","type":"int"}]}]},
+		{"name":"origin","type":"Point","default":{"x":0,"y":0}}
+	]}`
+	data := []byte(`{"schema":` + jsonString(schema) + `,"field_order":["id","name","tags","settings","home"],"data":[` +
+		`[1000,"User_0",["tag_0","common"],{"theme":"dark"},[3,4]],` +
+		`[1001,"User_1",[],{},null]]}`)
+	objects, err := Objects(data)
+	if err != nil {
+		t.Fatalf("Failed to read objects: %v", err)
+	}
+	got, _ := json.Marshal(objects)
+	want := `[{"home":{"x":3,"y":4},"id":1000,"name":"User_0","origin":{"x":0,"y":0},"settings":{"theme":"dark"},"tags":["tag_0","common"]},` +
+		`{"home":null,"id":1001,"name":"User_1","origin":{"x":0,"y":0},"settings":{},"tags":[]}]`
+	if string(got) != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	for name, doc := range map[string]string{
+		"short row":     `"field_order":["id","name","tags","settings","home"],"data":[[1,"ann",[],{}]]`,
+		"long row":      `"field_order":["id","name","tags","settings"],"data":[[1,"ann",[],{},null]]`,
+		"wrong type":    `"field_order":["id","name","tags","settings"],"data":[[1,"ann",[1],{}]]`,
+		"rows and data": `"field_order":["id","name","tags","settings"],"rows":[],"data":[]`,
+	} {
+		if _, err := Objects([]byte(`{"schema":` + jsonString(schema) + `,` + doc + `}`)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if _, err := Objects([]byte(`{"schema":` + jsonString(schema) + `,"field_order":["id","name","tags","settings"],"data":[[1,"ann",[],{}],[2,"bob",[]]]}`)); err == nil || !strings.Contains(err.Error(), "row 1: 3 values for the 4 fields of field_order") {
+		t.Errorf("expected the short row to be named, got %v", err)
+	}
+}
@@ -0,0 +1,224 @@
+package columnarjson
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// avroType is a parsed Avro schema node. Named types are shared, so a
+// recursive record points back at itself.
+type avroType struct {
+	kind     string // a primitive name, "record", "enum", "array", "map", "fixed" or "union"
+	logical  string
+	name     string // full name of records, enums and fixed
+	scale    int    // decimal scale
+	size     int    // fixed size
+	symbols  map[string]bool
+	fields   []*avroField
+	index    map[string]int // field position by name
+	items    *avroType      // array items and map values
+	branches []*avroType
+}
+
+type avroField struct {
+	name       string
+	typ        *avroType
+	def        interface{}
+	hasDefault bool
+}
+
+var primitives = map[string]bool{
+	"null": true, "boolean": true, "int": true, "long": true, "float": true,
+	"double": true, "bytes": true, "string": true,
+}
+
+type schemaParser struct {
+	named map[string]*avroType
+}
+
+func parseSchema(schema string) (*avroType, error) {
+	dec := json.NewDecoder(strings.NewReader(schema))
+	dec.UseNumber()
+	var node interface{}
+	if err := dec.Decode(&node); err != nil {
+		return nil, fmt.Errorf("columnarjson: invalid schema: %w", err)
+	}
+	p := &schemaParser{named: map[string]*avroType{}}
+	t, err := p.parse(node, "")
+	if err != nil {
+		return nil, fmt.Errorf("columnarjson: invalid schema: %w", err)
+	}
+	return t, nil
+}
+
+func (p *schemaParser) parse(node interface{}, namespace string) (*avroType, error) {
+	switch n := node.(type) {
+	case string:
+		if primitives[n] {
+			return &avroType{kind: n}, nil
+		}
+		if t, ok := p.named[fullName(n, namespace)]; ok {
+			return t, nil
+		}
+		if t, ok := p.named[n]; ok {
+			return t, nil
+		}
+		return nil, fmt.Errorf("unknown type %q", n)
+	case []interface{}:
+		union := &avroType{kind: "union"}
+		for _, branch := range n {
+			t, err := p.parse(branch, namespace)
+			if err != nil {
+				return nil, err
+			}
+			union.branches = append(union.branches, t)
+		}
+		return union, nil
+	case map[string]interface{}:
+		return p.parseComplex(n, namespace)
+	}
+	return nil, fmt.Errorf("invalid schema node %v", node)
+}
+
+func (p *schemaParser) parseComplex(n map[string]interface{}, namespace string) (*avroType, error) {
+	kind, _ := n["type"].(string)
+	logical, _ := n["logicalType"].(string)
+	switch kind {
+	case "record", "error", "enum", "fixed":
+		name, _ := n["name"].(string)
+		if name == "" {
+			return nil, fmt.Errorf("%s without a name", kind)
+		}
+		if ns, ok := n["namespace"].(string); ok && !strings.Contains(name, ".") {
+			namespace = ns
+		}
+		t := &avroType{kind: kind, logical: logical, name: fullName(name, namespace)}
+		if kind == "error" {
+			t.kind = "record"
+		}
+		if i := strings.LastIndex(t.name, "."); i >= 0 {
+			namespace = t.name[:i]
+		}
+		p.named[t.name] = t
+		switch t.kind {
+		case "record":
+			return t, p.parseFields(t, n, namespace)
+		case "enum":
+			t.symbols = map[string]bool{}
+			symbols, _ := n["symbols"].([]interface{})
+			for _, s := range symbols {
+				if s, ok := s.(string); ok {
+					t.symbols[s] = true
+				}
+			}
+		case "fixed":
+			t.size = intProperty(n["size"])
+			t.scale = intProperty(n["scale"])
+		}
+		return t, nil
+	case "array", "map":
+		key := "items"
+		if kind == "map" {
+			key = "values"
+		}
+		items, err := p.parse(n[key], namespace)
+		if err != nil {
+			return nil, err
+		}
+		return &avroType{kind: kind, items: items}, nil
+	case "":
+		if inner, ok := n["type"]; ok {
+			return p.parse(inner, namespace)
+		}
+		return nil, errors.New("schema node without a type")
+	}
+	if !primitives[kind] {
+		// {"type": "Name"} refers to a named type.
+		return p.parse(kind, namespace)
+	}
+	return &avroType{kind: kind, logical: logical, scale: intProperty(n["scale"])}, nil
+}
+
+func (p *schemaParser) parseFields(t *avroType, n map[string]interface{}, namespace string) error {
+	fields, _ := n["fields"].([]interface{})
+	t.index = make(map[string]int, len(fields))
+	for _, f := range fields {
+		fm, ok := f.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("record %s: invalid field %v", t.name, f)
+		}
+		name, _ := fm["name"].(string)
+		typ, err := p.parse(fm["type"], namespace)
+		if err != nil {
+			return fmt.Errorf("record %s: field %s: %w", t.name, name, err)
+		}
+		def, hasDefault := fm["default"]
+		t.index[name] = len(t.fields)
+		t.fields = append(t.fields, &avroField{name: name, typ: typ, def: def, hasDefault: hasDefault})
+	}
+	return nil
+}
+
+// logicalTypes are the logical types goavro implements, by
+// <type>.<logical> name. Others are their underlying type.
+var logicalTypes = map[string]bool{
+	"int.date":              true,
+	"int.time-millis":       true,
+	"long.time-micros":      true,
+	"long.timestamp-millis": true,
+	"long.timestamp-micros": true,
+	"bytes.decimal":         true,
+}
+
+// logicalName returns the <type>.<logical> name of a logical type goavro
+// implements, and "" otherwise.
+func (t *avroType) logicalName() string {
+	if name := t.kind + "." + t.logical; logicalTypes[name] {
+		return name
+	}
+	return ""
+}
+
+// branchName is the name a union branch is wrapped with in goavro's native
+// form and in Avro JSON.
+func (t *avroType) branchName() string {
+	if t.name != "" {
+		return t.name
+	}
+	if name := t.logicalName(); name != "" {
+		return name
+	}
+	return t.kind
+}
+
+// nullable returns the non-null branch of a ["null", T] or [T, "null"]
+// union.
+func (t *avroType) nullable() (*avroType, bool) {
+	if t.kind != "union" || len(t.branches) != 2 {
+		return nil, false
+	}
+	switch {
+	case t.branches[0].kind == "null":
+		return t.branches[1], true
+	case t.branches[1].kind == "null":
+		return t.branches[0], true
+	}
+	return nil, false
+}
+
+func fullName(name, namespace string) string {
+	if strings.Contains(name, ".") || namespace == "" {
+		return name
+	}
+	return namespace + "." + name
+}
+
+func intProperty(v interface{}) int {
+	if n, ok := v.(json.Number); ok {
+		i, _ := n.Int64()
+		return int(i)
+	}
+	return 0
+}
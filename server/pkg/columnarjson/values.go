@@ -0,0 +1,612 @@
+package columnarjson
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+)
+
+// encode converts v, a goavro native value or a struct, to its columnar
+// form. nil bytes, arrays and maps, as zero-value structs hold, are empty.
+// Records become arrays of their field values in schema order,
+// values of ["null", T] unions are written plain and other unions as
+// {"type": value}, bytes and fixed are base64 strings, decimals are
+// decimal strings and the time types are integers of their unit.
+func (t *avroType) encode(v interface{}) (interface{}, error) {
+	switch t.kind {
+	case "null":
+		if v == nil {
+			return nil, nil
+		}
+	case "boolean":
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+	case "int", "long":
+		return t.encodeInteger(v)
+	case "float", "double":
+		if f, ok := toFloat64(v); ok {
+			return f, nil
+		}
+	case "string":
+		switch s := v.(type) {
+		case string:
+			return s, nil
+		case []byte:
+			return string(s), nil
+		}
+	case "enum":
+		if s, ok := v.(string); ok {
+			if !t.symbols[s] {
+				return nil, fmt.Errorf("%q is not a symbol of enum %s", s, t.name)
+			}
+			return s, nil
+		}
+	case "bytes", "fixed":
+		if t.logical == "decimal" && t.kind == "bytes" {
+			return t.encodeDecimal(v)
+		}
+		var b []byte
+		switch s := v.(type) {
+		case nil:
+			// Zero-value structs have nil slices.
+		case []byte:
+			b = s
+		case string:
+			b = []byte(s)
+		default:
+			return nil, mismatch(t, v)
+		}
+		if t.kind == "fixed" && len(b) != t.size {
+			return nil, fmt.Errorf("%d bytes for fixed %s of size %d", len(b), t.name, t.size)
+		}
+		return base64.StdEncoding.EncodeToString(b), nil
+	case "array":
+		if v == nil {
+			return []interface{}{}, nil
+		}
+		rv := reflect.ValueOf(v)
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			break
+		}
+		out := make([]interface{}, rv.Len())
+		for i := range out {
+			item, err := t.items.encode(rv.Index(i).Interface())
+			if err != nil {
+				return nil, fmt.Errorf("item %d: %w", i, err)
+			}
+			out[i] = item
+		}
+		return out, nil
+	case "map":
+		if v == nil {
+			return map[string]interface{}{}, nil
+		}
+		rv := reflect.ValueOf(v)
+		if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+			break
+		}
+		out := make(map[string]interface{}, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			key := iter.Key().String()
+			value, err := t.items.encode(iter.Value().Interface())
+			if err != nil {
+				return nil, fmt.Errorf("key %q: %w", key, err)
+			}
+			out[key] = value
+		}
+		return out, nil
+	case "record":
+		return t.encodeRecord(v)
+	case "union":
+		return t.encodeUnion(v)
+	}
+	return nil, mismatch(t, v)
+}
+
+func (t *avroType) encodeRecord(v interface{}) (interface{}, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		native, err := avrojson.ToNative(v)
+		if err != nil {
+			return nil, mismatch(t, v)
+		}
+		m = native
+	}
+	row := make([]interface{}, len(t.fields))
+	for i, f := range t.fields {
+		value, ok := m[f.name]
+		if !ok {
+			if !f.hasDefault {
+				if _, nullable := f.typ.nullable(); !nullable {
+					return nil, fmt.Errorf("record %s: field %s is missing", t.name, f.name)
+				}
+			}
+			def, err := f.defaultValue()
+			if err != nil {
+				return nil, fmt.Errorf("record %s: field %s: %w", t.name, f.name, err)
+			}
+			value = def
+		}
+		encoded, err := f.typ.encode(value)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", f.name, err)
+		}
+		row[i] = encoded
+	}
+	return row, nil
+}
+
+func (t *avroType) encodeUnion(v interface{}) (interface{}, error) {
+	inner, nullable := t.nullable()
+	if m, ok := v.(map[string]interface{}); ok && len(m) == 1 {
+		// goavro's wrapped form names the branch.
+		for name, value := range m {
+			for _, b := range t.branches {
+				if b.branchName() == name {
+					return t.wrap(b, value)
+				}
+			}
+		}
+	}
+	if v == nil {
+		for _, b := range t.branches {
+			if b.kind == "null" {
+				return nil, nil
+			}
+		}
+		return nil, fmt.Errorf("null for a union without a null branch")
+	}
+	if nullable {
+		return inner.encode(v)
+	}
+	for _, b := range t.branches {
+		if b.kind == "null" {
+			continue
+		}
+		if encoded, err := t.wrap(b, v); err == nil {
+			return encoded, nil
+		}
+	}
+	return nil, fmt.Errorf("%T matches no branch of the union", v)
+}
+
+// wrap encodes v as branch b, wrapping it unless the union is nullable.
+func (t *avroType) wrap(b *avroType, v interface{}) (interface{}, error) {
+	encoded, err := b.encode(v)
+	if err != nil {
+		return nil, err
+	}
+	if _, nullable := t.nullable(); nullable || b.kind == "null" {
+		return encoded, nil
+	}
+	return map[string]interface{}{b.branchName(): encoded}, nil
+}
+
+func (t *avroType) encodeInteger(v interface{}) (interface{}, error) {
+	switch t.logicalName() {
+	case "long.timestamp-millis":
+		if tm, ok := v.(time.Time); ok {
+			return tm.UnixMilli(), nil
+		}
+	case "long.timestamp-micros":
+		if tm, ok := v.(time.Time); ok {
+			return tm.UnixMicro(), nil
+		}
+	case "int.date":
+		if tm, ok := v.(time.Time); ok {
+			return int64(math.Floor(float64(tm.Unix()) / 86400)), nil
+		}
+	case "int.time-millis":
+		if d, ok := v.(time.Duration); ok {
+			return d.Milliseconds(), nil
+		}
+	case "long.time-micros":
+		if d, ok := v.(time.Duration); ok {
+			return d.Microseconds(), nil
+		}
+	}
+	n, ok := toInt64(v)
+	if !ok {
+		return nil, mismatch(t, v)
+	}
+	if t.kind == "int" && (n < math.MinInt32 || n > math.MaxInt32) {
+		return nil, fmt.Errorf("%d overflows int", n)
+	}
+	return n, nil
+}
+
+func (t *avroType) encodeDecimal(v interface{}) (interface{}, error) {
+	var r *big.Rat
+	switch n := v.(type) {
+	case *big.Rat:
+		r = n
+	case big.Rat:
+		r = &n
+	case string:
+		var ok bool
+		if r, ok = new(big.Rat).SetString(n); !ok {
+			return nil, fmt.Errorf("%q is not a decimal", n)
+		}
+	default:
+		f, ok := toFloat64(v)
+		if !ok {
+			return nil, mismatch(t, v)
+		}
+		r = new(big.Rat).SetFloat64(f)
+		if r == nil {
+			return nil, fmt.Errorf("%v is not a decimal", f)
+		}
+	}
+	return r.FloatString(t.scale), nil
+}
+
+// decode converts a columnar value back to goavro's native form, except
+// that values of ["null", T] unions stay plain, as avrojson.FromNative
+// accepts them for struct fields.
+func (t *avroType) decode(v interface{}) (interface{}, error) {
+	switch t.kind {
+	case "null":
+		if v == nil {
+			return nil, nil
+		}
+	case "boolean":
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+	case "int", "long":
+		n, ok := toInt64(v)
+		if !ok {
+			break
+		}
+		switch t.logicalName() {
+		case "long.timestamp-millis":
+			return time.UnixMilli(n).UTC(), nil
+		case "long.timestamp-micros":
+			return time.UnixMicro(n).UTC(), nil
+		case "int.date":
+			return time.Unix(n*86400, 0).UTC(), nil
+		case "int.time-millis":
+			return time.Duration(n) * time.Millisecond, nil
+		case "long.time-micros":
+			return time.Duration(n) * time.Microsecond, nil
+		}
+		if t.kind == "int" {
+			if n < math.MinInt32 || n > math.MaxInt32 {
+				return nil, fmt.Errorf("%d overflows int", n)
+			}
+			return int32(n), nil
+		}
+		return n, nil
+	case "float", "double":
+		f, ok := toFloat64(v)
+		if !ok {
+			break
+		}
+		if t.kind == "float" {
+			return float32(f), nil
+		}
+		return f, nil
+	case "string", "enum":
+		s, ok := v.(string)
+		if !ok {
+			break
+		}
+		if t.kind == "enum" && !t.symbols[s] {
+			return nil, fmt.Errorf("%q is not a symbol of enum %s", s, t.name)
+		}
+		return s, nil
+	case "bytes", "fixed":
+		if t.logical == "decimal" && t.kind == "bytes" {
+			text, ok := v.(string)
+			if n, isNumber := v.(json.Number); isNumber {
+				text, ok = n.String(), true
+			}
+			if !ok {
+				break
+			}
+			r, ok := new(big.Rat).SetString(text)
+			if !ok {
+				return nil, fmt.Errorf("%q is not a decimal", text)
+			}
+			return r, nil
+		}
+		s, ok := v.(string)
+		if !ok {
+			break
+		}
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64: %w", err)
+		}
+		if t.kind == "fixed" && len(b) != t.size {
+			return nil, fmt.Errorf("%d bytes for fixed %s of size %d", len(b), t.name, t.size)
+		}
+		return b, nil
+	case "array":
+		items, ok := v.([]interface{})
+		if !ok {
+			break
+		}
+		out := make([]interface{}, len(items))
+		for i, item := range items {
+			decoded, err := t.items.decode(item)
+			if err != nil {
+				return nil, fmt.Errorf("item %d: %w", i, err)
+			}
+			out[i] = decoded
+		}
+		return out, nil
+	case "map":
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			break
+		}
+		out := make(map[string]interface{}, len(m))
+		for key, value := range m {
+			decoded, err := t.items.decode(value)
+			if err != nil {
+				return nil, fmt.Errorf("key %q: %w", key, err)
+			}
+			out[key] = decoded
+		}
+		return out, nil
+	case "record":
+		row, ok := v.([]interface{})
+		if !ok {
+			break
+		}
+		if len(row) != len(t.fields) {
+			return nil, fmt.Errorf("%d values for the %d fields of record %s", len(row), len(t.fields), t.name)
+		}
+		out := make(map[string]interface{}, len(t.fields))
+		for i, f := range t.fields {
+			decoded, err := f.typ.decode(row[i])
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", f.name, err)
+			}
+			out[f.name] = decoded
+		}
+		return out, nil
+	case "union":
+		if v == nil {
+			for _, b := range t.branches {
+				if b.kind == "null" {
+					return nil, nil
+				}
+			}
+			return nil, fmt.Errorf("null for a union without a null branch")
+		}
+		if inner, nullable := t.nullable(); nullable {
+			return inner.decode(v)
+		}
+		if m, ok := v.(map[string]interface{}); ok && len(m) == 1 {
+			for name, value := range m {
+				for _, b := range t.branches {
+					if b.branchName() == name {
+						decoded, err := b.decode(value)
+						if err != nil {
+							return nil, err
+						}
+						return map[string]interface{}{name: decoded}, nil
+					}
+				}
+				return nil, fmt.Errorf("%q is not a branch of the union", name)
+			}
+		}
+		return nil, fmt.Errorf("union value %v is not wrapped in its branch name", v)
+	}
+	return nil, mismatch(t, v)
+}
+
+// object converts a columnar value that decode accepts to plain JSON:
+// records become objects keyed by field name and everything else is kept
+// as written.
+func (t *avroType) object(v interface{}) interface{} {
+	switch t.kind {
+	case "record":
+		row := v.([]interface{})
+		out := make(map[string]interface{}, len(t.fields))
+		for i, f := range t.fields {
+			out[f.name] = f.typ.object(row[i])
+		}
+		return out
+	case "array":
+		items := v.([]interface{})
+		out := make([]interface{}, len(items))
+		for i, item := range items {
+			out[i] = t.items.object(item)
+		}
+		return out
+	case "map":
+		m := v.(map[string]interface{})
+		out := make(map[string]interface{}, len(m))
+		for key, value := range m {
+			out[key] = t.items.object(value)
+		}
+		return out
+	case "union":
+		if v == nil {
+			return nil
+		}
+		if inner, nullable := t.nullable(); nullable {
+			return inner.object(v)
+		}
+		for name, value := range v.(map[string]interface{}) {
+			for _, b := range t.branches {
+				if b.branchName() == name {
+					return map[string]interface{}{name: b.object(value)}
+				}
+			}
+		}
+	}
+	return v
+}
+
+// defaultValue converts the field's schema default, written in Avro JSON,
+// to the native form decode returns. Fields of ["null", T] unions without
+// a default are null.
+func (f *avroField) defaultValue() (interface{}, error) {
+	if !f.hasDefault {
+		return nil, nil
+	}
+	return f.typ.fromAvroJSON(f.def)
+}
+
+// fromAvroJSON converts an Avro JSON value, as schema defaults are
+// written, to native form. It differs from the columnar form for records,
+// which are objects, unions, whose default is of the first branch, and
+// bytes, which are strings of code points 0 to 255.
+func (t *avroType) fromAvroJSON(v interface{}) (interface{}, error) {
+	switch t.kind {
+	case "union":
+		if len(t.branches) == 0 {
+			return nil, fmt.Errorf("empty union")
+		}
+		first := t.branches[0]
+		native, err := first.fromAvroJSON(v)
+		if err != nil || first.kind == "null" {
+			return native, err
+		}
+		if _, nullable := t.nullable(); nullable {
+			return native, nil
+		}
+		return map[string]interface{}{first.branchName(): native}, nil
+	case "record":
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, mismatch(t, v)
+		}
+		out := make(map[string]interface{}, len(t.fields))
+		for _, f := range t.fields {
+			value, ok := m[f.name]
+			var native interface{}
+			var err error
+			if ok {
+				native, err = f.typ.fromAvroJSON(value)
+			} else {
+				native, err = f.defaultValue()
+			}
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", f.name, err)
+			}
+			out[f.name] = native
+		}
+		return out, nil
+	case "array":
+		items, ok := v.([]interface{})
+		if !ok {
+			return nil, mismatch(t, v)
+		}
+		out := make([]interface{}, len(items))
+		for i, item := range items {
+			native, err := t.items.fromAvroJSON(item)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = native
+		}
+		return out, nil
+	case "map":
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, mismatch(t, v)
+		}
+		out := make(map[string]interface{}, len(m))
+		for key, value := range m {
+			native, err := t.items.fromAvroJSON(value)
+			if err != nil {
+				return nil, err
+			}
+			out[key] = native
+		}
+		return out, nil
+	case "bytes", "fixed":
+		s, ok := v.(string)
+		if !ok {
+			return nil, mismatch(t, v)
+		}
+		b := make([]byte, 0, len(s))
+		for _, r := range s {
+			if r > 255 {
+				return nil, fmt.Errorf("code point %U in a bytes default", r)
+			}
+			b = append(b, byte(r))
+		}
+		if t.logical == "decimal" && t.kind == "bytes" {
+			return unscaledDecimal(b, t.scale), nil
+		}
+		return b, nil
+	}
+	return t.decode(v)
+}
+
+// unscaledDecimal reads the big-endian two's complement bytes of a
+// decimal's unscaled value.
+func unscaledDecimal(b []byte, scale int) *big.Rat {
+	n := new(big.Int).SetBytes(b)
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		n.Sub(n, new(big.Int).Lsh(big.NewInt(1), uint(len(b)*8)))
+	}
+	return new(big.Rat).SetFrac(n, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil))
+}
+
+func toInt64(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		i, err := strconv.ParseInt(string(n), 10, 64)
+		if err != nil {
+			f, ferr := n.Float64()
+			if ferr != nil || f != math.Trunc(f) {
+				return 0, false
+			}
+			return int64(f), true
+		}
+		return i, true
+	case float64:
+		return int64(n), n == math.Trunc(n)
+	case float32:
+		return int64(n), float64(n) == math.Trunc(float64(n))
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u := rv.Uint()
+		return int64(u), u <= math.MaxInt64
+	}
+	return 0, false
+}
+
+func toFloat64(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	}
+	if i, ok := toInt64(v); ok {
+		return float64(i), true
+	}
+	return 0, false
+}
+
+func mismatch(t *avroType, v interface{}) error {
+	name := t.kind
+	if t.name != "" {
+		name = t.kind + " " + t.name
+	}
+	return fmt.Errorf("%T is not a valid %s", v, name)
+}
@@ -0,0 +1,97 @@
+package columnarjson
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Writer streams a columnar document one record at a time, for batches
+// too large to hold, such as exports. Nothing is written until the first
+// record or Close, and the document is only complete once Close returns.
+type Writer struct {
+	c      *Codec
+	w      io.Writer
+	rows   int
+	closed bool
+	err    error
+	buf    []byte
+}
+
+// NewWriter starts a document of the codec's schema on w.
+func (c *Codec) NewWriter(w io.Writer) *Writer {
+	return &Writer{c: c, w: w}
+}
+
+// Write appends record, a struct with json tags or a goavro native map, as
+// the next row. A record that does not match the schema is reported
+// without writing anything, so the document stays valid.
+func (w *Writer) Write(record interface{}) error {
+	if w.closed {
+		return errors.New("columnarjson: write after Close")
+	}
+	if w.err != nil {
+		return w.err
+	}
+	row, err := w.c.root.encode(record)
+	if err != nil {
+		return fmt.Errorf("columnarjson: row %d: %w", w.rows, err)
+	}
+	data, err := json.Marshal(row)
+	if err != nil {
+		return fmt.Errorf("columnarjson: row %d: %w", w.rows, err)
+	}
+	w.buf = w.buf[:0]
+	if w.rows == 0 {
+		if w.buf, err = w.c.appendHeader(w.buf); err != nil {
+			return err
+		}
+	} else {
+		w.buf = append(w.buf, ',')
+	}
+	w.buf = append(w.buf, data...)
+	if _, err := w.w.Write(w.buf); err != nil {
+		w.err = err
+		return err
+	}
+	w.rows++
+	return nil
+}
+
+// Rows returns how many records were written.
+func (w *Writer) Rows() int { return w.rows }
+
+// Close ends the document. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if w.err != nil {
+		return w.err
+	}
+	w.buf = w.buf[:0]
+	if w.rows == 0 {
+		var err error
+		if w.buf, err = w.c.appendHeader(w.buf); err != nil {
+			return err
+		}
+	}
+	_, err := w.w.Write(append(w.buf, ']', '}'))
+	return err
+}
+
+// appendHeader appends the document up to the first row.
+func (c *Codec) appendHeader(buf []byte) ([]byte, error) {
+	schema, err := json.Marshal(c.schema)
+	if err != nil {
+		return buf, fmt.Errorf("columnarjson: %w", err)
+	}
+	order, _ := json.Marshal(c.FieldOrder())
+	buf = append(buf, `{"schema":`...)
+	buf = append(buf, schema...)
+	buf = append(buf, `,"field_order":`...)
+	buf = append(buf, order...)
+	return append(buf, `,"rows":[`...), nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// The plugin types every build has, small enough to serve as examples.
+func init() {
+	registerPluginType("drop", func(raw json.RawMessage) (interface{}, error) {
+		var p dropPlugin
+		if err := decodeSinkConfig(raw, &p); err != nil {
+			return nil, err
+		}
+		return &p, nil
+	})
+	registerPluginType("redact", func(raw json.RawMessage) (interface{}, error) {
+		var p redactPlugin
+		if err := decodeSinkConfig(raw, &p); err != nil {
+			return nil, err
+		}
+		return &p, nil
+	})
+}
+
+// dropPlugin filters out the logs matching every list it has, such as the
+// DEBUG logs of one project.
+type dropPlugin struct {
+	LogLevels []string `json:"log_levels"`
+	LogTypes  []string `json:"log_types"`
+	Projects  []string `json:"projects"`
+}
+
+func (p *dropPlugin) Keep(ctx context.Context, req LogRequest) (bool, error) {
+	matches := func(list []string, value string) bool {
+		if len(list) == 0 {
+			return true
+		}
+		for _, v := range list {
+			if v == value {
+				return true
+			}
+		}
+		return false
+	}
+	drop := matches(p.LogLevels, req.LogLevel) && matches(p.LogTypes, req.LogType) && matches(p.Projects, req.ProjectName)
+	return !drop, nil
+}
+
+// redactPlugin removes keys from the metadata and domainData objects of
+// every log, or replaces their values with Replacement when it is set.
+type redactPlugin struct {
+	Fields      []string `json:"fields"`
+	Replacement *string  `json:"replacement"`
+}
+
+func (p *redactPlugin) Transform(ctx context.Context, req *LogRequest) error {
+	for _, value := range []*interface{}{&req.LogBody.Metadata, &req.LogBody.DomainData} {
+		m, ok := (*value).(map[string]interface{})
+		if !ok {
+			continue
+		}
+		// Redact a copy: the map may be shared with the caller.
+		out := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			out[k] = v
+		}
+		for _, field := range p.Fields {
+			if _, ok := out[field]; !ok {
+				continue
+			}
+			if p.Replacement != nil {
+				out[field] = *p.Replacement
+			} else {
+				delete(out, field)
+			}
+		}
+		*value = out
+	}
+	return nil
+}
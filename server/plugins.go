@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Plugins add stages to the /log pipeline without forking the server. A
+// plugin type is compiled in: its file registers a factory from an init
+// function, and can sit behind a build tag so each build picks its own:
+//
+//	//go:build plugin_geoip
+//
+//	func init() { registerPluginType("geoip", newGeoIPPlugin) }
+//
+// -plugin-config lists the plugins to run, in pipeline order, the way
+// -sink-config lists sinks; the keys besides name and type are the
+// factory's:
+//
+//	{"plugins": [
+//	  {"type": "drop", "log_levels": ["DEBUG"]},
+//	  {"name": "no-emails", "type": "redact", "fields": ["email"]}
+//	]}
+//
+// A plugin's methods decide its stages. A logTransformer rewrites a /log
+// request before it is encoded, or a /log/binary one (and so the
+// transports routed to it) after it is decoded, which is then re-encoded
+// with the LogData version it was sent in; a logFilter drops it, answered
+// with status "filtered" and neither stored nor counted against quotas;
+// either rejects it with an error, answered with 400 plugin_rejected. A
+// Sink receives every stored log after the configured sinks and is listed
+// with them in /stats. Start(ctx) runs at startup, before the server
+// listens, and Close at shutdown once the sinks are flushed. /stats
+// reports each plugin's calls, errors, drops and time spent.
+type logTransformer interface {
+	Transform(ctx context.Context, req *LogRequest) error
+}
+
+// logFilter reports whether a /log request is kept.
+type logFilter interface {
+	Keep(ctx context.Context, req LogRequest) (bool, error)
+}
+
+// pluginTypes maps each config type to a factory decoding the rest of the
+// entry.
+var pluginTypes = map[string]func(raw json.RawMessage) (interface{}, error){}
+
+// registerPluginType makes typ available to -plugin-config. It panics on
+// a duplicate, as two plugins compiled in under one name is a build error.
+func registerPluginType(typ string, factory func(raw json.RawMessage) (interface{}, error)) {
+	if _, ok := pluginTypes[typ]; ok {
+		panic("duplicate plugin type " + typ)
+	}
+	pluginTypes[typ] = factory
+}
+
+type configuredPlugin struct {
+	name   string
+	typ    string
+	plugin interface{}
+
+	calls   atomic.Int64
+	errors  atomic.Int64
+	dropped atomic.Int64
+	nanos   atomic.Int64
+
+	mu        sync.Mutex
+	lastError string
+}
+
+var plugins []*configuredPlugin
+
+// loadPluginConfig configures the plugins listed in the file at path.
+func loadPluginConfig(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var config struct {
+		Plugins []json.RawMessage `json:"plugins"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("parse plugin config: %w", err)
+	}
+	for i, raw := range config.Plugins {
+		var entry sinkEntry
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			return fmt.Errorf("plugin %d: %w", i, err)
+		}
+		if entry.Name == "" {
+			entry.Name = entry.Type
+		}
+		var fields map[string]json.RawMessage
+		json.Unmarshal(raw, &fields)
+		delete(fields, "name")
+		delete(fields, "type")
+		rest, _ := json.Marshal(fields)
+		if err := addPlugin(entry.Name, entry.Type, rest); err != nil {
+			return fmt.Errorf("plugin %d (%s): %w", i, entry.Name, err)
+		}
+	}
+	return nil
+}
+
+// addPlugin creates a plugin of typ from its JSON config.
+func addPlugin(name, typ string, raw json.RawMessage) error {
+	factory, ok := pluginTypes[typ]
+	if !ok {
+		return fmt.Errorf("unknown plugin type %q (compiled in: %s)", typ, strings.Join(pluginTypeNames(), ", "))
+	}
+	for _, p := range plugins {
+		if p.name == name {
+			return fmt.Errorf("duplicate plugin name %q", name)
+		}
+	}
+	plugin, err := factory(raw)
+	if err != nil {
+		return err
+	}
+	_, transforms := plugin.(logTransformer)
+	_, filters := plugin.(logFilter)
+	sink, isSink := plugin.(Sink)
+	if !transforms && !filters && !isSink {
+		return fmt.Errorf("plugin type %q has no stage", typ)
+	}
+	if isSink {
+		if err := checkSinkName("plugin:" + name); err != nil {
+			return err
+		}
+	}
+	p := &configuredPlugin{name: name, typ: typ, plugin: plugin}
+	plugins = append(plugins, p)
+	if isSink {
+		// The wrapper has no Close: closing is the plugin's lifecycle.
+		sinks = append(sinks, &configuredSink{name: "plugin:" + name, typ: typ, sink: pluginSink{p, sink}})
+	}
+	return nil
+}
+
+// pluginSink writes to a plugin's Sink, counting the calls as the plugin's.
+type pluginSink struct {
+	p    *configuredPlugin
+	sink Sink
+}
+
+func (s pluginSink) Write(ctx context.Context, record sinkRecord) error {
+	start := time.Now()
+	err := s.sink.Write(ctx, record)
+	s.p.count(start, err)
+	return err
+}
+
+func (p *configuredPlugin) count(start time.Time, err error) {
+	p.calls.Add(1)
+	p.nanos.Add(int64(time.Since(start)))
+	if err != nil {
+		p.errors.Add(1)
+		p.mu.Lock()
+		p.lastError = err.Error()
+		p.mu.Unlock()
+	}
+}
+
+// pluginRejection is a /log request a plugin refused.
+type pluginRejection struct {
+	plugin string
+	err    error
+}
+
+func (e *pluginRejection) Error() string {
+	return fmt.Sprintf("plugin %q: %v", e.plugin, e.err)
+}
+
+func (e *pluginRejection) Unwrap() error { return e.err }
+
+// runPlugins passes req through every transformer and filter in order. It
+// reports false, with the plugin's name, when a filter drops the request,
+// and returns a *pluginRejection when one fails.
+func runPlugins(ctx context.Context, req *LogRequest) (string, bool, error) {
+	for _, p := range plugins {
+		if t, ok := p.plugin.(logTransformer); ok {
+			start := time.Now()
+			err := t.Transform(ctx, req)
+			p.count(start, err)
+			if err != nil {
+				return p.name, false, &pluginRejection{plugin: p.name, err: err}
+			}
+		}
+		if f, ok := p.plugin.(logFilter); ok {
+			start := time.Now()
+			keep, err := f.Keep(ctx, *req)
+			p.count(start, err)
+			if err != nil {
+				return p.name, false, &pluginRejection{plugin: p.name, err: err}
+			}
+			if !keep {
+				p.dropped.Add(1)
+				return p.name, false, nil
+			}
+		}
+	}
+	return "", true, nil
+}
+
+// startPlugins runs the Start hook of every plugin that has one.
+func startPlugins(ctx context.Context) error {
+	for _, p := range plugins {
+		if s, ok := p.plugin.(interface{ Start(context.Context) error }); ok {
+			if err := s.Start(ctx); err != nil {
+				return fmt.Errorf("plugin %q: %w", p.name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// closePlugins runs the Close hook of every plugin that has one, in
+// reverse order.
+func closePlugins() {
+	for i := len(plugins) - 1; i >= 0; i-- {
+		p := plugins[i]
+		closer, ok := p.plugin.(interface{ Close() error })
+		if !ok {
+			continue
+		}
+		if err := closer.Close(); err != nil {
+			logger.Error("Failed to close plugin", zap.String("plugin", p.name), zap.Error(err))
+		}
+	}
+}
+
+func pluginStats() []gin.H {
+	out := make([]gin.H, 0, len(plugins))
+	for _, p := range plugins {
+		p.mu.Lock()
+		lastError := p.lastError
+		p.mu.Unlock()
+		var stages []string
+		if _, ok := p.plugin.(logTransformer); ok {
+			stages = append(stages, "transform")
+		}
+		if _, ok := p.plugin.(logFilter); ok {
+			stages = append(stages, "filter")
+		}
+		if _, ok := p.plugin.(Sink); ok {
+			stages = append(stages, "sink")
+		}
+		calls := p.calls.Load()
+		stats := gin.H{
+			"name":     p.name,
+			"type":     p.typ,
+			"stages":   stages,
+			"calls":    calls,
+			"errors":   p.errors.Load(),
+			"dropped":  p.dropped.Load(),
+			"total_ms": float64(p.nanos.Load()) / 1e6,
+		}
+		if calls > 0 {
+			stats["avg_us"] = float64(p.nanos.Load()) / float64(calls) / 1e3
+		}
+		if lastError != "" {
+			stats["last_error"] = lastError
+		}
+		if r, ok := p.plugin.(interface{ Stats() gin.H }); ok {
+			stats["details"] = r.Stats()
+		}
+		out = append(out, stats)
+	}
+	return out
+}
+
+// pluginTypeNames lists the compiled-in plugin types.
+func pluginTypeNames() []string {
+	names := make([]string, 0, len(pluginTypes))
+	for name := range pluginTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+)
+
+// tagPlugin tags every log, rejects logs of the REJECT type and records
+// what it is handed as a sink.
+type tagPlugin struct {
+	Tag     string `json:"tag"`
+	started bool
+	closed  bool
+	written []sinkRecord
+}
+
+func (p *tagPlugin) Start(ctx context.Context) error { p.started = true; return nil }
+func (p *tagPlugin) Close() error                    { p.closed = true; return nil }
+
+func (p *tagPlugin) Transform(ctx context.Context, req *LogRequest) error {
+	if req.LogType == "REJECT" {
+		return errors.New("rejected by test")
+	}
+	req.LogSource = p.Tag
+	return nil
+}
+
+func (p *tagPlugin) Write(ctx context.Context, record sinkRecord) error {
+	p.written = append(p.written, record)
+	return nil
+}
+
+func TestPluginStages(t *testing.T) {
+	r := newSchemaTestEngine(t)
+	r.POST("/log", logHandler)
+	r.POST("/log/binary", logBinaryHandler)
+	var tagged *tagPlugin
+	registerPluginType("tag", func(raw json.RawMessage) (interface{}, error) {
+		tagged = &tagPlugin{}
+		return tagged, decodeSinkConfig(raw, tagged)
+	})
+	defer func() {
+		delete(pluginTypes, "tag")
+		plugins, sinks = nil, nil
+	}()
+
+	path := filepath.Join(t.TempDir(), "plugins.json")
+	write := func(config string) {
+		if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+			t.Fatalf("Failed to write plugin config: %v", err)
+		}
+	}
+	for name, config := range map[string]string{
+		"unknown type": `{"plugins": [{"type": "geoip"}]}`,
+		"unknown key":  `{"plugins": [{"type": "drop", "levels": ["DEBUG"]}]}`,
+		"duplicate":    `{"plugins": [{"type": "drop"}, {"type": "drop"}]}`,
+	} {
+		plugins, sinks = nil, nil
+		write(config)
+		if err := loadPluginConfig(path); err == nil {
+			t.Errorf("%s: expected the config to be rejected", name)
+		}
+	}
+	plugins, sinks = nil, nil
+	write(`{"plugins": [
+		{"type": "drop", "log_levels": ["DEBUG"]},
+		{"name": "no-emails", "type": "redact", "fields": ["email"]},
+		{"type": "tag", "tag": "plugin"}
+	]}`)
+	if err := loadPluginConfig(path); err != nil {
+		t.Fatalf("Failed to load plugin config: %v", err)
+	}
+	if err := startPlugins(context.Background()); err != nil || !tagged.started {
+		t.Fatalf("expected the tag plugin to start, got %v", err)
+	}
+
+	req := warmupPayload(1)
+	req.LogBody.DomainData = map[string]interface{}{"email": "a@example.com", "level": 3}
+	if w := doJSON(r, http.MethodPost, "/log", req); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(tagged.written) != 1 {
+		t.Fatalf("expected the plugin sink to get the log, got %d records", len(tagged.written))
+	}
+	wrapper := string(tagged.written[0].Encoded.WrapperJSON)
+	if !strings.Contains(wrapper, `"logSource":"plugin"`) || strings.Contains(wrapper, "example.com") {
+		t.Errorf("expected a tagged log without the email, got %s", wrapper)
+	}
+
+	req.LogLevel = "DEBUG"
+	w := doJSON(r, http.MethodPost, "/log", req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"status":"filtered"`) || len(tagged.written) != 1 {
+		t.Errorf("expected the DEBUG log to be filtered, got %d: %s", w.Code, w.Body.String())
+	}
+	req.LogLevel, req.LogType = "INFO", "REJECT"
+	w = doJSON(r, http.MethodPost, "/log", req)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), codePluginRejected) || !strings.Contains(w.Body.String(), `"plugin":"tag"`) {
+		t.Errorf("expected the plugin to reject the log, got %d: %s", w.Code, w.Body.String())
+	}
+
+	stats := map[string]gin.H{}
+	for _, s := range pluginStats() {
+		stats[s["name"].(string)] = s
+	}
+	if s := stats["drop"]; s["calls"] != int64(3) || s["dropped"] != int64(1) {
+		t.Errorf("unexpected drop stats %v", s)
+	}
+	// Two transforms, one failing, and one sink write.
+	if s := stats["tag"]; s["calls"] != int64(3) || s["errors"] != int64(1) || len(s["stages"].([]string)) != 2 {
+		t.Errorf("unexpected tag stats %v", s)
+	}
+	// Binary logs, and the transports routed to /log/binary, pass the
+	// same stages; one of a registered LogData version keeps its own
+	// fields.
+	binary, err := avrojson.EncodeLog(avrojson.LogWrapper{ProjectName: "p", ProjectVersion: "1", LogLevel: "DEBUG", LogType: "t", LogSource: "s"}, avrojson.LogData{Timestamp: time.UnixMilli(1).UTC(), Logtype: "t", Version: "1", Issuer: "i"})
+	if err != nil {
+		t.Fatalf("Failed to encode log: %v", err)
+	}
+	if w := postAvro(r, "/log/binary", avroContentType, binary.Wrapper, nil); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"status":"filtered"`) {
+		t.Errorf("expected the DEBUG binary log to be filtered, got %d: %s", w.Code, w.Body.String())
+	}
+	v2 := strings.Replace(avrojson.LogDataSchema, `"fields": [`, `"fields": [{"name": "region", "type": "string", "default": "unknown"},`, 1)
+	s2, _, err := schemaRegistry.Register(bodySubject, v2)
+	if err != nil {
+		t.Fatalf("Failed to register LogData v2: %v", err)
+	}
+	codec, _ := avrojson.DefaultCache.Get(v2)
+	logData, err := codec.EncodeNative(map[string]interface{}{
+		"region": "eu", "timestamp": int64(1), "logtype": "t", "version": "1", "issuer": "i",
+		"metadata": nil, "domainData": map[string]interface{}{"map": map[string]interface{}{"email": "a@example.com", "level": "3"}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode LogData v2: %v", err)
+	}
+	target := "/log/binary?schema=LogData&version=" + strconv.Itoa(s2.Version) + "&projectName=p&projectVersion=1&logLevel=INFO&logType=t&logSource=s"
+	if w := postAvro(r, target, avroContentType, logData, nil); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(tagged.written) != 2 {
+		t.Fatalf("expected the plugin sink to get the binary log, got %d records", len(tagged.written))
+	}
+	record := tagged.written[1].Encoded
+	if wrapper, body := string(record.WrapperJSON), string(record.LogDataJSON); !strings.Contains(wrapper, `"logSource":"plugin"`) ||
+		strings.Contains(body, "example.com") || !strings.Contains(body, `"region":"eu"`) || record.LogDataSchema != v2 {
+		t.Errorf("expected a tagged v2 log without the email, got %s %s", wrapper, body)
+	}
+
+	closePlugins()
+	if !tagged.closed {
+		t.Error("expected the tag plugin to be closed")
+	}
+}
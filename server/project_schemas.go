@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+	"github.com/homveloper/exp-avro-json/server/registry"
+	"go.uber.org/zap"
+)
+
+// A project can have a body schema of its own, so one game's domain data is
+// encoded as its own typed record rather than the string map of the
+// generic LogData. The latest version registered under
+// LogData.project.<projectName> encodes the bodies of its JSON /log
+// requests, ahead of logType schemas (logtypes.go), which are shared by
+// every project; other projects keep the built-in LogData. Project schemas
+// are registered like any other, or loaded at startup from the
+// <projectName>.avsc files of -project-schemas.
+//
+// Such a schema keeps LogData's timestamp (a timestamp-millis long),
+// logtype, version and issuer fields, and types metadata and domainData as
+// it likes. Bodies are checked against it first, so a domain field it does
+// not have is rejected rather than dropped.
+
+// projectSubject names the registry subject of project's body schema.
+func projectSubject(project string) string {
+	return bodySubject + ".project." + project
+}
+
+// projectSchema returns the latest body schema registered for project.
+func projectSchema(project string) (registry.Schema, bool) {
+	if schemaRegistry == nil || project == "" || !registry.ValidName(projectSubject(project)) {
+		return registry.Schema{}, false
+	}
+	s, err := resolveSchema(projectSubject(project), 0)
+	return s, err == nil
+}
+
+// bodySchema returns the schema encoding the body of req: its project's,
+// else its logType's. It reports false when neither is registered and the
+// body keeps the built-in or an inferred LogData.
+func bodySchema(req LogRequest) (registry.Schema, bool) {
+	if s, ok := projectSchema(req.ProjectName); ok {
+		return s, true
+	}
+	return logTypeSchema(req.LogType)
+}
+
+// loadProjectSchemas registers every <projectName>.avsc file in dir as the
+// body schema of projectName; a file matching a registered version adds
+// none.
+func loadProjectSchemas(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.avsc"))
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return err
+	}
+	for _, file := range files {
+		project := strings.TrimSuffix(filepath.Base(file), ".avsc")
+		if !registry.ValidName(projectSubject(project)) {
+			return fmt.Errorf("%s: project name %q is not an Avro name", file, project)
+		}
+		schema, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		s, created, err := schemaRegistry.Register(projectSubject(project), string(schema))
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		if created {
+			logger.Info("Registered project body schema", zap.String("project", project), zap.String("name", s.Name), zap.Int("version", s.Version))
+		}
+	}
+	return nil
+}
+
+// bodySchemaError is a /log body that does not fit its body schema.
+type bodySchemaError struct {
+	schema registry.Schema
+	errs   []avrojson.ValidationError
+	err    error
+}
+
+func (e *bodySchemaError) Error() string {
+	reason := ""
+	if len(e.errs) > 0 {
+		reason = e.errs[0].Message
+		if e.errs[0].Path != "" {
+			reason = e.errs[0].Path + ": " + reason
+		}
+	} else if e.err != nil {
+		reason = e.err.Error()
+	}
+	return fmt.Sprintf("body does not match schema %s version %d: %s", e.schema.Name, e.schema.Version, reason)
+}
+
+// respondBodySchemaError answers a bodySchemaError with validation_failed,
+// naming the first offending field and listing every error.
+func respondBodySchemaError(c *gin.Context, e *bodySchemaError) {
+	field := "body"
+	if len(e.errs) > 0 && e.errs[0].Path != "" {
+		field = "body." + e.errs[0].Path
+	}
+	extra := gin.H{"schema": e.schema.Name, "version": e.schema.Version}
+	if len(e.errs) > 0 {
+		extra["errors"] = e.errs
+	}
+	respondErrorWith(c, http.StatusBadRequest, apiError{Code: codeValidationFailed, Message: e.Error(), Field: field}, extra)
+}
+
+// typedLogBody is a /log body in the shape of a body schema, with the
+// metadata and domain values kept as sent for the codec to type.
+type typedLogBody struct {
+	Timestamp  time.Time   `json:"timestamp"`
+	Logtype    string      `json:"logtype"`
+	Version    string      `json:"version"`
+	Issuer     string      `json:"issuer"`
+	Metadata   interface{} `json:"metadata"`
+	DomainData interface{} `json:"domainData"`
+}
+
+// encodeTypedLogRequest encodes the body of req with s, a body schema,
+// returning a *bodySchemaError when the body does not fit it.
+func encodeTypedLogRequest(req LogRequest, wrapper avrojson.LogWrapper, s registry.Schema) (*avrojson.EncodedLog, error) {
+	codec, err := avrojson.DefaultCache.Get(s.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("compile %s version %d: %w", s.Name, s.Version, err)
+	}
+
+	// Validate the body as sent, timestamps in milliseconds and unions
+	// unwrapped, to report every field that breaks the schema.
+	text, err := json.Marshal(map[string]interface{}{
+		"timestamp":  req.LogBody.Timestamp,
+		"logtype":    req.LogBody.Logtype,
+		"version":    req.LogBody.Version,
+		"issuer":     req.LogBody.Issuer,
+		"metadata":   req.LogBody.Metadata,
+		"domainData": req.LogBody.DomainData,
+	})
+	if err != nil {
+		return nil, err
+	}
+	errs, err := codec.Validate(text, avrojson.ValidateOptions{PlainUnions: true})
+	if err != nil {
+		return nil, err
+	}
+	if len(errs) > 0 {
+		return nil, &bodySchemaError{schema: s, errs: errs}
+	}
+
+	logData, err := codec.Encode(typedLogBody{
+		Timestamp:  time.UnixMilli(req.LogBody.Timestamp).UTC(),
+		Logtype:    req.LogBody.Logtype,
+		Version:    req.LogBody.Version,
+		Issuer:     req.LogBody.Issuer,
+		Metadata:   req.LogBody.Metadata,
+		DomainData: req.LogBody.DomainData,
+	})
+	if err != nil {
+		return nil, &bodySchemaError{schema: s, err: err}
+	}
+	return avrojson.EncodeLogBinary(wrapper, s.Schema, logData)
+}
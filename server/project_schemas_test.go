@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+)
+
+// userActionSchema types the domain data of USER_ACTION logs.
+func userActionSchema(t *testing.T) string {
+	t.Helper()
+	var schema map[string]interface{}
+	if err := json.Unmarshal([]byte(avrojson.LogDataSchema), &schema); err != nil {
+		t.Fatalf("Failed to parse LogData schema: %v", err)
+	}
+	for _, f := range schema["fields"].([]interface{}) {
+		field := f.(map[string]interface{})
+		if field["name"] == "domainData" {
+			field["type"] = []interface{}{"null", map[string]interface{}{
+				"type": "record", "name": "UserAction",
+				"fields": []interface{}{
+					map[string]interface{}{"name": "login_method", "type": "string"},
+					map[string]interface{}{"name": "success", "type": "boolean"},
+					map[string]interface{}{"name": "duration_ms", "type": "int"},
+				},
+			}}
+			field["default"] = nil
+		}
+	}
+	data, _ := json.Marshal(schema)
+	return string(data)
+}
+
+func TestProjectBodySchemas(t *testing.T) {
+	r := newSchemaTestEngine(t)
+	r.POST("/log", logHandler)
+
+	dir := t.TempDir()
+	typed := userActionSchema(t)
+	if err := os.WriteFile(filepath.Join(dir, "raid.avsc"), []byte(typed), 0644); err != nil {
+		t.Fatalf("Failed to write schema: %v", err)
+	}
+	if err := loadProjectSchemas(dir); err != nil {
+		t.Fatalf("Failed to load project schemas: %v", err)
+	}
+	if err := loadProjectSchemas(dir); err != nil {
+		t.Fatalf("Failed to reload project schemas: %v", err)
+	}
+	if sub, err := schemaRegistry.Subject(projectSubject("raid")); err != nil || len(sub.Versions) != 1 {
+		t.Fatalf("expected one version of the raid schema, got %+v, %v", sub, err)
+	}
+
+	// The project's schema encodes its bodies, whatever the logType.
+	req := warmupPayload(1)
+	req.ProjectName = "raid"
+	req.LogBody.Metadata = nil
+	req.LogBody.DomainData = map[string]interface{}{"login_method": "password", "success": true, "duration_ms": 42}
+	encoded, err := encodeLogRequest(req)
+	if err != nil {
+		t.Fatalf("Failed to encode raid log: %v", err)
+	}
+	if encoded.LogDataSchema != typed {
+		t.Errorf("expected the raid schema to encode the body, got %s", encoded.LogDataSchema)
+	}
+	if w := doJSON(r, http.MethodPost, "/log", req); w.Code != http.StatusOK {
+		t.Errorf("expected a typed body to be accepted, got %d: %s", w.Code, w.Body.String())
+	}
+	req.LogBody.DomainData = map[string]interface{}{"level": 3}
+	if w := doJSON(r, http.MethodPost, "/log", req); w.Code != http.StatusBadRequest {
+		t.Errorf("expected a body not fitting the project schema to get 400, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Other projects keep the generic body.
+	encoded, err = encodeLogRequest(warmupPayload(1))
+	if err != nil {
+		t.Fatalf("Failed to encode warmup log: %v", err)
+	}
+	if encoded.LogDataSchema != avrojson.LogDataSchema {
+		t.Errorf("expected the built-in LogData schema for other projects, got %s", encoded.LogDataSchema)
+	}
+
+	os.WriteFile(filepath.Join(dir, "my-game.avsc"), []byte(typed), 0644)
+	if err := loadProjectSchemas(dir); err == nil {
+		t.Error("expected a project name that is not an Avro name to fail")
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Quotas cap how much each project may log per UTC day, counted as events
+// and as bytes of original JSON. They are loaded from -quota-file:
+//
+//	{"default": {"events_per_day": 100000, "bytes_per_day": 104857600},
+//	 "projects": {"big-game": {"events_per_day": 1000000}}}
+//
+// A project's entry replaces the default entirely; a zero limit is
+// unlimited. Usage is counted per instance, which in router mode is still
+// per project because each project's logs go to one backend.
+type quotaLimits struct {
+	EventsPerDay int64 `json:"events_per_day"`
+	BytesPerDay  int64 `json:"bytes_per_day"`
+}
+
+type quotaConfig struct {
+	Default  quotaLimits            `json:"default"`
+	Projects map[string]quotaLimits `json:"projects"`
+}
+
+type quotaUsage struct {
+	Events   int64 `json:"events"`
+	Bytes    int64 `json:"bytes"`
+	Rejected int64 `json:"rejected"`
+}
+
+// quotaTracker counts the current day's usage. quotas is nil when
+// -quota-file is empty.
+type quotaTracker struct {
+	config quotaConfig
+
+	mu    sync.Mutex
+	day   time.Time // UTC midnight starting the counted day
+	usage map[string]*quotaUsage
+}
+
+var quotas *quotaTracker
+
+func loadQuotas(path string) error {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var config quotaConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("parse quota file: %w", err)
+	}
+	for name, l := range config.Projects {
+		if l.EventsPerDay < 0 || l.BytesPerDay < 0 {
+			return fmt.Errorf("quota of project %q is negative", name)
+		}
+	}
+	if config.Default.EventsPerDay < 0 || config.Default.BytesPerDay < 0 {
+		return fmt.Errorf("default quota is negative")
+	}
+	quotas = newQuotaTracker(config, time.Now())
+	return nil
+}
+
+func newQuotaTracker(config quotaConfig, now time.Time) *quotaTracker {
+	return &quotaTracker{config: config, day: utcDay(now), usage: make(map[string]*quotaUsage)}
+}
+
+func utcDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func (q *quotaTracker) limits(project string) quotaLimits {
+	if l, ok := q.config.Projects[project]; ok {
+		return l
+	}
+	return q.config.Default
+}
+
+// quotaExceeded describes a rejected request.
+type quotaExceeded struct {
+	Quota string `json:"quota"`
+	Limit int64  `json:"limit"`
+	Used  int64  `json:"used"`
+}
+
+// reserve counts one event of size bytes against project unless it would
+// exceed a limit, in which case nothing but the rejection is counted.
+func (q *quotaTracker) reserve(project string, size int64) *quotaExceeded {
+	l := q.limits(project)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	u := q.usage[project]
+	if u == nil {
+		u = &quotaUsage{}
+		q.usage[project] = u
+	}
+	var exceeded *quotaExceeded
+	switch {
+	case l.EventsPerDay > 0 && u.Events+1 > l.EventsPerDay:
+		exceeded = &quotaExceeded{Quota: "events_per_day", Limit: l.EventsPerDay, Used: u.Events}
+	case l.BytesPerDay > 0 && u.Bytes+size > l.BytesPerDay:
+		exceeded = &quotaExceeded{Quota: "bytes_per_day", Limit: l.BytesPerDay, Used: u.Bytes}
+	}
+	if exceeded != nil {
+		u.Rejected++
+		return exceeded
+	}
+	u.Events++
+	u.Bytes += size
+	return nil
+}
+
+// reset starts the day containing now and returns the usage of the day it
+// closes, or false if now is still in the counted day.
+func (q *quotaTracker) reset(now time.Time) (time.Time, map[string]*quotaUsage, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !utcDay(now).After(q.day) {
+		return time.Time{}, nil, false
+	}
+	day, usage := q.day, q.usage
+	q.day, q.usage = utcDay(now), make(map[string]*quotaUsage)
+	return day, usage, true
+}
+
+func (q *quotaTracker) resetsAt() time.Time {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.day.AddDate(0, 0, 1)
+}
+
+// enforceQuota counts a log of size bytes against project, answering 429
+// and returning false when the project is over its daily quota.
+func enforceQuota(c *gin.Context, project string, size int) bool {
+	if quotas == nil {
+		return true
+	}
+	exceeded := quotas.reserve(project, int64(size))
+	if exceeded == nil {
+		return true
+	}
+	resetsAt := quotas.resetsAt()
+	requestLogger(c).Warn("Project over daily quota",
+		zap.String("project", project),
+		zap.String("quota", exceeded.Quota),
+		zap.Int64("limit", exceeded.Limit),
+		zap.Int64("used", exceeded.Used))
+	c.Header("Retry-After", strconv.Itoa(int(time.Until(resetsAt).Seconds())+1))
+	respondErrorWith(c, http.StatusTooManyRequests, apiError{
+		Code:    codeQuotaExceeded,
+		Message: "Daily quota exceeded for project " + strconv.Quote(project),
+	}, gin.H{
+		"project":   project,
+		"quota":     exceeded.Quota,
+		"limit":     exceeded.Limit,
+		"used":      exceeded.Used,
+		"resets_at": resetsAt,
+	})
+	return false
+}
+
+// runQuotaResets resets the usage counters at every UTC midnight, logging
+// each project's totals for the day that ended. Every instance runs it, as
+// the counters are local.
+func runQuotaResets(ctx context.Context) {
+	for {
+		timer := time.NewTimer(time.Until(quotas.resetsAt()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		// A timer can fire just before midnight by the wall clock; the
+		// next pass waits out the rest.
+		day, usage, _ := quotas.reset(time.Now())
+		for project, u := range usage {
+			logger.Info("Daily quota usage",
+				zap.String("day", day.Format("2006-01-02")),
+				zap.String("project", project),
+				zap.Int64("events", u.Events),
+				zap.Int64("bytes", u.Bytes),
+				zap.Int64("rejected", u.Rejected))
+		}
+	}
+}
+
+// quotaStatus reports the day's usage against each project's limits.
+func quotaStatus() gin.H {
+	q := quotas
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	projects := gin.H{}
+	for project, u := range q.usage {
+		projects[project] = gin.H{"usage": *u, "limits": q.limits(project)}
+	}
+	return gin.H{
+		"day":       q.day.Format("2006-01-02"),
+		"resets_at": q.day.AddDate(0, 0, 1),
+		"default":   q.config.Default,
+		"projects":  projects,
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func TestQuotaTrackerLimitsAndResets(t *testing.T) {
+	day := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	q := newQuotaTracker(quotaConfig{
+		Default:  quotaLimits{EventsPerDay: 2},
+		Projects: map[string]quotaLimits{"big": {BytesPerDay: 100}},
+	}, day)
+
+	for i := 0; i < 2; i++ {
+		if exceeded := q.reserve("small", 10); exceeded != nil {
+			t.Fatalf("event %d rejected: %+v", i, exceeded)
+		}
+	}
+	if exceeded := q.reserve("small", 10); exceeded == nil || exceeded.Quota != "events_per_day" || exceeded.Used != 2 {
+		t.Errorf("Expected the third event to exceed events_per_day, got %+v", exceeded)
+	}
+	if exceeded := q.reserve("big", 60); exceeded != nil {
+		t.Fatalf("big project rejected under its byte quota: %+v", exceeded)
+	}
+	if exceeded := q.reserve("big", 60); exceeded == nil || exceeded.Quota != "bytes_per_day" {
+		t.Errorf("Expected 120 bytes to exceed bytes_per_day, got %+v", exceeded)
+	}
+
+	if _, _, ok := q.reset(day.Add(time.Hour)); ok {
+		t.Error("Expected no reset within the same day")
+	}
+	closed, usage, ok := q.reset(day.Add(12 * time.Hour))
+	if !ok || !closed.Equal(utcDay(day)) || usage["small"].Events != 2 || usage["small"].Rejected != 1 {
+		t.Fatalf("unexpected closed day %v: %+v %v", closed, usage, ok)
+	}
+	if exceeded := q.reserve("small", 10); exceeded != nil {
+		t.Errorf("Expected a fresh quota after the reset, got %+v", exceeded)
+	}
+}
+
+func TestLogHandlerEnforcesQuota(t *testing.T) {
+	logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	path := filepath.Join(t.TempDir(), "quotas.json")
+	if err := os.WriteFile(path, []byte(`{"projects": {"warmup": {"events_per_day": 1}}}`), 0644); err != nil {
+		t.Fatalf("Failed to write quota file: %v", err)
+	}
+	if err := loadQuotas(path); err != nil {
+		t.Fatalf("Failed to load quotas: %v", err)
+	}
+	defer func() { quotas = nil }()
+
+	r := gin.New()
+	r.POST("/log", logHandler)
+	post := func() *httptest.ResponseRecorder {
+		body, _ := json.Marshal(warmupPayload(1))
+		req := httptest.NewRequest(http.MethodPost, "/log", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	if w := post(); w.Code != http.StatusOK {
+		t.Fatalf("Expected the first log to pass, got %d: %s", w.Code, w.Body.String())
+	}
+	w := post()
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("Expected 429 with Retry-After, got %d %v: %s", w.Code, w.Header(), w.Body.String())
+	}
+	var resp struct {
+		Quota string `json:"quota"`
+		Limit int64  `json:"limit"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Quota != "events_per_day" || resp.Limit != 1 {
+		t.Errorf("unexpected rejection body %s: %v", w.Body.String(), err)
+	}
+	if status := quotaStatus(); status["projects"].(gin.H)["warmup"] == nil {
+		t.Errorf("Expected usage of project warmup in %v", status)
+	}
+}
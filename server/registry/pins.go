@@ -0,0 +1,183 @@
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Pin modes. A soft pin accepts payloads of other versions and resolves
+// them to the pinned one; a hard pin rejects them.
+const (
+	PinSoft = "soft"
+	PinHard = "hard"
+)
+
+var (
+	// ErrInvalidPin is returned for pins with an unknown mode or project.
+	ErrInvalidPin = errors.New("registry: invalid pin")
+	// ErrPinned is returned when deleting a version a project is pinned to.
+	ErrPinned = errors.New("registry: schema version is pinned")
+)
+
+// Pin fixes the version of a subject a project's payloads are stored with,
+// so the project absorbs new versions only when it moves the pin.
+type Pin struct {
+	Project  string    `json:"project"`
+	Subject  string    `json:"subject"`
+	Version  int       `json:"version"`
+	Mode     string    `json:"mode"`
+	PinnedAt time.Time `json:"pinned_at"`
+}
+
+type pinKey struct{ project, subject string }
+
+// pinsFile holds every pin. It sits beside the subject directories, which
+// Open only reads through <name>/v*.json.
+const pinsFile = "pins.json"
+
+func (r *Registry) loadPins() error {
+	data, err := os.ReadFile(filepath.Join(r.dir, pinsFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var pins []Pin
+	if err := json.Unmarshal(data, &pins); err != nil {
+		return fmt.Errorf("registry: corrupt pin file: %w", err)
+	}
+	for _, p := range pins {
+		r.pins[pinKey{p.Project, p.Subject}] = p
+	}
+	return nil
+}
+
+// SetPin pins project to version of subject, which must be registered and
+// not deleted, replacing any earlier pin of the subject.
+func (r *Registry) SetPin(project, subject string, version int, mode string) (Pin, error) {
+	if project == "" {
+		return Pin{}, fmt.Errorf("%w: empty project", ErrInvalidPin)
+	}
+	if mode != PinSoft && mode != PinHard {
+		return Pin{}, fmt.Errorf("%w: mode must be %s or %s", ErrInvalidPin, PinSoft, PinHard)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.liveVersion(subject, version) {
+		return Pin{}, ErrNotFound
+	}
+	p := Pin{Project: project, Subject: subject, Version: version, Mode: mode, PinnedAt: time.Now().UTC()}
+	previous, had := r.pins[pinKey{project, subject}]
+	r.pins[pinKey{project, subject}] = p
+	if err := r.persistPins(); err != nil {
+		if had {
+			r.pins[pinKey{project, subject}] = previous
+		} else {
+			delete(r.pins, pinKey{project, subject})
+		}
+		return Pin{}, err
+	}
+	return p, nil
+}
+
+// GetPin returns project's pin of subject, if any.
+func (r *Registry) GetPin(project, subject string) (Pin, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	p, ok := r.pins[pinKey{project, subject}]
+	return p, ok
+}
+
+// Unpin removes project's pin of subject.
+func (r *Registry) Unpin(project, subject string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.pins[pinKey{project, subject}]
+	if !ok {
+		return ErrNotFound
+	}
+	delete(r.pins, pinKey{project, subject})
+	if err := r.persistPins(); err != nil {
+		r.pins[pinKey{project, subject}] = p
+		return err
+	}
+	return nil
+}
+
+// Pins returns the pins of project, or every pin when project is empty,
+// ordered by project and subject.
+func (r *Registry) Pins(project string) []Pin {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := []Pin{}
+	for _, p := range r.pins {
+		if project == "" || p.Project == project {
+			out = append(out, p)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Project != out[j].Project {
+			return out[i].Project < out[j].Project
+		}
+		return out[i].Subject < out[j].Subject
+	})
+	return out
+}
+
+// pinnedBy lists the projects pinned to version of name, or to any version
+// when version is 0. Callers hold r.mu.
+func (r *Registry) pinnedBy(name string, version int) []string {
+	var projects []string
+	for _, p := range r.pins {
+		if p.Subject == name && (version == 0 || p.Version == version) {
+			projects = append(projects, p.Project)
+		}
+	}
+	sort.Strings(projects)
+	return projects
+}
+
+func (r *Registry) liveVersion(name string, version int) bool {
+	for _, s := range r.subjects[name] {
+		if s.Version == version && s.DeletedAt == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Registry) persistPins() error {
+	if r.dir == "" {
+		return nil
+	}
+	return writePins(r.dir, r.pins)
+}
+
+func writePins(dir string, byKey map[pinKey]Pin) error {
+	pins := make([]Pin, 0, len(byKey))
+	for _, p := range byKey {
+		pins = append(pins, p)
+	}
+	sort.Slice(pins, func(i, j int) bool {
+		if pins[i].Project != pins[j].Project {
+			return pins[i].Project < pins[j].Project
+		}
+		return pins[i].Subject < pins[j].Subject
+	})
+	data, err := json.MarshalIndent(pins, "", "  ")
+	if err != nil {
+		return err
+	}
+	file := filepath.Join(dir, pinsFile)
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
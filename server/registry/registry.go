@@ -0,0 +1,342 @@
+// Package registry stores versioned Avro schemas by name. Registering a
+// schema whose canonical form matches an existing version returns that
+// version; any other change creates the next version. Versions are
+// persisted as one JSON file each under <dir>/<name>/, so the registry
+// survives restarts and can be inspected or seeded by hand. Projects can
+// pin a subject to one version; pins are kept in <dir>/pins.json.
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+	"github.com/linkedin/goavro/v2"
+)
+
+var (
+	// ErrNotFound is returned for unknown names and versions.
+	ErrNotFound = errors.New("registry: schema not found")
+	// ErrInvalidSchema wraps schema parse failures.
+	ErrInvalidSchema = errors.New("registry: invalid schema")
+)
+
+// namePattern accepts Avro full names, which are also safe directory names.
+var namePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)*$`)
+
+// ValidName reports whether name can name a subject.
+func ValidName(name string) bool { return namePattern.MatchString(name) }
+
+// Schema is one registered version.
+type Schema struct {
+	Name        string     `json:"name"`
+	Version     int        `json:"version"`
+	Schema      string     `json:"schema"`
+	Canonical   string     `json:"canonical"`
+	Fingerprint string     `json:"fingerprint"`
+	CreatedAt   time.Time  `json:"created_at"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+}
+
+// Subject summarizes all versions registered under one name.
+type Subject struct {
+	Name          string `json:"name"`
+	LatestVersion int    `json:"latest_version"`
+	Versions      []int  `json:"versions"`
+}
+
+// Registry is safe for concurrent use.
+type Registry struct {
+	dir string
+
+	mu       sync.RWMutex
+	subjects map[string][]*Schema // ordered by version, including deleted
+	pins     map[pinKey]Pin
+}
+
+// Open loads the registry persisted in dir, creating it if needed. An empty
+// dir keeps the registry in memory only.
+func Open(dir string) (*Registry, error) {
+	r := &Registry{dir: dir, subjects: make(map[string][]*Schema), pins: make(map[pinKey]Pin)}
+	if dir == "" {
+		return r, nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*", "v*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var s Schema
+		if err := json.Unmarshal(data, &s); err != nil {
+			return nil, fmt.Errorf("registry: corrupt schema file %s: %w", file, err)
+		}
+		// Versions stored with goavro's canonical form get the
+		// specification's, so equivalent schemas keep deduplicating.
+		if canonical, fingerprint, err := canonicalForm(s.Schema); err == nil {
+			s.Canonical, s.Fingerprint = canonical, fingerprint
+		}
+		r.subjects[s.Name] = append(r.subjects[s.Name], &s)
+	}
+	for _, versions := range r.subjects {
+		sort.Slice(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+	}
+	if err := r.loadPins(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Register adds schema under name and reports whether a new version was
+// created. When name is empty the schema's own full name is used.
+func (r *Registry) Register(name, schema string) (Schema, bool, error) {
+	canonical, fingerprint, err := canonicalForm(schema)
+	if err != nil {
+		return Schema{}, false, err
+	}
+	if name == "" {
+		name = schemaFullName(canonical)
+	}
+	if !namePattern.MatchString(name) {
+		return Schema{}, false, fmt.Errorf("%w: invalid name %q", ErrInvalidSchema, name)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	versions := r.subjects[name]
+	for _, existing := range versions {
+		if existing.DeletedAt == nil && existing.Canonical == canonical {
+			return *existing, false, nil
+		}
+	}
+
+	// Version numbers are never reused, even after deletes.
+	next := 1
+	if len(versions) > 0 {
+		next = versions[len(versions)-1].Version + 1
+	}
+	s := &Schema{
+		Name:        name,
+		Version:     next,
+		Schema:      schema,
+		Canonical:   canonical,
+		Fingerprint: fingerprint,
+		CreatedAt:   time.Now().UTC(),
+	}
+	if err := r.persist(s); err != nil {
+		return Schema{}, false, err
+	}
+	r.subjects[name] = append(versions, s)
+	return *s, true, nil
+}
+
+// Get returns a version of name; version 0 selects the latest one.
+func (r *Registry) Get(name string, version int) (Schema, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	versions := r.subjects[name]
+	for i := len(versions) - 1; i >= 0; i-- {
+		s := versions[i]
+		if s.DeletedAt != nil {
+			continue
+		}
+		if version == 0 || s.Version == version {
+			return *s, nil
+		}
+	}
+	return Schema{}, ErrNotFound
+}
+
+// Lookup finds the live version whose canonical form matches schema,
+// preferring the subject named after the schema's own full name when the
+// same schema is registered under several names.
+func (r *Registry) Lookup(schema string) (Schema, error) {
+	canonical, _, err := canonicalForm(schema)
+	if err != nil {
+		return Schema{}, err
+	}
+	return r.find(func(s *Schema) bool { return s.Canonical == canonical })
+}
+
+// LookupFingerprint finds the live version whose canonical form has the
+// Rabin fingerprint, such as the one a single-object encoded datum starts
+// with, preferring subjects the way Lookup does.
+func (r *Registry) LookupFingerprint(fingerprint uint64) (Schema, error) {
+	hex := avrojson.FormatFingerprint(fingerprint)
+	return r.find(func(s *Schema) bool { return s.Fingerprint == hex })
+}
+
+// find returns the live version matching match, preferring the subject
+// named after the schema's full name, then the first name in order.
+func (r *Registry) find(match func(*Schema) bool) (Schema, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var found *Schema
+	for name, versions := range r.subjects {
+		for _, s := range versions {
+			if s.DeletedAt != nil || !match(s) {
+				continue
+			}
+			preferred := schemaFullName(s.Canonical)
+			if found == nil || name == preferred || (found.Name != preferred && name < found.Name) {
+				found = s
+			}
+		}
+	}
+	if found == nil {
+		return Schema{}, ErrNotFound
+	}
+	return *found, nil
+}
+
+// Subjects lists every name with at least one live version.
+func (r *Registry) Subjects() []Subject {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var out []Subject
+	for name := range r.subjects {
+		if sub, ok := r.subject(name); ok {
+			out = append(out, sub)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Subject describes the live versions of name.
+func (r *Registry) Subject(name string) (Subject, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if sub, ok := r.subject(name); ok {
+		return sub, nil
+	}
+	return Subject{}, ErrNotFound
+}
+
+func (r *Registry) subject(name string) (Subject, bool) {
+	sub := Subject{Name: name}
+	for _, s := range r.subjects[name] {
+		if s.DeletedAt == nil {
+			sub.Versions = append(sub.Versions, s.Version)
+			sub.LatestVersion = s.Version
+		}
+	}
+	return sub, len(sub.Versions) > 0
+}
+
+// Delete removes a version of name, or every version when version is 0.
+// Deleted versions are kept as tombstones so their numbers stay reserved.
+// Versions a project is pinned to cannot be deleted.
+func (r *Registry) Delete(name string, version int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if projects := r.pinnedBy(name, version); len(projects) > 0 {
+		return fmt.Errorf("%w by %s", ErrPinned, strings.Join(projects, ", "))
+	}
+
+	now := time.Now().UTC()
+	found := false
+	for _, s := range r.subjects[name] {
+		if s.DeletedAt != nil || (version != 0 && s.Version != version) {
+			continue
+		}
+		deleted := *s
+		deleted.DeletedAt = &now
+		if err := r.persist(&deleted); err != nil {
+			return err
+		}
+		*s = deleted
+		found = true
+	}
+	if !found {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *Registry) persist(s *Schema) error {
+	if r.dir == "" {
+		return nil
+	}
+	return writeSchema(r.dir, s)
+}
+
+// Dump writes every version, deleted ones included, and the pins to dir in
+// the layout Open reads, so opening dir gives a copy of the registry, also
+// of one kept in memory.
+func (r *Registry) Dump(dir string) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, versions := range r.subjects {
+		for _, s := range versions {
+			if err := writeSchema(dir, s); err != nil {
+				return err
+			}
+		}
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return writePins(dir, r.pins)
+}
+
+func writeSchema(root string, s *Schema) error {
+	dir := filepath.Join(root, s.Name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	file := filepath.Join(dir, fmt.Sprintf("v%04d.json", s.Version))
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// canonicalForm checks that schema compiles and returns its Parsing
+// Canonical Form and the hex Rabin fingerprint of that.
+func canonicalForm(schema string) (string, string, error) {
+	if _, err := goavro.NewCodec(schema); err != nil {
+		return "", "", fmt.Errorf("%w: %v", ErrInvalidSchema, err)
+	}
+	canonical, err := avrojson.Canonical(schema)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %v", ErrInvalidSchema, err)
+	}
+	return canonical, avrojson.FormatFingerprint(avrojson.Rabin(canonical)), nil
+}
+
+// schemaFullName extracts the name of a named schema from its canonical
+// form, which already carries the namespace in the name.
+func schemaFullName(canonical string) string {
+	var named struct {
+		Name string `json:"name"`
+	}
+	if json.Unmarshal([]byte(canonical), &named) != nil {
+		return ""
+	}
+	return strings.TrimSpace(named.Name)
+}
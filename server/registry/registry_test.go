@@ -0,0 +1,266 @@
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+const userV1 = `{"type":"record","name":"User","namespace":"exp","fields":[{"name":"id","type":"long"}]}`
+const userV2 = `{"type":"record","name":"User","namespace":"exp","fields":[{"name":"id","type":"long"},{"name":"nick","type":["null","string"],"default":null}]}`
+
+func TestRegisterVersions(t *testing.T) {
+	r, err := Open("")
+	if err != nil {
+		t.Fatalf("Failed to open registry: %v", err)
+	}
+
+	v1, created, err := r.Register("", userV1)
+	if err != nil || !created {
+		t.Fatalf("Failed to register schema: %v, %v", created, err)
+	}
+	if v1.Name != "exp.User" || v1.Version != 1 {
+		t.Errorf("expected exp.User v1, got %s v%d", v1.Name, v1.Version)
+	}
+
+	// Formatting changes keep the same canonical form.
+	same, created, err := r.Register("exp.User", "  "+userV1+"\n")
+	if err != nil || created || same.Version != 1 {
+		t.Errorf("expected re-registration to return v1, got v%d created=%v err=%v", same.Version, created, err)
+	}
+
+	v2, created, err := r.Register("exp.User", userV2)
+	if err != nil || !created || v2.Version != 2 {
+		t.Fatalf("expected v2, got v%d created=%v err=%v", v2.Version, created, err)
+	}
+	if latest, _ := r.Get("exp.User", 0); latest.Version != 2 {
+		t.Errorf("expected latest to be v2, got v%d", latest.Version)
+	}
+	if old, _ := r.Get("exp.User", 1); old.Fingerprint != v1.Fingerprint {
+		t.Errorf("expected v1 to be retrievable")
+	}
+
+	if _, _, err := r.Register("", `{"type":"nope"}`); !errors.Is(err, ErrInvalidSchema) {
+		t.Errorf("expected ErrInvalidSchema, got %v", err)
+	}
+	if _, _, err := r.Register("../escape", userV1); !errors.Is(err, ErrInvalidSchema) {
+		t.Errorf("expected invalid name to be rejected, got %v", err)
+	}
+	if _, _, err := r.Register("", `"string"`); !errors.Is(err, ErrInvalidSchema) {
+		t.Errorf("expected unnamed schema without a name to be rejected, got %v", err)
+	}
+}
+
+func TestRegistryPersistsAcrossOpen(t *testing.T) {
+	dir := t.TempDir()
+	r, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to open registry: %v", err)
+	}
+	r.Register("", userV1)
+	r.Register("", userV2)
+	if err := r.Delete("exp.User", 2); err != nil {
+		t.Fatalf("Failed to delete version: %v", err)
+	}
+
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen registry: %v", err)
+	}
+	sub, err := reopened.Subject("exp.User")
+	if err != nil {
+		t.Fatalf("Failed to load subject: %v", err)
+	}
+	if len(sub.Versions) != 1 || sub.LatestVersion != 1 {
+		t.Errorf("expected only v1 to survive, got %+v", sub)
+	}
+	if _, err := reopened.Get("exp.User", 2); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected deleted version to be gone, got %v", err)
+	}
+
+	// Deleted version numbers are not reused.
+	v3, _, err := reopened.Register("", userV2)
+	if err != nil || v3.Version != 3 {
+		t.Errorf("expected re-registering after delete to create v3, got v%d, %v", v3.Version, err)
+	}
+
+	if err := reopened.Delete("exp.User", 0); err != nil {
+		t.Fatalf("Failed to delete subject: %v", err)
+	}
+	if len(reopened.Subjects()) != 0 {
+		t.Errorf("expected no subjects after deleting all versions, got %+v", reopened.Subjects())
+	}
+	if err := reopened.Delete("exp.User", 0); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound deleting twice, got %v", err)
+	}
+}
+
+func TestRegisterDeduplicatesEquivalentSchemas(t *testing.T) {
+	const timed = `{"type":"record","name":"Event","namespace":"exp","fields":[{"name":"at","type":{"type":"long","logicalType":"timestamp-millis"}}]}`
+	const documented = `{"doc":"An event.","name":"exp.Event","type":"record","fields":[{"doc":"When.","name":"at","type":{"logicalType":"timestamp-millis","type":"long"}}]}`
+
+	dir := t.TempDir()
+	r, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to open registry: %v", err)
+	}
+	v1, _, err := r.Register("", timed)
+	if err != nil {
+		t.Fatalf("Failed to register schema: %v", err)
+	}
+	if v1.Canonical != `{"name":"exp.Event","type":"record","fields":[{"name":"at","type":"long"}]}` {
+		t.Errorf("unexpected canonical form %s", v1.Canonical)
+	}
+	if same, created, err := r.Register("", documented); err != nil || created || same.Version != 1 {
+		t.Errorf("expected docs and attribute order to keep v1, got v%d created=%v err=%v", same.Version, created, err)
+	}
+
+	// A version stored with goavro's form of the logical type gets the
+	// specification's when the registry is opened again.
+	file := filepath.Join(dir, "exp.Event", "v0001.json")
+	stored := v1
+	stored.Canonical = `{"name":"exp.Event","type":"record","fields":[{"name":"at","type":{"type":"long"}}]}`
+	stored.Fingerprint = "0000000000000000"
+	data, _ := json.Marshal(stored)
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		t.Fatalf("Failed to write schema file: %v", err)
+	}
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen registry: %v", err)
+	}
+	if same, created, err := reopened.Register("", documented); err != nil || created || same.Fingerprint != v1.Fingerprint {
+		t.Errorf("expected the reloaded v1 to match, got %+v created=%v err=%v", same, created, err)
+	}
+}
+
+func TestLookupByCanonicalForm(t *testing.T) {
+	r, err := Open("")
+	if err != nil {
+		t.Fatalf("Failed to open registry: %v", err)
+	}
+	if _, _, err := r.Register("alias.User", userV1); err != nil {
+		t.Fatalf("Failed to register schema: %v", err)
+	}
+	if _, _, err := r.Register("", userV1); err != nil {
+		t.Fatalf("Failed to register schema: %v", err)
+	}
+
+	s, err := r.Lookup(" " + userV1)
+	if err != nil || s.Name != "exp.User" || s.Version != 1 {
+		t.Errorf("expected exp.User v1, got %s v%d: %v", s.Name, s.Version, err)
+	}
+	if _, err := r.Lookup(userV2); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for an unregistered schema, got %v", err)
+	}
+	if _, err := r.Lookup("{"); !errors.Is(err, ErrInvalidSchema) {
+		t.Errorf("expected ErrInvalidSchema, got %v", err)
+	}
+}
+
+func TestLookupFingerprint(t *testing.T) {
+	r, err := Open("")
+	if err != nil {
+		t.Fatalf("Failed to open registry: %v", err)
+	}
+	if _, _, err := r.Register("alias.User", userV1); err != nil {
+		t.Fatalf("Failed to register schema: %v", err)
+	}
+	v1, _, err := r.Register("", userV1)
+	if err != nil {
+		t.Fatalf("Failed to register schema: %v", err)
+	}
+	codec, _ := goavro.NewCodec(userV1)
+	s, err := r.LookupFingerprint(codec.Rabin)
+	if err != nil || s.Name != "exp.User" || s.Version != 1 || s.Fingerprint != v1.Fingerprint {
+		t.Errorf("expected exp.User v1, got %s v%d: %v", s.Name, s.Version, err)
+	}
+	if _, err := r.LookupFingerprint(codec.Rabin + 1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for an unknown fingerprint, got %v", err)
+	}
+}
+
+func TestDumpCopiesRegistry(t *testing.T) {
+	r, err := Open("")
+	if err != nil {
+		t.Fatalf("Failed to open registry: %v", err)
+	}
+	r.Register("", userV1)
+	r.Register("", userV2)
+	r.Delete("exp.User", 2)
+	if _, err := r.SetPin("game", "exp.User", 1, PinSoft); err != nil {
+		t.Fatalf("Failed to pin: %v", err)
+	}
+	dir := t.TempDir()
+	if err := r.Dump(dir); err != nil {
+		t.Fatalf("Failed to dump registry: %v", err)
+	}
+
+	copied, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to open dumped registry: %v", err)
+	}
+	if _, err := copied.Get("exp.User", 1); err != nil {
+		t.Errorf("expected v1 in the copy, got %v", err)
+	}
+	if _, err := copied.Get("exp.User", 2); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected the deleted version to stay deleted, got %v", err)
+	}
+	if v3, _, err := copied.Register("", userV2); err != nil || v3.Version != 3 {
+		t.Errorf("expected the copy not to reuse deleted versions, got v%d, %v", v3.Version, err)
+	}
+	if p, ok := copied.GetPin("game", "exp.User"); !ok || p.Version != 1 {
+		t.Errorf("expected the pin in the copy, got %+v %v", p, ok)
+	}
+}
+
+func TestPins(t *testing.T) {
+	dir := t.TempDir()
+	r, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to open registry: %v", err)
+	}
+	r.Register("", userV1)
+	r.Register("", userV2)
+
+	if _, err := r.SetPin("game", "exp.User", 3, PinSoft); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for an unregistered version, got %v", err)
+	}
+	if _, err := r.SetPin("game", "exp.User", 1, "loose"); !errors.Is(err, ErrInvalidPin) {
+		t.Errorf("expected ErrInvalidPin for an unknown mode, got %v", err)
+	}
+	if _, err := r.SetPin("game", "exp.User", 1, PinHard); err != nil {
+		t.Fatalf("Failed to pin: %v", err)
+	}
+	if err := r.Delete("exp.User", 1); !errors.Is(err, ErrPinned) {
+		t.Errorf("expected pinned version delete to fail with ErrPinned, got %v", err)
+	}
+	if err := r.Delete("exp.User", 2); err != nil {
+		t.Errorf("expected unpinned version to be deletable, got %v", err)
+	}
+
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen registry: %v", err)
+	}
+	p, ok := reopened.GetPin("game", "exp.User")
+	if !ok || p.Version != 1 || p.Mode != PinHard {
+		t.Fatalf("expected the pin to persist, got %+v %v", p, ok)
+	}
+	if pins := reopened.Pins("other"); len(pins) != 0 {
+		t.Errorf("expected no pins for another project, got %v", pins)
+	}
+	if err := reopened.Unpin("game", "exp.User"); err != nil {
+		t.Fatalf("Failed to unpin: %v", err)
+	}
+	if err := reopened.Unpin("game", "exp.User"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound unpinning twice, got %v", err)
+	}
+	if err := reopened.Delete("exp.User", 1); err != nil {
+		t.Errorf("expected delete to succeed once unpinned, got %v", err)
+	}
+}
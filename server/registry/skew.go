@@ -0,0 +1,220 @@
+package registry
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+)
+
+// SkewCase is data written with one version of a subject and read with
+// another, as happens while clients and servers of adjacent versions run
+// side by side during a rolling deployment.
+type SkewCase struct {
+	Subject string `json:"subject"`
+	Writer  int    `json:"writer"`
+	Reader  int    `json:"reader"`
+	// Compatible is the static check: every datum the writer can produce
+	// resolves to the reader. Issues lists why it does not.
+	Compatible bool                       `json:"compatible"`
+	Issues     []avrojson.Incompatibility `json:"issues,omitempty"`
+	// Samples data were encoded with the writer, and Resolved of them
+	// decoded with the reader; Error is the first failure.
+	Samples  int    `json:"samples"`
+	Resolved int    `json:"resolved"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Consistent reports whether the samples behaved as the static check
+// predicts: a pair found compatible resolves every sample.
+func (c SkewCase) Consistent() bool {
+	return !c.Compatible || c.Resolved == c.Samples
+}
+
+// SkewOptions configures Skew.
+type SkewOptions struct {
+	// Samples is the number of data encoded per pair (default 20).
+	Samples int
+	// Seed picks the first sample; sample i uses Seed+i, so a seed gives
+	// the same data on every run.
+	Seed int64
+	// Distance is how many live versions apart writer and reader may be
+	// (default 1, each version against its neighbours).
+	Distance int
+}
+
+// Skew encodes sample data with each live version of the named subjects,
+// all of them when names is empty, and decodes it with every live version
+// up to opts.Distance versions before and after it. Deleted versions are
+// skipped, so v1 and v3 are neighbours once v2 is deleted.
+func (r *Registry) Skew(opts SkewOptions, names ...string) ([]SkewCase, error) {
+	if opts.Samples <= 0 {
+		opts.Samples = 20
+	}
+	if opts.Distance <= 0 {
+		opts.Distance = 1
+	}
+	if len(names) == 0 {
+		for _, sub := range r.Subjects() {
+			names = append(names, sub.Name)
+		}
+	}
+
+	var cases []SkewCase
+	for _, name := range names {
+		sub, err := r.Subject(name)
+		if err != nil {
+			return nil, err
+		}
+		schemas := make([]Schema, len(sub.Versions))
+		for i, v := range sub.Versions {
+			if schemas[i], err = r.Get(name, v); err != nil {
+				return nil, err
+			}
+		}
+		for i, writer := range schemas {
+			for j, reader := range schemas {
+				if i == j || i-j > opts.Distance || j-i > opts.Distance {
+					continue
+				}
+				c, err := skewCase(writer, reader, opts)
+				if err != nil {
+					return nil, fmt.Errorf("registry: %s v%d against v%d: %w", name, writer.Version, reader.Version, err)
+				}
+				cases = append(cases, c)
+			}
+		}
+	}
+	return cases, nil
+}
+
+func skewCase(writer, reader Schema, opts SkewOptions) (SkewCase, error) {
+	c := SkewCase{Subject: writer.Name, Writer: writer.Version, Reader: reader.Version, Samples: opts.Samples}
+	issues, err := avrojson.Incompatibilities(writer.Schema, reader.Schema)
+	if err != nil {
+		return c, err
+	}
+	c.Compatible, c.Issues = len(issues) == 0, issues
+
+	codec, err := avrojson.DefaultCache.Get(writer.Schema)
+	if err != nil {
+		return c, err
+	}
+	resolver, err := avrojson.NewResolver(writer.Schema, reader.Schema)
+	if err != nil {
+		// Not even the data the writer can share with the reader resolves.
+		c.Error = err.Error()
+		return c, nil
+	}
+	for i := 0; i < opts.Samples; i++ {
+		native, err := codec.Sample(opts.Seed + int64(i))
+		if err != nil {
+			return c, fmt.Errorf("sample: %w", err)
+		}
+		data, err := codec.EncodeNative(native)
+		if err != nil {
+			return c, fmt.Errorf("encode sample: %w", err)
+		}
+		if _, err := resolver.Decode(data); err != nil {
+			if c.Error == "" {
+				c.Error = err.Error()
+			}
+			continue
+		}
+		c.Resolved++
+	}
+	return c, nil
+}
+
+// WriteSkewMatrix writes cases as a Markdown compatibility matrix per
+// subject, writer versions down and reader versions across. A cell reads
+// "ok" when the pair is compatible, "no" with the samples that resolved
+// anyway when it is not, "MISMATCH" when a compatible pair failed to
+// resolve a sample and "-" for pairs not run. The reasons for every "no"
+// and "MISMATCH" follow the table.
+func WriteSkewMatrix(w io.Writer, cases []SkewCase) error {
+	bySubject := make(map[string][]SkewCase)
+	var subjects []string
+	for _, c := range cases {
+		if _, ok := bySubject[c.Subject]; !ok {
+			subjects = append(subjects, c.Subject)
+		}
+		bySubject[c.Subject] = append(bySubject[c.Subject], c)
+	}
+	sort.Strings(subjects)
+
+	for _, subject := range subjects {
+		cells := make(map[[2]int]SkewCase)
+		versions := make(map[int]bool)
+		for _, c := range bySubject[subject] {
+			cells[[2]int{c.Writer, c.Reader}] = c
+			versions[c.Writer], versions[c.Reader] = true, true
+		}
+		order := make([]int, 0, len(versions))
+		for v := range versions {
+			order = append(order, v)
+		}
+		sort.Ints(order)
+
+		if _, err := fmt.Fprintf(w, "## %s\n\n| writer \\ reader |", subject); err != nil {
+			return err
+		}
+		for _, v := range order {
+			fmt.Fprintf(w, " v%d |", v)
+		}
+		fmt.Fprint(w, "\n|---|")
+		for range order {
+			fmt.Fprint(w, "---|")
+		}
+		fmt.Fprintln(w)
+		for _, writer := range order {
+			fmt.Fprintf(w, "| v%d |", writer)
+			for _, reader := range order {
+				c, ok := cells[[2]int{writer, reader}]
+				if !ok {
+					fmt.Fprint(w, " - |")
+					continue
+				}
+				fmt.Fprintf(w, " %s |", skewCell(c))
+			}
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintln(w)
+
+		for _, c := range bySubject[subject] {
+			if c.Compatible && c.Consistent() {
+				continue
+			}
+			fmt.Fprintf(w, "- v%d → v%d:", c.Writer, c.Reader)
+			for _, issue := range c.Issues {
+				path := issue.Path
+				if path == "" {
+					path = "(root)"
+				}
+				fmt.Fprintf(w, " %s: %s;", path, issue.Message)
+			}
+			if c.Error != "" {
+				fmt.Fprintf(w, " first failure: %s", c.Error)
+			}
+			fmt.Fprintln(w)
+		}
+		if _, err := fmt.Fprintln(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func skewCell(c SkewCase) string {
+	switch {
+	case !c.Consistent():
+		return fmt.Sprintf("MISMATCH %d/%d", c.Resolved, c.Samples)
+	case c.Compatible:
+		return "ok"
+	case c.Resolved > 0:
+		return fmt.Sprintf("no (%d/%d resolved)", c.Resolved, c.Samples)
+	default:
+		return "no"
+	}
+}
@@ -0,0 +1,105 @@
+package registry
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+// userV3 drops nick and narrows id to an int: v2 data no longer reads
+// with it, but v3 data still reads with v2, which promotes the int and
+// defaults nick.
+const userV3 = `{"type":"record","name":"User","namespace":"exp","fields":[{"name":"id","type":"int"}]}`
+
+func TestSkewMatrix(t *testing.T) {
+	r, err := Open("")
+	if err != nil {
+		t.Fatalf("Failed to open registry: %v", err)
+	}
+	for _, schema := range []string{userV1, userV2, userV3} {
+		if _, _, err := r.Register("", schema); err != nil {
+			t.Fatalf("Failed to register schema: %v", err)
+		}
+	}
+
+	cases, err := r.Skew(SkewOptions{Samples: 5, Seed: 1})
+	if err != nil {
+		t.Fatalf("Failed to run skew: %v", err)
+	}
+	want := map[[2]int]bool{{1, 2}: true, {2, 1}: true, {2, 3}: false, {3, 2}: true}
+	if len(cases) != len(want) {
+		t.Fatalf("expected %d neighbouring pairs, got %+v", len(want), cases)
+	}
+	for _, c := range cases {
+		compatible, ok := want[[2]int{c.Writer, c.Reader}]
+		if !ok || c.Compatible != compatible || !c.Consistent() {
+			t.Errorf("unexpected case %+v", c)
+		}
+		if c.Compatible && c.Resolved != 5 {
+			t.Errorf("expected v%d data to resolve with v%d, got %d/5: %s", c.Writer, c.Reader, c.Resolved, c.Error)
+		}
+	}
+
+	var report bytes.Buffer
+	if err := WriteSkewMatrix(&report, cases); err != nil {
+		t.Fatalf("Failed to write matrix: %v", err)
+	}
+	for _, line := range []string{"## exp.User", "| v1 | - | ok | - |", "| v2 | ok | - | no |", "| v3 | - | ok | - |", "- v2 → v3: id:"} {
+		if !strings.Contains(report.String(), line) {
+			t.Errorf("expected %q in the report:\n%s", line, report.String())
+		}
+	}
+
+	// Two versions apart, v1 and v3 meet too.
+	cases, err = r.Skew(SkewOptions{Samples: 1, Distance: 2}, "exp.User")
+	if err != nil || len(cases) != 6 {
+		t.Errorf("expected 6 pairs at distance 2, got %d, %v", len(cases), err)
+	}
+	if _, err := r.Skew(SkewOptions{}, "exp.Missing"); err == nil {
+		t.Error("expected an unknown subject to fail")
+	}
+}
+
+// TestSkewSchemaDir runs the harness over a real registry's history:
+//
+//	SKEW_SCHEMA_DIR=schemas SKEW_REPORT=skew.md go test ./registry -run SkewSchemaDir
+//
+// It fails when a pair the static check finds compatible fails to resolve
+// a sample, and, with SKEW_REQUIRE_COMPATIBLE=1, on any incompatible pair
+// of neighbouring versions. The matrix is logged, or written to SKEW_REPORT.
+func TestSkewSchemaDir(t *testing.T) {
+	dir := os.Getenv("SKEW_SCHEMA_DIR")
+	if dir == "" {
+		t.Skip("SKEW_SCHEMA_DIR not set")
+	}
+	r, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to open registry: %v", err)
+	}
+	cases, err := r.Skew(SkewOptions{Samples: 50, Seed: 1})
+	if err != nil {
+		t.Fatalf("Failed to run skew: %v", err)
+	}
+
+	var report bytes.Buffer
+	if err := WriteSkewMatrix(&report, cases); err != nil {
+		t.Fatalf("Failed to write matrix: %v", err)
+	}
+	if path := os.Getenv("SKEW_REPORT"); path != "" {
+		if err := os.WriteFile(path, report.Bytes(), 0644); err != nil {
+			t.Fatalf("Failed to write report: %v", err)
+		}
+	} else {
+		t.Log("\n" + report.String())
+	}
+
+	strict := os.Getenv("SKEW_REQUIRE_COMPATIBLE") == "1"
+	for _, c := range cases {
+		if !c.Consistent() {
+			t.Errorf("%s v%d → v%d: compatible, but %d/%d samples resolved: %s", c.Subject, c.Writer, c.Reader, c.Resolved, c.Samples, c.Error)
+		} else if strict && !c.Compatible {
+			t.Errorf("%s v%d → v%d: incompatible: %+v", c.Subject, c.Writer, c.Reader, c.Issues)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/homveloper/exp-avro-json/server/ocf"
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+	"go.uber.org/zap"
+)
+
+// replayLine is one NDJSON line of /logs/replay.
+type replayLine struct {
+	File   string          `json:"file"`
+	Index  int             `json:"index"`
+	Record json.RawMessage `json:"record"`
+}
+
+// errReplayLimit stops a replay once limit records were written.
+var errReplayLimit = errors.New("replay limit reached")
+
+// replayHandler serves GET /logs/replay: the records of the stored
+// container files, each decoded with the schema embedded in its file, as
+// NDJSON lines of {"file", "index", "record"}. Unlike /logs/export nothing
+// is resolved by default, so every stream and schema version can be
+// replayed as written.
+//
+// Query parameters: file (repeatable) selects files by name, stream
+// selects files by prefix (wrapper, logdata, <subject>-v<n>), skip leaves
+// out the first records, limit caps the records written,
+// strip_unions=true drops union wrappers, and reader with reader_version
+// (default latest) resolves every record into that registered schema,
+// which must be able to read all selected files.
+func replayHandler(c *gin.Context) {
+	store := requestOCFStore(c)
+	if store == nil {
+		return
+	}
+	limit := 0
+	if s := c.Query("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, "limit must be a positive integer")
+			return
+		}
+		limit = n
+	}
+	skip := 0
+	if s := c.Query("skip"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, "skip must be a non-negative integer")
+			return
+		}
+		skip = n
+	}
+	stripUnions, _ := strconv.ParseBool(c.Query("strip_unions"))
+
+	sources, err := store.sources()
+	if err != nil {
+		requestLogger(c).Error("Failed to list OCF files", zap.Error(err))
+		respondError(c, http.StatusInternalServerError, codeStorageFailed, "Failed to list OCF files")
+		return
+	}
+	sources, missing := filterReplaySources(sources, c.QueryArray("file"), c.Query("stream"))
+	if len(missing) > 0 {
+		respondErrorWith(c, http.StatusNotFound, apiError{Code: codeNotFound, Message: "Unknown OCF files", Field: "file"}, gin.H{"files": missing})
+		return
+	}
+	resolvers, ok := replayResolvers(c, sources)
+	if !ok {
+		return
+	}
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("X-Replay-Files", strconv.Itoa(len(sources)))
+	c.Header("Trailer", "X-Replay-Records")
+	c.Status(http.StatusOK)
+
+	written := 0
+	enc := json.NewEncoder(c.Writer)
+	for i, src := range sources {
+		resolver := resolvers[i]
+		var codec *avrojson.Codec
+		if resolver != nil {
+			codec = resolver.Reader()
+		} else if codec, err = avrojson.DefaultCache.Get(src.Schema); err != nil {
+			requestLogger(c).Error("Failed to compile embedded schema", zap.String("file", src.Path), zap.Error(err))
+			break
+		}
+		name := filepath.Base(src.Path)
+		dec := codec.Decoders().Get()
+		err = scanSource(src, &skip, func(index int, record interface{}) error {
+			if err := c.Request.Context().Err(); err != nil {
+				return err
+			}
+			if resolver != nil {
+				var err error
+				if record, err = resolver.Resolve(record); err != nil {
+					return err
+				}
+			}
+			text, err := replayRecord(dec, record, stripUnions)
+			if err != nil {
+				return err
+			}
+			if err := enc.Encode(replayLine{File: name, Index: index, Record: text}); err != nil {
+				return err
+			}
+			written++
+			if limit > 0 && written >= limit {
+				return errReplayLimit
+			}
+			return nil
+		})
+		codec.Decoders().Put(dec)
+		c.Writer.Flush()
+
+		var scanErr *ocf.ScanError
+		if errors.As(err, &scanErr) {
+			requestLogger(c).Warn("Stopped at an unreadable OCF block", zap.String("file", src.Path), zap.Error(err))
+			continue
+		}
+		if err != nil {
+			if !errors.Is(err, errReplayLimit) {
+				requestLogger(c).Error("OCF replay aborted", zap.String("file", src.Path), zap.Int("records", written), zap.Error(err))
+			}
+			break
+		}
+	}
+	c.Writer.Header().Set("X-Replay-Records", strconv.Itoa(written))
+}
+
+// replayResolvers returns, for each source, the resolver into the reader
+// schema the query names, or all nils without one. It answers the request
+// and returns false when the reader is unknown or cannot read a source.
+func replayResolvers(c *gin.Context, sources []ocfSource) ([]*avrojson.Resolver, bool) {
+	resolvers := make([]*avrojson.Resolver, len(sources))
+	name := c.Query("reader")
+	version := 0
+	if s := c.Query("reader_version"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, "reader_version must be a positive integer")
+			return nil, false
+		}
+		if name == "" {
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, "reader_version needs reader")
+			return nil, false
+		}
+		version = n
+	}
+	if name == "" {
+		return resolvers, true
+	}
+	reader, err := resolveSchema(name, version)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeUnknownSchema, "Unknown reader schema "+strconv.Quote(name)+" version "+strconv.Itoa(version))
+		return nil, false
+	}
+	var unreadable []string
+	for i, src := range sources {
+		if resolvers[i], err = avrojson.DefaultCache.Resolver(src.Schema, reader.Schema); err != nil {
+			unreadable = append(unreadable, filepath.Base(src.Path))
+		}
+	}
+	if len(unreadable) > 0 {
+		respondErrorWith(c, http.StatusBadRequest, apiError{Code: codeInvalidRequest, Message: "Reader schema cannot read these files; select them with file or stream", Field: "reader"}, gin.H{"files": unreadable})
+		return nil, false
+	}
+	return resolvers, true
+}
+
+// scanSource calls fn with the records of src and their index in the
+// file, leaving out the first *skip records and taking those it left out
+// off *skip. Plain files are mapped, so whole blocks within the skip are
+// stepped over by their headers without being decompressed; sealed files
+// are decrypted and decoded from the start. Unreadable blocks end the scan
+// with a *ocf.ScanError.
+func scanSource(src ocfSource, skip *int, fn func(index int, record interface{}) error) error {
+	m, err := ocf.Map(src.Path)
+	if errors.Is(err, ocf.ErrSealed) {
+		f, err := src.open()
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		index := -1
+		_, _, err = ocf.Scan(f, func(record interface{}) error {
+			index++
+			if *skip > 0 {
+				*skip--
+				return nil
+			}
+			return fn(index, record)
+		})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+	index := 0
+	return m.Blocks(0, func(b ocf.BlockInfo) error {
+		if int64(*skip) >= b.Records {
+			*skip -= int(b.Records)
+			index += int(b.Records)
+			return nil
+		}
+		records, err := m.BlockAt(b.Offset)
+		if err != nil {
+			return &ocf.ScanError{Record: index, Err: err}
+		}
+		for i, record := range records {
+			if *skip > 0 {
+				*skip--
+				continue
+			}
+			if err := fn(index+i, record); err != nil {
+				return err
+			}
+		}
+		index += len(records)
+		return nil
+	})
+}
+
+// replayRecord renders one record as Avro JSON, or as plain JSON when
+// stripUnions is set. Avro JSON is only valid until dec's next call.
+func replayRecord(dec *avrojson.Decoder, record interface{}, stripUnions bool) (json.RawMessage, error) {
+	if !stripUnions {
+		return dec.NativeJSON(record)
+	}
+	plain, err := dec.Codec().StripUnions(record)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(plain)
+}
+
+// filterReplaySources keeps the sources named in files (all when empty)
+// whose name starts with stream followed by "-", and lists requested files
+// that do not exist.
+func filterReplaySources(sources []ocfSource, files []string, stream string) ([]ocfSource, []string) {
+	wanted := make(map[string]bool, len(files))
+	for _, f := range files {
+		wanted[f] = false
+	}
+	var kept []ocfSource
+	for _, src := range sources {
+		name := filepath.Base(src.Path)
+		if _, ok := wanted[name]; len(files) > 0 && !ok {
+			continue
+		}
+		wanted[name] = true
+		if stream != "" && !strings.HasPrefix(name, stream+"-") {
+			continue
+		}
+		kept = append(kept, src)
+	}
+	var missing []string
+	for _, f := range files {
+		if !wanted[f] {
+			missing = append(missing, f)
+		}
+	}
+	return kept, missing
+}
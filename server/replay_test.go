@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+	"go.uber.org/zap"
+)
+
+func TestReplayStreamsStoredRecords(t *testing.T) {
+	logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	if err := openSchemaRegistry(""); err != nil {
+		t.Fatalf("Failed to open schema registry: %v", err)
+	}
+	if err := openOCFLogs(t.TempDir(), ocfTuning{}); err != nil {
+		t.Fatalf("Failed to open OCF logs: %v", err)
+	}
+	defer func() { ocfLogs.wrapper, ocfLogs.logData = nil, nil }()
+	for _, issuer := range []string{"a", "b", "c"} {
+		encoded, err := avrojson.EncodeLog(avrojson.LogWrapper{ProjectName: "p"},
+			avrojson.LogData{Timestamp: time.UnixMilli(1).UTC(), Logtype: "t", Version: "1", Issuer: issuer, Metadata: map[string]string{"k": issuer}})
+		if err != nil {
+			t.Fatalf("Failed to encode log: %v", err)
+		}
+		writeOCFLog(t, encoded)
+	}
+
+	r := gin.New()
+	r.GET("/logs/replay", replayHandler)
+	replay := func(target string) (*httptest.ResponseRecorder, []map[string]interface{}) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		var lines []map[string]interface{}
+		scanner := bufio.NewScanner(w.Body)
+		for scanner.Scan() {
+			var line map[string]interface{}
+			if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+				t.Fatalf("Failed to parse line %q: %v", scanner.Text(), err)
+			}
+			lines = append(lines, line)
+		}
+		return w, lines
+	}
+
+	w, lines := replay("/logs/replay")
+	if w.Code != http.StatusOK || len(lines) != 6 || w.Result().Trailer.Get("X-Replay-Records") != "6" {
+		t.Fatalf("Expected 6 records from both streams, got %d (%d): %s", len(lines), w.Code, w.Body.String())
+	}
+
+	_, lines = replay("/logs/replay?stream=logdata&strip_unions=true&limit=2")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 records, got %v", lines)
+	}
+	record := lines[1]["record"].(map[string]interface{})
+	if record["issuer"] != "b" || record["metadata"].(map[string]interface{})["k"] != "b" || lines[1]["index"] != float64(1) {
+		t.Errorf("unexpected replayed record %v", lines[1])
+	}
+
+	// Skipping steps over whole blocks of the first file into the second.
+	_, lines = replay("/logs/replay?skip=4&limit=1")
+	if len(lines) != 1 || lines[0]["index"] != float64(1) {
+		t.Errorf("Expected the second record of the second file, got %v", lines)
+	}
+	if w, _ := replay("/logs/replay?skip=-1"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for skip=-1, got %d", w.Code)
+	}
+
+	file := filepath.Base(ocfLogs.wrapper.Stats().File)
+	if _, lines = replay("/logs/replay?file=" + file); len(lines) != 3 || lines[0]["file"] != file {
+		t.Errorf("Expected the 3 wrapper records of %s, got %v", file, lines)
+	}
+	if w, _ := replay("/logs/replay?file=../secret.avro"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown file, got %d", w.Code)
+	}
+	if w, _ := replay("/logs/replay?limit=0"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for limit=0, got %d", w.Code)
+	}
+
+	// A reader schema resolves the records it can read, and refuses the
+	// files it cannot.
+	v2Schema := strings.Replace(avrojson.LogDataSchema, `{"name": "issuer", "type": "string"},`,
+		`{"name": "issuer", "type": "string"}, {"name": "region", "type": "string", "default": "eu"},`, 1)
+	if _, _, err := schemaRegistry.Register("LogData", v2Schema); err != nil {
+		t.Fatalf("Failed to register LogData v2: %v", err)
+	}
+	_, lines = replay("/logs/replay?stream=logdata&reader=LogData&strip_unions=true")
+	if len(lines) != 3 || lines[0]["record"].(map[string]interface{})["region"] != "eu" {
+		t.Errorf("Expected 3 records read as LogData v2, got %v", lines)
+	}
+	if _, lines = replay("/logs/replay?stream=logdata&reader=LogData&reader_version=1"); len(lines) != 3 {
+		t.Errorf("Expected 3 records read as LogData v1, got %v", lines)
+	}
+	for _, target := range []string{"/logs/replay?reader=LogData", "/logs/replay?reader=Missing", "/logs/replay?reader_version=1", "/logs/replay?reader=LogData&reader_version=x"} {
+		if w, _ := replay(target); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", target, w.Code)
+		}
+	}
+}
@@ -0,0 +1,600 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Replication keeps a warm standby of the storage directory, so a long
+// experiment survives losing its node. With -replicate-to the primary
+// compares its -replicate-dir against the standby's every
+// -replicate-interval, rsync-like: it fetches the standby's manifest of
+// paths, sizes and SHA-256 digests and PUTs every completed file that is
+// missing there or differs. Completed means every regular file except the
+// OCF files the sinks are still writing, temporary and dot files and the
+// artifact Bloom filters, which the standby rebuilds when it starts; so
+// closed OCF files, artifact manifests and blobs, import manifests and
+// idempotency keys are shipped, each once. An instance started with
+// -standby serves the manifest and accepts the files into its own
+// -replicate-dir, writing each to a temporary file that is renamed into
+// place only once its digest matches the X-Content-SHA256 header. Files
+// the primary removes, such as by artifact retention, stay on the standby.
+// Both sides check -replicate-token as a bearer token when it is set.
+//
+// GET /replication/status is the failover readiness report: on the
+// primary whether the standby holds every completed file as of a recent
+// sync, and which are behind; on the standby what it holds and when it
+// last received a file. A standby takes over by restarting it without
+// -standby, which indexes the OCF files and rebuilds the filters.
+
+const (
+	replicationChecksumHeader = "X-Content-SHA256"
+	// replicationBehindListed bounds the paths a status lists as behind.
+	replicationBehindListed = 20
+	// replicationExitTimeout bounds the last sync at shutdown.
+	replicationExitTimeout = time.Minute
+)
+
+// replicatedFile is one file of a replication manifest.
+type replicatedFile struct {
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+type replicationManifest struct {
+	Files map[string]replicatedFile `json:"files"`
+}
+
+// digestCache remembers file digests by size and modification time, so a
+// sync only reads the files that changed since the last.
+type digestCache struct {
+	mu   sync.Mutex
+	sums map[string]cachedDigest
+}
+
+type cachedDigest struct {
+	size int64
+	mod  time.Time
+	sum  string
+}
+
+func (d *digestCache) digest(path string, info fs.FileInfo) (string, error) {
+	d.mu.Lock()
+	cached, ok := d.sums[path]
+	d.mu.Unlock()
+	if ok && cached.size == info.Size() && cached.mod.Equal(info.ModTime()) {
+		return cached.sum, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+	d.mu.Lock()
+	if d.sums == nil {
+		d.sums = make(map[string]cachedDigest)
+	}
+	d.sums[path] = cachedDigest{size: info.Size(), mod: info.ModTime(), sum: sum}
+	d.mu.Unlock()
+	return sum, nil
+}
+
+// replicatedFiles lists the completed files below dir by slash-separated
+// relative path, leaving out those in open.
+func replicatedFiles(dir string, open map[string]bool, digests *digestCache) (map[string]replicatedFile, error) {
+	files := make(map[string]replicatedFile)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if path != dir && (name == "bloom" || strings.HasPrefix(name, ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || strings.HasPrefix(name, ".") || strings.HasSuffix(name, ".tmp") {
+			return nil
+		}
+		if abs, err := filepath.Abs(path); err == nil && open[abs] {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		sum, err := digests.digest(path, info)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = replicatedFile{Size: info.Size(), SHA256: sum}
+		return nil
+	})
+	return files, err
+}
+
+// openSinkFiles returns the absolute paths of the OCF files sinks are
+// writing.
+func openSinkFiles() map[string]bool {
+	open := make(map[string]bool)
+	for _, s := range sinks {
+		w, ok := s.sink.(interface{ openFiles() []string })
+		if !ok {
+			continue
+		}
+		for _, path := range w.openFiles() {
+			if abs, err := filepath.Abs(path); err == nil {
+				open[abs] = true
+			}
+		}
+	}
+	return open
+}
+
+// replicator ships the primary's completed files to the standby.
+type replicator struct {
+	dir      string
+	target   string
+	token    string
+	interval time.Duration
+	client   *http.Client
+	digests  digestCache
+	// syncing serializes syncs, the periodic ones and the last at exit.
+	syncing sync.Mutex
+
+	mu          sync.Mutex
+	lastRun     time.Time
+	lastSuccess time.Time
+	lastError   string
+	files       int
+	open        int
+	behind      []string
+	behindBytes int64
+	standbyOnly int
+	shipped     int64
+	shippedB    int64
+	failures    int64
+}
+
+// replication is the primary's replicator, nil without -replicate-to.
+var replication *replicator
+
+func newReplicator(dir, target, token string, interval time.Duration) *replicator {
+	return &replicator{
+		dir:      dir,
+		target:   strings.TrimRight(target, "/"),
+		token:    token,
+		interval: interval,
+		client:   &http.Client{Timeout: 10 * time.Minute},
+	}
+}
+
+// sync ships every completed file the standby lacks or holds another
+// version of. A file that fails is left for the next sync.
+func (r *replicator) sync(ctx context.Context) error {
+	r.syncing.Lock()
+	defer r.syncing.Unlock()
+	start := time.Now()
+	remote, err := r.manifest(ctx)
+	var local map[string]replicatedFile
+	open := openSinkFiles()
+	if err == nil {
+		local, err = replicatedFiles(r.dir, open, &r.digests)
+	}
+	if err != nil {
+		r.mu.Lock()
+		r.lastRun, r.lastError = start, err.Error()
+		r.failures++
+		r.mu.Unlock()
+		return err
+	}
+
+	paths := make([]string, 0, len(local))
+	for path, f := range local {
+		if remote[path] != f {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	var behind []string
+	var behindBytes, shipped, shippedBytes int64
+	var firstErr error
+	for _, path := range paths {
+		if err := r.ship(ctx, path, local[path]); err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("ship %s: %w", path, err)
+			}
+			behind = append(behind, path)
+			behindBytes += local[path].Size
+			continue
+		}
+		shipped++
+		shippedBytes += local[path].Size
+	}
+	standbyOnly := 0
+	for path := range remote {
+		if _, ok := local[path]; !ok {
+			standbyOnly++
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lastRun = start
+	r.files, r.open, r.standbyOnly = len(local), len(open), standbyOnly
+	r.behind, r.behindBytes = behind, behindBytes
+	r.shipped += shipped
+	r.shippedB += shippedBytes
+	if firstErr != nil {
+		if len(behind) > 1 {
+			firstErr = fmt.Errorf("%w (and %d more files)", firstErr, len(behind)-1)
+		}
+		r.lastError = firstErr.Error()
+		r.failures++
+		return firstErr
+	}
+	r.lastSuccess, r.lastError = start, ""
+	return nil
+}
+
+func (r *replicator) request(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, r.target+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if r.token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.token)
+	}
+	return req, nil
+}
+
+// manifest fetches the files the standby holds.
+func (r *replicator) manifest(ctx context.Context) (map[string]replicatedFile, error) {
+	req, err := r.request(ctx, http.MethodGet, "/replication/manifest", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, replicationStatusError(resp)
+	}
+	var manifest replicationManifest
+	if err := json.NewDecoder(resp.Body).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("decode standby manifest: %w", err)
+	}
+	return manifest.Files, nil
+}
+
+// ship PUTs one file; the standby rejects it if it changed after it was
+// hashed, and the next sync sends the new version.
+func (r *replicator) ship(ctx context.Context, path string, file replicatedFile) error {
+	f, err := os.Open(filepath.Join(r.dir, filepath.FromSlash(path)))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	req, err := r.request(ctx, http.MethodPut, "/replication/files/"+strings.Join(segments, "/"), io.LimitReader(f, file.Size))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = file.Size
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set(replicationChecksumHeader, file.SHA256)
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return replicationStatusError(resp)
+	}
+	return nil
+}
+
+func replicationStatusError(resp *http.Response) error {
+	var body apiError
+	json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&body)
+	if body.Message != "" {
+		return fmt.Errorf("standby answered %d: %s", resp.StatusCode, body.Message)
+	}
+	return fmt.Errorf("standby answered %d", resp.StatusCode)
+}
+
+// status reports whether the standby could take over now: it must hold
+// every completed file as of a sync that succeeded within two intervals.
+func (r *replicator) status(now time.Time) gin.H {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var reasons []string
+	switch {
+	case r.lastSuccess.IsZero():
+		reasons = append(reasons, "no sync has succeeded yet")
+	case now.Sub(r.lastSuccess) > 2*r.interval:
+		reasons = append(reasons, fmt.Sprintf("last successful sync was %s ago", now.Sub(r.lastSuccess).Round(time.Second)))
+	}
+	if len(r.behind) > 0 {
+		reasons = append(reasons, fmt.Sprintf("%d files are behind", len(r.behind)))
+	}
+	behind := r.behind
+	if len(behind) > replicationBehindListed {
+		behind = behind[:replicationBehindListed]
+	}
+	status := gin.H{
+		"ready":         len(reasons) == 0,
+		"target":        r.target,
+		"dir":           r.dir,
+		"interval":      r.interval.String(),
+		"files":         r.files,
+		"open_files":    r.open,
+		"behind":        len(r.behind),
+		"behind_bytes":  r.behindBytes,
+		"standby_only":  r.standbyOnly,
+		"shipped":       r.shipped,
+		"shipped_bytes": r.shippedB,
+		"failures":      r.failures,
+	}
+	if len(reasons) > 0 {
+		status["reasons"] = reasons
+	}
+	if len(behind) > 0 {
+		status["behind_files"] = behind
+	}
+	if !r.lastRun.IsZero() {
+		status["last_run"] = r.lastRun
+	}
+	if !r.lastSuccess.IsZero() {
+		status["last_success"] = r.lastSuccess
+	}
+	if r.lastError != "" {
+		status["last_error"] = r.lastError
+	}
+	return status
+}
+
+// runReplication syncs every interval until ctx is done.
+func runReplication(ctx context.Context) {
+	ticker := time.NewTicker(replication.interval)
+	defer ticker.Stop()
+	for {
+		if err := replication.sync(ctx); err != nil && ctx.Err() == nil {
+			logger.Error("Replication to standby failed", zap.String("target", replication.target), zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// replicateForExit ships the files closed at shutdown, once the sinks are
+// closed.
+func replicateForExit() {
+	if replication == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), replicationExitTimeout)
+	defer cancel()
+	if err := replication.sync(ctx); err != nil {
+		logger.Error("Final replication to standby failed", zap.String("target", replication.target), zap.Error(err))
+		return
+	}
+	logger.Info("Replicated storage to standby", zap.String("target", replication.target))
+}
+
+// standbyStore receives the primary's files.
+type standbyStore struct {
+	dir     string
+	digests digestCache
+
+	mu           sync.Mutex
+	received     int64
+	receivedB    int64
+	rejected     int64
+	lastReceived time.Time
+}
+
+// standby is the receiving side, nil without -standby.
+var standby *standbyStore
+
+// receive writes body to path below the standby's dir if its SHA-256 is
+// sum, replacing any older version.
+func (s *standbyStore) receive(path, sum string, body io.Reader) (int64, error) {
+	target := filepath.Join(s.dir, filepath.FromSlash(path))
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return 0, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".replicate-")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, h), body)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return n, err
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != sum {
+		return n, errChecksumMismatch
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return n, err
+	}
+	return n, os.Rename(tmp.Name(), target)
+}
+
+var errChecksumMismatch = errors.New("body does not match its checksum")
+
+func (s *standbyStore) status() gin.H {
+	files, err := replicatedFiles(s.dir, nil, &s.digests)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := gin.H{
+		"dir":            s.dir,
+		"received":       s.received,
+		"received_bytes": s.receivedB,
+		"rejected":       s.rejected,
+	}
+	if err != nil {
+		status["error"] = err.Error()
+	} else {
+		var bytes int64
+		for _, f := range files {
+			bytes += f.Size
+		}
+		status["files"], status["bytes"] = len(files), bytes
+	}
+	if !s.lastReceived.IsZero() {
+		status["last_received"] = s.lastReceived
+	}
+	return status
+}
+
+// requireBearerToken answers 401 unless the request carries token as its
+// bearer token. An empty token matches nothing, so a route guarded by an
+// unset token is closed rather than open. what names the token in the
+// error.
+func requireBearerToken(token, what string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		got, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if token == "" || !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			c.Header("WWW-Authenticate", `Bearer realm="avro-json"`)
+			respondError(c, http.StatusUnauthorized, codeUnauthorized, "A valid "+what+" is required")
+			return
+		}
+		c.Next()
+	}
+}
+
+func replicationManifestHandler(c *gin.Context) {
+	files, err := replicatedFiles(standby.dir, nil, &standby.digests)
+	if err != nil {
+		requestLogger(c).Error("Failed to list replicated files", zap.Error(err))
+		respondError(c, http.StatusInternalServerError, codeStorageFailed, "Failed to list replicated files")
+		return
+	}
+	c.JSON(http.StatusOK, replicationManifest{Files: files})
+}
+
+func replicationFileHandler(c *gin.Context) {
+	path := strings.TrimPrefix(c.Param("path"), "/")
+	if !filepath.IsLocal(filepath.FromSlash(path)) {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "path must stay inside the replicated directory")
+		return
+	}
+	sum := strings.ToLower(c.GetHeader(replicationChecksumHeader))
+	if decoded, err := hex.DecodeString(sum); err != nil || len(decoded) != sha256.Size {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, replicationChecksumHeader+" must be a hex SHA-256 digest")
+		return
+	}
+	n, err := standby.receive(path, sum, c.Request.Body)
+	if err != nil {
+		standby.mu.Lock()
+		standby.rejected++
+		standby.mu.Unlock()
+		if bodyTooLarge(c, err) {
+			return
+		}
+		if errors.Is(err, errChecksumMismatch) {
+			respondErrorWith(c, http.StatusBadRequest, apiError{Code: codeInvalidRequest, Message: "Body does not match " + replicationChecksumHeader}, gin.H{"path": path})
+			return
+		}
+		requestLogger(c).Error("Failed to store replicated file", zap.String("path", path), zap.Error(err))
+		respondError(c, http.StatusInternalServerError, codeStorageFailed, "Failed to store replicated file")
+		return
+	}
+	standby.mu.Lock()
+	standby.received++
+	standby.receivedB += n
+	standby.lastReceived = time.Now()
+	standby.mu.Unlock()
+	c.JSON(http.StatusOK, gin.H{"status": "stored", "path": path, "bytes": n})
+}
+
+// replicationStatus is the readiness report of whichever sides run here,
+// nil when neither does.
+func replicationStatus() gin.H {
+	if replication == nil && standby == nil {
+		return nil
+	}
+	status := gin.H{}
+	if replication != nil {
+		status["primary"] = replication.status(time.Now())
+	}
+	if standby != nil {
+		status["standby"] = standby.status()
+	}
+	return status
+}
+
+func replicationStatusHandler(c *gin.Context) {
+	status := replicationStatus()
+	if status == nil {
+		respondError(c, http.StatusNotFound, codeNotFound, "Replication is disabled")
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// registerReplicationRoutes adds the standby's endpoints and the status
+// report.
+func registerReplicationRoutes(r *gin.Engine, token string) {
+	r.GET("/replication/status", replicationStatusHandler)
+	if standby == nil {
+		return
+	}
+	auth := requireBearerToken(token, "replication token")
+	r.GET("/replication/manifest", auth, replicationManifestHandler)
+	r.PUT("/replication/files/*path", auth, replicationFileHandler)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+	"go.uber.org/zap"
+)
+
+func TestReplicationShipsCompletedFiles(t *testing.T) {
+	logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	primaryDir, standbyDir := t.TempDir(), t.TempDir()
+	standby = &standbyStore{dir: standbyDir}
+	defer func() { standby, replication, sinks = nil, nil, nil }()
+	r := gin.New()
+	registerReplicationRoutes(r, "secret")
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	// Two logs in one-record files: the first file of each stream is
+	// complete, the second still open.
+	store := &ocfStore{}
+	if err := store.open(filepath.Join(primaryDir, "ocf"), ocfTuning{MaxRecords: 1}, nil); err != nil {
+		t.Fatalf("Failed to open OCF store: %v", err)
+	}
+	defer store.close()
+	sinks = []*configuredSink{{name: "file", typ: "file", sink: fileSink{store: store}}}
+	for i := 0; i < 2; i++ {
+		encoded, err := avrojson.EncodeLog(avrojson.LogWrapper{ProjectName: "raid", LogLevel: "INFO", LogType: "t"},
+			avrojson.LogData{Logtype: "t", Version: "1", Issuer: "i"})
+		if err != nil {
+			t.Fatalf("Failed to encode log: %v", err)
+		}
+		if err := store.append(encoded); err != nil {
+			t.Fatalf("Failed to append log: %v", err)
+		}
+	}
+	for path, content := range map[string]string{
+		"manifests/01.json":      `{"id":"01"}`,
+		"blobs/ab/abcd":          "blob",
+		"bloom/blobs-00.bloom":   "filter",
+		"manifests/.put-123":     "partial",
+		"schemas/v0001.json.tmp": "partial",
+	} {
+		full := filepath.Join(primaryDir, filepath.FromSlash(path))
+		os.MkdirAll(filepath.Dir(full), 0o755)
+		if err := os.WriteFile(full, []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+
+	replication = newReplicator(primaryDir, srv.URL, "wrong", time.Minute)
+	if err := replication.sync(context.Background()); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("expected the standby to refuse a wrong token, got %v", err)
+	}
+	if status := replication.status(time.Now()); status["ready"] != false {
+		t.Errorf("expected a primary that never synced not to be ready, got %v", status)
+	}
+
+	replication.token = "secret"
+	if err := replication.sync(context.Background()); err != nil {
+		t.Fatalf("Failed to sync: %v", err)
+	}
+	got, err := replicatedFiles(standbyDir, nil, &digestCache{})
+	if err != nil {
+		t.Fatalf("Failed to list standby files: %v", err)
+	}
+	var names []string
+	for path := range got {
+		names = append(names, path)
+	}
+	sort.Strings(names)
+	if len(names) != 4 || names[0] != "blobs/ab/abcd" || names[1] != "manifests/01.json" ||
+		!strings.HasPrefix(names[2], "ocf/logdata-") || !strings.HasPrefix(names[3], "ocf/wrapper-") {
+		t.Errorf("expected the blob, the manifest and the two closed OCF files, got %v", names)
+	}
+	status := replication.status(time.Now())
+	if status["ready"] != true || status["shipped"] != int64(4) || status["open_files"] != 2 {
+		t.Errorf("unexpected primary status %v", status)
+	}
+
+	// Only changed files are shipped again.
+	os.WriteFile(filepath.Join(primaryDir, "manifests", "01.json"), []byte(`{"id":"01","v":2}`), 0o644)
+	if err := replication.sync(context.Background()); err != nil {
+		t.Fatalf("Failed to sync: %v", err)
+	}
+	if status := replication.status(time.Now()); status["shipped"] != int64(5) {
+		t.Errorf("expected one more file shipped, got %v", status["shipped"])
+	}
+	if data, _ := os.ReadFile(filepath.Join(standbyDir, "manifests", "01.json")); string(data) != `{"id":"01","v":2}` {
+		t.Errorf("expected the standby to hold the new manifest, got %s", data)
+	}
+	if status := replication.status(time.Now().Add(3 * time.Minute)); status["ready"] != false {
+		t.Errorf("expected a stale sync not to be ready, got %v", status)
+	}
+	if s := standby.status(); s["files"] != 4 || s["received"] != int64(5) {
+		t.Errorf("unexpected standby status %v", s)
+	}
+}
+
+func TestReplicationFileHandler(t *testing.T) {
+	logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	standby = &standbyStore{dir: t.TempDir()}
+	defer func() { standby = nil }()
+	r := gin.New()
+	r.Use(bodyLimits{
+		routes:    map[string]int64{"/replication/files/*path": 8},
+		streaming: map[string]bool{"/replication/files/*path": true},
+	}.middleware())
+	registerReplicationRoutes(r, "secret")
+
+	token := "secret"
+	put := func(path, sum, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/replication/files/"+path, strings.NewReader(body))
+		req.ContentLength = -1
+		req.Header.Set("Authorization", "Bearer "+token)
+		if sum != "" {
+			req.Header.Set(replicationChecksumHeader, sum)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	helloSum := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	token = ""
+	if w := put("a/b.json", helloSum, "hello"); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected a request without the token to be refused, got %d", w.Code)
+	}
+	token = "secret"
+	if w := put("a/b.json", strings.Repeat("0", 64), "hello, standby"); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected a file over the limit to be refused, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := put("a/b.json", "", "hello"); w.Code != http.StatusBadRequest {
+		t.Errorf("expected a missing checksum to be rejected, got %d", w.Code)
+	}
+	if w := put("a/b.json", strings.Repeat("0", 64), "hello"); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "does not match") {
+		t.Errorf("expected a wrong checksum to be rejected, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := put("..%2Fescape", helloSum, "hello"); w.Code != http.StatusBadRequest {
+		t.Errorf("expected a path outside the directory to be rejected, got %d", w.Code)
+	}
+	if w := put("a/b.json", helloSum, "hello"); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if data, _ := os.ReadFile(filepath.Join(standby.dir, "a", "b.json")); string(data) != "hello" {
+		t.Errorf("expected the file to be stored, got %q", data)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(standby.dir, "a")); len(entries) != 1 {
+		t.Errorf("expected no temporary files left, got %v", entries)
+	}
+	if s := standby.status(); s["rejected"] != int64(2) || s["received"] != int64(1) {
+		t.Errorf("unexpected standby status %v", s)
+	}
+
+	// A standby without a token accepts nobody.
+	open := gin.New()
+	registerReplicationRoutes(open, "")
+	req := httptest.NewRequest(http.MethodGet, "/replication/manifest", nil)
+	w := httptest.NewRecorder()
+	open.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected an empty token to refuse every request, got %d", w.Code)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/homveloper/exp-avro-json/server/ids"
+	"go.uber.org/zap"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// requestIDs names requests without an X-Request-ID header.
+var requestIDs = ids.NewULID()
+
+// requestIDMiddleware gives every request an ID, the caller's X-Request-ID
+// when it sent a usable one, echoed in the X-Request-ID response header and
+// in error bodies so a failure can be found in the server logs.
+func requestIDMiddleware(c *gin.Context) {
+	requestID(c)
+	c.Next()
+}
+
+// requestID returns the ID of the request, assigning it on first use.
+func requestID(c *gin.Context) string {
+	if id := c.GetString(requestIDHeader); id != "" {
+		return id
+	}
+	id := c.GetHeader(requestIDHeader)
+	if !usableRequestID(id) {
+		id = requestIDs.New()
+	}
+	c.Set(requestIDHeader, id)
+	c.Header(requestIDHeader, id)
+	// Shard backends and dispatched transport requests reuse it.
+	c.Request.Header.Set(requestIDHeader, id)
+	return id
+}
+
+// usableRequestID accepts up to 128 printable ASCII characters, so a
+// caller's ID cannot forge log lines or headers.
+func usableRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// requestIDMetadataKey is the metadata entry stored logs carry the ID of
+// the request that sent them under, so a record in an .avro file leads
+// back to the request's log lines and response.
+const requestIDMetadataKey = "request_id"
+
+// recordRequestIDs adds requestIDMetadataKey to the metadata of stored
+// logs; -request-id-metadata=false leaves bodies as sent.
+var recordRequestIDs = true
+
+// requestLogger returns the server logger with the request's ID, for the
+// log lines a handler writes.
+func requestLogger(c *gin.Context) *zap.Logger {
+	return logger.With(zap.String("request_id", requestID(c)))
+}
+
+// withRequestID returns metadata, a string map as /log or a decoded
+// LogData holds it, with the request ID added. The caller's own entry
+// wins, and metadata of any other shape, such as a logType schema's
+// record, is returned as it is.
+func withRequestID(metadata interface{}, id string) interface{} {
+	if !recordRequestIDs {
+		return metadata
+	}
+	switch m := metadata.(type) {
+	case nil:
+		return map[string]interface{}{requestIDMetadataKey: id}
+	case map[string]interface{}:
+		if _, ok := m[requestIDMetadataKey]; ok {
+			return m
+		}
+		out := make(map[string]interface{}, len(m)+1)
+		for k, v := range m {
+			out[k] = v
+		}
+		out[requestIDMetadataKey] = id
+		return out
+	case map[string]string:
+		if _, ok := m[requestIDMetadataKey]; ok {
+			return m
+		}
+		out := make(map[string]string, len(m)+1)
+		for k, v := range m {
+			out[k] = v
+		}
+		out[requestIDMetadataKey] = id
+		return out
+	}
+	return metadata
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestRequestIDPropagation(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	logger = zap.New(core)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(requestIDMiddleware)
+	r.POST("/log", logHandler)
+
+	post := func(req LogRequest) (*httptest.ResponseRecorder, map[string]interface{}) {
+		body, _ := json.Marshal(req)
+		httpReq := httptest.NewRequest(http.MethodPost, "/log?echo=full", bytes.NewReader(body))
+		httpReq.Header.Set("Content-Type", "application/json")
+		httpReq.Header.Set(requestIDHeader, "trace-7")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httpReq)
+		var resp map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w, resp
+	}
+
+	w, resp := post(warmupPayload(1))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if resp["request_id"] != "trace-7" || w.Header().Get(requestIDHeader) != "trace-7" {
+		t.Errorf("expected the request ID in the body and header, got %v and %q", resp["request_id"], w.Header().Get(requestIDHeader))
+	}
+	if logData, _ := resp["logdata_avro_json"].(string); !strings.Contains(logData, `"request_id":"trace-7"`) {
+		t.Errorf("expected the stored metadata to carry the request ID, got %s", logData)
+	}
+	processed := logs.FilterMessage("Log processed").All()
+	if len(processed) != 1 || processed[0].ContextMap()["request_id"] != "trace-7" {
+		t.Errorf("expected the log line to carry the request ID, got %+v", processed)
+	}
+
+	// A request ID the client put in the metadata is kept.
+	req := warmupPayload(1)
+	req.LogBody.Metadata = map[string]interface{}{requestIDMetadataKey: "client-1"}
+	if _, resp := post(req); !strings.Contains(resp["logdata_avro_json"].(string), `"request_id":"client-1"`) {
+		t.Errorf("expected the client's metadata entry to win, got %s", resp["logdata_avro_json"])
+	}
+}
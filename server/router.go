@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+	"github.com/homveloper/exp-avro-json/server/shard"
+	"go.uber.org/zap"
+)
+
+// Router mode turns the server into a thin proxy in front of several
+// instances. Log requests are forwarded to the instance that owns their
+// projectName on a consistent hash ring, so each project's partitions and
+// stats live on exactly one node.
+const shardNodeHeader = "X-Shard-Node"
+
+type shardBackend struct {
+	url      string
+	proxy    *httputil.ReverseProxy
+	requests atomic.Uint64
+	failures atomic.Uint64
+}
+
+type shardRouter struct {
+	ring     *shard.Ring
+	backends map[string]*shardBackend
+
+	// projects remembers where projects were routed for /shards, up to
+	// maxShardProjects of them, since project names come from clients.
+	// The ring never changes, so a remembered owner stays right.
+	mu        sync.RWMutex
+	projects  map[string]string
+	truncated bool
+}
+
+// maxShardProjects bounds the projects /shards lists.
+const maxShardProjects = 10000
+
+type shardBackendStats struct {
+	URL      string `json:"url"`
+	Requests uint64 `json:"requests"`
+	Failures uint64 `json:"failures"`
+}
+
+func newShardRouter(backendURLs []string, replicas int) (*shardRouter, error) {
+	router := &shardRouter{
+		ring:     shard.New(replicas, backendURLs...),
+		backends: make(map[string]*shardBackend),
+		projects: make(map[string]string),
+	}
+	for _, raw := range router.ring.Nodes() {
+		target, err := url.Parse(raw)
+		if err != nil {
+			return nil, err
+		}
+		backend := &shardBackend{url: raw, proxy: httputil.NewSingleHostReverseProxy(target)}
+		backend.proxy.ModifyResponse = func(resp *http.Response) error {
+			// The backend echoes the router's request ID, which the
+			// router has already set.
+			resp.Header.Del(requestIDHeader)
+			return nil
+		}
+		backend.proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+			backend.failures.Add(1)
+			logger.Error("Shard backend request failed",
+				zap.String("backend", backend.url),
+				zap.String("path", r.URL.Path),
+				zap.Error(err))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadGateway)
+			json.NewEncoder(w).Encode(apiError{Code: codeBackendUnavailable, Message: "Shard backend unavailable", RequestID: r.Header.Get(requestIDHeader)})
+		}
+		router.backends[raw] = backend
+	}
+	return router, nil
+}
+
+// logHandler forwards a /log request to the owner of its projectName.
+func (router *shardRouter) logHandler(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		requestLogger(c).Error("Failed to read log request", zap.Error(err))
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	var key struct {
+		ProjectName string `json:"projectName"`
+	}
+	if err := json.Unmarshal(body, &key); err != nil {
+		requestLogger(c).Error("Failed to bind log request", zap.Error(err))
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	router.forward(c, key.ProjectName, body)
+}
+
+// logBinaryHandler forwards a /log/binary request. The project comes from
+// the projectName query parameter or, for wrapper datums, from the record.
+func (router *shardRouter) logBinaryHandler(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		requestLogger(c).Error("Failed to read binary log request", zap.Error(err))
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	project := c.Query("projectName")
+	if project == "" {
+		var wrapper avrojson.LogWrapper
+		if err := avrojson.Decode(avrojson.WrapperSchema, body, &wrapper); err == nil {
+			project = wrapper.ProjectName
+		}
+	}
+	router.forward(c, project, body)
+}
+
+// projectHandler forwards a per-project request, such as a schema pin
+// change, to the instance that ingests the project's logs.
+func (router *shardRouter) projectHandler(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	router.forward(c, c.Param("project"), body)
+}
+
+func (router *shardRouter) forward(c *gin.Context, project string, body []byte) {
+	if project == "" {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "projectName is required for shard routing")
+		return
+	}
+
+	backend := router.backends[router.ring.Get(project)]
+	backend.requests.Add(1)
+	router.remember(project, backend.url)
+
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	c.Request.ContentLength = int64(len(body))
+	c.Header(shardNodeHeader, backend.url)
+	backend.proxy.ServeHTTP(c.Writer, c.Request)
+}
+
+func (router *shardRouter) remember(project, node string) {
+	router.mu.RLock()
+	known := router.projects[project] == node
+	router.mu.RUnlock()
+	if known {
+		return
+	}
+	router.mu.Lock()
+	if _, ok := router.projects[project]; ok || len(router.projects) < maxShardProjects {
+		router.projects[project] = node
+	} else {
+		router.truncated = true
+	}
+	router.mu.Unlock()
+}
+
+// shardsHandler reports the ring members and where projects were routed,
+// with projects_truncated set once more projects were seen than are kept.
+// With ?project=name it only resolves the owner of that project.
+func (router *shardRouter) shardsHandler(c *gin.Context) {
+	if project := c.Query("project"); project != "" {
+		c.JSON(http.StatusOK, gin.H{"project": project, "node": router.ring.Get(project)})
+		return
+	}
+
+	backends := make([]shardBackendStats, 0, len(router.backends))
+	for _, node := range router.ring.Nodes() {
+		b := router.backends[node]
+		backends = append(backends, shardBackendStats{
+			URL:      b.url,
+			Requests: b.requests.Load(),
+			Failures: b.failures.Load(),
+		})
+	}
+	sort.Slice(backends, func(i, j int) bool { return backends[i].URL < backends[j].URL })
+
+	router.mu.RLock()
+	projects := make(map[string]string, len(router.projects))
+	for project, node := range router.projects {
+		projects[project] = node
+	}
+	truncated := router.truncated
+	router.mu.RUnlock()
+
+	c.JSON(http.StatusOK, gin.H{
+		"backends":           backends,
+		"projects":           projects,
+		"projects_truncated": truncated,
+	})
+}
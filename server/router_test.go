@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func TestShardRouterPinsProjectsToOneBackend(t *testing.T) {
+	logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+
+	var mu sync.Mutex
+	hits := make(map[string]map[string]int)
+	var backendURLs []string
+	for i := 0; i < 3; i++ {
+		var srv *httptest.Server
+		srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req LogRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			mu.Lock()
+			defer mu.Unlock()
+			if hits[srv.URL] == nil {
+				hits[srv.URL] = make(map[string]int)
+			}
+			hits[srv.URL][req.ProjectName]++
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer srv.Close()
+		backendURLs = append(backendURLs, srv.URL)
+	}
+
+	router, err := newShardRouter(backendURLs, 0)
+	if err != nil {
+		t.Fatalf("Failed to create shard router: %v", err)
+	}
+	r := gin.New()
+	r.POST("/log", router.logHandler)
+	// httputil.ReverseProxy needs a real connection; ResponseRecorder does
+	// not support gin's CloseNotify.
+	front := httptest.NewServer(r)
+	defer front.Close()
+
+	projects := []string{"alpha", "bravo", "charlie", "delta", "echo", "foxtrot"}
+	for round := 0; round < 3; round++ {
+		for _, project := range projects {
+			body, _ := json.Marshal(gin.H{"projectName": project})
+			resp, err := http.Post(front.URL+"/log", "application/json", bytes.NewReader(body))
+			if err != nil {
+				t.Fatalf("Failed to send log request: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("expected 200 for %s, got %d", project, resp.StatusCode)
+			}
+			if got, want := resp.Header.Get(shardNodeHeader), router.ring.Get(project); got != want {
+				t.Errorf("expected %s to be routed to %s, got %s", project, want, got)
+			}
+		}
+	}
+
+	for _, project := range projects {
+		owners := 0
+		for _, byProject := range hits {
+			if n := byProject[project]; n > 0 {
+				owners++
+				if n != 3 {
+					t.Errorf("expected all 3 requests for %s on one backend, got %d", project, n)
+				}
+			}
+		}
+		if owners != 1 {
+			t.Errorf("expected %s to live on one backend, found %d", project, owners)
+		}
+	}
+}
+
+func TestShardRouterRejectsMissingProject(t *testing.T) {
+	logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+
+	router, err := newShardRouter([]string{"http://127.0.0.1:1"}, 0)
+	if err != nil {
+		t.Fatalf("Failed to create shard router: %v", err)
+	}
+	r := gin.New()
+	r.POST("/log", router.logHandler)
+	front := httptest.NewServer(r)
+	defer front.Close()
+
+	for body, want := range map[string]int{
+		`{"logType":"x"}`:         http.StatusBadRequest,
+		`{"projectName":"alpha"}`: http.StatusBadGateway,
+	} {
+		resp, err := http.Post(front.URL+"/log", "application/json", bytes.NewReader([]byte(body)))
+		if err != nil {
+			t.Fatalf("Failed to send log request: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("expected %d for %s, got %d", want, body, resp.StatusCode)
+		}
+	}
+}
+
+func TestShardRouterBoundsRememberedProjects(t *testing.T) {
+	router, err := newShardRouter([]string{"http://127.0.0.1:1"}, 0)
+	if err != nil {
+		t.Fatalf("Failed to create shard router: %v", err)
+	}
+	for i := 0; i < maxShardProjects+5; i++ {
+		router.remember(strconv.Itoa(i), "http://127.0.0.1:1")
+	}
+	router.remember("0", "http://127.0.0.1:1")
+	if len(router.projects) != maxShardProjects || !router.truncated {
+		t.Errorf("expected %d remembered projects and truncation, got %d (%v)", maxShardProjects, len(router.projects), router.truncated)
+	}
+}
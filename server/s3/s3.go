@@ -0,0 +1,323 @@
+// Package s3 uploads objects to Amazon S3 or an S3-compatible store such as
+// MinIO, Ceph or R2. Requests are signed with Signature Version 4 by hand,
+// so no SDK is needed. Objects larger than the part size go up as
+// multipart uploads, and every request is retried on throttling, server
+// errors and network failures.
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// MinPartSize is the smallest part S3 accepts, except for the last.
+	MinPartSize = 5 << 20
+	// DefaultPartSize is used when Config.PartSize is zero.
+	DefaultPartSize = 8 << 20
+	// maxParts is the most parts one multipart upload may have.
+	maxParts = 10000
+)
+
+// Config configures a Client.
+type Config struct {
+	// Endpoint is the base URL of the store. Empty uses AWS for Region.
+	Endpoint string
+	Region   string
+	Bucket   string
+
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is set for temporary credentials.
+	SessionToken string
+
+	// PathStyle addresses the bucket as the first path segment instead of
+	// a subdomain, as MinIO and most self-hosted stores expect.
+	PathStyle bool
+	// PartSize is the size of each part of a multipart upload; objects up
+	// to this size are sent with a single PUT. Zero uses DefaultPartSize.
+	PartSize int64
+	// MaxRetries is how many times a failed request is retried.
+	MaxRetries int
+
+	// HTTPClient sends the requests; nil uses http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// Error is an error response from the store.
+type Error struct {
+	StatusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("s3: HTTP %d", e.StatusCode)
+	}
+	return fmt.Sprintf("s3: %s: %s (HTTP %d)", e.Code, e.Message, e.StatusCode)
+}
+
+// retryable reports whether the request may succeed if sent again.
+func (e *Error) retryable() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests ||
+		e.Code == "SlowDown" || e.Code == "RequestTimeout" || e.Code == "InternalError"
+}
+
+// Client uploads objects to one bucket. It is safe for concurrent use.
+type Client struct {
+	cfg      Config
+	endpoint *url.URL
+	http     *http.Client
+
+	// Overridden by tests.
+	now     func() time.Time
+	backoff time.Duration
+}
+
+// New checks cfg and returns a client for its bucket.
+func New(cfg Config) (*Client, error) {
+	if cfg.Bucket == "" {
+		return nil, errors.New("s3: bucket is required")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+		return nil, errors.New("s3: access key ID and secret access key are required")
+	}
+	if cfg.PartSize == 0 {
+		cfg.PartSize = DefaultPartSize
+	}
+	if cfg.PartSize < MinPartSize {
+		return nil, fmt.Errorf("s3: part size %d is below the %d byte minimum", cfg.PartSize, MinPartSize)
+	}
+	if cfg.MaxRetries < 0 {
+		return nil, fmt.Errorf("s3: negative MaxRetries %d", cfg.MaxRetries)
+	}
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + cfg.Region + ".amazonaws.com"
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("s3: invalid endpoint %q", endpoint)
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Client{cfg: cfg, endpoint: u, http: client, now: time.Now, backoff: 200 * time.Millisecond}, nil
+}
+
+// Bucket returns the bucket the client uploads to.
+func (c *Client) Bucket() string { return c.cfg.Bucket }
+
+// UploadFile uploads the file at path as key.
+func (c *Client) UploadFile(ctx context.Context, key, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return c.Upload(ctx, key, f, info.Size())
+}
+
+// Upload stores size bytes of r as key, with a single PUT up to the part
+// size and a multipart upload above it.
+func (c *Client) Upload(ctx context.Context, key string, r io.ReaderAt, size int64) error {
+	if size <= c.cfg.PartSize {
+		data := make([]byte, size)
+		if _, err := r.ReadAt(data, 0); err != nil && err != io.EOF {
+			return err
+		}
+		_, err := c.do(ctx, http.MethodPut, key, nil, data)
+		return err
+	}
+	return c.uploadMultipart(ctx, key, r, size)
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+func (c *Client) uploadMultipart(ctx context.Context, key string, r io.ReaderAt, size int64) error {
+	partSize := c.cfg.PartSize
+	if (size+partSize-1)/partSize > maxParts {
+		// Grow parts rather than fail on very large objects.
+		partSize = (size + maxParts - 1) / maxParts
+	}
+
+	resp, err := c.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil)
+	if err != nil {
+		return fmt.Errorf("start multipart upload: %w", err)
+	}
+	var initiated struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.Unmarshal(resp.body, &initiated); err != nil || initiated.UploadID == "" {
+		return fmt.Errorf("s3: malformed InitiateMultipartUpload response: %q", resp.body)
+	}
+	uploadID := initiated.UploadID
+
+	parts, err := c.uploadParts(ctx, key, uploadID, r, size, partSize)
+	if err == nil {
+		err = c.completeMultipart(ctx, key, uploadID, parts)
+	}
+	if err != nil {
+		// Abort so the store does not keep billing for orphaned parts.
+		// The context may be what failed, so abort on a fresh one.
+		abortCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if _, abortErr := c.do(abortCtx, http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil); abortErr != nil {
+			return fmt.Errorf("%w (abort also failed: %v)", err, abortErr)
+		}
+		return err
+	}
+	return nil
+}
+
+func (c *Client) uploadParts(ctx context.Context, key, uploadID string, r io.ReaderAt, size, partSize int64) ([]completedPart, error) {
+	var parts []completedPart
+	buf := make([]byte, partSize)
+	for offset, number := int64(0), 1; offset < size; offset, number = offset+partSize, number+1 {
+		n := partSize
+		if size-offset < n {
+			n = size - offset
+		}
+		if _, err := r.ReadAt(buf[:n], offset); err != nil && err != io.EOF {
+			return nil, err
+		}
+		query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {uploadID}}
+		resp, err := c.do(ctx, http.MethodPut, key, query, buf[:n])
+		if err != nil {
+			return nil, fmt.Errorf("upload part %d: %w", number, err)
+		}
+		etag := resp.header.Get("ETag")
+		if etag == "" {
+			return nil, fmt.Errorf("s3: part %d response has no ETag", number)
+		}
+		parts = append(parts, completedPart{PartNumber: number, ETag: etag})
+	}
+	return parts, nil
+}
+
+func (c *Client) completeMultipart(ctx context.Context, key, uploadID string, parts []completedPart) error {
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(ctx, http.MethodPost, key, url.Values{"uploadId": {uploadID}}, body)
+	if err != nil {
+		return fmt.Errorf("complete multipart upload: %w", err)
+	}
+	// S3 can report a failed completion in a 200 response.
+	if e := parseError(resp.status, resp.body); e != nil {
+		return fmt.Errorf("complete multipart upload: %w", e)
+	}
+	return nil
+}
+
+type response struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// do sends one signed request, retrying with exponential backoff.
+func (c *Client) do(ctx context.Context, method, key string, query url.Values, body []byte) (*response, error) {
+	var lastErr error
+	for attempt := 0; attempt <= c.cfg.MaxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(c.backoff << (attempt - 1)):
+			}
+		}
+		resp, err := c.send(ctx, method, key, query, body)
+		if err == nil {
+			return resp, nil
+		}
+		lastErr = err
+		var s3Err *Error
+		if errors.As(err, &s3Err) && !s3Err.retryable() {
+			return nil, err
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+	return nil, lastErr
+}
+
+func (c *Client) send(ctx context.Context, method, key string, query url.Values, body []byte) (*response, error) {
+	u := *c.endpoint
+	path := "/" + strings.TrimPrefix(key, "/")
+	if c.cfg.PathStyle {
+		path = "/" + c.cfg.Bucket + path
+	} else {
+		u.Host = c.cfg.Bucket + "." + u.Host
+	}
+	u.Path = strings.TrimSuffix(c.endpoint.Path, "/") + path
+	u.RawPath = escapePath(u.Path)
+	u.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	payloadHash := emptyPayloadHash
+	if len(body) > 0 {
+		payloadHash = hexSHA256(body)
+	}
+	c.sign(req, payloadHash, c.now())
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		if e := parseError(resp.StatusCode, data); e != nil {
+			return nil, e
+		}
+		return nil, &Error{StatusCode: resp.StatusCode}
+	}
+	return &response{status: resp.StatusCode, header: resp.Header, body: data}, nil
+}
+
+// parseError returns the <Error> document in body, if any.
+func parseError(status int, body []byte) *Error {
+	if !bytes.Contains(body, []byte("<Error>")) {
+		return nil
+	}
+	e := &Error{StatusCode: status}
+	if err := xml.Unmarshal(body, e); err != nil {
+		return nil
+	}
+	return e
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/homveloper/exp-avro-json/server/s3"
+	"go.uber.org/zap"
+)
+
+// The S3 sink writes logs to OCF files in its own spool directory and
+// uploads every finished file, on roll-over and on close, to an
+// S3-compatible bucket under a time-partitioned key:
+//
+//	<prefix>/<stream>/dt=2026-10-14/hour=09/<file>.avro
+//
+// The partition is the file's creation time, read from the ID in its name.
+// Uploads run in the background with retries; a file that still fails
+// stays in the spool directory and is counted in /stats, and uploaded files
+// are removed unless keep_local is set. Credentials come from the standard
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN variables.
+type s3SinkOptions struct {
+	Bucket    string `json:"bucket"`
+	Endpoint  string `json:"endpoint"`
+	Region    string `json:"region"`
+	Prefix    string `json:"prefix"`
+	PathStyle bool   `json:"path_style"`
+	PartSize  int64  `json:"part_size"`
+	Retries   int    `json:"retries"`
+
+	// Dir spools the OCF files until they are uploaded.
+	Dir       string `json:"dir"`
+	KeepLocal bool   `json:"keep_local"`
+	ocfTuning
+}
+
+// s3Sink spools logs in its ocfStore, or in multi-tenant mode in one store
+// per project below the spool dir, and uploads the finished files.
+type s3Sink struct {
+	store    ocfStore
+	tenants  *tenantStores
+	uploader *s3Uploader
+}
+
+type s3Uploader struct {
+	client      *s3.Client
+	prefix      string
+	deleteLocal bool
+	// tenantSpool, in multi-tenant mode, is the spool dir whose project
+	// subdirectories are uploaded below <prefix>/<project>.
+	tenantSpool string
+	queue       chan string
+	timeout     time.Duration
+	// pending counts the queued files not yet done.
+	pending sync.WaitGroup
+
+	uploaded atomic.Int64
+	failed   atomic.Int64
+	dropped  atomic.Int64
+	bytes    atomic.Int64
+
+	mu        sync.Mutex
+	lastError string
+}
+
+// s3QueueSize bounds the files waiting for upload. OCF files roll every
+// max_records records, so a full queue means the store is far behind.
+const s3QueueSize = 1024
+
+func newS3Sink(opts s3SinkOptions) (Sink, error) {
+	if opts.Bucket == "" {
+		return nil, errors.New("bucket is required")
+	}
+	if opts.Dir == "" {
+		return nil, errors.New("dir is required")
+	}
+	if opts.Region == "" {
+		opts.Region = os.Getenv("AWS_REGION")
+	}
+	client, err := s3.New(s3.Config{
+		Endpoint:        opts.Endpoint,
+		Region:          opts.Region,
+		Bucket:          opts.Bucket,
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		PathStyle:       opts.PathStyle,
+		PartSize:        opts.PartSize,
+		MaxRetries:      opts.Retries,
+	})
+	if err != nil {
+		return nil, err
+	}
+	sink := &s3Sink{uploader: newS3Uploader(client, opts.Prefix, !opts.KeepLocal)}
+	if tenants != nil {
+		if sink.tenants, err = newTenantStores(opts.Dir, opts.ocfTuning, sink.uploader.enqueue); err != nil {
+			return nil, err
+		}
+		sink.uploader.tenantSpool = opts.Dir
+	} else if err := sink.store.open(opts.Dir, opts.ocfTuning, sink.uploader.enqueue); err != nil {
+		return nil, err
+	}
+	go sink.uploader.run()
+	return sink, nil
+}
+
+func (s *s3Sink) Write(ctx context.Context, record sinkRecord) error {
+	if s.tenants != nil {
+		store, err := s.tenants.store(record.Project)
+		if err != nil {
+			return err
+		}
+		return store.append(record.Encoded)
+	}
+	return s.store.append(record.Encoded)
+}
+
+func (s *s3Sink) Sync() error {
+	if s.tenants != nil {
+		return s.tenants.sync()
+	}
+	return s.store.sync()
+}
+
+// Close closes the spooled files, which queues their upload, and waits
+// for the uploads to finish.
+func (s *s3Sink) Close() error {
+	var err error
+	if s.tenants != nil {
+		err = s.tenants.close()
+	} else {
+		err = s.store.close()
+	}
+	s.uploader.wait()
+	return err
+}
+
+func (s *s3Sink) openFiles() []string {
+	if s.tenants != nil {
+		return s.tenants.openFiles()
+	}
+	return s.store.openFiles()
+}
+
+func (s *s3Sink) Dir() string {
+	if s.tenants != nil {
+		return s.tenants.dir
+	}
+	return s.store.dir
+}
+
+func (s *s3Sink) Stats() gin.H {
+	stats := s.uploader.stats()
+	if s.tenants != nil {
+		stats["spool"] = s.tenants.stats()
+	} else {
+		stats["spool"] = s.store.stats()
+	}
+	return stats
+}
+
+func newS3Uploader(client *s3.Client, prefix string, deleteLocal bool) *s3Uploader {
+	return &s3Uploader{
+		client:      client,
+		prefix:      strings.Trim(prefix, "/"),
+		deleteLocal: deleteLocal,
+		queue:       make(chan string, s3QueueSize),
+		timeout:     10 * time.Minute,
+	}
+}
+
+// enqueue is the OnFileClosed hook of the spool's streams. It runs with
+// the stream locked, so it only queues the file.
+func (u *s3Uploader) enqueue(file string) {
+	u.pending.Add(1)
+	select {
+	case u.queue <- file:
+	default:
+		u.pending.Done()
+		u.dropped.Add(1)
+		logger.Error("S3 upload queue is full; file stays local only", zap.String("file", file))
+	}
+}
+
+func (u *s3Uploader) run() {
+	for file := range u.queue {
+		u.upload(file)
+		u.pending.Done()
+	}
+}
+
+// wait blocks until every queued file is uploaded or has failed.
+func (u *s3Uploader) wait() {
+	u.pending.Wait()
+}
+
+func (u *s3Uploader) upload(file string) {
+	prefix := u.prefix
+	if u.tenantSpool != "" {
+		// Files of <spool>/<project>/ go below <prefix>/<project>/.
+		prefix = path.Join(prefix, filepath.Base(filepath.Dir(file)))
+	}
+	key := s3ObjectKey(prefix, file)
+	ctx, cancel := context.WithTimeout(context.Background(), u.timeout)
+	defer cancel()
+	info, err := os.Stat(file)
+	if err == nil {
+		err = u.client.UploadFile(ctx, key, file)
+	}
+	if err != nil {
+		u.failed.Add(1)
+		u.mu.Lock()
+		u.lastError = err.Error()
+		u.mu.Unlock()
+		logger.Error("Failed to upload OCF file to S3", zap.String("file", file), zap.String("key", key), zap.Error(err))
+		return
+	}
+	u.uploaded.Add(1)
+	u.bytes.Add(info.Size())
+	logger.Info("Uploaded OCF file to S3", zap.String("bucket", u.client.Bucket()), zap.String("key", key), zap.Int64("bytes", info.Size()))
+	if u.deleteLocal {
+		if err := os.Remove(file); err != nil {
+			logger.Warn("Failed to remove uploaded OCF file", zap.String("file", file), zap.Error(err))
+		}
+	}
+}
+
+// s3ObjectKey partitions file by the creation time embedded in the ID of
+// its <stream>-<id>.avro name, falling back to its modification time.
+func s3ObjectKey(prefix, file string) string {
+	name := filepath.Base(file)
+	stream, id := "", strings.TrimSuffix(name, ".avro")
+	if i := strings.LastIndexByte(id, '-'); i >= 0 {
+		stream, id = id[:i], id[i+1:]
+	}
+	created, err := logIDs.Time(id)
+	if err != nil {
+		created = time.Now()
+		if info, statErr := os.Stat(file); statErr == nil {
+			created = info.ModTime()
+		}
+	}
+	created = created.UTC()
+	return path.Join(prefix, stream, "dt="+created.Format("2006-01-02"), "hour="+created.Format("15"), name)
+}
+
+func (u *s3Uploader) stats() gin.H {
+	u.mu.Lock()
+	lastError := u.lastError
+	u.mu.Unlock()
+	stats := gin.H{
+		"bucket":         u.client.Bucket(),
+		"prefix":         u.prefix,
+		"uploaded":       u.uploaded.Load(),
+		"uploaded_bytes": u.bytes.Load(),
+		"failed":         u.failed.Load(),
+		"dropped":        u.dropped.Load(),
+		"pending":        len(u.queue),
+	}
+	if lastError != "" {
+		stats["last_error"] = lastError
+	}
+	return stats
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/homveloper/exp-avro-json/server/ids"
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+	"go.uber.org/zap"
+)
+
+func TestS3SinkUploadsSpooledOCFFiles(t *testing.T) {
+	logger = zap.NewNop()
+	var mu sync.Mutex
+	objects := map[string][]byte{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		objects[strings.TrimPrefix(r.URL.Path, "/logs/")] = body
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "id")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	dir := t.TempDir()
+	sink, err := newS3Sink(s3SinkOptions{Endpoint: srv.URL, Bucket: "logs", PathStyle: true, Prefix: "/archive/", Dir: dir, ocfTuning: ocfTuning{MaxRecords: 1}})
+	if err != nil {
+		t.Fatalf("Failed to create S3 sink: %v", err)
+	}
+	s3 := sink.(*s3Sink)
+	defer func() {
+		// Closing uploads the open files too; wait so no upload outlives
+		// the test.
+		s3.store.wrapper.Close()
+		s3.store.logData.Close()
+		s3.uploader.wait()
+	}()
+
+	// With one record per file, the second log rolls the first files over.
+	for i := 0; i < 2; i++ {
+		encoded, err := avrojson.EncodeLog(avrojson.LogWrapper{ProjectName: "p"}, avrojson.LogData{Timestamp: time.UnixMilli(1).UTC(), Logtype: "t", Version: "1", Issuer: "i"})
+		if err != nil {
+			t.Fatalf("Failed to encode log: %v", err)
+		}
+		if err := sink.Write(context.Background(), sinkRecord{Project: "p", Encoded: encoded}); err != nil {
+			t.Fatalf("Failed to write log: %v", err)
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for s3.uploader.uploaded.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(objects) != 2 {
+		t.Fatalf("expected the two rolled files to be uploaded, got %v", objects)
+	}
+	for key, data := range objects {
+		if !strings.HasPrefix(key, "archive/") || !strings.Contains(key, "/dt=") || !strings.Contains(key, "/hour=") {
+			t.Errorf("unexpected key %q", key)
+		}
+		if !strings.HasPrefix(string(data), "Obj\x01") {
+			t.Errorf("object %q is not an OCF file", key)
+		}
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.avro")); len(files) != 2 {
+		t.Errorf("expected only the two open files to remain locally, got %v", files)
+	}
+	if stats := s3.Stats(); stats["uploaded"] != int64(2) || stats["failed"] != int64(0) || stats["spool"] == nil {
+		t.Errorf("unexpected stats %v", stats)
+	}
+}
+
+func TestS3ObjectKeyPartitionsByFileID(t *testing.T) {
+	gen := ids.NewULID()
+	id := gen.New()
+	created, _ := gen.Time(id)
+	created = created.UTC()
+	defer func(prev ids.Generator) { logIDs = prev }(logIDs)
+	logIDs = gen
+
+	key := s3ObjectKey("logs", filepath.Join(os.TempDir(), "LogData-v2-"+id+".avro"))
+	want := "logs/LogData-v2/dt=" + created.Format("2006-01-02") + "/hour=" + created.Format("15") + "/LogData-v2-" + id + ".avro"
+	if key != want {
+		t.Errorf("s3ObjectKey = %q, want %q", key, want)
+	}
+}
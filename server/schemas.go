@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+	"github.com/homveloper/exp-avro-json/server/registry"
+	"go.uber.org/zap"
+)
+
+var schemaRegistry *registry.Registry
+
+// openSchemaRegistry loads the registry from dir and registers the built-in
+// pipeline schemas, which is a no-op once they are stored.
+func openSchemaRegistry(dir string) error {
+	reg, err := registry.Open(dir)
+	if err != nil {
+		return err
+	}
+	for name, schema := range avrojson.BuiltinSchemas() {
+		s, created, err := reg.Register(name, schema)
+		if err != nil {
+			return err
+		}
+		if created {
+			logger.Info("Registered built-in schema", zap.String("name", s.Name), zap.Int("version", s.Version))
+		}
+	}
+	schemaRegistry = reg
+	return nil
+}
+
+// resolveSchema looks up a registered schema; version 0 selects the latest.
+func resolveSchema(name string, version int) (registry.Schema, error) {
+	return schemaRegistry.Get(name, version)
+}
+
+// singleObjectVersion returns the live version of name whose fingerprint
+// starts data, a single-object encoded datum.
+func singleObjectVersion(name string, data []byte) (registry.Schema, bool) {
+	fingerprint, _, err := avrojson.SingleObjectFingerprint(data)
+	if err != nil {
+		return registry.Schema{}, false
+	}
+	sub, err := schemaRegistry.Subject(name)
+	if err != nil {
+		return registry.Schema{}, false
+	}
+	hex := avrojson.FormatFingerprint(fingerprint)
+	for _, version := range sub.Versions {
+		if s, err := resolveSchema(name, version); err == nil && s.Fingerprint == hex {
+			return s, true
+		}
+	}
+	return registry.Schema{}, false
+}
+
+type registerSchemaRequest struct {
+	Name string `json:"name"`
+	// Schema is the Avro schema either as a JSON value or as a string
+	// holding one.
+	Schema json.RawMessage `json:"schema" binding:"required"`
+}
+
+func registerSchemaRoutes(r *gin.Engine) {
+	r.POST("/schemas", registerSchemaHandler)
+	r.GET("/schemas", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"subjects": schemaRegistry.Subjects()})
+	})
+	r.GET("/schemas/:name", func(c *gin.Context) {
+		sub, err := schemaRegistry.Subject(c.Param("name"))
+		if err != nil {
+			respondError(c, http.StatusNotFound, codeUnknownSchema, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, sub)
+	})
+	r.GET("/schemas/:name/versions/:version", func(c *gin.Context) {
+		version, ok := parseSchemaVersion(c)
+		if !ok {
+			return
+		}
+		s, err := resolveSchema(c.Param("name"), version)
+		if err != nil {
+			respondError(c, http.StatusNotFound, codeUnknownSchema, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, s)
+	})
+	r.GET("/schemas/:name/sample", sampleSchemaHandler)
+	r.POST("/schemas/:name/compat", schemaCompatHandler)
+	r.DELETE("/schemas/:name", func(c *gin.Context) {
+		deleteSchema(c, 0)
+	})
+	r.DELETE("/schemas/:name/versions/:version", func(c *gin.Context) {
+		version, ok := parseSchemaVersion(c)
+		if !ok {
+			return
+		}
+		deleteSchema(c, version)
+	})
+}
+
+func registerSchemaHandler(c *gin.Context) {
+	var req registerSchemaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		requestLogger(c).Error("Failed to bind schema request", zap.Error(err))
+		respondBindError(c, err)
+		return
+	}
+
+	schema := string(req.Schema)
+	var quoted string
+	if json.Unmarshal(req.Schema, &quoted) == nil {
+		schema = quoted
+	}
+
+	s, created, err := schemaRegistry.Register(req.Name, schema)
+	if errors.Is(err, registry.ErrInvalidSchema) {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	if err != nil {
+		requestLogger(c).Error("Failed to register schema", zap.String("name", req.Name), zap.Error(err))
+		respondError(c, http.StatusInternalServerError, codeInternal, "Failed to register schema")
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+		requestLogger(c).Info("Schema registered",
+			zap.String("name", s.Name),
+			zap.Int("version", s.Version),
+			zap.String("fingerprint", s.Fingerprint))
+	}
+	c.JSON(status, s)
+}
+
+type schemaCompatRequest struct {
+	// Schema is the candidate, as a JSON value or a string holding one.
+	Schema json.RawMessage `json:"schema" binding:"required"`
+	// Mode is BACKWARD (the default), FORWARD or FULL.
+	Mode string `json:"mode"`
+	// Version checks against one version; 0 checks every live version.
+	Version int `json:"version"`
+}
+
+// schemaCompatHandler checks a candidate schema against the registered
+// versions of a subject without registering it, so a new version can be
+// gated before it is deployed. Incompatible candidates are still a 200,
+// with "compatible": false and every incompatibility per version.
+func schemaCompatHandler(c *gin.Context) {
+	var req schemaCompatRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	mode := avrojson.CompatibilityBackward
+	if req.Mode != "" {
+		var err error
+		if mode, err = avrojson.ParseCompatibilityMode(req.Mode); err != nil {
+			respondErrorWith(c, http.StatusBadRequest, apiError{Code: codeInvalidRequest, Message: err.Error(), Field: "mode"}, nil)
+			return
+		}
+	}
+	schema := string(req.Schema)
+	var quoted string
+	if json.Unmarshal(req.Schema, &quoted) == nil {
+		schema = quoted
+	}
+	if _, err := avrojson.NewCodec(schema); err != nil {
+		respondErrorWith(c, http.StatusBadRequest, apiError{Code: codeInvalidRequest, Message: "Invalid schema: " + err.Error(), Field: "schema"}, nil)
+		return
+	}
+
+	name := c.Param("name")
+	versions := []int{req.Version}
+	if req.Version == 0 {
+		sub, err := schemaRegistry.Subject(name)
+		if err != nil {
+			respondError(c, http.StatusNotFound, codeUnknownSchema, err.Error())
+			return
+		}
+		versions = sub.Versions
+	}
+
+	compatible := true
+	results := make([]gin.H, 0, len(versions))
+	for _, version := range versions {
+		s, err := resolveSchema(name, version)
+		if err != nil {
+			respondError(c, http.StatusNotFound, codeUnknownSchema, err.Error())
+			return
+		}
+		issues, err := avrojson.CheckCompatibility(s.Schema, schema, mode)
+		if err != nil {
+			requestLogger(c).Error("Failed to check schema compatibility", zap.String("name", name), zap.Int("version", version), zap.Error(err))
+			respondError(c, http.StatusInternalServerError, codeInternal, "Failed to check compatibility with version "+strconv.Itoa(version))
+			return
+		}
+		if issues == nil {
+			issues = []avrojson.Incompatibility{}
+		}
+		compatible = compatible && len(issues) == 0
+		results = append(results, gin.H{
+			"version":           s.Version,
+			"fingerprint":       s.Fingerprint,
+			"compatible":        len(issues) == 0,
+			"incompatibilities": issues,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"name":       name,
+		"mode":       mode,
+		"compatible": compatible,
+		"versions":   results,
+	})
+}
+
+func deleteSchema(c *gin.Context, version int) {
+	name := c.Param("name")
+	if _, builtin := avrojson.BuiltinSchemas()[name]; builtin {
+		respondError(c, http.StatusConflict, codeConflict, "Built-in schema "+name+" cannot be deleted")
+		return
+	}
+	if err := schemaRegistry.Delete(name, version); err != nil {
+		if errors.Is(err, registry.ErrNotFound) {
+			respondError(c, http.StatusNotFound, codeUnknownSchema, err.Error())
+			return
+		}
+		if errors.Is(err, registry.ErrPinned) {
+			respondError(c, http.StatusConflict, codeConflict, err.Error())
+			return
+		}
+		requestLogger(c).Error("Failed to delete schema", zap.String("name", name), zap.Error(err))
+		respondError(c, http.StatusInternalServerError, codeInternal, "Failed to delete schema")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "deleted", "name": name, "version": version})
+}
+
+// sampleSchemaHandler generates a random datum of a registered schema. The
+// version and seed query parameters pick the schema version (latest by
+// default) and make the sample reproducible; without a seed one is chosen
+// and returned. The record is Avro JSON, with {"type": value} union
+// wrappers, or plain JSON with strip_unions=true.
+func sampleSchemaHandler(c *gin.Context) {
+	name := c.Param("name")
+	version := 0
+	if v := c.Query("version"); v != "" && v != "latest" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, "version must be a positive integer or latest")
+			return
+		}
+		version = n
+	}
+	seed := rand.Int63n(math.MaxInt64-1) + 1
+	if v := c.Query("seed"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n == 0 {
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, "seed must be a non-zero integer")
+			return
+		}
+		seed = n
+	}
+	stripUnions, _ := strconv.ParseBool(c.Query("strip_unions"))
+
+	s, err := resolveSchema(name, version)
+	if err != nil {
+		respondError(c, http.StatusNotFound, codeUnknownSchema, err.Error())
+		return
+	}
+	codec, err := avrojson.DefaultCache.Get(s.Schema)
+	if err != nil {
+		requestLogger(c).Error("Failed to create Avro codec", zap.String("schema", name), zap.Error(err))
+		respondError(c, http.StatusInternalServerError, codeInternal, "Failed to create Avro codec")
+		return
+	}
+
+	native, err := codec.Sample(seed)
+	var binary, text []byte
+	if err == nil {
+		// Encoding checks the sample really conforms to the schema.
+		binary, err = codec.EncodeNative(native)
+	}
+	if err == nil {
+		text, err = codec.BinaryToJSON(binary)
+	}
+	if err != nil {
+		requestLogger(c).Error("Failed to generate sample", zap.String("schema", name), zap.Int64("seed", seed), zap.Error(err))
+		respondError(c, http.StatusInternalServerError, codeInternal, "Failed to generate a sample: "+err.Error())
+		return
+	}
+
+	var record interface{} = json.RawMessage(text)
+	if stripUnions {
+		dec := json.NewDecoder(bytes.NewReader(text))
+		dec.UseNumber()
+		var plain interface{}
+		if err := dec.Decode(&plain); err != nil {
+			requestLogger(c).Error("Failed to parse sample", zap.Error(err))
+			respondError(c, http.StatusInternalServerError, codeInternal, "Failed to parse sample")
+			return
+		}
+		if record, err = codec.StripUnions(plain); err != nil {
+			requestLogger(c).Error("Failed to strip union wrappers", zap.Error(err))
+			respondError(c, http.StatusInternalServerError, codeInternal, "Failed to strip union wrappers")
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"schema":       s.Name,
+		"version":      s.Version,
+		"seed":         seed,
+		"avro_bytes":   len(binary),
+		"strip_unions": stripUnions,
+		"record":       record,
+	})
+}
+
+// parseSchemaVersion reads the :version parameter, accepting "latest".
+func parseSchemaVersion(c *gin.Context) (int, bool) {
+	v := c.Param("version")
+	if v == "latest" {
+		return 0, true
+	}
+	version, err := strconv.Atoi(v)
+	if err != nil || version < 1 {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "version must be a positive integer or latest")
+		return 0, false
+	}
+	return version, true
+}
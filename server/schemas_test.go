@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+	"go.uber.org/zap"
+)
+
+func newSchemaTestEngine(t *testing.T) *gin.Engine {
+	t.Helper()
+	logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	if err := openSchemaRegistry(t.TempDir()); err != nil {
+		t.Fatalf("Failed to open schema registry: %v", err)
+	}
+	r := gin.New()
+	registerSchemaRoutes(r)
+	r.POST("/decode", decodeHandler)
+	return r
+}
+
+func doJSON(r *gin.Engine, method, target string, body interface{}) *httptest.ResponseRecorder {
+	var reader *bytes.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req := httptest.NewRequest(method, target, reader)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestSchemaRegistryEndpoints(t *testing.T) {
+	r := newSchemaTestEngine(t)
+
+	if w := doJSON(r, http.MethodGet, "/schemas/LogData/versions/latest", nil); w.Code != http.StatusOK {
+		t.Fatalf("expected built-in LogData to be registered, got %d: %s", w.Code, w.Body.String())
+	}
+
+	v1 := json.RawMessage(`{"type":"record","name":"Score","fields":[{"name":"points","type":"int"}]}`)
+	w := doJSON(r, http.MethodPost, "/schemas", gin.H{"schema": v1})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	// The same schema as a string is deduplicated.
+	if w := doJSON(r, http.MethodPost, "/schemas", gin.H{"schema": string(v1)}); w.Code != http.StatusOK {
+		t.Errorf("expected 200 for an existing schema, got %d", w.Code)
+	}
+	v2 := `{"type":"record","name":"Score","fields":[{"name":"points","type":"int"},{"name":"combo","type":"int","default":0}]}`
+	if w := doJSON(r, http.MethodPost, "/schemas", gin.H{"schema": v2}); w.Code != http.StatusCreated {
+		t.Errorf("expected 201 for a new version, got %d", w.Code)
+	}
+
+	w = doJSON(r, http.MethodGet, "/schemas/Score", nil)
+	var sub struct {
+		LatestVersion int   `json:"latest_version"`
+		Versions      []int `json:"versions"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &sub)
+	if sub.LatestVersion != 2 || len(sub.Versions) != 2 {
+		t.Errorf("unexpected subject: %s", w.Body.String())
+	}
+
+	// /decode resolves registered schemas and versions.
+	codec, _ := avrojson.NewCodec(string(v1))
+	binary, _ := codec.Encode(map[string]interface{}{"points": 7})
+	w = doJSON(r, http.MethodPost, "/decode", gin.H{"schema": "Score", "version": 1, "data": base64.StdEncoding.EncodeToString(binary)})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected decode with v1 to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if w := doJSON(r, http.MethodDelete, "/schemas/Score/versions/2", nil); w.Code != http.StatusOK {
+		t.Errorf("expected delete to succeed, got %d", w.Code)
+	}
+	if w := doJSON(r, http.MethodGet, "/schemas/Score/versions/2", nil); w.Code != http.StatusNotFound {
+		t.Errorf("expected deleted version to be gone, got %d", w.Code)
+	}
+	if w := doJSON(r, http.MethodDelete, "/schemas/LogData", nil); w.Code != http.StatusConflict {
+		t.Errorf("expected built-in schema deletion to be refused, got %d", w.Code)
+	}
+	if w := doJSON(r, http.MethodPost, "/schemas", gin.H{"schema": `{"type":"record"}`}); w.Code != http.StatusBadRequest {
+		t.Errorf("expected invalid schema to be rejected, got %d", w.Code)
+	}
+	if w := doJSON(r, http.MethodGet, "/schemas/Score/versions/zero", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("expected invalid version to be rejected, got %d", w.Code)
+	}
+}
+
+func TestSchemaSampleEndpoint(t *testing.T) {
+	r := newSchemaTestEngine(t)
+
+	w := doJSON(r, http.MethodGet, "/schemas/LogData/sample?seed=7", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Seed   int64           `json:"seed"`
+		Record json.RawMessage `json:"record"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if resp.Seed != 7 {
+		t.Errorf("expected seed 7, got %d", resp.Seed)
+	}
+	// The Avro JSON record converts back to binary as is.
+	codec, _ := avrojson.NewCodec(avrojson.LogDataSchema)
+	if _, err := codec.JSONToBinary(resp.Record); err != nil {
+		t.Errorf("sample is not valid Avro JSON: %v: %s", err, resp.Record)
+	}
+	var first, second interface{}
+	json.Unmarshal(w.Body.Bytes(), &first)
+	json.Unmarshal(doJSON(r, http.MethodGet, "/schemas/LogData/sample?seed=7", nil).Body.Bytes(), &second)
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("expected the same seed to give the same sample")
+	}
+
+	// Without a seed one is picked and reported.
+	w = doJSON(r, http.MethodGet, "/schemas/LogData/sample?strip_unions=true", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Seed == 0 {
+		t.Errorf("expected the generated seed to be returned: %s", w.Body.String())
+	}
+
+	if w := doJSON(r, http.MethodGet, "/schemas/Missing/sample", nil); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown schema, got %d", w.Code)
+	}
+	if w := doJSON(r, http.MethodGet, "/schemas/LogData/sample?seed=abc", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid seed, got %d", w.Code)
+	}
+}
+
+func TestSchemaCompat(t *testing.T) {
+	r := newSchemaTestEngine(t)
+	type compatResponse struct {
+		Mode       string `json:"mode"`
+		Compatible bool   `json:"compatible"`
+		Versions   []struct {
+			Version           int                        `json:"version"`
+			Compatible        bool                       `json:"compatible"`
+			Incompatibilities []avrojson.Incompatibility `json:"incompatibilities"`
+		} `json:"versions"`
+	}
+	check := func(body gin.H) compatResponse {
+		t.Helper()
+		w := doJSON(r, http.MethodPost, "/schemas/LogData/compat", body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var resp compatResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+		return resp
+	}
+
+	// A defaulted field keeps both directions.
+	if resp := check(gin.H{"schema": logDataV2(t), "mode": "full"}); !resp.Compatible || resp.Mode != "FULL" || len(resp.Versions) != 1 {
+		t.Errorf("expected LogData v2 to be fully compatible: %+v", resp)
+	}
+
+	// A required field breaks reading old data, but not the old schema
+	// reading new data.
+	var schema map[string]interface{}
+	json.Unmarshal([]byte(avrojson.LogDataSchema), &schema)
+	schema["fields"] = append(schema["fields"].([]interface{}), map[string]interface{}{"name": "region", "type": "string"})
+	required, _ := json.Marshal(schema)
+	resp := check(gin.H{"schema": string(required)})
+	if resp.Compatible || resp.Mode != "BACKWARD" || len(resp.Versions) != 1 {
+		t.Fatalf("expected a backward incompatibility: %+v", resp)
+	}
+	if issues := resp.Versions[0].Incompatibilities; len(issues) != 1 || issues[0].Path != "region" || issues[0].Direction != avrojson.DirectionBackward {
+		t.Errorf("expected the missing default of region to be reported: %+v", issues)
+	}
+	if resp := check(gin.H{"schema": json.RawMessage(required), "mode": "FORWARD", "version": 1}); !resp.Compatible {
+		t.Errorf("expected the required field to be forward compatible: %+v", resp)
+	}
+
+	if w := doJSON(r, http.MethodPost, "/schemas/Missing/compat", gin.H{"schema": logDataV2(t)}); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown subject, got %d", w.Code)
+	}
+	if w := doJSON(r, http.MethodPost, "/schemas/LogData/compat", gin.H{"schema": logDataV2(t), "version": 9}); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown version, got %d", w.Code)
+	}
+	if w := doJSON(r, http.MethodPost, "/schemas/LogData/compat", gin.H{"schema": logDataV2(t), "mode": "sideways"}); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown mode, got %d", w.Code)
+	}
+	if w := doJSON(r, http.MethodPost, "/schemas/LogData/compat", gin.H{"schema": `{"type":"nope"}`}); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid schema, got %d", w.Code)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/homveloper/exp-avro-json/server/expr"
+	"go.uber.org/zap"
+)
+
+// Scripts are for transforms and routing that do not deserve a compiled
+// plugin: expressions of package expr in the config files, evaluated per
+// record within an operation budget and a time limit.
+//
+// A plugin of type script sets fields of JSON /log requests and drops
+// them, its expressions seeing the request as sent (projectName, logLevel,
+// body.domainData.score, ...):
+//
+//	{"type": "script",
+//	 "set": {"body.domainData.score_pct": "body.domainData.score * 100",
+//	         "logSource": "lower(logSource)"},
+//	 "drop": "logLevel == 'DEBUG' && projectName != 'staging'",
+//	 "max_ops": 1000, "timeout": "2ms"}
+//
+// Every set expression sees the request before any of them is applied; a
+// null result removes the field. A sink entry of -sink-config with a when
+// predicate only receives the logs it holds for, evaluated over id,
+// projectName, projectVersion, logLevel, logType, logSource and received
+// (Unix milliseconds):
+//
+//	{"type": "kafka", "topic": "errors", "when": "logLevel in ['ERROR', 'FATAL']", ...}
+//
+// An expression that fails or runs out of its limits rejects the request
+// (400 plugin_rejected) or skips the sink, counted as its failure.
+
+func init() {
+	registerPluginType("script", newScriptPlugin)
+}
+
+type scriptConfig struct {
+	Set     map[string]string `json:"set"`
+	Drop    string            `json:"drop"`
+	MaxOps  int               `json:"max_ops"`
+	Timeout string            `json:"timeout"`
+}
+
+type scriptAssignment struct {
+	path []string
+	prog *expr.Program
+}
+
+type scriptPlugin struct {
+	set    []scriptAssignment
+	drop   *expr.Program
+	limits expr.Limits
+}
+
+func newScriptPlugin(raw json.RawMessage) (interface{}, error) {
+	var config scriptConfig
+	if err := decodeSinkConfig(raw, &config); err != nil {
+		return nil, err
+	}
+	if len(config.Set) == 0 && config.Drop == "" {
+		return nil, fmt.Errorf("script needs set or drop")
+	}
+	p := &scriptPlugin{limits: expr.Limits{MaxOps: config.MaxOps}}
+	if config.Timeout != "" {
+		d, err := time.ParseDuration(config.Timeout)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("timeout must be a positive duration such as 2ms")
+		}
+		p.limits.Timeout = d
+	}
+	paths := make([]string, 0, len(config.Set))
+	for path := range config.Set {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		segments := strings.Split(path, ".")
+		for _, s := range segments {
+			if s == "" {
+				return nil, fmt.Errorf("set: invalid field path %q", path)
+			}
+		}
+		prog, err := expr.Compile(config.Set[path])
+		if err != nil {
+			return nil, fmt.Errorf("set %s: %w", path, err)
+		}
+		p.set = append(p.set, scriptAssignment{path: segments, prog: prog})
+	}
+	if config.Drop != "" {
+		prog, err := expr.Compile(config.Drop)
+		if err != nil {
+			return nil, fmt.Errorf("drop: %w", err)
+		}
+		p.drop = prog
+	}
+	return p, nil
+}
+
+// scriptEnv returns v as the JSON object expressions see.
+func scriptEnv(v interface{}) (map[string]interface{}, error) {
+	text, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var env map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(text))
+	dec.UseNumber()
+	if err := dec.Decode(&env); err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+func (p *scriptPlugin) Transform(ctx context.Context, req *LogRequest) error {
+	if len(p.set) == 0 {
+		return nil
+	}
+	env, err := scriptEnv(req)
+	if err != nil {
+		return err
+	}
+	values := make([]interface{}, len(p.set))
+	for i, a := range p.set {
+		if values[i], err = a.prog.Eval(env, p.limits); err != nil {
+			return fmt.Errorf("set %s: %w", strings.Join(a.path, "."), err)
+		}
+	}
+	for i, a := range p.set {
+		setPath(env, a.path, values[i])
+	}
+	text, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+	var out LogRequest
+	dec := json.NewDecoder(bytes.NewReader(text))
+	dec.UseNumber()
+	if err := dec.Decode(&out); err != nil {
+		return fmt.Errorf("set: %w", err)
+	}
+	*req = out
+	return nil
+}
+
+// setPath sets the field at path of m to v, creating the objects on the
+// way, or removes it when v is nil.
+func setPath(m map[string]interface{}, path []string, v interface{}) {
+	for _, key := range path[:len(path)-1] {
+		next, ok := m[key].(map[string]interface{})
+		if !ok {
+			if v == nil {
+				return
+			}
+			next = make(map[string]interface{})
+			m[key] = next
+		}
+		m = next
+	}
+	if v == nil {
+		delete(m, path[len(path)-1])
+		return
+	}
+	m[path[len(path)-1]] = v
+}
+
+func (p *scriptPlugin) Keep(ctx context.Context, req LogRequest) (bool, error) {
+	if p.drop == nil {
+		return true, nil
+	}
+	env, err := scriptEnv(req)
+	if err != nil {
+		return false, err
+	}
+	drop, err := p.drop.EvalBool(env, p.limits)
+	if err != nil {
+		return false, fmt.Errorf("drop: %w", err)
+	}
+	return !drop, nil
+}
+
+// sinkRecordEnv returns the names sink predicates see for record.
+func sinkRecordEnv(record sinkRecord) map[string]interface{} {
+	env := map[string]interface{}{}
+	if record.Encoded != nil {
+		json.Unmarshal(record.Encoded.WrapperJSON, &env)
+		delete(env, "body")
+	}
+	env["id"] = record.ID
+	env["received"] = record.Received.UnixMilli()
+	return env
+}
+
+// routes reports whether record goes to s, counting a failed predicate
+// as the sink's failure.
+func (s *configuredSink) routes(env func() map[string]interface{}, record sinkRecord) bool {
+	if s.when == nil {
+		return true
+	}
+	ok, err := s.when.EvalBool(env(), expr.Limits{})
+	if err != nil {
+		s.failed.Add(1)
+		s.mu.Lock()
+		s.lastError = err.Error()
+		s.mu.Unlock()
+		logger.Error("Failed to evaluate sink predicate", zap.String("sink", s.name), zap.String("id", record.ID), zap.Error(err))
+		return false
+	}
+	if !ok {
+		s.skipped.Add(1)
+	}
+	return ok
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+	"go.uber.org/zap"
+)
+
+func TestScriptPlugin(t *testing.T) {
+	r := newSchemaTestEngine(t)
+	r.POST("/log", logHandler)
+	defer func() { plugins, sinks = nil, nil }()
+
+	for name, config := range map[string]string{
+		"empty":       `{}`,
+		"bad set":     `{"set": {"logSource": "upper("}}`,
+		"bad path":    `{"set": {"body..x": "1"}}`,
+		"bad drop":    `{"drop": "logLevel =="}`,
+		"bad timeout": `{"drop": "true", "timeout": "soon"}`,
+	} {
+		if _, err := newScriptPlugin(json.RawMessage(config)); err == nil {
+			t.Errorf("%s: expected the script to be rejected", name)
+		}
+	}
+	if err := addPlugin("script", "script", json.RawMessage(`{
+		"set": {"body.domainData.score_pct": "body.domainData.score * 100",
+		        "logSource": "upper(logSource)",
+		        "body.domainData.secret": "null"},
+		"drop": "logLevel == 'DEBUG'"}`)); err != nil {
+		t.Fatalf("Failed to add script plugin: %v", err)
+	}
+	var stored bytes.Buffer
+	sinks = append(sinks, &configuredSink{name: "out", typ: "stdout", sink: &stdoutSink{w: &stored}})
+
+	req := warmupPayload(1)
+	req.LogSource = "client"
+	req.LogBody.DomainData = map[string]interface{}{"score": 0.25, "secret": "s3cret"}
+	if w := doJSON(r, http.MethodPost, "/log", req); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	for _, part := range []string{`"logSource":"CLIENT"`, `\"score_pct\":\"25\"`} {
+		if !strings.Contains(stored.String(), part) {
+			t.Errorf("expected %s in %s", part, stored.String())
+		}
+	}
+	if strings.Contains(stored.String(), "s3cret") {
+		t.Errorf("expected the secret to be removed, got %s", stored.String())
+	}
+
+	// Values the script does not set keep their JSON numbers.
+	exact := warmupPayload(1)
+	exact.LogBody.DomainData = map[string]interface{}{"score": json.Number("1"), "id": json.Number("12345678901234567")}
+	if err := plugins[0].plugin.(logTransformer).Transform(context.Background(), &exact); err != nil {
+		t.Fatalf("Failed to transform: %v", err)
+	}
+	if id := exact.LogBody.DomainData.(map[string]interface{})["id"]; id != json.Number("12345678901234567") {
+		t.Errorf("expected the id to keep its digits, got %#v", id)
+	}
+
+	req.LogLevel = "DEBUG"
+	if w := doJSON(r, http.MethodPost, "/log", req); !strings.Contains(w.Body.String(), `"status":"filtered"`) {
+		t.Errorf("expected the DEBUG log to be dropped, got %d: %s", w.Code, w.Body.String())
+	}
+	req.LogLevel = "INFO"
+	req.LogBody.DomainData = map[string]interface{}{"score": "high"}
+	if w := doJSON(r, http.MethodPost, "/log", req); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "body.domainData.score_pct") {
+		t.Errorf("expected a failing expression to reject the log, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestSinkWhenRoutes(t *testing.T) {
+	logger = zap.NewNop()
+	defer func() { sinks = nil }()
+	path := filepath.Join(t.TempDir(), "sinks.json")
+	os.WriteFile(path, []byte(`{"sinks": [{"name": "bad", "type": "stdout", "when": "logLevel =="}]}`), 0o644)
+	if err := loadSinkConfig(path); err == nil {
+		t.Error("expected an invalid when to be rejected")
+	}
+	sinks = nil
+	os.WriteFile(path, []byte(`{"sinks": [
+		{"name": "errors", "type": "stdout", "when": "logLevel in ['ERROR', 'FATAL'] && projectName == 'raid'"},
+		{"name": "broken", "type": "stdout", "when": "logLevel"},
+		{"name": "all", "type": "stdout"}
+	]}`), 0o644)
+	if err := loadSinkConfig(path); err != nil {
+		t.Fatalf("Failed to load sink config: %v", err)
+	}
+	outputs := make([]*bytes.Buffer, len(sinks))
+	for i, s := range sinks {
+		outputs[i] = &bytes.Buffer{}
+		s.sink = &stdoutSink{w: outputs[i]}
+	}
+
+	for _, level := range []string{"INFO", "ERROR"} {
+		encoded, err := avrojson.EncodeLog(avrojson.LogWrapper{ProjectName: "raid", LogLevel: level, LogType: "t"},
+			avrojson.LogData{Logtype: "t", Version: "1", Issuer: "i"})
+		if err != nil {
+			t.Fatalf("Failed to encode log: %v", err)
+		}
+		writeSinks(context.Background(), sinkRecord{ID: level, Project: "raid", Encoded: encoded})
+	}
+	if got := strings.Count(outputs[0].String(), "\n"); got != 1 || !strings.Contains(outputs[0].String(), `"id":"ERROR"`) {
+		t.Errorf("expected only the ERROR log routed to errors, got %s", outputs[0].String())
+	}
+	if outputs[1].Len() != 0 || sinks[1].failed.Load() != 2 {
+		t.Errorf("expected a non-boolean predicate to fail the sink, got %d failures", sinks[1].failed.Load())
+	}
+	if got := strings.Count(outputs[2].String(), "\n"); got != 2 {
+		t.Errorf("expected both logs in the unrouted sink, got %d", got)
+	}
+	if stats := sinkStats()[0]; stats["skipped"] != int64(1) || stats["when"] == nil {
+		t.Errorf("unexpected routed sink stats %v", stats)
+	}
+}
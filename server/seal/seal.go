@@ -0,0 +1,287 @@
+// Package seal encrypts stored logs with AES-256-GCM, so each project's
+// files are readable only with its key. Whole payloads are sealed with
+// Seal; append-only files, such as Object Container Files, are written as
+// a stream of sealed frames by Writer and read back by Reader. Encryption
+// and hashing use separate subkeys derived from the project key with HKDF.
+package seal
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// KeySize is the length of a key in bytes.
+const KeySize = 32
+
+// streamMagic starts every sealed stream, telling it apart from a plain
+// file. It is followed by the stream's random ID.
+var streamMagic = []byte("AJSEAL1\n")
+
+// HeaderSize is how many leading bytes IsSealed needs.
+const HeaderSize = 8
+
+// streamIDSize is the length of the ID after streamMagic.
+const streamIDSize = 16
+
+// maxFrame bounds the allocation a corrupt frame length can cause.
+const maxFrame = 1 << 30
+
+// finalFrame is set in the length of the empty frame Writer.Close ends a
+// stream with.
+const finalFrame = 1 << 31
+
+// ErrDecrypt is returned for data that was not sealed with the key, or
+// was modified since.
+var ErrDecrypt = errors.New("seal: message authentication failed")
+
+// ErrUnfinished is returned by a Reader for a stream that ends without the
+// frame Writer.Close writes, which means it was cut short or is still
+// being written.
+var ErrUnfinished = fmt.Errorf("seal: stream ends before its final frame: %w", io.ErrUnexpectedEOF)
+
+// Key seals and opens data with AES-256-GCM and names it with
+// HMAC-SHA256, each under its own subkey derived from one key.
+type Key struct {
+	mac  []byte
+	aead cipher.AEAD
+}
+
+// NewKey returns a key for raw, which must be KeySize bytes.
+func NewKey(raw []byte) (*Key, error) {
+	if len(raw) != KeySize {
+		return nil, fmt.Errorf("seal: key is %d bytes, want %d", len(raw), KeySize)
+	}
+	encKey, err := hkdf.Key(sha256.New, raw, nil, "seal aes-256-gcm", KeySize)
+	if err != nil {
+		return nil, err
+	}
+	macKey, err := hkdf.Key(sha256.New, raw, nil, "seal hmac-sha256", KeySize)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Key{mac: macKey, aead: aead}, nil
+}
+
+// Seal encrypts data under a random nonce, returning the nonce followed
+// by the ciphertext.
+func (k *Key) Seal(data []byte) []byte {
+	return k.seal(data, nil)
+}
+
+// Open decrypts what Seal returned.
+func (k *Key) Open(sealed []byte) ([]byte, error) {
+	return k.open(sealed, nil)
+}
+
+// Hash returns an HMAC-SHA256 of data under the key, for naming sealed
+// data without revealing the plain data's digest.
+func (k *Key) Hash(data []byte) []byte {
+	mac := hmac.New(sha256.New, k.mac)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func (k *Key) seal(data, ad []byte) []byte {
+	out := make([]byte, k.aead.NonceSize(), k.aead.NonceSize()+len(data)+k.aead.Overhead())
+	// crypto/rand.Read never fails since Go 1.24.
+	rand.Read(out)
+	return k.aead.Seal(out, out, data, ad)
+}
+
+func (k *Key) open(sealed, ad []byte) ([]byte, error) {
+	if len(sealed) < k.aead.NonceSize()+k.aead.Overhead() {
+		return nil, ErrDecrypt
+	}
+	nonce, ciphertext := sealed[:k.aead.NonceSize()], sealed[k.aead.NonceSize():]
+	data, err := k.aead.Open(nil, nonce, ciphertext, ad)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return data, nil
+}
+
+// frameAD binds a frame to its stream, its position and whether it is the
+// last, so frames cannot be dropped, reordered, moved between streams or
+// follow the end without Reader noticing.
+func frameAD(stream []byte, index uint64, final bool) []byte {
+	ad := make([]byte, 0, len(stream)+9)
+	ad = append(ad, stream...)
+	ad = binary.BigEndian.AppendUint64(ad, index)
+	if final {
+		return append(ad, 1)
+	}
+	return append(ad, 0)
+}
+
+// Writer seals every Write as one frame of the stream. Readers see the
+// data of every complete frame, so each Write should be a unit that is
+// useful on its own, such as an OCF block. Close ends the stream with a
+// final frame, which tells a complete stream from a cut one.
+type Writer struct {
+	w      io.Writer
+	key    *Key
+	stream []byte
+	index  uint64
+	header bool
+	closed bool
+}
+
+// NewWriter returns a Writer sealing a new stream onto w.
+func (k *Key) NewWriter(w io.Writer) *Writer {
+	stream := make([]byte, streamIDSize)
+	rand.Read(stream)
+	return &Writer{w: w, key: k, stream: stream}
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("seal: write after Close")
+	}
+	if err := w.frame(p, false); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close writes the final frame. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.frame(nil, true)
+}
+
+func (w *Writer) frame(p []byte, final bool) error {
+	sealed := w.key.seal(p, frameAD(w.stream, w.index, final))
+	frame := make([]byte, 0, len(streamMagic)+streamIDSize+4+len(sealed))
+	if !w.header {
+		frame = append(frame, streamMagic...)
+		frame = append(frame, w.stream...)
+	}
+	size := uint32(len(sealed))
+	if final {
+		size |= finalFrame
+	}
+	frame = binary.BigEndian.AppendUint32(frame, size)
+	frame = append(frame, sealed...)
+	// One write per frame keeps a crash from leaving more than the last
+	// frame incomplete.
+	if _, err := w.w.Write(frame); err != nil {
+		return err
+	}
+	w.header = true
+	w.index++
+	return nil
+}
+
+// Reader opens a stream written by Writer.
+type Reader struct {
+	r      io.Reader
+	key    *Key
+	live   bool
+	stream []byte
+	index  uint64
+	buf    []byte
+	err    error
+}
+
+// NewReader returns a Reader of the sealed stream r. The stream's header
+// is checked on the first Read, and a stream that ends before its final
+// frame fails with ErrUnfinished after the data of its complete frames.
+func (k *Key) NewReader(r io.Reader) *Reader {
+	return &Reader{r: r, key: k}
+}
+
+// NewLiveReader is NewReader for a stream that may still be written to:
+// one that ends after a complete frame but before the final one reads as
+// if it ended there.
+func (k *Key) NewLiveReader(r io.Reader) *Reader {
+	return &Reader{r: r, key: k, live: true}
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.buf, r.err = r.next()
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// next reads and opens the next frame. A stream cut inside a frame ends
+// with io.ErrUnexpectedEOF after the complete frames.
+func (r *Reader) next() ([]byte, error) {
+	if r.stream == nil {
+		header := make([]byte, len(streamMagic)+streamIDSize)
+		if _, err := io.ReadFull(r.r, header); err != nil {
+			return nil, fmt.Errorf("seal: cannot read header: %w", err)
+		}
+		if !bytes.Equal(header[:len(streamMagic)], streamMagic) {
+			return nil, errors.New("seal: not a sealed stream")
+		}
+		r.stream = header[len(streamMagic):]
+	}
+	var size [4]byte
+	if _, err := io.ReadFull(r.r, size[:]); err != nil {
+		if err == io.EOF && !r.live {
+			err = ErrUnfinished
+		}
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	final := n&finalFrame != 0
+	n &^= finalFrame
+	if n > maxFrame {
+		return nil, fmt.Errorf("seal: invalid frame of %d bytes", n)
+	}
+	sealed := make([]byte, n)
+	if _, err := io.ReadFull(r.r, sealed); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	data, err := r.key.open(sealed, frameAD(r.stream, r.index, final))
+	if err != nil {
+		return nil, err
+	}
+	r.index++
+	if final {
+		switch _, err := io.ReadFull(r.r, size[:1]); err {
+		case io.EOF:
+			return data, io.EOF
+		case nil:
+			return nil, errors.New("seal: data after the final frame")
+		default:
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// IsSealed reports whether header, the first HeaderSize bytes of a file,
+// begin a sealed stream.
+func IsSealed(header []byte) bool {
+	return bytes.HasPrefix(header, streamMagic)
+}
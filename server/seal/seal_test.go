@@ -0,0 +1,156 @@
+package seal
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"testing"
+)
+
+func testKey(t *testing.T, b byte) *Key {
+	key, err := NewKey(bytes.Repeat([]byte{b}, KeySize))
+	if err != nil {
+		t.Fatalf("Failed to create key: %v", err)
+	}
+	return key
+}
+
+func TestSealOpen(t *testing.T) {
+	key := testKey(t, 1)
+	sealed := key.Seal([]byte("secret log"))
+	if bytes.Contains(sealed, []byte("secret")) {
+		t.Error("sealed data contains the plain text")
+	}
+	if data, err := key.Open(sealed); err != nil || string(data) != "secret log" {
+		t.Errorf("Open gave %q: %v", data, err)
+	}
+	if _, err := testKey(t, 2).Open(sealed); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("expected another key to fail, got %v", err)
+	}
+	sealed[len(sealed)-1] ^= 1
+	if _, err := key.Open(sealed); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("expected modified data to fail, got %v", err)
+	}
+	if _, err := NewKey([]byte("short")); err == nil {
+		t.Error("expected a short key to be rejected")
+	}
+	if bytes.Equal(key.Hash([]byte("a")), testKey(t, 2).Hash([]byte("a"))) {
+		t.Error("expected hashes to depend on the key")
+	}
+}
+
+func TestStream(t *testing.T) {
+	key := testKey(t, 1)
+	var buf bytes.Buffer
+	w := key.NewWriter(&buf)
+	for _, frame := range []string{"header", "block one", "block two"} {
+		if _, err := w.Write([]byte(frame)); err != nil {
+			t.Fatalf("Failed to write frame: %v", err)
+		}
+	}
+	open := buf.Len()
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to close stream: %v", err)
+	}
+	if !IsSealed(buf.Bytes()[:HeaderSize]) || bytes.Contains(buf.Bytes(), []byte("block")) {
+		t.Fatal("expected a sealed stream without plain text")
+	}
+	data, err := io.ReadAll(key.NewReader(bytes.NewReader(buf.Bytes())))
+	if err != nil || string(data) != "headerblock oneblock two" {
+		t.Fatalf("read %q: %v", data, err)
+	}
+
+	// A stream without its final frame reads up to where it ends, which
+	// only a live reader takes as the end.
+	data, err = io.ReadAll(key.NewReader(bytes.NewReader(buf.Bytes()[:open])))
+	if !errors.Is(err, ErrUnfinished) || string(data) != "headerblock oneblock two" {
+		t.Errorf("unfinished stream read %q: %v", data, err)
+	}
+	data, err = io.ReadAll(key.NewLiveReader(bytes.NewReader(buf.Bytes()[:open])))
+	if err != nil || string(data) != "headerblock oneblock two" {
+		t.Errorf("live stream read %q: %v", data, err)
+	}
+
+	// A stream cut inside a frame reads up to it.
+	data, err = io.ReadAll(key.NewLiveReader(bytes.NewReader(buf.Bytes()[:open-3])))
+	if !errors.Is(err, io.ErrUnexpectedEOF) || string(data) != "headerblock one" {
+		t.Errorf("truncated stream read %q: %v", data, err)
+	}
+
+	if _, err := w.Write([]byte("late")); err == nil {
+		t.Error("expected a write after Close to fail")
+	}
+	if _, err := io.ReadAll(testKey(t, 2).NewReader(bytes.NewReader(buf.Bytes()))); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("expected another key to fail, got %v", err)
+	}
+	if _, err := io.ReadAll(key.NewReader(bytes.NewReader([]byte("Obj\x01plain file with a header")))); err == nil {
+		t.Error("expected a plain file to be rejected")
+	}
+}
+
+// headerLen is the size of a stream's magic and ID.
+const headerLen = HeaderSize + streamIDSize
+
+func TestStreamRejectsReorderedFrames(t *testing.T) {
+	key := testKey(t, 1)
+	var first, second bytes.Buffer
+	w := key.NewWriter(&first)
+	w.Write([]byte("a"))
+	w.Write([]byte("b"))
+	// Swap the two frames, which are the same size, after the header.
+	frames := first.Bytes()[headerLen:]
+	size := len(frames) / 2
+	second.Write(first.Bytes()[:headerLen])
+	second.Write(frames[size:])
+	second.Write(frames[:size])
+	if _, err := io.ReadAll(key.NewLiveReader(&second)); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("expected reordered frames to fail, got %v", err)
+	}
+}
+
+func TestStreamRejectsSplicedFrames(t *testing.T) {
+	key := testKey(t, 1)
+	// stream returns a closed stream of two frames and the offsets where
+	// its second and final frames start.
+	stream := func(frames ...string) ([]byte, int, int) {
+		var buf bytes.Buffer
+		w := key.NewWriter(&buf)
+		w.Write([]byte(frames[0]))
+		second := buf.Len()
+		w.Write([]byte(frames[1]))
+		final := buf.Len()
+		w.Close()
+		return buf.Bytes(), second, final
+	}
+	cat := func(parts ...[]byte) []byte { return bytes.Join(parts, nil) }
+	a, second, final := stream("a1", "a2")
+	b, _, _ := stream("b1", "b2")
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"frame of another stream", cat(a[:second], b[second:final], a[final:])},
+		{"final frame moved up", cat(a[:second], a[final:])},
+		{"frames after the final one", cat(a, b[headerLen:])},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := io.ReadAll(key.NewReader(bytes.NewReader(tt.data))); err == nil {
+				t.Error("expected the spliced stream to fail")
+			}
+		})
+	}
+}
+
+func TestSubkeys(t *testing.T) {
+	raw := bytes.Repeat([]byte{1}, KeySize)
+	key := testKey(t, 1)
+	mac := hmac.New(sha256.New, raw)
+	mac.Write([]byte("a"))
+	if bytes.Equal(key.Hash([]byte("a")), mac.Sum(nil)) {
+		t.Error("expected Hash to use a derived key, not the raw one")
+	}
+}
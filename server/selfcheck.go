@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+	"go.uber.org/zap"
+)
+
+// The startup self-check compiles every registered schema, round-trips a
+// zero value through each codec and probes every directory the server
+// writes to, so broken configuration stops the boot instead of failing the
+// first real request.
+
+// checkResult is one line of the self-check report.
+type checkResult struct {
+	Name     string        `json:"name"`
+	Kind     string        `json:"kind"`
+	OK       bool          `json:"ok"`
+	Duration time.Duration `json:"duration_ns"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// sinkProbe names a directory the server writes to.
+type sinkProbe struct {
+	name string
+	dir  string
+}
+
+var (
+	selfCheckMu     sync.RWMutex
+	selfCheckReport []checkResult
+)
+
+// configuredSinks lists the directories the current flags and the
+// configured log sinks write to.
+func configuredSinks(schemaDir, leaseFile, artifactDir string) []sinkProbe {
+	sinks := []sinkProbe{{name: "logs", dir: "logs"}}
+	if artifactDir != "" {
+		sinks = append(sinks, sinkProbe{name: "artifacts", dir: artifactDir})
+	}
+	sinks = append(sinks, sinkDirs()...)
+	if schemaDir != "" {
+		sinks = append(sinks, sinkProbe{name: "schema-registry", dir: schemaDir})
+	}
+	if leaseFile != "" {
+		sinks = append(sinks, sinkProbe{name: "lease", dir: filepath.Dir(leaseFile)})
+	}
+	return sinks
+}
+
+// runSelfCheck checks every live schema version in the registry and every
+// sink. The report is kept for /stats; the error lists each failure.
+func runSelfCheck(sinks []sinkProbe) ([]checkResult, error) {
+	var results []checkResult
+	for _, sub := range schemaRegistry.Subjects() {
+		for _, version := range sub.Versions {
+			name := fmt.Sprintf("%s/v%d", sub.Name, version)
+			results = append(results, timedCheck(name, "schema", func() error {
+				s, err := schemaRegistry.Get(sub.Name, version)
+				if err != nil {
+					return err
+				}
+				codec, err := avrojson.DefaultCache.Get(s.Schema)
+				if err != nil {
+					return fmt.Errorf("compile: %w", err)
+				}
+				return codec.SelfCheck()
+			}))
+		}
+	}
+	for _, sink := range sinks {
+		results = append(results, timedCheck(sink.name, "sink", func() error {
+			return probeDir(sink.dir)
+		}))
+	}
+
+	selfCheckMu.Lock()
+	selfCheckReport = results
+	selfCheckMu.Unlock()
+
+	var failures []string
+	for _, r := range results {
+		if !r.OK {
+			failures = append(failures, fmt.Sprintf("%s %s: %s", r.Kind, r.Name, r.Error))
+		}
+	}
+	if len(failures) > 0 {
+		return results, fmt.Errorf("%d of %d self-checks failed: %s", len(failures), len(results), strings.Join(failures, "; "))
+	}
+	return results, nil
+}
+
+func timedCheck(name, kind string, check func() error) checkResult {
+	start := time.Now()
+	err := check()
+	r := checkResult{Name: name, Kind: kind, OK: err == nil, Duration: time.Since(start)}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	return r
+}
+
+// probeDir creates dir if needed, then writes, reads back and removes a
+// marker file.
+func probeDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	marker := filepath.Join(dir, fmt.Sprintf(".selfcheck-%d", os.Getpid()))
+	want := []byte(time.Now().Format(time.RFC3339Nano))
+	if err := os.WriteFile(marker, want, 0644); err != nil {
+		return err
+	}
+	got, readErr := os.ReadFile(marker)
+	if err := os.Remove(marker); err != nil {
+		return err
+	}
+	if readErr != nil {
+		return readErr
+	}
+	if string(got) != string(want) {
+		return errors.New("marker file read back different contents")
+	}
+	return nil
+}
+
+// logSelfCheck writes the report to the log, one entry per check.
+func logSelfCheck(results []checkResult) {
+	for _, r := range results {
+		fields := []zap.Field{
+			zap.String("check", r.Name),
+			zap.String("kind", r.Kind),
+			zap.Duration("duration", r.Duration),
+		}
+		if r.OK {
+			logger.Info("Self-check passed", fields...)
+		} else {
+			logger.Error("Self-check failed", append(fields, zap.String("error", r.Error))...)
+		}
+	}
+}
+
+func selfCheckStatus() []checkResult {
+	selfCheckMu.RLock()
+	defer selfCheckMu.RUnlock()
+	return selfCheckReport
+}
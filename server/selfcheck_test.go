@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestRunSelfCheck(t *testing.T) {
+	logger = zap.NewNop()
+	if err := openSchemaRegistry(""); err != nil {
+		t.Fatalf("Failed to open schema registry: %v", err)
+	}
+	if _, _, err := schemaRegistry.Register("exp.Event", `{"type":"record","name":"Event","namespace":"exp","fields":[
+		{"name":"kind","type":{"type":"enum","name":"Kind","symbols":["CLICK","VIEW"]}},
+		{"name":"tags","type":["null",{"type":"array","items":"string"}]}
+	]}`); err != nil {
+		t.Fatalf("Failed to register schema: %v", err)
+	}
+
+	dir := t.TempDir()
+	results, err := runSelfCheck([]sinkProbe{{name: "data", dir: filepath.Join(dir, "data")}})
+	if err != nil {
+		t.Fatalf("Self-check failed: %v", err)
+	}
+
+	kinds := map[string]int{}
+	for _, r := range results {
+		kinds[r.Kind]++
+	}
+	if kinds["schema"] != 3 || kinds["sink"] != 1 {
+		t.Errorf("unexpected checks: %+v", results)
+	}
+	entries, _ := os.ReadDir(filepath.Join(dir, "data"))
+	if len(entries) != 0 {
+		t.Errorf("probe left %d files behind", len(entries))
+	}
+	if len(selfCheckStatus()) != len(results) {
+		t.Errorf("report not kept for /stats")
+	}
+}
+
+func TestRunSelfCheckReportsUnwritableSink(t *testing.T) {
+	logger = zap.NewNop()
+	if err := openSchemaRegistry(""); err != nil {
+		t.Fatalf("Failed to open schema registry: %v", err)
+	}
+
+	file := filepath.Join(t.TempDir(), "not-a-dir")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	results, err := runSelfCheck([]sinkProbe{{name: "broken", dir: file}})
+	if err == nil {
+		t.Fatal("expected self-check to fail")
+	}
+	if !strings.Contains(err.Error(), "sink broken") {
+		t.Errorf("error does not name the sink: %v", err)
+	}
+	failed := 0
+	for _, r := range results {
+		if !r.OK {
+			failed++
+		}
+	}
+	if failed != 1 {
+		t.Errorf("expected exactly one failure, got %+v", results)
+	}
+}
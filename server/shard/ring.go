@@ -0,0 +1,79 @@
+// Package shard assigns keys to nodes with consistent hashing. Each node is
+// placed on the ring at several virtual positions so keys spread evenly, and
+// changing the node set only moves the keys owned by the added or removed
+// node.
+package shard
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"sort"
+	"strconv"
+)
+
+// DefaultReplicas is the number of virtual positions per node used when New
+// is given a non-positive replica count.
+const DefaultReplicas = 128
+
+// Ring is an immutable consistent hash ring. It is safe for concurrent use.
+type Ring struct {
+	nodes  []string
+	hashes []uint64
+	owners map[uint64]string
+}
+
+// New builds a ring over nodes. Duplicate and empty node names are ignored.
+func New(replicas int, nodes ...string) *Ring {
+	if replicas <= 0 {
+		replicas = DefaultReplicas
+	}
+
+	r := &Ring{owners: make(map[uint64]string)}
+	seen := make(map[string]bool)
+	for _, node := range nodes {
+		if node == "" || seen[node] {
+			continue
+		}
+		seen[node] = true
+		r.nodes = append(r.nodes, node)
+
+		for i := 0; i < replicas; i++ {
+			h := hash(node + "#" + strconv.Itoa(i))
+			// Collisions are astronomically unlikely; give the position to
+			// the smaller name so the ring does not depend on node order.
+			if owner, taken := r.owners[h]; taken {
+				if node < owner {
+					r.owners[h] = node
+				}
+				continue
+			}
+			r.owners[h] = node
+			r.hashes = append(r.hashes, h)
+		}
+	}
+	sort.Slice(r.hashes, func(i, j int) bool { return r.hashes[i] < r.hashes[j] })
+	return r
+}
+
+// Get returns the node owning key, or "" when the ring is empty.
+func (r *Ring) Get(key string) string {
+	if len(r.hashes) == 0 {
+		return ""
+	}
+	h := hash(key)
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= h })
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.owners[r.hashes[i]]
+}
+
+// Nodes returns the ring members in the order they were given.
+func (r *Ring) Nodes() []string {
+	return append([]string(nil), r.nodes...)
+}
+
+func hash(s string) uint64 {
+	sum := sha256.Sum256([]byte(s))
+	return binary.BigEndian.Uint64(sum[:8])
+}
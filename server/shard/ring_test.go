@@ -0,0 +1,64 @@
+package shard
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRingIsDeterministic(t *testing.T) {
+	a := New(0, "node-0", "node-1", "node-2")
+	b := New(0, "node-2", "node-0", "node-1")
+
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("project-%d", i)
+		if a.Get(key) != b.Get(key) {
+			t.Fatalf("key %s maps to %s and %s depending on node order", key, a.Get(key), b.Get(key))
+		}
+	}
+}
+
+func TestRingDistribution(t *testing.T) {
+	r := New(0, "node-0", "node-1", "node-2")
+
+	counts := make(map[string]int)
+	const keys = 30000
+	for i := 0; i < keys; i++ {
+		counts[r.Get(fmt.Sprintf("project-%d", i))]++
+	}
+	for _, node := range r.Nodes() {
+		share := float64(counts[node]) / keys
+		if share < 0.25 || share > 0.42 {
+			t.Errorf("node %s owns %.1f%% of keys", node, share*100)
+		}
+	}
+}
+
+func TestRingMinimalMovement(t *testing.T) {
+	before := New(0, "node-0", "node-1", "node-2")
+	after := New(0, "node-0", "node-1", "node-2", "node-3")
+
+	moved := 0
+	const keys = 10000
+	for i := 0; i < keys; i++ {
+		key := fmt.Sprintf("project-%d", i)
+		from, to := before.Get(key), after.Get(key)
+		if from != to {
+			moved++
+			if to != "node-3" {
+				t.Fatalf("key %s moved from %s to %s instead of the new node", key, from, to)
+			}
+		}
+	}
+	if share := float64(moved) / keys; share > 0.35 {
+		t.Errorf("adding one node moved %.1f%% of keys", share*100)
+	}
+}
+
+func TestRingEmpty(t *testing.T) {
+	if node := New(0).Get("project"); node != "" {
+		t.Errorf("expected empty ring to return no node, got %q", node)
+	}
+	if nodes := New(0, "a", "", "a").Nodes(); len(nodes) != 1 {
+		t.Errorf("expected duplicates and empty names to be ignored, got %v", nodes)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// shutdownOn shuts srv down on the first signal from stop: it stops
+// accepting connections and lets in-flight requests run for up to timeout
+// before closing the connections left. The returned channel is closed once
+// that is done; ListenAndServe returns as soon as shutdown starts, so main
+// waits for it before flushing.
+func shutdownOn(srv *http.Server, stop <-chan os.Signal, timeout time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sig := <-stop
+		logger.Info("Shutting down", zap.String("signal", sig.String()), zap.Duration("timeout", timeout))
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			logger.Warn("In-flight requests did not finish before the shutdown timeout", zap.Error(err))
+			srv.Close()
+		}
+	}()
+	return done
+}
+
+// flushForExit writes what the server holds in memory once requests have
+// stopped: the sink queue is drained, the sinks are closed so their last
+// OCF blocks are written and their files end complete, those files go to
+// the standby, and the artifact stores' Bloom filters are saved.
+func flushForExit() {
+	if sinkLogQueue != nil {
+		logger.Info("Draining sink queue", zap.Int("depth", len(sinkLogQueue.records)))
+		sinkLogQueue.close()
+	}
+	closeSinks()
+	closePlugins()
+	replicateForExit()
+	for _, store := range openArtifactStores() {
+		if err := store.FlushFilters(); err != nil {
+			logger.Warn("Failed to flush artifact Bloom filters", zap.String("dir", store.Dir()), zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/homveloper/exp-avro-json/server/ocf"
+	"go.uber.org/zap"
+)
+
+func TestShutdownDrainsInFlightRequests(t *testing.T) {
+	logger = zap.NewNop()
+	started := make(chan struct{})
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("done"))
+	})}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	stop := make(chan os.Signal, 1)
+	stopped := shutdownOn(srv, stop, 5*time.Second)
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(ln) }()
+
+	body := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String())
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		body <- string(data)
+	}()
+	<-started
+	stop <- syscall.SIGTERM
+
+	if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+		t.Fatalf("expected the server to close, got %v", err)
+	}
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown did not finish")
+	}
+	if got := <-body; got != "done" {
+		t.Errorf("expected the in-flight request to complete, got %q", got)
+	}
+}
+
+func TestFlushForExitWritesBufferedBlocks(t *testing.T) {
+	logger = zap.NewNop()
+	dir := t.TempDir()
+	sink, err := newFileSink(fileSinkConfig{Dir: dir, ocfTuning: ocfTuning{BlockRecords: 10}})
+	if err != nil {
+		t.Fatalf("Failed to create file sink: %v", err)
+	}
+	sinks = []*configuredSink{{name: "file", typ: "file", sink: sink}}
+	defer func() {
+		sinks = nil
+		ocfLogs.wrapper, ocfLogs.logData = nil, nil
+	}()
+	writeSinks(context.Background(), testSinkRecord(t, "a"))
+	if stats := ocfLogs.logData.Stats(); stats.Buffered != 1 {
+		t.Fatalf("expected the log to wait for a full block: %+v", stats)
+	}
+
+	flushForExit()
+	files, _ := filepath.Glob(filepath.Join(dir, "logdata-*.avro"))
+	if len(files) != 1 {
+		t.Fatalf("expected one log data file, found %v", files)
+	}
+	f, err := os.Open(files[0])
+	if err != nil {
+		t.Fatalf("Failed to open OCF file: %v", err)
+	}
+	defer f.Close()
+	if _, n, err := ocf.Scan(f, func(interface{}) error { return nil }); err != nil || n != 1 {
+		t.Errorf("expected one complete record after shutdown, got %d, %v", n, err)
+	}
+	if failures := writeSinks(context.Background(), testSinkRecord(t, "b")); len(failures) != 1 {
+		t.Errorf("expected writes after shutdown to fail, got %v", failures)
+	}
+}
+
+func TestKafkaSinkCloseSendsPendingRecords(t *testing.T) {
+	logger = zap.NewNop()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"offsets":[{"partition":0,"offset":1}]}`))
+	}))
+	defer srv.Close()
+
+	// The record would wait a minute for its batch to fill.
+	sink, err := newKafkaSink(kafkaSinkConfig{RestProxy: srv.URL, Topic: "logs", BatchSize: 10, LingerMillis: 60000})
+	if err != nil {
+		t.Fatalf("Failed to create Kafka sink: %v", err)
+	}
+	if err := sink.Write(context.Background(), testSinkRecord(t, "a")); err != nil {
+		t.Fatalf("Failed to write log: %v", err)
+	}
+	kafka := sink.(*kafkaSink)
+	if err := kafka.Close(); err != nil {
+		t.Fatalf("Failed to close sink: %v", err)
+	}
+	if kafka.produced.Load() != 1 {
+		t.Errorf("expected the pending record to be produced on close, got %v", kafka.Stats())
+	}
+}
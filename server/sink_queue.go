@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// When the sink queue commits the sinks' files to stable storage, for
+// -sink-fsync.
+const (
+	// sinkFsyncNone leaves it to the OS.
+	sinkFsyncNone = "none"
+	// sinkFsyncBatch syncs after every batch, before the next is taken.
+	sinkFsyncBatch = "batch"
+	// sinkFsyncInterval syncs every -sink-fsync-interval while logs were
+	// written since the last sync.
+	sinkFsyncInterval = "interval"
+)
+
+func checkSinkFsync(policy string) error {
+	switch policy {
+	case sinkFsyncNone, sinkFsyncBatch, sinkFsyncInterval:
+		return nil
+	}
+	return fmt.Errorf("unknown fsync policy %q (want none, batch or interval)", policy)
+}
+
+// sinkQueue moves the sink writes off the request path: /log enqueues each
+// record on a bounded channel and one background goroutine hands them to
+// the sinks in batches of up to batch records, syncing the sinks per the
+// fsync policy. A full queue blocks the request until there is room, so a
+// slow disk slows ingest down instead of growing memory; a request whose
+// context ends while it waits drops its record, counted in dropped.
+//
+// Logs still queued are lost if the process is killed; close drains the
+// queue on a graceful shutdown.
+type sinkQueue struct {
+	records  chan sinkRecord
+	batch    int
+	fsync    string
+	interval time.Duration
+	done     chan struct{}
+	// pending counts the enqueued records not yet written.
+	pending sync.WaitGroup
+	// closeMu guards closed: enqueue holds it for reading, so close cannot
+	// close records under a sender.
+	closeMu sync.RWMutex
+	closed  bool
+
+	enqueued   atomic.Int64
+	written    atomic.Int64
+	batches    atomic.Int64
+	blocked    atomic.Int64
+	dropped    atomic.Int64
+	maxDepth   atomic.Int64
+	syncs      atomic.Int64
+	syncErrors atomic.Int64
+
+	mu            sync.Mutex
+	lastSync      time.Time
+	lastSyncError string
+}
+
+// sinkLogQueue is the queue of -sink-queue, nil when sinks are written
+// synchronously.
+var sinkLogQueue *sinkQueue
+
+func newSinkQueue(size, batch int, fsync string, interval time.Duration) *sinkQueue {
+	q := &sinkQueue{
+		records:  make(chan sinkRecord, size),
+		batch:    batch,
+		fsync:    fsync,
+		interval: interval,
+		done:     make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+// logToSinks hands record to the sinks: through the queue when there is
+// one, otherwise before returning with the sinks' failures.
+func logToSinks(ctx context.Context, record sinkRecord) []apiError {
+	if sinkLogQueue == nil {
+		return writeSinks(ctx, record)
+	}
+	sinkLogQueue.enqueue(ctx, record)
+	return nil
+}
+
+func (q *sinkQueue) enqueue(ctx context.Context, record sinkRecord) {
+	q.closeMu.RLock()
+	defer q.closeMu.RUnlock()
+	if q.closed {
+		// Late logs of a shutdown, such as from the TCP transport.
+		writeSinks(ctx, record)
+		return
+	}
+	q.pending.Add(1)
+	select {
+	case q.records <- record:
+	default:
+		q.blocked.Add(1)
+		select {
+		case q.records <- record:
+		case <-ctx.Done():
+			q.pending.Done()
+			q.dropped.Add(1)
+			logger.Error("Sink queue is full; log dropped", zap.String("id", record.ID), zap.Error(ctx.Err()))
+			return
+		}
+	}
+	q.enqueued.Add(1)
+	for depth := int64(len(q.records)); ; {
+		max := q.maxDepth.Load()
+		if depth <= max || q.maxDepth.CompareAndSwap(max, depth) {
+			break
+		}
+	}
+}
+
+func (q *sinkQueue) run() {
+	defer close(q.done)
+	var tick <-chan time.Time
+	if q.fsync == sinkFsyncInterval {
+		ticker := time.NewTicker(q.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	// The request contexts end with their responses, before the records
+	// are written.
+	ctx := context.Background()
+	dirty := false
+	batch := make([]sinkRecord, 0, q.batch)
+	for {
+		select {
+		case record, ok := <-q.records:
+			if !ok {
+				if dirty {
+					q.sync()
+				}
+				return
+			}
+			batch = append(batch[:0], record)
+			for len(batch) < q.batch {
+				next, ok := q.takeReady()
+				if !ok {
+					break
+				}
+				batch = append(batch, next)
+			}
+			for _, record := range batch {
+				writeSinks(ctx, record)
+			}
+			q.written.Add(int64(len(batch)))
+			q.batches.Add(1)
+			if q.fsync == sinkFsyncBatch {
+				q.sync()
+			} else if q.fsync == sinkFsyncInterval {
+				dirty = true
+			}
+			for range batch {
+				q.pending.Done()
+			}
+		case <-tick:
+			if dirty {
+				q.sync()
+				dirty = false
+			}
+		}
+	}
+}
+
+// takeReady returns a queued record without waiting for one.
+func (q *sinkQueue) takeReady() (sinkRecord, bool) {
+	select {
+	case record, ok := <-q.records:
+		return record, ok
+	default:
+		return sinkRecord{}, false
+	}
+}
+
+// sync commits the files of every sink that has a Sync method.
+func (q *sinkQueue) sync() {
+	var failed error
+	for _, s := range sinks {
+		syncer, ok := s.sink.(interface{ Sync() error })
+		if !ok {
+			continue
+		}
+		if err := syncer.Sync(); err != nil {
+			failed = err
+			logger.Error("Failed to sync sink", zap.String("sink", s.name), zap.Error(err))
+		}
+	}
+	q.syncs.Add(1)
+	q.mu.Lock()
+	q.lastSync = time.Now()
+	if failed != nil {
+		q.syncErrors.Add(1)
+		q.lastSyncError = failed.Error()
+	}
+	q.mu.Unlock()
+}
+
+// wait blocks until every record enqueued so far is written.
+func (q *sinkQueue) wait() {
+	q.pending.Wait()
+}
+
+// close returns once the queued records are written, and synced unless the
+// policy is none. Records enqueued afterwards are written synchronously.
+func (q *sinkQueue) close() {
+	q.closeMu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.records)
+	}
+	q.closeMu.Unlock()
+	<-q.done
+}
+
+func (q *sinkQueue) stats() gin.H {
+	q.mu.Lock()
+	lastSync, lastSyncError := q.lastSync, q.lastSyncError
+	q.mu.Unlock()
+	stats := gin.H{
+		"capacity":    cap(q.records),
+		"depth":       len(q.records),
+		"max_depth":   q.maxDepth.Load(),
+		"batch":       q.batch,
+		"fsync":       q.fsync,
+		"enqueued":    q.enqueued.Load(),
+		"written":     q.written.Load(),
+		"batches":     q.batches.Load(),
+		"blocked":     q.blocked.Load(),
+		"dropped":     q.dropped.Load(),
+		"syncs":       q.syncs.Load(),
+		"sync_errors": q.syncErrors.Load(),
+	}
+	if !lastSync.IsZero() {
+		stats["last_sync"] = lastSync
+	}
+	if lastSyncError != "" {
+		stats["last_sync_error"] = lastSyncError
+	}
+	return stats
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// gatedSink records what it is written and how often it is synced; writes
+// wait for gate to be closed.
+type gatedSink struct {
+	gate    chan struct{}
+	writing atomic.Int64
+
+	mu    sync.Mutex
+	ids   []string
+	syncs int
+}
+
+func (s *gatedSink) Write(ctx context.Context, record sinkRecord) error {
+	s.writing.Add(1)
+	<-s.gate
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ids = append(s.ids, record.ID)
+	return nil
+}
+
+func (s *gatedSink) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.syncs++
+	return nil
+}
+
+func TestSinkQueueWritesInBackground(t *testing.T) {
+	logger = zap.NewNop()
+	sink := &gatedSink{gate: make(chan struct{})}
+	sinks = []*configuredSink{{name: "gated", typ: "test", sink: sink}}
+	defer func() { sinks = nil }()
+	q := newSinkQueue(4, 8, sinkFsyncBatch, time.Second)
+
+	// The first record is taken by the writer and stalls on the gate;
+	// four more fill the queue without waiting for the sink.
+	record := testSinkRecord(t, "p")
+	for i := 0; i < 5; i++ {
+		record.ID = fmt.Sprint(i)
+		start := time.Now()
+		q.enqueue(context.Background(), record)
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Fatalf("enqueue %d waited %v for the sink", i, elapsed)
+		}
+		for i == 0 && sink.writing.Load() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	// The queue is full, so a request whose context ends is dropped.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	record.ID = "late"
+	q.enqueue(ctx, record)
+	if stats := q.stats(); stats["depth"] != 4 || stats["blocked"] != int64(1) || stats["dropped"] != int64(1) {
+		t.Fatalf("unexpected stats of a full queue %v", stats)
+	}
+
+	close(sink.gate)
+	q.wait()
+	stats := q.stats()
+	if stats["written"] != int64(5) || stats["batches"] != int64(2) || stats["max_depth"] != int64(4) {
+		t.Errorf("expected 5 logs in two batches, got %v", stats)
+	}
+	sink.mu.Lock()
+	if fmt.Sprint(sink.ids) != "[0 1 2 3 4]" || sink.syncs != 2 {
+		t.Errorf("expected the logs in order and a sync per batch, got %v and %d syncs", sink.ids, sink.syncs)
+	}
+	sink.mu.Unlock()
+
+	// After close the queue is bypassed.
+	q.close()
+	record.ID = "after"
+	q.enqueue(context.Background(), record)
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	if last := sink.ids[len(sink.ids)-1]; last != "after" {
+		t.Errorf("expected a record enqueued after close to be written directly, got %v", sink.ids)
+	}
+}
+
+func TestSinkQueueSyncsOnInterval(t *testing.T) {
+	logger = zap.NewNop()
+	sink := &gatedSink{gate: make(chan struct{})}
+	close(sink.gate)
+	sinks = []*configuredSink{{name: "gated", typ: "test", sink: sink}}
+	defer func() { sinks = nil }()
+	q := newSinkQueue(16, 8, sinkFsyncInterval, 10*time.Millisecond)
+	defer q.close()
+
+	q.enqueue(context.Background(), testSinkRecord(t, "p"))
+	q.wait()
+	deadline := time.Now().Add(5 * time.Second)
+	for q.syncs.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	syncs := q.syncs.Load()
+	if syncs != 1 {
+		t.Fatalf("expected one sync after the write, got %d", syncs)
+	}
+	// Nothing was written since, so the next ticks do not sync.
+	time.Sleep(50 * time.Millisecond)
+	if got := q.syncs.Load(); got != syncs {
+		t.Errorf("expected no syncs without new writes, got %d", got)
+	}
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/homveloper/exp-avro-json/server/expr"
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+	"go.uber.org/zap"
+)
+
+// Sinks receive every logged request after it is encoded. They are listed
+// in -sink-config:
+//
+//	{"sinks": [
+//	  {"type": "file", "dir": "avro-logs/ocf", "max_records": 10000},
+//	  {"type": "stdout"},
+//	  {"name": "events", "type": "kafka", "rest_proxy": "http://kafka-rest:8082", "topic": "logs"},
+//	  {"type": "s3", "bucket": "logs", "dir": "avro-logs/s3-spool"},
+//	  {"type": "db", "path": "avro-logs/logs.db"}
+//	]}
+//
+// Without a config file the -ocf-*, -s3-* and -db-path flags configure a
+// file, an S3 and a db sink. Each entry's type selects a factory in sinkTypes, so a new
+// destination only needs a Sink implementation and an entry there. A
+// failing sink is logged and counted in /stats but never fails the
+// request, like publishing to the demo broker.
+type Sink interface {
+	Write(ctx context.Context, record sinkRecord) error
+}
+
+// sinkRecord is one logged request. OriginalSize is the size of the JSON
+// request it was sent as, or would have been for binary ingest.
+type sinkRecord struct {
+	ID           string
+	Project      string
+	LogType      string
+	Received     time.Time
+	OriginalSize int
+	Encoded      *avrojson.EncodedLog
+}
+
+// sinkTypes maps each config type to a factory decoding the rest of the
+// entry.
+var sinkTypes = map[string]func(raw json.RawMessage) (Sink, error){
+	"file": func(raw json.RawMessage) (Sink, error) {
+		var config fileSinkConfig
+		if err := decodeSinkConfig(raw, &config); err != nil {
+			return nil, err
+		}
+		return newFileSink(config)
+	},
+	"stdout": func(raw json.RawMessage) (Sink, error) {
+		if err := decodeSinkConfig(raw, &struct{}{}); err != nil {
+			return nil, err
+		}
+		return &stdoutSink{w: os.Stdout}, nil
+	},
+	"kafka": func(raw json.RawMessage) (Sink, error) {
+		var config kafkaSinkConfig
+		if err := decodeSinkConfig(raw, &config); err != nil {
+			return nil, err
+		}
+		return newKafkaSink(config)
+	},
+	"s3": func(raw json.RawMessage) (Sink, error) {
+		var config s3SinkOptions
+		if err := decodeSinkConfig(raw, &config); err != nil {
+			return nil, err
+		}
+		return newS3Sink(config)
+	},
+	"db": func(raw json.RawMessage) (Sink, error) {
+		var config dbSinkConfig
+		if err := decodeSinkConfig(raw, &config); err != nil {
+			return nil, err
+		}
+		return newDBSink(config)
+	},
+}
+
+// decodeSinkConfig decodes a sink's keys into config. Unknown keys are
+// rejected so typos do not silently fall back to defaults.
+func decodeSinkConfig(raw json.RawMessage, config interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	return dec.Decode(config)
+}
+
+// sinkEntry is the part of a config entry every sink has; the other keys
+// belong to the sink type.
+type sinkEntry struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// When is an expression routing to the sink only the logs it holds
+	// for (see scripts.go).
+	When string `json:"when"`
+}
+
+type configuredSink struct {
+	name string
+	typ  string
+	sink Sink
+	when *expr.Program
+
+	written atomic.Int64
+	failed  atomic.Int64
+	skipped atomic.Int64
+
+	mu        sync.Mutex
+	lastError string
+}
+
+var sinks []*configuredSink
+
+// loadSinkConfig configures the sinks listed in the file at path.
+func loadSinkConfig(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var config struct {
+		Sinks []json.RawMessage `json:"sinks"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("parse sink config: %w", err)
+	}
+	for i, raw := range config.Sinks {
+		var entry sinkEntry
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			return fmt.Errorf("sink %d: %w", i, err)
+		}
+		if entry.Name == "" {
+			entry.Name = entry.Type
+		}
+		// Strip the common keys so the factory sees only its own.
+		var fields map[string]json.RawMessage
+		json.Unmarshal(raw, &fields)
+		delete(fields, "name")
+		delete(fields, "type")
+		delete(fields, "when")
+		rest, _ := json.Marshal(fields)
+		var when *expr.Program
+		if entry.When != "" {
+			if when, err = expr.Compile(entry.When); err != nil {
+				return fmt.Errorf("sink %d (%s): when: %w", i, entry.Name, err)
+			}
+		}
+		if err := addSink(entry.Name, entry.Type, rest); err != nil {
+			return fmt.Errorf("sink %d (%s): %w", i, entry.Name, err)
+		}
+		sinks[len(sinks)-1].when = when
+	}
+	return nil
+}
+
+// addSink creates a sink of typ from its JSON config.
+func addSink(name, typ string, raw json.RawMessage) error {
+	factory, ok := sinkTypes[typ]
+	if !ok {
+		return fmt.Errorf("unknown sink type %q", typ)
+	}
+	if err := checkSinkName(name); err != nil {
+		return err
+	}
+	sink, err := factory(raw)
+	if err != nil {
+		return err
+	}
+	sinks = append(sinks, &configuredSink{name: name, typ: typ, sink: sink})
+	return nil
+}
+
+func checkSinkName(name string) error {
+	for _, s := range sinks {
+		if s.name == name {
+			return fmt.Errorf("duplicate sink name %q", name)
+		}
+	}
+	return nil
+}
+
+// openFlagSinks configures the sinks of the -ocf-*, -s3-* and -db-path
+// flags, used when there is no -sink-config.
+func openFlagSinks(file fileSinkConfig, s3Opts s3SinkOptions, db dbSinkConfig) error {
+	if file.Dir != "" {
+		sink, err := newFileSink(file)
+		if err != nil {
+			return fmt.Errorf("file sink: %w", err)
+		}
+		sinks = append(sinks, &configuredSink{name: "file", typ: "file", sink: sink})
+	}
+	if s3Opts.Bucket != "" {
+		sink, err := newS3Sink(s3Opts)
+		if err != nil {
+			return fmt.Errorf("s3 sink: %w", err)
+		}
+		sinks = append(sinks, &configuredSink{name: "s3", typ: "s3", sink: sink})
+	}
+	if db.Path != "" {
+		sink, err := newDBSink(db)
+		if err != nil {
+			return fmt.Errorf("db sink: %w", err)
+		}
+		sinks = append(sinks, &configuredSink{name: "db", typ: "db", sink: sink})
+	}
+	return nil
+}
+
+// writeSinks hands record to every sink in order whose when predicate
+// holds, returning the failures as sink_failed errors.
+func writeSinks(ctx context.Context, record sinkRecord) []apiError {
+	var failures []apiError
+	var env map[string]interface{}
+	recordEnv := func() map[string]interface{} {
+		if env == nil {
+			env = sinkRecordEnv(record)
+		}
+		return env
+	}
+	for _, s := range sinks {
+		if !s.routes(recordEnv, record) {
+			continue
+		}
+		if err := s.sink.Write(ctx, record); err != nil {
+			failures = append(failures, apiError{Code: codeSinkFailed, Message: fmt.Sprintf("sink %q: %v", s.name, err)})
+			s.failed.Add(1)
+			s.mu.Lock()
+			s.lastError = err.Error()
+			s.mu.Unlock()
+			logger.Error("Failed to write log to sink", zap.String("sink", s.name), zap.String("id", record.ID), zap.Error(err))
+			continue
+		}
+		s.written.Add(1)
+	}
+	return failures
+}
+
+// closeSinks closes every sink that has a Close method at shutdown, so
+// what sinks buffer is written: partly filled OCF blocks, the S3 uploads
+// of the files that closes and Kafka's pending records.
+func closeSinks() {
+	for _, s := range sinks {
+		closer, ok := s.sink.(interface{ Close() error })
+		if !ok {
+			continue
+		}
+		if err := closer.Close(); err != nil {
+			logger.Error("Failed to close sink", zap.String("sink", s.name), zap.Error(err))
+		}
+	}
+}
+
+// sinkDirs lists the directories of sinks that spool to disk, for the
+// startup self-check.
+func sinkDirs() []sinkProbe {
+	var probes []sinkProbe
+	for _, s := range sinks {
+		if d, ok := s.sink.(interface{ Dir() string }); ok {
+			probes = append(probes, sinkProbe{name: "sink:" + s.name, dir: d.Dir()})
+		}
+	}
+	return probes
+}
+
+func sinkStats() []gin.H {
+	out := make([]gin.H, 0, len(sinks))
+	for _, s := range sinks {
+		s.mu.Lock()
+		lastError := s.lastError
+		s.mu.Unlock()
+		stats := gin.H{"name": s.name, "type": s.typ, "written": s.written.Load(), "failed": s.failed.Load()}
+		if s.when != nil {
+			stats["when"], stats["skipped"] = s.when.String(), s.skipped.Load()
+		}
+		if lastError != "" {
+			stats["last_error"] = lastError
+		}
+		if r, ok := s.sink.(interface{ Stats() gin.H }); ok {
+			stats["details"] = r.Stats()
+		}
+		out = append(out, stats)
+	}
+	return out
+}
+
+// stdoutSink prints one JSON line per log with both levels in Avro JSON,
+// for piping into log shippers or watching a local run.
+type stdoutSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *stdoutSink) Write(ctx context.Context, record sinkRecord) error {
+	line, err := json.Marshal(struct {
+		ID       string          `json:"id"`
+		Project  string          `json:"project"`
+		Received time.Time       `json:"received"`
+		Wrapper  json.RawMessage `json:"wrapper"`
+		LogData  json.RawMessage `json:"logdata"`
+	}{record.ID, record.Project, record.Received, record.Encoded.WrapperJSON, record.Encoded.LogDataJSON})
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(append(line, '\n'))
+	return err
+}
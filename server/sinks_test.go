@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+	"go.uber.org/zap"
+)
+
+func testSinkRecord(t *testing.T, project string) sinkRecord {
+	t.Helper()
+	encoded, err := avrojson.EncodeLog(avrojson.LogWrapper{ProjectName: project, LogType: "t"},
+		avrojson.LogData{Timestamp: time.UnixMilli(1).UTC(), Logtype: "t", Version: "1", Issuer: "i"})
+	if err != nil {
+		t.Fatalf("Failed to encode log: %v", err)
+	}
+	return sinkRecord{ID: "id-1", Project: project, Received: time.Unix(1, 0).UTC(), Encoded: encoded}
+}
+
+func TestLoadSinkConfig(t *testing.T) {
+	logger = zap.NewNop()
+	defer func() {
+		if ocfLogs.wrapper != nil {
+			ocfLogs.wrapper.Close()
+			ocfLogs.logData.Close()
+		}
+		ocfLogs.wrapper, ocfLogs.logData = nil, nil
+		sinks = nil
+	}()
+	dir := t.TempDir()
+	write := func(config string) string {
+		path := filepath.Join(dir, "sinks.json")
+		if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+			t.Fatalf("Failed to write sink config: %v", err)
+		}
+		return path
+	}
+
+	for name, config := range map[string]string{
+		"unknown type":  `{"sinks": [{"type": "carrier-pigeon"}]}`,
+		"unknown key":   `{"sinks": [{"type": "stdout", "colour": true}]}`,
+		"duplicate":     `{"sinks": [{"type": "stdout"}, {"type": "stdout"}]}`,
+		"missing dir":   `{"sinks": [{"type": "file"}]}`,
+		"missing topic": `{"sinks": [{"type": "kafka", "rest_proxy": "http://localhost:8082"}]}`,
+	} {
+		sinks = nil
+		if err := loadSinkConfig(write(config)); err == nil {
+			t.Errorf("%s: expected the config to be rejected", name)
+		}
+	}
+
+	sinks = nil
+	ocfDir := filepath.Join(dir, "ocf")
+	config := `{"sinks": [{"type": "file", "dir": "` + ocfDir + `", "max_records": 5}, {"name": "console", "type": "stdout"}]}`
+	if err := loadSinkConfig(write(config)); err != nil {
+		t.Fatalf("Failed to load sink config: %v", err)
+	}
+	if len(sinks) != 2 || sinks[0].name != "file" || sinks[1].name != "console" || sinks[1].typ != "stdout" {
+		t.Fatalf("unexpected sinks %+v", sinks)
+	}
+	if ocfLogs.dir != ocfDir || ocfLogs.tuning.MaxRecords != 5 {
+		t.Errorf("file sink opened %q with %d records per file", ocfLogs.dir, ocfLogs.tuning.MaxRecords)
+	}
+	if probes := sinkDirs(); len(probes) != 1 || probes[0].dir != ocfDir {
+		t.Errorf("sinkDirs = %v", probes)
+	}
+}
+
+// failingSink fails every write.
+type failingSink struct{}
+
+func (failingSink) Write(ctx context.Context, record sinkRecord) error {
+	return errors.New("disk full")
+}
+
+func TestWriteSinksCountsFailures(t *testing.T) {
+	logger = zap.NewNop()
+	defer func() { sinks = nil }()
+	var out bytes.Buffer
+	sinks = []*configuredSink{
+		{name: "broken", typ: "test", sink: failingSink{}},
+		{name: "stdout", typ: "stdout", sink: &stdoutSink{w: &out}},
+	}
+
+	record := testSinkRecord(t, "p")
+	failures := writeSinks(context.Background(), record)
+	if len(failures) != 1 || failures[0].Code != codeSinkFailed || !strings.Contains(failures[0].Message, `"broken"`) {
+		t.Errorf("expected one sink_failed error naming the sink, got %+v", failures)
+	}
+
+	// The failing sink does not stop the others.
+	var line struct {
+		ID      string          `json:"id"`
+		Project string          `json:"project"`
+		Wrapper json.RawMessage `json:"wrapper"`
+		LogData json.RawMessage `json:"logdata"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &line); err != nil {
+		t.Fatalf("Failed to parse stdout line %q: %v", out.String(), err)
+	}
+	if line.ID != "id-1" || line.Project != "p" || !bytes.Equal(line.LogData, record.Encoded.LogDataJSON) {
+		t.Errorf("unexpected stdout line %s", out.String())
+	}
+	stats := sinkStats()
+	if stats[0]["failed"] != int64(1) || stats[0]["last_error"] != "disk full" || stats[1]["written"] != int64(1) {
+		t.Errorf("unexpected sink stats %v", stats)
+	}
+}
+
+func TestKafkaSinkBatchesThroughRESTProxy(t *testing.T) {
+	logger = zap.NewNop()
+	var mu sync.Mutex
+	var requests [][]kafkaRecord
+	failNext := 1
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path != "/topics/logs" || r.Header.Get("Content-Type") != "application/vnd.kafka.binary.v2+json" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		if failNext > 0 {
+			failNext--
+			http.Error(w, `{"error_code":50302,"message":"leader not available"}`, http.StatusServiceUnavailable)
+			return
+		}
+		var body struct {
+			Records []kafkaRecord `json:"records"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		requests = append(requests, body.Records)
+		offsets := make([]string, len(body.Records))
+		for i := range offsets {
+			offsets[i] = `{"partition":0,"offset":1,"error_code":null,"error":null}`
+		}
+		w.Write([]byte(`{"offsets":[` + strings.Join(offsets, ",") + `]}`))
+	}))
+	defer srv.Close()
+
+	sink, err := newKafkaSink(kafkaSinkConfig{RestProxy: srv.URL, Topic: "logs", BatchSize: 2, LingerMillis: 20, Retries: 1})
+	if err != nil {
+		t.Fatalf("Failed to create Kafka sink: %v", err)
+	}
+	kafka := sink.(*kafkaSink)
+	kafka.backoff = time.Millisecond
+
+	// Two records fill a batch; the third goes out after the linger time.
+	records := []sinkRecord{testSinkRecord(t, "a"), testSinkRecord(t, "b"), testSinkRecord(t, "c")}
+	for _, record := range records {
+		if err := sink.Write(context.Background(), record); err != nil {
+			t.Fatalf("Failed to write log: %v", err)
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for kafka.produced.Load() < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(requests) != 2 || len(requests[0]) != 2 || len(requests[1]) != 1 {
+		t.Fatalf("expected batches of 2 and 1 after one retry, got %v", requests)
+	}
+	if string(requests[0][0].Key) != "a" || !bytes.Equal(requests[0][0].Value, records[0].Encoded.Wrapper) {
+		t.Errorf("first record has key %q and value %x", requests[0][0].Key, requests[0][0].Value)
+	}
+	if stats := kafka.Stats(); stats["produced"] != int64(3) || stats["failed"] != int64(0) {
+		t.Errorf("unexpected stats %v", stats)
+	}
+}
@@ -0,0 +1,495 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Snapshots rebuild an environment between experiment phases. GET
+// /admin/snapshot, enabled by -admin-token, returns one gzipped tar of the
+// server's state: the effective configuration as YAML (config.yaml), the
+// files it names (quotas, feature flags, experiments, sink and plugin
+// configs, project schemas), every schema registry version and pin,
+// the artifact store's manifests, blobs and idempotency keys, and the
+// db sink's stats database. The OCF files are not included; replicate
+// them or keep them in S3. Neither are the secrets: config.yaml leaves out
+// -admin-token and -replicate-token (secretFlags), and the tenant file
+// with its keys is not among the files.
+//
+// -restore <archive> unpacks one into a fresh instance before it starts:
+// the configuration is written to -config (default config.yaml) and used
+// for the run, flags and AVRO_JSON_* variables still overriding it, and
+// the rest goes where that configuration puts it. A restore refuses to
+// overwrite anything, so every target file must be missing and every
+// target directory missing or empty. The restored instance takes the
+// secrets from its own flags or environment; until it has them its admin
+// routes stay disabled and a -standby refuses to start.
+
+// snapshotFormat is the version of the archive layout.
+const snapshotFormat = 1
+
+// snapshotManifest is the first entry of an archive, snapshot.json.
+type snapshotManifest struct {
+	Format  int       `json:"format"`
+	Created time.Time `json:"created"`
+	Node    string    `json:"node"`
+	// Sections lists what the archive holds: config, registry, artifacts,
+	// logdb and files.
+	Sections []string `json:"sections"`
+	// Files maps the flags whose files are included, below files/<flag>,
+	// to "file" or "dir".
+	Files map[string]string `json:"files,omitempty"`
+	// LogDBPath is where the stats database was. A restore only ever
+	// writes it to the restored -db-path.
+	LogDBPath string `json:"logdb_path,omitempty"`
+	// OmittedSecrets lists the secret flags that were set but are not in
+	// config.yaml.
+	OmittedSecrets []string `json:"omitted_secrets,omitempty"`
+}
+
+const (
+	snapshotManifestEntry = "snapshot.json"
+	snapshotConfigEntry   = "config.yaml"
+	snapshotLogDBEntry    = "logdb"
+	// snapshotDefaultConfig is where a restore writes the configuration
+	// when no -config is given.
+	snapshotDefaultConfig = "config.yaml"
+)
+
+// snapshotFileFlags name the files and directories the configuration
+// refers to, included in a snapshot when set. TLS keys and the tenant
+// file, which holds API and encryption keys, are left out.
+var snapshotFileFlags = []string{"quota-file", "feature-file", "experiment-file", "sink-config", "plugin-config", "project-schemas"}
+
+// configSources records where each flag's value came from, for the
+// configuration a snapshot holds.
+var configSources map[string]string
+
+// artifactSnapshotDirs are the artifact store directories a snapshot holds;
+// bloom/ is rebuilt when the restored store opens.
+var artifactSnapshotDirs = map[string]bool{"blobs": true, "manifests": true, "keys": true}
+
+// artifactSnapshotPath reports whether rel, a path below -artifact-dir, is
+// part of an artifact store: <dir>/blobs/... or, in multi-tenant mode,
+// <dir>/<project>/blobs/...
+func artifactSnapshotPath(rel string) bool {
+	parts := strings.Split(rel, "/")
+	for i := 0; i < len(parts)-1 && i < 2; i++ {
+		if artifactSnapshotDirs[parts[i]] {
+			return true
+		}
+	}
+	return false
+}
+
+// snapshotArchive writes the entries of an archive.
+type snapshotArchive struct {
+	tw *tar.Writer
+}
+
+func (a snapshotArchive) addBytes(name string, data []byte, mod time.Time) error {
+	if err := a.tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: mod, Typeflag: tar.TypeReg}); err != nil {
+		return err
+	}
+	_, err := a.tw.Write(data)
+	return err
+}
+
+// addFile adds the file at path as it is now; bytes appended while it is
+// copied are left out.
+func (a snapshotArchive) addFile(name, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if err := a.tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: info.Size(), ModTime: info.ModTime(), Typeflag: tar.TypeReg}); err != nil {
+		return err
+	}
+	_, err = io.CopyN(a.tw, f, info.Size())
+	return err
+}
+
+// addTree adds the regular files below dir for which include, given their
+// slash-separated relative path, holds, skipping temporary and dot files.
+func (a snapshotArchive) addTree(prefix, dir string, include func(rel string) bool) error {
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		name := d.Name()
+		if !d.Type().IsRegular() || strings.HasPrefix(name, ".") || strings.HasSuffix(name, ".tmp") {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if include != nil && !include(rel) {
+			return nil
+		}
+		err = a.addFile(prefix+rel, p)
+		if errors.Is(err, fs.ErrNotExist) {
+			// Removed while walking, such as by artifact retention.
+			return nil
+		}
+		return err
+	})
+}
+
+// writeSnapshot writes the archive of the server's state configured by fs
+// to w.
+func writeSnapshot(w io.Writer, fs *flag.FlagSet, sources map[string]string, now time.Time) (snapshotManifest, error) {
+	manifest := snapshotManifest{
+		Format:   snapshotFormat,
+		Created:  now.UTC(),
+		Node:     fs.Lookup("node-id").Value.String(),
+		Sections: []string{"config"},
+		Files:    make(map[string]string),
+	}
+	var config bytes.Buffer
+	if err := printConfig(&config, fs, sources, secretFlags); err != nil {
+		return manifest, err
+	}
+	fs.VisitAll(func(f *flag.Flag) {
+		if secretFlags[f.Name] && f.Value.String() != "" {
+			manifest.OmittedSecrets = append(manifest.OmittedSecrets, f.Name)
+		}
+	})
+	for _, name := range snapshotFileFlags {
+		p := fs.Lookup(name).Value.String()
+		if p == "" {
+			continue
+		}
+		info, err := os.Stat(p)
+		if err != nil {
+			return manifest, fmt.Errorf("%s: %w", name, err)
+		}
+		manifest.Files[name] = "file"
+		if info.IsDir() {
+			manifest.Files[name] = "dir"
+		}
+	}
+	if len(manifest.Files) > 0 {
+		manifest.Sections = append(manifest.Sections, "files")
+	}
+	var registryDir string
+	if schemaRegistry != nil {
+		dir, err := os.MkdirTemp("", "snapshot-registry-")
+		if err != nil {
+			return manifest, err
+		}
+		defer os.RemoveAll(dir)
+		if err := schemaRegistry.Dump(dir); err != nil {
+			return manifest, fmt.Errorf("registry: %w", err)
+		}
+		registryDir = dir
+		manifest.Sections = append(manifest.Sections, "registry")
+	}
+	artifactDir := fs.Lookup("artifact-dir").Value.String()
+	if artifactDir != "" {
+		manifest.Sections = append(manifest.Sections, "artifacts")
+	}
+	if logDB != nil {
+		if err := logDB.Sync(); err != nil {
+			return manifest, fmt.Errorf("logdb: %w", err)
+		}
+		manifest.LogDBPath = logDB.Stats().Path
+		manifest.Sections = append(manifest.Sections, "logdb")
+	}
+
+	gz := gzip.NewWriter(w)
+	a := snapshotArchive{tw: tar.NewWriter(gz)}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return manifest, err
+	}
+	if err := a.addBytes(snapshotManifestEntry, data, now); err != nil {
+		return manifest, err
+	}
+	if err := a.addBytes(snapshotConfigEntry, config.Bytes(), now); err != nil {
+		return manifest, err
+	}
+	for _, name := range snapshotFileFlags {
+		p := fs.Lookup(name).Value.String()
+		switch manifest.Files[name] {
+		case "file":
+			err = a.addFile("files/"+name, p)
+		case "dir":
+			err = a.addTree("files/"+name+"/", p, nil)
+		}
+		if err != nil {
+			return manifest, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	if registryDir != "" {
+		if err := a.addTree("registry/", registryDir, nil); err != nil {
+			return manifest, fmt.Errorf("registry: %w", err)
+		}
+	}
+	if artifactDir != "" {
+		if err := a.addTree("artifacts/", artifactDir, artifactSnapshotPath); err != nil {
+			return manifest, fmt.Errorf("artifacts: %w", err)
+		}
+	}
+	if manifest.LogDBPath != "" {
+		if err := a.addFile(snapshotLogDBEntry, manifest.LogDBPath); err != nil {
+			return manifest, fmt.Errorf("logdb: %w", err)
+		}
+	}
+	if err := a.tw.Close(); err != nil {
+		return manifest, err
+	}
+	return manifest, gz.Close()
+}
+
+// snapshotHandler builds the archive in a temporary file first, so a
+// failure is still answered with an error status.
+func snapshotHandler(c *gin.Context) {
+	tmp, err := os.CreateTemp("", "snapshot-*.tar.gz")
+	if err != nil {
+		requestLogger(c).Error("Failed to create snapshot file", zap.Error(err))
+		respondError(c, http.StatusInternalServerError, codeStorageFailed, "Failed to write snapshot")
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	manifest, err := writeSnapshot(tmp, flag.CommandLine, configSources, time.Now())
+	if err != nil {
+		requestLogger(c).Error("Failed to write snapshot", zap.Error(err))
+		respondError(c, http.StatusInternalServerError, codeStorageFailed, "Failed to write snapshot")
+		return
+	}
+	requestLogger(c).Info("Wrote snapshot", zap.Strings("sections", manifest.Sections))
+	name := "snapshot-" + manifest.Created.Format("20060102T150405Z") + ".tar.gz"
+	c.Header("Content-Disposition", `attachment; filename="`+name+`"`)
+	c.Header("Content-Type", "application/gzip")
+	http.ServeContent(c.Writer, c.Request, name, manifest.Created, tmp)
+}
+
+// registerSnapshotRoutes adds GET /admin/snapshot when token is set.
+func registerSnapshotRoutes(r *gin.Engine, token string) {
+	if token == "" {
+		return
+	}
+	r.GET("/admin/snapshot", requireBearerToken(token, "admin token"), snapshotHandler)
+}
+
+// readSnapshot calls fn with each entry of the archive at file until fn
+// returns errStopSnapshot or another error.
+func readSnapshot(file string, fn func(name string, r io.Reader) error) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("%s is not a snapshot: %w", file, err)
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read snapshot: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := fn(hdr.Name, tr); err != nil {
+			if errors.Is(err, errStopSnapshot) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+var errStopSnapshot = errors.New("stop reading snapshot")
+
+// readSnapshotHeader returns the manifest and configuration the archive
+// starts with.
+func readSnapshotHeader(file string) (snapshotManifest, []byte, error) {
+	var manifest snapshotManifest
+	var config []byte
+	err := readSnapshot(file, func(name string, r io.Reader) error {
+		var err error
+		switch name {
+		case snapshotManifestEntry:
+			err = json.NewDecoder(r).Decode(&manifest)
+		case snapshotConfigEntry:
+			config, err = io.ReadAll(r)
+		default:
+			return errStopSnapshot
+		}
+		return err
+	})
+	if err == nil && manifest.Format != snapshotFormat {
+		err = fmt.Errorf("%s is not a snapshot of format %d", file, snapshotFormat)
+	}
+	if err == nil && config == nil {
+		err = fmt.Errorf("%s holds no %s", file, snapshotConfigEntry)
+	}
+	return manifest, config, err
+}
+
+// restoreSnapshotConfig writes the archive's configuration to path, or to
+// config.yaml when path is empty, and returns where it went.
+func restoreSnapshotConfig(file, path string) (string, error) {
+	_, config, err := readSnapshotHeader(file)
+	if err != nil {
+		return "", err
+	}
+	if path == "" {
+		path = snapshotDefaultConfig
+	}
+	if err := restoreTargetFree(path, false); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	return path, os.WriteFile(path, config, 0644)
+}
+
+// restoreTargetFree checks that a restore would not overwrite anything at
+// path: a file must be missing, a directory missing or empty.
+func restoreTargetFree(path string, dir bool) error {
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if dir && info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s already exists; restore into a fresh instance", path)
+}
+
+// restoreSnapshot unpacks everything but the configuration into the paths
+// fs, configured from it, names.
+func restoreSnapshot(file string, fs *flag.FlagSet) (snapshotManifest, error) {
+	manifest, _, err := readSnapshotHeader(file)
+	if err != nil {
+		return manifest, err
+	}
+	// targets maps each archive prefix to its destination; prefixes
+	// ending in / are directories.
+	targets := make(map[string]string)
+	target := func(prefix, flagName, dest string) error {
+		if dest == "" {
+			return fmt.Errorf("the snapshot holds %s but -%s is empty", strings.TrimSuffix(prefix, "/"), flagName)
+		}
+		if err := restoreTargetFree(dest, strings.HasSuffix(prefix, "/")); err != nil {
+			return err
+		}
+		targets[prefix] = dest
+		return nil
+	}
+	for name, kind := range manifest.Files {
+		prefix := "files/" + name
+		if kind == "dir" {
+			prefix += "/"
+		}
+		if fs.Lookup(name) == nil {
+			return manifest, fmt.Errorf("the snapshot holds a file of unknown flag -%s", name)
+		}
+		if err := target(prefix, name, fs.Lookup(name).Value.String()); err != nil {
+			return manifest, err
+		}
+	}
+	for _, section := range manifest.Sections {
+		switch section {
+		case "registry":
+			err = target("registry/", "schema-dir", fs.Lookup("schema-dir").Value.String())
+		case "artifacts":
+			err = target("artifacts/", "artifact-dir", fs.Lookup("artifact-dir").Value.String())
+		case "logdb":
+			err = target(snapshotLogDBEntry, "db-path", fs.Lookup("db-path").Value.String())
+		}
+		if err != nil {
+			return manifest, err
+		}
+	}
+
+	err = readSnapshot(file, func(name string, r io.Reader) error {
+		if name == snapshotManifestEntry || name == snapshotConfigEntry {
+			return nil
+		}
+		dest, ok := targets[name]
+		if !ok {
+			prefix, rel := restorePrefix(name)
+			base, found := targets[prefix]
+			if !found {
+				return fmt.Errorf("unexpected snapshot entry %s", name)
+			}
+			if !filepath.IsLocal(filepath.FromSlash(rel)) {
+				return fmt.Errorf("snapshot entry %s leaves its directory", name)
+			}
+			dest = filepath.Join(base, filepath.FromSlash(rel))
+		}
+		return restoreFile(dest, r)
+	})
+	return manifest, err
+}
+
+// restorePrefix splits an entry below a directory target into the
+// target's prefix and the path below it.
+func restorePrefix(name string) (string, string) {
+	top, rest, _ := strings.Cut(name, "/")
+	if top == "files" {
+		flagName, rel, _ := strings.Cut(rest, "/")
+		return path.Join("files", flagName) + "/", rel
+	}
+	return top + "/", rest
+}
+
+func restoreFile(dest string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
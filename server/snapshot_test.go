@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/homveloper/exp-avro-json/server/logdb"
+	"github.com/homveloper/exp-avro-json/server/registry"
+)
+
+func newSnapshotFlagSet(root string) *flag.FlagSet {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("node-id", "node-a", "")
+	fs.String("schema-dir", filepath.Join(root, "schemas"), "")
+	fs.String("artifact-dir", filepath.Join(root, "avro-logs"), "")
+	fs.String("db-path", filepath.Join(root, "stats.db"), "")
+	for _, name := range snapshotFileFlags {
+		fs.String(name, "", "")
+	}
+	fs.String("tenant-file", "", "")
+	fs.String("admin-token", "", "")
+	fs.String("replicate-token", "", "")
+	fs.String("config", "", "")
+	return fs
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	newSchemaTestEngine(t)
+	defer func() { schemaRegistry, logDB = nil, nil }()
+	src, dst := t.TempDir(), t.TempDir()
+	fs := newSnapshotFlagSet(src)
+
+	reg, err := registry.Open(filepath.Join(src, "schemas"))
+	if err != nil {
+		t.Fatalf("Failed to open registry: %v", err)
+	}
+	if _, _, err := reg.Register("exp.Event", `{"type":"record","name":"exp.Event","fields":[{"name":"id","type":"string"}]}`); err != nil {
+		t.Fatalf("Failed to register schema: %v", err)
+	}
+	schemaRegistry = reg
+	if logDB, err = logdb.Open(filepath.Join(src, "stats.db")); err != nil {
+		t.Fatalf("Failed to open logdb: %v", err)
+	}
+	defer logDB.Close()
+	if err := logDB.Put(logdb.Record{ID: "01", Project: "raid", LogType: "t", Time: time.Now(), Wrapper: []byte{1}, LogData: []byte{2}}); err != nil {
+		t.Fatalf("Failed to put record: %v", err)
+	}
+	for path, content := range map[string]string{
+		"avro-logs/manifests/01.json":   `{"id":"01"}`,
+		"avro-logs/blobs/ab/abcd":       "blob",
+		"avro-logs/bloom/blobs.bloom":   "filter",
+		"avro-logs/ocf/wrapper-01.avro": "ocf",
+		"quotas.json":                   `{"projects":{}}`,
+		"tenants.json":                  `{"tenants":[]}`,
+		"project-schemas/raid.avsc":     `{"type":"record","name":"Raid","fields":[]}`,
+	} {
+		full := filepath.Join(src, filepath.FromSlash(path))
+		os.MkdirAll(filepath.Dir(full), 0o755)
+		if err := os.WriteFile(full, []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+	fs.Set("quota-file", filepath.Join(src, "quotas.json"))
+	fs.Set("project-schemas", filepath.Join(src, "project-schemas"))
+	fs.Set("tenant-file", filepath.Join(src, "tenants.json"))
+	fs.Set("admin-token", "admin-secret")
+	fs.Set("replicate-token", "replicate-secret")
+
+	var archive bytes.Buffer
+	manifest, err := writeSnapshot(&archive, fs, map[string]string{}, time.Now())
+	if err != nil {
+		t.Fatalf("Failed to write snapshot: %v", err)
+	}
+	if got := strings.Join(manifest.Sections, ","); got != "config,files,registry,artifacts,logdb" {
+		t.Errorf("unexpected sections %s", got)
+	}
+	if _, ok := manifest.Files["tenant-file"]; ok {
+		t.Error("expected the tenant file and its keys to be left out")
+	}
+	file := filepath.Join(t.TempDir(), "snapshot.tar.gz")
+	os.WriteFile(file, archive.Bytes(), 0o644)
+
+	// The configuration goes to -config, and never over an existing file.
+	cfgPath, err := restoreSnapshotConfig(file, filepath.Join(dst, "config.yaml"))
+	if err != nil {
+		t.Fatalf("Failed to restore config: %v", err)
+	}
+	if data, _ := os.ReadFile(cfgPath); !strings.Contains(string(data), "quota-file: "+filepath.Join(src, "quotas.json")) {
+		t.Errorf("expected the snapshot's configuration, got %s", data)
+	}
+	if data, _ := os.ReadFile(cfgPath); strings.Contains(string(data), "secret") || strings.Contains(string(data), "token") {
+		t.Errorf("expected the tokens to be left out of the configuration, got %s", data)
+	}
+	if got := strings.Join(manifest.OmittedSecrets, ","); got != "admin-token,replicate-token" {
+		t.Errorf("unexpected omitted secrets %s", got)
+	}
+	if _, err := restoreSnapshotConfig(file, cfgPath); err == nil {
+		t.Error("expected restoring over an existing config to fail")
+	}
+
+	// Paths set on the command line override the restored configuration.
+	restored := newSnapshotFlagSet(dst)
+	for _, name := range []string{"schema-dir", "artifact-dir", "db-path"} {
+		restored.Set(name, restored.Lookup(name).Value.String())
+	}
+	restored.Set("quota-file", filepath.Join(dst, "quotas.json"))
+	restored.Set("project-schemas", filepath.Join(dst, "project-schemas"))
+	if _, err := applyConfig(restored, cfgPath, nil); err != nil {
+		t.Fatalf("Failed to apply restored config: %v", err)
+	}
+	os.MkdirAll(filepath.Join(dst, "avro-logs"), 0o755)
+	os.WriteFile(filepath.Join(dst, "avro-logs", "leftover"), nil, 0o644)
+	if _, err := restoreSnapshot(file, restored); err == nil || !strings.Contains(err.Error(), "fresh instance") {
+		t.Errorf("expected a non-empty artifact dir to be refused, got %v", err)
+	}
+	os.Remove(filepath.Join(dst, "avro-logs", "leftover"))
+	// The stats database only goes to -db-path, wherever it was.
+	restored.Set("db-path", "")
+	if _, err := restoreSnapshot(file, restored); err == nil || !strings.Contains(err.Error(), "-db-path is empty") {
+		t.Errorf("expected a restore without -db-path to be refused, got %v", err)
+	}
+	restored.Set("db-path", filepath.Join(dst, "stats.db"))
+	if _, err := restoreSnapshot(file, restored); err != nil {
+		t.Fatalf("Failed to restore snapshot: %v", err)
+	}
+
+	for _, path := range []string{"avro-logs/manifests/01.json", "avro-logs/blobs/ab/abcd", "quotas.json", "project-schemas/raid.avsc"} {
+		if _, err := os.Stat(filepath.Join(dst, filepath.FromSlash(path))); err != nil {
+			t.Errorf("expected %s to be restored: %v", path, err)
+		}
+	}
+	for _, path := range []string{"avro-logs/bloom", "avro-logs/ocf"} {
+		if _, err := os.Stat(filepath.Join(dst, filepath.FromSlash(path))); err == nil {
+			t.Errorf("expected %s to be left out", path)
+		}
+	}
+	copied, err := registry.Open(filepath.Join(dst, "schemas"))
+	if err != nil {
+		t.Fatalf("Failed to open restored registry: %v", err)
+	}
+	if _, err := copied.Get("exp.Event", 1); err != nil {
+		t.Errorf("expected the schema in the restored registry: %v", err)
+	}
+	db, err := logdb.Open(filepath.Join(dst, "stats.db"))
+	if err != nil {
+		t.Fatalf("Failed to open restored logdb: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.Get("01"); err != nil {
+		t.Errorf("expected the record in the restored logdb: %v", err)
+	}
+}
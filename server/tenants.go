@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/homveloper/exp-avro-json/server/artifact"
+	"github.com/homveloper/exp-avro-json/server/seal"
+	"go.uber.org/zap"
+)
+
+// tenantConfig is the JSON file -tenant-file names. Listing tenants turns
+// on multi-tenant mode: every log, export, replay, import and artifact
+// request needs a tenant's API key, and each project's logs are stored in
+// their own directories, encrypted with the project's key.
+type tenantConfig struct {
+	Tenants []tenantEntry `json:"tenants"`
+}
+
+type tenantEntry struct {
+	Project string   `json:"project"`
+	APIKeys []string `json:"api_keys"`
+	// EncryptionKey is the base64 of the 32-byte AES-256 key the project's
+	// OCF files and artifacts are sealed with.
+	EncryptionKey string `json:"encryption_key"`
+}
+
+// tenant is one project of multi-tenant mode.
+type tenant struct {
+	project string
+	key     *seal.Key
+
+	mu        sync.Mutex
+	artifacts *artifact.Store // opened on first use
+}
+
+var (
+	// tenants holds the tenants by project and tenantKeys by the SHA-256
+	// of each API key. Both are nil outside multi-tenant mode.
+	tenants    map[string]*tenant
+	tenantKeys map[[sha256.Size]byte]*tenant
+	// tenantArtifactDir is -artifact-dir in multi-tenant mode, where each
+	// project's artifacts get a subdirectory.
+	tenantArtifactDir string
+)
+
+// tenantContextKey is the gin context key of the authenticated tenant.
+const tenantContextKey = "tenant"
+
+// loadTenants reads the tenants of path. An empty path leaves multi-tenant
+// mode off.
+func loadTenants(path string) error {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var config tenantConfig
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&config); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	if len(config.Tenants) == 0 {
+		return errors.New("no tenants configured")
+	}
+	byProject := make(map[string]*tenant)
+	byKey := make(map[[sha256.Size]byte]*tenant)
+	for i, entry := range config.Tenants {
+		// The project names the tenant's directories.
+		if entry.Project == "" || entry.Project == "." || entry.Project == ".." || unsafeFileChars.MatchString(entry.Project) {
+			return fmt.Errorf("tenant %d: project %q must be a non-empty name of letters, digits, '.', '_' and '-'", i, entry.Project)
+		}
+		if byProject[entry.Project] != nil {
+			return fmt.Errorf("tenant %q is configured twice", entry.Project)
+		}
+		raw, err := base64.StdEncoding.DecodeString(entry.EncryptionKey)
+		if err != nil {
+			return fmt.Errorf("tenant %q: encryption_key is not base64: %v", entry.Project, err)
+		}
+		key, err := seal.NewKey(raw)
+		if err != nil {
+			return fmt.Errorf("tenant %q: %v", entry.Project, err)
+		}
+		if len(entry.APIKeys) == 0 {
+			return fmt.Errorf("tenant %q has no api_keys", entry.Project)
+		}
+		t := &tenant{project: entry.Project, key: key}
+		for _, apiKey := range entry.APIKeys {
+			sum := sha256.Sum256([]byte(apiKey))
+			if apiKey == "" || byKey[sum] != nil {
+				return fmt.Errorf("tenant %q: API keys must be non-empty and unique across tenants", entry.Project)
+			}
+			byKey[sum] = t
+		}
+		byProject[entry.Project] = t
+	}
+	tenants, tenantKeys = byProject, byKey
+	logger.Info("Multi-tenant mode enabled", zap.Int("tenants", len(tenants)))
+	return nil
+}
+
+// requireTenant authenticates a request in multi-tenant mode: it must carry
+// one of a tenant's API keys as "Authorization: Bearer <key>", and the
+// handlers then only see that tenant's storage. Outside multi-tenant mode,
+// and for in-process warm-up requests, which are never stored, it does
+// nothing.
+func requireTenant(c *gin.Context) {
+	if tenants == nil || isWarmup(c.Request.Context()) {
+		c.Next()
+		return
+	}
+	apiKey, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	t := tenantKeys[sha256.Sum256([]byte(apiKey))]
+	if !ok || apiKey == "" || t == nil {
+		c.Header("WWW-Authenticate", `Bearer realm="avro-json"`)
+		respondError(c, http.StatusUnauthorized, codeUnauthorized, "A valid tenant API key is required")
+		return
+	}
+	c.Set(tenantContextKey, t)
+	c.Next()
+}
+
+// requestTenant returns the tenant requireTenant authenticated, or nil.
+func requestTenant(c *gin.Context) *tenant {
+	t, _ := c.Get(tenantContextKey)
+	tt, _ := t.(*tenant)
+	return tt
+}
+
+// checkTenantProject rejects a log for another project than the caller's
+// tenant with 403.
+func checkTenantProject(c *gin.Context, project string) bool {
+	t := requestTenant(c)
+	if t == nil || t.project == project {
+		return true
+	}
+	respondError(c, http.StatusForbidden, codeForbidden, fmt.Sprintf("API key is not valid for project %q", project))
+	return false
+}
+
+// tenantStores is the OCF store of a sink in multi-tenant mode: one
+// ocfStore per project in <dir>/<project>, sealed with the project's key,
+// opened on the project's first log.
+type tenantStores struct {
+	dir      string
+	tuning   ocfTuning
+	onClosed func(path string)
+	// indexed gives each store a log index; the file sink's stores are.
+	indexed bool
+
+	mu       sync.Mutex
+	projects map[string]*ocfStore
+}
+
+func newTenantStores(dir string, tuning ocfTuning, onClosed func(string)) (*tenantStores, error) {
+	if _, _, err := parseOCFCompression(tuning.Compression); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &tenantStores{dir: dir, tuning: tuning, onClosed: onClosed, projects: make(map[string]*ocfStore)}, nil
+}
+
+// store returns the store of project, which must be a tenant.
+func (s *tenantStores) store(project string) (*ocfStore, error) {
+	t := tenants[project]
+	if t == nil {
+		return nil, fmt.Errorf("project %q is not a tenant", project)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if store, ok := s.projects[project]; ok {
+		return store, nil
+	}
+	store := &ocfStore{key: t.key}
+	if s.indexed {
+		store.index = newLogIndex()
+	}
+	if err := store.open(filepath.Join(s.dir, project), s.tuning, s.onClosed); err != nil {
+		return nil, err
+	}
+	s.projects[project] = store
+	return store, nil
+}
+
+func (s *tenantStores) sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var errs []error
+	for _, store := range s.projects {
+		errs = append(errs, store.sync())
+	}
+	return errors.Join(errs...)
+}
+
+func (s *tenantStores) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var errs []error
+	for _, store := range s.projects {
+		errs = append(errs, store.close())
+	}
+	return errors.Join(errs...)
+}
+
+func (s *tenantStores) openFiles() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var paths []string
+	for _, store := range s.projects {
+		paths = append(paths, store.openFiles()...)
+	}
+	return paths
+}
+
+func (s *tenantStores) stats() gin.H {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := gin.H{}
+	for project, store := range s.projects {
+		stats[project] = store.stats()
+	}
+	return stats
+}
+
+// tenantLogs is the file sink's store in multi-tenant mode, nil otherwise.
+var tenantLogs *tenantStores
+
+// requestOCFStore returns the OCF store a request reads and imports into:
+// the caller's project store in multi-tenant mode, otherwise the file
+// sink's. It answers 404 and returns nil when there is no file sink.
+func requestOCFStore(c *gin.Context) *ocfStore {
+	var store *ocfStore
+	var err error
+	if t := requestTenant(c); t != nil && tenantLogs != nil {
+		store, err = tenantLogs.store(t.project)
+	} else if t == nil && ocfLogs.wrapper != nil {
+		store = &ocfLogs
+	}
+	if err != nil {
+		requestLogger(c).Error("Failed to open tenant OCF store", zap.Error(err))
+		respondError(c, http.StatusInternalServerError, codeStorageFailed, "Failed to open OCF storage")
+		return nil
+	}
+	if store == nil {
+		respondError(c, http.StatusNotFound, codeNotFound, "OCF storage is disabled")
+	}
+	return store
+}
+
+// requestArtifacts returns the artifact store of a request's logs: the
+// caller's project store in multi-tenant mode, otherwise artifactStore. It
+// is nil when artifact storage is disabled.
+func requestArtifacts(c *gin.Context) (*artifact.Store, error) {
+	t := requestTenant(c)
+	if t == nil {
+		if tenants != nil {
+			// Warm-up requests are never stored.
+			return nil, nil
+		}
+		return artifactStore, nil
+	}
+	return t.artifactStore()
+}
+
+func (t *tenant) artifactStore() (*artifact.Store, error) {
+	if tenantArtifactDir == "" {
+		return nil, nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.artifacts == nil {
+		store, err := artifact.OpenSealed(filepath.Join(tenantArtifactDir, t.project), t.key)
+		if err != nil {
+			return nil, err
+		}
+		t.artifacts = store
+	}
+	return t.artifacts, nil
+}
+
+// openArtifactStores returns every open artifact store: artifactStore, or
+// the tenants' stores opened so far.
+func openArtifactStores() []*artifact.Store {
+	if tenants == nil {
+		if artifactStore == nil {
+			return nil
+		}
+		return []*artifact.Store{artifactStore}
+	}
+	var stores []*artifact.Store
+	for _, t := range tenants {
+		t.mu.Lock()
+		if t.artifacts != nil {
+			stores = append(stores, t.artifacts)
+		}
+		t.mu.Unlock()
+	}
+	return stores
+}
+
+// tenantStatus reports each tenant's artifact totals for /stats.
+func tenantStatus() gin.H {
+	status := gin.H{}
+	for project, t := range tenants {
+		entry := gin.H{}
+		t.mu.Lock()
+		if t.artifacts != nil {
+			entry["artifacts"] = t.artifacts.Stats()
+			entry["artifact_filters"] = t.artifacts.FilterStats()
+			if artifactRetention.Enabled() {
+				entry["artifact_retention"] = t.artifacts.RetentionStats()
+			}
+		}
+		t.mu.Unlock()
+		status[project] = entry
+	}
+	return status
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func writeTenantFile(t *testing.T, config string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "tenants.json")
+	if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to write tenant file: %v", err)
+	}
+	return path
+}
+
+func resetTenants() {
+	tenants, tenantKeys, tenantLogs, tenantArtifactDir = nil, nil, nil, ""
+}
+
+func TestLoadTenants(t *testing.T) {
+	logger = zap.NewNop()
+	defer resetTenants()
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+	cases := []struct {
+		name, config, wantErr string
+	}{
+		{"no tenants", `{"tenants": []}`, "no tenants"},
+		{"path project", `{"tenants": [{"project": "../etc", "api_keys": ["k"], "encryption_key": "` + key + `"}]}`, "project"},
+		{"short key", `{"tenants": [{"project": "a", "api_keys": ["k"], "encryption_key": "c2hvcnQ="}]}`, "32"},
+		{"no api keys", `{"tenants": [{"project": "a", "encryption_key": "` + key + `"}]}`, "api_keys"},
+		{"shared api key", `{"tenants": [{"project": "a", "api_keys": ["k"], "encryption_key": "` + key + `"}, {"project": "b", "api_keys": ["k"], "encryption_key": "` + key + `"}]}`, "unique"},
+		{"unknown field", `{"tenants": [{"project": "a", "api_keys": ["k"], "encryption_key": "` + key + `", "bucket": "x"}]}`, "bucket"},
+	}
+	for _, c := range cases {
+		if err := loadTenants(writeTenantFile(t, c.config)); err == nil || !strings.Contains(err.Error(), c.wantErr) {
+			t.Errorf("%s: expected an error mentioning %q, got %v", c.name, c.wantErr, err)
+		}
+	}
+	if tenants != nil {
+		t.Error("expected failed loads to leave multi-tenant mode off")
+	}
+}
+
+func TestTenantIsolation(t *testing.T) {
+	logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	defer resetTenants()
+	defer func() { sinks = nil }()
+	if err := openSchemaRegistry(""); err != nil {
+		t.Fatalf("Failed to open schema registry: %v", err)
+	}
+	keyA := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+	keyB := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, 32))
+	config := `{"tenants": [
+		{"project": "alpha", "api_keys": ["alpha-key"], "encryption_key": "` + keyA + `"},
+		{"project": "beta", "api_keys": ["beta-key"], "encryption_key": "` + keyB + `"}]}`
+	if err := loadTenants(writeTenantFile(t, config)); err != nil {
+		t.Fatalf("Failed to load tenants: %v", err)
+	}
+	ocfDir, artifactDir := t.TempDir(), t.TempDir()
+	if err := openArtifactStore(artifactDir); err != nil {
+		t.Fatalf("Failed to open artifact store: %v", err)
+	}
+	if err := openFlagSinks(fileSinkConfig{Dir: ocfDir}, s3SinkOptions{}, dbSinkConfig{}); err != nil {
+		t.Fatalf("Failed to open sinks: %v", err)
+	}
+
+	r := gin.New()
+	r.POST("/log", requireTenant, logHandler)
+	r.GET("/logs/replay", requireTenant, replayHandler)
+	r.GET("/logs/export", requireTenant, exportHandler)
+	r.GET("/logs/:id/artifact", requireTenant, artifactHandler)
+	send := func(method, target, apiKey string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if apiKey != "" {
+			req.Header.Set("Authorization", "Bearer "+apiKey)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	logFor := func(project string) []byte {
+		req := warmupPayload(1)
+		req.ProjectName = project
+		req.LogBody.Issuer = project + "-issuer"
+		body, _ := json.Marshal(req)
+		return body
+	}
+
+	if w := send(http.MethodPost, "/log", "", logFor("alpha")); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a key, got %d", w.Code)
+	}
+	if w := send(http.MethodPost, "/log", "wrong", logFor("alpha")); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for an unknown key, got %d", w.Code)
+	}
+	if w := send(http.MethodPost, "/log", "beta-key", logFor("alpha")); w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for another project's key, got %d: %s", w.Code, w.Body.String())
+	}
+	w := send(http.MethodPost, "/log", "alpha-key", logFor("alpha"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected the log to be stored, got %d: %s", w.Code, w.Body.String())
+	}
+	id := w.Header().Get("X-Log-ID")
+
+	// Each project's files live in its own directories, encrypted.
+	files, _ := filepath.Glob(filepath.Join(ocfDir, "alpha", "logdata-*.avro"))
+	if len(files) != 1 {
+		t.Fatalf("expected alpha's log data stream in its own directory, found %v", files)
+	}
+	data, _ := os.ReadFile(files[0])
+	if bytes.Contains(data, []byte("alpha-issuer")) || bytes.Contains(data, []byte("LogData")) {
+		t.Error("expected the OCF file to be encrypted")
+	}
+	if _, err := os.Stat(filepath.Join(artifactDir, "alpha", "manifests", id+".json")); err != nil {
+		t.Errorf("expected alpha's artifacts in its own directory: %v", err)
+	}
+
+	// alpha reads its log back; beta sees nothing of it.
+	if w := send(http.MethodGet, "/logs/replay?stream=logdata", "alpha-key", nil); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "alpha-issuer") {
+		t.Errorf("expected alpha to replay its log, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := send(http.MethodGet, "/logs/replay", "beta-key", nil); w.Code != http.StatusOK || strings.Contains(w.Body.String(), "alpha") {
+		t.Errorf("expected beta's replay to be empty, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := send(http.MethodGet, "/logs/export?format=ndjson", "alpha-key", nil); !strings.Contains(w.Body.String(), "alpha-issuer") {
+		t.Errorf("expected alpha to export its log, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := send(http.MethodGet, "/logs/export?format=ndjson", "beta-key", nil); strings.Contains(w.Body.String(), "alpha") {
+		t.Errorf("expected beta's export to exclude alpha's log: %s", w.Body.String())
+	}
+	if w := send(http.MethodGet, "/logs/"+id+"/artifact?format=original-json", "alpha-key", nil); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "alpha-issuer") {
+		t.Errorf("expected alpha to download its artifact, got %d", w.Code)
+	}
+	if w := send(http.MethodGet, "/logs/"+id+"/artifact?format=original-json", "beta-key", nil); w.Code != http.StatusNotFound {
+		t.Errorf("expected beta to get 404 for alpha's artifact, got %d", w.Code)
+	}
+	if w := send(http.MethodGet, "/logs/replay", "", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected replay without a key to be rejected, got %d", w.Code)
+	}
+}
+
+func TestTenantTransportsCarryAPIKey(t *testing.T) {
+	logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	defer resetTenants()
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+	if err := loadTenants(writeTenantFile(t, `{"tenants": [{"project": "alpha", "api_keys": ["alpha-key"], "encryption_key": "`+key+`"}]}`)); err != nil {
+		t.Fatalf("Failed to load tenants: %v", err)
+	}
+	r := gin.New()
+	r.POST("/log", requireTenant, func(c *gin.Context) { c.String(http.StatusOK, requestTenant(c).project) })
+	r.POST(grpcTransportPath, grpcTransportHandler(r))
+
+	// WebSocket and gRPC messages pass on their connection's Authorization.
+	if status, _ := dispatchRequest(r, "/log", "application/json", nil, "websocket", "127.0.0.1:1", ""); status != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a key, got %d", status)
+	}
+	if status, body := dispatchRequest(r, "/log", "application/json", nil, "websocket", "127.0.0.1:1", "Bearer alpha-key"); status != http.StatusOK || string(body) != "alpha" {
+		t.Errorf("expected alpha's key to pass, got %d: %s", status, body)
+	}
+	frame := buildRequestFrame("/log", nil)
+	message := make([]byte, 5+len(frame))
+	binary.BigEndian.PutUint32(message[1:5], uint32(len(frame)))
+	copy(message[5:], frame)
+	req := httptest.NewRequest(http.MethodPost, grpcTransportPath, bytes.NewReader(message))
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("Authorization", "Bearer alpha-key")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if out := w.Body.Bytes(); len(out) < 7 || binary.BigEndian.Uint16(out[5:7]) != http.StatusOK || string(out[7:]) != "alpha" {
+		t.Errorf("expected the gRPC metadata's key to pass, got %x", out)
+	}
+
+	// TCP and UDP frames have none, so they are refused at startup.
+	fs := newConfigFlagSet()
+	fs.Parse([]string{"-tenant-file", "tenants.json", "-tcp-addr", "", "-udp-addr", ""})
+	if err := validateConfig(fs); err != nil {
+		t.Errorf("expected multi-tenant mode without frame transports to be valid, got %v", err)
+	}
+	fs.Set("udp-addr", ":8082")
+	if err := validateConfig(fs); err == nil || !strings.Contains(err.Error(), "udp-addr") {
+		t.Errorf("expected -udp-addr to be refused with -tenant-file, got %v", err)
+	}
+}
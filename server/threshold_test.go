@@ -6,17 +6,6 @@ import (
 	"testing"
 )
 
-// Simple test structure
-type SimpleRecord struct {
-	ID       int64             `json:"id"`
-	Name     string            `json:"name"`
-	Email    string            `json:"email"`
-	Active   bool              `json:"active"`
-	Score    float64           `json:"score"`
-	Tags     []string          `json:"tags"`
-	Settings map[string]string `json:"settings"`
-}
-
 func TestOptimizationThreshold(t *testing.T) {
 	fmt.Println("\n📊 === Optimization Threshold Analysis ===")
 
@@ -127,25 +116,6 @@ func TestOptimizationThreshold(t *testing.T) {
 	testRecordComplexity(100) // Large array
 }
 
-func generateTestRecords(count int) []SimpleRecord {
-	records := make([]SimpleRecord, count)
-	for i := 0; i < count; i++ {
-		records[i] = SimpleRecord{
-			ID:     int64(i + 1000),
-			Name:   fmt.Sprintf("User_%d", i),
-			Email:  fmt.Sprintf("user%d@example.com", i),
-			Active: i%2 == 0,
-			Score:  float64(60 + (i % 40)),
-			Tags:   []string{fmt.Sprintf("tag_%d", i%5), "common"},
-			Settings: map[string]string{
-				"theme": []string{"light", "dark"}[i%2],
-				"lang":  []string{"ko", "en"}[i%2],
-			},
-		}
-	}
-	return records
-}
-
 func getDataOnlySize(record SimpleRecord) int {
 	// Estimate data-only size (without field names)
 	dataSize := 8 + // id (int64)
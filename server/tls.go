@@ -0,0 +1,115 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// tlsOptions describes the certificates used by the HTTP and TCP listeners.
+// When ClientCAFile is set the server requires clients to present a
+// certificate signed by that CA (mutual TLS).
+type tlsOptions struct {
+	CertFile     string
+	KeyFile      string
+	ClientCAFile string
+	// AllowedSANs restricts accepted client certificates to those carrying
+	// at least one matching DNS, email, URI or IP subject alternative name.
+	AllowedSANs []string
+}
+
+func (o tlsOptions) enabled() bool {
+	return o.CertFile != "" || o.KeyFile != ""
+}
+
+func buildServerTLSConfig(o tlsOptions) (*tls.Config, error) {
+	if !o.enabled() {
+		return nil, nil
+	}
+	if o.CertFile == "" || o.KeyFile == "" {
+		return nil, errors.New("both TLS certificate and key must be provided")
+	}
+
+	cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load server key pair: %w", err)
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if o.ClientCAFile != "" {
+		pool, err := loadCertPool(o.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	if len(o.AllowedSANs) > 0 {
+		if o.ClientCAFile == "" {
+			return nil, errors.New("allowed client SANs require a client CA")
+		}
+		config.VerifyConnection = verifyPeerSAN(o.AllowedSANs)
+	}
+
+	return config, nil
+}
+
+func loadCertPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read CA bundle: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+	return pool, nil
+}
+
+// verifyPeerSAN runs after chain verification and rejects peers whose leaf
+// certificate does not carry one of the allowed subject alternative names.
+func verifyPeerSAN(allowed []string) func(tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return errors.New("no peer certificate presented")
+		}
+		leaf := cs.PeerCertificates[0]
+
+		var sans []string
+		sans = append(sans, leaf.DNSNames...)
+		sans = append(sans, leaf.EmailAddresses...)
+		for _, ip := range leaf.IPAddresses {
+			sans = append(sans, ip.String())
+		}
+		for _, uri := range leaf.URIs {
+			sans = append(sans, uri.String())
+		}
+
+		for _, want := range allowed {
+			for _, got := range sans {
+				if strings.EqualFold(want, got) {
+					return nil
+				}
+			}
+		}
+		return fmt.Errorf("peer certificate SANs %v not in allowed list", sans)
+	}
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
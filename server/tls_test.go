@@ -0,0 +1,148 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+func newTestCert(t *testing.T, cn string, dnsNames []string, parent *testCert, isCA bool) *testCert {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		DNSNames:              dnsNames,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+
+	signer, signerKey := tmpl, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+func (c *testCert) write(t *testing.T, dir, name string) (string, string) {
+	t.Helper()
+
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+	keyDER, _ := x509.MarshalECPrivateKey(c.key)
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return certFile, keyFile
+}
+
+func TestMutualTLSSANVerification(t *testing.T) {
+	dir := t.TempDir()
+
+	ca := newTestCert(t, "test-ca", nil, nil, true)
+	caFile, _ := ca.write(t, dir, "ca")
+	serverCertFile, serverKeyFile := newTestCert(t, "server", []string{"localhost"}, ca, false).write(t, dir, "server")
+
+	config, err := buildServerTLSConfig(tlsOptions{
+		CertFile:     serverCertFile,
+		KeyFile:      serverKeyFile,
+		ClientCAFile: caFile,
+		AllowedSANs:  []string{"ue-client.internal"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to build server TLS config: %v", err)
+	}
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.(*tls.Conn).Handshake()
+				conn.Write([]byte("ok"))
+			}()
+		}
+	}()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	dial := func(client *testCert) error {
+		clientConfig := &tls.Config{RootCAs: roots, ServerName: "localhost"}
+		if client != nil {
+			clientConfig.Certificates = []tls.Certificate{{
+				Certificate: [][]byte{client.der},
+				PrivateKey:  client.key,
+			}}
+		}
+		conn, err := tls.Dial("tcp", ln.Addr().String(), clientConfig)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		// TLS 1.3 reports client certificate rejection on the first read.
+		_, err = conn.Read(make([]byte, 2))
+		return err
+	}
+
+	if err := dial(newTestCert(t, "allowed", []string{"ue-client.internal"}, ca, false)); err != nil {
+		t.Errorf("expected allowed SAN to be accepted, got %v", err)
+	}
+	if err := dial(newTestCert(t, "other", []string{"other.internal"}, ca, false)); err == nil {
+		t.Error("expected certificate with unknown SAN to be rejected")
+	}
+	if err := dial(nil); err == nil {
+		t.Error("expected connection without client certificate to be rejected")
+	}
+
+	untrusted := newTestCert(t, "rogue-ca", nil, nil, true)
+	if err := dial(newTestCert(t, "rogue", []string{"ue-client.internal"}, untrusted, false)); err == nil {
+		t.Error("expected certificate from an untrusted CA to be rejected")
+	}
+}
+
+func TestBuildServerTLSConfigValidation(t *testing.T) {
+	if config, err := buildServerTLSConfig(tlsOptions{}); config != nil || err != nil {
+		t.Errorf("expected TLS to stay disabled, got %v, %v", config, err)
+	}
+	if _, err := buildServerTLSConfig(tlsOptions{CertFile: "server.crt"}); err == nil {
+		t.Error("expected missing key to be rejected")
+	}
+}
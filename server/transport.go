@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Frame layout shared by the TCP, UDP and gRPC transports:
+//
+//	request:  [2 bytes path length][path][body]
+//	response: [2 bytes HTTP status][body]
+//
+// TCP additionally prefixes every frame with a 4 byte big-endian length.
+// The path is dispatched to the regular gin routes so every transport hits
+// exactly the same handlers as plain HTTP.
+const (
+	grpcTransportPath = "/exp.avrojson.Transport/Call"
+	maxFrameSize      = 64 << 20
+	maxDatagramSize   = 65507
+)
+
+func decodeRequestFrame(frame []byte) (string, []byte, error) {
+	if len(frame) < 2 {
+		return "", nil, errors.New("frame too short")
+	}
+	pathLen := int(binary.BigEndian.Uint16(frame[:2]))
+	if len(frame) < 2+pathLen {
+		return "", nil, errors.New("frame path truncated")
+	}
+	return string(frame[2 : 2+pathLen]), frame[2+pathLen:], nil
+}
+
+func encodeResponseFrame(status int, body []byte) []byte {
+	frame := make([]byte, 2+len(body))
+	binary.BigEndian.PutUint16(frame[:2], uint16(status))
+	copy(frame[2:], body)
+	return frame
+}
+
+// frameRecorder is a minimal http.ResponseWriter that buffers a handler's output.
+type frameRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *frameRecorder) Header() http.Header         { return r.header }
+func (r *frameRecorder) Write(b []byte) (int, error) { return r.body.Write(b) }
+func (r *frameRecorder) WriteHeader(status int)      { r.status = status }
+
+// dispatchFrame runs a decoded request frame through the HTTP handler and
+// returns the encoded response frame.
+func dispatchFrame(handler http.Handler, frame []byte, transport, remote, authorization string) []byte {
+	path, body, err := decodeRequestFrame(frame)
+	if err != nil {
+		return encodeResponseFrame(http.StatusBadRequest, errorBody(codeInvalidRequest, err.Error()))
+	}
+	return encodeResponseFrame(dispatchRequest(handler, path, "application/json", body, transport, remote, authorization))
+}
+
+// dispatchRequest POSTs body to path on the HTTP handler and returns the
+// response status and body. authorization is the Authorization header of
+// the HTTP request the transport arrived on, so that requireTenant sees the
+// caller's API key; the TCP and UDP frames have none and pass "".
+func dispatchRequest(handler http.Handler, path, contentType string, body []byte, transport, remote, authorization string) (int, []byte) {
+	req, err := http.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	if err != nil {
+		return http.StatusBadRequest, errorBody(codeInvalidRequest, err.Error())
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-Transport", transport)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	req.RemoteAddr = remote
+
+	rec := &frameRecorder{header: make(http.Header), status: http.StatusOK}
+	handler.ServeHTTP(rec, req)
+	return rec.status, rec.body.Bytes()
+}
+
+// serveTCPTransport accepts length-prefixed frames on addr until the listener
+// fails. A non-nil tlsConfig wraps the listener in TLS.
+func serveTCPTransport(addr string, handler http.Handler, tlsConfig *tls.Config) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	if tlsConfig != nil {
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+	logger.Info("TCP frame transport listening", zap.String("addr", addr), zap.Bool("tls", tlsConfig != nil))
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go handleTCPConn(conn, handler)
+	}
+}
+
+func handleTCPConn(conn net.Conn, handler http.Handler) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	remote := conn.RemoteAddr().String()
+
+	for {
+		var size uint32
+		if err := binary.Read(reader, binary.BigEndian, &size); err != nil {
+			if !errors.Is(err, io.EOF) {
+				logger.Warn("TCP frame read failed", zap.String("remote", remote), zap.Error(err))
+			}
+			return
+		}
+		if size > maxFrameSize {
+			logger.Warn("TCP frame too large", zap.String("remote", remote), zap.Uint32("size", size))
+			return
+		}
+
+		frame := make([]byte, size)
+		if _, err := io.ReadFull(reader, frame); err != nil {
+			logger.Warn("TCP frame truncated", zap.String("remote", remote), zap.Error(err))
+			return
+		}
+
+		start := time.Now()
+		resp := dispatchFrame(handler, frame, "tcp", remote, "")
+
+		out := make([]byte, 4+len(resp))
+		binary.BigEndian.PutUint32(out[:4], uint32(len(resp)))
+		copy(out[4:], resp)
+		if _, err := conn.Write(out); err != nil {
+			logger.Warn("TCP frame write failed", zap.String("remote", remote), zap.Error(err))
+			return
+		}
+		logger.Debug("TCP frame processed",
+			zap.String("remote", remote),
+			zap.Int("request_bytes", len(frame)),
+			zap.Int("response_bytes", len(resp)),
+			zap.Duration("duration", time.Since(start)))
+	}
+}
+
+// serveUDPTransport handles one request frame per datagram. Responses larger
+// than a single datagram are replaced with a 413 frame.
+func serveUDPTransport(addr string, handler http.Handler) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	logger.Info("UDP frame transport listening", zap.String("addr", addr))
+
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, remote, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+
+		frame := make([]byte, n)
+		copy(frame, buf[:n])
+
+		go func(remote net.Addr, frame []byte) {
+			resp := dispatchFrame(handler, frame, "udp", remote.String(), "")
+			if len(resp) > maxDatagramSize {
+				resp = encodeResponseFrame(http.StatusRequestEntityTooLarge,
+					errorBody(codeResponseTooLarge, fmt.Sprintf("response of %d bytes exceeds UDP datagram size", len(resp))))
+			}
+			if _, err := conn.WriteTo(resp, remote); err != nil {
+				logger.Warn("UDP frame write failed", zap.String("remote", remote.String()), zap.Error(err))
+			}
+		}(remote, frame)
+	}
+}
+
+// grpcTransportHandler implements a unary gRPC method whose request and
+// response messages are the raw frames described above. It lets the client
+// measure gRPC framing overhead without a protobuf toolchain.
+func grpcTransportHandler(handler http.Handler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		message, err := readGRPCMessage(c.Request.Body)
+		if err != nil {
+			writeGRPCStatus(c, grpcInvalidArgument, err.Error())
+			return
+		}
+
+		writeGRPCMessage(c, dispatchFrame(handler, message, "grpc", c.Request.RemoteAddr, c.GetHeader("Authorization")))
+	}
+}
+
+// writeGRPCMessage answers a unary call with one uncompressed message and
+// an OK status in the trailers.
+func writeGRPCMessage(c *gin.Context, message []byte) {
+	c.Header("Content-Type", "application/grpc")
+	c.Header("Trailer", "Grpc-Status, Grpc-Message")
+	c.Status(http.StatusOK)
+	prefix := make([]byte, 5)
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(message)))
+	c.Writer.Write(prefix)
+	c.Writer.Write(message)
+	c.Writer.Header().Set("Grpc-Status", "0")
+	c.Writer.Header().Set("Grpc-Message", "")
+}
+
+func readGRPCMessage(r io.Reader) ([]byte, error) {
+	prefix := make([]byte, 5)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return nil, fmt.Errorf("read gRPC message prefix: %w", err)
+	}
+	if prefix[0] != 0 {
+		return nil, errors.New("compressed gRPC messages are not supported")
+	}
+	size := binary.BigEndian.Uint32(prefix[1:])
+	if size > maxFrameSize {
+		return nil, fmt.Errorf("gRPC message of %d bytes exceeds limit", size)
+	}
+	message := make([]byte, size)
+	if _, err := io.ReadFull(r, message); err != nil {
+		return nil, fmt.Errorf("read gRPC message: %w", err)
+	}
+	return message, nil
+}
+
+func writeGRPCStatus(c *gin.Context, code int, message string) {
+	c.Header("Content-Type", "application/grpc")
+	c.Header("Grpc-Status", fmt.Sprintf("%d", code))
+	c.Header("Grpc-Message", message)
+	c.Status(http.StatusOK)
+}
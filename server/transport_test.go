@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func newTransportTestEngine() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	logger = zap.NewNop()
+
+	r := gin.New()
+	r.POST("/ping", pingHandler)
+	return r
+}
+
+func buildRequestFrame(path string, body []byte) []byte {
+	frame := make([]byte, 2+len(path)+len(body))
+	binary.BigEndian.PutUint16(frame[:2], uint16(len(path)))
+	copy(frame[2:], path)
+	copy(frame[2+len(path):], body)
+	return frame
+}
+
+func TestDispatchFrame(t *testing.T) {
+	r := newTransportTestEngine()
+
+	resp := dispatchFrame(r, buildRequestFrame("/ping", []byte(`{"data":"hello"}`)), "test", "127.0.0.1:1", "")
+	if status := binary.BigEndian.Uint16(resp[:2]); status != http.StatusOK {
+		t.Fatalf("expected status 200, got %d (%s)", status, resp[2:])
+	}
+
+	var ping PingResponse
+	if err := json.Unmarshal(resp[2:], &ping); err != nil {
+		t.Fatalf("Failed to parse ping response: %v", err)
+	}
+	if ping.Echo != "hello" {
+		t.Errorf("expected echo %q, got %v", "hello", ping.Echo)
+	}
+
+	resp = dispatchFrame(r, []byte{0x00}, "test", "127.0.0.1:1", "")
+	if status := binary.BigEndian.Uint16(resp[:2]); status != http.StatusBadRequest {
+		t.Errorf("expected status 400 for truncated frame, got %d", status)
+	}
+}
+
+func TestTCPTransportRoundTrip(t *testing.T) {
+	r := newTransportTestEngine()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		handleTCPConn(conn, r)
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	// The handler logs until it sees the connection close, so wait for it
+	// before another test swaps the logger.
+	defer func() {
+		conn.Close()
+		<-served
+	}()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// Two requests on the same connection to make sure framing stays in sync.
+	for i := 0; i < 2; i++ {
+		frame := buildRequestFrame("/ping", []byte(`{"data":1}`))
+		out := make([]byte, 4+len(frame))
+		binary.BigEndian.PutUint32(out[:4], uint32(len(frame)))
+		copy(out[4:], frame)
+		if _, err := conn.Write(out); err != nil {
+			t.Fatalf("Failed to write frame: %v", err)
+		}
+
+		var size uint32
+		if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+			t.Fatalf("Failed to read response size: %v", err)
+		}
+		resp := make([]byte, size)
+		if _, err := io.ReadFull(conn, resp); err != nil {
+			t.Fatalf("Failed to read response: %v", err)
+		}
+		if status := binary.BigEndian.Uint16(resp[:2]); status != http.StatusOK {
+			t.Fatalf("request %d: expected status 200, got %d", i, status)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+)
+
+// Avro JSON wraps union values as {"<branch>": value}, so a nullable
+// metadata map reads {"map": {...}} to JSON consumers that do not know the
+// schema. ?unions= selects the form per request: wrapped, the default,
+// keeps the encoding the specification defines; plain strips the wrappers
+// from the Avro JSON /log and /log/binary echo and lets /log/binary
+// LogWrapper bodies carry log data JSON without them. The Avro JSON
+// returned for Accept: application/avro+json is never rewritten.
+const (
+	unionsWrapped = "wrapped"
+	unionsPlain   = "plain"
+)
+
+// requestPlainUnions reports whether the request asked for plain unions.
+func requestPlainUnions(c *gin.Context) (bool, error) {
+	switch v := c.Query("unions"); v {
+	case "", unionsWrapped:
+		return false, nil
+	case unionsPlain:
+		return true, nil
+	default:
+		return false, fmt.Errorf("unknown unions form %q (expected wrapped or plain)", v)
+	}
+}
+
+// plainLogJSON returns the Avro JSON of encoded without union wrappers.
+// The wrapper's body, log data JSON itself, is replaced by its plain form.
+func plainLogJSON(encoded *avrojson.EncodedLog) (wrapperJSON, logDataJSON []byte, err error) {
+	logDataCodec, err := avrojson.DefaultCache.Get(encoded.LogDataSchema)
+	if err != nil {
+		return nil, nil, err
+	}
+	if logDataJSON, err = logDataCodec.StripUnionsJSON(encoded.LogDataJSON); err != nil {
+		return nil, nil, fmt.Errorf("strip log data unions: %w", err)
+	}
+	wrapperCodec, err := avrojson.DefaultCache.Get(avrojson.WrapperSchema)
+	if err != nil {
+		return nil, nil, err
+	}
+	text, err := wrapperCodec.StripUnionsJSON(encoded.WrapperJSON)
+	if err != nil {
+		return nil, nil, fmt.Errorf("strip wrapper unions: %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(text))
+	dec.UseNumber()
+	var wrapper map[string]interface{}
+	if err := dec.Decode(&wrapper); err != nil {
+		return nil, nil, err
+	}
+	wrapper["body"] = string(logDataJSON)
+	var out bytes.Buffer
+	enc := json.NewEncoder(&out)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(wrapper); err != nil {
+		return nil, nil, err
+	}
+	return bytes.TrimSuffix(out.Bytes(), []byte("\n")), logDataJSON, nil
+}
+
+// wrapPlainBody re-encodes a LogWrapper datum whose body is log data JSON
+// of bodySchema without union wrappers, adding them, so the datum decodes
+// like any other.
+func wrapPlainBody(datum []byte, bodySchema string) ([]byte, error) {
+	var wrapper avrojson.LogWrapper
+	if err := avrojson.Decode(avrojson.WrapperSchema, datum, &wrapper); err != nil {
+		return nil, err
+	}
+	codec, err := avrojson.DefaultCache.Get(bodySchema)
+	if err != nil {
+		return nil, err
+	}
+	body, err := codec.WrapUnionsJSON([]byte(wrapper.Body))
+	if err != nil {
+		return nil, fmt.Errorf("decode log data: %w", err)
+	}
+	wrapper.Body = string(body)
+	return avrojson.Encode(avrojson.WrapperSchema, wrapper)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+)
+
+func TestPlainUnions(t *testing.T) {
+	r := newBinaryTestEngine()
+
+	// A wrapper whose body leaves the metadata union unwrapped.
+	datum, err := avrojson.Encode(avrojson.WrapperSchema, avrojson.LogWrapper{
+		ProjectName:    "game-server",
+		ProjectVersion: "1.0.0",
+		LogLevel:       "info",
+		LogType:        "user_action",
+		LogSource:      "game_client",
+		Body:           `{"timestamp":1700000000000,"logtype":"user_action","version":"1.0","issuer":"client","metadata":{"level":"12","request_id":"req-1"},"domainData":null}`,
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode wrapper: %v", err)
+	}
+
+	if w := postAvro(r, "/log/binary", "application/avro", datum, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("expected an unwrapped body to be rejected by default, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := postAvro(r, "/log/binary?unions=bare", "application/avro", datum, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown unions form, got %d", w.Code)
+	}
+
+	w := postAvro(r, "/log/binary?unions=plain&echo=full", "application/avro", datum, map[string]string{requestIDHeader: "req-1"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected a plain body to be accepted, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		WrapperJSON string                 `json:"wrapper_avro_json"`
+		LogDataJSON string                 `json:"logdata_avro_json"`
+		Stats       map[string]interface{} `json:"compression_stats"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if !strings.Contains(resp.LogDataJSON, `"metadata":{"level":"12","request_id":"req-1"}`) || strings.Contains(resp.LogDataJSON, `"map"`) {
+		t.Errorf("expected plain log data JSON, got %s", resp.LogDataJSON)
+	}
+	var wrapper avrojson.LogWrapper
+	if err := json.Unmarshal([]byte(resp.WrapperJSON), &wrapper); err != nil || wrapper.Body != resp.LogDataJSON {
+		t.Errorf("expected the wrapper body to hold the plain log data, got %s (%v)", resp.WrapperJSON, err)
+	}
+
+	// The stored encoding is the one a wrapped body gets.
+	encoded, err := avrojson.EncodeLog(avrojson.LogWrapper{ProjectName: "game-server", ProjectVersion: "1.0.0", LogLevel: "info", LogType: "user_action", LogSource: "game_client"},
+		avrojson.LogData{Timestamp: time.UnixMilli(1700000000000).UTC(), Logtype: "user_action", Version: "1.0", Issuer: "client", Metadata: map[string]string{"level": "12", requestIDMetadataKey: "req-1"}})
+	if err != nil {
+		t.Fatalf("Failed to encode log: %v", err)
+	}
+	if got := int(resp.Stats["logdata_avro_size"].(float64)); got != len(encoded.LogData) {
+		t.Errorf("expected log data size %d, got %d", len(encoded.LogData), got)
+	}
+	if got := int(resp.Stats["wrapper_json_size"].(float64)); got != len(encoded.WrapperJSON) {
+		t.Errorf("expected stats to measure the wrapped Avro JSON, got %d want %d", got, len(encoded.WrapperJSON))
+	}
+}
@@ -2,7 +2,8 @@ package main
 
 import (
 	"encoding/json"
-	"reflect"
+
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
 )
 
 // structToMap converts a struct to map[string]interface{} for goavro compatibility
@@ -34,14 +35,8 @@ func mapToStruct(m map[string]interface{}, s interface{}) error {
 	return json.Unmarshal(jsonBytes, s)
 }
 
-// getStructSchema generates Avro schema from Go struct using reflection
-func getStructSchema(s interface{}) string {
-	t := reflect.TypeOf(s)
-	if t.Kind() == reflect.Ptr {
-		t = t.Elem()
-	}
-	
-	// This is a simplified version - in production you'd want a more robust schema generator
-	// For now, we'll use the predefined schemas
-	return ""
-}
\ No newline at end of file
+// getStructSchema generates an Avro schema from a Go struct using reflection.
+// See avrojson.SchemaOf for the type mapping and supported tags.
+func getStructSchema(s interface{}) (string, error) {
+	return avrojson.SchemaOf(s)
+}
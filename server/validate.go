@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+	"go.uber.org/zap"
+)
+
+// validateRequest is the body of POST /validate.
+type validateRequest struct {
+	// Schema and Version name a registered schema, version 0 meaning the
+	// latest. AvroSchema is an inline schema instead, as a JSON value or a
+	// string holding one.
+	Schema     string          `json:"schema"`
+	Version    int             `json:"version"`
+	AvroSchema json.RawMessage `json:"avro_schema"`
+	// Document is the JSON datum to check, in Avro JSON unless
+	// PlainUnions is set.
+	Document    json.RawMessage `json:"document" binding:"required"`
+	PlainUnions bool            `json:"plain_unions"`
+}
+
+// validateHandler checks a JSON document against a schema and reports
+// every field that breaks it, with its path, the expected type and the
+// JSON type found, without encoding or storing anything. A document that
+// does not fit is still a successful request: the answer is 200 with
+// "valid": false.
+func validateHandler(c *gin.Context) {
+	var req validateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	resp := gin.H{}
+	var codec *avrojson.Codec
+	switch {
+	case req.Schema != "" && len(req.AvroSchema) > 0:
+		respondErrorWith(c, http.StatusBadRequest, apiError{Code: codeInvalidRequest, Message: "schema and avro_schema are exclusive", Field: "avro_schema"}, nil)
+		return
+	case len(req.AvroSchema) > 0:
+		schema := string(req.AvroSchema)
+		var quoted string
+		if json.Unmarshal(req.AvroSchema, &quoted) == nil {
+			schema = quoted
+		}
+		// Inline schemas are compiled for this request only, so they do
+		// not fill the shared codec cache.
+		var err error
+		if codec, err = avrojson.NewCodec(schema); err != nil {
+			respondErrorWith(c, http.StatusBadRequest, apiError{Code: codeInvalidRequest, Message: "Invalid schema: " + err.Error(), Field: "avro_schema"}, nil)
+			return
+		}
+	case req.Schema != "":
+		s, err := resolveSchema(req.Schema, req.Version)
+		if err != nil {
+			respondErrorWith(c, http.StatusBadRequest, apiError{Code: codeUnknownSchema, Message: "Unknown schema " + strconv.Quote(req.Schema) + " version " + strconv.Itoa(req.Version), Field: "schema"}, nil)
+			return
+		}
+		if codec, err = avrojson.DefaultCache.Get(s.Schema); err != nil {
+			requestLogger(c).Error("Failed to create Avro codec", zap.String("schema", s.Name), zap.Error(err))
+			respondError(c, http.StatusInternalServerError, codeInternal, "Failed to create Avro codec")
+			return
+		}
+		resp["schema"], resp["version"] = s.Name, s.Version
+	default:
+		respondErrorWith(c, http.StatusBadRequest, apiError{Code: codeInvalidRequest, Message: "schema or avro_schema is required", Field: "schema"}, nil)
+		return
+	}
+
+	errs, err := codec.Validate(req.Document, avrojson.ValidateOptions{PlainUnions: req.PlainUnions})
+	if err != nil {
+		respondErrorWith(c, http.StatusBadRequest, apiError{Code: codeInvalidRequest, Message: err.Error(), Field: "document"}, nil)
+		return
+	}
+	if errs == nil {
+		errs = []avrojson.ValidationError{}
+	}
+	resp["valid"] = len(errs) == 0
+	resp["plain_unions"] = req.PlainUnions
+	resp["errors"] = errs
+	c.JSON(http.StatusOK, resp)
+}
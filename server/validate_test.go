@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+	"go.uber.org/zap"
+)
+
+func newValidateTestEngine() *gin.Engine {
+	logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	if err := openSchemaRegistry(""); err != nil {
+		panic(err)
+	}
+	r := gin.New()
+	r.POST("/validate", validateHandler)
+	return r
+}
+
+type validateResponse struct {
+	Valid   bool                       `json:"valid"`
+	Schema  string                     `json:"schema"`
+	Version int                        `json:"version"`
+	Errors  []avrojson.ValidationError `json:"errors"`
+	Code    string                     `json:"code"`
+	Field   string                     `json:"field"`
+}
+
+func postValidate(t *testing.T, r *gin.Engine, body string) (int, validateResponse) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/validate", bytes.NewReader([]byte(body)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var resp validateResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	return w.Code, resp
+}
+
+func TestValidateRegisteredSchema(t *testing.T) {
+	r := newValidateTestEngine()
+
+	status, resp := postValidate(t, r, `{"schema":"LogWrapper","document":{"projectName":"p","projectVersion":"1","body":"{}","logLevel":"info","logType":"t","logSource":"s"}}`)
+	if status != http.StatusOK || !resp.Valid || len(resp.Errors) != 0 {
+		t.Fatalf("expected a valid document, got %d %+v", status, resp)
+	}
+	if resp.Schema != "LogWrapper" || resp.Version != 1 {
+		t.Errorf("expected LogWrapper version 1, got %s version %d", resp.Schema, resp.Version)
+	}
+
+	status, resp = postValidate(t, r, `{"schema":"LogWrapper","document":{"projectName":7,"body":"{}","logLevel":"info","logType":"t","logSource":"s","extra":true}}`)
+	if status != http.StatusOK || resp.Valid {
+		t.Fatalf("expected an invalid document, got %d %+v", status, resp)
+	}
+	want := []avrojson.ValidationError{
+		{Kind: avrojson.ViolationWrongType, Path: "projectName", Expected: "string", Actual: "number"},
+		{Kind: avrojson.ViolationMissingField, Path: "projectVersion", Expected: "string"},
+		{Kind: avrojson.ViolationUnknownField, Path: "extra", Actual: "boolean"},
+	}
+	if len(resp.Errors) != len(want) {
+		t.Fatalf("expected %d errors, got %+v", len(want), resp.Errors)
+	}
+	for i, w := range want {
+		got := resp.Errors[i]
+		if got.Kind != w.Kind || got.Path != w.Path || got.Actual != w.Actual || (w.Expected != "" && got.Expected != w.Expected) {
+			t.Errorf("error %d: expected %+v, got %+v", i, w, got)
+		}
+	}
+}
+
+func TestValidateInlineSchema(t *testing.T) {
+	r := newValidateTestEngine()
+	schema := `{"type":"record","name":"Order","fields":[{"name":"lines","type":{"type":"array","items":"int"}},{"name":"note","type":["null","string"]}]}`
+
+	status, resp := postValidate(t, r, `{"avro_schema":`+schema+`,"document":{"lines":[1,"2"],"note":"x"}}`)
+	if status != http.StatusOK || resp.Valid || len(resp.Errors) != 2 {
+		t.Fatalf("expected two errors, got %d %+v", status, resp)
+	}
+	if e := resp.Errors[0]; e.Path != "lines[1]" || e.Expected != "int" || e.Actual != "string" {
+		t.Errorf("unexpected array error %+v", e)
+	}
+	if e := resp.Errors[1]; e.Path != "note" || e.Expected != "union [null, string]" {
+		t.Errorf("unexpected union error %+v", e)
+	}
+
+	// A schema string and plain unions.
+	quoted, _ := json.Marshal(schema)
+	status, resp = postValidate(t, r, `{"avro_schema":`+string(quoted)+`,"plain_unions":true,"document":{"lines":[1],"note":"x"}}`)
+	if status != http.StatusOK || !resp.Valid {
+		t.Fatalf("expected a valid document with plain unions, got %d %+v", status, resp)
+	}
+}
+
+func TestValidateRejectsBadRequests(t *testing.T) {
+	r := newValidateTestEngine()
+	cases := []struct {
+		name, body, code, field string
+	}{
+		{"no schema", `{"document":{}}`, codeInvalidRequest, "schema"},
+		{"both schemas", `{"schema":"LogWrapper","avro_schema":"string","document":"x"}`, codeInvalidRequest, "avro_schema"},
+		{"unknown schema", `{"schema":"Missing","document":{}}`, codeUnknownSchema, "schema"},
+		{"invalid schema", `{"avro_schema":{"type":"nope"},"document":{}}`, codeInvalidRequest, "avro_schema"},
+		{"no document", `{"schema":"LogWrapper"}`, codeValidationFailed, "document"},
+	}
+	for _, tc := range cases {
+		status, resp := postValidate(t, r, tc.body)
+		if status != http.StatusBadRequest || resp.Code != tc.code || resp.Field != tc.field {
+			t.Errorf("%s: expected 400 %s on %s, got %d %s on %s", tc.name, tc.code, tc.field, status, resp.Code, resp.Field)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/homveloper/exp-avro-json/server/pkg/avrojson"
+	"go.uber.org/zap"
+)
+
+// Warm-up pushes synthetic logs through the full HTTP pipeline (routing,
+// binding, codec cache, encoding, response rendering) so that benchmark
+// runs start from a steady state: codecs compiled, pools and maps grown,
+// the first GC cycles done. Afterwards the heap is collected and, in
+// measurement mode, the codec metrics are reset so /stats only reflects
+// the measured traffic.
+
+type warmupKey struct{}
+
+// isWarmup reports whether ctx belongs to a synthetic warm-up request.
+// Warm-up requests are not logged and not published to the demo broker.
+func isWarmup(ctx context.Context) bool {
+	return ctx.Value(warmupKey{}) != nil
+}
+
+type warmupReport struct {
+	StartedAt    time.Time     `json:"started_at"`
+	Requests     int           `json:"requests"`
+	Failures     int           `json:"failures"`
+	FirstError   string        `json:"first_error,omitempty"`
+	Duration     time.Duration `json:"duration_ns"`
+	PerRequest   time.Duration `json:"per_request_ns"`
+	GCCycles     uint32        `json:"gc_cycles"`
+	HeapAlloc    uint64        `json:"heap_alloc_bytes"`
+	MetricsReset bool          `json:"metrics_reset"`
+}
+
+var (
+	warmupRunning atomic.Bool
+	warmupMu      sync.RWMutex
+	lastWarmup    *warmupReport
+)
+
+var warmupLevels = []string{"DEBUG", "INFO", "WARN", "ERROR"}
+
+// warmupPayload builds the i-th synthetic request; sizes cycle so that
+// maps and buffers grow to what real traffic needs.
+func warmupPayload(i int) LogRequest {
+	domain := map[string]interface{}{"sequence": strconv.Itoa(i)}
+	for j := 0; j < (i%3)*16; j++ {
+		domain[fmt.Sprintf("field_%d", j)] = strings.Repeat("x", 8+j)
+	}
+	return LogRequest{
+		ProjectName:    "warmup",
+		ProjectVersion: "1.0.0",
+		LogLevel:       warmupLevels[i%len(warmupLevels)],
+		LogType:        "warmup",
+		LogSource:      "server",
+		LogBody: LogData{
+			Timestamp:  time.Now().UnixMilli(),
+			Logtype:    "warmup",
+			Version:    "1.0.0",
+			Issuer:     "warmup",
+			Metadata:   map[string]interface{}{"iteration": strconv.Itoa(i)},
+			DomainData: domain,
+		},
+	}
+}
+
+// runWarmup sends n requests through handler, alternating between /log and
+// /log/binary. It returns an error when another warm-up is in progress.
+func runWarmup(ctx context.Context, handler http.Handler, n int, resetMetrics bool) (warmupReport, error) {
+	if !warmupRunning.CompareAndSwap(false, true) {
+		return warmupReport{}, fmt.Errorf("a warm-up is already running")
+	}
+	defer warmupRunning.Store(false)
+
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+	report := warmupReport{StartedAt: time.Now(), Requests: n}
+	ctx = context.WithValue(ctx, warmupKey{}, true)
+
+	for i := 0; i < n; i++ {
+		if err := ctx.Err(); err != nil {
+			report.Requests = i
+			break
+		}
+		if err := sendWarmupRequest(ctx, handler, i); err != nil {
+			report.Failures++
+			if report.FirstError == "" {
+				report.FirstError = err.Error()
+			}
+		}
+	}
+	report.Duration = time.Since(report.StartedAt)
+	if report.Requests > 0 {
+		report.PerRequest = report.Duration / time.Duration(report.Requests)
+	}
+
+	// Two collections leave the heap at its live size, so the first GC
+	// during measurement is not paying for warm-up garbage.
+	runtime.GC()
+	runtime.GC()
+	var after runtime.MemStats
+	runtime.ReadMemStats(&after)
+	report.GCCycles = after.NumGC - before.NumGC
+	report.HeapAlloc = after.HeapAlloc
+
+	if resetMetrics {
+		avrojson.DefaultMetrics.Reset()
+		report.MetricsReset = true
+	}
+
+	warmupMu.Lock()
+	lastWarmup = &report
+	warmupMu.Unlock()
+	return report, nil
+}
+
+func sendWarmupRequest(ctx context.Context, handler http.Handler, i int) error {
+	payload := warmupPayload(i)
+	path, contentType := "/log", "application/json"
+	var body []byte
+	if i%2 == 0 {
+		var err error
+		if body, err = json.Marshal(payload); err != nil {
+			return err
+		}
+	} else {
+		encoded, err := avrojson.EncodeLog(avrojson.LogWrapper{
+			ProjectName:    payload.ProjectName,
+			ProjectVersion: payload.ProjectVersion,
+			LogLevel:       payload.LogLevel,
+			LogType:        payload.LogType,
+			LogSource:      payload.LogSource,
+		}, avrojson.LogData{
+			Timestamp:  time.UnixMilli(payload.LogBody.Timestamp).UTC(),
+			Logtype:    payload.LogBody.Logtype,
+			Version:    payload.LogBody.Version,
+			Issuer:     payload.LogBody.Issuer,
+			Metadata:   avrojson.StringMap(payload.LogBody.Metadata),
+			DomainData: avrojson.StringMap(payload.LogBody.DomainData),
+		})
+		if err != nil {
+			return err
+		}
+		path, contentType, body = "/log/binary", avroContentType, encoded.Wrapper
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-Transport", "warmup")
+
+	rec := &frameRecorder{header: make(http.Header), status: http.StatusOK}
+	handler.ServeHTTP(rec, req)
+	if rec.status != http.StatusOK {
+		return fmt.Errorf("%s returned %d: %s", path, rec.status, rec.body.String())
+	}
+	return nil
+}
+
+func warmupStatus() *warmupReport {
+	warmupMu.RLock()
+	defer warmupMu.RUnlock()
+	return lastWarmup
+}
+
+func logWarmup(report warmupReport) {
+	logger.Info("Warm-up finished",
+		zap.Int("requests", report.Requests),
+		zap.Int("failures", report.Failures),
+		zap.Duration("duration", report.Duration),
+		zap.Duration("per_request", report.PerRequest),
+		zap.Uint32("gc_cycles", report.GCCycles),
+		zap.Bool("metrics_reset", report.MetricsReset))
+	if report.FirstError != "" {
+		logger.Warn("Warm-up requests failed", zap.String("first_error", report.FirstError))
+	}
+}
+
+// maxWarmupRequests bounds one admin warm-up, which holds up the calling
+// request until it is done.
+const maxWarmupRequests = 100000
+
+// registerWarmupRoutes adds POST /admin/warmup behind the admin token;
+// without one there is no endpoint.
+func registerWarmupRoutes(r *gin.Engine, token string, defaultRequests int) {
+	if token == "" {
+		return
+	}
+	r.POST("/admin/warmup", requireBearerToken(token, "admin token"), warmupHandler(r, defaultRequests))
+}
+
+// warmupHandler serves POST /admin/warmup?requests=N&reset=true, running
+// the warm-up against handler, normally the engine itself.
+func warmupHandler(handler http.Handler, defaultRequests int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		n := defaultRequests
+		if v := c.Query("requests"); v != "" {
+			parsed, err := strconv.Atoi(v)
+			if err != nil || parsed < 1 || parsed > maxWarmupRequests {
+				respondError(c, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("requests must be between 1 and %d", maxWarmupRequests))
+				return
+			}
+			n = parsed
+		}
+		reset := true
+		if v := c.Query("reset"); v != "" {
+			parsed, err := strconv.ParseBool(v)
+			if err != nil {
+				respondError(c, http.StatusBadRequest, codeInvalidRequest, "reset must be a boolean")
+				return
+			}
+			reset = parsed
+		}
+
+		report, err := runWarmup(c.Request.Context(), handler, n, reset)
+		if err != nil {
+			respondError(c, http.StatusConflict, codeConflict, err.Error())
+			return
+		}
+		logWarmup(report)
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// defaultWarmupRequests is the admin call's request count when none is
+// given: the startup count up to maxWarmupRequests, or 1000 when startup
+// warm-up is disabled.
+func defaultWarmupRequests(startup int) int {
+	if startup > 0 {
+		return min(startup, maxWarmupRequests)
+	}
+	return 1000
+}
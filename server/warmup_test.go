@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/homveloper/exp-avro-json/server/broker"
+	"go.uber.org/zap"
+)
+
+func newWarmupTestEngine() *gin.Engine {
+	logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/log", logHandler)
+	r.POST("/log/binary", logBinaryHandler)
+	registerWarmupRoutes(r, "admin", 4)
+	return r
+}
+
+func TestWarmupRunsFullPipeline(t *testing.T) {
+	r := newWarmupTestEngine()
+
+	demoBroker = broker.New(16)
+	defer func() { demoBroker = nil }()
+	messages := demoBroker.Subscribe(demoTopic, demoIndexerGroup)
+
+	report, err := runWarmup(context.Background(), r, 12, true)
+	if err != nil {
+		t.Fatalf("Failed to run warm-up: %v", err)
+	}
+	if report.Requests != 12 || report.Failures != 0 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if !report.MetricsReset || report.GCCycles < 2 {
+		t.Errorf("expected metrics reset and forced GC: %+v", report)
+	}
+	if got := warmupStatus(); got == nil || got.Requests != 12 {
+		t.Errorf("report not kept for /stats: %+v", got)
+	}
+	select {
+	case msg := <-messages:
+		t.Errorf("warm-up record was published to the demo broker: %+v", msg)
+	default:
+	}
+}
+
+// adminRequest returns a request carrying the test engine's admin token.
+func adminRequest(method, target string) *http.Request {
+	req := httptest.NewRequest(method, target, nil)
+	req.Header.Set("Authorization", "Bearer admin")
+	return req
+}
+
+func TestWarmupAdminEndpoint(t *testing.T) {
+	r := newWarmupTestEngine()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, adminRequest(http.MethodPost, "/admin/warmup?reset=false"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var report warmupReport
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if report.Requests != 4 || report.Failures != 0 || report.MetricsReset {
+		t.Errorf("unexpected report: %+v", report)
+	}
+
+	for _, target := range []string{"/admin/warmup?requests=0", "/admin/warmup?requests=100001", "/admin/warmup?reset=maybe"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, adminRequest(http.MethodPost, target))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", target, w.Code)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/warmup", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without the admin token, got %d", w.Code)
+	}
+	unguarded := gin.New()
+	registerWarmupRoutes(unguarded, "", 4)
+	w = httptest.NewRecorder()
+	unguarded.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/warmup", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 without -admin-token, got %d", w.Code)
+	}
+
+	warmupRunning.Store(true)
+	defer warmupRunning.Store(false)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, adminRequest(http.MethodPost, "/admin/warmup"))
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected 409 while a warm-up runs, got %d", w.Code)
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// /ws/log keeps one WebSocket (RFC 6455) open per client, for game clients
+// that hold a persistent connection rather than paying a request per log.
+// Every text message is a /log JSON request and every binary message a
+// /log/binary LogWrapper datum; each is dispatched to the regular routes
+// and answered, in order, with one text message:
+//
+//	{"seq": 1, "status": 200, "response": {"status": "logged", "compression_stats": {...}}}
+//
+// seq counts the client's messages from 1. A failed log answers with its
+// HTTP status and error and leaves the connection open.
+const (
+	websocketPath    = "/ws/log"
+	websocketGUID    = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	websocketIdle    = 5 * time.Minute
+	websocketMaxSize = 1 << 20
+)
+
+// WebSocket opcodes.
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xA
+)
+
+// WebSocket close codes.
+const (
+	wsCloseNormal      = 1000
+	wsCloseProtocol    = 1002
+	wsCloseUnsupported = 1003
+	wsCloseTooBig      = 1009
+)
+
+type websocketReply struct {
+	Seq      uint64          `json:"seq"`
+	Status   int             `json:"status"`
+	Response json.RawMessage `json:"response"`
+}
+
+// websocketLogHandler upgrades the request and serves logs on the
+// connection until the client closes it or stays idle for websocketIdle.
+func websocketLogHandler(handler http.Handler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader("Sec-WebSocket-Key")
+		if !headerContains(c.Request.Header, "Connection", "upgrade") ||
+			!headerContains(c.Request.Header, "Upgrade", "websocket") || key == "" {
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, "WebSocket upgrade required")
+			return
+		}
+		if c.GetHeader("Sec-WebSocket-Version") != "13" {
+			c.Header("Sec-WebSocket-Version", "13")
+			respondError(c, http.StatusUpgradeRequired, codeUpgradeRequired, "Unsupported WebSocket version")
+			return
+		}
+
+		conn, rw, err := c.Writer.Hijack()
+		if err != nil {
+			logger.Error("Failed to hijack WebSocket connection", zap.Error(err))
+			respondError(c, http.StatusInternalServerError, codeInternal, "WebSocket upgrade failed")
+			return
+		}
+		defer conn.Close()
+
+		accept := sha1.Sum([]byte(key + websocketGUID))
+		fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+			base64.StdEncoding.EncodeToString(accept[:]))
+		if err := rw.Flush(); err != nil {
+			logger.Warn("WebSocket handshake write failed", zap.Error(err))
+			return
+		}
+
+		remote := c.Request.RemoteAddr
+		logger.Info("WebSocket log channel opened", zap.String("remote", remote))
+		seq, err := serveWebsocketLogs(conn, rw, handler, remote, c.GetHeader("Authorization"))
+		if err != nil {
+			logger.Warn("WebSocket log channel failed", zap.String("remote", remote), zap.Uint64("messages", seq), zap.Error(err))
+			return
+		}
+		logger.Info("WebSocket log channel closed", zap.String("remote", remote), zap.Uint64("messages", seq))
+	}
+}
+
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, part := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// serveWebsocketLogs reads messages until the connection closes and returns
+// how many it answered. A clean close returns a nil error.
+func serveWebsocketLogs(conn net.Conn, rw *bufio.ReadWriter, handler http.Handler, remote, authorization string) (uint64, error) {
+	var seq uint64
+	var message []byte
+	var messageOp byte
+	for {
+		conn.SetReadDeadline(time.Now().Add(websocketIdle))
+		fin, op, payload, err := readWebsocketFrame(rw.Reader)
+		if err != nil {
+			if errors.Is(err, errWebsocketTooBig) {
+				writeWebsocketClose(rw, wsCloseTooBig, err.Error())
+			} else if errors.Is(err, errWebsocketProtocol) {
+				writeWebsocketClose(rw, wsCloseProtocol, err.Error())
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				writeWebsocketClose(rw, wsCloseNormal, "idle timeout")
+				return seq, nil
+			}
+			if errors.Is(err, io.EOF) {
+				err = nil
+			}
+			return seq, err
+		}
+
+		switch op {
+		case wsPing:
+			if err := writeWebsocketFrame(rw, wsPong, payload); err != nil {
+				return seq, err
+			}
+			continue
+		case wsPong:
+			continue
+		case wsClose:
+			code := wsCloseNormal
+			if len(payload) >= 2 {
+				code = int(binary.BigEndian.Uint16(payload))
+			}
+			writeWebsocketClose(rw, code, "")
+			return seq, nil
+		case wsText, wsBinary:
+			if messageOp != 0 {
+				writeWebsocketClose(rw, wsCloseProtocol, "new message before the previous one finished")
+				return seq, errWebsocketProtocol
+			}
+			messageOp, message = op, payload
+		case wsContinuation:
+			if messageOp == 0 {
+				writeWebsocketClose(rw, wsCloseProtocol, "continuation without a message")
+				return seq, errWebsocketProtocol
+			}
+			if len(message)+len(payload) > websocketMaxSize {
+				writeWebsocketClose(rw, wsCloseTooBig, errWebsocketTooBig.Error())
+				return seq, errWebsocketTooBig
+			}
+			message = append(message, payload...)
+		default:
+			writeWebsocketClose(rw, wsCloseUnsupported, fmt.Sprintf("unsupported opcode %#x", op))
+			return seq, errWebsocketProtocol
+		}
+		if !fin {
+			continue
+		}
+
+		seq++
+		path, contentType := "/log", "application/json"
+		if messageOp == wsBinary {
+			path, contentType = "/log/binary", avroContentType
+		}
+		start := time.Now()
+		status, body := dispatchRequest(handler, path, contentType, message, "websocket", remote, authorization)
+		if !json.Valid(body) {
+			body, _ = json.Marshal(gin.H{"error": string(body)})
+		}
+		reply, _ := json.Marshal(websocketReply{Seq: seq, Status: status, Response: body})
+		if err := writeWebsocketFrame(rw, wsText, reply); err != nil {
+			return seq, err
+		}
+		logger.Debug("WebSocket message processed",
+			zap.String("remote", remote),
+			zap.Uint64("seq", seq),
+			zap.Int("status", status),
+			zap.Int("request_bytes", len(message)),
+			zap.Duration("duration", time.Since(start)))
+		messageOp, message = 0, nil
+	}
+}
+
+var (
+	errWebsocketProtocol = errors.New("websocket protocol error")
+	errWebsocketTooBig   = fmt.Errorf("websocket message exceeds %d bytes", websocketMaxSize)
+)
+
+// readWebsocketFrame reads one client frame, which must be masked, and
+// returns its unmasked payload.
+func readWebsocketFrame(r *bufio.Reader) (fin bool, op byte, payload []byte, err error) {
+	var head [2]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin, op = head[0]&0x80 != 0, head[0]&0x0F
+	if head[0]&0x70 != 0 {
+		return false, 0, nil, fmt.Errorf("%w: reserved bits set", errWebsocketProtocol)
+	}
+	if head[1]&0x80 == 0 {
+		return false, 0, nil, fmt.Errorf("%w: client frame not masked", errWebsocketProtocol)
+	}
+
+	size := uint64(head[1] & 0x7F)
+	switch size {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		size = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		size = binary.BigEndian.Uint64(ext[:])
+	}
+	if op >= wsClose && (size > 125 || !fin) {
+		return false, 0, nil, fmt.Errorf("%w: invalid control frame", errWebsocketProtocol)
+	}
+	if size > websocketMaxSize {
+		return false, 0, nil, errWebsocketTooBig
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(r, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload = make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, op, payload, nil
+}
+
+// writeWebsocketFrame writes one unfragmented, unmasked server frame.
+func writeWebsocketFrame(w *bufio.ReadWriter, op byte, payload []byte) error {
+	head := []byte{0x80 | op, 0}
+	switch n := len(payload); {
+	case n < 126:
+		head[1] = byte(n)
+	case n <= 0xFFFF:
+		head[1] = 126
+		head = binary.BigEndian.AppendUint16(head, uint16(n))
+	default:
+		head[1] = 127
+		head = binary.BigEndian.AppendUint64(head, uint64(n))
+	}
+	if _, err := w.Write(head); err != nil {
+		return err
+	}
+	if _, err := w.Write(payload); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+func writeWebsocketClose(w *bufio.ReadWriter, code int, reason string) {
+	if len(reason) > 123 {
+		reason = reason[:123]
+	}
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	writeWebsocketFrame(w, wsClose, append(payload, reason...))
+}
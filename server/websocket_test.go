@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// dialWebsocket opens /ws/log on srv with a minimal client handshake.
+func dialWebsocket(t *testing.T, srv *httptest.Server) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: test\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n", websocketPath)
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("Failed to read handshake: %v", err)
+	}
+	// The accept value for the RFC 6455 sample nonce.
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("unexpected handshake response: %d %v", resp.StatusCode, resp.Header)
+	}
+	return conn, reader
+}
+
+// writeClientFrame writes a masked frame as a browser would.
+func writeClientFrame(t *testing.T, conn net.Conn, fin bool, op byte, payload []byte) {
+	t.Helper()
+	head := []byte{op, 0x80}
+	if fin {
+		head[0] |= 0x80
+	}
+	if len(payload) < 126 {
+		head[1] |= byte(len(payload))
+	} else {
+		head[1] |= 126
+		head = binary.BigEndian.AppendUint16(head, uint16(len(payload)))
+	}
+	mask := [4]byte{1, 2, 3, 4}
+	head = append(head, mask[:]...)
+	for i, b := range payload {
+		head = append(head, b^mask[i%4])
+	}
+	if _, err := conn.Write(head); err != nil {
+		t.Fatalf("Failed to write frame: %v", err)
+	}
+}
+
+// readServerFrame reads one unmasked frame.
+func readServerFrame(t *testing.T, r *bufio.Reader) (byte, []byte) {
+	t.Helper()
+	var head [2]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		t.Fatalf("Failed to read frame: %v", err)
+	}
+	size := int(head[1] & 0x7F)
+	if size == 126 {
+		var ext [2]byte
+		io.ReadFull(r, ext[:])
+		size = int(binary.BigEndian.Uint16(ext[:]))
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		t.Fatalf("Failed to read frame payload: %v", err)
+	}
+	return head[0] & 0x0F, payload
+}
+
+func TestWebsocketLogChannel(t *testing.T) {
+	logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/log", logHandler)
+	// The server does not wait for hijacked connections, so wait for the
+	// handler before another test swaps the logger.
+	handled := make(chan struct{})
+	ws := websocketLogHandler(r)
+	r.GET(websocketPath, func(c *gin.Context) {
+		defer close(handled)
+		ws(c)
+	})
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	conn, reader := dialWebsocket(t, srv)
+	defer func() {
+		conn.Close()
+		<-handled
+	}()
+
+	body, _ := json.Marshal(warmupPayload(1))
+	for i := 1; i <= 2; i++ {
+		// The second message arrives in two fragments.
+		if i == 1 {
+			writeClientFrame(t, conn, true, wsText, body)
+		} else {
+			writeClientFrame(t, conn, false, wsText, body[:10])
+			writeClientFrame(t, conn, true, wsPing, []byte("hi"))
+			if op, payload := readServerFrame(t, reader); op != wsPong || string(payload) != "hi" {
+				t.Fatalf("expected pong between fragments, got %#x %q", op, payload)
+			}
+			writeClientFrame(t, conn, true, wsContinuation, body[10:])
+		}
+		op, payload := readServerFrame(t, reader)
+		var reply struct {
+			Seq      uint64 `json:"seq"`
+			Status   int    `json:"status"`
+			Response struct {
+				Status string                 `json:"status"`
+				Stats  map[string]interface{} `json:"compression_stats"`
+			} `json:"response"`
+		}
+		if err := json.Unmarshal(payload, &reply); err != nil || op != wsText {
+			t.Fatalf("Failed to parse reply %#x %s: %v", op, payload, err)
+		}
+		if reply.Seq != uint64(i) || reply.Status != http.StatusOK || reply.Response.Status != "logged" || reply.Response.Stats["wrapper_avro_size"] == nil {
+			t.Errorf("unexpected reply %d: %s", i, payload)
+		}
+	}
+
+	writeClientFrame(t, conn, true, wsText, []byte(`{"projectName":1}`))
+	if _, payload := readServerFrame(t, reader); !strings.Contains(string(payload), `"status":400`) {
+		t.Errorf("expected an invalid log to be answered with 400, got %s", payload)
+	}
+
+	writeClientFrame(t, conn, true, wsClose, binary.BigEndian.AppendUint16(nil, wsCloseNormal))
+	if op, payload := readServerFrame(t, reader); op != wsClose || binary.BigEndian.Uint16(payload) != wsCloseNormal {
+		t.Errorf("expected the close to be echoed, got %#x %v", op, payload)
+	}
+}
+
+func TestWebsocketRejectsPlainRequests(t *testing.T) {
+	logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET(websocketPath, websocketLogHandler(r))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, websocketPath, nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without an upgrade, got %d", w.Code)
+	}
+}